@@ -4,9 +4,11 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/exe"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/timestamp"
@@ -18,26 +20,41 @@ import (
 var (
 	app = kingpin.New("imagecustomizer", "Customizes a pre-built Azure Linux image")
 
-	buildDir                    = app.Flag("build-dir", "Directory to run build out of.").Required().String()
-	imageFile                   = app.Flag("image-file", "Path of the base Azure Linux image which the customization will be applied to.").Required().String()
-	outputImageFile             = app.Flag("output-image-file", "Path to write the customized image to.").Required().String()
-	outputImageFormat           = app.Flag("output-image-format", "Format of output image. Supported: vhd, vhdx, qcow2, raw, iso.").Enum("vhd", "vhd-fixed", "vhdx", "qcow2", "raw", "iso")
-	outputSplitPartitionsFormat = app.Flag("output-split-partitions-format", "Format of partition files. Supported: raw, raw-zst").Enum("raw", "raw-zst")
-	configFile                  = app.Flag("config-file", "Path of the image customization config file.").Required().String()
-	rpmSources                  = app.Flag("rpm-source", "Path to a RPM repo config file or a directory containing RPMs.").Strings()
-	disableBaseImageRpmRepos    = app.Flag("disable-base-image-rpm-repos", "Disable the base image's RPM repos as an RPM source").Bool()
-	enableShrinkFilesystems     = app.Flag("shrink-filesystems", "Enable shrinking of filesystems to minimum size. Supports ext2, ext3, ext4 filesystem types.").Bool()
-	outputPXEArtifactsDir       = app.Flag("output-pxe-artifacts-dir", "Create a directory with customized image PXE booting artifacts. '--output-image-format' must be set to 'iso'.").String()
-	logFlags                    = exe.SetupLogFlags(app)
-	profFlags                   = exe.SetupProfileFlags(app)
-	timestampFile               = app.Flag("timestamp-file", "File that stores timestamps for this program.").String()
+	customizeCmd                = app.Command("customize", "Customize an image.").Default()
+	buildDir                    = customizeCmd.Flag("build-dir", "Directory to run build out of.").Required().String()
+	imageFile                   = customizeCmd.Flag("image-file", "Path of the base Azure Linux image which the customization will be applied to.").Required().String()
+	outputImageFile             = customizeCmd.Flag("output-image-file", "Path to write the customized image to.").Required().String()
+	outputImageFormat           = customizeCmd.Flag("output-image-format", "Format of output image. Supported: vhd, vhdx, qcow2, raw, iso, oci, docker-archive.").Enum("vhd", "vhd-fixed", "vhdx", "qcow2", "raw", "iso", "oci", "docker-archive")
+	outputSplitPartitionsFormat = customizeCmd.Flag("output-split-partitions-format", "Format of partition files. Supported: raw, raw-zst").Enum("raw", "raw-zst")
+	configFile                  = customizeCmd.Flag("config-file", "Path of the image customization config file.").Required().String()
+	configVars                  = customizeCmd.Flag("set", "Set a config variable, which replaces '${NAME}' in the config file. Format: NAME=VALUE").PlaceHolder("NAME=VALUE").StringMap()
+	strictConfigVars            = customizeCmd.Flag("strict-vars", "Fail if the config file references an undefined variable.").Bool()
+	rpmSources                  = customizeCmd.Flag("rpm-source", "Path to a RPM repo config file or a directory containing RPMs.").Strings()
+	disableBaseImageRpmRepos    = customizeCmd.Flag("disable-base-image-rpm-repos", "Disable the base image's RPM repos as an RPM source").Bool()
+	enableShrinkFilesystems     = customizeCmd.Flag("shrink-filesystems", "Enable shrinking of filesystems to minimum size. Supports ext2, ext3, ext4 filesystem types.").Bool()
+	outputPXEArtifactsDir       = customizeCmd.Flag("output-pxe-artifacts-dir", "Create a directory with customized image PXE booting artifacts. '--output-image-format' must be set to 'iso'.").String()
+	dryRun                      = customizeCmd.Flag("dry-run", "Validate the config and print the planned customizations, without modifying the image.").Bool()
+
+	schemaCmd = app.Command("schema", "Print the JSON Schema of the image customization config file.")
+
+	logFlags      = exe.SetupLogFlags(app)
+	profFlags     = exe.SetupProfileFlags(app)
+	timestampFile = app.Flag("timestamp-file", "File that stores timestamps for this program.").String()
 )
 
 func main() {
 	var err error
 
 	app.Version(imagecustomizerlib.ToolVersion)
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+	if command == schemaCmd.FullCommand() {
+		err = printSchema()
+		if err != nil {
+			log.Fatalf("failed to print schema:\n%v", err)
+		}
+		return
+	}
+
 	if *outputSplitPartitionsFormat == "" && *outputImageFormat == "" {
 		kingpin.Fatalf("Either --output-image-format or --output-split-partitions-format must be specified.")
 	}
@@ -70,9 +87,34 @@ func main() {
 func customizeImage() error {
 	var err error
 
-	err = imagecustomizerlib.CustomizeImageWithConfigFile(*buildDir, *configFile, *imageFile,
-		*rpmSources, *outputImageFile, *outputImageFormat, *outputSplitPartitionsFormat, *outputPXEArtifactsDir,
-		!*disableBaseImageRpmRepos, *enableShrinkFilesystems)
+	configFileOptions := imagecustomizerlib.ConfigFileOptions{
+		ConfigVars:       *configVars,
+		StrictConfigVars: *strictConfigVars,
+	}
+
+	if *dryRun {
+		return imagecustomizerlib.DryRunImageWithConfigFileOptions(*buildDir, *configFile, configFileOptions,
+			*imageFile, *rpmSources, *outputImageFile, *outputImageFormat, *outputSplitPartitionsFormat,
+			*outputPXEArtifactsDir, !*disableBaseImageRpmRepos, *enableShrinkFilesystems)
+	}
+
+	err = imagecustomizerlib.CustomizeImageWithConfigFileOptions(*buildDir, *configFile, configFileOptions,
+		*imageFile, *rpmSources, *outputImageFile, *outputImageFormat, *outputSplitPartitionsFormat,
+		*outputPXEArtifactsDir, !*disableBaseImageRpmRepos, *enableShrinkFilesystems)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func printSchema() error {
+	schemaJson, err := imagecustomizerapi.ConfigJsonSchema()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Println(string(schemaJson))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,27 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+type ABSlotContentType string
+
+const (
+	ABSlotContentTypeDefault ABSlotContentType = ""
+	ABSlotContentTypeEmpty   ABSlotContentType = "empty"
+	ABSlotContentTypeClone   ABSlotContentType = "clone"
+)
+
+func (t ABSlotContentType) IsValid() error {
+	switch t {
+	case ABSlotContentTypeDefault, ABSlotContentTypeEmpty, ABSlotContentTypeClone:
+		// All good.
+		return nil
+
+	default:
+		return fmt.Errorf("invalid slotBContent value (%v)", t)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+// ABUpdate defines an A/B (dual-root) partition layout. Slot A is the partition of the root filesystem. Slot B is a
+// second partition that an update agent can write the next OS version to.
+type ABUpdate struct {
+	// The ID of the partition of slot B.
+	SlotBDeviceId string `yaml:"slotBDeviceId"`
+	// How slot B is populated.
+	SlotBContent ABSlotContentType `yaml:"slotBContent"`
+}
+
+func (a *ABUpdate) IsValid() error {
+	if a.SlotBDeviceId == "" {
+		return fmt.Errorf("'slotBDeviceId' may not be empty")
+	}
+
+	err := a.SlotBContent.IsValid()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
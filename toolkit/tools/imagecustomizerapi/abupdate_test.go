@@ -0,0 +1,37 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestABUpdateIsValid(t *testing.T) {
+	abUpdate := ABUpdate{
+		SlotBDeviceId: "rootb",
+		SlotBContent:  ABSlotContentTypeClone,
+	}
+
+	err := abUpdate.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestABUpdateIsValidMissingSlotB(t *testing.T) {
+	abUpdate := ABUpdate{}
+
+	err := abUpdate.IsValid()
+	assert.ErrorContains(t, err, "'slotBDeviceId' may not be empty")
+}
+
+func TestABUpdateIsValidBadSlotBContent(t *testing.T) {
+	abUpdate := ABUpdate{
+		SlotBDeviceId: "rootb",
+		SlotBContent:  "copy",
+	}
+
+	err := abUpdate.IsValid()
+	assert.ErrorContains(t, err, "invalid slotBContent value (copy)")
+}
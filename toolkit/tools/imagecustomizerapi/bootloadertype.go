@@ -0,0 +1,27 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+type BootLoaderType string
+
+const (
+	BootLoaderTypeDefault     BootLoaderType = ""
+	BootLoaderTypeGrub        BootLoaderType = "grub"
+	BootLoaderTypeSystemdBoot BootLoaderType = "systemd-boot"
+)
+
+func (t BootLoaderType) IsValid() error {
+	switch t {
+	case BootLoaderTypeDefault, BootLoaderTypeGrub, BootLoaderTypeSystemdBoot:
+		// All good.
+		return nil
+
+	default:
+		return fmt.Errorf("invalid bootLoader value (%v)", t)
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootLoaderTypeIsValidValid(t *testing.T) {
+	err := BootLoaderTypeSystemdBoot.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestBootLoaderTypeIsValidInvalid(t *testing.T) {
+	err := BootLoaderType("lilo").IsValid()
+	assert.ErrorContains(t, err, "invalid bootLoader value (lilo)")
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// BtrfsSubvolume holds the configuration of a subvolume of a btrfs filesystem.
+type BtrfsSubvolume struct {
+	// The path of the subvolume, relative to the top-level subvolume of the filesystem (e.g. '@home').
+	Path string `yaml:"path"`
+	// MountPoint contains the mount settings of the subvolume.
+	MountPoint *MountPoint `yaml:"mountPoint"`
+	// Whether to make the subvolume read-only after the OS has been customized.
+	ReadOnly bool `yaml:"readOnly"`
+}
+
+func (s *BtrfsSubvolume) IsValid() error {
+	if s.Path == "" {
+		return fmt.Errorf("'path' may not be empty")
+	}
+
+	if path.IsAbs(s.Path) || path.Clean(s.Path) != s.Path || s.Path == "." || s.Path == ".." ||
+		strings.HasPrefix(s.Path, "../") {
+		return fmt.Errorf("invalid 'path' value (%s):\nmust be a clean relative path", s.Path)
+	}
+
+	if s.MountPoint != nil {
+		err := s.MountPoint.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid mountPoint value:\n%w", err)
+		}
+
+		for _, option := range strings.Split(s.MountPoint.Options, ",") {
+			optionName, _, _ := strings.Cut(option, "=")
+			if optionName == "subvol" || optionName == "subvolid" {
+				return fmt.Errorf("mountPoint 'options' of subvolume (%s) may not contain (%s)", s.Path, optionName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// MountOptions returns the options to mount the subvolume with.
+func (s *BtrfsSubvolume) MountOptions() string {
+	options := "subvol=" + s.Path
+	if s.MountPoint != nil && s.MountPoint.Options != "" {
+		options += "," + s.MountPoint.Options
+	}
+
+	return options
+}
@@ -0,0 +1,66 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBtrfsSubvolumeIsValid(t *testing.T) {
+	subvolume := BtrfsSubvolume{
+		Path: "@home",
+		MountPoint: &MountPoint{
+			Path:    "/home",
+			Options: "compress=zstd,noatime",
+		},
+	}
+
+	err := subvolume.IsValid()
+	assert.NoError(t, err)
+	assert.Equal(t, "subvol=@home,compress=zstd,noatime", subvolume.MountOptions())
+}
+
+func TestBtrfsSubvolumeIsValidNoMountPoint(t *testing.T) {
+	subvolume := BtrfsSubvolume{
+		Path:     "@snapshots/1",
+		ReadOnly: true,
+	}
+
+	err := subvolume.IsValid()
+	assert.NoError(t, err)
+	assert.Equal(t, "subvol=@snapshots/1", subvolume.MountOptions())
+}
+
+func TestBtrfsSubvolumeIsValidEmptyPath(t *testing.T) {
+	subvolume := BtrfsSubvolume{}
+
+	err := subvolume.IsValid()
+	assert.ErrorContains(t, err, "'path' may not be empty")
+}
+
+func TestBtrfsSubvolumeIsValidBadPath(t *testing.T) {
+	for _, path := range []string{"/@", "@home/", "../@", "@/./var", "."} {
+		subvolume := BtrfsSubvolume{
+			Path: path,
+		}
+
+		err := subvolume.IsValid()
+		assert.ErrorContains(t, err, "invalid 'path' value ("+path+")")
+	}
+}
+
+func TestBtrfsSubvolumeIsValidSubvolOption(t *testing.T) {
+	subvolume := BtrfsSubvolume{
+		Path: "@",
+		MountPoint: &MountPoint{
+			Path:    "/",
+			Options: "noatime,subvolid=256",
+		},
+	}
+
+	err := subvolume.IsValid()
+	assert.ErrorContains(t, err, "mountPoint 'options' of subvolume (@) may not contain (subvolid)")
+}
@@ -6,14 +6,22 @@ package imagecustomizerapi
 import "fmt"
 
 type Config struct {
-	Storage Storage `yaml:"storage"`
-	Iso     *Iso    `yaml:"iso"`
-	Pxe     *Pxe    `yaml:"pxe"`
-	OS      *OS     `yaml:"os"`
-	Scripts Scripts `yaml:"scripts"`
+	// Include lists the config files that this config is layered on top of.
+	// They are merged in by the config file loader.
+	Include   []string   `yaml:"include"`
+	Storage   Storage    `yaml:"storage"`
+	Iso       *Iso       `yaml:"iso"`
+	Pxe       *Pxe       `yaml:"pxe"`
+	Container *Container `yaml:"container"`
+	OS        *OS        `yaml:"os"`
+	Scripts   Scripts    `yaml:"scripts"`
 }
 
 func (c *Config) IsValid() (err error) {
+	if len(c.Include) > 0 {
+		return fmt.Errorf("'include' is only supported when loading a config file (--config-file)")
+	}
+
 	err = c.Storage.IsValid()
 	if err != nil {
 		return err
@@ -35,6 +43,13 @@ func (c *Config) IsValid() (err error) {
 		}
 	}
 
+	if c.Container != nil {
+		err = c.Container.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid 'container' field:\n%w", err)
+		}
+	}
+
 	hasResetBootLoader := false
 	if c.OS != nil {
 		err = c.OS.IsValid()
@@ -57,6 +72,35 @@ func (c *Config) IsValid() (err error) {
 		return fmt.Errorf("'os.resetBootLoaderType' must be specified if 'storage.resetPartitionsUuidsType' is specified")
 	}
 
+	// The UKI is installed into the EFI system partition.
+	if c.OS != nil && c.OS.Uki != nil && c.CustomizePartitions() && c.Storage.BootType != BootTypeEfi {
+		return fmt.Errorf("'os.uki' requires 'storage.bootType' to be 'efi'")
+	}
+
+	if c.OS != nil && c.OS.BootLoader == BootLoaderTypeSystemdBoot {
+		// systemd-boot is a UEFI-only bootloader.
+		if c.CustomizePartitions() && c.Storage.BootType != BootTypeEfi {
+			return fmt.Errorf("'os.bootLoader' value 'systemd-boot' requires 'storage.bootType' to be 'efi'")
+		}
+
+		// The verity root hash is only added to the grub config.
+		if len(c.Storage.Verity) > 0 {
+			return fmt.Errorf("'os.bootLoader' value 'systemd-boot' is not supported with 'storage.verity'")
+		}
+	}
+
+	// The A/B slot is selected by the grub config. The UKI and the systemd-boot entries have a fixed kernel command
+	// line.
+	if c.Storage.ABUpdate != nil && c.OS != nil {
+		if c.OS.Uki != nil {
+			return fmt.Errorf("'os.uki' is not supported with 'storage.abUpdate'")
+		}
+
+		if c.OS.BootLoader == BootLoaderTypeSystemdBoot {
+			return fmt.Errorf("'os.bootLoader' value 'systemd-boot' is not supported with 'storage.abUpdate'")
+		}
+	}
+
 	return nil
 }
 
@@ -519,3 +519,165 @@ func TestConfigIsValidVerityNoStorage(t *testing.T) {
 	err := config.IsValid()
 	assert.ErrorContains(t, err, "cannot specify 'verity' without specifying 'disks'")
 }
+
+func TestConfigIsValidUkiLegacy(t *testing.T) {
+	config := &Config{
+		Storage: Storage{
+			Disks: []Disk{{
+				PartitionTableType: "gpt",
+				MaxSize:            ptrutils.PtrTo(DiskSize(3 * diskutils.MiB)),
+				Partitions: []Partition{
+					{
+						Id:    "boot",
+						Start: ptrutils.PtrTo(DiskSize(1 * diskutils.MiB)),
+						Type:  PartitionTypeBiosGrub,
+					},
+				},
+			}},
+			BootType: "legacy",
+			FileSystems: []FileSystem{
+				{
+					DeviceId: "boot",
+				},
+			},
+		},
+		OS: &OS{
+			ResetBootLoaderType: "hard-reset",
+			Hostname:            "test",
+			Uki:                 &Uki{},
+		},
+	}
+
+	err := config.IsValid()
+	assert.ErrorContains(t, err, "'os.uki' requires 'storage.bootType' to be 'efi'")
+}
+
+func TestConfigIsValidSystemdBootLegacy(t *testing.T) {
+	config := &Config{
+		Storage: Storage{
+			Disks: []Disk{{
+				PartitionTableType: "gpt",
+				MaxSize:            ptrutils.PtrTo(DiskSize(3 * diskutils.MiB)),
+				Partitions: []Partition{
+					{
+						Id:    "boot",
+						Start: ptrutils.PtrTo(DiskSize(1 * diskutils.MiB)),
+						Type:  PartitionTypeBiosGrub,
+					},
+				},
+			}},
+			BootType: "legacy",
+			FileSystems: []FileSystem{
+				{
+					DeviceId: "boot",
+				},
+			},
+		},
+		OS: &OS{
+			ResetBootLoaderType: "hard-reset",
+			Hostname:            "test",
+			BootLoader:          BootLoaderTypeSystemdBoot,
+		},
+	}
+
+	err := config.IsValid()
+	assert.ErrorContains(t, err, "'os.bootLoader' value 'systemd-boot' requires 'storage.bootType' to be 'efi'")
+}
+
+func TestConfigIsValidSystemdBootVerity(t *testing.T) {
+	config := &Config{
+		Storage: Storage{
+			Disks: []Disk{{
+				PartitionTableType: "gpt",
+				Partitions: []Partition{
+					{
+						Id: "esp",
+						Size: PartitionSize{
+							Type: PartitionSizeTypeExplicit,
+							Size: 8 * diskutils.MiB,
+						},
+						Type: PartitionTypeESP,
+					},
+					{
+						Id: "root",
+						Size: PartitionSize{
+							Type: PartitionSizeTypeExplicit,
+							Size: 1 * diskutils.GiB,
+						},
+					},
+					{
+						Id: "verityhash",
+						Size: PartitionSize{
+							Type: PartitionSizeTypeExplicit,
+							Size: 100 * diskutils.MiB,
+						},
+					},
+				},
+			}},
+			BootType: "efi",
+			FileSystems: []FileSystem{
+				{
+					DeviceId: "esp",
+					Type:     "fat32",
+					MountPoint: &MountPoint{
+						Path: "/boot/efi",
+					},
+				},
+				{
+					DeviceId: "rootverity",
+					Type:     "ext4",
+					MountPoint: &MountPoint{
+						Path: "/",
+					},
+				},
+			},
+			Verity: []Verity{
+				{
+					Id:           "rootverity",
+					Name:         "root",
+					DataDeviceId: "root",
+					HashDeviceId: "verityhash",
+				},
+			},
+		},
+		OS: &OS{
+			ResetBootLoaderType: "hard-reset",
+			BootLoader:          BootLoaderTypeSystemdBoot,
+		},
+	}
+	err := config.IsValid()
+	assert.ErrorContains(t, err, "'os.bootLoader' value 'systemd-boot' is not supported with 'storage.verity'")
+}
+
+func TestConfigIsValidABUpdateUki(t *testing.T) {
+	config := &Config{
+		Storage: newTestABStorage(),
+		OS: &OS{
+			ResetBootLoaderType: "hard-reset",
+			Uki:                 &Uki{},
+		},
+	}
+
+	err := config.IsValid()
+	assert.ErrorContains(t, err, "'os.uki' is not supported with 'storage.abUpdate'")
+
+	config.OS.Uki = nil
+	config.OS.BootLoader = BootLoaderTypeSystemdBoot
+
+	err = config.IsValid()
+	assert.ErrorContains(t, err, "'os.bootLoader' value 'systemd-boot' is not supported with 'storage.abUpdate'")
+
+	config.OS.BootLoader = BootLoaderTypeGrub
+
+	err = config.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestConfigIsValidUnresolvedInclude(t *testing.T) {
+	config := &Config{
+		Include: []string{"base.yaml"},
+	}
+
+	err := config.IsValid()
+	assert.ErrorContains(t, err, "'include' is only supported when loading a config file (--config-file)")
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// A simplified form of the docker image reference grammar: [domain[:port]/]path[:tag]
+var containerTagRegex = regexp.MustCompile(
+	`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?::[0-9]+)?(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*` +
+		`(?::[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?$`)
+
+// Container configures the container image that is created when the output image format is 'oci' or
+// 'docker-archive'.
+type Container struct {
+	// Tag is the name and tag of the image (e.g. 'myregistry.azurecr.io/myapp:1.0').
+	Tag string `yaml:"tag"`
+	// Labels are added to the image config.
+	Labels map[string]string `yaml:"labels"`
+	// Entrypoint is the command that is run when the container starts.
+	Entrypoint []string `yaml:"entrypoint"`
+	// Cmd is the default arguments passed to the entrypoint.
+	Cmd []string `yaml:"cmd"`
+	// ExcludePaths lists the directories and files of the rootfs that are left out of the container image.
+	// If not specified, then the boot files, kernel modules and firmware are left out.
+	ExcludePaths *[]string `yaml:"excludePaths"`
+}
+
+func (c *Container) IsValid() error {
+	if c.Tag != "" && !containerTagRegex.MatchString(c.Tag) {
+		return fmt.Errorf("invalid tag (%s)", c.Tag)
+	}
+
+	for key := range c.Labels {
+		if key == "" {
+			return fmt.Errorf("invalid labels:\nlabel name must not be empty")
+		}
+	}
+
+	if c.ExcludePaths != nil {
+		for _, excludePath := range *c.ExcludePaths {
+			if !path.IsAbs(excludePath) {
+				return fmt.Errorf("invalid excludePaths item (%s):\npath must be absolute", excludePath)
+			}
+
+			if path.Clean(excludePath) == "/" {
+				return fmt.Errorf("invalid excludePaths item (%s):\ncannot exclude the root directory", excludePath)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerIsValid(t *testing.T) {
+	container := Container{
+		Tag:        "myregistry.azurecr.io/team/myapp:1.0",
+		Labels:     map[string]string{"org.opencontainers.image.title": "myapp"},
+		Entrypoint: []string{"/usr/bin/myapp"},
+		Cmd:        []string{"--verbose"},
+		ExcludePaths: &[]string{
+			"/boot",
+			"/var/cache/tdnf",
+		},
+	}
+
+	err := container.IsValid()
+	assert.NoError(t, err)
+
+	for _, tag := range []string{"myapp", "myapp:latest", "localhost:5000/myapp", "localhost:5000/my-app:1.0"} {
+		container.Tag = tag
+		err = container.IsValid()
+		assert.NoError(t, err, "%s", tag)
+	}
+}
+
+func TestContainerIsValidInvalidTag(t *testing.T) {
+	for _, tag := range []string{"MyApp", "myapp:", "my app", "myapp@sha256:abc", "/myapp"} {
+		container := Container{
+			Tag: tag,
+		}
+
+		err := container.IsValid()
+		assert.ErrorContains(t, err, "invalid tag ("+tag+")")
+	}
+}
+
+func TestContainerIsValidEmptyLabel(t *testing.T) {
+	container := Container{
+		Labels: map[string]string{"": "value"},
+	}
+
+	err := container.IsValid()
+	assert.ErrorContains(t, err, "label name must not be empty")
+}
+
+func TestContainerIsValidRelativeExcludePath(t *testing.T) {
+	container := Container{
+		ExcludePaths: &[]string{"boot"},
+	}
+
+	err := container.IsValid()
+	assert.ErrorContains(t, err, "invalid excludePaths item (boot):\npath must be absolute")
+}
+
+func TestContainerIsValidRootExcludePath(t *testing.T) {
+	container := Container{
+		ExcludePaths: &[]string{"/usr/.."},
+	}
+
+	err := container.IsValid()
+	assert.ErrorContains(t, err, "cannot exclude the root directory")
+}
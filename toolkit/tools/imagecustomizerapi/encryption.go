@@ -0,0 +1,81 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	DefaultEncryptionCipher = "aes-xts-plain64"
+)
+
+var (
+	encryptionNameRegex   = regexp.MustCompile("^[a-z][a-z0-9-]*$")
+	encryptionCipherRegex = regexp.MustCompile("^[a-z0-9]+(-[a-z0-9]+)*$")
+)
+
+type Encryption struct {
+	// ID is used to correlate `Encryption` objects with `FileSystem` objects.
+	Id string `yaml:"id"`
+	// The name of the mapper block device.
+	Name string `yaml:"name"`
+	// The ID of the 'Partition' to encrypt.
+	DeviceId string `yaml:"deviceId"`
+	// The cipher to pass to cryptsetup.
+	// Defaults to 'aes-xts-plain64'.
+	Cipher string `yaml:"cipher"`
+	// The path of the file that contains the key for the LUKS key slot.
+	// The path is relative to the config file.
+	KeyFile string `yaml:"keyFile"`
+	// How the device is unlocked when the OS boots.
+	//
+	// Anyone who can read the disk can read a key file that is stored on an unencrypted filesystem. So, 'key-file'
+	// is only allowed for devices that are unlocked after the root filesystem is mounted (i.e. not '/', '/usr' or
+	// 'x-initrd.mount' filesystems), and only if the root filesystem is encrypted (and unlocked by a passphrase or
+	// the TPM). The key file is then stored on the encrypted root filesystem.
+	Unlock EncryptionUnlockType `yaml:"unlock"`
+
+	// The filesystem config that points to this encrypted device.
+	// Value is filled in by Storage.IsValid().
+	FileSystem *FileSystem
+}
+
+func (e *Encryption) IsValid() error {
+	if e.Id == "" {
+		return fmt.Errorf("'id' may not be empty")
+	}
+
+	if !encryptionNameRegex.MatchString(e.Name) {
+		return fmt.Errorf("invalid 'name' value (%s)", e.Name)
+	}
+
+	if e.DeviceId == "" {
+		return fmt.Errorf("'deviceId' may not be empty")
+	}
+
+	if e.Cipher != "" && !encryptionCipherRegex.MatchString(e.Cipher) {
+		return fmt.Errorf("invalid 'cipher' value (%s)", e.Cipher)
+	}
+
+	if e.KeyFile == "" {
+		return fmt.Errorf("'keyFile' may not be empty")
+	}
+
+	if err := e.Unlock.IsValid(); err != nil {
+		return fmt.Errorf("invalid unlock:\n%w", err)
+	}
+
+	return nil
+}
+
+// GetCipher returns the cipher to use for the encrypted device.
+func (e *Encryption) GetCipher() string {
+	if e.Cipher == "" {
+		return DefaultEncryptionCipher
+	}
+
+	return e.Cipher
+}
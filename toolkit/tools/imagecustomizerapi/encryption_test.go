@@ -0,0 +1,110 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptionIsValid(t *testing.T) {
+	validEncryption := Encryption{
+		Id:       "rootencrypted",
+		Name:     "luks-root",
+		DeviceId: "root",
+		Cipher:   "aes-xts-plain64",
+		KeyFile:  "files/root.key",
+		Unlock:   EncryptionUnlockTypeTpm2,
+	}
+
+	err := validEncryption.IsValid()
+	assert.NoError(t, err)
+	assert.Equal(t, "aes-xts-plain64", validEncryption.GetCipher())
+}
+
+func TestEncryptionIsValidDefaultCipher(t *testing.T) {
+	validEncryption := Encryption{
+		Id:       "rootencrypted",
+		Name:     "root",
+		DeviceId: "root",
+		KeyFile:  "files/root.key",
+	}
+
+	err := validEncryption.IsValid()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultEncryptionCipher, validEncryption.GetCipher())
+}
+
+func TestEncryptionIsValidMissingId(t *testing.T) {
+	invalidEncryption := Encryption{
+		Name:     "root",
+		DeviceId: "root",
+		KeyFile:  "files/root.key",
+	}
+
+	err := invalidEncryption.IsValid()
+	assert.ErrorContains(t, err, "'id' may not be empty")
+}
+
+func TestEncryptionIsValidInvalidName(t *testing.T) {
+	invalidEncryption := Encryption{
+		Id:       "rootencrypted",
+		Name:     "root/crypt",
+		DeviceId: "root",
+		KeyFile:  "files/root.key",
+	}
+
+	err := invalidEncryption.IsValid()
+	assert.ErrorContains(t, err, "invalid 'name' value (root/crypt)")
+}
+
+func TestEncryptionIsValidMissingDeviceId(t *testing.T) {
+	invalidEncryption := Encryption{
+		Id:      "rootencrypted",
+		Name:    "root",
+		KeyFile: "files/root.key",
+	}
+
+	err := invalidEncryption.IsValid()
+	assert.ErrorContains(t, err, "'deviceId' may not be empty")
+}
+
+func TestEncryptionIsValidInvalidCipher(t *testing.T) {
+	invalidEncryption := Encryption{
+		Id:       "rootencrypted",
+		Name:     "root",
+		DeviceId: "root",
+		Cipher:   "aes xts",
+		KeyFile:  "files/root.key",
+	}
+
+	err := invalidEncryption.IsValid()
+	assert.ErrorContains(t, err, "invalid 'cipher' value (aes xts)")
+}
+
+func TestEncryptionIsValidMissingKeyFile(t *testing.T) {
+	invalidEncryption := Encryption{
+		Id:       "rootencrypted",
+		Name:     "root",
+		DeviceId: "root",
+	}
+
+	err := invalidEncryption.IsValid()
+	assert.ErrorContains(t, err, "'keyFile' may not be empty")
+}
+
+func TestEncryptionIsValidInvalidUnlock(t *testing.T) {
+	invalidEncryption := Encryption{
+		Id:       "rootencrypted",
+		Name:     "root",
+		DeviceId: "root",
+		KeyFile:  "files/root.key",
+		Unlock:   "fido2",
+	}
+
+	err := invalidEncryption.IsValid()
+	assert.ErrorContains(t, err, "invalid unlock")
+	assert.ErrorContains(t, err, "invalid EncryptionUnlockType value (fido2)")
+}
@@ -0,0 +1,32 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+// EncryptionUnlockType is how an encrypted device is unlocked when the OS boots.
+type EncryptionUnlockType string
+
+const (
+	EncryptionUnlockTypeDefault    EncryptionUnlockType = ""
+	EncryptionUnlockTypePassphrase EncryptionUnlockType = "passphrase"
+	EncryptionUnlockTypeKeyFile    EncryptionUnlockType = "key-file"
+	EncryptionUnlockTypeTpm2       EncryptionUnlockType = "tpm2"
+)
+
+func (e EncryptionUnlockType) IsValid() error {
+	switch e {
+	case EncryptionUnlockTypeDefault,
+		EncryptionUnlockTypePassphrase,
+		EncryptionUnlockTypeKeyFile,
+		EncryptionUnlockTypeTpm2:
+		// All good.
+		return nil
+
+	default:
+		return fmt.Errorf("invalid EncryptionUnlockType value (%v)", e)
+	}
+}
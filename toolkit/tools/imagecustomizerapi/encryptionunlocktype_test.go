@@ -0,0 +1,25 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptionUnlockTypeKeyFileIsValid(t *testing.T) {
+	err := EncryptionUnlockTypeKeyFile.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestEncryptionUnlockTypeTpm2IsValid(t *testing.T) {
+	err := EncryptionUnlockTypeTpm2.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestEncryptionUnlockTypeIsValidBadValue(t *testing.T) {
+	err := EncryptionUnlockType("bad").IsValid()
+	assert.ErrorContains(t, err, "invalid EncryptionUnlockType value (bad)")
+}
@@ -15,8 +15,13 @@ type FileSystem struct {
 	Type FileSystemType `yaml:"type"`
 	// MountPoint contains the mount settings.
 	MountPoint *MountPoint `yaml:"mountPoint"`
+	// Subvolumes are the subvolumes to create on a btrfs filesystem.
+	Subvolumes []BtrfsSubvolume `yaml:"subvolumes"`
 
 	// If 'DeviceId' points at a verity device, this value is the 'Id' of the data partition.
+	// If 'DeviceId' points at an encrypted device, this value is the 'Id' of the encrypted partition.
+	// If 'DeviceId' points at a logical volume, this value is the 'Id' of the logical volume.
+	// If 'DeviceId' points at a RAID array, this value is the 'Id' of the RAID array.
 	// Otherwise, it is the same as 'DeviceId'.
 	// Value is filled in by Storage.IsValid().
 	PartitionId string
@@ -44,5 +49,52 @@ func (f *FileSystem) IsValid() error {
 		}
 	}
 
+	if len(f.Subvolumes) > 0 && f.Type != FileSystemTypeBtrfs {
+		return fmt.Errorf("filesystem with 'subvolumes' must have a 'type' of 'btrfs'")
+	}
+
+	subvolumePaths := make(map[string]bool)
+	for i := range f.Subvolumes {
+		subvolume := &f.Subvolumes[i]
+
+		err := subvolume.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid subvolume at index %d:\n%w", i, err)
+		}
+
+		if _, existingPath := subvolumePaths[subvolume.Path]; existingPath {
+			return fmt.Errorf("invalid subvolume at index %d:\nduplicate path (%s)", i, subvolume.Path)
+		}
+
+		subvolumePaths[subvolume.Path] = true
+	}
+
 	return nil
 }
+
+// MountPoints returns the mount points of the filesystem and of its subvolumes.
+func (f *FileSystem) MountPoints() []*MountPoint {
+	mountPoints := []*MountPoint(nil)
+	if f.MountPoint != nil {
+		mountPoints = append(mountPoints, f.MountPoint)
+	}
+
+	for _, subvolume := range f.Subvolumes {
+		if subvolume.MountPoint != nil {
+			mountPoints = append(mountPoints, subvolume.MountPoint)
+		}
+	}
+
+	return mountPoints
+}
+
+// GetMountPoint returns the mount point of the filesystem or of one of its subvolumes that has the path.
+func (f *FileSystem) GetMountPoint(path string) (*MountPoint, bool) {
+	for _, mountPoint := range f.MountPoints() {
+		if mountPoint.Path == path {
+			return mountPoint, true
+		}
+	}
+
+	return nil, false
+}
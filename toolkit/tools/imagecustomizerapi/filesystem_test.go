@@ -19,3 +19,39 @@ func TestFileSystemIsValidBadDeviceId(t *testing.T) {
 	assert.Error(t, err)
 	assert.ErrorContains(t, err, "invalid deviceId value: must not be empty")
 }
+
+func TestFileSystemIsValidSubvolumesNotBtrfs(t *testing.T) {
+	fileSystem := FileSystem{
+		DeviceId: "root",
+		Type:     FileSystemTypeExt4,
+		Subvolumes: []BtrfsSubvolume{
+			{
+				Path: "@",
+			},
+		},
+	}
+
+	err := fileSystem.IsValid()
+	assert.ErrorContains(t, err, "filesystem with 'subvolumes' must have a 'type' of 'btrfs'")
+}
+
+func TestFileSystemIsValidSubvolumesDuplicatePath(t *testing.T) {
+	fileSystem := FileSystem{
+		DeviceId: "root",
+		Type:     FileSystemTypeBtrfs,
+		Subvolumes: []BtrfsSubvolume{
+			{
+				Path:       "@",
+				MountPoint: &MountPoint{Path: "/"},
+			},
+			{
+				Path:       "@",
+				MountPoint: &MountPoint{Path: "/home"},
+			},
+		},
+	}
+
+	err := fileSystem.IsValid()
+	assert.ErrorContains(t, err, "invalid subvolume at index 1")
+	assert.ErrorContains(t, err, "duplicate path (@)")
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+type LogicalVolume struct {
+	// ID is used to correlate `LogicalVolume` objects with `FileSystem` objects.
+	Id string `yaml:"id"`
+	// The name of the logical volume.
+	Name string `yaml:"name"`
+	// The size of the logical volume.
+	// If not set, the logical volume uses the remaining space of the volume group.
+	Size *DiskSize `yaml:"size"`
+}
+
+func (l *LogicalVolume) IsValid() error {
+	if l.Id == "" {
+		return fmt.Errorf("'id' may not be empty")
+	}
+
+	if !lvmNameRegex.MatchString(l.Name) {
+		return fmt.Errorf("invalid 'name' value (%s)", l.Name)
+	}
+
+	if l.Size != nil && *l.Size <= 0 {
+		return fmt.Errorf("'size' (%d) must be a positive non-zero number", *l.Size)
+	}
+
+	return nil
+}
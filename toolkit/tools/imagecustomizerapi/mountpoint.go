@@ -2,6 +2,7 @@ package imagecustomizerapi
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/sliceutils"
 	"gopkg.in/yaml.v3"
@@ -45,6 +46,16 @@ func (p *MountPoint) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// isInitramfsMount returns true if the filesystem is mounted by the initramfs, before the root filesystem is switched
+// to.
+func (p *MountPoint) isInitramfsMount() bool {
+	if p.Path == "/" || p.Path == "/usr" {
+		return true
+	}
+
+	return sliceutils.ContainsValue(strings.Split(p.Options, ","), "x-initrd.mount")
+}
+
 // IsValid returns an error if the MountPoint is not valid
 func (p *MountPoint) IsValid() error {
 	err := p.IdType.IsValid()
@@ -8,11 +8,13 @@ import (
 	"strings"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
 )
 
 // OS defines how each system present on the image is supposed to be configured.
 type OS struct {
 	ResetBootLoaderType ResetBootLoaderType `yaml:"resetBootLoaderType"`
+	BootLoader          BootLoaderType      `yaml:"bootLoader"`
 	Hostname            string              `yaml:"hostname"`
 	Packages            Packages            `yaml:"packages"`
 	SELinux             SELinux             `yaml:"selinux"`
@@ -23,6 +25,9 @@ type OS struct {
 	Services            Services            `yaml:"services"`
 	Modules             []Module            `yaml:"modules"`
 	Overlays            *[]Overlay          `yaml:"overlays"`
+	TargetKernel        string              `yaml:"targetKernel"`
+	Uki                 *Uki                `yaml:"uki"`
+	Sbom                *Sbom               `yaml:"sbom"`
 }
 
 func (s *OS) IsValid() error {
@@ -32,6 +37,11 @@ func (s *OS) IsValid() error {
 		return err
 	}
 
+	err = s.BootLoader.IsValid()
+	if err != nil {
+		return err
+	}
+
 	if s.Hostname != "" {
 		if !govalidator.IsDNSName(s.Hostname) || strings.Contains(s.Hostname, "_") {
 			return fmt.Errorf("invalid hostname (%s)", s.Hostname)
@@ -114,5 +124,26 @@ func (s *OS) IsValid() error {
 		}
 	}
 
+	if s.TargetKernel != "" {
+		_, err = versioncompare.ParseConstraint(s.TargetKernel)
+		if err != nil {
+			return fmt.Errorf("invalid targetKernel:\n%w", err)
+		}
+	}
+
+	if s.Uki != nil {
+		err = s.Uki.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid uki:\n%w", err)
+		}
+	}
+
+	if s.Sbom != nil {
+		err = s.Sbom.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid sbom:\n%w", err)
+		}
+	}
+
 	return nil
 }
@@ -226,3 +226,33 @@ func TestOSIsValidInvalidKernelCommandLine(t *testing.T) {
 	err := os.IsValid()
 	assert.ErrorContains(t, err, "invalid kernelCommandLine")
 }
+
+func TestOSValidTargetKernel(t *testing.T) {
+	testValidYamlValue[*OS](t, "{ \"targetKernel\": \"6.6.*\" }", &OS{TargetKernel: "6.6.*"})
+}
+
+func TestOSIsValidInvalidTargetKernel(t *testing.T) {
+	os := OS{
+		TargetKernel: ">= 6.6.*",
+	}
+
+	err := os.IsValid()
+	assert.ErrorContains(t, err, "invalid targetKernel")
+	assert.ErrorContains(t, err, "invalid version constraint (>= 6.6.*)")
+}
+
+func TestOSValidSbom(t *testing.T) {
+	testValidYamlValue[*OS](t, "{ \"sbom\": { \"format\": \"spdx\" } }", &OS{Sbom: &Sbom{Format: SbomFormatSpdx}})
+}
+
+func TestOSIsValidInvalidSbom(t *testing.T) {
+	os := OS{
+		Sbom: &Sbom{
+			Format: "swid",
+		},
+	}
+
+	err := os.IsValid()
+	assert.ErrorContains(t, err, "invalid sbom")
+	assert.ErrorContains(t, err, "invalid format value (swid)")
+}
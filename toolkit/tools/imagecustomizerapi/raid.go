@@ -0,0 +1,51 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	// The directory that mdadm creates the named RAID array device links in.
+	MdDevicePath = "/dev/md"
+)
+
+var (
+	raidNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)
+)
+
+type Raid struct {
+	// ID is used to correlate `Raid` objects with `FileSystem` objects.
+	Id string `yaml:"id"`
+	// The name of the RAID array.
+	// The array's device is '/dev/md/<name>'.
+	Name string `yaml:"name"`
+	// The RAID level of the array.
+	Level RaidLevel `yaml:"level"`
+	// The IDs of the 'Partition' objects to use as the array's member devices.
+	Devices []string `yaml:"devices"`
+}
+
+func (r *Raid) IsValid() error {
+	if r.Id == "" {
+		return fmt.Errorf("'id' may not be empty")
+	}
+
+	if !raidNameRegex.MatchString(r.Name) {
+		return fmt.Errorf("invalid 'name' value (%s)", r.Name)
+	}
+
+	err := r.Level.IsValid()
+	if err != nil {
+		return fmt.Errorf("invalid 'level':\n%w", err)
+	}
+
+	if len(r.Devices) < r.Level.MinDevices() {
+		return fmt.Errorf("RAID level (%s) requires at least %d devices", r.Level, r.Level.MinDevices())
+	}
+
+	return nil
+}
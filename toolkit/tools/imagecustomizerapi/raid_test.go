@@ -0,0 +1,69 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaidIsValid(t *testing.T) {
+	raid := Raid{
+		Id:      "rootraid",
+		Name:    "root",
+		Level:   RaidLevelRaid1,
+		Devices: []string{"root1", "root2"},
+	}
+
+	err := raid.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestRaidIsValidMissingId(t *testing.T) {
+	raid := Raid{
+		Name:    "root",
+		Level:   RaidLevelRaid1,
+		Devices: []string{"root1", "root2"},
+	}
+
+	err := raid.IsValid()
+	assert.ErrorContains(t, err, "'id' may not be empty")
+}
+
+func TestRaidIsValidBadName(t *testing.T) {
+	raid := Raid{
+		Id:      "rootraid",
+		Name:    "md/root",
+		Level:   RaidLevelRaid1,
+		Devices: []string{"root1", "root2"},
+	}
+
+	err := raid.IsValid()
+	assert.ErrorContains(t, err, "invalid 'name' value (md/root)")
+}
+
+func TestRaidIsValidBadLevel(t *testing.T) {
+	raid := Raid{
+		Id:      "rootraid",
+		Name:    "root",
+		Devices: []string{"root1", "root2"},
+	}
+
+	err := raid.IsValid()
+	assert.ErrorContains(t, err, "invalid 'level'")
+	assert.ErrorContains(t, err, "invalid RaidLevel value ()")
+}
+
+func TestRaidIsValidTooFewDevices(t *testing.T) {
+	raid := Raid{
+		Id:      "dataraid",
+		Name:    "data",
+		Level:   RaidLevelRaid5,
+		Devices: []string{"data1", "data2"},
+	}
+
+	err := raid.IsValid()
+	assert.ErrorContains(t, err, "RAID level (raid5) requires at least 3 devices")
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+// RaidLevel is the RAID level of a software RAID array.
+type RaidLevel string
+
+const (
+	RaidLevelRaid0  RaidLevel = "raid0"
+	RaidLevelRaid1  RaidLevel = "raid1"
+	RaidLevelRaid5  RaidLevel = "raid5"
+	RaidLevelRaid6  RaidLevel = "raid6"
+	RaidLevelRaid10 RaidLevel = "raid10"
+)
+
+func (r RaidLevel) IsValid() error {
+	switch r {
+	case RaidLevelRaid0, RaidLevelRaid1, RaidLevelRaid5, RaidLevelRaid6, RaidLevelRaid10:
+		// All good.
+		return nil
+
+	default:
+		return fmt.Errorf("invalid RaidLevel value (%v)", r)
+	}
+}
+
+// MinDevices returns the minimum number of member devices that the RAID level requires.
+func (r RaidLevel) MinDevices() int {
+	switch r {
+	case RaidLevelRaid5:
+		return 3
+
+	case RaidLevelRaid6:
+		return 4
+
+	default:
+		return 2
+	}
+}
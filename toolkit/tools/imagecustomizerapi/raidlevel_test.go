@@ -0,0 +1,31 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaidLevelIsValid(t *testing.T) {
+	err := RaidLevelRaid1.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestRaidLevelIsValidBadValue(t *testing.T) {
+	err := RaidLevel("raid3").IsValid()
+	assert.ErrorContains(t, err, "invalid RaidLevel value (raid3)")
+
+	err = RaidLevel("").IsValid()
+	assert.ErrorContains(t, err, "invalid RaidLevel value ()")
+}
+
+func TestRaidLevelMinDevices(t *testing.T) {
+	assert.Equal(t, 2, RaidLevelRaid0.MinDevices())
+	assert.Equal(t, 2, RaidLevelRaid1.MinDevices())
+	assert.Equal(t, 3, RaidLevelRaid5.MinDevices())
+	assert.Equal(t, 4, RaidLevelRaid6.MinDevices())
+	assert.Equal(t, 2, RaidLevelRaid10.MinDevices())
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+// Sbom configures the creation of a software bill of materials (SBOM) for the image. The SBOM is written next to the
+// output image.
+type Sbom struct {
+	// The SBOM document format.
+	Format SbomFormat `yaml:"format"`
+	// Signing holds the key and certificate that the SBOM is signed with.
+	// If not specified, then the SBOM is not signed.
+	Signing *SbomSigning `yaml:"signing"`
+}
+
+func (s *Sbom) IsValid() error {
+	err := s.Format.IsValid()
+	if err != nil {
+		return err
+	}
+
+	if s.Signing != nil {
+		err := s.Signing.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid signing:\n%w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSbomIsValid(t *testing.T) {
+	sbom := Sbom{
+		Format: SbomFormatCycloneDx,
+	}
+
+	err := sbom.IsValid()
+	assert.NoError(t, err)
+
+	sbom.Signing = &SbomSigning{
+		KeyFile:         "files/sbom.key",
+		CertificateFile: "files/sbom.crt",
+	}
+
+	err = sbom.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestSbomIsValidMissingFormat(t *testing.T) {
+	sbom := Sbom{}
+
+	err := sbom.IsValid()
+	assert.ErrorContains(t, err, "'format' must be specified")
+}
+
+func TestSbomIsValidMissingKeyFile(t *testing.T) {
+	sbom := Sbom{
+		Format: SbomFormatSpdx,
+		Signing: &SbomSigning{
+			CertificateFile: "files/sbom.crt",
+		},
+	}
+
+	err := sbom.IsValid()
+	assert.ErrorContains(t, err, "invalid signing")
+	assert.ErrorContains(t, err, "'keyFile' may not be empty")
+}
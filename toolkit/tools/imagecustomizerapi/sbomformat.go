@@ -0,0 +1,30 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+type SbomFormat string
+
+const (
+	SbomFormatDefault   SbomFormat = ""
+	SbomFormatSpdx      SbomFormat = "spdx"
+	SbomFormatCycloneDx SbomFormat = "cyclonedx"
+)
+
+func (f SbomFormat) IsValid() error {
+	switch f {
+	case SbomFormatSpdx, SbomFormatCycloneDx:
+		// All good.
+		return nil
+
+	case SbomFormatDefault:
+		return fmt.Errorf("'format' must be specified")
+
+	default:
+		return fmt.Errorf("invalid format value (%v)", f)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSbomFormatIsValidValid(t *testing.T) {
+	err := SbomFormatSpdx.IsValid()
+	assert.NoError(t, err)
+
+	err = SbomFormatCycloneDx.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestSbomFormatIsValidEmpty(t *testing.T) {
+	err := SbomFormatDefault.IsValid()
+	assert.ErrorContains(t, err, "'format' must be specified")
+}
+
+func TestSbomFormatIsValidInvalid(t *testing.T) {
+	err := SbomFormat("swid").IsValid()
+	assert.ErrorContains(t, err, "invalid format value (swid)")
+}
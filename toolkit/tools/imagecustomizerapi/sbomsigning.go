@@ -0,0 +1,30 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+// SbomSigning holds the key and certificate that an SBOM is signed with.
+type SbomSigning struct {
+	// The path of the PEM private key file.
+	// The path is relative to the config file.
+	KeyFile string `yaml:"keyFile"`
+	// The path of the PEM certificate file.
+	// The path is relative to the config file.
+	CertificateFile string `yaml:"certificateFile"`
+}
+
+func (s *SbomSigning) IsValid() error {
+	if s.KeyFile == "" {
+		return fmt.Errorf("'keyFile' may not be empty")
+	}
+
+	if s.CertificateFile == "" {
+		return fmt.Errorf("'certificateFile' may not be empty")
+	}
+
+	return nil
+}
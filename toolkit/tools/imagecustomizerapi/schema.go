@@ -0,0 +1,487 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/sliceutils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	jsonSchemaDialect    = "https://json-schema.org/draft/2020-12/schema"
+	jsonSchemaDefsPrefix = "#/$defs/"
+
+	jsonSchemaTypeObject  = "object"
+	jsonSchemaTypeArray   = "array"
+	jsonSchemaTypeString  = "string"
+	jsonSchemaTypeInteger = "integer"
+	jsonSchemaTypeBoolean = "boolean"
+)
+
+// jsonSchemaEnumValues lists the values of the API's string enum types.
+// The default (empty) values are added automatically, if the type accepts them.
+var jsonSchemaEnumValues = []HasIsValid{
+	ABSlotContentTypeEmpty, ABSlotContentTypeClone,
+	ResetBootLoaderTypeHard,
+	BootLoaderTypeGrub, BootLoaderTypeSystemdBoot,
+	BootTypeEfi, BootTypeLegacy,
+	CorruptionOptionIoError, CorruptionOptionIgnore, CorruptionOptionPanic, CorruptionOptionRestart,
+	EncryptionUnlockTypePassphrase, EncryptionUnlockTypeKeyFile, EncryptionUnlockTypeTpm2,
+	FileSystemTypeExt4, FileSystemTypeXfs, FileSystemTypeFat32, FileSystemTypeVfat, FileSystemTypeBtrfs,
+	IdTypeId, IdTypePartLabel, IdTypeUuid, IdTypePartUuid,
+	ModuleLoadModeAlways, ModuleLoadModeAuto, ModuleLoadModeDisable, ModuleLoadModeInherit,
+	MountIdentifierTypeUuid, MountIdentifierTypePartUuid, MountIdentifierTypePartLabel,
+	PartitionTableTypeGpt,
+	PartitionTypeESP, PartitionTypeBiosGrub,
+	PasswordTypeLocked, PasswordTypePlainText, PasswordTypeHashed, PasswordTypePlainTextFile,
+	PasswordTypeHashedFile,
+	RaidLevelRaid0, RaidLevelRaid1, RaidLevelRaid5, RaidLevelRaid6, RaidLevelRaid10,
+	ResetPartitionsUuidsTypeAll,
+	SbomFormatSpdx, SbomFormatCycloneDx,
+	SELinuxModeDisabled, SELinuxModeEnforcing, SELinuxModePermissive, SELinuxModeForceEnforcing,
+}
+
+// jsonSchema is the subset of JSON Schema that is needed to describe the config file format.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*jsonSchema `json:"$defs,omitempty"`
+
+	// False indicates the schema doesn't match any value (i.e. the 'false' schema).
+	False bool `json:"-"`
+
+	// unmarshalType is set for types with a custom UnmarshalYAML function.
+	// Their values are checked by decoding them, since their errors are more descriptive than a pattern mismatch.
+	unmarshalType reflect.Type
+}
+
+func (s *jsonSchema) MarshalJSON() ([]byte, error) {
+	if s.False {
+		return []byte("false"), nil
+	}
+
+	type IntermediateTypeJsonSchema jsonSchema
+	return json.Marshal((*IntermediateTypeJsonSchema)(s))
+}
+
+// jsonSchemaCache holds the generated schema of each type, since generating a schema walks the entire type tree.
+// The schemas are treated as read-only once they are generated.
+var jsonSchemaCache sync.Map
+
+// ConfigJsonSchema returns the JSON Schema of the image customizer config file.
+func ConfigJsonSchema() ([]byte, error) {
+	schema := cachedJsonSchema(reflect.TypeOf(Config{}))
+
+	schemaJson, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize JSON schema:\n%w", err)
+	}
+
+	return schemaJson, nil
+}
+
+// ValidateConfigYamlSchema checks a config file's contents against the config file's JSON Schema.
+// This reports errors (e.g. unknown fields, wrong value types and invalid enum values) with the line, column and field
+// path of the value. So, it should be called before the config file is decoded.
+func ValidateConfigYamlSchema(yamlData []byte) error {
+	return validateYamlDataSchema(yamlData, reflect.TypeOf(Config{}))
+}
+
+func validateYamlDataSchema(yamlData []byte, valueType reflect.Type) error {
+	var node yaml.Node
+	err := yaml.Unmarshal(yamlData, &node)
+	if err != nil {
+		return err
+	}
+
+	if node.Kind == 0 {
+		// Empty document.
+		return nil
+	}
+
+	return validateYamlSchema(&node, cachedJsonSchema(valueType))
+}
+
+// cachedJsonSchema returns the schema of a type, generating it only on first use.
+func cachedJsonSchema(valueType reflect.Type) *jsonSchema {
+	schema, found := jsonSchemaCache.Load(valueType)
+	if !found {
+		schema, _ = jsonSchemaCache.LoadOrStore(valueType, newJsonSchema(valueType))
+	}
+
+	return schema.(*jsonSchema)
+}
+
+type jsonSchemaGenerator struct {
+	defs map[string]*jsonSchema
+}
+
+func newJsonSchema(valueType reflect.Type) *jsonSchema {
+	generator := jsonSchemaGenerator{
+		defs: make(map[string]*jsonSchema),
+	}
+
+	schema := generator.typeSchema(valueType)
+	schema.Schema = jsonSchemaDialect
+	schema.Defs = generator.defs
+	return schema
+}
+
+func (g *jsonSchemaGenerator) typeSchema(valueType reflect.Type) *jsonSchema {
+	for valueType.Kind() == reflect.Pointer {
+		valueType = valueType.Elem()
+	}
+
+	if valueType.PkgPath() == "" {
+		// Built-in type.
+		return g.kindSchema(valueType)
+	}
+
+	name := valueType.Name()
+	if _, found := g.defs[name]; !found {
+		// Reserve the name first, in case the type references itself.
+		g.defs[name] = nil
+		g.defs[name] = g.namedTypeSchema(valueType)
+	}
+
+	return &jsonSchema{Ref: jsonSchemaDefsPrefix + name}
+}
+
+func (g *jsonSchemaGenerator) namedTypeSchema(valueType reflect.Type) *jsonSchema {
+	// Types with a custom UnmarshalYAML function.
+	switch valueType {
+	case reflect.TypeOf(DiskSize(0)):
+		return &jsonSchema{Type: jsonSchemaTypeString, Pattern: `^[0-9]+[KMGT]$`, unmarshalType: valueType}
+
+	case reflect.TypeOf(PartitionSize{}):
+		return &jsonSchema{Type: jsonSchemaTypeString, Pattern: `^(grow|[0-9]+[KMGT])$`, unmarshalType: valueType}
+
+	case reflect.TypeOf(FilePermissions(0)):
+		return &jsonSchema{
+			AnyOf: []*jsonSchema{
+				{Type: jsonSchemaTypeInteger},
+				{Type: jsonSchemaTypeString, Pattern: `^[0-7]+$`},
+			},
+			unmarshalType: valueType,
+		}
+
+	case reflect.TypeOf(MountPoint{}):
+		return &jsonSchema{AnyOf: []*jsonSchema{
+			{Type: jsonSchemaTypeString},
+			g.kindSchema(valueType),
+		}}
+	}
+
+	if valueType.Kind() == reflect.String {
+		enum := enumValues(valueType)
+		if len(enum) > 0 {
+			return &jsonSchema{Type: jsonSchemaTypeString, Enum: enum}
+		}
+	}
+
+	return g.kindSchema(valueType)
+}
+
+func (g *jsonSchemaGenerator) kindSchema(valueType reflect.Type) *jsonSchema {
+	switch valueType.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: jsonSchemaTypeBoolean}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: jsonSchemaTypeInteger}
+
+	case reflect.String:
+		return &jsonSchema{Type: jsonSchemaTypeString}
+
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: jsonSchemaTypeArray, Items: g.typeSchema(valueType.Elem())}
+
+	case reflect.Map:
+		return &jsonSchema{Type: jsonSchemaTypeObject, AdditionalProperties: g.typeSchema(valueType.Elem())}
+
+	case reflect.Struct:
+		return g.structSchema(valueType)
+
+	default:
+		// Allow any value.
+		return &jsonSchema{}
+	}
+}
+
+func (g *jsonSchemaGenerator) structSchema(valueType reflect.Type) *jsonSchema {
+	schema := &jsonSchema{
+		Type:                 jsonSchemaTypeObject,
+		Properties:           make(map[string]*jsonSchema),
+		AdditionalProperties: &jsonSchema{False: true},
+	}
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+
+		// Fields without a yaml tag are internal values that are filled in during validation.
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		schema.Properties[name] = g.typeSchema(field.Type)
+	}
+
+	return schema
+}
+
+// enumValues returns the valid values of a string enum type.
+func enumValues(valueType reflect.Type) []string {
+	values := []string(nil)
+
+	defaultValue, hasIsValid := reflect.New(valueType).Interface().(HasIsValid)
+	if hasIsValid && defaultValue.IsValid() == nil {
+		values = append(values, "")
+	}
+
+	for _, value := range jsonSchemaEnumValues {
+		// Some values (e.g. plain-text passwords) are only valid in some builds.
+		if reflect.TypeOf(value) == valueType && value.IsValid() == nil {
+			values = append(values, reflect.ValueOf(value).String())
+		}
+	}
+
+	if len(values) == 1 && values[0] == "" {
+		// Not an enum type.
+		return nil
+	}
+
+	return values
+}
+
+// validateYamlSchema checks that a YAML document matches a JSON schema.
+// This allows errors to be reported with the line and column of the invalid value, instead of just the line (or no
+// location at all) that the YAML decoder and the IsValid() functions report.
+func validateYamlSchema(node *yaml.Node, schema *jsonSchema) error {
+	validator := yamlSchemaValidator{
+		defs:     schema.Defs,
+		patterns: make(map[string]*regexp.Regexp),
+	}
+
+	validator.validate(node, schema, "")
+
+	if len(validator.errs) > 0 {
+		return fmt.Errorf("yaml schema validation failed:\n%w", errors.Join(validator.errs...))
+	}
+
+	return nil
+}
+
+type yamlSchemaValidator struct {
+	defs     map[string]*jsonSchema
+	patterns map[string]*regexp.Regexp
+	errs     []error
+}
+
+func (v *yamlSchemaValidator) validate(node *yaml.Node, schema *jsonSchema, path string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			v.validate(child, schema, path)
+		}
+		return
+
+	case yaml.AliasNode:
+		v.validate(node.Alias, schema, path)
+		return
+
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			// The YAML decoder treats null as the type's zero value.
+			return
+		}
+	}
+
+	schema = v.resolve(schema)
+
+	if schema.unmarshalType != nil {
+		err := node.Decode(reflect.New(schema.unmarshalType).Interface())
+		if err != nil {
+			v.addError(node, path, "%s", err)
+		}
+		return
+	}
+
+	if len(schema.AnyOf) > 0 {
+		// Pick the option based on the node's kind.
+		types := []string(nil)
+		for _, option := range schema.AnyOf {
+			option = v.resolve(option)
+			if yamlNodeMatchesType(node, option.Type) {
+				v.validate(node, option, path)
+				return
+			}
+
+			types = append(types, describeJsonSchemaType(option.Type))
+		}
+
+		v.addError(node, path, "expected %s", strings.Join(types, " or "))
+		return
+	}
+
+	if !yamlNodeMatchesType(node, schema.Type) {
+		v.addError(node, path, "expected %s", describeJsonSchemaType(schema.Type))
+		return
+	}
+
+	switch schema.Type {
+	case jsonSchemaTypeObject:
+		v.validateMapping(node, schema, path)
+
+	case jsonSchemaTypeArray:
+		for i, item := range node.Content {
+			v.validate(item, schema.Items, fmt.Sprintf("%s[%d]", path, i))
+		}
+
+	case jsonSchemaTypeString:
+		v.validateString(node, schema, path)
+	}
+}
+
+func (v *yamlSchemaValidator) validateMapping(node *yaml.Node, schema *jsonSchema, path string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		value := node.Content[i+1]
+
+		if key.Tag == "!!merge" {
+			// Merge key (<<). So, the value's fields belong to this mapping.
+			if value.Kind == yaml.SequenceNode {
+				for _, item := range value.Content {
+					v.validate(item, schema, path)
+				}
+			} else {
+				v.validate(value, schema, path)
+			}
+			continue
+		}
+
+		propertySchema, found := schema.Properties[key.Value]
+		if !found {
+			propertySchema = schema.AdditionalProperties
+		}
+
+		switch {
+		case propertySchema == nil:
+			continue
+
+		case propertySchema.False:
+			v.addError(key, path, "unknown field (%s)", key.Value)
+
+		default:
+			propertyPath := key.Value
+			if path != "" {
+				propertyPath = path + "." + key.Value
+			}
+
+			v.validate(value, propertySchema, propertyPath)
+		}
+	}
+}
+
+func (v *yamlSchemaValidator) validateString(node *yaml.Node, schema *jsonSchema, path string) {
+	if len(schema.Enum) > 0 {
+		if !sliceutils.ContainsValue(schema.Enum, node.Value) {
+			// Don't list the default (empty) value.
+			validValues := sliceutils.FindMatches(schema.Enum, func(value string) bool { return value != "" })
+			v.addError(node, path, "invalid value (%s): must be one of (%s)", node.Value,
+				strings.Join(validValues, ", "))
+			return
+		}
+	}
+
+	if schema.Pattern != "" {
+		pattern, found := v.patterns[schema.Pattern]
+		if !found {
+			pattern = regexp.MustCompile(schema.Pattern)
+			v.patterns[schema.Pattern] = pattern
+		}
+
+		if !pattern.MatchString(node.Value) {
+			v.addError(node, path, "invalid value (%s): must match (%s)", node.Value, schema.Pattern)
+			return
+		}
+	}
+}
+
+func (v *yamlSchemaValidator) resolve(schema *jsonSchema) *jsonSchema {
+	for schema.Ref != "" {
+		schema = v.defs[strings.TrimPrefix(schema.Ref, jsonSchemaDefsPrefix)]
+	}
+	return schema
+}
+
+func (v *yamlSchemaValidator) addError(node *yaml.Node, path string, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if path != "" {
+		message = fmt.Sprintf("%s: %s", path, message)
+	}
+
+	v.errs = append(v.errs, fmt.Errorf("line %d, column %d: %s", node.Line, node.Column, message))
+}
+
+func yamlNodeMatchesType(node *yaml.Node, schemaType string) bool {
+	switch schemaType {
+	case jsonSchemaTypeObject:
+		return node.Kind == yaml.MappingNode
+
+	case jsonSchemaTypeArray:
+		return node.Kind == yaml.SequenceNode
+
+	case jsonSchemaTypeString:
+		// The YAML decoder accepts any scalar value for a string.
+		return node.Kind == yaml.ScalarNode
+
+	case jsonSchemaTypeInteger:
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!int"
+
+	case jsonSchemaTypeBoolean:
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!bool"
+
+	default:
+		return true
+	}
+}
+
+func describeJsonSchemaType(schemaType string) string {
+	switch schemaType {
+	case jsonSchemaTypeObject:
+		return "a mapping"
+
+	case jsonSchemaTypeArray:
+		return "a list"
+
+	case jsonSchemaTypeString:
+		return "a string"
+
+	case jsonSchemaTypeInteger:
+		return "an integer"
+
+	case jsonSchemaTypeBoolean:
+		return "a boolean"
+
+	default:
+		return "any value"
+	}
+}
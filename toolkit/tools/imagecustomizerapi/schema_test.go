@@ -0,0 +1,128 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigJsonSchema(t *testing.T) {
+	schemaJson, err := ConfigJsonSchema()
+	assert.NoError(t, err)
+
+	var schema map[string]any
+	err = json.Unmarshal(schemaJson, &schema)
+	assert.NoError(t, err)
+	assert.Equal(t, jsonSchemaDialect, schema["$schema"])
+	assert.Equal(t, "#/$defs/Config", schema["$ref"])
+
+	defs := schema["$defs"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string", "enum": []any{"", "efi", "legacy"}}, defs["BootType"])
+	assert.Equal(t, map[string]any{"type": "string", "pattern": "^[0-9]+[KMGT]$"}, defs["DiskSize"])
+
+	config := defs["Config"].(map[string]any)
+	assert.Equal(t, "object", config["type"])
+	assert.Equal(t, false, config["additionalProperties"])
+	assert.Equal(t, map[string]any{"$ref": "#/$defs/OS"}, config["properties"].(map[string]any)["os"])
+
+	// Fields without a yaml tag aren't part of the config file.
+	filesystem := defs["FileSystem"].(map[string]any)
+	assert.NotContains(t, filesystem["properties"], "PartitionId")
+}
+
+func TestJsonSchemaEnumValuesAreValid(t *testing.T) {
+	for _, value := range jsonSchemaEnumValues {
+		valueType := reflect.TypeOf(value)
+		assert.Equal(t, reflect.String, valueType.Kind(), "%s", valueType)
+
+		// Check that the type rejects values that aren't in its enum.
+		invalidValue := reflect.New(valueType).Elem()
+		invalidValue.SetString("not-a-valid-value")
+		assert.Error(t, invalidValue.Interface().(HasIsValid).IsValid(), "%s", valueType)
+	}
+}
+
+func TestValidateYamlSchemaTestConfigs(t *testing.T) {
+	configFiles, err := filepath.Glob(filepath.Join(workingDir, "../pkg/imagecustomizerlib/testdata/*.yaml"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, configFiles)
+
+	for _, configFile := range configFiles {
+		configData, err := os.ReadFile(configFile)
+		assert.NoError(t, err)
+
+		err = ValidateConfigYamlSchema(configData)
+		assert.NoError(t, err, "%s", configFile)
+	}
+}
+
+func TestCachedJsonSchema(t *testing.T) {
+	schema := cachedJsonSchema(reflect.TypeOf(Config{}))
+	assert.Same(t, schema, cachedJsonSchema(reflect.TypeOf(Config{})))
+	assert.NotSame(t, schema, cachedJsonSchema(reflect.TypeOf(MountPoint{})))
+}
+
+func TestValidateConfigYamlSchemaErrors(t *testing.T) {
+	yamlString := `
+storage:
+  bootType: efi
+  disks:
+  - partitionTableType: mbr
+    maxSize: 1G
+    partitions:
+    - id: esp
+      size: 8Q
+os:
+  hostname: test
+  users:
+  - name: test
+    passwrd: test
+  kernelCommandLine:
+    extraCommandLine: [ console=ttyS0 ]
+`
+
+	err := ValidateConfigYamlSchema([]byte(yamlString))
+	assert.ErrorContains(t, err, "yaml schema validation failed:\n"+
+		"line 5, column 25: storage.disks[0].partitionTableType: invalid value (mbr): must be one of (gpt)\n"+
+		"line 9, column 13: storage.disks[0].partitions[0].size: (8Q) has incorrect format")
+	assert.ErrorContains(t, err, "line 14, column 5: os.users[0]: unknown field (passwrd)\n"+
+		"line 16, column 23: os.kernelCommandLine.extraCommandLine: expected a string")
+}
+
+func TestValidateYamlDataSchemaMountPoint(t *testing.T) {
+	mountPointType := reflect.TypeOf(MountPoint{})
+	err := validateYamlDataSchema([]byte("path: /\nidType: uuid"), mountPointType)
+	assert.NoError(t, err)
+
+	err = validateYamlDataSchema([]byte("path: /\nidType: label"), mountPointType)
+	assert.ErrorContains(t, err, "line 2, column 9: idType: invalid value (label): must be one of "+
+		"(uuid, part-uuid, part-label)")
+
+	err = validateYamlDataSchema([]byte("[ / ]"), mountPointType)
+	assert.ErrorContains(t, err, "line 1, column 1: expected a string or a mapping")
+}
+
+func TestValidateConfigYamlSchemaNullAndAlias(t *testing.T) {
+	yamlString := `
+os:
+  hostname: &name test
+  packages:
+    install: [ *name ]
+scripts:
+`
+
+	err := ValidateConfigYamlSchema([]byte(yamlString))
+	assert.NoError(t, err)
+
+	var config Config
+	err = UnmarshalYaml([]byte(yamlString), &config)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test"}, config.OS.Packages.Install)
+}
@@ -13,6 +13,10 @@ type Storage struct {
 	Disks                    []Disk                   `yaml:"disks"`
 	FileSystems              []FileSystem             `yaml:"filesystems"`
 	Verity                   []Verity                 `yaml:"verity"`
+	Encryption               []Encryption             `yaml:"encryption"`
+	VolumeGroups             []VolumeGroup            `yaml:"volumeGroups"`
+	Raid                     []Raid                   `yaml:"raid"`
+	ABUpdate                 *ABUpdate                `yaml:"abUpdate"`
 }
 
 func (s *Storage) IsValid() error {
@@ -48,6 +52,41 @@ func (s *Storage) IsValid() error {
 		}
 	}
 
+	for i, encryption := range s.Encryption {
+		err = encryption.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid encryption item at index %d:\n%w", i, err)
+		}
+	}
+
+	raidNames := make(map[string]bool)
+	for i, raid := range s.Raid {
+		err = raid.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid raid item at index %d:\n%w", i, err)
+		}
+
+		if _, existingName := raidNames[raid.Name]; existingName {
+			return fmt.Errorf("invalid raid item at index %d:\nduplicate name (%s)", i, raid.Name)
+		}
+
+		raidNames[raid.Name] = true
+	}
+
+	volumeGroupNames := make(map[string]bool)
+	for i, volumeGroup := range s.VolumeGroups {
+		err = volumeGroup.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid volumeGroups item at index %d:\n%w", i, err)
+		}
+
+		if _, existingName := volumeGroupNames[volumeGroup.Name]; existingName {
+			return fmt.Errorf("invalid volumeGroups item at index %d:\nduplicate name (%s)", i, volumeGroup.Name)
+		}
+
+		volumeGroupNames[volumeGroup.Name] = true
+	}
+
 	for i, fileSystem := range s.FileSystems {
 		err = fileSystem.IsValid()
 		if err != nil {
@@ -55,11 +94,22 @@ func (s *Storage) IsValid() error {
 		}
 	}
 
+	if s.ABUpdate != nil {
+		err = s.ABUpdate.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid abUpdate:\n%w", err)
+		}
+	}
+
 	hasResetUuids := s.ResetPartitionsUuidsType != ResetPartitionsUuidsTypeDefault
 	hasBootType := s.BootType != BootTypeNone
 	hasDisks := len(s.Disks) > 0
 	hasFileSystems := len(s.FileSystems) > 0
 	hasVerity := len(s.Verity) > 0
+	hasEncryption := len(s.Encryption) > 0
+	hasVolumeGroups := len(s.VolumeGroups) > 0
+	hasRaid := len(s.Raid) > 0
+	hasABUpdate := s.ABUpdate != nil
 
 	if hasResetUuids && hasDisks {
 		return fmt.Errorf("cannot specify both 'resetPartitionsUuidsType' and 'disks'")
@@ -81,6 +131,22 @@ func (s *Storage) IsValid() error {
 		return fmt.Errorf("cannot specify 'verity' without specifying 'disks'")
 	}
 
+	if hasEncryption && !hasDisks {
+		return fmt.Errorf("cannot specify 'encryption' without specifying 'disks'")
+	}
+
+	if hasVolumeGroups && !hasDisks {
+		return fmt.Errorf("cannot specify 'volumeGroups' without specifying 'disks'")
+	}
+
+	if hasRaid && !hasDisks {
+		return fmt.Errorf("cannot specify 'raid' without specifying 'disks'")
+	}
+
+	if hasABUpdate && !hasDisks {
+		return fmt.Errorf("cannot specify 'abUpdate' without specifying 'disks'")
+	}
+
 	// Create a set of all block devices by their Id.
 	deviceMap, partitionLabelCounts, err := s.buildDeviceMap()
 	if err != nil {
@@ -160,9 +226,196 @@ func (s *Storage) IsValid() error {
 		}
 	}
 
+	// Validate encryption filesystem settings.
+	encryptionNames := make(map[string]bool)
+	rootEncrypted := false
+	for i := range s.Encryption {
+		encryption := &s.Encryption[i]
+
+		if _, existingName := encryptionNames[encryption.Name]; existingName {
+			return fmt.Errorf("invalid encryption item at index %d:\nduplicate name (%s)", i, encryption.Name)
+		}
+
+		encryptionNames[encryption.Name] = true
+
+		filesystem, hasFileSystem := deviceParents[encryption.Id].(*FileSystem)
+		if !hasFileSystem || filesystem.Type == FileSystemTypeNone {
+			return fmt.Errorf("encrypted device (%s) must have a filesystem with a 'type'", encryption.Id)
+		}
+
+		encryption.FileSystem = filesystem
+
+		if filesystem.MountPoint != nil && filesystem.MountPoint.Path == "/" {
+			rootEncrypted = true
+		}
+	}
+
+	if rootEncrypted {
+		// The bootloader can't unlock the encrypted root. So, the kernel and initramfs must be on a separate partition.
+		err = s.checkSeparateBootFileSystem(deviceMap, "encrypted root filesystem")
+		if err != nil {
+			return err
+		}
+	}
+
+	// A key file is only as confidential as the filesystem that it is stored on.
+	for i := range s.Encryption {
+		encryption := &s.Encryption[i]
+		if encryption.Unlock != EncryptionUnlockTypeKeyFile {
+			continue
+		}
+
+		if encryption.FileSystem.MountPoint != nil && encryption.FileSystem.MountPoint.isInitramfsMount() {
+			return fmt.Errorf("encrypted device (%s) may not use 'unlock' value 'key-file':\n"+
+				"the (%s) filesystem is unlocked by the initramfs, which is stored unencrypted under '/boot'",
+				encryption.Id, encryption.FileSystem.MountPoint.Path)
+		}
+
+		if !rootEncrypted {
+			return fmt.Errorf("encrypted device (%s) may not use 'unlock' value 'key-file' unless the root filesystem "+
+				"is encrypted:\nthe key file would be stored on the unencrypted root filesystem", encryption.Id)
+		}
+	}
+
+	// Validate logical volume filesystem settings.
+	for _, volumeGroup := range s.VolumeGroups {
+		for _, logicalVolume := range volumeGroup.LogicalVolumes {
+			filesystem, hasFileSystem := deviceParents[logicalVolume.Id].(*FileSystem)
+			if !hasFileSystem || filesystem.MountPoint == nil || filesystem.MountPoint.Path != "/" {
+				continue
+			}
+
+			// The bootloader doesn't activate volume groups. So, the kernel and initramfs must be on a separate
+			// partition.
+			err = s.checkSeparateBootFileSystem(deviceMap, "root filesystem on a logical volume")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Validate RAID filesystem settings.
+	for _, raid := range s.Raid {
+		filesystem, hasFileSystem := deviceParents[raid.Id].(*FileSystem)
+		if !hasFileSystem || filesystem.MountPoint == nil || filesystem.MountPoint.Path != "/" {
+			continue
+		}
+
+		// The bootloader doesn't assemble RAID arrays. So, the kernel and initramfs must be on a separate partition.
+		err = s.checkSeparateBootFileSystem(deviceMap, "root filesystem on a RAID array")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Validate btrfs subvolume settings.
+	for _, filesystem := range s.FileSystems {
+		for _, subvolume := range filesystem.Subvolumes {
+			if subvolume.MountPoint == nil {
+				continue
+			}
+
+			if subvolume.MountPoint.Path == "/" {
+				// The bootloader looks for the kernel and initramfs relative to the top-level subvolume. So, they must
+				// be on a separate partition.
+				err = s.checkSeparateBootFileSystem(deviceMap, "root filesystem on a btrfs subvolume")
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if hasABUpdate {
+		err = s.checkABUpdate(deviceMap, partitionLabelCounts)
+		if err != nil {
+			return fmt.Errorf("invalid abUpdate:\n%w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkABUpdate checks that the root filesystem's partition (i.e. slot A) can be paired with the slot B partition.
+func (s *Storage) checkABUpdate(deviceMap map[string]any, partitionLabelCounts map[string]int) error {
+	var rootFileSystem *FileSystem
+	for i := range s.FileSystems {
+		filesystem := &s.FileSystems[i]
+		if filesystem.MountPoint != nil && filesystem.MountPoint.Path == "/" {
+			rootFileSystem = filesystem
+			break
+		}
+	}
+
+	if rootFileSystem == nil {
+		return fmt.Errorf("A/B update requires a root filesystem (i.e. a 'mountPoint.path' of '/')")
+	}
+
+	// The bootloader selects the slot by its partition. So, the root filesystem can't be on any other type of device.
+	slotAPartition, isPartition := deviceMap[rootFileSystem.DeviceId].(*Partition)
+	if !isPartition {
+		return fmt.Errorf("A/B update requires the root filesystem to be on a partition")
+	}
+
+	slotBPartition := deviceMap[s.ABUpdate.SlotBDeviceId].(*Partition)
+
+	switch rootFileSystem.MountPoint.IdType {
+	case MountIdentifierTypeDefault, MountIdentifierTypePartUuid:
+
+	case MountIdentifierTypePartLabel:
+		if slotBPartition.Label == "" {
+			return fmt.Errorf("idType is set to (part-label) but slot B partition (%s) has no label set",
+				slotBPartition.Id)
+		}
+
+		labelCount := partitionLabelCounts[slotBPartition.Label]
+		if labelCount > 1 {
+			return fmt.Errorf("more than one partition has a label of (%s)", slotBPartition.Label)
+		}
+
+	default:
+		// A filesystem UUID can't tell the slots apart, since a cloned filesystem starts with the same UUID.
+		return fmt.Errorf("A/B update requires the root filesystem's 'mountPoint.idType' to be 'part-uuid' or " +
+			"'part-label'")
+	}
+
+	if s.ABUpdate.SlotBContent == ABSlotContentTypeClone {
+		if rootFileSystem.Type != FileSystemTypeExt4 && rootFileSystem.Type != FileSystemTypeXfs {
+			return fmt.Errorf("'slotBContent' value 'clone' requires the root filesystem 'type' to be 'ext4' or 'xfs'")
+		}
+
+		slotAEnd, slotAHasEnd := slotAPartition.GetEnd()
+		slotBEnd, slotBHasEnd := slotBPartition.GetEnd()
+		if slotAHasEnd && slotBHasEnd && slotBEnd-*slotBPartition.Start < slotAEnd-*slotAPartition.Start {
+			return fmt.Errorf("slot B partition (%s) must be at least as large as slot A partition (%s)",
+				slotBPartition.Id, slotAPartition.Id)
+		}
+	}
+
+	// Both slots boot using the same kernels and grub config. So, they must be on a shared partition.
+	err := s.checkSeparateBootFileSystem(deviceMap, "A/B update")
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// checkSeparateBootFileSystem checks that there is a '/boot' filesystem on a plain partition.
+func (s *Storage) checkSeparateBootFileSystem(deviceMap map[string]any, requiredBy string) error {
+	for _, filesystem := range s.FileSystems {
+		if filesystem.MountPoint != nil && filesystem.MountPoint.Path == "/boot" {
+			if _, isPartition := deviceMap[filesystem.DeviceId].(*Partition); !isPartition {
+				return fmt.Errorf("'/boot' filesystem must be on a partition")
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s requires a separate '/boot' filesystem", requiredBy)
+}
+
 func (s *Storage) CustomizePartitions() bool {
 	return len(s.Disks) > 0
 }
@@ -197,6 +450,41 @@ func (s *Storage) buildDeviceMap() (map[string]any, map[string]int, error) {
 		deviceMap[verity.Id] = verity
 	}
 
+	for i := range s.Encryption {
+		encryption := &s.Encryption[i]
+
+		if _, existingName := deviceMap[encryption.Id]; existingName {
+			return nil, nil, fmt.Errorf("invalid encryption item at index %d:\nduplicate id (%s)", i, encryption.Id)
+		}
+
+		deviceMap[encryption.Id] = encryption
+	}
+
+	for i := range s.Raid {
+		raid := &s.Raid[i]
+
+		if _, existingName := deviceMap[raid.Id]; existingName {
+			return nil, nil, fmt.Errorf("invalid raid item at index %d:\nduplicate id (%s)", i, raid.Id)
+		}
+
+		deviceMap[raid.Id] = raid
+	}
+
+	for i := range s.VolumeGroups {
+		volumeGroup := &s.VolumeGroups[i]
+
+		for j := range volumeGroup.LogicalVolumes {
+			logicalVolume := &volumeGroup.LogicalVolumes[j]
+
+			if _, existingName := deviceMap[logicalVolume.Id]; existingName {
+				return nil, nil, fmt.Errorf("invalid volumeGroups item at index %d:\n"+
+					"invalid logical volume at index %d:\nduplicate id (%s)", i, j, logicalVolume.Id)
+			}
+
+			deviceMap[logicalVolume.Id] = logicalVolume
+		}
+	}
+
 	return deviceMap, partitionLabelCounts, nil
 }
 
@@ -213,6 +501,40 @@ func (s *Storage) checkDeviceTree(deviceMap map[string]any, partitionLabelCounts
 		}
 	}
 
+	for i := range s.Encryption {
+		encryption := &s.Encryption[i]
+
+		err := checkDeviceTreeEncryptionItem(encryption, deviceMap, deviceParents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption item at index %d:\n%w", i, err)
+		}
+	}
+
+	for i := range s.Raid {
+		raid := &s.Raid[i]
+
+		err := checkDeviceTreeRaidItem(raid, deviceMap, deviceParents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid raid item at index %d:\n%w", i, err)
+		}
+	}
+
+	for i := range s.VolumeGroups {
+		volumeGroup := &s.VolumeGroups[i]
+
+		err := checkDeviceTreeVolumeGroupItem(volumeGroup, deviceMap, deviceParents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volumeGroups item at index %d:\n%w", i, err)
+		}
+	}
+
+	if s.ABUpdate != nil {
+		err := checkDeviceTreeABUpdateItem(s.ABUpdate, deviceMap, deviceParents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid abUpdate:\n%w", err)
+		}
+	}
+
 	mountPaths := make(map[string]bool)
 	for i := range s.FileSystems {
 		filesystem := &s.FileSystems[i]
@@ -257,6 +579,78 @@ func addVerityParentToDevice(deviceId string, deviceMap map[string]any, devicePa
 	return nil
 }
 
+func checkDeviceTreeEncryptionItem(encryption *Encryption, deviceMap map[string]any, deviceParents map[string]any,
+) error {
+	device, err := addParentToDevice(encryption.DeviceId, deviceMap, deviceParents, encryption)
+	if err != nil {
+		return fmt.Errorf("invalid 'deviceId':\n%w", err)
+	}
+
+	switch device.(type) {
+	case *Partition:
+
+	default:
+		return fmt.Errorf("device (%s) must be a partition", encryption.DeviceId)
+	}
+
+	return nil
+}
+
+func checkDeviceTreeVolumeGroupItem(volumeGroup *VolumeGroup, deviceMap map[string]any,
+	deviceParents map[string]any,
+) error {
+	for _, physicalVolume := range volumeGroup.PhysicalVolumes {
+		device, err := addParentToDevice(physicalVolume, deviceMap, deviceParents, volumeGroup)
+		if err != nil {
+			return fmt.Errorf("invalid 'physicalVolumes':\n%w", err)
+		}
+
+		switch device.(type) {
+		case *Partition, *Raid:
+
+		default:
+			return fmt.Errorf("physical volume (%s) must be a partition or a RAID array", physicalVolume)
+		}
+	}
+
+	return nil
+}
+
+func checkDeviceTreeRaidItem(raid *Raid, deviceMap map[string]any, deviceParents map[string]any) error {
+	for _, deviceId := range raid.Devices {
+		device, err := addParentToDevice(deviceId, deviceMap, deviceParents, raid)
+		if err != nil {
+			return fmt.Errorf("invalid 'devices':\n%w", err)
+		}
+
+		switch device.(type) {
+		case *Partition:
+
+		default:
+			return fmt.Errorf("device (%s) must be a partition", deviceId)
+		}
+	}
+
+	return nil
+}
+
+func checkDeviceTreeABUpdateItem(abUpdate *ABUpdate, deviceMap map[string]any, deviceParents map[string]any,
+) error {
+	device, err := addParentToDevice(abUpdate.SlotBDeviceId, deviceMap, deviceParents, abUpdate)
+	if err != nil {
+		return fmt.Errorf("invalid 'slotBDeviceId':\n%w", err)
+	}
+
+	switch device.(type) {
+	case *Partition:
+
+	default:
+		return fmt.Errorf("device (%s) must be a partition", abUpdate.SlotBDeviceId)
+	}
+
+	return nil
+}
+
 func checkDeviceTreeFileSystemItem(filesystem *FileSystem, deviceMap map[string]any, deviceParents map[string]any,
 	partitionLabelCounts map[string]int, mountPaths map[string]bool,
 ) error {
@@ -265,19 +659,36 @@ func checkDeviceTreeFileSystemItem(filesystem *FileSystem, deviceMap map[string]
 		return fmt.Errorf("invalid 'deviceId':\n%w", err)
 	}
 
-	if filesystem.MountPoint != nil {
-		if _, existingMountPath := mountPaths[filesystem.MountPoint.Path]; existingMountPath {
-			return fmt.Errorf("duplicate 'mountPoint.path' (%s)", filesystem.MountPoint.Path)
+	for _, mountPoint := range filesystem.MountPoints() {
+		if _, existingMountPath := mountPaths[mountPoint.Path]; existingMountPath {
+			return fmt.Errorf("duplicate 'mountPoint.path' (%s)", mountPoint.Path)
+		}
+
+		mountPaths[mountPoint.Path] = true
+	}
+
+	if filesystem.Type == FileSystemTypeBtrfs {
+		// Subvolumes are created directly on the partition.
+		if _, isPartition := device.(*Partition); !isPartition {
+			return fmt.Errorf("btrfs filesystem (%s) must be on a partition", filesystem.DeviceId)
 		}
 
-		mountPaths[filesystem.MountPoint.Path] = true
+		for _, subvolume := range filesystem.Subvolumes {
+			if subvolume.MountPoint != nil && subvolume.MountPoint.Path == "/boot" {
+				return fmt.Errorf("btrfs subvolume (%s) may not be mounted at '/boot'", subvolume.Path)
+			}
+		}
 	}
 
 	switch device := device.(type) {
 	case *Partition:
 		filesystem.PartitionId = filesystem.DeviceId
 
-		if filesystem.MountPoint != nil && filesystem.MountPoint.IdType == MountIdentifierTypePartLabel {
+		for _, mountPoint := range filesystem.MountPoints() {
+			if mountPoint.IdType != MountIdentifierTypePartLabel {
+				continue
+			}
+
 			if device.Label == "" {
 				return fmt.Errorf("idType is set to (part-label) but partition (%s) has no label set", device.Id)
 			}
@@ -296,6 +707,32 @@ func checkDeviceTreeFileSystemItem(filesystem *FileSystem, deviceMap map[string]
 				filesystem.DeviceId)
 		}
 
+	case *Encryption:
+		filesystem.PartitionId = device.DeviceId
+
+		if filesystem.MountPoint != nil && filesystem.MountPoint.IdType != MountIdentifierTypeDefault {
+			return fmt.Errorf("filesystem for encrypted device (%s) may not specify 'mountPoint.idType'",
+				filesystem.DeviceId)
+		}
+
+	case *LogicalVolume:
+		filesystem.PartitionId = device.Id
+
+		if filesystem.MountPoint != nil && filesystem.MountPoint.IdType != MountIdentifierTypeDefault {
+			return fmt.Errorf("filesystem for logical volume (%s) may not specify 'mountPoint.idType'",
+				filesystem.DeviceId)
+		}
+
+	case *Raid:
+		filesystem.PartitionId = device.Id
+
+		// RAID arrays don't have partition identifiers.
+		if filesystem.MountPoint != nil && filesystem.MountPoint.IdType != MountIdentifierTypeDefault &&
+			filesystem.MountPoint.IdType != MountIdentifierTypeUuid {
+			return fmt.Errorf("filesystem for RAID array (%s) may only specify a 'mountPoint.idType' of 'uuid'",
+				filesystem.DeviceId)
+		}
+
 	default:
 
 	}
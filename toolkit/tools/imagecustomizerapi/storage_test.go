@@ -1247,3 +1247,835 @@ func TestStorageIsValidVerityTwoVerity(t *testing.T) {
 	assert.ErrorContains(t, err, "invalid 'dataDeviceId'")
 	assert.ErrorContains(t, err, "device (root) is used by multiple things")
 }
+
+// newTestEncryptedRootStorage returns a valid storage config with an encrypted root filesystem.
+func newTestEncryptedRootStorage() Storage {
+	return Storage{
+		Disks: []Disk{{
+			PartitionTableType: "gpt",
+			Partitions: []Partition{
+				{
+					Id: "esp",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 8 * diskutils.MiB,
+					},
+					Type: PartitionTypeESP,
+				},
+				{
+					Id: "boot",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 100 * diskutils.MiB,
+					},
+				},
+				{
+					Id: "root",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 1 * diskutils.GiB,
+					},
+				},
+			},
+		}},
+		BootType: "efi",
+		FileSystems: []FileSystem{
+			{
+				DeviceId: "esp",
+				Type:     "vfat",
+				MountPoint: &MountPoint{
+					Path: "/boot/efi",
+				},
+			},
+			{
+				DeviceId: "boot",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/boot",
+				},
+			},
+			{
+				DeviceId: "rootencrypted",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/",
+				},
+			},
+		},
+		Encryption: []Encryption{
+			{
+				Id:       "rootencrypted",
+				Name:     "luks-root",
+				DeviceId: "root",
+				KeyFile:  "files/root.key",
+			},
+		},
+	}
+}
+
+func TestStorageIsValidEncryptionRoot(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+
+	err := value.IsValid()
+	assert.NoError(t, err)
+	assert.Equal(t, &value.FileSystems[2], value.Encryption[0].FileSystem)
+	assert.Equal(t, "root", value.FileSystems[2].PartitionId)
+}
+
+func TestStorageIsValidEncryptionRootWithoutBoot(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+	value.FileSystems = append(value.FileSystems[:1], value.FileSystems[2])
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "encrypted root filesystem requires a separate '/boot' filesystem")
+}
+
+func TestStorageIsValidEncryptionBadDeviceId(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+	value.Encryption[0].DeviceId = "rootfs"
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "invalid encryption item at index 0")
+	assert.ErrorContains(t, err, "device (rootfs) not found")
+}
+
+func TestStorageIsValidEncryptionFileSystemHasIdType(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+	value.FileSystems[2].MountPoint.IdType = MountIdentifierTypePartUuid
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "filesystem for encrypted device (rootencrypted) may not specify 'mountPoint.idType'")
+}
+
+func TestStorageIsValidEncryptionFileSystemMissing(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+	value.FileSystems = value.FileSystems[:2]
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "encrypted device (rootencrypted) must have a filesystem with a 'type'")
+}
+
+// addTestEncryptedVar adds an encrypted '/var' partition to a storage config.
+func addTestEncryptedVar(storage *Storage, unlock EncryptionUnlockType) {
+	storage.Disks[0].Partitions = append(storage.Disks[0].Partitions, Partition{
+		Id: "var",
+		Size: PartitionSize{
+			Type: PartitionSizeTypeExplicit,
+			Size: 1 * diskutils.GiB,
+		},
+	})
+	storage.FileSystems = append(storage.FileSystems, FileSystem{
+		DeviceId: "varencrypted",
+		Type:     "ext4",
+		MountPoint: &MountPoint{
+			Path: "/var",
+		},
+	})
+	storage.Encryption = append(storage.Encryption, Encryption{
+		Id:       "varencrypted",
+		Name:     "luks-var",
+		DeviceId: "var",
+		KeyFile:  "files/var.key",
+		Unlock:   unlock,
+	})
+}
+
+func TestStorageIsValidEncryptionKeyFile(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+	value.Encryption[0].Unlock = EncryptionUnlockTypeTpm2
+	addTestEncryptedVar(&value, EncryptionUnlockTypeKeyFile)
+
+	err := value.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestStorageIsValidEncryptionKeyFileRoot(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+	value.Encryption[0].Unlock = EncryptionUnlockTypeKeyFile
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "encrypted device (rootencrypted) may not use 'unlock' value 'key-file':\n"+
+		"the (/) filesystem is unlocked by the initramfs, which is stored unencrypted under '/boot'")
+}
+
+func TestStorageIsValidEncryptionKeyFileInitrdMount(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+	value.Encryption[0].Unlock = EncryptionUnlockTypeTpm2
+	addTestEncryptedVar(&value, EncryptionUnlockTypeKeyFile)
+	value.FileSystems[3].MountPoint.Options = "defaults,x-initrd.mount"
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "encrypted device (varencrypted) may not use 'unlock' value 'key-file':\n"+
+		"the (/var) filesystem is unlocked by the initramfs")
+}
+
+func TestStorageIsValidEncryptionKeyFileUnencryptedRoot(t *testing.T) {
+	value := newTestEncryptedRootStorage()
+	value.Encryption = nil
+	value.FileSystems[2].DeviceId = "root"
+	addTestEncryptedVar(&value, EncryptionUnlockTypeKeyFile)
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "encrypted device (varencrypted) may not use 'unlock' value 'key-file' unless the "+
+		"root filesystem is encrypted")
+}
+
+// newTestVerityRootEncryptedVarStorage returns a valid storage config with a verity root filesystem and an
+// encrypted /var filesystem.
+func newTestVerityRootEncryptedVarStorage(unlock EncryptionUnlockType) Storage {
+	value := newTestEncryptedRootStorage()
+	value.Encryption = nil
+	value.Disks[0].Partitions = append(value.Disks[0].Partitions, Partition{
+		Id: "roothash",
+		Size: PartitionSize{
+			Type: PartitionSizeTypeExplicit,
+			Size: 100 * diskutils.MiB,
+		},
+	})
+	value.FileSystems[2].DeviceId = "rootverity"
+	value.Verity = []Verity{
+		{
+			Id:           "rootverity",
+			Name:         "root",
+			DataDeviceId: "root",
+			HashDeviceId: "roothash",
+		},
+	}
+	addTestEncryptedVar(&value, unlock)
+	return value
+}
+
+func TestStorageIsValidEncryptionAndVerity(t *testing.T) {
+	value := newTestVerityRootEncryptedVarStorage(EncryptionUnlockTypeTpm2)
+
+	err := value.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestStorageIsValidEncryptionAndVerityKeyFile(t *testing.T) {
+	value := newTestVerityRootEncryptedVarStorage(EncryptionUnlockTypeKeyFile)
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "encrypted device (varencrypted) may not use 'unlock' value 'key-file' unless the "+
+		"root filesystem is encrypted")
+}
+
+func TestStorageIsValidEncryptionOfVerityDevice(t *testing.T) {
+	value := newTestVerityRootEncryptedVarStorage(EncryptionUnlockTypeTpm2)
+	value.Encryption[0].DeviceId = "root"
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "invalid encryption item at index 0")
+}
+
+// newTestLvmRootStorage returns a valid storage config with the root filesystem on a logical volume.
+func newTestLvmRootStorage() Storage {
+	return Storage{
+		Disks: []Disk{{
+			PartitionTableType: "gpt",
+			Partitions: []Partition{
+				{
+					Id: "esp",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 8 * diskutils.MiB,
+					},
+					Type: PartitionTypeESP,
+				},
+				{
+					Id: "boot",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 100 * diskutils.MiB,
+					},
+				},
+				{
+					Id: "pv",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 4 * diskutils.GiB,
+					},
+				},
+			},
+		}},
+		BootType: "efi",
+		VolumeGroups: []VolumeGroup{
+			{
+				Name:            "vg0",
+				PhysicalVolumes: []string{"pv"},
+				LogicalVolumes: []LogicalVolume{
+					{
+						Id:   "rootlv",
+						Name: "root",
+						Size: ptrutils.PtrTo(DiskSize(2 * diskutils.GiB)),
+					},
+					{
+						Id:   "varlv",
+						Name: "var",
+					},
+				},
+			},
+		},
+		FileSystems: []FileSystem{
+			{
+				DeviceId: "esp",
+				Type:     "vfat",
+				MountPoint: &MountPoint{
+					Path: "/boot/efi",
+				},
+			},
+			{
+				DeviceId: "boot",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/boot",
+				},
+			},
+			{
+				DeviceId: "rootlv",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/",
+				},
+			},
+			{
+				DeviceId: "varlv",
+				Type:     "xfs",
+				MountPoint: &MountPoint{
+					Path: "/var",
+				},
+			},
+		},
+	}
+}
+
+func TestStorageIsValidVolumeGroupRoot(t *testing.T) {
+	value := newTestLvmRootStorage()
+
+	err := value.IsValid()
+	assert.NoError(t, err)
+	assert.Equal(t, "rootlv", value.FileSystems[2].PartitionId)
+	assert.Equal(t, "varlv", value.FileSystems[3].PartitionId)
+}
+
+func TestStorageIsValidVolumeGroupRootWithoutBoot(t *testing.T) {
+	value := newTestLvmRootStorage()
+	value.FileSystems = append(value.FileSystems[:1], value.FileSystems[2:]...)
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "root filesystem on a logical volume requires a separate '/boot' filesystem")
+}
+
+func TestStorageIsValidVolumeGroupBootOnLogicalVolume(t *testing.T) {
+	value := newTestLvmRootStorage()
+	value.FileSystems[1].DeviceId = "bootlv"
+	value.VolumeGroups[0].LogicalVolumes = append([]LogicalVolume{{
+		Id:   "bootlv",
+		Name: "boot",
+		Size: ptrutils.PtrTo(DiskSize(100 * diskutils.MiB)),
+	}}, value.VolumeGroups[0].LogicalVolumes...)
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "'/boot' filesystem must be on a partition")
+}
+
+func TestStorageIsValidVolumeGroupBadPhysicalVolume(t *testing.T) {
+	value := newTestLvmRootStorage()
+	value.VolumeGroups[0].PhysicalVolumes = []string{"varlv"}
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "invalid volumeGroups item at index 0")
+	assert.ErrorContains(t, err, "physical volume (varlv) must be a partition or a RAID array")
+}
+
+func TestStorageIsValidVolumeGroupPhysicalVolumeHasFileSystem(t *testing.T) {
+	value := newTestLvmRootStorage()
+	value.VolumeGroups[0].PhysicalVolumes = []string{"boot"}
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "device (boot) is used by multiple things")
+}
+
+func TestStorageIsValidVolumeGroupDuplicateLogicalVolumeId(t *testing.T) {
+	value := newTestLvmRootStorage()
+	value.VolumeGroups[0].LogicalVolumes[1].Id = "pv"
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "invalid logical volume at index 1")
+	assert.ErrorContains(t, err, "duplicate id (pv)")
+}
+
+func TestStorageIsValidVolumeGroupDuplicateName(t *testing.T) {
+	value := newTestLvmRootStorage()
+	value.VolumeGroups = append(value.VolumeGroups, VolumeGroup{
+		Name:            "vg0",
+		PhysicalVolumes: []string{"boot"},
+	})
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "invalid volumeGroups item at index 1")
+	assert.ErrorContains(t, err, "duplicate name (vg0)")
+}
+
+func TestStorageIsValidVolumeGroupFileSystemHasIdType(t *testing.T) {
+	value := newTestLvmRootStorage()
+	value.FileSystems[3].MountPoint.IdType = MountIdentifierTypeUuid
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "filesystem for logical volume (varlv) may not specify 'mountPoint.idType'")
+}
+
+func newTestRaidRootStorage() Storage {
+	return Storage{
+		Disks: []Disk{{
+			PartitionTableType: "gpt",
+			Partitions: []Partition{
+				{
+					Id: "esp",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 8 * diskutils.MiB,
+					},
+					Type: PartitionTypeESP,
+				},
+				{
+					Id: "boot",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 100 * diskutils.MiB,
+					},
+				},
+				{
+					Id: "root1",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 2 * diskutils.GiB,
+					},
+				},
+				{
+					Id: "root2",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 2 * diskutils.GiB,
+					},
+				},
+			},
+		}},
+		BootType: "efi",
+		Raid: []Raid{
+			{
+				Id:      "rootraid",
+				Name:    "root",
+				Level:   RaidLevelRaid1,
+				Devices: []string{"root1", "root2"},
+			},
+		},
+		FileSystems: []FileSystem{
+			{
+				DeviceId: "esp",
+				Type:     "vfat",
+				MountPoint: &MountPoint{
+					Path: "/boot/efi",
+				},
+			},
+			{
+				DeviceId: "boot",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/boot",
+				},
+			},
+			{
+				DeviceId: "rootraid",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/",
+				},
+			},
+		},
+	}
+}
+
+func TestStorageIsValidRaidRoot(t *testing.T) {
+	value := newTestRaidRootStorage()
+
+	err := value.IsValid()
+	assert.NoError(t, err)
+	assert.Equal(t, "rootraid", value.FileSystems[2].PartitionId)
+}
+
+func TestStorageIsValidRaidRootWithoutBoot(t *testing.T) {
+	value := newTestRaidRootStorage()
+	value.FileSystems = append(value.FileSystems[:1], value.FileSystems[2:]...)
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "root filesystem on a RAID array requires a separate '/boot' filesystem")
+}
+
+func TestStorageIsValidRaidWithoutDisks(t *testing.T) {
+	value := Storage{
+		Raid: []Raid{
+			{
+				Id:      "rootraid",
+				Name:    "root",
+				Level:   RaidLevelRaid1,
+				Devices: []string{"root1", "root2"},
+			},
+		},
+	}
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "cannot specify 'raid' without specifying 'disks'")
+}
+
+func TestStorageIsValidRaidBadDevice(t *testing.T) {
+	value := newTestRaidRootStorage()
+	value.Raid = append(value.Raid, Raid{
+		Id:      "dataraid",
+		Name:    "data",
+		Level:   RaidLevelRaid0,
+		Devices: []string{"rootraid", "boot"},
+	})
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "invalid raid item at index 1")
+	assert.ErrorContains(t, err, "device (rootraid) must be a partition")
+}
+
+func TestStorageIsValidRaidDeviceHasFileSystem(t *testing.T) {
+	value := newTestRaidRootStorage()
+	value.Raid[0].Devices = []string{"root1", "boot"}
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "device (boot) is used by multiple things")
+}
+
+func TestStorageIsValidRaidDuplicateName(t *testing.T) {
+	value := newTestRaidRootStorage()
+	value.Raid = append(value.Raid, Raid{
+		Id:      "dataraid",
+		Name:    "root",
+		Level:   RaidLevelRaid1,
+		Devices: []string{"data1", "data2"},
+	})
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "invalid raid item at index 1")
+	assert.ErrorContains(t, err, "duplicate name (root)")
+}
+
+func TestStorageIsValidRaidFileSystemIdType(t *testing.T) {
+	value := newTestRaidRootStorage()
+	value.FileSystems[2].MountPoint.IdType = MountIdentifierTypeUuid
+
+	err := value.IsValid()
+	assert.NoError(t, err)
+
+	value.FileSystems[2].MountPoint.IdType = MountIdentifierTypePartUuid
+
+	err = value.IsValid()
+	assert.ErrorContains(t, err, "filesystem for RAID array (rootraid) may only specify a 'mountPoint.idType' of 'uuid'")
+}
+
+func TestStorageIsValidVolumeGroupOnRaid(t *testing.T) {
+	value := newTestRaidRootStorage()
+	value.FileSystems = value.FileSystems[:2]
+	value.VolumeGroups = []VolumeGroup{
+		{
+			Name:            "vg0",
+			PhysicalVolumes: []string{"rootraid"},
+			LogicalVolumes: []LogicalVolume{
+				{
+					Id:   "rootlv",
+					Name: "root",
+				},
+			},
+		},
+	}
+	value.FileSystems = append(value.FileSystems, FileSystem{
+		DeviceId: "rootlv",
+		Type:     "ext4",
+		MountPoint: &MountPoint{
+			Path: "/",
+		},
+	})
+
+	err := value.IsValid()
+	assert.NoError(t, err)
+}
+
+func newTestBtrfsRootStorage() Storage {
+	return Storage{
+		Disks: []Disk{{
+			PartitionTableType: "gpt",
+			Partitions: []Partition{
+				{
+					Id: "esp",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 8 * diskutils.MiB,
+					},
+					Type: PartitionTypeESP,
+				},
+				{
+					Id: "boot",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 100 * diskutils.MiB,
+					},
+				},
+				{
+					Id: "root",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 4 * diskutils.GiB,
+					},
+				},
+			},
+		}},
+		BootType: "efi",
+		FileSystems: []FileSystem{
+			{
+				DeviceId: "esp",
+				Type:     "vfat",
+				MountPoint: &MountPoint{
+					Path: "/boot/efi",
+				},
+			},
+			{
+				DeviceId: "boot",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/boot",
+				},
+			},
+			{
+				DeviceId: "root",
+				Type:     "btrfs",
+				Subvolumes: []BtrfsSubvolume{
+					{
+						Path: "@",
+						MountPoint: &MountPoint{
+							Path: "/",
+						},
+					},
+					{
+						Path: "@home",
+						MountPoint: &MountPoint{
+							Path: "/home",
+						},
+					},
+					{
+						Path: "@var",
+						MountPoint: &MountPoint{
+							Path: "/var",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestStorageIsValidBtrfsRoot(t *testing.T) {
+	value := newTestBtrfsRootStorage()
+
+	err := value.IsValid()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", value.FileSystems[2].PartitionId)
+}
+
+func TestStorageIsValidBtrfsRootWithoutBoot(t *testing.T) {
+	value := newTestBtrfsRootStorage()
+	value.FileSystems = append(value.FileSystems[:1], value.FileSystems[2:]...)
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "root filesystem on a btrfs subvolume requires a separate '/boot' filesystem")
+}
+
+func TestStorageIsValidBtrfsDuplicateMountPath(t *testing.T) {
+	value := newTestBtrfsRootStorage()
+	value.FileSystems[2].Subvolumes[2].MountPoint.Path = "/boot"
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "duplicate 'mountPoint.path' (/boot)")
+}
+
+func TestStorageIsValidBtrfsSubvolumeBoot(t *testing.T) {
+	value := newTestBtrfsRootStorage()
+	value.FileSystems = append(value.FileSystems[:1], value.FileSystems[2:]...)
+	value.FileSystems[1].Subvolumes[2].MountPoint.Path = "/boot"
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "btrfs subvolume (@var) may not be mounted at '/boot'")
+}
+
+func TestStorageIsValidBtrfsOnLogicalVolume(t *testing.T) {
+	value := newTestBtrfsRootStorage()
+	value.VolumeGroups = []VolumeGroup{
+		{
+			Name:            "vg0",
+			PhysicalVolumes: []string{"root"},
+			LogicalVolumes: []LogicalVolume{
+				{
+					Id:   "rootlv",
+					Name: "root",
+				},
+			},
+		},
+	}
+	value.FileSystems[2].DeviceId = "rootlv"
+
+	err := value.IsValid()
+	assert.ErrorContains(t, err, "btrfs filesystem (rootlv) must be on a partition")
+}
+
+func newTestABStorage() Storage {
+	return Storage{
+		Disks: []Disk{{
+			PartitionTableType: "gpt",
+			Partitions: []Partition{
+				{
+					Id: "esp",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 8 * diskutils.MiB,
+					},
+					Type: PartitionTypeESP,
+				},
+				{
+					Id: "boot",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 100 * diskutils.MiB,
+					},
+				},
+				{
+					Id:    "roota",
+					Label: "roota",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 2 * diskutils.GiB,
+					},
+				},
+				{
+					Id:    "rootb",
+					Label: "rootb",
+					Size: PartitionSize{
+						Type: PartitionSizeTypeExplicit,
+						Size: 2 * diskutils.GiB,
+					},
+				},
+			},
+		}},
+		BootType: "efi",
+		FileSystems: []FileSystem{
+			{
+				DeviceId: "esp",
+				Type:     "vfat",
+				MountPoint: &MountPoint{
+					Path: "/boot/efi",
+				},
+			},
+			{
+				DeviceId: "boot",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/boot",
+				},
+			},
+			{
+				DeviceId: "roota",
+				Type:     "ext4",
+				MountPoint: &MountPoint{
+					Path: "/",
+				},
+			},
+		},
+		ABUpdate: &ABUpdate{
+			SlotBDeviceId: "rootb",
+			SlotBContent:  ABSlotContentTypeClone,
+		},
+	}
+}
+
+func TestStorageIsValidABUpdate(t *testing.T) {
+	storage := newTestABStorage()
+
+	err := storage.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestStorageIsValidABUpdatePartLabel(t *testing.T) {
+	storage := newTestABStorage()
+	storage.FileSystems[2].MountPoint.IdType = MountIdentifierTypePartLabel
+
+	err := storage.IsValid()
+	assert.NoError(t, err)
+
+	storage.Disks[0].Partitions[3].Label = ""
+
+	err = storage.IsValid()
+	assert.ErrorContains(t, err, "idType is set to (part-label) but slot B partition (rootb) has no label set")
+}
+
+func TestStorageIsValidABUpdateUuid(t *testing.T) {
+	storage := newTestABStorage()
+	storage.FileSystems[2].MountPoint.IdType = MountIdentifierTypeUuid
+
+	err := storage.IsValid()
+	assert.ErrorContains(t, err, "A/B update requires the root filesystem's 'mountPoint.idType' to be 'part-uuid'")
+}
+
+func TestStorageIsValidABUpdateSlotBInUse(t *testing.T) {
+	storage := newTestABStorage()
+	storage.FileSystems = append(storage.FileSystems, FileSystem{
+		DeviceId: "rootb",
+		Type:     "ext4",
+	})
+
+	err := storage.IsValid()
+	assert.ErrorContains(t, err, "device (rootb) is used by multiple things")
+}
+
+func TestStorageIsValidABUpdateSlotBTooSmall(t *testing.T) {
+	storage := newTestABStorage()
+	storage.Disks[0].Partitions[3].Size.Size = 1 * diskutils.GiB
+
+	err := storage.IsValid()
+	assert.ErrorContains(t, err, "slot B partition (rootb) must be at least as large as slot A partition (roota)")
+
+	// An empty slot B is written by the update agent. So, its size isn't checked.
+	storage = newTestABStorage()
+	storage.Disks[0].Partitions[3].Size.Size = 1 * diskutils.GiB
+	storage.ABUpdate.SlotBContent = ABSlotContentTypeEmpty
+
+	err = storage.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestStorageIsValidABUpdateNoBoot(t *testing.T) {
+	storage := newTestABStorage()
+	storage.Disks[0].Partitions = append(storage.Disks[0].Partitions[:1], storage.Disks[0].Partitions[2:]...)
+	storage.FileSystems = append(storage.FileSystems[:1], storage.FileSystems[2:]...)
+
+	err := storage.IsValid()
+	assert.ErrorContains(t, err, "A/B update requires a separate '/boot' filesystem")
+}
+
+func TestStorageIsValidABUpdateBtrfsRoot(t *testing.T) {
+	storage := newTestBtrfsRootStorage()
+	storage.Disks[0].Partitions = append(storage.Disks[0].Partitions, Partition{
+		Id: "rootb",
+		Size: PartitionSize{
+			Type: PartitionSizeTypeExplicit,
+			Size: 4 * diskutils.GiB,
+		},
+	})
+	storage.ABUpdate = &ABUpdate{
+		SlotBDeviceId: "rootb",
+	}
+
+	err := storage.IsValid()
+	assert.ErrorContains(t, err, "A/B update requires a root filesystem (i.e. a 'mountPoint.path' of '/')")
+}
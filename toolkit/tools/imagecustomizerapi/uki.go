@@ -0,0 +1,26 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+)
+
+// Uki configures the creation of a Unified Kernel Image (UKI) in the EFI system partition.
+type Uki struct {
+	// Signing holds the Secure Boot keys that the UKI is signed with.
+	// If not specified, then the UKI is not signed.
+	Signing *UkiSigning `yaml:"signing"`
+}
+
+func (u *Uki) IsValid() error {
+	if u.Signing != nil {
+		err := u.Signing.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid signing:\n%w", err)
+		}
+	}
+
+	return nil
+}
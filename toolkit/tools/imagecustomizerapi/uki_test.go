@@ -0,0 +1,48 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUkiIsValid(t *testing.T) {
+	uki := Uki{}
+
+	err := uki.IsValid()
+	assert.NoError(t, err)
+
+	uki.Signing = &UkiSigning{
+		KeyFile:         "files/db.key",
+		CertificateFile: "files/db.crt",
+	}
+
+	err = uki.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestUkiIsValidMissingCertificateFile(t *testing.T) {
+	uki := Uki{
+		Signing: &UkiSigning{
+			KeyFile: "files/db.key",
+		},
+	}
+
+	err := uki.IsValid()
+	assert.ErrorContains(t, err, "invalid signing")
+	assert.ErrorContains(t, err, "'certificateFile' may not be empty")
+}
+
+func TestUkiIsValidMissingKeyFile(t *testing.T) {
+	uki := Uki{
+		Signing: &UkiSigning{
+			CertificateFile: "files/db.crt",
+		},
+	}
+
+	err := uki.IsValid()
+	assert.ErrorContains(t, err, "'keyFile' may not be empty")
+}
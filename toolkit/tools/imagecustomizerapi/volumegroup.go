@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// The characters that LVM allows in volume group and logical volume names.
+	lvmNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_+.-]*$`)
+)
+
+type VolumeGroup struct {
+	// The name of the volume group.
+	Name string `yaml:"name"`
+	// The IDs of the 'Partition' objects to use as the volume group's physical volumes.
+	PhysicalVolumes []string `yaml:"physicalVolumes"`
+	// The logical volumes to create in the volume group.
+	LogicalVolumes []LogicalVolume `yaml:"logicalVolumes"`
+}
+
+func (v *VolumeGroup) IsValid() error {
+	if !lvmNameRegex.MatchString(v.Name) {
+		return fmt.Errorf("invalid 'name' value (%s)", v.Name)
+	}
+
+	if len(v.PhysicalVolumes) <= 0 {
+		return fmt.Errorf("volume group (%s) must have at least one physical volume", v.Name)
+	}
+
+	logicalVolumeNames := make(map[string]bool)
+	for i, logicalVolume := range v.LogicalVolumes {
+		err := logicalVolume.IsValid()
+		if err != nil {
+			return fmt.Errorf("invalid logical volume at index %d:\n%w", i, err)
+		}
+
+		if _, existingName := logicalVolumeNames[logicalVolume.Name]; existingName {
+			return fmt.Errorf("invalid logical volume at index %d:\nduplicate name (%s)", i, logicalVolume.Name)
+		}
+
+		logicalVolumeNames[logicalVolume.Name] = true
+
+		// Only the last logical volume can fill the remaining space.
+		if logicalVolume.Size == nil && i != len(v.LogicalVolumes)-1 {
+			return fmt.Errorf("invalid logical volume at index %d:\nonly the last logical volume may omit 'size'", i)
+		}
+	}
+
+	return nil
+}
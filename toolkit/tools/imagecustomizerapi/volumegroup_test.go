@@ -0,0 +1,116 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerapi
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/diskutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/ptrutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeGroupIsValid(t *testing.T) {
+	volumeGroup := VolumeGroup{
+		Name:            "vg0",
+		PhysicalVolumes: []string{"pv"},
+		LogicalVolumes: []LogicalVolume{
+			{
+				Id:   "root",
+				Name: "root",
+				Size: ptrutils.PtrTo(DiskSize(4 * diskutils.GiB)),
+			},
+			{
+				Id:   "var",
+				Name: "var",
+			},
+		},
+	}
+
+	err := volumeGroup.IsValid()
+	assert.NoError(t, err)
+}
+
+func TestVolumeGroupIsValidInvalidName(t *testing.T) {
+	volumeGroup := VolumeGroup{
+		Name:            "-vg0",
+		PhysicalVolumes: []string{"pv"},
+	}
+
+	err := volumeGroup.IsValid()
+	assert.ErrorContains(t, err, "invalid 'name' value (-vg0)")
+}
+
+func TestVolumeGroupIsValidNoPhysicalVolumes(t *testing.T) {
+	volumeGroup := VolumeGroup{
+		Name: "vg0",
+	}
+
+	err := volumeGroup.IsValid()
+	assert.ErrorContains(t, err, "volume group (vg0) must have at least one physical volume")
+}
+
+func TestVolumeGroupIsValidDuplicateLogicalVolumeName(t *testing.T) {
+	volumeGroup := VolumeGroup{
+		Name:            "vg0",
+		PhysicalVolumes: []string{"pv"},
+		LogicalVolumes: []LogicalVolume{
+			{
+				Id:   "root",
+				Name: "root",
+				Size: ptrutils.PtrTo(DiskSize(4 * diskutils.GiB)),
+			},
+			{
+				Id:   "root2",
+				Name: "root",
+			},
+		},
+	}
+
+	err := volumeGroup.IsValid()
+	assert.ErrorContains(t, err, "invalid logical volume at index 1")
+	assert.ErrorContains(t, err, "duplicate name (root)")
+}
+
+func TestVolumeGroupIsValidMissingSizeNotLast(t *testing.T) {
+	volumeGroup := VolumeGroup{
+		Name:            "vg0",
+		PhysicalVolumes: []string{"pv"},
+		LogicalVolumes: []LogicalVolume{
+			{
+				Id:   "root",
+				Name: "root",
+			},
+			{
+				Id:   "var",
+				Name: "var",
+				Size: ptrutils.PtrTo(DiskSize(1 * diskutils.GiB)),
+			},
+		},
+	}
+
+	err := volumeGroup.IsValid()
+	assert.ErrorContains(t, err, "invalid logical volume at index 0")
+	assert.ErrorContains(t, err, "only the last logical volume may omit 'size'")
+}
+
+func TestLogicalVolumeIsValidMissingId(t *testing.T) {
+	logicalVolume := LogicalVolume{
+		Name: "root",
+	}
+
+	err := logicalVolume.IsValid()
+	assert.ErrorContains(t, err, "'id' may not be empty")
+}
+
+func TestLogicalVolumeIsValidZeroSize(t *testing.T) {
+	logicalVolume := LogicalVolume{
+		Id:   "root",
+		Name: "root",
+		Size: ptrutils.PtrTo(DiskSize(0)),
+	}
+
+	err := logicalVolume.IsValid()
+	assert.ErrorContains(t, err, "'size' (0) must be a positive non-zero number")
+}
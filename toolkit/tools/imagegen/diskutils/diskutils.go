@@ -799,7 +799,7 @@ func FormatSinglePartition(partDevPath string, partition configuration.Partition
 	// This is due to a possible race condition in Linux/parted where the partition may not actually be ready after being newly created.
 	// To handle such cases, we can retry the command.
 	switch fsType {
-	case "fat32", "fat16", "vfat", "ext2", "ext3", "ext4", "xfs":
+	case "fat32", "fat16", "vfat", "ext2", "ext3", "ext4", "xfs", "btrfs":
 		mkfsOptions := DefaultMkfsOptions[fsType]
 
 		if fsType == "fat32" || fsType == "fat16" {
@@ -916,7 +916,19 @@ func GetDiskPartitions(diskDevPath string) ([]PartitionInfo, error) {
 		}
 	}
 
-	return output.Devices, err
+	// A device with multiple parents (e.g. a RAID array) is listed once for each of its parents.
+	partitions := []PartitionInfo(nil)
+	seenPaths := make(map[string]bool)
+	for _, partition := range output.Devices {
+		if seenPaths[partition.Path] {
+			continue
+		}
+
+		seenPaths[partition.Path] = true
+		partitions = append(partitions, partition)
+	}
+
+	return partitions, err
 }
 
 func createExtendedPartition(diskDevPath string, partitionTableType configuration.PartitionTableType,
@@ -8,6 +8,7 @@ package diskutils
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
@@ -116,3 +117,13 @@ func restartLVMetadataService() (err error) {
 
 	return
 }
+
+// IsLogicalVolumeDevice returns true if the block device is an LVM logical volume.
+func IsLogicalVolumeDevice(devicePath string) bool {
+	stdout, _, err := shell.Execute("lsblk", "--nodeps", "--noheadings", "--output", "TYPE", devicePath)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(stdout) == "lvm"
+}
@@ -1150,7 +1150,8 @@ func addEntryToFstab(fullFstabPath, mountPoint, devicePath, fsType, mountArgs st
 
 	// Get the block device
 	var device string
-	if diskutils.IsEncryptedDevice(devicePath) || doPseudoFsMount {
+	if doPseudoFsMount || diskutils.IsEncryptedDevice(devicePath) || diskutils.IsLogicalVolumeDevice(devicePath) {
+		// Encrypted devices and logical volumes are referenced by their device path.
 		device = devicePath
 	} else {
 		device, err = FormatMountIdentifier(identifierType, devicePath)
@@ -1279,6 +1280,9 @@ func ConfigureDiskBootloaderWithRootMountIdType(bootType string, encryptionEnabl
 	if encryptionEnable {
 		// Encrypted devices don't currently support identifiers
 		rootDevice = mountPointMap[rootMountPoint]
+	} else if diskutils.IsLogicalVolumeDevice(mountPointMap[rootMountPoint]) {
+		// Logical volumes don't have partition identifiers
+		rootDevice = mountPointMap[rootMountPoint]
 	} else {
 		var partIdentifier string
 		partIdentifier, err = FormatMountIdentifier(rootMountIdentifier, mountPointMap[rootMountPoint])
@@ -0,0 +1,151 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package safechroot
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+)
+
+// procMountsPath is the file that lists the mounts of the current process's mount namespace.
+// Tests may replace it with a fake mounts file.
+var procMountsPath = "/proc/mounts"
+
+// procMountEntry is a single line of /proc/mounts.
+type procMountEntry struct {
+	source  string
+	target  string
+	fstype  string
+	options string
+}
+
+// ActiveMounts returns the mounts that are currently active under the chroot's root directory. Target paths are
+// relative to the chroot's root directory.
+//
+// The Chroot's own list of mounts is reconciled against /proc/mounts:
+//   - Mounts the Chroot set up are only returned if they are still mounted.
+//   - Mounts under the root directory that the Chroot didn't set up (e.g. leaked by a customization step) are also
+//     returned. Since /proc/mounts doesn't report the raw mount flags, the flags of these mounts are 0 and their
+//     options are reported in the mount's data.
+func (c *Chroot) ActiveMounts() ([]MountPoint, error) {
+	entries, err := readProcMounts(procMountsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rootDir := filepath.Clean(c.rootDir)
+
+	mountedTargets := make(map[string]procMountEntry)
+	for _, entry := range entries {
+		// For stacked mounts, the last entry is the one that is visible.
+		mountedTargets[entry.target] = entry
+	}
+
+	activeMounts := []MountPoint(nil)
+	trackedTargets := make(map[string]bool)
+	for _, mountPoint := range c.mountPoints {
+		fullPath := filepath.Join(rootDir, mountPoint.target)
+		trackedTargets[fullPath] = true
+
+		if !mountPoint.isMounted {
+			continue
+		}
+
+		if _, found := mountedTargets[fullPath]; !found {
+			logger.Log.Warnf("Chroot mount (%s) is no longer mounted", fullPath)
+			continue
+		}
+
+		activeMounts = append(activeMounts, *mountPoint)
+	}
+
+	for _, entry := range entries {
+		if trackedTargets[entry.target] {
+			continue
+		}
+
+		relativeTarget, found := strings.CutPrefix(entry.target, rootDir+"/")
+		if !found {
+			continue
+		}
+
+		activeMounts = append(activeMounts, MountPoint{
+			source:    entry.source,
+			target:    "/" + relativeTarget,
+			fstype:    entry.fstype,
+			data:      entry.options,
+			isMounted: true,
+		})
+	}
+
+	return activeMounts, nil
+}
+
+// readProcMounts parses a file in the /proc/mounts format.
+func readProcMounts(path string) ([]procMountEntry, error) {
+	mountsFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mounts file (%s):\n%w", path, err)
+	}
+	defer mountsFile.Close()
+
+	entries := []procMountEntry(nil)
+
+	scanner := bufio.NewScanner(mountsFile)
+	for scanner.Scan() {
+		// Each line has the format: <source> <target> <fstype> <options> <dump> <pass>
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid line in mounts file (%s): (%s)", path, scanner.Text())
+		}
+
+		entries = append(entries, procMountEntry{
+			source:  unescapeProcMountsField(fields[0]),
+			target:  unescapeProcMountsField(fields[1]),
+			fstype:  fields[2],
+			options: fields[3],
+		})
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mounts file (%s):\n%w", path, err)
+	}
+
+	return entries, nil
+}
+
+// unescapeProcMountsField reverses the octal escaping the kernel applies to whitespace and backslashes in
+// /proc/mounts (e.g. "\040" for a space).
+func unescapeProcMountsField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			value, err := strconv.ParseUint(field[i+1:i+4], 8, 8)
+			if err == nil {
+				builder.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+
+		builder.WriteByte(field[i])
+	}
+
+	return builder.String()
+}
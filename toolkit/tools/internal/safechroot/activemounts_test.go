@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package safechroot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setTestProcMounts replaces /proc/mounts with a fake mounts file containing 'content'.
+func setTestProcMounts(t *testing.T, content string) {
+	mountsPath := filepath.Join(t.TempDir(), "mounts")
+	err := os.WriteFile(mountsPath, []byte(content), 0o644)
+	assert.NoError(t, err)
+
+	originalPath := procMountsPath
+	procMountsPath = mountsPath
+	t.Cleanup(func() { procMountsPath = originalPath })
+}
+
+func TestActiveMountsReconcilesTrackedMounts(t *testing.T) {
+	rootDir := t.TempDir()
+	chroot := NewChroot(rootDir, isExistingDir)
+
+	procMount := NewMountPoint("proc", "/proc", "proc", 0, "")
+	procMount.isMounted = true
+	sysMount := NewMountPoint("sysfs", "/sys", "sysfs", 0, "")
+	sysMount.isMounted = true
+	devMount := NewMountPoint("/dev", "/dev", "", BindMountPointFlags, "")
+	chroot.mountPoints = []*MountPoint{procMount, sysMount, devMount}
+
+	setTestProcMounts(t, fmt.Sprintf(
+		"/dev/sda2 / ext4 rw,relatime 0 0\n"+
+			"proc %[1]s/proc proc rw,nosuid,nodev,noexec,relatime 0 0\n"+
+			"tmpfs %[1]s/tmp/build\\040dir tmpfs rw,relatime 0 0\n"+
+			"tmpfs %[1]s2/tmp tmpfs rw,relatime 0 0\n",
+		rootDir))
+
+	mounts, err := chroot.ActiveMounts()
+	assert.NoError(t, err)
+	if assert.Len(t, mounts, 2) {
+		// /sys was set up by the chroot but is no longer mounted.
+		// /dev was never mounted.
+		assert.Equal(t, "proc", mounts[0].GetSource())
+		assert.Equal(t, "/proc", mounts[0].GetTarget())
+		assert.Equal(t, "proc", mounts[0].GetFSType())
+
+		// Untracked mount (e.g. leaked by a script).
+		assert.Equal(t, "tmpfs", mounts[1].GetSource())
+		assert.Equal(t, "/tmp/build dir", mounts[1].GetTarget())
+		assert.Equal(t, "tmpfs", mounts[1].GetFSType())
+		assert.Equal(t, uintptr(0), mounts[1].GetFlags())
+		assert.Equal(t, "rw,relatime", mounts[1].GetData())
+	}
+}
+
+func TestActiveMountsKeepsTrackedFlags(t *testing.T) {
+	rootDir := t.TempDir()
+	chroot := NewChroot(rootDir, isExistingDir)
+
+	devMount := NewMountPoint("/dev", "/dev", "", BindMountPointFlags, "")
+	devMount.isMounted = true
+	chroot.mountPoints = []*MountPoint{devMount}
+
+	setTestProcMounts(t, fmt.Sprintf("devtmpfs %s/dev devtmpfs rw,nosuid 0 0\n", rootDir))
+
+	mounts, err := chroot.ActiveMounts()
+	assert.NoError(t, err)
+	if assert.Len(t, mounts, 1) {
+		assert.Equal(t, "/dev", mounts[0].GetSource())
+		assert.Equal(t, uintptr(BindMountPointFlags), mounts[0].GetFlags())
+	}
+}
+
+func TestActiveMountsNoMounts(t *testing.T) {
+	chroot := NewChroot(t.TempDir(), isExistingDir)
+	setTestProcMounts(t, "/dev/sda2 / ext4 rw,relatime 0 0\n")
+
+	mounts, err := chroot.ActiveMounts()
+	assert.NoError(t, err)
+	assert.Empty(t, mounts)
+}
+
+func TestActiveMountsInvalidMountsFile(t *testing.T) {
+	chroot := NewChroot(t.TempDir(), isExistingDir)
+	setTestProcMounts(t, "proc /proc\n")
+
+	_, err := chroot.ActiveMounts()
+	assert.ErrorContains(t, err, "invalid line in mounts file")
+}
+
+func TestUnescapeProcMountsField(t *testing.T) {
+	assert.Equal(t, "/mnt/a b", unescapeProcMountsField("/mnt/a\\040b"))
+	assert.Equal(t, "/mnt/a\tb\\c", unescapeProcMountsField("/mnt/a\\011b\\134c"))
+	assert.Equal(t, "/mnt/a\\0", unescapeProcMountsField("/mnt/a\\0"))
+	assert.Equal(t, "/mnt/plain", unescapeProcMountsField("/mnt/plain"))
+}
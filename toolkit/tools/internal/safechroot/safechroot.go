@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -71,6 +72,8 @@ type MountPoint struct {
 type Chroot struct {
 	rootDir     string
 	mountPoints []*MountPoint
+	// The environment variables for commands run by Run. nil means defaultChrootEnv.
+	env []string
 
 	isExistingDir        bool
 	includeDefaultMounts bool
@@ -94,14 +97,24 @@ var (
 	activeChroots      []*Chroot
 )
 
+// defaultChrootEnv is a minimal environment for commands run inside a chroot. Only TERM is taken from the host, since
+// it describes the terminal the output is written to. Everything else is fixed so that the behavior of the commands
+// (e.g. package scriptlets) doesn't depend on the host's environment.
 var defaultChrootEnv = []string{
 	"USER=root",
 	"HOME=/root",
-	fmt.Sprintf("SHELL=%s", os.Getenv("SHELL")),
+	fmt.Sprintf("SHELL=%s", shell.ShellProgram),
 	fmt.Sprintf("TERM=%s", os.Getenv("TERM")),
 	"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
 }
 
+const (
+	// chrootTempDir is the directory, within the chroot, that RunScript and TempDir create files in.
+	chrootTempDir = "/tmp"
+	// defaultScriptShebang is the interpreter used by RunScript when the script doesn't specify one.
+	defaultScriptShebang = "#!/bin/sh"
+)
+
 const (
 	unmountTypeLazy   = true
 	unmountTypeNormal = !unmountTypeLazy
@@ -175,6 +188,16 @@ func (m *MountPoint) GetTarget() string {
 	return m.target
 }
 
+// GetFlags gets the mount flags of the mount.
+func (m *MountPoint) GetFlags() uintptr {
+	return m.flags
+}
+
+// GetData gets the file-system specific data (i.e. options) of the mount.
+func (m *MountPoint) GetData() string {
+	return m.data
+}
+
 // NewChroot creates a new Chroot struct
 func NewChroot(rootDir string, isExistingDir bool) *Chroot {
 	// get chroot folder
@@ -428,7 +451,7 @@ func (c *Chroot) Run(toRun func() error) (err error) {
 
 	// Alter the environment variables while inside the chroot, upon exit restore them.
 	originalEnv := shell.CurrentEnvironment()
-	shell.SetEnvironment(defaultChrootEnv)
+	shell.SetEnvironment(c.Env())
 	defer shell.SetEnvironment(originalEnv)
 
 	err = c.UnsafeRun(toRun)
@@ -473,6 +496,195 @@ func (c *Chroot) UnsafeRun(toRun func() error) (err error) {
 	return
 }
 
+// RunScript runs a multi-line shell script inside the chroot. This is safer than building a command line out of
+// concatenated commands, since the script doesn't need to be quoted.
+//
+// The script is written to a temporary file in the chroot's /tmp directory and removed afterwards. If the script
+// doesn't start with a shebang line, it is run with /bin/sh. If the script exits with a non-zero code, the returned
+// error includes the script's output.
+func (c *Chroot) RunScript(script string) (err error) {
+	if !strings.HasPrefix(script, "#!") {
+		script = defaultScriptShebang + "\n" + script
+	}
+
+	tempDirFullPath, err := c.ensureTempDir()
+	if err != nil {
+		return err
+	}
+
+	scriptFile, err := os.CreateTemp(tempDirFullPath, "safechroot-script-*.sh")
+	if err != nil {
+		return fmt.Errorf("failed to create script file:\n%w", err)
+	}
+	defer os.Remove(scriptFile.Name())
+
+	_, err = scriptFile.WriteString(script)
+	if err != nil {
+		scriptFile.Close()
+		return fmt.Errorf("failed to write script file (%s):\n%w", scriptFile.Name(), err)
+	}
+
+	err = scriptFile.Chmod(0o700)
+	if err != nil {
+		scriptFile.Close()
+		return fmt.Errorf("failed to set script file (%s) permissions:\n%w", scriptFile.Name(), err)
+	}
+
+	err = scriptFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close script file (%s):\n%w", scriptFile.Name(), err)
+	}
+
+	scriptPath := filepath.Join(chrootTempDir, filepath.Base(scriptFile.Name()))
+
+	var stdout, stderr string
+	err = c.Run(func() error {
+		var runErr error
+		stdout, stderr, runErr = shell.Execute(scriptPath)
+		return runErr
+	})
+	if err != nil {
+		return fmt.Errorf("script failed:\nstdout:\n%s\nstderr:\n%s\n%w", stdout, stderr, err)
+	}
+
+	return nil
+}
+
+// TempDir creates a new temporary directory inside the chroot's /tmp directory, using 'pattern' in the same way as
+// os.MkdirTemp. It returns the path of the directory relative to the chroot (e.g. "/tmp/scratch-1234") and a function
+// that removes the directory and its contents.
+func (c *Chroot) TempDir(pattern string) (relPath string, cleanup func() error, err error) {
+	tempDirFullPath, err := c.ensureTempDir()
+	if err != nil {
+		return "", nil, err
+	}
+
+	fullPath, err := os.MkdirTemp(tempDirFullPath, pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory in chroot (%s):\n%w", c.rootDir, err)
+	}
+
+	relPath = filepath.Join(chrootTempDir, filepath.Base(fullPath))
+	cleanup = func() error {
+		err := os.RemoveAll(fullPath)
+		if err != nil {
+			return fmt.Errorf("failed to remove temporary directory (%s):\n%w", fullPath, err)
+		}
+		return nil
+	}
+
+	return relPath, cleanup, nil
+}
+
+// ensureTempDir creates the chroot's /tmp directory, if needed, and returns its full path.
+func (c *Chroot) ensureTempDir() (string, error) {
+	tempDirFullPath := filepath.Join(c.rootDir, chrootTempDir)
+	if filepath.Clean(c.rootDir) == "/" {
+		// Files must never be left behind in the host's root directory.
+		return "", fmt.Errorf("chroot root directory must not be the host's root directory")
+	}
+
+	err := os.MkdirAll(tempDirFullPath, os.ModePerm)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory (%s):\n%w", tempDirFullPath, err)
+	}
+
+	// Don't follow a symlink, since it could point outside of the chroot.
+	tempDirInfo, err := os.Lstat(tempDirFullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat temporary directory (%s):\n%w", tempDirFullPath, err)
+	}
+
+	if !tempDirInfo.IsDir() {
+		return "", fmt.Errorf("temporary directory (%s) is not a directory", tempDirFullPath)
+	}
+
+	return tempDirFullPath, nil
+}
+
+// WithReadonlyBind bind mounts the host directory 'hostPath' read-only at 'chrootRelTarget' within the chroot, runs
+// 'fn', and then unmounts it. The target directory is created, and later removed, if it doesn't exist. 'fn' runs on
+// the host; use Run within 'fn' to run commands inside the chroot.
+//
+// The read-only flag is checked after the mount is made. So, 'fn' is never called with a writable bind.
+func (c *Chroot) WithReadonlyBind(hostPath, chrootRelTarget string, fn func() error) (err error) {
+	if filepath.Clean(c.rootDir) == "/" {
+		return fmt.Errorf("chroot root directory must not be the host's root directory")
+	}
+
+	target := filepath.Join(c.rootDir, chrootRelTarget)
+	if !strings.HasPrefix(target, filepath.Clean(c.rootDir)+string(filepath.Separator)) {
+		return fmt.Errorf("bind target (%s) is outside of the chroot (%s)", chrootRelTarget, c.rootDir)
+	}
+
+	// Only remove the target directory afterwards if it is created here.
+	targetExists, err := file.PathExists(target)
+	if err != nil {
+		return fmt.Errorf("failed to check if bind target (%s) exists:\n%w", target, err)
+	}
+
+	if !targetExists {
+		err = os.MkdirAll(target, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create bind target (%s):\n%w", target, err)
+		}
+
+		defer func() {
+			removeErr := os.Remove(target)
+			if removeErr != nil && err == nil {
+				err = fmt.Errorf("failed to remove bind target (%s):\n%w", target, removeErr)
+			}
+		}()
+	}
+
+	err = unix.Mount(hostPath, target, "", BindMountPointFlags, "")
+	if err != nil {
+		return fmt.Errorf("failed to bind mount (%s) into chroot:\n%w", hostPath, err)
+	}
+
+	defer func() {
+		unmountErr := unix.Unmount(target, 0)
+		if unmountErr != nil && err == nil {
+			err = fmt.Errorf("failed to unmount bind mount (%s):\n%w", target, unmountErr)
+		}
+	}()
+
+	// The kernel ignores MS_RDONLY when a bind mount is created. So, the bind mount must be remounted read-only.
+	err = unix.Mount("", target, "", BindMountPointFlags|unix.MS_REMOUNT|unix.MS_RDONLY, "")
+	if err != nil {
+		return fmt.Errorf("failed to make bind mount (%s) read-only:\n%w", target, err)
+	}
+
+	var statfs unix.Statfs_t
+	err = unix.Statfs(target, &statfs)
+	if err != nil {
+		return fmt.Errorf("failed to stat bind mount (%s):\n%w", target, err)
+	}
+
+	if statfs.Flags&unix.ST_RDONLY == 0 {
+		return fmt.Errorf("bind mount (%s) is not read-only", target)
+	}
+
+	return fn()
+}
+
+// Env returns a copy of the environment variables used for commands launched inside the chroot by Run.
+func (c *Chroot) Env() []string {
+	if c.env == nil {
+		return append([]string(nil), defaultChrootEnv...)
+	}
+
+	return slices.Clone(c.env)
+}
+
+// SetEnv sets the environment variables (in "KEY=value" form) used for all commands launched inside the chroot by Run.
+// The host's environment is not inherited. Passing nil restores the default minimal environment. Passing an empty
+// (non-nil) slice runs commands with no environment variables at all.
+func (c *Chroot) SetEnv(env []string) {
+	// slices.Clone keeps the difference between nil and empty.
+	c.env = slices.Clone(env)
+}
+
 // RootDir returns the Chroot's root directory.
 func (c *Chroot) RootDir() string {
 	return c.rootDir
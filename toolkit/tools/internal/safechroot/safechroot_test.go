@@ -10,9 +10,12 @@ import (
 	"testing"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/buildpipeline"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -276,3 +279,235 @@ func TestInitializeShouldCreateExtraDirectories(t *testing.T) {
 	_, err = os.Stat(fullPath)
 	assert.True(t, !os.IsNotExist(err))
 }
+
+func TestRunShouldUseChrootEnv(t *testing.T) {
+	extraMountPoints := []*MountPoint{}
+	extraDirectories := []string{}
+
+	dir := filepath.Join(t.TempDir(), "TestRunShouldUseChrootEnv")
+	chroot := NewChroot(dir, isExistingDir)
+
+	err := chroot.Initialize(emptyPath, extraDirectories, extraMountPoints, false)
+	assert.NoError(t, err)
+	defer chroot.Close(defaultLeaveOnDisk)
+
+	t.Setenv("TEST_HOST_ONLY_VAR", "leaked")
+
+	chroot.SetEnv([]string{"PATH=/usr/bin:/bin", "TEST_CHROOT_VAR=value"})
+	assert.Equal(t, []string{"PATH=/usr/bin:/bin", "TEST_CHROOT_VAR=value"}, chroot.Env())
+
+	originalEnv := shell.CurrentEnvironment()
+
+	// The environment is what all commands launched by the shell package receive.
+	var chrootEnv []string
+	err = chroot.Run(func() error {
+		chrootEnv = shell.CurrentEnvironment()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, chrootEnv, "TEST_CHROOT_VAR=value")
+	assert.NotContains(t, chrootEnv, "TEST_HOST_ONLY_VAR=leaked")
+
+	// The original environment is restored on exit.
+	assert.Equal(t, originalEnv, shell.CurrentEnvironment())
+
+	// Reset to the default environment.
+	chroot.SetEnv(nil)
+	assert.Equal(t, defaultChrootEnv, chroot.Env())
+
+	// An empty environment isn't replaced by the default one.
+	chroot.SetEnv([]string{})
+	assert.NotNil(t, chroot.Env())
+	assert.Empty(t, chroot.Env())
+
+	err = chroot.Run(func() error {
+		chrootEnv = shell.CurrentEnvironment()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, chrootEnv)
+	assert.Empty(t, chrootEnv)
+}
+
+// initializeShellChroot creates a chroot that has a shell, by bind mounting the host's /usr directory.
+func initializeShellChroot(t *testing.T) *Chroot {
+	binTarget, err := os.Readlink("/bin")
+	if err != nil || binTarget != "usr/bin" {
+		t.Skip("test requires a usr-merged build host")
+	}
+
+	extraMountPoints := []*MountPoint{
+		NewMountPoint("/usr", "/usr", "", BindMountPointFlags, emptyPath),
+	}
+
+	dir := filepath.Join(t.TempDir(), t.Name())
+	chroot := NewChroot(dir, isExistingDir)
+
+	err = chroot.Initialize(emptyPath, []string{}, extraMountPoints, true /*includeDefaultMounts*/)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { chroot.Close(defaultLeaveOnDisk) })
+
+	for _, dir := range []string{"bin", "lib", "lib64", "sbin"} {
+		err = os.Symlink("usr/"+dir, filepath.Join(chroot.RootDir(), dir))
+		assert.NoError(t, err)
+	}
+
+	return chroot
+}
+
+func TestRunScriptShouldRunInChroot(t *testing.T) {
+	chroot := initializeShellChroot(t)
+
+	err := chroot.RunScript("set -e\n" +
+		"echo 'hello world' > /result.txt\n" +
+		"echo \"$TEST_CHROOT_VAR\" >> /result.txt\n")
+	assert.NoError(t, err)
+
+	result, err := os.ReadFile(filepath.Join(chroot.RootDir(), "result.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world\n\n", string(result))
+
+	// The script file is removed.
+	entries, err := os.ReadDir(filepath.Join(chroot.RootDir(), chrootTempDir))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRunScriptShouldReturnOutputOnFailure(t *testing.T) {
+	chroot := initializeShellChroot(t)
+
+	err := chroot.RunScript("#!/bin/bash\n" +
+		"echo 'about to fail'\n" +
+		"echo 'failure reason' >&2\n" +
+		"exit 3\n")
+	assert.ErrorContains(t, err, "script failed")
+	assert.ErrorContains(t, err, "about to fail")
+	assert.ErrorContains(t, err, "failure reason")
+	assert.ErrorContains(t, err, "exit status 3")
+}
+
+func TestRunScriptShouldRejectSymlinkTempDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "TestRunScriptShouldRejectSymlinkTempDir")
+	chroot := NewChroot(dir, isExistingDir)
+
+	err := chroot.Initialize(emptyPath, []string{}, []*MountPoint{}, false)
+	assert.NoError(t, err)
+	defer chroot.Close(defaultLeaveOnDisk)
+
+	err = os.Symlink(t.TempDir(), filepath.Join(chroot.RootDir(), "tmp"))
+	assert.NoError(t, err)
+
+	err = chroot.RunScript("true\n")
+	assert.ErrorContains(t, err, "is not a directory")
+}
+
+func TestTempDirShouldCreateDirInChroot(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "TestTempDirShouldCreateDirInChroot")
+	chroot := NewChroot(dir, isExistingDir)
+
+	err := chroot.Initialize(emptyPath, []string{}, []*MountPoint{}, false)
+	assert.NoError(t, err)
+	defer chroot.Close(defaultLeaveOnDisk)
+
+	relPath, cleanup, err := chroot.TempDir("scratch-*")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^/tmp/scratch-\d+$`, relPath)
+
+	fullPath := filepath.Join(chroot.RootDir(), relPath)
+	exists, err := file.DirExists(fullPath)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	err = os.WriteFile(filepath.Join(fullPath, "file.txt"), []byte("scratch"), 0o644)
+	assert.NoError(t, err)
+
+	err = cleanup()
+	assert.NoError(t, err)
+
+	exists, err = file.PathExists(fullPath)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestTempDirShouldRejectSymlinkTempDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "TestTempDirShouldRejectSymlinkTempDir")
+	chroot := NewChroot(dir, isExistingDir)
+
+	err := chroot.Initialize(emptyPath, []string{}, []*MountPoint{}, false)
+	assert.NoError(t, err)
+	defer chroot.Close(defaultLeaveOnDisk)
+
+	hostDir := t.TempDir()
+	err = os.Symlink(hostDir, filepath.Join(chroot.RootDir(), "tmp"))
+	assert.NoError(t, err)
+
+	_, _, err = chroot.TempDir("scratch-*")
+	assert.ErrorContains(t, err, "is not a directory")
+
+	// Nothing was created on the host.
+	entries, err := os.ReadDir(hostDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestTempDirShouldRejectHostRoot(t *testing.T) {
+	chroot := &Chroot{rootDir: "/"}
+
+	_, _, err := chroot.TempDir("scratch-*")
+	assert.ErrorContains(t, err, "must not be the host's root directory")
+}
+
+func TestWithReadonlyBindShouldRejectWrites(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "TestWithReadonlyBindShouldRejectWrites")
+	chroot := NewChroot(dir, isExistingDir)
+
+	err := chroot.Initialize(emptyPath, []string{}, []*MountPoint{}, false)
+	assert.NoError(t, err)
+	defer chroot.Close(defaultLeaveOnDisk)
+
+	hostDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(hostDir, "cached.txt"), []byte("cached"), 0o644)
+	assert.NoError(t, err)
+
+	targetPath := filepath.Join(chroot.RootDir(), "mnt/cache")
+
+	fnCalled := false
+	err = chroot.WithReadonlyBind(hostDir, "/mnt/cache", func() error {
+		fnCalled = true
+
+		content, err := os.ReadFile(filepath.Join(targetPath, "cached.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "cached", string(content))
+
+		err = os.WriteFile(filepath.Join(targetPath, "new.txt"), []byte("new"), 0o644)
+		assert.ErrorIs(t, err, unix.EROFS)
+
+		err = os.Remove(filepath.Join(targetPath, "cached.txt"))
+		assert.ErrorIs(t, err, unix.EROFS)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, fnCalled)
+
+	// The bind was unmounted and its target directory removed.
+	exists, err := file.PathExists(targetPath)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// The host directory is unchanged.
+	entries, err := os.ReadDir(hostDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWithReadonlyBindShouldRejectEscapingTarget(t *testing.T) {
+	chroot := NewChroot(t.TempDir(), true /*isExistingDir*/)
+
+	err := chroot.WithReadonlyBind(t.TempDir(), "../escape", func() error {
+		assert.Fail(t, "fn must not be called")
+		return nil
+	})
+	assert.ErrorContains(t, err, "is outside of the chroot")
+}
@@ -160,7 +160,9 @@ func MustExecuteLive(command string, args ...string) {
 func trackAndStartProcess(cmd *exec.Cmd) (err error) {
 	logger.Log.Debugf("Executing: %v", cmd.Args)
 
-	if cmd.Env == nil && len(currentEnv) > 0 {
+	// An empty, but non-nil, environment means that the process gets no environment variables. Only a nil
+	// environment inherits the tool's own environment.
+	if cmd.Env == nil && currentEnv != nil {
 		cmd.Env = currentEnv
 	}
 
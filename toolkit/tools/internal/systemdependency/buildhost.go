@@ -0,0 +1,224 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/sliceutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+const (
+	osReleasePath = "/etc/os-release"
+)
+
+// procKernelOsReleasePath is the kernel's own report of its release string. It is a variable so that tests can
+// replace it.
+var procKernelOsReleasePath = "/proc/sys/kernel/osrelease"
+
+// buildHostRootfs is the root directory of the build host. It is a variable so that tests can replace it.
+var buildHostRootfs = "/"
+
+// The build host's kernel version, as returned by GetBuildHostKernelVersion. It is only read once, by
+// getCachedBuildHostKernelVersion, since the build host's kernel can't change while the tools are running.
+var (
+	buildHostKernelVersionOnce  sync.Once
+	buildHostKernelVersion      *versioncompare.TolerantVersion
+	buildHostKernelVersionError error
+)
+
+// init will always be called if this package is loaded
+func init() {
+	// The versioncompare package can't depend on this one. So, TolerantVersion.CompareToBuildHost gets the build host's
+	// kernel version from here.
+	versioncompare.SetBuildHostVersionGetter(getCachedBuildHostKernelVersion)
+}
+
+// getBuildHostKernelRelease returns the raw output of 'uname -r'. It is a variable so that tests can replace it.
+var getBuildHostKernelRelease = func() (string, error) {
+	stdout, stderr, err := runner.Execute("uname", "-r")
+	if err != nil {
+		return "", fmt.Errorf("failed to get build host kernel version:\n%v\n%w", stderr, err)
+	}
+
+	return stdout, nil
+}
+
+// readBuildHostKernelRelease returns the build host's kernel release string, with any noise around it removed.
+func readBuildHostKernelRelease() (string, error) {
+	release, err := getBuildHostKernelRelease()
+	if err != nil {
+		return "", err
+	}
+
+	return sanitizeKernelRelease(release), nil
+}
+
+// sanitizeKernelRelease removes whitespace and control characters from a kernel release string read from a command or
+// file. Some 'uname' shims, found on CI runners, append a carriage return or a null byte to their output, which would
+// otherwise fail to parse. Kernel release strings never contain these characters. So, they are removed wherever they
+// appear, not just at the ends.
+func sanitizeKernelRelease(release string) string {
+	release = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, release)
+
+	return strings.TrimSpace(release)
+}
+
+// Distro identifies a Linux distribution, as reported by its os-release file.
+type Distro struct {
+	// The ID field of os-release. For example: "azurelinux", "mariner", "ubuntu".
+	ID string
+	// The VERSION_ID field of os-release. For example: "3.0". May be empty for rolling releases.
+	VersionID string
+}
+
+// GetBuildHostKernelVersion returns the version of the kernel running on the build host, as reported by 'uname -r'.
+//
+// When running inside a container, prefer GetContainerHostKernelVersion, since the container image may replace
+// 'uname' with a shim that reports a different version.
+func GetBuildHostKernelVersion() (*versioncompare.TolerantVersion, error) {
+	release, err := readBuildHostKernelRelease()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKernelVersion(release)
+}
+
+// getCachedBuildHostKernelVersion returns the result of GetBuildHostKernelVersion. Only the first call runs 'uname'.
+// Later calls return the same version, or the same error.
+func getCachedBuildHostKernelVersion() (*versioncompare.TolerantVersion, error) {
+	buildHostKernelVersionOnce.Do(func() {
+		buildHostKernelVersion, buildHostKernelVersionError = GetBuildHostKernelVersion()
+	})
+
+	return buildHostKernelVersion, buildHostKernelVersionError
+}
+
+// resetBuildHostKernelVersionCache forgets the cached build host kernel version, so that it is read again (e.g. with a
+// new Runner).
+func resetBuildHostKernelVersionCache() {
+	buildHostKernelVersionOnce = sync.Once{}
+	buildHostKernelVersion = nil
+	buildHostKernelVersionError = nil
+}
+
+// CheckBuildHostKernelModulesPresent verifies that the kernel running on the build host has a non-empty
+// /lib/modules/<ver> directory. Without it, host-side module operations (e.g. loading the loop or overlay modules)
+// fail, often with confusing errors from within a chroot.
+func CheckBuildHostKernelModulesPresent() error {
+	release, err := readBuildHostKernelRelease()
+	if err != nil {
+		return err
+	}
+
+	installedKernels, err := GetInstalledKernelStringVersions(buildHostRootfs)
+	if err != nil {
+		return fmt.Errorf("failed to check build host kernel (%s) modules:\n%w", release, err)
+	}
+
+	if !sliceutils.ContainsValue(installedKernels, release) {
+		return fmt.Errorf("build host kernel (%s) has no modules in (%s) (is the running kernel's modules package "+
+			"installed?)", release, filepath.Join(KernelModulesDir, release))
+	}
+
+	return nil
+}
+
+// GetContainerHostKernelVersion returns the version of the running kernel by reading it directly from procfs.
+//
+// Containers share the kernel of the machine hosting them. So, when the tools run inside a container, this is the
+// authoritative version of the kernel that will perform mounts, load modules, etc. Outside of a container, it returns
+// the same value as GetBuildHostKernelVersion.
+func GetContainerHostKernelVersion() (*versioncompare.TolerantVersion, error) {
+	osRelease, err := os.ReadFile(procKernelOsReleasePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel release file (%s):\n%w", procKernelOsReleasePath, err)
+	}
+
+	return parseKernelVersion(sanitizeKernelRelease(string(osRelease)))
+}
+
+// GetBuildHostDistro returns the Linux distribution of the build host.
+func GetBuildHostDistro() (*Distro, error) {
+	return readDistroFromOsRelease(osReleasePath)
+}
+
+// ReadDistroFromOsRelease returns the Linux distribution described by the os-release file at 'osReleaseFilePath'.
+func ReadDistroFromOsRelease(osReleaseFilePath string) (*Distro, error) {
+	return readDistroFromOsRelease(osReleaseFilePath)
+}
+
+// readDistroFromOsRelease reads the distribution information from an os-release file.
+func readDistroFromOsRelease(osReleaseFilePath string) (*Distro, error) {
+	osReleaseFile, err := os.Open(osReleaseFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open os-release file (%s):\n%w", osReleaseFilePath, err)
+	}
+	defer osReleaseFile.Close()
+
+	fields := make(map[string]string)
+
+	scanner := bufio.NewScanner(osReleaseFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			// Be lenient with malformed lines, like systemd is.
+			continue
+		}
+
+		fields[strings.TrimSpace(key)] = unquoteOsReleaseValue(strings.TrimSpace(value))
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read os-release file (%s):\n%w", osReleaseFilePath, err)
+	}
+
+	distro := &Distro{
+		ID:        fields["ID"],
+		VersionID: fields["VERSION_ID"],
+	}
+
+	if distro.ID == "" {
+		return nil, fmt.Errorf("os-release file (%s) is missing the ID field", osReleaseFilePath)
+	}
+
+	return distro, nil
+}
+
+// unquoteOsReleaseValue removes the shell-style quoting that os-release values may have.
+func unquoteOsReleaseValue(value string) string {
+	if len(value) >= 2 {
+		quote := value[0]
+		if (quote == '"' || quote == '\'') && value[len(value)-1] == quote {
+			value = value[1 : len(value)-1]
+
+			if quote == '"' {
+				// Within double quotes, a backslash escapes the characters: " \ $ `
+				replacer := strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\$`, `$`, "\\`", "`")
+				value = replacer.Replace(value)
+			}
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,217 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDistroFromOsReleaseAzureLinux(t *testing.T) {
+	distro, err := readDistroFromOsRelease(filepath.Join("testdata", "osrelease", "azurelinux"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Distro{ID: "azurelinux", VersionID: "3.0"}, distro)
+}
+
+func TestReadDistroFromOsReleaseCommentsAndQuotes(t *testing.T) {
+	distro, err := readDistroFromOsRelease(filepath.Join("testdata", "osrelease", "ubuntu"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Distro{ID: "ubuntu", VersionID: "22.04"}, distro)
+}
+
+func TestReadDistroFromOsReleaseNoVersionId(t *testing.T) {
+	distro, err := readDistroFromOsRelease(filepath.Join("testdata", "osrelease", "rolling"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Distro{ID: "arch", VersionID: ""}, distro)
+}
+
+func TestReadDistroFromOsReleaseMissingId(t *testing.T) {
+	_, err := readDistroFromOsRelease(filepath.Join("testdata", "osrelease", "noid"))
+	assert.ErrorContains(t, err, "missing the ID field")
+}
+
+func TestReadDistroFromOsReleaseMissingFile(t *testing.T) {
+	_, err := readDistroFromOsRelease(filepath.Join("testdata", "osrelease", "missing"))
+	assert.ErrorContains(t, err, "failed to open os-release file")
+}
+
+func TestUnquoteOsReleaseValue(t *testing.T) {
+	assert.Equal(t, "abc", unquoteOsReleaseValue("abc"))
+	assert.Equal(t, "a b", unquoteOsReleaseValue(`"a b"`))
+	assert.Equal(t, `a "b"`, unquoteOsReleaseValue(`"a \"b\""`))
+	assert.Equal(t, `a\"b`, unquoteOsReleaseValue(`'a\"b'`))
+	assert.Equal(t, `"`, unquoteOsReleaseValue(`"`))
+	assert.Equal(t, "", unquoteOsReleaseValue(`""`))
+}
+
+// setTestProcKernelOsReleasePath points GetContainerHostKernelVersion at a fake procfs file for the duration of a test.
+func setTestProcKernelOsReleasePath(t *testing.T, content string) {
+	osReleasePath := filepath.Join(t.TempDir(), "osrelease")
+	err := os.WriteFile(osReleasePath, []byte(content), 0o644)
+	assert.NoError(t, err)
+
+	originalPath := procKernelOsReleasePath
+	procKernelOsReleasePath = osReleasePath
+	t.Cleanup(func() {
+		procKernelOsReleasePath = originalPath
+	})
+}
+
+func TestGetContainerHostKernelVersion(t *testing.T) {
+	setTestProcKernelOsReleasePath(t, "6.6.47.1-1.azl3\n")
+
+	version, err := GetContainerHostKernelVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.47.1-1.azl3", version.String())
+}
+
+func TestGetContainerHostKernelVersionInvalid(t *testing.T) {
+	setTestProcKernelOsReleasePath(t, "garbage\n")
+
+	_, err := GetContainerHostKernelVersion()
+	assert.ErrorContains(t, err, "failed to parse kernel version (garbage)")
+}
+
+func TestGetContainerHostKernelVersionMissingFile(t *testing.T) {
+	originalPath := procKernelOsReleasePath
+	procKernelOsReleasePath = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() {
+		procKernelOsReleasePath = originalPath
+	})
+
+	_, err := GetContainerHostKernelVersion()
+	assert.ErrorContains(t, err, "failed to read kernel release file")
+}
+
+// setTestBuildHost replaces the build host's 'uname -r' output and root directory.
+func setTestBuildHost(t *testing.T, release string, rootfs string) {
+	originalRelease := getBuildHostKernelRelease
+	originalRootfs := buildHostRootfs
+
+	getBuildHostKernelRelease = func() (string, error) {
+		return release, nil
+	}
+	buildHostRootfs = rootfs
+	resetBuildHostKernelVersionCache()
+
+	t.Cleanup(func() {
+		getBuildHostKernelRelease = originalRelease
+		buildHostRootfs = originalRootfs
+		resetBuildHostKernelVersionCache()
+	})
+}
+
+func TestCheckBuildHostKernelModulesPresent(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "kernel/fs/overlayfs/overlay.ko.xz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "", "kernel/fs/overlayfs/overlay.ko.xz")
+	setTestBuildHost(t, "6.6.51.1-1.azl3", rootfs)
+
+	err := CheckBuildHostKernelModulesPresent()
+	assert.NoError(t, err)
+}
+
+func TestCheckBuildHostKernelModulesPresentMissing(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "kernel/fs/overlayfs/overlay.ko.xz")
+	setTestBuildHost(t, "6.6.51.1-1.azl3", rootfs)
+
+	err := CheckBuildHostKernelModulesPresent()
+	assert.ErrorContains(t, err, "build host kernel (6.6.51.1-1.azl3) has no modules in (/lib/modules/6.6.51.1-1.azl3)")
+}
+
+func TestCheckBuildHostKernelModulesPresentEmpty(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "")
+	setTestBuildHost(t, "6.6.51.1-1.azl3", rootfs)
+
+	err := CheckBuildHostKernelModulesPresent()
+	assert.ErrorContains(t, err, "build host kernel (6.6.51.1-1.azl3) has no modules")
+}
+
+func TestCheckBuildHostKernelModulesPresentNoModulesDir(t *testing.T) {
+	setTestBuildHost(t, "6.6.51.1-1.azl3", t.TempDir())
+
+	err := CheckBuildHostKernelModulesPresent()
+	assert.ErrorContains(t, err, "failed to check build host kernel (6.6.51.1-1.azl3) modules")
+}
+
+func TestGetBuildHostKernelVersionUnameNoise(t *testing.T) {
+	tests := []string{
+		"6.6.47.1-1.azl3\n",
+		"6.6.47.1-1.azl3\r\n",
+		"6.6.47.1-1.azl3\x00\n",
+		"6.6.47.1-1.azl3\x00\r\n\x00",
+		" \t6.6.47.1-1.azl3\x1b\n",
+		"6.6.47.1-1\r.azl3\n",
+	}
+
+	for _, uname := range tests {
+		setTestBuildHost(t, uname, t.TempDir())
+
+		version, err := GetBuildHostKernelVersion()
+		if assert.NoError(t, err, "uname output (%q)", uname) {
+			assert.Equal(t, "6.6.47.1-1.azl3", version.String(), "uname output (%q)", uname)
+		}
+	}
+}
+
+func TestCompareToBuildHost(t *testing.T) {
+	setTestBuildHost(t, "6.6.47.1-1.azl3\n", t.TempDir())
+
+	tests := map[string]int{
+		"6.6.51.1-1.azl3":        1,
+		"6.6.47.1-1.azl3":        0,
+		"6.6.47.1-1.azl3.x86_64": 0,
+		"6.1.58.1-1.azl3":        -1,
+	}
+
+	for release, expected := range tests {
+		version, err := parseKernelVersion(release)
+		assert.NoError(t, err)
+
+		result, err := version.CompareToBuildHost()
+		assert.NoError(t, err, "release (%s)", release)
+		assert.Equal(t, expected, result, "release (%s)", release)
+	}
+}
+
+func TestCompareToBuildHostUnameFailure(t *testing.T) {
+	originalRelease := getBuildHostKernelRelease
+	getBuildHostKernelRelease = func() (string, error) {
+		return "", fmt.Errorf("uname not found")
+	}
+	resetBuildHostKernelVersionCache()
+	t.Cleanup(func() {
+		getBuildHostKernelRelease = originalRelease
+		resetBuildHostKernelVersionCache()
+	})
+
+	version, err := parseKernelVersion("6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+
+	_, err = version.CompareToBuildHost()
+	assert.EqualError(t, err, "uname not found")
+}
+
+func TestCheckBuildHostKernelModulesPresentUnameNoise(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "", "kernel/fs/overlayfs/overlay.ko.xz")
+	setTestBuildHost(t, "6.6.51.1-1.azl3\x00\r\n", rootfs)
+
+	err := CheckBuildHostKernelModulesPresent()
+	assert.NoError(t, err)
+}
+
+func TestGetContainerHostKernelVersionNullTerminated(t *testing.T) {
+	setTestProcKernelOsReleasePath(t, "6.6.47.1-1.azl3\x00\n")
+
+	version, err := GetContainerHostKernelVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.47.1-1.azl3", version.String())
+}
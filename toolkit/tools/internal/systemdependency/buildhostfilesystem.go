@@ -0,0 +1,126 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const modulesBuiltinFileName = "modules.builtin"
+
+// procFilesystemsPath lists the filesystem types registered with the running kernel. It is a variable so that tests
+// can replace it.
+var procFilesystemsPath = "/proc/filesystems"
+
+// filesystemModuleNames maps the filesystem types whose kernel module has a different name to that module.
+var filesystemModuleNames = map[string]string{
+	"ext2":    "ext4",
+	"ext3":    "ext4",
+	"iso9660": "isofs",
+}
+
+// BuildHostSupportsFilesystem returns true if the kernel running on the build host can mount filesystems of type
+// 'fsType' (e.g. "erofs"). That is, if the filesystem is already registered with the kernel, is built into the kernel,
+// or has a loadable module in the kernel's modules directory.
+//
+// Checking this up front avoids confusing mount failures later in the build.
+func BuildHostSupportsFilesystem(fsType string) (bool, error) {
+	registered, err := readRegisteredFilesystems(procFilesystemsPath)
+	if err != nil {
+		return false, err
+	}
+
+	if registered[fsType] {
+		return true, nil
+	}
+
+	release, err := readBuildHostKernelRelease()
+	if err != nil {
+		return false, err
+	}
+
+	kernelDir, err := ResolvePathInRootfs(buildHostRootfs, filepath.Join(KernelModulesDir, release))
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve build host kernel (%s) modules directory:\n%w", release, err)
+	}
+
+	moduleName, found := filesystemModuleNames[fsType]
+	if !found {
+		moduleName = fsType
+	}
+
+	builtin, err := readModulesBuiltin(filepath.Join(kernelDir, modulesBuiltinFileName))
+	if err != nil {
+		return false, err
+	}
+
+	if builtin[normalizeModuleName(moduleName)] {
+		return true, nil
+	}
+
+	deps, err := readModulesDep(filepath.Join(kernelDir, modulesDepFileName))
+	if err != nil {
+		return false, fmt.Errorf("failed to read build host kernel (%s) modules:\n%w", release, err)
+	}
+
+	_, found = findModuleInDeps(deps, moduleName)
+	return found, nil
+}
+
+// readRegisteredFilesystems returns the filesystem types listed in a /proc/filesystems file. A missing file (e.g. when
+// /proc isn't mounted) is treated as empty.
+func readRegisteredFilesystems(filesystemsPath string) (map[string]bool, error) {
+	content, err := os.ReadFile(filesystemsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registered filesystems (%s):\n%w", filesystemsPath, err)
+	}
+
+	// Each line has the format: [nodev]<tab><fstype>
+	registered := make(map[string]bool)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			registered[fields[len(fields)-1]] = true
+		}
+	}
+
+	return registered, nil
+}
+
+// readModulesBuiltin returns the normalized names of the modules listed in a modules.builtin file, which are built into
+// the kernel. A missing file is treated as empty.
+func readModulesBuiltin(modulesBuiltinPath string) (map[string]bool, error) {
+	builtinFile, err := os.Open(modulesBuiltinPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open builtin modules file (%s):\n%w", modulesBuiltinPath, err)
+	}
+	defer builtinFile.Close()
+
+	builtin := make(map[string]bool)
+
+	scanner := bufio.NewScanner(builtinFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			builtin[moduleNameFromPath(line)] = true
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read builtin modules file (%s):\n%w", modulesBuiltinPath, err)
+	}
+
+	return builtin, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testBuildHostModulesDep = `kernel/fs/erofs/erofs.ko.xz:
+kernel/fs/isofs/isofs.ko.xz:
+`
+
+// setTestBuildHostFilesystems replaces the build host's /proc/filesystems content.
+func setTestBuildHostFilesystems(t *testing.T, content string) {
+	filesystemsPath := filepath.Join(t.TempDir(), "filesystems")
+	err := os.WriteFile(filesystemsPath, []byte(content), 0o644)
+	assert.NoError(t, err)
+
+	originalPath := procFilesystemsPath
+	procFilesystemsPath = filesystemsPath
+	t.Cleanup(func() { procFilesystemsPath = originalPath })
+}
+
+func createTestFilesystemBuildHost(t *testing.T) {
+	rootfs := t.TempDir()
+	kernelDir := createTestKernel(t, rootfs, "6.6.51.1-1.azl3", testBuildHostModulesDep,
+		"kernel/fs/erofs/erofs.ko.xz", "kernel/fs/isofs/isofs.ko.xz")
+
+	err := os.WriteFile(filepath.Join(kernelDir, modulesBuiltinFileName),
+		[]byte("kernel/fs/ext4/ext4.ko\nkernel/fs/squashfs/squashfs.ko\n"), 0o644)
+	assert.NoError(t, err)
+
+	setTestBuildHost(t, "6.6.51.1-1.azl3", rootfs)
+	setTestBuildHostFilesystems(t, "nodev\tsysfs\nnodev\tproc\n\tvfat\n")
+}
+
+func TestBuildHostSupportsFilesystem(t *testing.T) {
+	createTestFilesystemBuildHost(t)
+
+	for _, fsType := range []string{"vfat", "ext4", "ext3", "squashfs", "erofs", "iso9660"} {
+		supported, err := BuildHostSupportsFilesystem(fsType)
+		assert.NoError(t, err, fsType)
+		assert.True(t, supported, fsType)
+	}
+}
+
+func TestBuildHostSupportsFilesystemUnsupported(t *testing.T) {
+	createTestFilesystemBuildHost(t)
+
+	supported, err := BuildHostSupportsFilesystem("btrfs")
+	assert.NoError(t, err)
+	assert.False(t, supported)
+}
+
+func TestBuildHostSupportsFilesystemNoModules(t *testing.T) {
+	setTestBuildHost(t, "6.6.51.1-1.azl3", t.TempDir())
+	setTestBuildHostFilesystems(t, "\text4\n")
+
+	// Registered filesystems don't need the modules directory.
+	supported, err := BuildHostSupportsFilesystem("ext4")
+	assert.NoError(t, err)
+	assert.True(t, supported)
+
+	_, err = BuildHostSupportsFilesystem("erofs")
+	assert.ErrorContains(t, err, "failed to read build host kernel (6.6.51.1-1.azl3) modules")
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+)
+
+// procKernelTaintedPath is the running kernel's taint bitmask. It is a variable so that tests can replace it.
+var procKernelTaintedPath = "/proc/sys/kernel/tainted"
+
+// KernelTaintFlag is one of the bits of the kernel's taint bitmask, as documented in the kernel's
+// Documentation/admin-guide/tainted-kernels.rst.
+type KernelTaintFlag struct {
+	Bit int
+	// The letter that the kernel uses for the flag in oops reports. For example: "O".
+	Letter string
+	// For example: "externally-built (out-of-tree) module was loaded".
+	Description string
+}
+
+// kernelTaintFlags are the well-known kernel taint flags, ordered by bit.
+var kernelTaintFlags = []KernelTaintFlag{
+	{0, "P", "proprietary module was loaded"},
+	{1, "F", "module was force loaded"},
+	{2, "S", "kernel running on an out of specification system"},
+	{3, "R", "module was force unloaded"},
+	{4, "M", "processor reported a machine check exception"},
+	{5, "B", "bad page referenced or unexpected page flags"},
+	{6, "U", "taint requested by userspace application"},
+	{7, "D", "kernel died recently (i.e. there was an oops or bug)"},
+	{8, "A", "ACPI table overridden by user"},
+	{9, "W", "kernel issued a warning"},
+	{10, "C", "staging driver was loaded"},
+	{11, "I", "workaround for bug in platform firmware applied"},
+	{12, "O", "externally-built (out-of-tree) module was loaded"},
+	{13, "E", "unsigned module was loaded"},
+	{14, "L", "soft lockup occurred"},
+	{15, "K", "kernel has been live patched"},
+	{16, "X", "auxiliary taint, defined for and used by distros"},
+	{17, "T", "kernel was built with the struct randomization plugin"},
+	{18, "N", "an in-kernel test has been run"},
+}
+
+// kernelModuleTaintBits are the taint bits that indicate that the running kernel has loaded modules that it wasn't
+// built with, or has forced a module operation. Module operations (e.g. loading the loop or overlay modules) on such a
+// kernel may behave unexpectedly.
+var kernelModuleTaintBits = []int{0, 1, 3, 12, 13}
+
+// GetBuildHostKernelTaint returns the taint bitmask of the kernel running on the build host, as read from
+// /proc/sys/kernel/tainted. 0 means that the kernel isn't tainted. Use DecodeKernelTaint to get the flags that are set.
+func GetBuildHostKernelTaint() (int, error) {
+	taintedContent, err := os.ReadFile(procKernelTaintedPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read kernel taint file (%s):\n%w", procKernelTaintedPath, err)
+	}
+
+	taintedString := strings.TrimSpace(string(taintedContent))
+
+	taint, err := strconv.Atoi(taintedString)
+	if err != nil || taint < 0 {
+		return 0, fmt.Errorf("invalid kernel taint (%s) in (%s)", taintedString, procKernelTaintedPath)
+	}
+
+	return taint, nil
+}
+
+// DecodeKernelTaint returns the well-known flags that are set in the kernel taint bitmask 'taint', ordered by bit.
+// Unknown bits are ignored.
+func DecodeKernelTaint(taint int) []KernelTaintFlag {
+	flags := []KernelTaintFlag(nil)
+	for _, flag := range kernelTaintFlags {
+		if taint&(1<<flag.Bit) != 0 {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
+
+// WarnIfBuildHostKernelModulesTainted logs a warning if the build host's kernel is tainted by an out-of-tree,
+// proprietary, unsigned or forced module. This is only informational, to aid debugging of module operations that fail
+// on the build host. So, an error is only returned if the taint can't be read.
+func WarnIfBuildHostKernelModulesTainted() error {
+	taint, err := GetBuildHostKernelTaint()
+	if err != nil {
+		return err
+	}
+
+	moduleFlags := []string(nil)
+	for _, flag := range DecodeKernelTaint(taint) {
+		for _, bit := range kernelModuleTaintBits {
+			if flag.Bit == bit {
+				moduleFlags = append(moduleFlags, fmt.Sprintf("%s (%s)", flag.Letter, flag.Description))
+			}
+		}
+	}
+
+	if len(moduleFlags) > 0 {
+		logger.Log.Warnf("Build host kernel is tainted (%d): %s", taint, strings.Join(moduleFlags, ", "))
+	} else if taint != 0 {
+		logger.Log.Debugf("Build host kernel is tainted (%d)", taint)
+	}
+
+	return nil
+}
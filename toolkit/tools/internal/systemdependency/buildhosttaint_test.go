@@ -0,0 +1,75 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setTestProcKernelTaintedPath(t *testing.T, content string) {
+	originalPath := procKernelTaintedPath
+	procKernelTaintedPath = filepath.Join(t.TempDir(), "tainted")
+	t.Cleanup(func() {
+		procKernelTaintedPath = originalPath
+	})
+
+	err := os.WriteFile(procKernelTaintedPath, []byte(content), 0o644)
+	assert.NoError(t, err)
+}
+
+func TestGetBuildHostKernelTaint(t *testing.T) {
+	setTestProcKernelTaintedPath(t, "12288\n")
+
+	taint, err := GetBuildHostKernelTaint()
+	assert.NoError(t, err)
+	assert.Equal(t, 12288, taint)
+
+	err = WarnIfBuildHostKernelModulesTainted()
+	assert.NoError(t, err)
+}
+
+func TestGetBuildHostKernelTaintNotTainted(t *testing.T) {
+	setTestProcKernelTaintedPath(t, "0\n")
+
+	taint, err := GetBuildHostKernelTaint()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, taint)
+}
+
+func TestGetBuildHostKernelTaintInvalid(t *testing.T) {
+	setTestProcKernelTaintedPath(t, "garbage\n")
+
+	_, err := GetBuildHostKernelTaint()
+	assert.ErrorContains(t, err, "invalid kernel taint (garbage)")
+
+	err = WarnIfBuildHostKernelModulesTainted()
+	assert.ErrorContains(t, err, "invalid kernel taint (garbage)")
+}
+
+func TestGetBuildHostKernelTaintMissingFile(t *testing.T) {
+	originalPath := procKernelTaintedPath
+	procKernelTaintedPath = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() {
+		procKernelTaintedPath = originalPath
+	})
+
+	_, err := GetBuildHostKernelTaint()
+	assert.ErrorContains(t, err, "failed to read kernel taint file")
+}
+
+func TestDecodeKernelTaint(t *testing.T) {
+	// O (12) and E (13), plus an unknown bit.
+	flags := DecodeKernelTaint(1<<12 | 1<<13 | 1<<30)
+	letters := []string(nil)
+	for _, flag := range flags {
+		letters = append(letters, flag.Letter)
+	}
+	assert.Equal(t, []string{"O", "E"}, letters)
+
+	assert.Empty(t, DecodeKernelTaint(0))
+}
@@ -0,0 +1,245 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	// The size of a cpio "newc" header: the 6 byte magic, followed by 13 fields of 8 hex digits.
+	cpioNewcHeaderSize = 110
+	cpioTrailerName    = "TRAILER!!!"
+)
+
+var (
+	cpioNewcMagic    = []byte("070701")
+	cpioNewcCrcMagic = []byte("070702")
+	xzMagic          = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic        = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// kernelModuleBuiltInConfigs maps the modules that are commonly needed to mount the root device to the kernel config
+// option that builds them. This is only used for kernels that don't have a modules.builtin file.
+var kernelModuleBuiltInConfigs = map[string]string{
+	"ahci":         "CONFIG_SATA_AHCI",
+	"hv_storvsc":   "CONFIG_SCSI_STORVSC",
+	"nvme":         "CONFIG_BLK_DEV_NVME",
+	"sd_mod":       "CONFIG_BLK_DEV_SD",
+	"virtio_blk":   "CONFIG_VIRTIO_BLK",
+	"virtio_scsi":  "CONFIG_SCSI_VIRTIO",
+	"xen_blkfront": "CONFIG_XEN_BLKDEV_FRONTEND",
+}
+
+// IsKernelModuleBuiltIn returns true if the module 'moduleName' (e.g. "nvme") is built into the kernel 'version',
+// instead of being a loadable module.
+//
+// The kernel's modules.builtin file is used if it has one. Otherwise, the kernel config is checked, for the modules that
+// have a known config option.
+func IsKernelModuleBuiltIn(rootfs string, version string, moduleName string) (bool, error) {
+	moduleName = normalizeModuleName(moduleName)
+
+	kernelDir, err := ResolvePathInRootfs(rootfs, filepath.Join(KernelModulesDir, version))
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve kernel (%s) modules directory:\n%w", version, err)
+	}
+
+	builtin, err := readModulesBuiltin(filepath.Join(kernelDir, modulesBuiltinFileName))
+	if err != nil {
+		return false, err
+	}
+
+	if builtin != nil {
+		return builtin[moduleName], nil
+	}
+
+	configKey, found := kernelModuleBuiltInConfigs[moduleName]
+	if !found {
+		return false, nil
+	}
+
+	config, err := GetKernelConfig(rootfs, version)
+	if err != nil {
+		return false, err
+	}
+
+	return KernelConfigEnabled(config, configKey), nil
+}
+
+// ListInitramfsModules returns the names of the kernel modules included in the initramfs file 'initramfsPath'. The
+// names are normalized, the same as modprobe does (e.g. "hv_storvsc").
+//
+// The initramfs may be an uncompressed cpio archive, or one compressed with gzip, xz or zstd. An uncompressed archive
+// may be followed by another archive (e.g. the early microcode archive that dracut prepends).
+func ListInitramfsModules(initramfsPath string) (map[string]bool, error) {
+	initramfsFile, err := os.Open(initramfsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open initramfs (%s):\n%w", initramfsPath, err)
+	}
+	defer initramfsFile.Close()
+
+	modules := make(map[string]bool)
+	visit := func(name string) {
+		if strings.Contains(name, KernelModulesDir[1:]+"/") && moduleCompressionFromPath(name) != "" {
+			modules[moduleNameFromPath(name)] = true
+		}
+	}
+
+	err = walkInitramfs(bufio.NewReader(initramfsFile), visit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read initramfs (%s):\n%w", initramfsPath, err)
+	}
+
+	return modules, nil
+}
+
+// walkInitramfs calls 'visit' with the path of each file in the (possibly concatenated) cpio archives of an initramfs.
+func walkInitramfs(reader *bufio.Reader, visit func(name string)) error {
+	for {
+		// Archives are padded with null bytes (e.g. to a 512 byte boundary).
+		err := skipNullBytes(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		magic, err := reader.Peek(len(xzMagic))
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		var decompressed io.Reader
+		switch {
+		case bytes.HasPrefix(magic, cpioNewcMagic) || bytes.HasPrefix(magic, cpioNewcCrcMagic):
+			err = walkCpioArchive(reader, visit)
+			if err != nil {
+				return err
+			}
+
+			continue
+
+		case bytes.HasPrefix(magic, gzipMagic):
+			gzipReader, err := gzip.NewReader(reader)
+			if err != nil {
+				return fmt.Errorf("failed to open gzip stream:\n%w", err)
+			}
+			defer gzipReader.Close()
+
+			decompressed = gzipReader
+
+		case bytes.HasPrefix(magic, xzMagic):
+			xzReader, err := xz.NewReader(reader)
+			if err != nil {
+				return fmt.Errorf("failed to open xz stream:\n%w", err)
+			}
+
+			decompressed = xzReader
+
+		case bytes.HasPrefix(magic, zstdMagic):
+			zstdReader, err := zstd.NewReader(reader)
+			if err != nil {
+				return fmt.Errorf("failed to open zstd stream:\n%w", err)
+			}
+			defer zstdReader.Close()
+
+			decompressed = zstdReader
+
+		default:
+			return fmt.Errorf("unsupported initramfs format (magic: %s)", hex.EncodeToString(magic))
+		}
+
+		// A compressed archive is always the last one, since the kernel can't tell where the compressed stream ends.
+		return walkCpioArchive(bufio.NewReader(decompressed), visit)
+	}
+}
+
+// skipNullBytes discards the null bytes at the start of 'reader'. io.EOF is returned if there is no more data.
+func skipNullBytes(reader *bufio.Reader) error {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if b != 0 {
+			return reader.UnreadByte()
+		}
+	}
+}
+
+// walkCpioArchive calls 'visit' with the path of each entry of a cpio "newc" archive, up to the archive's trailer.
+func walkCpioArchive(reader io.Reader, visit func(name string)) error {
+	header := make([]byte, cpioNewcHeaderSize)
+	for {
+		_, err := io.ReadFull(reader, header)
+		if err != nil {
+			return fmt.Errorf("failed to read cpio header:\n%w", err)
+		}
+
+		if !bytes.HasPrefix(header, cpioNewcMagic) && !bytes.HasPrefix(header, cpioNewcCrcMagic) {
+			return fmt.Errorf("invalid cpio header magic (%s)", header[:len(cpioNewcMagic)])
+		}
+
+		fileSize, err := parseCpioHeaderField(header, 6)
+		if err != nil {
+			return err
+		}
+
+		nameSize, err := parseCpioHeaderField(header, 11)
+		if err != nil {
+			return err
+		}
+
+		// The name is null terminated and padded, along with the header, to a 4 byte boundary.
+		name := make([]byte, nameSize+cpioPadding(cpioNewcHeaderSize+nameSize))
+		_, err = io.ReadFull(reader, name)
+		if err != nil {
+			return fmt.Errorf("failed to read cpio entry name:\n%w", err)
+		}
+
+		entryName := strings.TrimRight(string(name[:nameSize]), "\x00")
+		if entryName == cpioTrailerName {
+			return nil
+		}
+
+		visit(entryName)
+
+		_, err = io.CopyN(io.Discard, reader, fileSize+cpioPadding(fileSize))
+		if err != nil {
+			return fmt.Errorf("failed to read cpio entry (%s):\n%w", entryName, err)
+		}
+	}
+}
+
+// parseCpioHeaderField returns the value of the 'index'th hex field of a cpio "newc" header.
+func parseCpioHeaderField(header []byte, index int) (int64, error) {
+	start := len(cpioNewcMagic) + index*8
+	field := string(header[start : start+8])
+
+	value, err := strconv.ParseInt(field, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cpio header field (%s):\n%w", field, err)
+	}
+
+	return value, nil
+}
+
+// cpioPadding returns the number of bytes needed to pad 'size' to a 4 byte boundary.
+func cpioPadding(size int64) int64 {
+	return (4 - size%4) % 4
+}
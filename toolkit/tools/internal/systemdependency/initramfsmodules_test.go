@@ -0,0 +1,142 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavaliercoder/go-cpio"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+)
+
+// newTestCpioArchive returns an uncompressed cpio "newc" archive with an empty file for each of 'names'.
+func newTestCpioArchive(t *testing.T, names ...string) []byte {
+	buffer := bytes.Buffer{}
+	writer := cpio.NewWriter(&buffer)
+	for _, name := range names {
+		err := writer.WriteHeader(&cpio.Header{Name: name, Mode: 0o644})
+		assert.NoError(t, err)
+	}
+
+	err := writer.Close()
+	assert.NoError(t, err)
+
+	return buffer.Bytes()
+}
+
+func gzipTestData(t *testing.T, data []byte) []byte {
+	buffer := bytes.Buffer{}
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write(data)
+	assert.NoError(t, err)
+
+	err = writer.Close()
+	assert.NoError(t, err)
+
+	return buffer.Bytes()
+}
+
+func createTestInitramfs(t *testing.T, data []byte) string {
+	initramfsPath := filepath.Join(t.TempDir(), "initramfs-"+testKernelVersion+".img")
+	err := os.WriteFile(initramfsPath, data, 0o644)
+	assert.NoError(t, err)
+
+	return initramfsPath
+}
+
+var testInitramfsFiles = []string{
+	"usr/lib/modules/" + testKernelVersion + "/kernel/drivers/nvme/host/nvme.ko.xz",
+	"usr/lib/modules/" + testKernelVersion + "/kernel/drivers/scsi/hv_storvsc.ko.xz",
+	"usr/lib/modules/" + testKernelVersion + "/modules.dep",
+	"usr/bin/systemd",
+}
+
+func TestListInitramfsModulesGzip(t *testing.T) {
+	initramfsPath := createTestInitramfs(t, gzipTestData(t, newTestCpioArchive(t, testInitramfsFiles...)))
+
+	modules, err := ListInitramfsModules(initramfsPath)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"nvme": true, "hv_storvsc": true}, modules)
+}
+
+func TestListInitramfsModulesXz(t *testing.T) {
+	buffer := bytes.Buffer{}
+	writer, err := xz.NewWriter(&buffer)
+	assert.NoError(t, err)
+
+	_, err = writer.Write(newTestCpioArchive(t, testInitramfsFiles...))
+	assert.NoError(t, err)
+
+	err = writer.Close()
+	assert.NoError(t, err)
+
+	modules, err := ListInitramfsModules(createTestInitramfs(t, buffer.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"nvme": true, "hv_storvsc": true}, modules)
+}
+
+func TestListInitramfsModulesEarlyCpio(t *testing.T) {
+	// dracut prepends an uncompressed archive with the CPU microcode, padded with null bytes.
+	data := newTestCpioArchive(t, "kernel/x86/microcode/GenuineIntel.bin")
+	data = append(data, make([]byte, 512-len(data)%512)...)
+	data = append(data, gzipTestData(t, newTestCpioArchive(t, testInitramfsFiles...))...)
+
+	modules, err := ListInitramfsModules(createTestInitramfs(t, data))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"nvme": true, "hv_storvsc": true}, modules)
+}
+
+func TestListInitramfsModulesUnsupportedFormat(t *testing.T) {
+	initramfsPath := createTestInitramfs(t, []byte("BZh91AY&SY"))
+
+	_, err := ListInitramfsModules(initramfsPath)
+	assert.ErrorContains(t, err, "unsupported initramfs format")
+}
+
+func TestListInitramfsModulesMissingFile(t *testing.T) {
+	_, err := ListInitramfsModules(filepath.Join(t.TempDir(), "initramfs.img"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestIsKernelModuleBuiltInModulesBuiltin(t *testing.T) {
+	rootfs := t.TempDir()
+	kernelDir := createTestKernel(t, rootfs, testKernelVersion, testModulesDep)
+
+	err := os.WriteFile(filepath.Join(kernelDir, modulesBuiltinFileName),
+		[]byte("kernel/drivers/nvme/host/nvme.ko\nkernel/drivers/scsi/hv_storvsc.ko\n"), 0o644)
+	assert.NoError(t, err)
+
+	builtIn, err := IsKernelModuleBuiltIn(rootfs, testKernelVersion, "hv-storvsc")
+	assert.NoError(t, err)
+	assert.True(t, builtIn)
+
+	builtIn, err = IsKernelModuleBuiltIn(rootfs, testKernelVersion, "virtio_blk")
+	assert.NoError(t, err)
+	assert.False(t, builtIn)
+}
+
+func TestIsKernelModuleBuiltInKernelConfig(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, testModulesDep)
+
+	err := os.MkdirAll(filepath.Join(rootfs, KernelBootDir), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(rootfs, KernelBootDir, kernelConfigFilePrefix+testKernelVersion),
+		[]byte("CONFIG_BLK_DEV_NVME=y\nCONFIG_VIRTIO_BLK=m\n"), 0o644)
+	assert.NoError(t, err)
+
+	builtIn, err := IsKernelModuleBuiltIn(rootfs, testKernelVersion, "nvme")
+	assert.NoError(t, err)
+	assert.True(t, builtIn)
+
+	builtIn, err = IsKernelModuleBuiltIn(rootfs, testKernelVersion, "virtio_blk")
+	assert.NoError(t, err)
+	assert.False(t, builtIn)
+}
@@ -0,0 +1,100 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"time"
+)
+
+// InstalledKernelsOption changes the behavior of GetInstalledKernelVersions.
+type InstalledKernelsOption func(options *installedKernelsOptions)
+
+type installedKernelsOptions struct {
+	strict           bool
+	skipUnparseable  bool
+	additionalFilter KernelDirFilter
+	readAttempts     int
+	readRetryDelay   time.Duration
+}
+
+// WithStrict makes an empty or unreadable kernel directory an error, instead of skipping it. Use this when the image is
+// expected to be clean, so that leftovers of an uninstalled kernel are reported as soon as possible.
+func WithStrict() InstalledKernelsOption {
+	return func(options *installedKernelsOptions) {
+		options.strict = true
+	}
+}
+
+// WithSkipUnparseable skips, with a warning, the kernel directories whose names aren't kernel release strings,
+// instead of returning an error. Use this when reporting on an image, so that one odd directory doesn't hide the other
+// kernels.
+func WithSkipUnparseable() InstalledKernelsOption {
+	return func(options *installedKernelsOptions) {
+		options.skipUnparseable = true
+	}
+}
+
+// WithFilter skips the kernel directories that 'filter' doesn't keep. The filter is applied in addition to the
+// default handling of empty kernel directories. If WithFilter is passed more than once, all of the filters must keep
+// a directory.
+func WithFilter(filter KernelDirFilter) InstalledKernelsOption {
+	return func(options *installedKernelsOptions) {
+		if options.additionalFilter == nil {
+			options.additionalFilter = filter
+		} else {
+			options.additionalFilter = AllKernelDirFilters(options.additionalFilter, filter)
+		}
+	}
+}
+
+// WithReadRetries makes up to 'attempts' attempts to read the kernel modules directory, waiting 'delay' before the
+// first retry and doubling the wait for each further retry. Only transient errors that network-backed filesystems
+// return (e.g. EIO or ESTALE) are retried. By default, the directory is read once (see DefaultKernelDirReadAttempts).
+func WithReadRetries(attempts int, delay time.Duration) InstalledKernelsOption {
+	return func(options *installedKernelsOptions) {
+		options.readAttempts = attempts
+		options.readRetryDelay = delay
+	}
+}
+
+func newInstalledKernelsOptions(opts []InstalledKernelsOption) installedKernelsOptions {
+	options := installedKernelsOptions{
+		readAttempts: DefaultKernelDirReadAttempts,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// kernelDirFilter returns the filter that implements the options.
+func (o *installedKernelsOptions) kernelDirFilter() KernelDirFilter {
+	filter := NonEmptyKernelDirFilter
+	if o.strict {
+		filter = strictNonEmptyKernelDirFilter
+	}
+
+	if o.additionalFilter != nil {
+		filter = AllKernelDirFilters(filter, o.additionalFilter)
+	}
+
+	return filter
+}
+
+// strictNonEmptyKernelDirFilter is the same as NonEmptyKernelDirFilter, except that an empty or unreadable directory is
+// an error.
+func strictNonEmptyKernelDirFilter(path string) (bool, error) {
+	keep, err := nonEmptyKernelDirFilter(path)
+	if err != nil {
+		return false, err
+	}
+
+	if !keep {
+		return false, fmt.Errorf("kernel directory (%s) is empty (leftover of an uninstalled kernel?)", path)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestOptionsRootfs creates a rootfs with two good kernels, an empty kernel directory and a directory whose name
+// isn't a kernel release.
+func createTestOptionsRootfs(t *testing.T) string {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3-rt", "", "vmlinuz")
+	createTestKernel(t, rootfs, "extramodules", "", "vmlinuz")
+
+	err := os.MkdirAll(filepath.Join(rootfs, KernelModulesDir, "5.15.153.1-2.cm2"), os.ModePerm)
+	assert.NoError(t, err)
+
+	return rootfs
+}
+
+func noRealtimeKernelDirFilter(path string) (bool, error) {
+	return !strings.HasSuffix(filepath.Base(path), "-rt"), nil
+}
+
+func TestGetInstalledKernelVersionsNoOptions(t *testing.T) {
+	rootfs := createTestOptionsRootfs(t)
+
+	_, err := GetInstalledKernelVersions(rootfs)
+	assert.ErrorContains(t, err, "failed to parse kernel version (extramodules)")
+}
+
+func TestGetInstalledKernelVersionsSkipUnparseable(t *testing.T) {
+	rootfs := createTestOptionsRootfs(t)
+
+	versions, err := GetInstalledKernelVersions(rootfs, WithSkipUnparseable())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3-rt"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsStrict(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	versions, err := GetInstalledKernelVersions(rootfs, WithStrict())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+
+	err = os.MkdirAll(filepath.Join(rootfs, KernelModulesDir, "5.15.153.1-2.cm2"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, err = GetInstalledKernelVersions(rootfs, WithStrict())
+	assert.ErrorContains(t, err, "5.15.153.1-2.cm2) is empty")
+}
+
+func TestGetInstalledKernelVersionsStrictAndSkipUnparseable(t *testing.T) {
+	rootfs := createTestOptionsRootfs(t)
+
+	// Skipping unparseable names doesn't skip empty directories.
+	_, err := GetInstalledKernelVersions(rootfs, WithStrict(), WithSkipUnparseable())
+	assert.ErrorContains(t, err, "5.15.153.1-2.cm2) is empty")
+}
+
+func TestGetInstalledKernelVersionsFilter(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3-rt", "", "vmlinuz")
+
+	versions, err := GetInstalledKernelVersions(rootfs, WithFilter(noRealtimeKernelDirFilter))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsFilterAndSkipUnparseable(t *testing.T) {
+	rootfs := createTestOptionsRootfs(t)
+
+	versions, err := GetInstalledKernelVersions(rootfs, WithFilter(noRealtimeKernelDirFilter), WithSkipUnparseable())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsStrictAndFilter(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3-rt", "", "vmlinuz")
+
+	versions, err := GetInstalledKernelVersions(rootfs, WithStrict(), WithFilter(noRealtimeKernelDirFilter))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsMultipleFilters(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.1.90.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3-rt", "", "vmlinuz")
+
+	series66Filter := func(path string) (bool, error) {
+		return strings.HasPrefix(filepath.Base(path), "6.6."), nil
+	}
+
+	versions, err := GetInstalledKernelVersions(rootfs, WithFilter(noRealtimeKernelDirFilter),
+		WithFilter(series66Filter))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+// stubUnreadableKernelDir makes the emptiness check of the kernel directory 'version' fail with a permission error.
+func stubUnreadableKernelDir(t *testing.T, version string) {
+	originalIsDirEmpty := isDirEmpty
+	isDirEmpty = func(path string) (bool, error) {
+		if filepath.Base(path) == version {
+			return false, &fs.PathError{Op: "open", Path: path, Err: fs.ErrPermission}
+		}
+		return originalIsDirEmpty(path)
+	}
+	t.Cleanup(func() { isDirEmpty = originalIsDirEmpty })
+}
+
+func TestGetInstalledKernelVersionsUnreadableKernelDir(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "", "vmlinuz")
+	stubUnreadableKernelDir(t, "6.6.51.1-1.azl3")
+
+	versions, err := GetInstalledKernelVersions(rootfs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+
+	stringVersions, err := GetInstalledKernelStringVersions(rootfs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, stringVersions)
+
+	_, err = GetInstalledKernelVersions(rootfs, WithStrict())
+	assert.ErrorContains(t, err, "failed to read installed kernel (6.6.51.1-1.azl3) module directory")
+	assert.ErrorIs(t, err, fs.ErrPermission)
+}
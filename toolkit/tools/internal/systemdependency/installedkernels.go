@@ -0,0 +1,350 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// kernelBackupDirSuffixes are the suffixes that package managers add to a directory that they move out of the way
+// during an upgrade (e.g. /lib/modules/<ver>.rpmmoved).
+var kernelBackupDirSuffixes = []string{
+	".rpmmoved",
+	".dpkg-old",
+}
+
+// KernelDirFilter decides if a kernel modules directory (i.e. /lib/modules/<ver>) should be treated as an installed
+// kernel. 'path' is the full path of the directory.
+type KernelDirFilter func(path string) (keep bool, err error)
+
+// isDirEmpty is file.IsDirEmpty. It is a variable so that tests can simulate an unreadable directory, since the tests
+// run as root, which can read any directory.
+var isDirEmpty = file.IsDirEmpty
+
+// NonEmptyKernelDirFilter keeps the kernel directories that are not empty. This is the default filter.
+//
+// There is a bug in Azure Linux 2.0, where uninstalling the kernel package doesn't remove the directory
+// /lib/modules/<ver>. Instead the directory is just emptied. So, an empty directory isn't an installed kernel.
+//
+// A kernel directory that can't be read due to its permissions is skipped with a warning, so that the other kernels
+// are still listed. Use WithStrict to make this an error instead.
+func NonEmptyKernelDirFilter(path string) (bool, error) {
+	keep, err := nonEmptyKernelDirFilter(path)
+	if errors.Is(err, fs.ErrPermission) {
+		logger.Log.Warnf("Skipping unreadable kernel directory (%s): %s", path, err)
+		return false, nil
+	}
+
+	return keep, err
+}
+
+// nonEmptyKernelDirFilter is the same as NonEmptyKernelDirFilter, except that all errors are returned.
+func nonEmptyKernelDirFilter(path string) (bool, error) {
+	empty, err := isDirEmpty(path)
+	if err != nil {
+		return false, err
+	}
+
+	return !empty, nil
+}
+
+// AllKernelDirFilters returns a filter that keeps a kernel directory only if all of the provided filters keep it.
+// The filters are evaluated in order and evaluation stops at the first filter that rejects the directory.
+func AllKernelDirFilters(filters ...KernelDirFilter) KernelDirFilter {
+	return func(path string) (bool, error) {
+		for _, filter := range filters {
+			keep, err := filter(path)
+			if err != nil || !keep {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+}
+
+// GetInstalledKernelStringVersions returns the names of the kernel module directories under 'rootfs', skipping any
+// kernel directory that is empty.
+func GetInstalledKernelStringVersions(rootfs string) ([]string, error) {
+	return GetFilteredKernelStringVersions(rootfs, NonEmptyKernelDirFilter)
+}
+
+// GetFilteredKernelStringVersions returns the names of the kernel module directories under 'rootfs' that 'filter'
+// keeps. To extend the default behavior instead of replacing it, combine the filter with NonEmptyKernelDirFilter using
+// AllKernelDirFilters.
+func GetFilteredKernelStringVersions(rootfs string, filter KernelDirFilter) ([]string, error) {
+	kernelModulesDir, err := resolveKernelModulesDir(rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	return getFilteredKernelStringVersionsInDir(kernelModulesDir, filter)
+}
+
+// resolveKernelModulesDir returns the host path of the kernel modules directory of 'rootfs', after checking that it is
+// a directory.
+func resolveKernelModulesDir(rootfs string) (string, error) {
+	kernelModulesDir, err := ResolvePathInRootfs(rootfs, KernelModulesDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve kernel modules directory (%s):\n%w",
+			kernelModulesDirErrorHint(rootfs, err), err)
+	}
+
+	info, err := os.Stat(kernelModulesDir)
+	if err == nil && !info.IsDir() {
+		err = &fs.PathError{Op: "stat", Path: kernelModulesDir, Err: syscall.ENOTDIR}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read installed kernels list (%s):\n%w", kernelModulesDirErrorHint(rootfs, err),
+			err)
+	}
+
+	return kernelModulesDir, nil
+}
+
+// getFilteredKernelStringVersionsInDir returns the names of the sub-directories of 'modulesDir' that 'filter' keeps.
+func getFilteredKernelStringVersionsInDir(modulesDir string, filter KernelDirFilter) ([]string, error) {
+	return getFilteredKernelStringVersionsInDirWithRetries(modulesDir, filter, DefaultKernelDirReadAttempts, 0)
+}
+
+// getFilteredKernelStringVersionsInDirWithRetries is the same as getFilteredKernelStringVersionsInDir, but makes up to
+// 'readAttempts' attempts to read 'modulesDir' (see readDirWithRetries).
+func getFilteredKernelStringVersionsInDirWithRetries(modulesDir string, filter KernelDirFilter, readAttempts int,
+	readRetryDelay time.Duration,
+) ([]string, error) {
+	kernels, err := readDirWithRetries(kernelModulesFS, modulesDir, readAttempts, readRetryDelay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read installed kernels list (%s):\n%w", modulesDir, err)
+	}
+
+	versions := []string(nil)
+	for _, kernel := range kernels {
+		if isKernelBackupDirName(kernel.Name()) {
+			logger.Log.Debugf("Skipping package manager backup kernel directory (%s)", kernel.Name())
+			continue
+		}
+
+		keep, err := filter(filepath.Join(modulesDir, kernel.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read installed kernel (%s) module directory:\n%w", kernel.Name(), err)
+		}
+
+		if keep {
+			versions = append(versions, kernel.Name())
+		}
+	}
+
+	return versions, nil
+}
+
+// GetKernelBackupDirs returns the names of the directories under the kernel modules directory of 'rootfs' that a
+// package manager left behind as backups (e.g. "6.6.47.1-1.azl3.rpmmoved"). These are never listed as installed
+// kernels, but may be useful when investigating a failed package upgrade.
+func GetKernelBackupDirs(rootfs string) ([]string, error) {
+	kernelModulesDir, err := resolveKernelModulesDir(rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := readDirWithRetries(kernelModulesFS, kernelModulesDir, DefaultKernelDirReadAttempts, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel modules directory (%s):\n%w", kernelModulesDir, err)
+	}
+
+	backupDirs := []string(nil)
+	for _, entry := range entries {
+		if entry.IsDir() && isKernelBackupDirName(entry.Name()) {
+			backupDirs = append(backupDirs, entry.Name())
+		}
+	}
+
+	return backupDirs, nil
+}
+
+// isKernelBackupDirName returns true if 'name' is the name of a directory that a package manager moved out of the way.
+func isKernelBackupDirName(name string) bool {
+	for _, suffix := range kernelBackupDirSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// kernelModulesDirErrorHint returns a remediation hint for a failure to read the kernel modules directory.
+func kernelModulesDirErrorHint(rootfs string, err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Sprintf("directory doesn't exist, check that (%s) is the root directory of an OS image", rootfs)
+
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied, try running as root"
+
+	case errors.Is(err, syscall.ENOTDIR):
+		return fmt.Sprintf("not a directory, check that (%s) is a directory and not an image or archive file", rootfs)
+
+	default:
+		return "unexpected error"
+	}
+}
+
+// GetInstalledKernelVersions returns the versions of the kernels installed under 'rootfs'.
+//
+// By default, empty kernel directories are skipped and the first kernel directory whose name can't be parsed fails
+// the call. Pass options (e.g. WithSkipUnparseable) to change this.
+func GetInstalledKernelVersions(rootfs string, opts ...InstalledKernelsOption) ([]*versioncompare.TolerantVersion,
+	error,
+) {
+	kernelModulesDir, err := resolveKernelModulesDir(rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetInstalledKernelVersionsInDir(kernelModulesDir, opts...)
+}
+
+// GetInstalledKernelVersionsInDir returns the versions of the kernels in 'modulesDir', which is a kernel modules
+// directory (i.e. the equivalent of /lib/modules) that may be anywhere on the build host. It accepts the same options
+// as GetInstalledKernelVersions. Unlike GetInstalledKernelVersions, symlinks aren't resolved within a rootfs.
+func GetInstalledKernelVersionsInDir(modulesDir string, opts ...InstalledKernelsOption,
+) ([]*versioncompare.TolerantVersion, error) {
+	options := newInstalledKernelsOptions(opts)
+
+	stringVersions, err := getFilteredKernelStringVersionsInDirWithRetries(modulesDir, options.kernelDirFilter(),
+		options.readAttempts, options.readRetryDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	if !options.skipUnparseable {
+		return parseKernelVersions(stringVersions)
+	}
+
+	versions := []*versioncompare.TolerantVersion(nil)
+	for _, stringVersion := range stringVersions {
+		version, err := parseKernelVersion(stringVersion)
+		if err != nil {
+			logger.Log.Warnf("Skipping kernel directory (%s): %s", stringVersion, err)
+			continue
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// parseKernelVersions parses each of the kernel release strings in 'stringVersions'.
+func parseKernelVersions(stringVersions []string) ([]*versioncompare.TolerantVersion, error) {
+	versions := make([]*versioncompare.TolerantVersion, len(stringVersions))
+	for i, stringVersion := range stringVersions {
+		var err error
+		versions[i], err = parseKernelVersion(stringVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return versions, nil
+}
+
+// MatchInstalledKernels returns the versions of the kernels installed under 'rootfs' whose full release string matches
+// the glob 'pattern' (e.g. "6.6.*" or "*.azl3"). The pattern is matched against the kernel's module directory name,
+// which is the same string that 'uname -r' reports. So, unlike a version constraint, the pattern can select on the
+// kernel's flavor (e.g. "*-rt"). The pattern syntax is the same as path.Match.
+func MatchInstalledKernels(rootfs string, pattern string) ([]*versioncompare.TolerantVersion, error) {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid kernel pattern (%s):\n%w", pattern, err)
+	}
+
+	patternFilter := func(kernelDir string) (bool, error) {
+		return path.Match(pattern, filepath.Base(kernelDir))
+	}
+
+	stringVersions, err := GetFilteredKernelStringVersions(rootfs,
+		AllKernelDirFilters(NonEmptyKernelDirFilter, patternFilter))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKernelVersions(stringVersions)
+}
+
+// ResolvePathInRootfs returns the host path of 'path' within 'rootfs', following symlinks as if 'rootfs' were the root
+// directory.
+//
+// On usr-merged systems, /lib is a symlink to /usr/lib. When the symlink is absolute, naively following it from within
+// an image's rootfs would read the build host's /usr/lib instead of the image's. When 'rootfs' is "/", this resolves
+// the same way as the OS does.
+//
+// Path components that don't exist are kept as-is, so that the caller's subsequent file operation reports the error.
+func ResolvePathInRootfs(rootfs string, path string) (string, error) {
+	const maxSymlinks = 40
+
+	resolved := "/"
+	remaining := strings.Split(path, "/")
+	symlinkCount := 0
+
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+
+		switch component {
+		case "", ".":
+			continue
+
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, component)
+
+		info, err := os.Lstat(filepath.Join(rootfs, next))
+		if os.IsNotExist(err) {
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		symlinkCount++
+		if symlinkCount > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links while resolving (%s)", path)
+		}
+
+		target, err := os.Readlink(filepath.Join(rootfs, next))
+		if err != nil {
+			return "", err
+		}
+
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+
+	return filepath.Join(rootfs, resolved), nil
+}
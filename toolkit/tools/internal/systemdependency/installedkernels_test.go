@@ -0,0 +1,355 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetInstalledKernelStringVersions(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "5.15.153.1-2.cm2", "", "vmlinuz")
+
+	versions, err := GetInstalledKernelStringVersions(rootfs)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"6.6.47.1-1.azl3", "5.15.153.1-2.cm2"}, versions)
+}
+
+func TestGetInstalledKernelStringVersionsSkipsEmptyDirs(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	// An uninstalled kernel can leave an empty directory behind.
+	err := os.MkdirAll(filepath.Join(rootfs, KernelModulesDir, "5.15.153.1-2.cm2"), os.ModePerm)
+	assert.NoError(t, err)
+
+	versions, err := GetInstalledKernelStringVersions(rootfs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, versions)
+}
+
+func TestGetInstalledKernelStringVersionsSkipsBackupDirs(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.43.1-1.azl3.rpmmoved", "", "vmlinuz")
+	createTestKernel(t, rootfs, "5.15.153.1-2.cm2.dpkg-old", "", "vmlinuz")
+
+	versions, err := GetInstalledKernelStringVersions(rootfs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, versions)
+
+	kernels, err := GetInstalledKernelVersions(rootfs)
+	assert.NoError(t, err)
+	if assert.Len(t, kernels, 1) {
+		assert.Equal(t, "6.6.47.1-1.azl3", kernels[0].String())
+	}
+}
+
+func TestGetKernelBackupDirs(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.43.1-1.azl3.rpmmoved", "", "vmlinuz")
+	createTestKernel(t, rootfs, "5.15.153.1-2.cm2.dpkg-old", "")
+
+	// A file with a backup suffix isn't a backup directory.
+	err := os.WriteFile(filepath.Join(rootfs, KernelModulesDir, "modules.rpmmoved"), nil, 0o644)
+	assert.NoError(t, err)
+
+	backupDirs, err := GetKernelBackupDirs(rootfs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5.15.153.1-2.cm2.dpkg-old", "6.6.43.1-1.azl3.rpmmoved"}, backupDirs)
+}
+
+func TestGetKernelBackupDirsNone(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	backupDirs, err := GetKernelBackupDirs(rootfs)
+	assert.NoError(t, err)
+	assert.Empty(t, backupDirs)
+}
+
+func TestGetInstalledKernelStringVersionsMissingModulesDir(t *testing.T) {
+	_, err := GetInstalledKernelStringVersions(t.TempDir())
+	assert.ErrorContains(t, err, "failed to read installed kernels list")
+}
+
+func TestGetInstalledKernelStringVersionsMissingModulesDirHint(t *testing.T) {
+	rootfs := t.TempDir()
+
+	_, err := GetInstalledKernelStringVersions(rootfs)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorContains(t, err, fmt.Sprintf("directory doesn't exist, check that (%s) is the root directory", rootfs))
+}
+
+func TestGetInstalledKernelStringVersionsRootfsIsFileHint(t *testing.T) {
+	rootfs := filepath.Join(t.TempDir(), "image.raw")
+	err := os.WriteFile(rootfs, nil, 0o644)
+	assert.NoError(t, err)
+
+	_, err = GetInstalledKernelStringVersions(rootfs)
+	assert.ErrorIs(t, err, syscall.ENOTDIR)
+	assert.ErrorContains(t, err, "not a directory, check that")
+}
+
+func TestGetInstalledKernelStringVersionsModulesDirIsFileHint(t *testing.T) {
+	rootfs := t.TempDir()
+	err := os.MkdirAll(filepath.Join(rootfs, "lib"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(rootfs, KernelModulesDir), nil, 0o644)
+	assert.NoError(t, err)
+
+	_, err = GetInstalledKernelStringVersions(rootfs)
+	assert.ErrorIs(t, err, syscall.ENOTDIR)
+	assert.ErrorContains(t, err, "not a directory")
+}
+
+func TestKernelModulesDirErrorHint(t *testing.T) {
+	permissionErr := &fs.PathError{Op: "open", Path: "/rootfs/lib/modules", Err: fs.ErrPermission}
+	assert.Equal(t, "permission denied, try running as root", kernelModulesDirErrorHint("/rootfs", permissionErr))
+
+	notExistErr := &fs.PathError{Op: "open", Path: "/rootfs/lib/modules", Err: syscall.ENOENT}
+	assert.Contains(t, kernelModulesDirErrorHint("/rootfs", notExistErr), "directory doesn't exist")
+
+	otherErr := &fs.PathError{Op: "open", Path: "/rootfs/lib/modules", Err: syscall.EIO}
+	assert.Equal(t, "unexpected error", kernelModulesDirErrorHint("/rootfs", otherErr))
+}
+
+func TestGetInstalledKernelVersions(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	versions, err := GetInstalledKernelVersions(rootfs)
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 1) {
+		assert.Equal(t, "6.6.47.1-1.azl3", versions[0].String())
+	}
+}
+
+func TestGetInstalledKernelVersionsInvalidVersion(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "not-a-kernel", "", "vmlinuz")
+
+	_, err := GetInstalledKernelVersions(rootfs)
+	assert.ErrorContains(t, err, "failed to parse kernel version (not-a-kernel)")
+}
+
+func TestGetInstalledKernelVersionsInDir(t *testing.T) {
+	// The modules directory doesn't need to be within a rootfs.
+	modulesDir := t.TempDir()
+	for _, version := range []string{"6.6.47.1-1.azl3", "5.15.153.1-2.cm2"} {
+		err := os.MkdirAll(filepath.Join(modulesDir, version), os.ModePerm)
+		assert.NoError(t, err)
+		err = os.WriteFile(filepath.Join(modulesDir, version, "vmlinuz"), nil, 0o644)
+		assert.NoError(t, err)
+	}
+
+	err := os.MkdirAll(filepath.Join(modulesDir, "6.1.0"), os.ModePerm)
+	assert.NoError(t, err)
+
+	versions, err := GetInstalledKernelVersionsInDir(modulesDir)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"6.6.47.1-1.azl3", "5.15.153.1-2.cm2"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsInDirMissing(t *testing.T) {
+	modulesDir := filepath.Join(t.TempDir(), "modules")
+
+	_, err := GetInstalledKernelVersionsInDir(modulesDir)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorContains(t, err, fmt.Sprintf("failed to read installed kernels list (%s)", modulesDir))
+}
+
+func TestGetInstalledKernelVersionsMissingModulesDirHint(t *testing.T) {
+	rootfs := t.TempDir()
+
+	_, err := GetInstalledKernelVersions(rootfs)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorContains(t, err, fmt.Sprintf("directory doesn't exist, check that (%s) is the root directory", rootfs))
+}
+
+func TestMatchInstalledKernels(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.44.1-1.azl3-rt", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.1.0", "", "vmlinuz")
+	createTestKernel(t, rootfs, "5.15.153.1-2.cm2", "", "vmlinuz")
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"*", []string{"5.15.153.1-2.cm2", "6.1.0", "6.6.44.1-1.azl3-rt", "6.6.47.1-1.azl3"}},
+		{"6.6.*", []string{"6.6.44.1-1.azl3-rt", "6.6.47.1-1.azl3"}},
+		{"*.azl3", []string{"6.6.47.1-1.azl3"}},
+		{"*-azl3", []string{}},
+		{"*-rt", []string{"6.6.44.1-1.azl3-rt"}},
+		{"6.?.*", []string{"6.1.0", "6.6.44.1-1.azl3-rt", "6.6.47.1-1.azl3"}},
+		{"[56].1*", []string{"5.15.153.1-2.cm2", "6.1.0"}},
+		{"6.6.47.1-1.azl3", []string{"6.6.47.1-1.azl3"}},
+		{"7.*", []string{}},
+	}
+
+	for _, test := range tests {
+		versions, err := MatchInstalledKernels(rootfs, test.pattern)
+		if assert.NoError(t, err, test.pattern) {
+			strVersions := []string{}
+			for _, version := range versions {
+				strVersions = append(strVersions, version.String())
+			}
+			assert.ElementsMatch(t, test.expected, strVersions, test.pattern)
+		}
+	}
+}
+
+func TestMatchInstalledKernelsSkipsEmptyDirs(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "")
+
+	versions, err := MatchInstalledKernels(rootfs, "6.6.*")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestMatchInstalledKernelsInvalidPattern(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	_, err := MatchInstalledKernels(rootfs, "6.[6")
+	assert.ErrorContains(t, err, "invalid kernel pattern (6.[6)")
+}
+
+func TestGetFilteredKernelStringVersionsCustomFilter(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3+debug", "", "vmlinuz")
+	err := os.MkdirAll(filepath.Join(rootfs, KernelModulesDir, "5.15.153.1-2.cm2"), os.ModePerm)
+	assert.NoError(t, err)
+
+	skipDebug := func(path string) (bool, error) {
+		return !strings.HasSuffix(path, "+debug"), nil
+	}
+
+	// Replace the default filter.
+	versions, err := GetFilteredKernelStringVersions(rootfs, skipDebug)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5.15.153.1-2.cm2", "6.6.47.1-1.azl3"}, versions)
+
+	// Extend the default filter.
+	versions, err = GetFilteredKernelStringVersions(rootfs, AllKernelDirFilters(NonEmptyKernelDirFilter, skipDebug))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, versions)
+}
+
+func TestGetFilteredKernelStringVersionsFilterError(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	failFilter := func(path string) (bool, error) {
+		return false, fmt.Errorf("filter failure")
+	}
+
+	_, err := GetFilteredKernelStringVersions(rootfs, failFilter)
+	assert.ErrorContains(t, err, "failed to read installed kernel (6.6.47.1-1.azl3) module directory")
+	assert.ErrorContains(t, err, "filter failure")
+}
+
+func TestNonEmptyKernelDirFilter(t *testing.T) {
+	rootfs := t.TempDir()
+	kernelDir := createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "")
+
+	keep, err := NonEmptyKernelDirFilter(kernelDir)
+	assert.NoError(t, err)
+	assert.False(t, keep)
+
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	keep, err = NonEmptyKernelDirFilter(kernelDir)
+	assert.NoError(t, err)
+	assert.True(t, keep)
+}
+
+// createUsrMergedTestRootfs creates a rootfs where /lib is a symlink to /usr/lib.
+func createUsrMergedTestRootfs(t *testing.T, libSymlinkTarget string) string {
+	rootfs := t.TempDir()
+
+	kernelDir := filepath.Join(rootfs, "usr/lib/modules/6.6.47.1-1.azl3")
+	err := os.MkdirAll(kernelDir, os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(kernelDir, "modules.dep"), nil, 0o644)
+	assert.NoError(t, err)
+
+	err = os.Symlink(libSymlinkTarget, filepath.Join(rootfs, "lib"))
+	assert.NoError(t, err)
+
+	return rootfs
+}
+
+func TestGetInstalledKernelStringVersionsUsrMergeRelativeSymlink(t *testing.T) {
+	rootfs := createUsrMergedTestRootfs(t, "usr/lib")
+
+	versions, err := GetInstalledKernelStringVersions(rootfs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, versions)
+}
+
+func TestGetInstalledKernelStringVersionsUsrMergeAbsoluteSymlink(t *testing.T) {
+	// The absolute symlink must be resolved within the rootfs, not against the build host's /usr/lib.
+	rootfs := createUsrMergedTestRootfs(t, "/usr/lib")
+
+	versions, err := GetInstalledKernelStringVersions(rootfs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, versions)
+}
+
+func TestResolvePathInRootfs(t *testing.T) {
+	rootfs := createUsrMergedTestRootfs(t, "/usr/lib")
+
+	resolved, err := ResolvePathInRootfs(rootfs, KernelModulesDir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(rootfs, "usr/lib/modules"), resolved)
+
+	// Symlinks can't escape the rootfs using "..".
+	err = os.Symlink("../../../../..", filepath.Join(rootfs, "escape"))
+	assert.NoError(t, err)
+
+	resolved, err = ResolvePathInRootfs(rootfs, "/escape/lib/modules")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(rootfs, "usr/lib/modules"), resolved)
+
+	// Missing components are kept as-is.
+	resolved, err = ResolvePathInRootfs(rootfs, "/missing/dir")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(rootfs, "missing/dir"), resolved)
+}
+
+func TestResolvePathInRootfsSymlinkLoop(t *testing.T) {
+	rootfs := t.TempDir()
+	err := os.Symlink("/b", filepath.Join(rootfs, "a"))
+	assert.NoError(t, err)
+	err = os.Symlink("/a", filepath.Join(rootfs, "b"))
+	assert.NoError(t, err)
+
+	_, err = ResolvePathInRootfs(rootfs, "/a/modules")
+	assert.ErrorContains(t, err, "too many levels of symbolic links")
+}
+
+func TestResolvePathInRootfsHostRoot(t *testing.T) {
+	resolved, err := ResolvePathInRootfs("/", "/usr/bin")
+	assert.NoError(t, err)
+
+	expected, err := filepath.EvalSymlinks("/usr/bin")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, resolved)
+}
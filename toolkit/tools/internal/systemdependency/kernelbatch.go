@@ -0,0 +1,88 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// KernelVersionsResult is the outcome of enumerating the installed kernels of a single rootfs.
+type KernelVersionsResult struct {
+	Rootfs   string
+	Versions []*versioncompare.TolerantVersion
+	// Set if the kernels of this rootfs could not be enumerated.
+	Err error
+}
+
+// batchScanKernelVersions enumerates the kernels of a single rootfs. It is a variable so that tests can replace it.
+var batchScanKernelVersions = func(rootfs string) ([]*versioncompare.TolerantVersion, error) {
+	return GetInstalledKernelVersions(rootfs)
+}
+
+// GetInstalledKernelVersionsBatch enumerates the installed kernels of each rootfs in 'rootfsList' using up to 'workers'
+// concurrent goroutines. A failure to enumerate one rootfs is recorded in its result and doesn't stop the others.
+//
+// If 'ctx' is cancelled, no new rootfs is started and the results that were already computed are returned (in input
+// order) along with an error wrapping the context's error.
+func GetInstalledKernelVersionsBatch(ctx context.Context, rootfsList []string, workers int,
+) ([]KernelVersionsResult, error) {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	results := make([]KernelVersionsResult, len(rootfsList))
+	completed := make([]bool, len(rootfsList))
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+
+				versions, err := batchScanKernelVersions(rootfsList[i])
+				results[i] = KernelVersionsResult{
+					Rootfs:   rootfsList[i],
+					Versions: versions,
+					Err:      err,
+				}
+				completed[i] = true
+			}
+		}()
+	}
+
+feedLoop:
+	for i := range rootfsList {
+		select {
+		case <-ctx.Done():
+			break feedLoop
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	completedResults := make([]KernelVersionsResult, 0, len(results))
+	for i, result := range results {
+		if completed[i] {
+			completedResults = append(completedResults, result)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return completedResults, fmt.Errorf("kernel enumeration was cancelled after (%d) of (%d) rootfs:\n%w",
+			len(completedResults), len(rootfsList), ctx.Err())
+	}
+
+	return completedResults, nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"context"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetInstalledKernelVersionsBatch(t *testing.T) {
+	rootfsA := t.TempDir()
+	createTestKernel(t, rootfsA, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	rootfsB := t.TempDir()
+	createTestKernel(t, rootfsB, "5.15.153.1-2.cm2", "", "vmlinuz")
+
+	missingRootfs := t.TempDir()
+
+	results, err := GetInstalledKernelVersionsBatch(context.Background(),
+		[]string{rootfsA, missingRootfs, rootfsB}, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, rootfsA, results[0].Rootfs)
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, "6.6.47.1-1.azl3", results[0].Versions[0].String())
+
+		assert.Equal(t, missingRootfs, results[1].Rootfs)
+		assert.ErrorContains(t, results[1].Err, "failed to read installed kernels list")
+
+		assert.Equal(t, rootfsB, results[2].Rootfs)
+		assert.NoError(t, results[2].Err)
+		assert.Equal(t, "5.15.153.1-2.cm2", results[2].Versions[0].String())
+	}
+}
+
+func TestGetInstalledKernelVersionsBatchCancelledMidScan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancel the context while the second rootfs is being scanned.
+	scanned := []string(nil)
+	originalScan := batchScanKernelVersions
+	batchScanKernelVersions = func(rootfs string) ([]*versioncompare.TolerantVersion, error) {
+		scanned = append(scanned, rootfs)
+		if len(scanned) == 2 {
+			cancel()
+		}
+		return []*versioncompare.TolerantVersion{versioncompare.New("6.6.47.1-1.azl3")}, nil
+	}
+	t.Cleanup(func() {
+		batchScanKernelVersions = originalScan
+	})
+
+	results, err := GetInstalledKernelVersionsBatch(ctx, []string{"/a", "/b", "/c", "/d", "/e"}, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "cancelled after (2) of (5) rootfs")
+
+	// The results that were computed before the cancellation are kept.
+	assert.Equal(t, []string{"/a", "/b"}, scanned)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "/a", results[0].Rootfs)
+		assert.Equal(t, "/b", results[1].Rootfs)
+	}
+}
+
+func TestGetInstalledKernelVersionsBatchAlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := GetInstalledKernelVersionsBatch(ctx, []string{t.TempDir()}, 4)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, results)
+}
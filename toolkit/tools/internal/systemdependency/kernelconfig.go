@@ -0,0 +1,166 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// KernelBootDir is the directory, relative to a rootfs, that holds the kernel binaries and their build configs.
+	KernelBootDir = "/boot"
+
+	kernelConfigFilePrefix = "config-"
+
+	// KernelConfigBuiltIn is the value of a kernel config option that is built into the kernel.
+	KernelConfigBuiltIn = "y"
+	// KernelConfigModule is the value of a kernel config option that is built as a loadable module.
+	KernelConfigModule = "m"
+	// KernelConfigNotSet is the value used for options that are explicitly disabled ("# CONFIG_X is not set").
+	KernelConfigNotSet = "n"
+
+	kernelConfigLockdownLsm = "CONFIG_SECURITY_LOCKDOWN_LSM"
+)
+
+// kernelConfigCgroupV2Options are the options that a kernel needs to provide a usable cgroup v2 hierarchy. The unified
+// (v2) hierarchy is always available when CONFIG_CGROUPS is set. But, under cgroup v2, device access control is
+// implemented with BPF programs. So, without CONFIG_CGROUP_BPF, systemd and container runtimes can't restrict devices.
+var kernelConfigCgroupV2Options = []string{
+	"CONFIG_CGROUPS",
+	"CONFIG_CGROUP_BPF",
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// GetKernelConfig returns the build config of the kernel 'version' installed under 'rootfs', read from
+// /boot/config-<ver>. Both plain and gzip compressed (like /proc/config.gz) files are supported, including a
+// /boot/config-<ver>.gz file.
+//
+// The map's keys are the option names (e.g. "CONFIG_SECURITY_LOCKDOWN_LSM"). String values have their quotes removed.
+// Options that are explicitly disabled have the value KernelConfigNotSet.
+//
+// If the kernel doesn't have a config file, a nil map is returned without an error. Lookups on the nil map behave the
+// same as for a kernel that doesn't enable any options.
+func GetKernelConfig(rootfs string, version string) (map[string]string, error) {
+	configPath := filepath.Join(rootfs, KernelBootDir, kernelConfigFilePrefix+version)
+
+	configBytes, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		configPath += ".gz"
+		configBytes, err = os.ReadFile(configPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel config file (%s):\n%w", configPath, err)
+	}
+
+	var reader io.Reader = bytes.NewReader(configBytes)
+	if bytes.HasPrefix(configBytes, gzipMagic) {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress kernel config file (%s):\n%w", configPath, err)
+		}
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	}
+
+	config, err := parseKernelConfig(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel config file (%s):\n%w", configPath, err)
+	}
+
+	return config, nil
+}
+
+// parseKernelConfig parses a kernel build config in the Kconfig format.
+func parseKernelConfig(reader io.Reader) (map[string]string, error) {
+	config := make(map[string]string)
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Disabled options have the format: # CONFIG_X is not set
+		if disabled, found := strings.CutPrefix(line, "# "); found {
+			key, found := strings.CutSuffix(disabled, " is not set")
+			if found && strings.HasPrefix(key, "CONFIG_") {
+				config[key] = KernelConfigNotSet
+			}
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid kernel config line (%s)", line)
+		}
+
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+
+		config[key] = value
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// KernelConfigEnabled returns true if the option 'key' is built into the kernel (i.e. CONFIG_X=y). Options built as
+// modules (CONFIG_X=m) are not considered enabled, since they may not be available early in boot.
+func KernelConfigEnabled(config map[string]string, key string) bool {
+	return config[key] == KernelConfigBuiltIn
+}
+
+// KernelSupportsLockdown returns true if the kernel 'version' installed under 'rootfs' was built with the lockdown LSM,
+// which is required to enforce kernel lockdown when Secure Boot is enabled.
+//
+// This is determined from the kernel's build config (/boot/config-<ver>). If the kernel doesn't have a build config
+// file, then false is returned without an error.
+func KernelSupportsLockdown(rootfs string, version string) (bool, error) {
+	config, err := GetKernelConfig(rootfs, version)
+	if err != nil {
+		return false, err
+	}
+
+	return KernelConfigEnabled(config, kernelConfigLockdownLsm), nil
+}
+
+// KernelSupportsCgroupV2 returns true if the kernel 'version' installed under 'rootfs' was built with the options
+// needed to provide cgroup v2 (i.e. the unified cgroup hierarchy).
+//
+// This is determined from the kernel's build config (/boot/config-<ver>). If the kernel doesn't have a build config
+// file, then false is returned without an error.
+func KernelSupportsCgroupV2(rootfs string, version string) (bool, error) {
+	config, err := GetKernelConfig(rootfs, version)
+	if err != nil {
+		return false, err
+	}
+
+	for _, option := range kernelConfigCgroupV2Options {
+		if !KernelConfigEnabled(config, option) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
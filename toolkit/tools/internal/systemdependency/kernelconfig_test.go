@@ -0,0 +1,173 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKernelConfigLockdown = `#
+# Automatically generated file; DO NOT EDIT.
+# Linux/x86 6.6.47.1 Kernel Configuration
+#
+CONFIG_SECURITY=y
+CONFIG_SECURITY_LOCKDOWN_LSM=y
+CONFIG_SECURITY_LOCKDOWN_LSM_EARLY=y
+CONFIG_LSM="lockdown,yama,integrity,selinux,bpf"
+`
+
+const testKernelConfigNoLockdown = `CONFIG_SECURITY=y
+# CONFIG_SECURITY_LOCKDOWN_LSM is not set
+CONFIG_LSM="yama,integrity,selinux,bpf"
+`
+
+const testKernelConfigCgroupV2 = `CONFIG_CGROUPS=y
+CONFIG_CGROUP_BPF=y
+CONFIG_MEMCG=y
+`
+
+const testKernelConfigNoCgroupBpf = `CONFIG_CGROUPS=y
+# CONFIG_CGROUP_BPF is not set
+CONFIG_MEMCG=y
+`
+
+// createTestKernelConfig writes a /boot/config-<ver> file under 'rootfs'.
+func createTestKernelConfig(t *testing.T, rootfs string, version string, config string) {
+	bootDir := filepath.Join(rootfs, KernelBootDir)
+	err := os.MkdirAll(bootDir, os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(bootDir, kernelConfigFilePrefix+version), []byte(config), 0o644)
+	assert.NoError(t, err)
+}
+
+func TestKernelSupportsLockdown(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernelConfig(t, rootfs, testKernelVersion, testKernelConfigLockdown)
+
+	supported, err := KernelSupportsLockdown(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.True(t, supported)
+}
+
+func TestKernelSupportsLockdownNotSet(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernelConfig(t, rootfs, testKernelVersion, testKernelConfigNoLockdown)
+
+	supported, err := KernelSupportsLockdown(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.False(t, supported)
+}
+
+func TestKernelSupportsLockdownMissingConfig(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernelConfig(t, rootfs, "6.6.51.1-1.azl3", testKernelConfigLockdown)
+
+	supported, err := KernelSupportsLockdown(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.False(t, supported)
+}
+
+func TestKernelSupportsCgroupV2(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernelConfig(t, rootfs, testKernelVersion, testKernelConfigCgroupV2)
+
+	supported, err := KernelSupportsCgroupV2(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.True(t, supported)
+}
+
+func TestKernelSupportsCgroupV2MissingOption(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernelConfig(t, rootfs, testKernelVersion, testKernelConfigNoCgroupBpf)
+
+	supported, err := KernelSupportsCgroupV2(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.False(t, supported)
+
+	// Without cgroups at all.
+	createTestKernelConfig(t, rootfs, testKernelVersion, "# CONFIG_CGROUPS is not set\n")
+
+	supported, err = KernelSupportsCgroupV2(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.False(t, supported)
+}
+
+func TestKernelSupportsCgroupV2MissingConfig(t *testing.T) {
+	rootfs := t.TempDir()
+
+	supported, err := KernelSupportsCgroupV2(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.False(t, supported)
+}
+
+func TestGetKernelConfig(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernelConfig(t, rootfs, testKernelVersion, testKernelConfigLockdown+
+		"CONFIG_OVERLAY_FS=m\n"+
+		"# CONFIG_DM_VERITY is not set\n"+
+		"CONFIG_HZ=1000\n")
+
+	config, err := GetKernelConfig(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"CONFIG_SECURITY":                    "y",
+		"CONFIG_SECURITY_LOCKDOWN_LSM":       "y",
+		"CONFIG_SECURITY_LOCKDOWN_LSM_EARLY": "y",
+		"CONFIG_LSM":                         "lockdown,yama,integrity,selinux,bpf",
+		"CONFIG_OVERLAY_FS":                  "m",
+		"CONFIG_DM_VERITY":                   "n",
+		"CONFIG_HZ":                          "1000",
+	}, config)
+
+	assert.True(t, KernelConfigEnabled(config, "CONFIG_SECURITY_LOCKDOWN_LSM"))
+	assert.False(t, KernelConfigEnabled(config, "CONFIG_OVERLAY_FS"))
+	assert.False(t, KernelConfigEnabled(config, "CONFIG_DM_VERITY"))
+	assert.False(t, KernelConfigEnabled(config, "CONFIG_MISSING"))
+}
+
+func TestGetKernelConfigGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(testKernelConfigLockdown))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	// Compressed content with the plain file name.
+	rootfs := t.TempDir()
+	createTestKernelConfig(t, rootfs, testKernelVersion, compressed.String())
+
+	config, err := GetKernelConfig(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.True(t, KernelConfigEnabled(config, "CONFIG_SECURITY_LOCKDOWN_LSM"))
+
+	// Compressed content with a ".gz" file name.
+	rootfs = t.TempDir()
+	createTestKernelConfig(t, rootfs, testKernelVersion+".gz", compressed.String())
+
+	config, err = GetKernelConfig(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.True(t, KernelConfigEnabled(config, "CONFIG_SECURITY_LOCKDOWN_LSM"))
+}
+
+func TestGetKernelConfigMissing(t *testing.T) {
+	config, err := GetKernelConfig(t.TempDir(), testKernelVersion)
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+	assert.False(t, KernelConfigEnabled(config, "CONFIG_SECURITY_LOCKDOWN_LSM"))
+}
+
+func TestGetKernelConfigInvalidLine(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernelConfig(t, rootfs, testKernelVersion, "CONFIG_SECURITY\n")
+
+	_, err := GetKernelConfig(rootfs, testKernelVersion)
+	assert.ErrorContains(t, err, "invalid kernel config line (CONFIG_SECURITY)")
+}
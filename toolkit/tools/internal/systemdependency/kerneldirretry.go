@@ -0,0 +1,87 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/retry"
+)
+
+const (
+	// DefaultKernelDirReadAttempts is the number of times the kernel modules directory is read, if WithReadRetries isn't
+	// passed. That is, it isn't retried.
+	DefaultKernelDirReadAttempts = 1
+
+	kernelDirReadBackoffBase = 2.0
+)
+
+// retryableFsErrnos are the errors that a network-backed filesystem (e.g. NFS) may return transiently.
+var retryableFsErrnos = []syscall.Errno{
+	syscall.EIO,
+	syscall.ESTALE,
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.ETIMEDOUT,
+}
+
+// hostFS is an fs.FS that reads host paths (absolute or relative to the working directory) as-is. Unlike os.DirFS, its
+// errors are the same as those of the os package functions.
+type hostFS struct{}
+
+func (hostFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (hostFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// kernelModulesFS is the filesystem that the kernel modules directory is listed from. It is a variable so that tests
+// can simulate a flaky filesystem.
+var kernelModulesFS fs.FS = hostFS{}
+
+// isRetryableFsError returns true if 'err' may be a transient failure of the filesystem.
+func isRetryableFsError(err error) bool {
+	for _, errno := range retryableFsErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readDirWithRetries reads the directory 'name' of 'fsys', the same as fs.ReadDir, making up to 'attempts' attempts
+// with an exponential backoff starting at 'delay'. Only retryable errors (e.g. EIO or ESTALE) are retried. Other
+// errors (e.g. ENOENT) are returned immediately.
+func readDirWithRetries(fsys fs.FS, name string, attempts int, delay time.Duration) ([]fs.DirEntry, error) {
+	entries := []fs.DirEntry(nil)
+	readErr := error(nil)
+	failures := 0
+
+	_, err := retry.RunWithExpBackoff(context.Background(), func() error {
+		entries, readErr = fs.ReadDir(fsys, name)
+		if !isRetryableFsError(readErr) {
+			return nil
+		}
+
+		failures++
+		if failures < attempts {
+			logger.Log.Warnf("Retrying read of directory (%s) after transient error: %s", name, readErr)
+		}
+		return readErr
+	}, max(attempts, 1), delay, kernelDirReadBackoffBase)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, readErr
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyFS is a hostFS whose directory reads fail with 'err' the first 'failures' times.
+type flakyFS struct {
+	hostFS
+	failures int
+	err      error
+	reads    int
+}
+
+func (f *flakyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f.reads++
+	if f.reads <= f.failures {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: f.err}
+	}
+
+	return f.hostFS.ReadDir(name)
+}
+
+func setTestKernelModulesFS(t *testing.T, fsys fs.FS) {
+	original := kernelModulesFS
+	kernelModulesFS = fsys
+	t.Cleanup(func() { kernelModulesFS = original })
+}
+
+func TestGetInstalledKernelVersionsReadRetries(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, testModulesDep)
+
+	flaky := &flakyFS{failures: 1, err: syscall.ESTALE}
+	setTestKernelModulesFS(t, flaky)
+
+	versions, err := GetInstalledKernelVersions(rootfs, WithReadRetries(3, 0))
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 1) {
+		assert.Equal(t, testKernelVersion, versions[0].String())
+	}
+	assert.Equal(t, 2, flaky.reads)
+}
+
+func TestGetInstalledKernelVersionsNoReadRetriesByDefault(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, testModulesDep)
+
+	flaky := &flakyFS{failures: 1, err: syscall.EIO}
+	setTestKernelModulesFS(t, flaky)
+
+	_, err := GetInstalledKernelVersions(rootfs)
+	assert.ErrorIs(t, err, syscall.EIO)
+	assert.Equal(t, 1, flaky.reads)
+}
+
+func TestGetInstalledKernelVersionsReadRetriesExhausted(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, testModulesDep)
+
+	flaky := &flakyFS{failures: 5, err: syscall.EIO}
+	setTestKernelModulesFS(t, flaky)
+
+	_, err := GetInstalledKernelVersions(rootfs, WithReadRetries(3, 0))
+	assert.ErrorIs(t, err, syscall.EIO)
+	assert.Equal(t, 3, flaky.reads)
+}
+
+func TestReadDirWithRetriesNotRetryable(t *testing.T) {
+	flaky := &flakyFS{}
+
+	_, err := readDirWithRetries(flaky, filepath.Join(t.TempDir(), "missing"), 3, 0)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, 1, flaky.reads)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// kernelBootFileNames returns the names of the files in /boot that belong to kernel 'version'.
+func kernelBootFileNames(version string) []string {
+	return []string{
+		kernelBinaryFilePrefix + version,
+		// The FIPS HMAC of the kernel binary.
+		"." + kernelBinaryFilePrefix + version + ".hmac",
+		"initramfs-" + version + ".img",
+		"initrd.img-" + version,
+		"System.map-" + version,
+		kernelConfigFilePrefix + version,
+		kernelConfigFilePrefix + version + ".gz",
+	}
+}
+
+// KernelDiskUsage returns the number of bytes used by each kernel installed under 'rootfs', keyed by kernel version.
+// This is the size of the kernel's modules directory plus the size of its files in /boot (e.g. vmlinuz-<ver> and
+// initramfs-<ver>.img).
+//
+// Sizes are the apparent sizes of the regular files. Symlinks are counted as links and never followed. So, files
+// outside of a kernel's directory aren't counted.
+func KernelDiskUsage(rootfs string) (map[string]int64, error) {
+	kernelModulesDir, err := resolveKernelModulesDir(rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	kernels, err := getFilteredKernelStringVersionsInDir(kernelModulesDir, NonEmptyKernelDirFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]int64, len(kernels))
+	for _, kernel := range kernels {
+		modulesSize, err := getDirDiskUsage(filepath.Join(kernelModulesDir, kernel))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get kernel (%s) modules disk usage:\n%w", kernel, err)
+		}
+
+		bootSize, err := getKernelBootDiskUsage(rootfs, kernel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get kernel (%s) boot files disk usage:\n%w", kernel, err)
+		}
+
+		usage[kernel] = modulesSize + bootSize
+	}
+
+	return usage, nil
+}
+
+// getDirDiskUsage returns the total size of the regular files under 'dir'.
+func getDirDiskUsage(dir string) (int64, error) {
+	size := int64(0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// getKernelBootDiskUsage returns the total size of kernel 'version's regular files in /boot.
+func getKernelBootDiskUsage(rootfs string, version string) (int64, error) {
+	size := int64(0)
+	for _, name := range kernelBootFileNames(version) {
+		info, err := os.Lstat(filepath.Join(rootfs, KernelBootDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+
+	return size, nil
+}
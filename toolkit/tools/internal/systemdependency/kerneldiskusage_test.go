@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestSizedFile(t *testing.T, path string, size int) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(path, make([]byte, size), 0o644)
+	assert.NoError(t, err)
+}
+
+func TestKernelDiskUsage(t *testing.T) {
+	rootfs := t.TempDir()
+	customVersion := testKernelVersion + ".custom"
+
+	kernelDir := createTestKernel(t, rootfs, testKernelVersion, "")
+	createTestSizedFile(t, filepath.Join(kernelDir, modulesDepFileName), 10)
+	createTestSizedFile(t, filepath.Join(kernelDir, "kernel/fs/fuse/fuse.ko.xz"), 1000)
+	createTestSizedFile(t, filepath.Join(rootfs, KernelBootDir, "vmlinuz-"+testKernelVersion), 20000)
+	createTestSizedFile(t, filepath.Join(rootfs, KernelBootDir, "initramfs-"+testKernelVersion+".img"), 30000)
+	createTestSizedFile(t, filepath.Join(rootfs, KernelBootDir, "config-"+testKernelVersion), 200)
+
+	// Symlinks aren't followed, so the file outside of the kernel's directory isn't counted.
+	outsidePath := filepath.Join(t.TempDir(), "outside.ko")
+	createTestSizedFile(t, outsidePath, 500000)
+	err := os.Symlink(outsidePath, filepath.Join(kernelDir, "kernel/outside.ko"))
+	assert.NoError(t, err)
+
+	// The kernel whose version has the other kernel's version as a prefix doesn't share its files.
+	customKernelDir := createTestKernel(t, rootfs, customVersion, "")
+	createTestSizedFile(t, filepath.Join(customKernelDir, modulesDepFileName), 3)
+	createTestSizedFile(t, filepath.Join(rootfs, KernelBootDir, "vmlinuz-"+customVersion), 4000)
+
+	// Empty kernel directories aren't installed kernels.
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "")
+
+	usage, err := KernelDiskUsage(rootfs)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		testKernelVersion: 10 + 1000 + 20000 + 30000 + 200,
+		customVersion:     3 + 4000,
+	}, usage)
+}
+
+func TestKernelDiskUsageNoModulesDir(t *testing.T) {
+	_, err := KernelDiskUsage(t.TempDir())
+	assert.ErrorContains(t, err, "failed to read installed kernels list")
+}
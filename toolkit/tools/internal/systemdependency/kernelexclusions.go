@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// DefaultKernelExclusionFile is the default path, relative to a rootfs, of the file that lists kernels to ignore.
+const DefaultKernelExclusionFile = "/etc/kernel/excluded-versions"
+
+// ReadKernelExclusions reads the kernel versions listed in 'exclusionFile', a path relative to 'rootfs'. The file has
+// one version per line. Blank lines and lines starting with '#' are ignored.
+//
+// If the file doesn't exist, no exclusions are returned.
+func ReadKernelExclusions(rootfs string, exclusionFile string) ([]*versioncompare.TolerantVersion, error) {
+	exclusionPath := filepath.Join(rootfs, exclusionFile)
+
+	file, err := os.Open(exclusionPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open kernel exclusion file (%s):\n%w", exclusionPath, err)
+	}
+	defer file.Close()
+
+	exclusions := []*versioncompare.TolerantVersion(nil)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		exclusions = append(exclusions, versioncompare.New(line))
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel exclusion file (%s):\n%w", exclusionPath, err)
+	}
+
+	return exclusions, nil
+}
+
+// ExcludeKernelVersions returns the versions that don't match any of the exclusions. Versions are matched using
+// TolerantVersion.Compare. So, an exclusion without a release (e.g. "6.6.47.1") matches every release of that version.
+func ExcludeKernelVersions(versions []*versioncompare.TolerantVersion, exclusions []*versioncompare.TolerantVersion,
+) []*versioncompare.TolerantVersion {
+	kept := []*versioncompare.TolerantVersion(nil)
+	for _, version := range versions {
+		excluded := false
+		for _, exclusion := range exclusions {
+			if version.Compare(exclusion) == versioncompare.EqualTo {
+				excluded = true
+				break
+			}
+		}
+
+		if !excluded {
+			kept = append(kept, version)
+		}
+	}
+
+	return kept
+}
+
+// GetInstalledKernelVersionsWithExclusions is the same as GetInstalledKernelVersions but omits the kernels listed in
+// 'exclusionFile' (e.g. DefaultKernelExclusionFile), a path relative to 'rootfs'.
+func GetInstalledKernelVersionsWithExclusions(rootfs string, exclusionFile string,
+) ([]*versioncompare.TolerantVersion, error) {
+	versions, err := GetInstalledKernelVersions(rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions, err := ReadKernelExclusions(rootfs, exclusionFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return ExcludeKernelVersions(versions, exclusions), nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestKernelExclusionFile(t *testing.T, rootfs string, exclusionFile string, content string) {
+	exclusionPath := filepath.Join(rootfs, exclusionFile)
+	err := os.MkdirAll(filepath.Dir(exclusionPath), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(exclusionPath, []byte(content), 0o644)
+	assert.NoError(t, err)
+}
+
+func TestGetInstalledKernelVersionsWithExclusions(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.57.1-1.azl3", "", "vmlinuz")
+	createTestKernelExclusionFile(t, rootfs, DefaultKernelExclusionFile,
+		"# Staging kernel that doesn't boot on gen1 VMs.\n\n6.6.51.1-1.azl3\n")
+
+	versions, err := GetInstalledKernelVersionsWithExclusions(rootfs, DefaultKernelExclusionFile)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"6.6.47.1-1.azl3", "6.6.57.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsWithExclusionsMatchesEquivalentVersions(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.47.1-2.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "", "vmlinuz")
+
+	// An exclusion without a release matches every release.
+	createTestKernelExclusionFile(t, rootfs, "custom/exclusions", "0:6.6.47.1\n")
+
+	versions, err := GetInstalledKernelVersionsWithExclusions(rootfs, "custom/exclusions")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsWithExclusionsMissingFile(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	versions, err := GetInstalledKernelVersionsWithExclusions(rootfs, DefaultKernelExclusionFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestReadKernelExclusionsUnreadable(t *testing.T) {
+	rootfs := t.TempDir()
+
+	// A directory can't be read as a file.
+	err := os.MkdirAll(filepath.Join(rootfs, DefaultKernelExclusionFile), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, err = ReadKernelExclusions(rootfs, DefaultKernelExclusionFile)
+	assert.ErrorContains(t, err, "failed to read kernel exclusion file")
+}
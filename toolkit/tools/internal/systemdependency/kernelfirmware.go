@@ -0,0 +1,124 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+)
+
+const (
+	// KernelFirmwareDir is the directory, relative to a rootfs, that the kernel loads firmware blobs from.
+	KernelFirmwareDir = "/lib/firmware"
+)
+
+var (
+	// Each firmware blob the module may request has a "firmware=<path>" modinfo entry.
+	modinfoFirmwareTag = []byte("firmware=")
+
+	// The kernel can load firmware that has been compressed with these extensions.
+	firmwareFileExtensions = []string{"", ".xz", ".zst"}
+)
+
+// GetKernelFirmwareRequirements returns the firmware blobs that the modules of kernel 'version' under 'rootfs' declare
+// that they may load. The paths are relative to /lib/firmware.
+//
+// This is best-effort. Firmware declarations are found by scanning the module files for their "firmware=" modinfo
+// entries. Modules that are compressed with an unsupported format (e.g. zstd) are skipped with a warning. And drivers
+// may also request firmware that they don't declare.
+func GetKernelFirmwareRequirements(rootfs, version string) ([]string, error) {
+	kernelDir := filepath.Join(rootfs, KernelModulesDir, version)
+
+	firmwareSet := make(map[string]bool)
+	err := filepath.WalkDir(kernelDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !isModuleFile(d.Name()) {
+			return nil
+		}
+
+		moduleFirmware, err := readModuleFirmware(path)
+		if err != nil {
+			logger.Log.Warnf("Skipping firmware scan of module (%s): %s", path, err)
+			return nil
+		}
+
+		for _, firmware := range moduleFirmware {
+			firmwareSet[firmware] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan kernel (%s) modules for firmware:\n%w", version, err)
+	}
+
+	firmwareList := make([]string, 0, len(firmwareSet))
+	for firmware := range firmwareSet {
+		firmwareList = append(firmwareList, firmware)
+	}
+	sort.Strings(firmwareList)
+
+	return firmwareList, nil
+}
+
+// GetMissingKernelFirmware returns the firmware blobs required by kernel 'version' (see GetKernelFirmwareRequirements)
+// that are not present under /lib/firmware.
+func GetMissingKernelFirmware(rootfs, version string) ([]string, error) {
+	requiredFirmware, err := GetKernelFirmwareRequirements(rootfs, version)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string(nil)
+	for _, firmware := range requiredFirmware {
+		found := false
+		for _, extension := range firmwareFileExtensions {
+			exists, err := file.PathExists(filepath.Join(rootfs, KernelFirmwareDir, firmware+extension))
+			if err != nil {
+				return nil, fmt.Errorf("failed to check if firmware (%s) exists:\n%w", firmware, err)
+			}
+
+			if exists {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, firmware)
+		}
+	}
+
+	return missing, nil
+}
+
+// isModuleFile returns true if the file name has the extension of a (possibly compressed) kernel module.
+func isModuleFile(name string) bool {
+	for _, extension := range moduleFileExtensions {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readModuleFirmware returns the firmware declared in a module file's modinfo.
+func readModuleFirmware(modulePath string) ([]string, error) {
+	content, err := readModuleContent(modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return readModinfoValues(content, modinfoFirmwareTag), nil
+}
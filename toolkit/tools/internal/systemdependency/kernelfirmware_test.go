@@ -0,0 +1,88 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+)
+
+// fakeModinfo returns content resembling a module's .modinfo section.
+func fakeModinfo(entries ...string) []byte {
+	content := []byte("\x7fELF")
+	for _, entry := range entries {
+		content = append(content, 0)
+		content = append(content, []byte(entry)...)
+	}
+	return append(content, 0)
+}
+
+func writeTestFile(t *testing.T, path string, content []byte) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(path, content, 0o644)
+	assert.NoError(t, err)
+}
+
+func createTestFirmwareKernel(t *testing.T) string {
+	rootfs := t.TempDir()
+	kernelDir := createTestKernel(t, rootfs, testKernelVersion, "")
+
+	writeTestFile(t, filepath.Join(kernelDir, "kernel/drivers/net/wireless/wifi.ko"),
+		fakeModinfo("license=GPL", "firmware=vendor/wifi-a.bin", "firmware=vendor/wifi-b.bin"))
+
+	var compressed bytes.Buffer
+	xzWriter, err := xz.NewWriter(&compressed)
+	assert.NoError(t, err)
+	_, err = xzWriter.Write(fakeModinfo("firmware=gpu/gpu.bin", "firmware=vendor/wifi-a.bin"))
+	assert.NoError(t, err)
+	assert.NoError(t, xzWriter.Close())
+	writeTestFile(t, filepath.Join(kernelDir, "kernel/drivers/gpu/gpu.ko.xz"), compressed.Bytes())
+
+	writeTestFile(t, filepath.Join(kernelDir, "kernel/fs/ext4/ext4.ko"), fakeModinfo("license=GPL"))
+
+	// Not a module.
+	writeTestFile(t, filepath.Join(kernelDir, "modules.order"), []byte("firmware=not/a/module.bin\n"))
+
+	return rootfs
+}
+
+func TestGetKernelFirmwareRequirements(t *testing.T) {
+	rootfs := createTestFirmwareKernel(t)
+
+	firmware, err := GetKernelFirmwareRequirements(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gpu/gpu.bin", "vendor/wifi-a.bin", "vendor/wifi-b.bin"}, firmware)
+}
+
+func TestGetKernelFirmwareRequirementsSkipsUnreadableModules(t *testing.T) {
+	rootfs := createTestFirmwareKernel(t)
+	writeTestFile(t, filepath.Join(rootfs, KernelModulesDir, testKernelVersion, "kernel/bad.ko.xz"),
+		[]byte("not xz"))
+
+	firmware, err := GetKernelFirmwareRequirements(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Len(t, firmware, 3)
+}
+
+func TestGetKernelFirmwareRequirementsMissingKernel(t *testing.T) {
+	_, err := GetKernelFirmwareRequirements(t.TempDir(), testKernelVersion)
+	assert.ErrorContains(t, err, "failed to scan kernel")
+}
+
+func TestGetMissingKernelFirmware(t *testing.T) {
+	rootfs := createTestFirmwareKernel(t)
+	writeTestFile(t, filepath.Join(rootfs, KernelFirmwareDir, "vendor/wifi-a.bin"), nil)
+	writeTestFile(t, filepath.Join(rootfs, KernelFirmwareDir, "gpu/gpu.bin.xz"), nil)
+
+	missing, err := GetMissingKernelFirmware(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vendor/wifi-b.bin"}, missing)
+}
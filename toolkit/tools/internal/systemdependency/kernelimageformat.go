@@ -0,0 +1,141 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	kernelBinaryFilePrefix = "vmlinuz-"
+
+	// VmlinuzFormatBzImage is an x86 kernel that is loaded above 1 MiB (i.e. a "big" zImage).
+	VmlinuzFormatBzImage = "bzImage"
+	// VmlinuzFormatZImage is an x86 kernel that is loaded below 1 MiB or a self-decompressing 32-bit ARM kernel.
+	VmlinuzFormatZImage = "zImage"
+	// VmlinuzFormatArm64Image is an uncompressed arm64 kernel.
+	VmlinuzFormatArm64Image = "Image"
+	// VmlinuzFormatEfiZboot is an EFI application that decompresses the kernel (e.g. arm64 CONFIG_EFI_ZBOOT).
+	VmlinuzFormatEfiZboot = "zboot"
+	// VmlinuzFormatElf is an uncompressed vmlinux.
+	VmlinuzFormatElf = "elf"
+
+	// A raw kernel binary that is compressed, but that isn't wrapped in a boot header.
+	VmlinuzFormatGzip  = "gzip"
+	VmlinuzFormatBzip2 = "bzip2"
+	VmlinuzFormatLzma  = "lzma"
+	VmlinuzFormatXz    = "xz"
+	VmlinuzFormatLz4   = "lz4"
+	VmlinuzFormatZstd  = "zstd"
+	// VmlinuzFormatUnknown is used when the file doesn't match any known format.
+	VmlinuzFormatUnknown = "unknown"
+
+	// The x86 boot protocol's setup header starts with "HdrS" at offset 0x202. Bit 0 (LOADED_HIGH) of the loadflags
+	// field is set for a bzImage.
+	x86SetupHeaderMagicOffset = 0x202
+	x86LoadFlagsOffset        = 0x211
+	x86LoadFlagsLoadedHigh    = 0x01
+
+	// The arm64 Image header has the magic "ARM\x64" at offset 0x38.
+	arm64ImageMagicOffset = 0x38
+
+	// The 32-bit ARM zImage header has the little-endian magic 0x016f2818 at offset 0x24.
+	armZImageMagicOffset = 0x24
+	armZImageMagic       = 0x016f2818
+
+	// An EFI zboot image is a PE file whose DOS header has "zimg" at offset 4.
+	efiZbootMagicOffset = 4
+
+	// The number of bytes needed to recognize all of the formats.
+	vmlinuzHeaderSize = x86LoadFlagsOffset + 1
+)
+
+var (
+	x86SetupHeaderMagic = []byte("HdrS")
+	arm64ImageMagic     = []byte("ARM\x64")
+	peMagic             = []byte("MZ")
+	efiZbootMagic       = []byte("zimg")
+)
+
+// vmlinuzCompressionMagics lists the magic bytes of the compression formats that a raw kernel binary may use.
+var vmlinuzCompressionMagics = []struct {
+	format string
+	magic  []byte
+}{
+	{VmlinuzFormatGzip, []byte{0x1f, 0x8b}},
+	{VmlinuzFormatBzip2, []byte("BZh")},
+	{VmlinuzFormatXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{VmlinuzFormatLzma, []byte{0x5d, 0x00, 0x00}},
+	// The kernel uses the legacy lz4 format. But, the lz4 frame format is accepted as well.
+	{VmlinuzFormatLz4, []byte{0x02, 0x21, 0x4c, 0x18}},
+	{VmlinuzFormatLz4, []byte{0x04, 0x22, 0x4d, 0x18}},
+	{VmlinuzFormatZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{VmlinuzFormatElf, []byte{0x7f, 'E', 'L', 'F'}},
+}
+
+// DetectVmlinuzFormat returns the format of the kernel binary /boot/vmlinuz-<ver> of the kernel 'version' installed
+// under 'rootfs' (e.g. VmlinuzFormatBzImage), according to the file's magic bytes.
+//
+// If the file doesn't match any known format, VmlinuzFormatUnknown is returned. If the file doesn't exist, the returned
+// error wraps os.ErrNotExist.
+func DetectVmlinuzFormat(rootfs string, version string) (string, error) {
+	vmlinuzPath := filepath.Join(rootfs, KernelBootDir, kernelBinaryFilePrefix+version)
+
+	vmlinuzFile, err := os.Open(vmlinuzPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("kernel (%s) binary (%s) not found:\n%w", version, vmlinuzPath, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open kernel binary (%s):\n%w", vmlinuzPath, err)
+	}
+	defer vmlinuzFile.Close()
+
+	header := make([]byte, vmlinuzHeaderSize)
+	n, err := io.ReadFull(vmlinuzFile, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read kernel binary (%s):\n%w", vmlinuzPath, err)
+	}
+
+	return getVmlinuzFormat(header[:n]), nil
+}
+
+// getVmlinuzFormat returns the format of a kernel binary, given the start of the file.
+func getVmlinuzFormat(header []byte) string {
+	switch {
+	case hasMagicAt(header, x86SetupHeaderMagicOffset, x86SetupHeaderMagic):
+		if len(header) > x86LoadFlagsOffset && header[x86LoadFlagsOffset]&x86LoadFlagsLoadedHigh != 0 {
+			return VmlinuzFormatBzImage
+		}
+		return VmlinuzFormatZImage
+
+	case bytes.HasPrefix(header, peMagic) && hasMagicAt(header, efiZbootMagicOffset, efiZbootMagic):
+		return VmlinuzFormatEfiZboot
+
+	case hasMagicAt(header, arm64ImageMagicOffset, arm64ImageMagic):
+		return VmlinuzFormatArm64Image
+
+	case len(header) >= armZImageMagicOffset+4 &&
+		binary.LittleEndian.Uint32(header[armZImageMagicOffset:]) == armZImageMagic:
+		return VmlinuzFormatZImage
+	}
+
+	for _, compression := range vmlinuzCompressionMagics {
+		if bytes.HasPrefix(header, compression.magic) {
+			return compression.format
+		}
+	}
+
+	return VmlinuzFormatUnknown
+}
+
+// hasMagicAt returns true if 'data' contains 'magic' at 'offset'.
+func hasMagicAt(data []byte, offset int, magic []byte) bool {
+	return len(data) >= offset+len(magic) && bytes.Equal(data[offset:offset+len(magic)], magic)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestVmlinuzHeader returns a fake kernel binary with 'magic' at 'offset'.
+func newTestVmlinuzHeader(offset int, magic ...byte) []byte {
+	header := make([]byte, 1024)
+	copy(header[offset:], magic)
+	return header
+}
+
+func createTestVmlinuz(t *testing.T, rootfs string, version string, content []byte) {
+	vmlinuzPath := filepath.Join(rootfs, KernelBootDir, kernelBinaryFilePrefix+version)
+	err := os.MkdirAll(filepath.Dir(vmlinuzPath), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(vmlinuzPath, content, 0o644)
+	assert.NoError(t, err)
+}
+
+func TestDetectVmlinuzFormat(t *testing.T) {
+	bzImage := newTestVmlinuzHeader(x86SetupHeaderMagicOffset, 'H', 'd', 'r', 'S')
+	bzImage[x86LoadFlagsOffset] = x86LoadFlagsLoadedHigh
+
+	efiZboot := newTestVmlinuzHeader(0, 'M', 'Z', 0, 0, 'z', 'i', 'm', 'g')
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{"bzImage", bzImage, VmlinuzFormatBzImage},
+		{"x86 zImage", newTestVmlinuzHeader(x86SetupHeaderMagicOffset, 'H', 'd', 'r', 'S'), VmlinuzFormatZImage},
+		{"arm zImage", newTestVmlinuzHeader(armZImageMagicOffset, 0x18, 0x28, 0x6f, 0x01), VmlinuzFormatZImage},
+		{"arm64 Image", newTestVmlinuzHeader(arm64ImageMagicOffset, 'A', 'R', 'M', 0x64), VmlinuzFormatArm64Image},
+		{"zboot", efiZboot, VmlinuzFormatEfiZboot},
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, VmlinuzFormatGzip},
+		{"lz4", []byte{0x02, 0x21, 0x4c, 0x18, 0x00}, VmlinuzFormatLz4},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, VmlinuzFormatZstd},
+		{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, VmlinuzFormatXz},
+		{"elf", []byte{0x7f, 'E', 'L', 'F', 0x02}, VmlinuzFormatElf},
+		{"unknown", []byte("not a kernel"), VmlinuzFormatUnknown},
+		{"empty", nil, VmlinuzFormatUnknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rootfs := t.TempDir()
+			createTestVmlinuz(t, rootfs, testKernelVersion, test.content)
+
+			format, err := DetectVmlinuzFormat(rootfs, testKernelVersion)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, format)
+		})
+	}
+}
+
+func TestDetectVmlinuzFormatMissing(t *testing.T) {
+	rootfs := t.TempDir()
+
+	_, err := DetectVmlinuzFormat(rootfs, testKernelVersion)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorContains(t, err, "kernel (6.6.47.1-1.azl3) binary")
+	assert.ErrorContains(t, err, "not found")
+}
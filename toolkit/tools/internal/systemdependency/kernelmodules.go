@@ -0,0 +1,423 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+const (
+	// KernelModulesDir is the directory, relative to a rootfs, that holds a sub-directory for each installed kernel.
+	KernelModulesDir = "/lib/modules"
+
+	modulesDepFileName   = "modules.dep"
+	modulesAliasFileName = "modules.alias"
+
+	modulesAliasCommand = "alias"
+)
+
+const (
+	ModuleCompressionNone = "none"
+	ModuleCompressionXz   = "xz"
+	ModuleCompressionGzip = "gz"
+	ModuleCompressionZstd = "zst"
+)
+
+// moduleCompressionOrder is the order used to break ties when detecting the predominant compression format.
+var moduleCompressionOrder = []string{
+	ModuleCompressionNone,
+	ModuleCompressionXz,
+	ModuleCompressionGzip,
+	ModuleCompressionZstd,
+}
+
+// moduleFileExtensions lists the file extensions a kernel module may have, ordered longest first so that the
+// compressed variants are stripped before the plain ".ko" suffix.
+var moduleFileExtensions = []string{".ko.xz", ".ko.gz", ".ko.zst", ".ko"}
+
+// ResolveModuleDeps returns the ordered list of modules required to load 'module' for the kernel 'version' installed
+// under 'rootfs'. The list is ordered in load order: every dependency appears before the modules that depend on it and
+// the requested module is the last entry. Paths are relative to the kernel's modules directory, as in modules.dep.
+func ResolveModuleDeps(rootfs, version, module string) ([]string, error) {
+	kernelDir := filepath.Join(rootfs, KernelModulesDir, version)
+	modulesDepPath := filepath.Join(kernelDir, modulesDepFileName)
+
+	deps, err := readModulesDep(modulesDepPath)
+	if err != nil {
+		return nil, err
+	}
+
+	modulePath, found := findModuleInDeps(deps, module)
+	if !found {
+		return nil, fmt.Errorf("module (%s) not found in (%s)", module, modulesDepPath)
+	}
+
+	ordered := []string(nil)
+	visited := make(map[string]bool)
+	inProgress := make(map[string]bool)
+
+	var visit func(path string) error
+	visit = func(path string) error {
+		if visited[path] {
+			return nil
+		}
+		if inProgress[path] {
+			return fmt.Errorf("circular module dependency detected at (%s)", path)
+		}
+		inProgress[path] = true
+
+		for _, dep := range deps[path] {
+			err := visit(dep)
+			if err != nil {
+				return err
+			}
+		}
+
+		inProgress[path] = false
+		visited[path] = true
+		ordered = append(ordered, path)
+		return nil
+	}
+
+	err = visit(modulePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dependencies of module (%s):\n%w", module, err)
+	}
+
+	for _, path := range ordered {
+		exists, err := file.PathExists(filepath.Join(kernelDir, path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if module file (%s) exists:\n%w", path, err)
+		}
+
+		if !exists {
+			return nil, fmt.Errorf("module (%s) requires (%s) which is missing from kernel (%s)", module, path, version)
+		}
+	}
+
+	return ordered, nil
+}
+
+// readModulesDep parses a modules.dep file into a map of module path to the module paths it depends on.
+func readModulesDep(modulesDepPath string) (map[string][]string, error) {
+	depFile, err := os.Open(modulesDepPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open modules dependency file (%s):\n%w", modulesDepPath, err)
+	}
+	defer depFile.Close()
+
+	deps, err := ParseModulesDep(depFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read modules dependency file (%s):\n%w", modulesDepPath, err)
+	}
+
+	return deps, nil
+}
+
+// ParseModulesDep parses content in the modules.dep format, as written by depmod (kmod), into a map of module path to
+// the module paths it depends on. So, dependency information can be read from any source, such as the output of a kmod
+// tool, and not just from a kernel's modules directory.
+//
+// Module paths are returned relative to the kernel's modules directory (e.g. "kernel/fs/overlayfs/overlay.ko.xz"), the
+// same as depmod writes them. Absolute paths (e.g. "/lib/modules/<ver>/kernel/fs/overlayfs/overlay.ko.xz"), which
+// older tools write, are made relative.
+func ParseModulesDep(r io.Reader) (map[string][]string, error) {
+	deps := make(map[string][]string)
+
+	err := scanModulesFile(r, func(line string) error {
+		// Each line has the format: <module>: [<dep> ...]
+		modulePath, depsList, found := strings.Cut(line, ":")
+		if !found {
+			return fmt.Errorf("invalid modules dependency line (%s)", line)
+		}
+
+		moduleDeps := strings.Fields(depsList)
+		for i, dep := range moduleDeps {
+			moduleDeps[i] = relativeModulePath(dep)
+		}
+
+		deps[relativeModulePath(strings.TrimSpace(modulePath))] = moduleDeps
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deps, nil
+}
+
+// ReadKernelModulesAlias reads the modules.alias file of the kernel 'version' installed under 'rootfs'. See
+// ParseModulesAlias. If the kernel doesn't have a modules.alias file, the returned error wraps os.ErrNotExist.
+func ReadKernelModulesAlias(rootfs, version string) (map[string][]string, error) {
+	modulesAliasPath := filepath.Join(rootfs, KernelModulesDir, version, modulesAliasFileName)
+
+	aliasFile, err := os.Open(modulesAliasPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open modules alias file (%s):\n%w", modulesAliasPath, err)
+	}
+	defer aliasFile.Close()
+
+	aliases, err := ParseModulesAlias(aliasFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read modules alias file (%s):\n%w", modulesAliasPath, err)
+	}
+
+	return aliases, nil
+}
+
+// ParseModulesAlias parses content in the modules.alias format, as written by depmod (kmod), into a map of alias
+// pattern (e.g. "pci:v00001AF4d00001000sv*sd*bc*sc*i*") to the names of the modules that provide it. An alias may be
+// provided by several modules, in which case modprobe loads all of them. Module names are normalized, the same as
+// modprobe does (i.e. '-' is replaced with '_').
+func ParseModulesAlias(r io.Reader) (map[string][]string, error) {
+	aliases := make(map[string][]string)
+
+	err := scanModulesFile(r, func(line string) error {
+		// Each line has the format: alias <pattern> <module>
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != modulesAliasCommand {
+			return fmt.Errorf("invalid modules alias line (%s)", line)
+		}
+
+		pattern, module := fields[1], normalizeModuleName(fields[2])
+		aliases[pattern] = append(aliases[pattern], module)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+// scanModulesFile calls 'parseLine' for each line of a file written by depmod (e.g. modules.dep), skipping blank lines
+// and comments. The lines are trimmed of surrounding whitespace.
+func scanModulesFile(r io.Reader, parseLine func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		err := parseLine(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// relativeModulePath returns the path of a module relative to its kernel's modules directory. For example:
+// "/lib/modules/6.6.47.1-1.azl3/kernel/fs/overlayfs/overlay.ko.xz" -> "kernel/fs/overlayfs/overlay.ko.xz". Relative
+// paths, and absolute paths outside of a kernel modules directory, are returned unchanged.
+func relativeModulePath(modulePath string) string {
+	if !path.IsAbs(modulePath) {
+		return modulePath
+	}
+
+	// This also handles the usr-merged location (i.e. /usr/lib/modules).
+	_, kernelPath, found := strings.Cut(modulePath, KernelModulesDir+"/")
+	if !found {
+		return modulePath
+	}
+
+	_, relPath, found := strings.Cut(kernelPath, "/")
+	if !found || relPath == "" {
+		return modulePath
+	}
+
+	return relPath
+}
+
+// KernelVersionFromModulePath returns the version of the kernel that a path under a kernel modules directory belongs
+// to. For example: "/lib/modules/6.6.47.1-1.azl3/kernel/fs/ext4/ext4.ko" -> "6.6.47.1-1.azl3". The path may be
+// relative (e.g. "lib/modules/<ver>/...") or within a rootfs (e.g. "/mnt/rootfs/usr/lib/modules/<ver>/...").
+func KernelVersionFromModulePath(modulePath string) (*versioncompare.TolerantVersion, error) {
+	cleanPath := path.Clean("/" + modulePath)
+
+	_, kernelPath, found := strings.Cut(cleanPath, KernelModulesDir+"/")
+	if !found {
+		return nil, fmt.Errorf("path (%s) isn't under a kernel modules directory (%s)", modulePath, KernelModulesDir)
+	}
+
+	version, _, _ := strings.Cut(kernelPath, "/")
+
+	kernelVersion, err := parseKernelVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kernel version from path (%s):\n%w", modulePath, err)
+	}
+
+	return kernelVersion, nil
+}
+
+// findModuleInDeps finds the modules.dep entry for a module name (e.g. "overlay").
+func findModuleInDeps(deps map[string][]string, module string) (string, bool) {
+	wantName := normalizeModuleName(module)
+	for modulePath := range deps {
+		if moduleNameFromPath(modulePath) == wantName {
+			return modulePath, true
+		}
+	}
+
+	return "", false
+}
+
+// moduleNameFromPath returns the normalized module name of a module file path.
+// For example: "kernel/fs/overlayfs/overlay.ko.xz" -> "overlay".
+func moduleNameFromPath(modulePath string) string {
+	name := filepath.Base(modulePath)
+	for _, extension := range moduleFileExtensions {
+		if strings.HasSuffix(name, extension) {
+			name = strings.TrimSuffix(name, extension)
+			break
+		}
+	}
+
+	return normalizeModuleName(name)
+}
+
+// normalizeModuleName treats '-' and '_' as equivalent, the same as modprobe does.
+func normalizeModuleName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// moduleCompressionFromPath returns the compression format of a module file, or an empty string if the file isn't a
+// kernel module.
+func moduleCompressionFromPath(modulePath string) string {
+	switch {
+	case strings.HasSuffix(modulePath, ".ko"):
+		return ModuleCompressionNone
+	case strings.HasSuffix(modulePath, ".ko.xz"):
+		return ModuleCompressionXz
+	case strings.HasSuffix(modulePath, ".ko.gz"):
+		return ModuleCompressionGzip
+	case strings.HasSuffix(modulePath, ".ko.zst"):
+		return ModuleCompressionZstd
+	default:
+		return ""
+	}
+}
+
+// CountModuleCompression returns the number of module files of kernel 'version' under 'rootfs' for each compression
+// format (e.g. ModuleCompressionXz). Formats with no modules are omitted.
+func CountModuleCompression(rootfs, version string) (map[string]int, error) {
+	kernelDir := filepath.Join(rootfs, KernelModulesDir, version)
+
+	counts := make(map[string]int)
+	err := filepath.WalkDir(kernelDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		compression := moduleCompressionFromPath(d.Name())
+		if compression != "" {
+			counts[compression]++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan kernel (%s) modules:\n%w", version, err)
+	}
+
+	return counts, nil
+}
+
+// DetectModuleCompression returns the compression format (e.g. ModuleCompressionXz) used by the majority of the module
+// files of kernel 'version' under 'rootfs'.
+func DetectModuleCompression(rootfs, version string) (string, error) {
+	counts, err := CountModuleCompression(rootfs, version)
+	if err != nil {
+		return "", err
+	}
+
+	predominant := ""
+	for _, compression := range moduleCompressionOrder {
+		if counts[compression] > counts[predominant] {
+			predominant = compression
+		}
+	}
+
+	if predominant == "" {
+		return "", fmt.Errorf("no modules found for kernel (%s)", version)
+	}
+
+	return predominant, nil
+}
+
+// getKernelModuleNames returns the set of normalized names of the module files of kernel 'version' under 'rootfs'.
+func getKernelModuleNames(rootfs, version string) (map[string]bool, error) {
+	kernelDir := filepath.Join(rootfs, KernelModulesDir, version)
+
+	modules := make(map[string]bool)
+	err := filepath.WalkDir(kernelDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !isModuleFile(d.Name()) {
+			return nil
+		}
+
+		modules[moduleNameFromPath(d.Name())] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan kernel (%s) modules:\n%w", version, err)
+	}
+
+	return modules, nil
+}
+
+// DiffKernelModules returns the modules that kernel 'versionB' has but kernel 'versionA' doesn't ('added') and the
+// modules that kernel 'versionA' has but kernel 'versionB' doesn't ('removed'), for two kernels installed under
+// 'rootfs'. For example, with the old kernel as 'versionA' and the new kernel as 'versionB', 'removed' lists the
+// drivers lost by an upgrade.
+//
+// Modules are compared by their normalized name (e.g. "hv_netvsc"), which is what both lists contain. So, a module that
+// only changed its compression format or its directory isn't reported. Both lists are sorted.
+func DiffKernelModules(rootfs, versionA, versionB string) (added, removed []string, err error) {
+	modulesA, err := getKernelModuleNames(rootfs, versionA)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modulesB, err := getKernelModuleNames(rootfs, versionB)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for module := range modulesB {
+		if !modulesA[module] {
+			added = append(added, module)
+		}
+	}
+
+	for module := range modulesA {
+		if !modulesB[module] {
+			removed = append(removed, module)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed, nil
+}
@@ -0,0 +1,289 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKernelVersion = "6.6.47.1-1.azl3"
+
+const testModulesDep = `kernel/fs/overlayfs/overlay.ko.xz:
+kernel/fs/fuse/virtiofs.ko.xz: kernel/fs/fuse/fuse.ko.xz kernel/drivers/virtio/virtio_ring.ko.xz
+kernel/fs/fuse/fuse.ko.xz:
+kernel/drivers/virtio/virtio_ring.ko.xz:
+kernel/drivers/block/nbd-test.ko: kernel/drivers/block/missing.ko
+`
+
+// createTestKernel creates a fake kernel modules directory under 'rootfs' containing the provided module files and
+// modules.dep content.
+func createTestKernel(t *testing.T, rootfs string, version string, modulesDep string, moduleFiles ...string) string {
+	kernelDir := filepath.Join(rootfs, KernelModulesDir, version)
+	err := os.MkdirAll(kernelDir, os.ModePerm)
+	assert.NoError(t, err)
+
+	if modulesDep != "" {
+		err = os.WriteFile(filepath.Join(kernelDir, modulesDepFileName), []byte(modulesDep), 0o644)
+		assert.NoError(t, err)
+	}
+
+	for _, moduleFile := range moduleFiles {
+		modulePath := filepath.Join(kernelDir, moduleFile)
+		err = os.MkdirAll(filepath.Dir(modulePath), os.ModePerm)
+		assert.NoError(t, err)
+
+		err = os.WriteFile(modulePath, nil, 0o644)
+		assert.NoError(t, err)
+	}
+
+	return kernelDir
+}
+
+func createTestModulesDepKernel(t *testing.T) string {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, testModulesDep,
+		"kernel/fs/overlayfs/overlay.ko.xz",
+		"kernel/fs/fuse/virtiofs.ko.xz",
+		"kernel/fs/fuse/fuse.ko.xz",
+		"kernel/drivers/virtio/virtio_ring.ko.xz",
+		"kernel/drivers/block/nbd-test.ko",
+	)
+	return rootfs
+}
+
+func TestResolveModuleDepsNoDeps(t *testing.T) {
+	rootfs := createTestModulesDepKernel(t)
+
+	deps, err := ResolveModuleDeps(rootfs, testKernelVersion, "overlay")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kernel/fs/overlayfs/overlay.ko.xz"}, deps)
+}
+
+func TestResolveModuleDepsOrdered(t *testing.T) {
+	rootfs := createTestModulesDepKernel(t)
+
+	deps, err := ResolveModuleDeps(rootfs, testKernelVersion, "virtiofs")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"kernel/fs/fuse/fuse.ko.xz",
+		"kernel/drivers/virtio/virtio_ring.ko.xz",
+		"kernel/fs/fuse/virtiofs.ko.xz",
+	}, deps)
+}
+
+func TestResolveModuleDepsMissingDependency(t *testing.T) {
+	rootfs := createTestModulesDepKernel(t)
+
+	// Dashes and underscores in module names are interchangeable.
+	_, err := ResolveModuleDeps(rootfs, testKernelVersion, "nbd_test")
+	assert.ErrorContains(t, err, "requires (kernel/drivers/block/missing.ko) which is missing")
+}
+
+func TestResolveModuleDepsUnknownModule(t *testing.T) {
+	rootfs := createTestModulesDepKernel(t)
+
+	_, err := ResolveModuleDeps(rootfs, testKernelVersion, "btrfs")
+	assert.ErrorContains(t, err, "module (btrfs) not found")
+}
+
+func TestResolveModuleDepsMissingModulesDep(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, "")
+
+	_, err := ResolveModuleDeps(rootfs, testKernelVersion, "overlay")
+	assert.ErrorContains(t, err, "failed to open modules dependency file")
+}
+
+func TestResolveModuleDepsCircular(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, "a.ko: b.ko\nb.ko: a.ko\n", "a.ko", "b.ko")
+
+	_, err := ResolveModuleDeps(rootfs, testKernelVersion, "a")
+	assert.ErrorContains(t, err, "circular module dependency")
+}
+
+func TestParseModulesDep(t *testing.T) {
+	deps, err := ParseModulesDep(strings.NewReader(testModulesDep))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"kernel/fs/overlayfs/overlay.ko.xz":       {},
+		"kernel/fs/fuse/virtiofs.ko.xz":           {"kernel/fs/fuse/fuse.ko.xz", "kernel/drivers/virtio/virtio_ring.ko.xz"},
+		"kernel/fs/fuse/fuse.ko.xz":               {},
+		"kernel/drivers/virtio/virtio_ring.ko.xz": {},
+		"kernel/drivers/block/nbd-test.ko":        {"kernel/drivers/block/missing.ko"},
+	}, deps)
+}
+
+func TestParseModulesDepAbsolutePaths(t *testing.T) {
+	content := `# Written by an older depmod.
+/lib/modules/6.6.47.1-1.azl3/kernel/fs/fuse/virtiofs.ko.xz: /lib/modules/6.6.47.1-1.azl3/kernel/fs/fuse/fuse.ko.xz
+/usr/lib/modules/6.6.47.1-1.azl3/kernel/fs/fuse/fuse.ko.xz:
+/opt/extra/out-of-tree.ko:   kernel/fs/fuse/fuse.ko.xz
+
+`
+
+	deps, err := ParseModulesDep(strings.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"kernel/fs/fuse/virtiofs.ko.xz": {"kernel/fs/fuse/fuse.ko.xz"},
+		"kernel/fs/fuse/fuse.ko.xz":     {},
+		"/opt/extra/out-of-tree.ko":     {"kernel/fs/fuse/fuse.ko.xz"},
+	}, deps)
+}
+
+func TestParseModulesAlias(t *testing.T) {
+	content := `# Aliases extracted from modules themselves.
+alias fs-virtiofs virtiofs
+alias pci:v00001AF4d00001000sv*sd*bc*sc*i* virtio-net
+alias pci:v00001AF4d00001000sv*sd*bc*sc*i* virtio_pci
+
+`
+
+	aliases, err := ParseModulesAlias(strings.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"fs-virtiofs":                          {"virtiofs"},
+		"pci:v00001AF4d00001000sv*sd*bc*sc*i*": {"virtio_net", "virtio_pci"},
+	}, aliases)
+
+	_, err = ParseModulesAlias(strings.NewReader("options virtio_net napi_tx=1\n"))
+	assert.ErrorContains(t, err, "invalid modules alias line (options virtio_net napi_tx=1)")
+}
+
+func TestReadKernelModulesAliasMissing(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, testModulesDep)
+
+	_, err := ReadKernelModulesAlias(rootfs, testKernelVersion)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestParseModulesDepInvalid(t *testing.T) {
+	_, err := ParseModulesDep(strings.NewReader("kernel/fs/overlayfs/overlay.ko.xz\n"))
+	assert.ErrorContains(t, err, "invalid modules dependency line (kernel/fs/overlayfs/overlay.ko.xz)")
+}
+
+func TestDetectModuleCompressionSingleFormat(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, "", "kernel/a.ko.xz", "kernel/b.ko.xz", "modules.alias")
+
+	compression, err := DetectModuleCompression(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, ModuleCompressionXz, compression)
+
+	counts, err := CountModuleCompression(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{ModuleCompressionXz: 2}, counts)
+}
+
+func TestDetectModuleCompressionUncompressed(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, "", "kernel/a.ko")
+
+	compression, err := DetectModuleCompression(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, ModuleCompressionNone, compression)
+}
+
+func TestDetectModuleCompressionMixedFormats(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, "",
+		"kernel/a.ko.zst", "kernel/b.ko.zst", "kernel/c.ko.zst", "kernel/d.ko", "extra/e.ko.gz")
+
+	compression, err := DetectModuleCompression(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, ModuleCompressionZstd, compression)
+
+	counts, err := CountModuleCompression(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		ModuleCompressionZstd: 3,
+		ModuleCompressionNone: 1,
+		ModuleCompressionGzip: 1,
+	}, counts)
+}
+
+func TestDetectModuleCompressionNoModules(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, "", "modules.dep")
+
+	_, err := DetectModuleCompression(rootfs, testKernelVersion)
+	assert.ErrorContains(t, err, "no modules found")
+}
+
+func TestDiffKernelModules(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "",
+		"kernel/fs/overlayfs/overlay.ko.xz",
+		"kernel/drivers/net/hyperv/hv_netvsc.ko.xz",
+		"kernel/drivers/scsi/megaraid/megaraid_sas.ko.xz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "",
+		// Only the compression changed.
+		"kernel/fs/overlayfs/overlay.ko.zst",
+		"kernel/drivers/net/hyperv/hv_netvsc.ko.zst",
+		"kernel/drivers/net/ethernet/microsoft/mana/mana.ko.zst",
+		"modules.order")
+
+	added, removed, err := DiffKernelModules(rootfs, "6.6.47.1-1.azl3", "6.6.51.1-1.azl3")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mana"}, added)
+	assert.Equal(t, []string{"megaraid_sas"}, removed)
+
+	added, removed, err = DiffKernelModules(rootfs, "6.6.51.1-1.azl3", "6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"megaraid_sas"}, added)
+	assert.Equal(t, []string{"mana"}, removed)
+}
+
+func TestDiffKernelModulesSameKernel(t *testing.T) {
+	rootfs := createTestModulesDepKernel(t)
+
+	added, removed, err := DiffKernelModules(rootfs, testKernelVersion, testKernelVersion)
+	assert.NoError(t, err)
+	assert.Empty(t, added)
+	assert.Empty(t, removed)
+}
+
+func TestDiffKernelModulesMissingKernel(t *testing.T) {
+	rootfs := createTestModulesDepKernel(t)
+
+	_, _, err := DiffKernelModules(rootfs, testKernelVersion, "6.6.51.1-1.azl3")
+	assert.ErrorContains(t, err, "failed to scan kernel (6.6.51.1-1.azl3) modules")
+}
+
+func TestKernelVersionFromModulePath(t *testing.T) {
+	tests := map[string]string{
+		"/lib/modules/6.6.47.1-1.azl3/kernel/fs/ext4/ext4.ko":                 "6.6.47.1-1.azl3",
+		"/usr/lib/modules/6.6.47.1-1.azl3/kernel/fs/ext4/ext4.ko.xz":          "6.6.47.1-1.azl3",
+		"lib/modules/5.15.0-1064-azure/modules.dep":                           "5.15.0-1064-azure",
+		"/mnt/rootfs/lib/modules/6.6.47.1-1.azl3.x86_64/extra/out-of-tree.ko": "6.6.47.1-1.azl3.x86_64",
+		"/lib/modules/6.6.47.1-1.azl3":                                        "6.6.47.1-1.azl3",
+	}
+
+	for modulePath, expected := range tests {
+		version, err := KernelVersionFromModulePath(modulePath)
+		if assert.NoError(t, err, "path (%s)", modulePath) {
+			assert.Equal(t, expected, version.String(), "path (%s)", modulePath)
+		}
+	}
+}
+
+func TestKernelVersionFromModulePathInvalid(t *testing.T) {
+	_, err := KernelVersionFromModulePath("/opt/extra/out-of-tree.ko")
+	assert.EqualError(t, err, "path (/opt/extra/out-of-tree.ko) isn't under a kernel modules directory (/lib/modules)")
+
+	_, err = KernelVersionFromModulePath("kernel/fs/ext4/ext4.ko")
+	assert.ErrorContains(t, err, "isn't under a kernel modules directory")
+
+	_, err = KernelVersionFromModulePath("/lib/modules/")
+	assert.ErrorContains(t, err, "isn't under a kernel modules directory")
+
+	_, err = KernelVersionFromModulePath("/lib/modules/not-a-version/kernel/fs/ext4/ext4.ko")
+	assert.ErrorContains(t, err, "failed to get kernel version from path")
+}
@@ -0,0 +1,198 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// The prefix of an OCI/AUFS style whiteout file. For example, ".wh.6.6.47.1-1.azl3" hides "6.6.47.1-1.azl3".
+	whiteoutFilePrefix = ".wh."
+	// The OCI/AUFS style marker file for an opaque directory.
+	whiteoutOpaqueMarker = ".wh..wh..opq"
+)
+
+// overlayOpaqueXattrs are the extended attributes that overlayfs uses to mark an opaque directory.
+var overlayOpaqueXattrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+// overlayKernelDir tracks the merged state of a /lib/modules/<ver> entry across overlay layers.
+type overlayKernelDir struct {
+	// The entry was removed by a whiteout or replaced by a non-directory in a higher layer.
+	hidden   bool
+	nonEmpty bool
+	// The directory is opaque in a higher layer, so lower layers don't contribute to it.
+	opaque bool
+}
+
+// GetInstalledKernelVersionsOverlay returns the versions of the kernels installed in an un-merged overlay layer stack.
+// This gives the same result as calling GetInstalledKernelVersions on the merged mount, without needing to mount it.
+//
+// 'lowerDirs' are ordered from the top-most layer to the bottom-most layer, the same as overlayfs's lowerdir option.
+// Entries in 'upperDir' take precedence over the lower layers. Both overlayfs style whiteouts (0/0 character devices
+// and opaque xattrs) and OCI style whiteouts (".wh.<name>" and ".wh..wh..opq" files) are respected.
+func GetInstalledKernelVersionsOverlay(lowerDirs []string, upperDir string) ([]*versioncompare.TolerantVersion, error) {
+	layers := append([]string{upperDir}, lowerDirs...)
+
+	kernelDirs := make(map[string]*overlayKernelDir)
+	for _, layer := range layers {
+		modulesDir, err := ResolvePathInRootfs(layer, KernelModulesDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve kernel modules directory in layer (%s):\n%w", layer, err)
+		}
+
+		entries, err := os.ReadDir(modulesDir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read installed kernels list in layer (%s):\n%w", layer, err)
+		}
+
+		for _, entry := range entries {
+			err = mergeOverlayKernelDir(kernelDirs, modulesDir, entry)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read installed kernel (%s) in layer (%s):\n%w", entry.Name(), layer,
+					err)
+			}
+		}
+
+		opaque, err := isOverlayOpaqueDir(modulesDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kernel modules directory in layer (%s):\n%w", layer, err)
+		}
+
+		if opaque {
+			// The lower layers are hidden.
+			break
+		}
+	}
+
+	names := []string(nil)
+	for name, kernelDir := range kernelDirs {
+		if !kernelDir.hidden && kernelDir.nonEmpty && !isKernelBackupDirName(name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	versions := make([]*versioncompare.TolerantVersion, len(names))
+	for i, name := range names {
+		version, err := parseKernelVersion(name)
+		if err != nil {
+			return nil, err
+		}
+
+		versions[i] = version
+	}
+
+	return versions, nil
+}
+
+// mergeOverlayKernelDir merges a layer's /lib/modules entry into the state accumulated from the higher layers.
+func mergeOverlayKernelDir(kernelDirs map[string]*overlayKernelDir, modulesDir string, entry os.DirEntry) error {
+	if entry.Name() == whiteoutOpaqueMarker {
+		return nil
+	}
+
+	name, isWhiteoutFile := strings.CutPrefix(entry.Name(), whiteoutFilePrefix)
+
+	kernelDir, found := kernelDirs[name]
+	if found && (kernelDir.hidden || kernelDir.opaque) {
+		return nil
+	}
+
+	entryPath := filepath.Join(modulesDir, entry.Name())
+
+	if !found {
+		kernelDir = &overlayKernelDir{}
+		kernelDirs[name] = kernelDir
+
+		whiteout, err := isOverlayWhiteout(entryPath)
+		if err != nil {
+			return err
+		}
+
+		if isWhiteoutFile || whiteout || !entry.IsDir() {
+			kernelDir.hidden = true
+			return nil
+		}
+	}
+
+	if isWhiteoutFile || !entry.IsDir() {
+		// A lower layer's whiteout or file can't affect a directory from a higher layer.
+		return nil
+	}
+
+	empty, err := file.IsDirEmpty(entryPath)
+	if err != nil {
+		return err
+	}
+
+	kernelDir.nonEmpty = kernelDir.nonEmpty || !empty
+
+	opaque, err := isOverlayOpaqueDir(entryPath)
+	if err != nil {
+		return err
+	}
+
+	kernelDir.opaque = opaque
+
+	return nil
+}
+
+// isOverlayWhiteout returns true if 'path' is an overlayfs whiteout (i.e. a character device with device number 0/0).
+func isOverlayWhiteout(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false, nil
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Rdev == 0, nil
+}
+
+// isOverlayOpaqueDir returns true if the directory 'path' hides the contents of the same directory in lower layers.
+func isOverlayOpaqueDir(path string) (bool, error) {
+	markerExists, err := file.PathExists(filepath.Join(path, whiteoutOpaqueMarker))
+	if err != nil {
+		return false, err
+	}
+
+	if markerExists {
+		return true, nil
+	}
+
+	for _, xattr := range overlayOpaqueXattrs {
+		value := make([]byte, 1)
+		size, err := unix.Lgetxattr(path, xattr, value)
+		if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read xattr (%s) of (%s):\n%w", xattr, path, err)
+		}
+
+		if size == 1 && value[0] == 'y' {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
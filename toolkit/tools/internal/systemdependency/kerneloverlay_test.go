@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// createTestOverlayWhiteout creates an overlayfs style whiteout for the kernel 'version' in 'layer'.
+func createTestOverlayWhiteout(t *testing.T, layer string, version string) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating overlayfs whiteouts requires root")
+	}
+
+	modulesDir := filepath.Join(layer, KernelModulesDir)
+	err := os.MkdirAll(modulesDir, os.ModePerm)
+	assert.NoError(t, err)
+
+	err = unix.Mknod(filepath.Join(modulesDir, version), unix.S_IFCHR|0o000, 0)
+	assert.NoError(t, err)
+}
+
+func TestGetInstalledKernelVersionsOverlayWhiteout(t *testing.T) {
+	lower := t.TempDir()
+	createTestKernel(t, lower, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, lower, "6.6.51.1-1.azl3", "", "vmlinuz")
+
+	upper := t.TempDir()
+	createTestKernel(t, upper, "6.6.57.1-1.azl3", "", "vmlinuz")
+	createTestOverlayWhiteout(t, upper, "6.6.47.1-1.azl3")
+
+	versions, err := GetInstalledKernelVersionsOverlay([]string{lower}, upper)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3", "6.6.57.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsOverlayOciWhiteout(t *testing.T) {
+	bottom := t.TempDir()
+	createTestKernel(t, bottom, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	middle := t.TempDir()
+	createTestKernel(t, middle, "6.6.51.1-1.azl3", "", "vmlinuz")
+	err := os.WriteFile(filepath.Join(middle, KernelModulesDir, ".wh.6.6.47.1-1.azl3"), nil, 0o644)
+	assert.NoError(t, err)
+
+	// The whiteout in the middle layer doesn't hide the upper layer's kernel of the same name.
+	upper := t.TempDir()
+	createTestKernel(t, upper, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	versions, err := GetInstalledKernelVersionsOverlay([]string{middle, bottom}, upper)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"}, kernelVersionStrings(versions))
+
+	// Without the upper layer, the whiteout hides the bottom layer's kernel.
+	versions, err = GetInstalledKernelVersionsOverlay([]string{bottom}, middle)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsOverlayOpaqueModulesDir(t *testing.T) {
+	lower := t.TempDir()
+	createTestKernel(t, lower, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	upper := t.TempDir()
+	createTestKernel(t, upper, "6.6.51.1-1.azl3", "", "vmlinuz")
+	err := os.WriteFile(filepath.Join(upper, KernelModulesDir, whiteoutOpaqueMarker), nil, 0o644)
+	assert.NoError(t, err)
+
+	versions, err := GetInstalledKernelVersionsOverlay([]string{lower}, upper)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsOverlayMergesKernelDir(t *testing.T) {
+	// The upper layer has an empty kernel directory (e.g. only its metadata changed). The merged directory still has the
+	// lower layer's modules.
+	lower := t.TempDir()
+	createTestKernel(t, lower, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	upper := t.TempDir()
+	createTestKernel(t, upper, "6.6.47.1-1.azl3", "")
+
+	versions, err := GetInstalledKernelVersionsOverlay([]string{lower}, upper)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestGetInstalledKernelVersionsOverlayMissingModulesDirs(t *testing.T) {
+	lower := t.TempDir()
+	createTestKernel(t, lower, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	// The upper layer doesn't have a /lib/modules directory.
+	versions, err := GetInstalledKernelVersionsOverlay([]string{lower}, t.TempDir())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// kernelRpmQueryFormat lists the package's name, version and release, followed by one line per file in the package.
+const kernelRpmQueryFormat = "%{NAME}\n%{VERSION}\n%{RELEASE}\n[%{FILENAMES}\n]"
+
+// queryRpmFile returns the output of 'rpm -qp --qf <queryFormat> <rpmPath>'. It is a variable so that tests can
+// replace it.
+var queryRpmFile = func(rpmPath string, queryFormat string) (string, error) {
+	stdout, stderr, err := runner.Execute("rpm", "-qp", "--qf", queryFormat, rpmPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to query rpm (%s):\n%v\n%w", rpmPath, stderr, err)
+	}
+
+	return stdout, nil
+}
+
+// KernelVersionFromRpmFile returns the version of the kernel that the RPM file 'rpmPath' would install, without
+// installing it. The version is read from the RPM header's version and release (e.g. "6.6.47.1-1.azl3").
+//
+// An RPM is considered to be a kernel RPM if it contains a kernel binary (i.e. /boot/vmlinuz-<version> or
+// /lib/modules/<version>/vmlinuz). So, packages such as kernel-headers and kernel-devel are rejected.
+func KernelVersionFromRpmFile(rpmPath string) (*versioncompare.TolerantVersion, error) {
+	stdout, err := queryRpmFile(rpmPath, kernelRpmQueryFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) < 3 {
+		return nil, fmt.Errorf("unexpected rpm query output for (%s):\n%s", rpmPath, stdout)
+	}
+
+	name, version, release, files := lines[0], lines[1], lines[2], lines[3:]
+
+	if !rpmFilesContainKernel(files) {
+		return nil, fmt.Errorf("rpm (%s) is not a kernel package: package (%s) doesn't contain a kernel binary",
+			rpmPath, name)
+	}
+
+	kernelVersion, err := versioncompare.Parse(version + "-" + release)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel version of rpm (%s):\n%w", rpmPath, err)
+	}
+
+	return kernelVersion, nil
+}
+
+// rpmFilesContainKernel returns true if any of the RPM's files is a kernel binary.
+func rpmFilesContainKernel(files []string) bool {
+	for _, file := range files {
+		file = strings.TrimSpace(file)
+
+		if strings.HasPrefix(file, "/boot/vmlinuz-") {
+			return true
+		}
+
+		// The kernel binary is also shipped within the modules directory (e.g. /lib/modules/<version>/vmlinuz), for
+		// kernel-install to copy into /boot.
+		modulesDir := path.Dir(path.Dir(file))
+		if path.Base(file) == "vmlinuz" && (modulesDir == KernelModulesDir || modulesDir == "/usr"+KernelModulesDir) {
+			return true
+		}
+	}
+
+	return false
+}
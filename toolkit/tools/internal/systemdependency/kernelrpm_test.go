@@ -0,0 +1,51 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stubQueryRpmFile(t *testing.T, stdout string) {
+	originalQuery := queryRpmFile
+	queryRpmFile = func(rpmPath string, queryFormat string) (string, error) {
+		assert.Equal(t, kernelRpmQueryFormat, queryFormat)
+		return stdout, nil
+	}
+	t.Cleanup(func() { queryRpmFile = originalQuery })
+}
+
+func TestKernelVersionFromRpmFile(t *testing.T) {
+	stubQueryRpmFile(t, "kernel\n6.6.47.1\n1.azl3\n/boot/System.map-6.6.47.1-1.azl3\n"+
+		"/boot/vmlinuz-6.6.47.1-1.azl3\n/lib/modules/6.6.47.1-1.azl3/modules.order\n")
+
+	version, err := KernelVersionFromRpmFile("kernel-6.6.47.1-1.azl3.x86_64.rpm")
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.47.1-1.azl3", version.String())
+}
+
+func TestKernelVersionFromRpmFileModulesDirKernel(t *testing.T) {
+	// Fedora style kernel packages only ship the kernel binary within the modules directory.
+	stubQueryRpmFile(t, "kernel-core\n6.10.6\n200.fc40\n/lib/modules/6.10.6-200.fc40.x86_64/vmlinuz\n")
+
+	version, err := KernelVersionFromRpmFile("kernel-core-6.10.6-200.fc40.x86_64.rpm")
+	assert.NoError(t, err)
+	assert.Equal(t, "6.10.6-200.fc40", version.String())
+}
+
+func TestKernelVersionFromRpmFileNotKernel(t *testing.T) {
+	stubQueryRpmFile(t, "kernel-headers\n6.6.47.1\n1.azl3\n/usr/include/linux/kernel.h\n")
+
+	_, err := KernelVersionFromRpmFile("kernel-headers-6.6.47.1-1.azl3.noarch.rpm")
+	assert.ErrorContains(t, err, "is not a kernel package: package (kernel-headers) doesn't contain a kernel binary")
+}
+
+func TestKernelVersionFromRpmFileBadOutput(t *testing.T) {
+	stubQueryRpmFile(t, "kernel\n")
+
+	_, err := KernelVersionFromRpmFile("kernel.rpm")
+	assert.ErrorContains(t, err, "unexpected rpm query output for (kernel.rpm)")
+}
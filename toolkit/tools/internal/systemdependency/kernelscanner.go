@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"sync"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// KernelScanner enumerates the kernels installed under a rootfs and caches the result, so that the many checks that
+// need the kernel list during a build don't each re-read /lib/modules. Call Invalidate after any step that may change
+// the installed kernels (e.g. installing or removing packages).
+//
+// A KernelScanner is safe for concurrent use.
+type KernelScanner struct {
+	rootfs string
+	scan   func(rootfs string) ([]*versioncompare.TolerantVersion, error)
+
+	mutex    sync.Mutex
+	versions []*versioncompare.TolerantVersion
+	cached   bool
+}
+
+// NewKernelScanner returns a new KernelScanner for 'rootfs'.
+func NewKernelScanner(rootfs string) *KernelScanner {
+	return &KernelScanner{
+		rootfs: rootfs,
+		scan: func(rootfs string) ([]*versioncompare.TolerantVersion, error) {
+			return GetInstalledKernelVersions(rootfs)
+		},
+	}
+}
+
+// Rootfs returns the rootfs the scanner is bound to.
+func (s *KernelScanner) Rootfs() string {
+	return s.rootfs
+}
+
+// GetInstalledKernelVersions returns the same result as the package level GetInstalledKernelVersions function, but
+// only scans the rootfs if there isn't a cached result. Errors are not cached.
+func (s *KernelScanner) GetInstalledKernelVersions() ([]*versioncompare.TolerantVersion, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.cached {
+		versions, err := s.scan(s.rootfs)
+		if err != nil {
+			return nil, err
+		}
+
+		s.versions = versions
+		s.cached = true
+	}
+
+	// Return a copy so that callers can't modify the cache.
+	return append([]*versioncompare.TolerantVersion(nil), s.versions...), nil
+}
+
+// Invalidate clears the cached result, so that the next call rescans the rootfs.
+func (s *KernelScanner) Invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.versions = nil
+	s.cached = false
+}
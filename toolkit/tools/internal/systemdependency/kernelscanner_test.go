@@ -0,0 +1,136 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+	"github.com/stretchr/testify/assert"
+)
+
+// newCountingKernelScanner returns a scanner for 'rootfs' and a counter of the number of times it read the rootfs.
+func newCountingKernelScanner(rootfs string) (*KernelScanner, *atomic.Int32) {
+	scanCount := &atomic.Int32{}
+
+	scanner := NewKernelScanner(rootfs)
+	scanner.scan = func(rootfs string) ([]*versioncompare.TolerantVersion, error) {
+		scanCount.Add(1)
+		return GetInstalledKernelVersions(rootfs)
+	}
+
+	return scanner, scanCount
+}
+
+func kernelVersionStrings(versions []*versioncompare.TolerantVersion) []string {
+	strs := []string{}
+	for _, version := range versions {
+		strs = append(strs, version.String())
+	}
+	return strs
+}
+
+func TestKernelScannerCaches(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	scanner, scanCount := newCountingKernelScanner(rootfs)
+
+	versions, err := scanner.GetInstalledKernelVersions()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+
+	// A new kernel isn't seen until the cache is invalidated.
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "", "vmlinuz")
+
+	versions, err = scanner.GetInstalledKernelVersions()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+	assert.Equal(t, int32(1), scanCount.Load())
+}
+
+func TestKernelScannerInvalidate(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	scanner, scanCount := newCountingKernelScanner(rootfs)
+
+	_, err := scanner.GetInstalledKernelVersions()
+	assert.NoError(t, err)
+
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "", "vmlinuz")
+	err = os.RemoveAll(filepath.Join(rootfs, KernelModulesDir, "6.6.47.1-1.azl3"))
+	assert.NoError(t, err)
+
+	scanner.Invalidate()
+
+	versions, err := scanner.GetInstalledKernelVersions()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, kernelVersionStrings(versions))
+	assert.Equal(t, int32(2), scanCount.Load())
+}
+
+func TestKernelScannerDoesNotCacheErrors(t *testing.T) {
+	rootfs := t.TempDir()
+
+	scanner, scanCount := newCountingKernelScanner(rootfs)
+
+	_, err := scanner.GetInstalledKernelVersions()
+	assert.ErrorContains(t, err, "failed to read installed kernels list")
+
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	versions, err := scanner.GetInstalledKernelVersions()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+	assert.Equal(t, int32(2), scanCount.Load())
+}
+
+func TestKernelScannerResultIsCopy(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	scanner := NewKernelScanner(rootfs)
+
+	versions, err := scanner.GetInstalledKernelVersions()
+	assert.NoError(t, err)
+	versions[0] = versioncompare.New("1.0")
+
+	versions, err = scanner.GetInstalledKernelVersions()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(versions))
+}
+
+func TestKernelScannerConcurrent(t *testing.T) {
+	rootfs := t.TempDir()
+	for i := 0; i < 4; i++ {
+		createTestKernel(t, rootfs, fmt.Sprintf("6.6.%d.1-1.azl3", i), "", "vmlinuz")
+	}
+
+	scanner, scanCount := newCountingKernelScanner(rootfs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if i%4 == 0 {
+				scanner.Invalidate()
+			}
+
+			versions, err := scanner.GetInstalledKernelVersions()
+			assert.NoError(t, err)
+			assert.Len(t, versions, 4)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, scanCount.Load(), int32(5))
+}
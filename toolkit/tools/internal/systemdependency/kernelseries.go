@@ -0,0 +1,40 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"sort"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// kernelSeriesComponents is the number of version components that identify a kernel series (i.e. major.minor).
+const kernelSeriesComponents = 2
+
+// KernelsBySeries returns the kernels installed under 'rootfs' grouped by their series (i.e. "major.minor", like
+// "6.6"). The kernels of each series are sorted in ascending order.
+func KernelsBySeries(rootfs string) (map[string][]*versioncompare.TolerantVersion, error) {
+	versions, err := GetInstalledKernelVersions(rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupKernelsBySeries(versions), nil
+}
+
+func groupKernelsBySeries(versions []*versioncompare.TolerantVersion) map[string][]*versioncompare.TolerantVersion {
+	series := make(map[string][]*versioncompare.TolerantVersion)
+	for _, version := range versions {
+		key := version.FormatComponents(kernelSeriesComponents)
+		series[key] = append(series[key], version)
+	}
+
+	for _, seriesVersions := range series {
+		sort.SliceStable(seriesVersions, func(i, j int) bool {
+			return seriesVersions[i].Compare(seriesVersions[j]) < 0
+		})
+	}
+
+	return series
+}
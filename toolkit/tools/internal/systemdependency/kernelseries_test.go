@@ -0,0 +1,41 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKernelsBySeries(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+	createTestKernel(t, rootfs, "6.1.0", "", "vmlinuz")
+	createTestKernel(t, rootfs, "5.15.153.1-2.cm2", "", "vmlinuz")
+	createTestKernel(t, rootfs, "5.15.0-1064-azure", "", "vmlinuz")
+
+	series, err := KernelsBySeries(rootfs)
+	assert.NoError(t, err)
+	assert.Len(t, series, 3)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"}, kernelVersionStrings(series["6.6"]))
+	assert.Equal(t, []string{"6.1.0"}, kernelVersionStrings(series["6.1"]))
+	assert.Equal(t, []string{"5.15.0-1064-azure", "5.15.153.1-2.cm2"}, kernelVersionStrings(series["5.15"]))
+}
+
+func TestKernelsBySeriesSingleKernel(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "vmlinuz")
+
+	series, err := KernelsBySeries(rootfs)
+	assert.NoError(t, err)
+	assert.Len(t, series, 1)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, kernelVersionStrings(series["6.6"]))
+}
+
+func TestKernelsBySeriesMissingModulesDir(t *testing.T) {
+	_, err := KernelsBySeries(t.TempDir())
+	assert.ErrorContains(t, err, "failed to read installed kernels list")
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// squashfsListRoot is the destination directory passed to 'unsquashfs -l', which prefixes each listed path.
+const squashfsListRoot = "squashfs-root"
+
+// squashfsKernelModulesDirs are the kernel modules directories, relative to the squashfs's root, that are listed. On
+// usr-merged images, /lib is a symlink that 'unsquashfs' doesn't follow. So, /usr/lib/modules is listed as well.
+var squashfsKernelModulesDirs = []string{
+	strings.TrimPrefix(KernelModulesDir, "/"),
+	"usr" + KernelModulesDir,
+}
+
+// GetInstalledKernelVersionsFromSquashfs returns the versions of the kernels installed in the rootfs image
+// 'squashfsPath' (e.g. the rootfs of a live or installer ISO), sorted by name. The squashfs's file listing is read with
+// 'unsquashfs -l'. So, nothing is mounted or extracted.
+//
+// The same as GetInstalledKernelVersions, empty kernel directories are skipped. A squashfs without a kernel modules
+// directory has no kernels.
+func GetInstalledKernelVersionsFromSquashfs(squashfsPath string) ([]*versioncompare.TolerantVersion, error) {
+	args := append([]string{"-d", squashfsListRoot, "-l", squashfsPath}, squashfsKernelModulesDirs...)
+
+	stdout, stderr, err := runner.Execute("unsquashfs", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list squashfs (%s):\n%v\n%w", squashfsPath, stderr, err)
+	}
+
+	return parseKernelVersions(parseSquashfsKernelListing(stdout))
+}
+
+// parseSquashfsKernelListing returns the names of the non-empty kernel directories in the output of 'unsquashfs -l',
+// sorted by name.
+func parseSquashfsKernelListing(listing string) []string {
+	kernels := make(map[string]bool)
+	for _, line := range strings.Split(listing, "\n") {
+		listedPath, found := strings.CutPrefix(strings.TrimSpace(line), squashfsListRoot+"/")
+		if !found {
+			continue
+		}
+
+		for _, modulesDir := range squashfsKernelModulesDirs {
+			kernelPath, found := strings.CutPrefix(listedPath, modulesDir+"/")
+			if !found {
+				continue
+			}
+
+			// Only a kernel directory with something in it is an installed kernel.
+			version, kernelFile, _ := strings.Cut(kernelPath, "/")
+			if version != "" && kernelFile != "" && !isKernelBackupDirName(version) {
+				kernels[version] = true
+			}
+		}
+	}
+
+	versions := make([]string, 0, len(kernels))
+	for version := range kernels {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	return versions
+}
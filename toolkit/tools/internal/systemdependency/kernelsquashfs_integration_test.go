@@ -0,0 +1,48 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//go:build squashfs
+
+package systemdependency
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Run with: go test -tags squashfs ./internal/systemdependency
+// Requires mksquashfs and unsquashfs (squashfs-tools).
+func TestGetInstalledKernelVersionsFromSquashfsImage(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", testModulesDep, "kernel/fs/fuse/fuse.ko.xz")
+	createTestKernel(t, rootfs, "6.6.51.1-1.azl3", testModulesDep)
+	createTestKernel(t, rootfs, "6.6.44.1-1.azl3", "")
+
+	squashfsPath := filepath.Join(t.TempDir(), "rootfs.img")
+	output, err := exec.Command("mksquashfs", rootfs, squashfsPath, "-noappend", "-quiet").CombinedOutput()
+	if !assert.NoError(t, err, string(output)) {
+		t.FailNow()
+	}
+
+	versions, err := GetInstalledKernelVersionsFromSquashfs(squashfsPath)
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		assert.Equal(t, "6.6.47.1-1.azl3", versions[0].String())
+		assert.Equal(t, "6.6.51.1-1.azl3", versions[1].String())
+	}
+}
+
+func TestGetInstalledKernelVersionsFromSquashfsImageNoModulesDir(t *testing.T) {
+	squashfsPath := filepath.Join(t.TempDir(), "rootfs.img")
+	output, err := exec.Command("mksquashfs", t.TempDir(), squashfsPath, "-noappend", "-quiet").CombinedOutput()
+	if !assert.NoError(t, err, string(output)) {
+		t.FailNow()
+	}
+
+	versions, err := GetInstalledKernelVersionsFromSquashfs(squashfsPath)
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSquashfsListCommand = "unsquashfs -d squashfs-root -l rootfs.img lib/modules usr/lib/modules"
+
+func TestGetInstalledKernelVersionsFromSquashfs(t *testing.T) {
+	setTestRunner(t, map[string]string{
+		testSquashfsListCommand: `squashfs-root
+squashfs-root/usr
+squashfs-root/usr/lib
+squashfs-root/usr/lib/modules
+squashfs-root/usr/lib/modules/6.6.51.1-1.azl3
+squashfs-root/usr/lib/modules/6.6.51.1-1.azl3/modules.dep
+squashfs-root/usr/lib/modules/6.6.47.1-1.azl3
+squashfs-root/usr/lib/modules/6.6.47.1-1.azl3/kernel
+squashfs-root/usr/lib/modules/6.6.47.1-1.azl3/kernel/fs/fuse/fuse.ko.xz
+squashfs-root/usr/lib/modules/6.6.44.1-1.azl3
+squashfs-root/usr/lib/modules/6.6.43.1-1.azl3.rpmmoved
+squashfs-root/usr/lib/modules/6.6.43.1-1.azl3.rpmmoved/modules.dep
+`,
+	})
+
+	versions, err := GetInstalledKernelVersionsFromSquashfs("rootfs.img")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		assert.Equal(t, "6.6.47.1-1.azl3", versions[0].String())
+		assert.Equal(t, "6.6.51.1-1.azl3", versions[1].String())
+	}
+}
+
+func TestGetInstalledKernelVersionsFromSquashfsNoModulesDir(t *testing.T) {
+	setTestRunner(t, map[string]string{
+		testSquashfsListCommand: "squashfs-root\n",
+	})
+
+	versions, err := GetInstalledKernelVersionsFromSquashfs("rootfs.img")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestGetInstalledKernelVersionsFromSquashfsError(t *testing.T) {
+	setTestRunner(t, map[string]string{})
+
+	_, err := GetInstalledKernelVersionsFromSquashfs("rootfs.img")
+	assert.ErrorContains(t, err, "failed to list squashfs (rootfs.img)")
+}
@@ -0,0 +1,32 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// KernelUpgradeSteps returns the versions in 'available' that a staged upgrade from kernel 'from' to kernel 'to' passes
+// through. That is, the versions greater than 'from' and less than or equal to 'to', in ascending order. Duplicate
+// versions in 'available' are only returned once. 'available' may be in any order.
+//
+// 'to' is only included if it is in 'available'. If 'from' and 'to' are equal, then there are no steps. An error is
+// returned if 'to' is less than 'from'.
+func KernelUpgradeSteps(from, to *versioncompare.TolerantVersion, available []*versioncompare.TolerantVersion,
+) ([]*versioncompare.TolerantVersion, error) {
+	if to.Compare(from) < 0 {
+		return nil, fmt.Errorf("kernel upgrade target (%s) is older than the current kernel (%s)", to, from)
+	}
+
+	steps := []*versioncompare.TolerantVersion(nil)
+	for _, version := range versioncompare.NewSet(available...).Sorted() {
+		if version.Compare(from) > 0 && version.Compare(to) <= 0 {
+			steps = append(steps, version)
+		}
+	}
+
+	return steps, nil
+}
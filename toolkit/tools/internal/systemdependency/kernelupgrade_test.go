@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVersions(versionStrings ...string) []*versioncompare.TolerantVersion {
+	versions := make([]*versioncompare.TolerantVersion, len(versionStrings))
+	for i, versionString := range versionStrings {
+		versions[i] = versioncompare.New(versionString)
+	}
+	return versions
+}
+
+func TestKernelUpgradeSteps(t *testing.T) {
+	available := newTestVersions("6.6.9.1-1.azl3", "6.6.29.1-1.azl3", "6.6.47.1-1.azl3", "6.6.51.1-1.azl3",
+		"6.6.57.1-1.azl3")
+
+	steps, err := KernelUpgradeSteps(versioncompare.New("6.6.9.1-1.azl3"), versioncompare.New("6.6.51.1-1.azl3"),
+		available)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.29.1-1.azl3", "6.6.47.1-1.azl3", "6.6.51.1-1.azl3"}, kernelVersionStrings(steps))
+}
+
+func TestKernelUpgradeStepsDescendingInput(t *testing.T) {
+	available := newTestVersions("6.6.57.1-1.azl3", "6.6.51.1-1.azl3", "6.6.47.1-1.azl3", "6.6.47.1-1.azl3",
+		"6.6.29.1-1.azl3")
+
+	steps, err := KernelUpgradeSteps(versioncompare.New("6.6.29.1-1.azl3"), versioncompare.New("6.6.57.1-1.azl3"),
+		available)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3", "6.6.57.1-1.azl3"}, kernelVersionStrings(steps))
+}
+
+func TestKernelUpgradeStepsNoIntermediate(t *testing.T) {
+	available := newTestVersions("6.6.9.1-1.azl3", "6.6.51.1-1.azl3")
+
+	steps, err := KernelUpgradeSteps(versioncompare.New("6.6.9.1-1.azl3"), versioncompare.New("6.6.51.1-1.azl3"),
+		available)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, kernelVersionStrings(steps))
+
+	// The target isn't available.
+	steps, err = KernelUpgradeSteps(versioncompare.New("6.6.9.1-1.azl3"), versioncompare.New("6.6.47.1-1.azl3"),
+		available)
+	assert.NoError(t, err)
+	assert.Empty(t, steps)
+}
+
+func TestKernelUpgradeStepsSameVersion(t *testing.T) {
+	steps, err := KernelUpgradeSteps(versioncompare.New("6.6.47.1-1.azl3"), versioncompare.New("6.6.47.1-1.azl3"),
+		newTestVersions("6.6.47.1-1.azl3"))
+	assert.NoError(t, err)
+	assert.Empty(t, steps)
+}
+
+func TestKernelUpgradeStepsDowngrade(t *testing.T) {
+	_, err := KernelUpgradeSteps(versioncompare.New("6.6.51.1-1.azl3"), versioncompare.New("6.6.47.1-1.azl3"),
+		newTestVersions("6.6.47.1-1.azl3", "6.6.51.1-1.azl3"))
+	assert.ErrorContains(t, err, "kernel upgrade target (6.6.47.1-1.azl3) is older than the current kernel "+
+		"(6.6.51.1-1.azl3)")
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// absentModulePrefix marks a signature module that must not be present for the variant to match.
+const absentModulePrefix = "!"
+
+// ClassifyKernelVariant returns the variant of kernel 'version' under 'rootfs', according to which of its modules are
+// present. 'signatureModules' maps each variant name to the modules (e.g. "hv_netvsc") that are characteristic of it.
+// A module prefixed with '!' (e.g. "!i915") must be absent instead. This allows kernels with the same flavor suffix,
+// but different contents, to be told apart.
+//
+// A variant matches if all of its signature modules are present (or absent). If several variants match, then the one
+// with the most signature modules (i.e. the most specific) is returned. An error is returned if no variant matches or
+// if the most specific match is ambiguous.
+func ClassifyKernelVariant(rootfs, version string, signatureModules map[string][]string) (string, error) {
+	modules, err := getKernelModuleNames(rootfs, version)
+	if err != nil {
+		return "", err
+	}
+
+	// Sort the variants so that the result doesn't depend on map order.
+	variants := make([]string, 0, len(signatureModules))
+	for variant := range signatureModules {
+		variants = append(variants, variant)
+	}
+	sort.Strings(variants)
+
+	matches := []string(nil)
+	bestSignatureLen := -1
+	for _, variant := range variants {
+		signature := signatureModules[variant]
+		if !kernelVariantMatches(modules, signature) {
+			continue
+		}
+
+		switch {
+		case len(signature) > bestSignatureLen:
+			matches = []string{variant}
+			bestSignatureLen = len(signature)
+
+		case len(signature) == bestSignatureLen:
+			matches = append(matches, variant)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("kernel (%s) doesn't match any kernel variant", version)
+
+	case 1:
+		return matches[0], nil
+
+	default:
+		return "", fmt.Errorf("kernel (%s) matches multiple kernel variants (%s)", version, strings.Join(matches, ", "))
+	}
+}
+
+// kernelVariantMatches returns true if each of the signature's modules is present in 'modules', or absent if it is
+// prefixed with '!'.
+func kernelVariantMatches(modules map[string]bool, signature []string) bool {
+	for _, module := range signature {
+		name, wantAbsent := strings.CutPrefix(module, absentModulePrefix)
+		if modules[normalizeModuleName(name)] == wantAbsent {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKernelVariantSignatures = map[string][]string{
+	"cloud":   {"hv_netvsc", "!i915"},
+	"desktop": {"i915"},
+	// More specific than "desktop".
+	"desktop-nvidia": {"i915", "nouveau"},
+}
+
+func TestClassifyKernelVariant(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "",
+		"kernel/drivers/net/hyperv/hv_netvsc.ko.xz",
+		"kernel/fs/overlayfs/overlay.ko.xz")
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3.desktop", "",
+		"kernel/drivers/net/hyperv/hv-netvsc.ko.xz",
+		"kernel/drivers/gpu/drm/i915/i915.ko.xz")
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3.nvidia", "",
+		"kernel/drivers/gpu/drm/i915/i915.ko",
+		"kernel/drivers/gpu/drm/nouveau/nouveau.ko")
+
+	variant, err := ClassifyKernelVariant(rootfs, "6.6.47.1-1.azl3", testKernelVariantSignatures)
+	assert.NoError(t, err)
+	assert.Equal(t, "cloud", variant)
+
+	variant, err = ClassifyKernelVariant(rootfs, "6.6.47.1-1.azl3.desktop", testKernelVariantSignatures)
+	assert.NoError(t, err)
+	assert.Equal(t, "desktop", variant)
+
+	variant, err = ClassifyKernelVariant(rootfs, "6.6.47.1-1.azl3.nvidia", testKernelVariantSignatures)
+	assert.NoError(t, err)
+	assert.Equal(t, "desktop-nvidia", variant)
+}
+
+func TestClassifyKernelVariantNoMatch(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "", "kernel/fs/overlayfs/overlay.ko.xz")
+
+	_, err := ClassifyKernelVariant(rootfs, "6.6.47.1-1.azl3", testKernelVariantSignatures)
+	assert.ErrorContains(t, err, "kernel (6.6.47.1-1.azl3) doesn't match any kernel variant")
+}
+
+func TestClassifyKernelVariantAmbiguous(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, "6.6.47.1-1.azl3", "",
+		"kernel/drivers/net/hyperv/hv_netvsc.ko.xz",
+		"kernel/drivers/net/ethernet/mellanox/mlx5/core/mlx5_core.ko.xz")
+
+	_, err := ClassifyKernelVariant(rootfs, "6.6.47.1-1.azl3", map[string][]string{
+		"azure":     {"hv_netvsc"},
+		"baremetal": {"mlx5_core"},
+	})
+	assert.ErrorContains(t, err, "matches multiple kernel variants (azure, baremetal)")
+}
+
+func TestClassifyKernelVariantMissingKernel(t *testing.T) {
+	_, err := ClassifyKernelVariant(t.TempDir(), "6.6.47.1-1.azl3", testKernelVariantSignatures)
+	assert.ErrorContains(t, err, "failed to scan kernel (6.6.47.1-1.azl3) modules")
+}
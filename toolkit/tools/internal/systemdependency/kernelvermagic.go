@@ -0,0 +1,78 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+)
+
+// The vermagic modinfo entry records the kernel release a module was built for, followed by the build options. For
+// example: "vermagic=6.6.47.1-1.azl3 SMP preempt mod_unload modversions".
+var modinfoVermagicTag = []byte("vermagic=")
+
+// errVermagicFound stops the module walk once a vermagic has been found.
+var errVermagicFound = errors.New("vermagic found")
+
+// GetKernelModulesVermagic returns the kernel release that the modules of kernel 'version' under 'rootfs' were built
+// for, according to the vermagic of a sample module.
+//
+// This is best-effort. Modules that can't be read (e.g. zstd compressed modules) are skipped. If no module could be
+// read, then 'found' is false.
+func GetKernelModulesVermagic(rootfs, version string) (release string, found bool, err error) {
+	kernelDir := filepath.Join(rootfs, KernelModulesDir, version)
+
+	err = filepath.WalkDir(kernelDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !isModuleFile(d.Name()) {
+			return nil
+		}
+
+		moduleRelease, err := readModuleVermagic(path)
+		if err != nil {
+			logger.Log.Debugf("Skipping vermagic read of module (%s): %s", path, err)
+			return nil
+		}
+
+		if moduleRelease == "" {
+			return nil
+		}
+
+		release = moduleRelease
+		return errVermagicFound
+	})
+	if errors.Is(err, errVermagicFound) {
+		return release, true, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to scan kernel (%s) modules for vermagic:\n%w", version, err)
+	}
+
+	return "", false, nil
+}
+
+// readModuleVermagic returns the kernel release in a module file's vermagic, or an empty string if the module doesn't
+// have one.
+func readModuleVermagic(modulePath string) (string, error) {
+	content, err := readModuleContent(modulePath)
+	if err != nil {
+		return "", err
+	}
+
+	vermagics := readModinfoValues(content, modinfoVermagicTag)
+	if len(vermagics) <= 0 {
+		return "", nil
+	}
+
+	release, _, _ := strings.Cut(vermagics[0], " ")
+	return release, nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetKernelModulesVermagic(t *testing.T) {
+	rootfs := t.TempDir()
+	kernelDir := createTestKernel(t, rootfs, testKernelVersion, "")
+	writeTestFile(t, filepath.Join(kernelDir, "kernel/fs/ext4/ext4.ko"),
+		fakeModinfo("license=GPL", "vermagic=6.6.47.1-1.azl3 SMP preempt mod_unload modversions"))
+
+	release, found, err := GetKernelModulesVermagic(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "6.6.47.1-1.azl3", release)
+}
+
+func TestGetKernelModulesVermagicSkipsUnreadableModules(t *testing.T) {
+	rootfs := t.TempDir()
+	kernelDir := createTestKernel(t, rootfs, testKernelVersion, "")
+	writeTestFile(t, filepath.Join(kernelDir, "kernel/a/a.ko.zst"), []byte("not readable"))
+	writeTestFile(t, filepath.Join(kernelDir, "kernel/b/b.ko"), fakeModinfo("license=GPL"))
+	writeTestFile(t, filepath.Join(kernelDir, "kernel/c/c.ko"), fakeModinfo("vermagic=6.6.51.1-1.azl3 SMP"))
+
+	release, found, err := GetKernelModulesVermagic(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "6.6.51.1-1.azl3", release)
+}
+
+func TestGetKernelModulesVermagicNoModules(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, "", "kernel/a/a.ko.zst")
+
+	_, found, err := GetKernelModulesVermagic(rootfs, testKernelVersion)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestGetKernelModulesVermagicMissingKernel(t *testing.T) {
+	_, _, err := GetKernelModulesVermagic(t.TempDir(), testKernelVersion)
+	assert.ErrorContains(t, err, "failed to scan kernel (6.6.47.1-1.azl3) modules for vermagic")
+}
@@ -0,0 +1,331 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+var (
+	// Kernel release strings (as reported by 'uname -r' and used for the /lib/modules/<ver> directory names) start
+	// with at least 3 numeric components and are optionally followed by a '-' and a free-form suffix. For example:
+	//
+	//	6.6.47.1-1.azl3
+	//	5.15.153.1-2.cm2
+	//	6.11.6-200.fc40.x86_64
+	//	5.15.0-1064-azure
+	//	6.6.44.1-1.azl3-rt
+	//	6.1.0
+	//
+	// Group 1 is the numeric version and group 2 is the suffix.
+	kernelVersionRegex = regexp.MustCompile(`^(\d+\.\d+\.\d+(?:\.\d+)*)(?:-([0-9A-Za-z_.+~-]+))?$`)
+
+	// An RPM style epoch prefix. For example: "1:6.6.47.1-1.azl3".
+	kernelEpochRegex = regexp.MustCompile(`^(\d+):`)
+
+	// The leading numeric part of a release suffix, which distributions bump when the kernel's ABI changes. For example:
+	// "1064" in "1064-azure" and "70.13.1" in "70.13.1.rt21.83.el9_0".
+	kernelAbiRegex = regexp.MustCompile(`^\d+(?:\.\d+)*`)
+
+	// The distribution tags that RPM based distributions append to the ABI number. For example: "azl3" in
+	// "6.6.47.1-1.azl3" and "el9_0" in "5.14.0-70.13.1.el9_0".
+	kernelDistTagRegex = regexp.MustCompile(`^(?:azl|cm|fc|el|amzn|mga|ph)\d+(?:_\d+)*$`)
+
+	// A RHEL/Fedora style real-time build tag. For example: "rt21" in "5.14.0-70.13.1.rt21.83.el9_0.x86_64".
+	realtimeBuildTagRegex = regexp.MustCompile(`^rt\d+$`)
+)
+
+// kernelArchitectures are the architecture names that RPM based distributions (e.g. Fedora) append to the kernel
+// release string. For example: "6.11.6-200.fc40.x86_64".
+var kernelArchitectures = []string{
+	"x86_64",
+	"aarch64",
+	"i386",
+	"i586",
+	"i686",
+	"armv7hl",
+	"ppc64",
+	"ppc64le",
+	"riscv64",
+	"s390x",
+}
+
+// ParsedKernelRelease holds the parts of a kernel release string (as reported by 'uname -r').
+//
+// For example, "6.6.44.1-1.azl3-rt" is parsed into the components [6 6 44 1], the ABI "1", the flavor "rt" and no
+// arch. And "6.11.6-200.fc40.x86_64" is parsed into the components [6 11 6], the ABI "200", no flavor and the arch
+// "x86_64". And "6.6.47.1-1.2.3.azl3.custom" is parsed into the components [6 6 47 1], the ABI "1.2.3", the flavor
+// "custom" and no arch.
+type ParsedKernelRelease struct {
+	// Raw is the full release string.
+	Raw string
+	// Components are the numeric components of the upstream kernel version. For example: [6 6 47 1].
+	Components []uint64
+	// ABI is the distribution's ABI bump number, if present. For example: "1064" in "5.15.0-1064-azure".
+	ABI string
+	// Flavor is the kernel variant, if present. For example: "azure" in "5.15.0-1064-azure", "rt" in
+	// "6.6.44.1-1.azl3-rt" or "custom.v2" in "6.6.47.1-1.azl3.custom.v2".
+	Flavor string
+	// Arch is the CPU architecture, if present. For example: "x86_64" in "6.11.6-200.fc40.x86_64".
+	Arch string
+	// Realtime is true if the release identifies a PREEMPT_RT real-time kernel. See IsRealtimeKernel.
+	Realtime bool
+}
+
+// ParseKernelRelease splits a kernel release string (e.g. "5.15.0-1064-azure") into its parts.
+//
+// The release's suffix is interpreted as: [<abi>[.<dist>[.<vendor>]]][-<flavor>][.<arch>]. If the suffix doesn't start
+// with an ABI number, then the whole suffix (less any arch) is the flavor.
+//
+// Only the leading numeric components of the ABI are compared. Vendor kernels may append their own dotted flavor after
+// a known distribution tag (e.g. ".custom" in "6.6.47.1-1.2.3.azl3.custom"), which becomes part of the flavor. If the
+// distribution tag isn't recognized, everything after the ABI is treated as the distribution tag.
+func ParseKernelRelease(release string) (ParsedKernelRelease, error) {
+	match := kernelVersionRegex.FindStringSubmatch(release)
+	if match == nil {
+		return ParsedKernelRelease{}, fmt.Errorf("failed to parse kernel version (%s)", release)
+	}
+
+	parsed := ParsedKernelRelease{
+		Raw: release,
+	}
+
+	for _, component := range strings.Split(match[1], ".") {
+		value, err := strconv.ParseUint(component, 10, 64)
+		if err != nil {
+			return ParsedKernelRelease{}, fmt.Errorf("failed to parse kernel version (%s):\n%w", release, err)
+		}
+
+		parsed.Components = append(parsed.Components, value)
+	}
+
+	suffix, arch := cutKernelArch(match[2])
+	parsed.Arch = arch
+
+	abiRelease, flavor, _ := strings.Cut(suffix, "-")
+
+	parsed.ABI = kernelAbiRegex.FindString(abiRelease)
+	if parsed.ABI == "" {
+		// There is no ABI number. So, treat the whole suffix as the flavor. For example: "6.1.0-rpi".
+		flavor = suffix
+	}
+
+	vendorFlavor := parseKernelVendorFlavor(strings.TrimPrefix(abiRelease, parsed.ABI))
+	if vendorFlavor != "" && flavor != "" {
+		flavor = vendorFlavor + "-" + flavor
+	} else if vendorFlavor != "" {
+		flavor = vendorFlavor
+	}
+
+	parsed.Flavor = flavor
+	parsed.Realtime = IsRealtimeKernel(release)
+
+	return parsed, nil
+}
+
+// String returns the numeric upstream version of the release, without the ABI, flavor or arch. For example:
+// "6.6.44.1" for "6.6.44.1-1.azl3-rt". Use FullString for the whole release string.
+func (r ParsedKernelRelease) String() string {
+	components := make([]string, len(r.Components))
+	for i, component := range r.Components {
+		components[i] = strconv.FormatUint(component, 10)
+	}
+
+	return strings.Join(components, ".")
+}
+
+// FullString returns the whole release string (i.e. uname -r), including the ABI, distribution tag, flavor and arch.
+// For example: "6.6.44.1-1.azl3-rt". This is exactly the string that was parsed. So, it can be parsed again with
+// ParseKernelRelease.
+func (r ParsedKernelRelease) FullString() string {
+	return r.Raw
+}
+
+// SplitKernelArch splits the arch suffix from a kernel release string. For example, "6.11.6-200.fc40.x86_64" is split
+// into "6.11.6-200.fc40" and "x86_64". If the release doesn't have an arch suffix, it is returned unchanged along with
+// an empty arch.
+//
+// Kernels of the same version, but built for different arches, have the same release once the arch is split off.
+func SplitKernelArch(release string) (string, string) {
+	version, suffix, found := strings.Cut(release, "-")
+	if !found {
+		return release, ""
+	}
+
+	suffix, arch := cutKernelArch(suffix)
+	return version + "-" + suffix, arch
+}
+
+// cutKernelArch splits a known arch (e.g. ".x86_64") from the end of a kernel release suffix.
+func cutKernelArch(suffix string) (string, string) {
+	for _, arch := range kernelArchitectures {
+		trimmed, found := strings.CutSuffix(suffix, "."+arch)
+		if found {
+			return trimmed, arch
+		}
+	}
+
+	return suffix, ""
+}
+
+// parseKernelVendorFlavor returns the components that follow the last known distribution tag in 'distAndVendor' (e.g.
+// "custom.v2" in ".azl3.custom.v2"), or an empty string if there are none.
+func parseKernelVendorFlavor(distAndVendor string) string {
+	components := strings.Split(strings.TrimPrefix(distAndVendor, "."), ".")
+	for i := len(components) - 1; i >= 0; i-- {
+		if kernelDistTagRegex.MatchString(components[i]) {
+			return strings.Join(components[i+1:], ".")
+		}
+	}
+
+	return ""
+}
+
+// CompareRelease compares two kernel release strings (optionally prefixed with an RPM style epoch, like "1:") and
+// returns -1, 0 or 1 if 'a' is less than, equal to or greater than 'b'.
+//
+// The parts of the releases are compared in the following order of precedence, and the first difference decides the
+// result:
+//  1. Epoch: compared numerically. A missing epoch is 0.
+//  2. Upstream version: the numeric components are compared one by one. If one version is a prefix of the other, the
+//     shorter one is less (e.g. "6.6.47" < "6.6.47.1").
+//  3. Build (i.e. the ABI number, like "1064" in "5.15.0-1064-azure"): compared as a version. A release without a
+//     build is less than one with a build.
+//  4. Flavor: only used as a tiebreaker. A release without a flavor is less than one with a flavor. Otherwise the
+//     flavors are compared alphabetically.
+//
+// The distro tag (e.g. "azl3") and the arch never affect the result.
+func CompareRelease(a string, b string) (int, error) {
+	aEpoch, aRelease, err := parseEpochRelease(a)
+	if err != nil {
+		return 0, err
+	}
+
+	bEpoch, bRelease, err := parseEpochRelease(b)
+	if err != nil {
+		return 0, err
+	}
+
+	if result := compareUint64(aEpoch, bEpoch); result != versioncompare.EqualTo {
+		return result, nil
+	}
+
+	for i := 0; i < len(aRelease.Components) && i < len(bRelease.Components); i++ {
+		if result := compareUint64(aRelease.Components[i], bRelease.Components[i]); result != versioncompare.EqualTo {
+			return result, nil
+		}
+	}
+
+	result := compareUint64(uint64(len(aRelease.Components)), uint64(len(bRelease.Components)))
+	if result != versioncompare.EqualTo {
+		return result, nil
+	}
+
+	switch {
+	case aRelease.ABI == "" && bRelease.ABI != "":
+		return versioncompare.LessThan, nil
+	case aRelease.ABI != "" && bRelease.ABI == "":
+		return versioncompare.GreatherThan, nil
+	case aRelease.ABI != "":
+		result = versioncompare.New(aRelease.ABI).Compare(versioncompare.New(bRelease.ABI))
+		if result != versioncompare.EqualTo {
+			return result, nil
+		}
+	}
+
+	return strings.Compare(aRelease.Flavor, bRelease.Flavor), nil
+}
+
+// parseEpochRelease splits an optional RPM style epoch from a kernel release string and parses both.
+func parseEpochRelease(release string) (uint64, ParsedKernelRelease, error) {
+	epoch := uint64(0)
+
+	epochMatch := kernelEpochRegex.FindStringSubmatch(release)
+	if epochMatch != nil {
+		var err error
+		epoch, err = strconv.ParseUint(epochMatch[1], 10, 64)
+		if err != nil {
+			return 0, ParsedKernelRelease{}, fmt.Errorf("failed to parse kernel version (%s):\n%w", release, err)
+		}
+	}
+
+	parsed, err := ParseKernelRelease(strings.TrimPrefix(release, kernelEpochRegex.FindString(release)))
+	if err != nil {
+		return 0, ParsedKernelRelease{}, fmt.Errorf("failed to parse kernel version (%s)", release)
+	}
+
+	return epoch, parsed, nil
+}
+
+func compareUint64(a uint64, b uint64) int {
+	switch {
+	case a < b:
+		return versioncompare.LessThan
+	case a > b:
+		return versioncompare.GreatherThan
+	default:
+		return versioncompare.EqualTo
+	}
+}
+
+// RealtimeKernelTokens are the suffix tokens (compared case-insensitively) that identify a PREEMPT_RT real-time kernel.
+// Callers may append to this list to recognize additional vendor naming schemes.
+var RealtimeKernelTokens = []string{
+	"rt",
+	"preempt_rt",
+	"realtime",
+}
+
+// parseKernelVersion parses a kernel release string into a comparable version.
+//
+// An optional RPM style epoch (e.g. "1:") may prefix the release string. The epoch is retained in the returned version
+// and takes precedence over the rest of the version when comparing. A missing epoch is treated as 0.
+//
+// The arch suffix (e.g. ".x86_64") doesn't affect comparisons, so that kernels of the same version built for different
+// arches are equal. The returned version's String() is still the full release string. Use SplitKernelArch or
+// ParseKernelRelease to get the arch.
+func parseKernelVersion(kernelVersionString string) (*versioncompare.TolerantVersion, error) {
+	releaseString := kernelEpochRegex.ReplaceAllString(kernelVersionString, "")
+
+	_, err := ParseKernelRelease(releaseString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kernel version (%s)", kernelVersionString)
+	}
+
+	comparableVersion, _ := SplitKernelArch(kernelVersionString)
+	return versioncompare.NewWithOriginal(comparableVersion, kernelVersionString), nil
+}
+
+// IsRealtimeKernel returns true if the kernel release string identifies a PREEMPT_RT real-time kernel flavor.
+// For example: "6.6.44.1-1.azl3-rt", "5.15.0-1032-realtime", "5.14.0-70.13.1.rt21.83.el9_0.x86_64".
+func IsRealtimeKernel(versionString string) bool {
+	_, suffix, found := strings.Cut(versionString, "-")
+	if !found {
+		return false
+	}
+
+	tokens := strings.FieldsFunc(suffix, func(r rune) bool {
+		return r == '.' || r == '-' || r == '+' || r == '~'
+	})
+
+	for _, token := range tokens {
+		token = strings.ToLower(token)
+		if realtimeBuildTagRegex.MatchString(token) {
+			return true
+		}
+
+		for _, realtimeToken := range RealtimeKernelTokens {
+			if token == strings.ToLower(realtimeToken) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,314 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKernelVersion(t *testing.T) {
+	for _, release := range []string{
+		"6.6.47.1-1.azl3",
+		"5.15.153.1-2.cm2",
+		"6.11.6-200.fc40.x86_64",
+		"5.15.0-1064-azure",
+		"6.6.44.1-1.azl3-rt",
+		"6.1.0",
+	} {
+		version, err := parseKernelVersion(release)
+		if assert.NoError(t, err, release) {
+			assert.Equal(t, release, version.String())
+		}
+	}
+}
+
+func TestParseKernelVersionInvalid(t *testing.T) {
+	for _, release := range []string{
+		"",
+		"6.6",
+		"abc",
+		"v6.6.47",
+		"6.6.47 1-1",
+		"6.6.47-",
+	} {
+		_, err := parseKernelVersion(release)
+		assert.ErrorContains(t, err, "failed to parse kernel version", release)
+	}
+}
+
+func TestParseKernelVersionEpoch(t *testing.T) {
+	version, err := parseKernelVersion("1:6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+	assert.Equal(t, "1:6.6.47.1-1.azl3", version.String())
+
+	noEpochVersion, err := parseKernelVersion("6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version.Compare(noEpochVersion))
+}
+
+func TestParseKernelVersionEpochOrdering(t *testing.T) {
+	high, err := parseKernelVersion("1:6.6.0")
+	assert.NoError(t, err)
+
+	low, err := parseKernelVersion("0:6.7.0")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, high.Compare(low))
+	assert.Equal(t, -1, low.Compare(high))
+}
+
+func TestParseKernelVersionZeroEpochEqualsNoEpoch(t *testing.T) {
+	withEpoch, err := parseKernelVersion("0:6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+
+	withoutEpoch, err := parseKernelVersion("6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, withEpoch.Compare(withoutEpoch))
+}
+
+func TestParseKernelVersionIgnoresArch(t *testing.T) {
+	x86, err := parseKernelVersion("6.11.6-200.fc40.x86_64")
+	assert.NoError(t, err)
+
+	arm, err := parseKernelVersion("6.11.6-200.fc40.aarch64")
+	assert.NoError(t, err)
+
+	// The versions are equal, but the full release strings, and so the arches, are kept.
+	assert.Equal(t, 0, x86.Compare(arm))
+	assert.Equal(t, 0, arm.Compare(x86))
+	assert.Equal(t, "6.11.6-200.fc40.x86_64", x86.String())
+	assert.Equal(t, "6.11.6-200.fc40.aarch64", arm.String())
+
+	_, x86Arch := SplitKernelArch(x86.String())
+	_, armArch := SplitKernelArch(arm.String())
+	assert.Equal(t, "x86_64", x86Arch)
+	assert.Equal(t, "aarch64", armArch)
+
+	// Versions still differ when the release does.
+	newer, err := parseKernelVersion("6.11.6-201.fc40.aarch64")
+	assert.NoError(t, err)
+	assert.Equal(t, -1, x86.Compare(newer))
+}
+
+func TestSplitKernelArch(t *testing.T) {
+	tests := []struct {
+		release         string
+		expectedVersion string
+		expectedArch    string
+	}{
+		{"6.11.6-200.fc40.x86_64", "6.11.6-200.fc40", "x86_64"},
+		{"5.14.0-70.13.1.rt21.83.el9_0.aarch64", "5.14.0-70.13.1.rt21.83.el9_0", "aarch64"},
+		{"1:6.11.6-200.fc40.ppc64le", "1:6.11.6-200.fc40", "ppc64le"},
+		{"6.6.47.1-1.azl3", "6.6.47.1-1.azl3", ""},
+		{"5.15.0-1064-azure", "5.15.0-1064-azure", ""},
+		{"6.1.0", "6.1.0", ""},
+	}
+
+	for _, test := range tests {
+		version, arch := SplitKernelArch(test.release)
+		assert.Equal(t, test.expectedVersion, version, test.release)
+		assert.Equal(t, test.expectedArch, arch, test.release)
+	}
+}
+
+func TestParseKernelRelease(t *testing.T) {
+	tests := []ParsedKernelRelease{
+		{Raw: "6.6.47.1-1.azl3", Components: []uint64{6, 6, 47, 1}, ABI: "1"},
+		{Raw: "5.15.153.1-2.cm2", Components: []uint64{5, 15, 153, 1}, ABI: "2"},
+		{Raw: "6.11.6-200.fc40.x86_64", Components: []uint64{6, 11, 6}, ABI: "200", Arch: "x86_64"},
+		{Raw: "5.15.0-1064-azure", Components: []uint64{5, 15, 0}, ABI: "1064", Flavor: "azure"},
+		{Raw: "6.6.44.1-1.azl3-rt", Components: []uint64{6, 6, 44, 1}, ABI: "1", Flavor: "rt", Realtime: true},
+		{Raw: "5.15.0-1032-realtime", Components: []uint64{5, 15, 0}, ABI: "1032", Flavor: "realtime", Realtime: true},
+		{Raw: "6.1.0-PREEMPT_RT", Components: []uint64{6, 1, 0}, Flavor: "PREEMPT_RT", Realtime: true},
+		{Raw: "6.1.0-rtx", Components: []uint64{6, 1, 0}, Flavor: "rtx"},
+		{Raw: "6.1.0", Components: []uint64{6, 1, 0}},
+		{Raw: "6.1.0-18-amd64", Components: []uint64{6, 1, 0}, ABI: "18", Flavor: "amd64"},
+		{Raw: "6.1.0-rpi", Components: []uint64{6, 1, 0}, Flavor: "rpi"},
+		{
+			Raw: "5.14.0-70.13.1.rt21.83.el9_0.aarch64", Components: []uint64{5, 14, 0}, ABI: "70.13.1",
+			Arch: "aarch64", Realtime: true,
+		},
+	}
+
+	for _, expected := range tests {
+		parsed, err := ParseKernelRelease(expected.Raw)
+		if assert.NoError(t, err, expected.Raw) {
+			assert.Equal(t, expected, parsed, expected.Raw)
+		}
+	}
+}
+
+func TestParseKernelReleaseVendorFlavor(t *testing.T) {
+	tests := []ParsedKernelRelease{
+		{Raw: "6.6.47.1-1.2.3.azl3.custom", Components: []uint64{6, 6, 47, 1}, ABI: "1.2.3", Flavor: "custom"},
+		{Raw: "6.6.47.1-1.azl3.custom.v2", Components: []uint64{6, 6, 47, 1}, ABI: "1", Flavor: "custom.v2"},
+		{
+			Raw: "6.6.47.1-1.2.3.azl3.acme.build7.x86_64", Components: []uint64{6, 6, 47, 1}, ABI: "1.2.3",
+			Flavor: "acme.build7", Arch: "x86_64",
+		},
+		{
+			Raw: "6.6.47.1-1.2.azl3.custom-rt", Components: []uint64{6, 6, 47, 1}, ABI: "1.2", Flavor: "custom-rt",
+			Realtime: true,
+		},
+		{Raw: "6.6.47.1-4.5.6.7.8.azl3", Components: []uint64{6, 6, 47, 1}, ABI: "4.5.6.7.8"},
+
+		// Without a known distribution tag, the remainder is treated as the distribution tag.
+		{Raw: "6.6.47.1-1.2.3.acme.custom", Components: []uint64{6, 6, 47, 1}, ABI: "1.2.3"},
+	}
+
+	for _, expected := range tests {
+		parsed, err := ParseKernelRelease(expected.Raw)
+		if assert.NoError(t, err, expected.Raw) {
+			assert.Equal(t, expected, parsed, expected.Raw)
+		}
+	}
+}
+
+func TestParsedKernelReleaseString(t *testing.T) {
+	// The examples of kernelVersionRegex's doc comment.
+	tests := map[string]string{
+		"6.6.47.1-1.azl3":        "6.6.47.1",
+		"5.15.153.1-2.cm2":       "5.15.153.1",
+		"6.11.6-200.fc40.x86_64": "6.11.6",
+		"5.15.0-1064-azure":      "5.15.0",
+		"6.6.44.1-1.azl3-rt":     "6.6.44.1",
+		"6.1.0":                  "6.1.0",
+	}
+
+	for release, expected := range tests {
+		parsed, err := ParseKernelRelease(release)
+		if !assert.NoError(t, err, release) {
+			continue
+		}
+
+		assert.Equal(t, expected, parsed.String(), release)
+		assert.Equal(t, release, parsed.FullString(), release)
+
+		reparsed, err := ParseKernelRelease(parsed.FullString())
+		assert.NoError(t, err, release)
+		assert.Equal(t, parsed, reparsed, release)
+	}
+}
+
+func TestParseKernelReleaseInvalid(t *testing.T) {
+	for _, release := range []string{
+		"",
+		"6.6",
+		"1:6.6.47.1-1.azl3",
+		"6.6.47-",
+		"6.6.99999999999999999999999",
+	} {
+		_, err := ParseKernelRelease(release)
+		assert.ErrorContains(t, err, "failed to parse kernel version", release)
+	}
+}
+
+func TestIsRealtimeKernel(t *testing.T) {
+	for _, release := range []string{
+		"6.6.44.1-1.azl3-rt",
+		"6.6.44.1-1.azl3+rt",
+		"5.15.0-1032-realtime",
+		"5.14.0-70.13.1.rt21.83.el9_0.x86_64",
+		"6.1.0-PREEMPT_RT",
+	} {
+		assert.True(t, IsRealtimeKernel(release), release)
+	}
+}
+
+func TestIsRealtimeKernelStandard(t *testing.T) {
+	for _, release := range []string{
+		"6.6.47.1-1.azl3",
+		"5.15.153.1-2.cm2",
+		"6.11.6-200.fc40.x86_64",
+		"5.15.0-1064-azure",
+		"6.1.0",
+		"6.1.0-sort",
+		"6.1.0-rtx",
+	} {
+		assert.False(t, IsRealtimeKernel(release), release)
+	}
+}
+
+func TestIsRealtimeKernelCustomToken(t *testing.T) {
+	originalTokens := RealtimeKernelTokens
+	RealtimeKernelTokens = append(append([]string(nil), RealtimeKernelTokens...), "lowlatency")
+	t.Cleanup(func() {
+		RealtimeKernelTokens = originalTokens
+	})
+
+	assert.True(t, IsRealtimeKernel("6.8.0-31-lowlatency"))
+}
+
+func TestCompareRelease(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		// Identical.
+		{"6.6.47.1-1.azl3", "6.6.47.1-1.azl3", 0},
+		{"6.1.0", "6.1.0", 0},
+
+		// Epoch takes precedence over everything else.
+		{"1:6.6.0", "0:6.7.0", 1},
+		{"1:6.6.0", "6.7.0", 1},
+		{"0:6.6.47.1-1.azl3", "6.6.47.1-1.azl3", 0},
+		{"2:5.15.0-1-azure", "10:5.15.0-1-azure", -1},
+
+		// Upstream version.
+		{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3", -1},
+		{"6.10.0", "6.9.0", 1},
+		{"5.15.153.1-2.cm2", "6.6.47.1-1.azl3", -1},
+		{"6.6.47-1", "6.6.47.1-1", -1},
+		{"6.6.47.1-9", "6.6.47-10", 1},
+
+		// Build (ABI) number.
+		{"6.6.47.1-1.azl3", "6.6.47.1-2.azl3", -1},
+		{"5.15.0-1064-azure", "5.15.0-1070-azure", -1},
+		{"5.15.0-999-azure", "5.15.0-1000-azure", -1},
+		{"5.14.0-70.13.1.el9_0.x86_64", "5.14.0-70.2.1.el9_0.x86_64", 1},
+		{"6.1.0", "6.1.0-1", -1},
+
+		// Flavor is only a tiebreaker.
+		{"6.6.44.1-1.azl3", "6.6.44.1-1.azl3-rt", -1},
+		{"5.15.0-1064-azure", "5.15.0-1064-generic", -1},
+		{"5.15.0-1065-azure", "5.15.0-1064-generic", 1},
+		{"6.6.44.1-2.azl3", "6.6.44.1-1.azl3-rt", 1},
+
+		// The numeric parts of a deeply dotted vendor suffix are compared, the rest is the flavor.
+		{"6.6.47.1-1.2.3.azl3.custom", "6.6.47.1-1.2.4.azl3.custom", -1},
+		{"6.6.47.1-1.2.10.azl3.custom", "6.6.47.1-1.2.9.azl3.custom", 1},
+		{"6.6.47.1-1.2.3.azl3", "6.6.47.1-1.2.3.azl3.custom", -1},
+		{"6.6.47.1-1.2.3.azl3.custom", "6.6.47.1-1.2.3.cm2.custom", 0},
+
+		// Distro tag and arch are ignored.
+		{"6.6.47.1-1.azl3", "6.6.47.1-1.cm2", 0},
+		{"6.11.6-200.fc40.x86_64", "6.11.6-200.fc40.aarch64", 0},
+		{"6.11.6-200.fc40.x86_64", "6.11.6-200.fc40", 0},
+	}
+
+	for _, test := range tests {
+		result, err := CompareRelease(test.a, test.b)
+		if assert.NoError(t, err, "%s vs %s", test.a, test.b) {
+			assert.Equal(t, test.expected, result, "%s vs %s", test.a, test.b)
+		}
+
+		// The comparison is antisymmetric.
+		result, err = CompareRelease(test.b, test.a)
+		if assert.NoError(t, err, "%s vs %s", test.b, test.a) {
+			assert.Equal(t, -test.expected, result, "%s vs %s", test.b, test.a)
+		}
+	}
+}
+
+func TestCompareReleaseInvalid(t *testing.T) {
+	_, err := CompareRelease("6.6", "6.6.47.1-1.azl3")
+	assert.ErrorContains(t, err, "failed to parse kernel version (6.6)")
+
+	_, err = CompareRelease("6.6.47.1-1.azl3", "x:6.6.47")
+	assert.ErrorContains(t, err, "failed to parse kernel version (x:6.6.47)")
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// DefaultKernelModulesPollInterval is how often WaitForKernelModules checks the kernel's modules directory.
+const DefaultKernelModulesPollInterval = 100 * time.Millisecond
+
+// errModuleFound stops the module walk once a module has been found.
+var errModuleFound = errors.New("module found")
+
+// WaitForKernelModules waits until the modules directory of kernel 'version' under 'rootfs' contains at least one
+// module file. This is useful when the kernel is still being installed by another process (e.g. depmod is still
+// running), so that the kernel isn't mistaken for an empty one.
+//
+// The directory is checked every DefaultKernelModulesPollInterval. An error is returned if the directory still doesn't
+// contain any modules after 'timeout'. The directory not existing yet isn't an error.
+func WaitForKernelModules(rootfs string, version string, timeout time.Duration) error {
+	return WaitForKernelModulesWithInterval(rootfs, version, timeout, DefaultKernelModulesPollInterval)
+}
+
+// WaitForKernelModulesWithInterval is the same as WaitForKernelModules but checks the directory every 'interval'.
+func WaitForKernelModulesWithInterval(rootfs string, version string, timeout time.Duration,
+	interval time.Duration,
+) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid kernel modules poll interval (%s): must be positive", interval)
+	}
+
+	kernelDir := filepath.Join(rootfs, KernelModulesDir, version)
+	deadline := time.Now().Add(timeout)
+
+	for {
+		found, err := kernelDirHasModules(kernelDir)
+		if err != nil {
+			return err
+		}
+
+		if found {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("timed out after %s waiting for kernel (%s) modules in (%s)", timeout, version, kernelDir)
+		}
+
+		time.Sleep(min(interval, remaining))
+	}
+}
+
+// kernelDirHasModules returns true if the kernel modules directory 'kernelDir' contains at least one module file.
+func kernelDirHasModules(kernelDir string) (bool, error) {
+	err := filepath.WalkDir(kernelDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !isModuleFile(d.Name()) {
+			return nil
+		}
+
+		return errModuleFound
+	})
+	switch {
+	case errors.Is(err, errModuleFound):
+		return true, nil
+
+	case errors.Is(err, fs.ErrNotExist):
+		// The directory (or one of its subdirectories) may not have been created yet, or may have been replaced
+		// mid-walk.
+		return false, nil
+
+	case err != nil:
+		return false, fmt.Errorf("failed to scan kernel modules directory (%s):\n%w", kernelDir, err)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForKernelModulesAlreadyPopulated(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, "", "kernel/fs/fuse/fuse.ko.xz")
+
+	err := WaitForKernelModules(rootfs, testKernelVersion, 0)
+	assert.NoError(t, err)
+}
+
+func TestWaitForKernelModulesDelayed(t *testing.T) {
+	rootfs := t.TempDir()
+
+	// The kernel directory is created, but the modules are only written after a short delay.
+	createTestKernel(t, rootfs, testKernelVersion, "")
+
+	populated := make(chan struct{})
+	go func() {
+		defer close(populated)
+		time.Sleep(50 * time.Millisecond)
+		createTestKernel(t, rootfs, testKernelVersion, "", "kernel/fs/fuse/fuse.ko.xz")
+	}()
+
+	err := WaitForKernelModulesWithInterval(rootfs, testKernelVersion, 10*time.Second, 10*time.Millisecond)
+	assert.NoError(t, err)
+
+	<-populated
+}
+
+func TestWaitForKernelModulesTimeout(t *testing.T) {
+	rootfs := t.TempDir()
+	createTestKernel(t, rootfs, testKernelVersion, testModulesDep)
+
+	err := WaitForKernelModulesWithInterval(rootfs, testKernelVersion, 30*time.Millisecond, 10*time.Millisecond)
+	assert.ErrorContains(t, err, "timed out after 30ms waiting for kernel (6.6.47.1-1.azl3) modules")
+
+	// A missing directory is waited on as well.
+	err = WaitForKernelModulesWithInterval(t.TempDir(), testKernelVersion, 0, 10*time.Millisecond)
+	assert.ErrorContains(t, err, "timed out")
+}
+
+func TestWaitForKernelModulesInvalidInterval(t *testing.T) {
+	err := WaitForKernelModulesWithInterval(t.TempDir(), testKernelVersion, time.Second, 0)
+	assert.ErrorContains(t, err, "invalid kernel modules poll interval")
+}
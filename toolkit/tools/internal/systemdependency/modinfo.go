@@ -0,0 +1,72 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// readModuleContent returns the decompressed content of a kernel module file.
+func readModuleContent(modulePath string) ([]byte, error) {
+	moduleFile, err := os.Open(modulePath)
+	if err != nil {
+		return nil, err
+	}
+	defer moduleFile.Close()
+
+	var reader io.Reader
+	switch {
+	case strings.HasSuffix(modulePath, ".ko"):
+		reader = moduleFile
+
+	case strings.HasSuffix(modulePath, ".ko.xz"):
+		reader, err = xz.NewReader(moduleFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open xz stream:\n%w", err)
+		}
+
+	case strings.HasSuffix(modulePath, ".ko.gz"):
+		gzipReader, err := gzip.NewReader(moduleFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream:\n%w", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+
+	default:
+		return nil, fmt.Errorf("unsupported module compression")
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module:\n%w", err)
+	}
+
+	return content, nil
+}
+
+// readModinfoValues returns the non-empty values of the modinfo entries with the tag 'tag' (e.g. "firmware=").
+//
+// The .modinfo section of a module stores "key=value" strings separated by null characters. Instead of parsing the
+// ELF file, the whole module is scanned for these strings.
+func readModinfoValues(content []byte, tag []byte) []string {
+	values := []string(nil)
+	for _, entry := range bytes.Split(content, []byte{0}) {
+		if bytes.HasPrefix(entry, tag) {
+			value := string(bytes.TrimPrefix(entry, tag))
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsHostRootfs returns true if 'rootfs' is the root of the running system (i.e. "/"), instead of an image's rootfs. In
+// that case, the kernels found under 'rootfs' belong to the build host, including the running kernel.
+//
+// A path that resolves to the host's root (e.g. a symlink to "/") is also treated as the host's root.
+func IsHostRootfs(rootfs string) bool {
+	if filepath.Clean(rootfs) == "/" {
+		return true
+	}
+
+	rootfsInfo, err := os.Stat(rootfs)
+	if err != nil {
+		return false
+	}
+
+	hostRootInfo, err := os.Stat("/")
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(rootfsInfo, hostRootInfo)
+}
+
+// TrimRootfs converts 'absPath', a path on the build host that is under 'rootfs', into the equivalent absolute path
+// within the rootfs. For example, ("/tmp/rootfs", "/tmp/rootfs/lib/modules/6.6.47.1-1.azl3") returns
+// "/lib/modules/6.6.47.1-1.azl3".
+//
+// Trailing slashes are ignored and the result is always cleaned. If 'absPath' isn't under 'rootfs', it is returned
+// unchanged apart from being cleaned.
+func TrimRootfs(rootfs string, absPath string) string {
+	rootfs = filepath.Clean(rootfs)
+	absPath = filepath.Clean(absPath)
+
+	if rootfs == "/" {
+		return absPath
+	}
+
+	if absPath == rootfs {
+		return "/"
+	}
+
+	relPath, found := strings.CutPrefix(absPath, rootfs+"/")
+	if !found {
+		return absPath
+	}
+
+	return "/" + relPath
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrimRootfs(t *testing.T) {
+	assert.Equal(t, "/lib/modules/6.6.47.1-1.azl3",
+		TrimRootfs("/tmp/rootfs", "/tmp/rootfs/lib/modules/6.6.47.1-1.azl3"))
+}
+
+func TestTrimRootfsTrailingSlashes(t *testing.T) {
+	assert.Equal(t, "/lib/modules", TrimRootfs("/tmp/rootfs/", "/tmp/rootfs/lib/modules/"))
+	assert.Equal(t, "/lib/modules", TrimRootfs("/tmp/rootfs", "/tmp/rootfs/lib/modules/"))
+	assert.Equal(t, "/lib/modules", TrimRootfs("/tmp/rootfs/", "/tmp/rootfs/lib/modules"))
+}
+
+func TestTrimRootfsRootfsItself(t *testing.T) {
+	assert.Equal(t, "/", TrimRootfs("/tmp/rootfs", "/tmp/rootfs"))
+	assert.Equal(t, "/", TrimRootfs("/tmp/rootfs", "/tmp/rootfs/"))
+}
+
+func TestTrimRootfsHostRoot(t *testing.T) {
+	assert.Equal(t, "/lib/modules", TrimRootfs("/", "/lib/modules"))
+	assert.Equal(t, "/lib/modules", TrimRootfs("/", "/lib/modules/"))
+	assert.Equal(t, "/", TrimRootfs("/", "/"))
+}
+
+func TestTrimRootfsPathOutsideRootfs(t *testing.T) {
+	assert.Equal(t, "/tmp/rootfs2/lib/modules", TrimRootfs("/tmp/rootfs", "/tmp/rootfs2/lib/modules"))
+	assert.Equal(t, "/var/lib", TrimRootfs("/tmp/rootfs", "/var/lib/"))
+}
+
+func TestIsHostRootfs(t *testing.T) {
+	assert.True(t, IsHostRootfs("/"))
+	assert.True(t, IsHostRootfs("//"))
+	assert.True(t, IsHostRootfs("/tmp/.."))
+
+	rootfs := t.TempDir()
+	assert.False(t, IsHostRootfs(rootfs))
+	assert.False(t, IsHostRootfs(filepath.Join(rootfs, "missing")))
+
+	hostRootLink := filepath.Join(rootfs, "hostroot")
+	err := os.Symlink("/", hostRootLink)
+	assert.NoError(t, err)
+	assert.True(t, IsHostRootfs(hostRootLink))
+}
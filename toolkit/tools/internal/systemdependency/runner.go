@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+)
+
+// Runner runs the commands (e.g. 'uname -r') that the functions of this package use to inspect the build host.
+type Runner interface {
+	// Execute runs 'program' with 'args' and returns its stdout and stderr. An error is returned if the program can't
+	// be run or exits with a non-zero code.
+	Execute(program string, args ...string) (stdout string, stderr string, err error)
+}
+
+// shellRunner runs commands directly on the build host using shell.Execute.
+type shellRunner struct{}
+
+func (shellRunner) Execute(program string, args ...string) (string, string, error) {
+	return shell.Execute(program, args...)
+}
+
+// runner is the Runner used by all of the functions of this package.
+var runner Runner = shellRunner{}
+
+// SetRunner replaces the Runner used by all of the functions of this package and returns the previous one. Passing nil
+// restores the default Runner, which runs commands directly on the build host. For example, a tool can route commands
+// through an agent, or a test can return canned output. The cached build host kernel version is discarded, so that the
+// new Runner is used to read it.
+//
+// SetRunner isn't safe to call concurrently with the other functions of this package. So, it should only be called
+// during startup (or at the start of a test).
+func SetRunner(r Runner) Runner {
+	previous := runner
+
+	if r == nil {
+		r = shellRunner{}
+	}
+
+	runner = r
+	resetBuildHostKernelVersionCache()
+	return previous
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package systemdependency
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunner returns canned output for each command line (e.g. "uname -r") and records the commands it was asked to
+// run.
+type fakeRunner struct {
+	outputs  map[string]string
+	commands []string
+}
+
+func (r *fakeRunner) Execute(program string, args ...string) (string, string, error) {
+	command := strings.Join(append([]string{program}, args...), " ")
+	r.commands = append(r.commands, command)
+
+	stdout, found := r.outputs[command]
+	if !found {
+		return "", "command not found", fmt.Errorf("exit status 127")
+	}
+
+	return stdout, "", nil
+}
+
+func setTestRunner(t *testing.T, outputs map[string]string) *fakeRunner {
+	fake := &fakeRunner{outputs: outputs}
+
+	previous := SetRunner(fake)
+	t.Cleanup(func() { SetRunner(previous) })
+
+	return fake
+}
+
+func TestGetBuildHostKernelVersionFakeRunner(t *testing.T) {
+	fake := setTestRunner(t, map[string]string{
+		"uname -r": "6.6.47.1-1.azl3\r\n",
+	})
+
+	version, err := GetBuildHostKernelVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.47.1-1.azl3", version.String())
+	assert.Equal(t, []string{"uname -r"}, fake.commands)
+}
+
+func TestCompareToBuildHostFakeRunnerCached(t *testing.T) {
+	fake := setTestRunner(t, map[string]string{
+		"uname -r": "6.6.47.1-1.azl3\n",
+	})
+
+	for _, release := range []string{"6.6.51.1-1.azl3", "6.1.58.1-1.azl3"} {
+		version, err := parseKernelVersion(release)
+		assert.NoError(t, err)
+
+		_, err = version.CompareToBuildHost()
+		assert.NoError(t, err)
+	}
+
+	// The build host's kernel version is only read once.
+	assert.Equal(t, []string{"uname -r"}, fake.commands)
+
+	// Replacing the runner discards the cached version.
+	fake = setTestRunner(t, map[string]string{
+		"uname -r": "6.6.51.1-1.azl3\n",
+	})
+
+	version, err := parseKernelVersion("6.6.51.1-1.azl3")
+	assert.NoError(t, err)
+
+	result, err := version.CompareToBuildHost()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result)
+	assert.Equal(t, []string{"uname -r"}, fake.commands)
+}
+
+func TestGetBuildHostKernelVersionFakeRunnerError(t *testing.T) {
+	setTestRunner(t, map[string]string{})
+
+	_, err := GetBuildHostKernelVersion()
+	assert.ErrorContains(t, err, "failed to get build host kernel version")
+	assert.ErrorContains(t, err, "command not found")
+}
+
+func TestKernelVersionFromRpmFileFakeRunner(t *testing.T) {
+	rpmPath := "kernel-6.6.47.1-1.azl3.x86_64.rpm"
+	fake := setTestRunner(t, map[string]string{
+		"rpm -qp --qf " + kernelRpmQueryFormat + " " + rpmPath: "kernel\n6.6.47.1\n1.azl3\n/boot/vmlinuz-6.6.47.1-1.azl3\n",
+	})
+
+	version, err := KernelVersionFromRpmFile(rpmPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.47.1-1.azl3", version.String())
+	assert.Len(t, fake.commands, 1)
+}
+
+func TestSetRunnerNilRestoresDefault(t *testing.T) {
+	previous := SetRunner(&fakeRunner{})
+	t.Cleanup(func() { SetRunner(previous) })
+
+	SetRunner(nil)
+	assert.Equal(t, shellRunner{}, runner)
+}
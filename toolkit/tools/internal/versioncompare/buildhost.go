@@ -0,0 +1,38 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package versioncompare
+
+import (
+	"fmt"
+)
+
+// buildHostVersionGetter returns the version of the kernel running on the build host. This package can't read it
+// itself, since that is done by the systemdependency package, which depends on this one. So, systemdependency sets it
+// when it is loaded.
+var buildHostVersionGetter func() (*TolerantVersion, error)
+
+// SetBuildHostVersionGetter sets the function that CompareToBuildHost uses to get the version of the kernel running on
+// the build host. It is called by the systemdependency package, or by tests.
+func SetBuildHostVersionGetter(getter func() (*TolerantVersion, error)) {
+	buildHostVersionGetter = getter
+}
+
+// CompareToBuildHost compares the version against the version of the kernel running on the build host. It returns 1
+// if the version is newer, 0 if they are the same, or -1 if it is older. An error is returned if the build host's
+// kernel version can't be read.
+//
+// The build host's kernel version is only read once (see systemdependency.GetBuildHostKernelVersion), and is then
+// cached.
+func (v *TolerantVersion) CompareToBuildHost() (int, error) {
+	if buildHostVersionGetter == nil {
+		return 0, fmt.Errorf("build host kernel version isn't available (is the systemdependency package loaded?)")
+	}
+
+	buildHostVersion, err := buildHostVersionGetter()
+	if err != nil {
+		return 0, err
+	}
+
+	return v.Compare(buildHostVersion), nil
+}
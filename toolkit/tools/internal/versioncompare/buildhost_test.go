@@ -0,0 +1,51 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package versioncompare
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setTestBuildHostVersion(t *testing.T, getter func() (*TolerantVersion, error)) {
+	original := buildHostVersionGetter
+	SetBuildHostVersionGetter(getter)
+	t.Cleanup(func() { SetBuildHostVersionGetter(original) })
+}
+
+func TestCompareToBuildHost(t *testing.T) {
+	setTestBuildHostVersion(t, func() (*TolerantVersion, error) {
+		return New("6.6.47.1-1.azl3"), nil
+	})
+
+	tests := map[string]int{
+		"6.6.51.1-1.azl3": GreatherThan,
+		"6.6.47.1-1.azl3": EqualTo,
+		"6.1.58.1-1.azl3": LessThan,
+	}
+
+	for version, expected := range tests {
+		result, err := New(version).CompareToBuildHost()
+		assert.NoError(t, err, "version (%s)", version)
+		assert.Equal(t, expected, result, "version (%s)", version)
+	}
+}
+
+func TestCompareToBuildHostError(t *testing.T) {
+	setTestBuildHostVersion(t, func() (*TolerantVersion, error) {
+		return nil, fmt.Errorf("uname not found")
+	})
+
+	_, err := New("6.6.47.1-1.azl3").CompareToBuildHost()
+	assert.EqualError(t, err, "uname not found")
+}
+
+func TestCompareToBuildHostNoGetter(t *testing.T) {
+	setTestBuildHostVersion(t, nil)
+
+	_, err := New("6.6.47.1-1.azl3").CompareToBuildHost()
+	assert.ErrorContains(t, err, "build host kernel version isn't available")
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package versioncompare
+
+import (
+	"fmt"
+	"strings"
+)
+
+// seriesWildcardSuffix marks a constraint clause that matches every version that starts with the clause's components.
+const seriesWildcardSuffix = ".*"
+
+// constraintOperators lists the supported operators. Longer operators are listed first so that "<=" isn't parsed as
+// "<" followed by "=".
+var constraintOperators = []string{"<=", ">=", "<", ">", "="}
+
+// Constraint is a set of conditions that a version must meet. For example: ">= 6.6.44, < 6.7" or "6.6.*".
+type Constraint struct {
+	clauses  []constraintClause
+	original string
+}
+
+type constraintClause struct {
+	operator string
+	version  *TolerantVersion
+	// Set if the clause has the form "<version>.*".
+	isSeries bool
+}
+
+// ParseConstraint parses a comma separated list of clauses, all of which must be met.
+//
+// Each clause is either "<operator> <version>", where operator is one of: <, <=, >, >=, =, or "<version>.*", which
+// matches every version whose leading components equal those of 'version' (e.g. "6.6.*" matches "6.6.47.1-1.azl3"). A
+// clause without an operator is treated as "=".
+func ParseConstraint(constraintString string) (*Constraint, error) {
+	constraint := &Constraint{original: constraintString}
+
+	for _, clauseString := range strings.Split(constraintString, ",") {
+		clause, err := parseConstraintClause(strings.TrimSpace(clauseString))
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint (%s):\n%w", constraintString, err)
+		}
+
+		constraint.clauses = append(constraint.clauses, clause)
+	}
+
+	return constraint, nil
+}
+
+func parseConstraintClause(clauseString string) (constraintClause, error) {
+	if clauseString == "" {
+		return constraintClause{}, fmt.Errorf("empty clause")
+	}
+
+	operator := "="
+	for _, candidate := range constraintOperators {
+		if strings.HasPrefix(clauseString, candidate) {
+			operator = candidate
+			clauseString = strings.TrimSpace(strings.TrimPrefix(clauseString, candidate))
+			break
+		}
+	}
+
+	versionString, isSeries := strings.CutSuffix(clauseString, seriesWildcardSuffix)
+	if isSeries && operator != "=" {
+		return constraintClause{}, fmt.Errorf("operator (%s) can't be used with a series wildcard (%s)", operator,
+			clauseString)
+	}
+
+	version, err := Parse(versionString)
+	if err != nil {
+		return constraintClause{}, err
+	}
+
+	clause := constraintClause{
+		operator: operator,
+		version:  version,
+		isSeries: isSeries,
+	}
+	return clause, nil
+}
+
+// Check returns true if 'v' meets all of the constraint's clauses.
+func (c *Constraint) Check(v *TolerantVersion) bool {
+	for _, clause := range c.clauses {
+		if !clause.check(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the original string representation of the constraint
+func (c *Constraint) String() string {
+	return c.original
+}
+
+func (c *constraintClause) check(v *TolerantVersion) bool {
+	if c.isSeries {
+		if v.isMaxVer || v.isMinVer || len(v.versionComponents) < len(c.version.versionComponents) {
+			return false
+		}
+
+		for i, component := range c.version.versionComponents {
+			if v.versionComponents[i] != component {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	// The operator was validated when the clause was parsed.
+	valid, _ := v.CompareWithConditional(c.operator, c.version)
+	return valid
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package versioncompare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstraintRange(t *testing.T) {
+	constraint, err := ParseConstraint(">= 6.6.44, < 6.7")
+	assert.NoError(t, err)
+	assert.Equal(t, ">= 6.6.44, < 6.7", constraint.String())
+
+	assert.True(t, constraint.Check(New("6.6.44")))
+	assert.True(t, constraint.Check(New("6.6.47.1-1.azl3")))
+	assert.False(t, constraint.Check(New("6.6.9.1-1.azl3")))
+	assert.False(t, constraint.Check(New("6.7.0")))
+	assert.False(t, constraint.Check(NewMax()))
+}
+
+func TestConstraintNoOperator(t *testing.T) {
+	constraint, err := ParseConstraint("6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+
+	assert.True(t, constraint.Check(New("6.6.47.1-1.azl3")))
+	assert.False(t, constraint.Check(New("6.6.47.1-2.azl3")))
+}
+
+func TestConstraintSeries(t *testing.T) {
+	constraint, err := ParseConstraint("6.6.*")
+	assert.NoError(t, err)
+
+	assert.True(t, constraint.Check(New("6.6.47.1-1.azl3")))
+	assert.True(t, constraint.Check(New("6.6")))
+	assert.False(t, constraint.Check(New("6.1.0")))
+	assert.False(t, constraint.Check(New("6.60.1")))
+	assert.False(t, constraint.Check(New("6")))
+	assert.False(t, constraint.Check(NewMax()))
+}
+
+func TestConstraintSeriesWithRange(t *testing.T) {
+	constraint, err := ParseConstraint("6.6.*, >=6.6.44")
+	assert.NoError(t, err)
+
+	assert.True(t, constraint.Check(New("6.6.47.1-1.azl3")))
+	assert.False(t, constraint.Check(New("6.6.9.1-1.azl3")))
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	_, err := ParseConstraint("")
+	assert.ErrorContains(t, err, "empty clause")
+
+	_, err = ParseConstraint(">= 6.6,")
+	assert.ErrorContains(t, err, "empty clause")
+
+	_, err = ParseConstraint(">=")
+	assert.ErrorContains(t, err, "failed to parse version ()")
+
+	_, err = ParseConstraint(">= 6.6.*")
+	assert.ErrorContains(t, err, "operator (>=) can't be used with a series wildcard")
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package versioncompare
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Set is a collection of unique versions. Two versions are considered the same member of the set if they have the same
+// canonical form, so equivalent but differently formatted strings (e.g. "0:1.2.3" and "1.2.3") collide.
+//
+// Unlike Compare, the canonical form always takes the release into account. So "1.2.3" and "1.2.3-1" are distinct
+// members of a set even though Compare reports them as equal. Keying on the version without its release isn't an
+// option, since Compare's equality isn't transitive: "1.2.3" equals both "1.2.3-1" and "1.2.3-2", but "1.2.3-1" and
+// "1.2.3-2" aren't equal. So, a set may hold versions that Compare reports as equal. Sorted still returns them in a
+// deterministic order.
+type Set struct {
+	versions map[string]*TolerantVersion
+}
+
+// NewSet returns a new Set containing the provided versions.
+func NewSet(versions ...*TolerantVersion) *Set {
+	s := &Set{versions: make(map[string]*TolerantVersion)}
+	for _, v := range versions {
+		s.Add(v)
+	}
+	return s
+}
+
+// Add adds a version to the set. If an equivalent version is already present, the existing entry is kept.
+func (s *Set) Add(v *TolerantVersion) {
+	key := v.canonicalKey()
+	if _, found := s.versions[key]; !found {
+		s.versions[key] = v
+	}
+}
+
+// Contains returns true if an equivalent version is in the set.
+func (s *Set) Contains(v *TolerantVersion) bool {
+	_, found := s.versions[v.canonicalKey()]
+	return found
+}
+
+// Len returns the number of versions in the set.
+func (s *Set) Len() int {
+	return len(s.versions)
+}
+
+// Union returns a new set with the versions that are in either set.
+func (s *Set) Union(other *Set) *Set {
+	result := NewSet()
+	for _, v := range s.versions {
+		result.Add(v)
+	}
+	for _, v := range other.versions {
+		result.Add(v)
+	}
+	return result
+}
+
+// Intersect returns a new set with the versions that are in both sets.
+func (s *Set) Intersect(other *Set) *Set {
+	result := NewSet()
+	for key, v := range s.versions {
+		if _, found := other.versions[key]; found {
+			result.Add(v)
+		}
+	}
+	return result
+}
+
+// Difference returns a new set with the versions that are in this set but not in the other set.
+func (s *Set) Difference(other *Set) *Set {
+	result := NewSet()
+	for key, v := range s.versions {
+		if _, found := other.versions[key]; !found {
+			result.Add(v)
+		}
+	}
+	return result
+}
+
+// Sorted returns the versions in the set in ascending order.
+func (s *Set) Sorted() []*TolerantVersion {
+	keys := make([]string, 0, len(s.versions))
+	for key := range s.versions {
+		keys = append(keys, key)
+	}
+
+	// Sort the keys first so that versions which Compare as equal still have a deterministic order.
+	sort.Strings(keys)
+
+	sorted := make([]*TolerantVersion, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, s.versions[key])
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Compare(sorted[j]) < 0
+	})
+
+	return sorted
+}
+
+// canonicalKey returns a string which is identical for all versions that have the same parsed representation.
+func (v *TolerantVersion) canonicalKey() string {
+	return v.key
+}
+
+func (v *TolerantVersion) computeCanonicalKey() string {
+	switch {
+	case v.isMaxVer:
+		return "MAX_VER"
+	case v.isMinVer:
+		return "MIN_VER"
+	}
+
+	key := joinComponents(v.versionComponents)
+	if len(v.releaseComponents) > 0 {
+		key += "-" + joinComponents(v.releaseComponents)
+	}
+	return key
+}
+
+func joinComponents(components []uint64) string {
+	strComponents := make([]string, len(components))
+	for i, component := range components {
+		strComponents[i] = strconv.FormatUint(component, 10)
+	}
+	return strings.Join(strComponents, ".")
+}
@@ -0,0 +1,138 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package versioncompare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setStrings(versions []*TolerantVersion) []string {
+	strs := make([]string, len(versions))
+	for i, v := range versions {
+		strs[i] = v.String()
+	}
+	return strs
+}
+
+func TestSetAddAndContains(t *testing.T) {
+	s := NewSet(New("6.6.47.1-1.azl3"))
+	assert.Equal(t, 1, s.Len())
+	assert.True(t, s.Contains(New("6.6.47.1-1.azl3")))
+	assert.False(t, s.Contains(New("6.6.47.1-2.azl3")))
+
+	s.Add(New("6.6.47.1-1.azl3"))
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestSetEquivalentVersionsCollide(t *testing.T) {
+	s := NewSet(New("1.2.3"))
+	s.Add(New("0:1.2.3"))
+	s.Add(New("1.02.3"))
+	s.Add(New("1_2_3"))
+	assert.Equal(t, 1, s.Len())
+
+	// The first added representation is kept.
+	assert.Equal(t, []string{"1.2.3"}, setStrings(s.Sorted()))
+}
+
+func TestSetReleaseIsSignificant(t *testing.T) {
+	s := NewSet(New("1.2.3"), New("1.2.3-1"))
+	assert.Equal(t, 2, s.Len())
+	assert.False(t, s.Contains(New("1.2.3-2")))
+}
+
+func TestSetReleaseEqualityIsNotTransitive(t *testing.T) {
+	noRelease := New("1.2.3")
+	release1 := New("1.2.3-1")
+	release2 := New("1.2.3-2")
+
+	assert.Equal(t, EqualTo, noRelease.Compare(release1))
+	assert.Equal(t, EqualTo, noRelease.Compare(release2))
+	assert.Equal(t, LessThan, release1.Compare(release2))
+
+	// All three are kept, even though Compare reports the version without a release as equal to the others.
+	s := NewSet(release2, noRelease, release1)
+	assert.Equal(t, 3, s.Len())
+	assert.True(t, s.Contains(New("1.2.3")))
+	assert.False(t, s.Contains(New("1.2.3-3")))
+	assert.Equal(t, []string{"1.2.3", "1.2.3-1", "1.2.3-2"}, setStrings(s.Sorted()))
+}
+
+func TestSetMaxAndMin(t *testing.T) {
+	s := NewSet(NewMax(), NewMin(), New("1"))
+	s.Add(NewMax())
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, []string{"MIN_VER", "1", "MAX_VER"}, setStrings(s.Sorted()))
+}
+
+func TestSetUnion(t *testing.T) {
+	a := NewSet(New("1.0"), New("2.0"))
+	b := NewSet(New("2.0"), New("3.0"))
+
+	union := a.Union(b)
+	assert.Equal(t, []string{"1.0", "2.0", "3.0"}, setStrings(union.Sorted()))
+
+	// The inputs are not modified.
+	assert.Equal(t, 2, a.Len())
+	assert.Equal(t, 2, b.Len())
+}
+
+func TestSetIntersect(t *testing.T) {
+	a := NewSet(New("1.0"), New("2.0"), New("0:3.0"))
+	b := NewSet(New("2.0"), New("3.0"), New("4.0"))
+
+	intersect := a.Intersect(b)
+	assert.Equal(t, []string{"2.0", "0:3.0"}, setStrings(intersect.Sorted()))
+}
+
+func TestSetIntersectEmpty(t *testing.T) {
+	a := NewSet(New("1.0"))
+	b := NewSet(New("2.0"))
+
+	assert.Equal(t, 0, a.Intersect(b).Len())
+}
+
+func TestSetDifference(t *testing.T) {
+	a := NewSet(New("1.0"), New("2.0"), New("3.0"))
+	b := NewSet(New("2.0"), New("4.0"))
+
+	assert.Equal(t, []string{"1.0", "3.0"}, setStrings(a.Difference(b).Sorted()))
+	assert.Equal(t, []string{"4.0"}, setStrings(b.Difference(a).Sorted()))
+}
+
+func TestSetSorted(t *testing.T) {
+	s := NewSet(New("6.6.47.1"), New("5.15.153.1"), New("6.6.9"), New("6.1.0"))
+	assert.Equal(t, []string{"5.15.153.1", "6.1.0", "6.6.9", "6.6.47.1"}, setStrings(s.Sorted()))
+}
+
+func TestSetSortedEmpty(t *testing.T) {
+	assert.Empty(t, NewSet().Sorted())
+}
+
+// The canonical key is cached on construction, so Set lookups don't re-format the version's components.
+//
+// Before caching:
+//
+//	BenchmarkSetContains-8     2543 ns/op      1176 B/op       44 allocs/op
+//
+// After caching:
+//
+//	BenchmarkSetContains-8     107.3 ns/op         0 B/op        0 allocs/op
+func BenchmarkSetContains(b *testing.B) {
+	versions := make([]*TolerantVersion, len(benchmarkVersionStrings))
+	for i, versionString := range benchmarkVersionStrings {
+		versions[i] = New(versionString)
+	}
+
+	s := NewSet(versions...)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, v := range versions {
+			s.Contains(v)
+		}
+	}
+}
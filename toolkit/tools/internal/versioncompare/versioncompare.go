@@ -28,23 +28,55 @@ type TolerantVersion struct {
 	isMaxVer          bool
 	isMinVer          bool
 	original          string
+
+	// key is the canonical form of the parsed components. It is computed once on construction so that hot loops
+	// (e.g. Set lookups) don't need to re-format the components on every call.
+	key string
 }
 
 // New returns new TolerantVersion
 func New(versionString string) *TolerantVersion {
 	v := &TolerantVersion{original: versionString}
-	v.parse(versionString)
+	// Any component that fails to parse is treated as 0.
+	_ = v.parse(versionString)
+	v.key = v.computeCanonicalKey()
+	return v
+}
+
+// NewWithOriginal returns a new TolerantVersion parsed from 'versionString', like New, but whose String() is 'original'
+// instead. This allows parts of a version string that shouldn't affect comparisons (e.g. a kernel release's arch
+// suffix) to be kept for display.
+func NewWithOriginal(versionString string, original string) *TolerantVersion {
+	v := New(versionString)
+	v.original = original
 	return v
 }
 
+// Parse returns a new TolerantVersion, like New, but returns an error instead of guessing when 'versionString' doesn't
+// contain a version. That is, when it has no version components or a component is too large to represent.
+func Parse(versionString string) (*TolerantVersion, error) {
+	v := &TolerantVersion{original: versionString}
+	err := v.parse(versionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version (%s):\n%w", versionString, err)
+	}
+
+	v.key = v.computeCanonicalKey()
+	return v, nil
+}
+
 // NewMax returns a special version which is always greater than any other version
 func NewMax() *TolerantVersion {
-	return &TolerantVersion{original: "MAX_VER", isMaxVer: true}
+	v := &TolerantVersion{original: "MAX_VER", isMaxVer: true}
+	v.key = v.computeCanonicalKey()
+	return v
 }
 
 // NewMin returns a special version which is always less than any other version
 func NewMin() *TolerantVersion {
-	return &TolerantVersion{original: "MIN_VER", isMinVer: true}
+	v := &TolerantVersion{original: "MIN_VER", isMinVer: true}
+	v.key = v.computeCanonicalKey()
+	return v
 }
 
 // CompareWithConditional evaluates a conditional statement
@@ -116,15 +148,299 @@ func (v *TolerantVersion) Compare(other *TolerantVersion) int {
 	return EqualTo
 }
 
+// CompareN compares this version and the argument version, the same as Compare, except that only the first 'n'
+// version components are significant. Any further version components, and the release, are ignored. For example,
+// "5.15.153.1" and "5.15.153.2" are equal when n is 3, but not when n is 4. The epoch is always compared.
+//
+// CompareN(other, n) gives the same result as comparing the versions formed from FormatComponents(n) of each
+// version, which truncates a version to its first 'n' components, except that CompareN keeps the epochs. So,
+// FormatComponents(n) shows the part of a version that CompareN looks at.
+func (v *TolerantVersion) CompareN(other *TolerantVersion, n int) int {
+	if v.isMaxVer || v.isMinVer || other.isMaxVer || other.isMinVer {
+		return v.Compare(other)
+	}
+
+	return v.withComponents(n).Compare(other.withComponents(n))
+}
+
+// seriesComponents is the number of version components that identify a series (i.e. major.minor).
+const seriesComponents = 2
+
+// SameSeries returns true if this version and the argument version are in the same major.minor series. For example,
+// "6.6.47.1-1.azl3" and "6.6.51.1-2.azl3" are in the same series, but "6.1.58.1" isn't. The epoch is also compared, the
+// same as CompareN. A nil version, or the special max and min versions, aren't in any series.
+func (v *TolerantVersion) SameSeries(other *TolerantVersion) bool {
+	if v == nil || other == nil || v.isMaxVer || v.isMinVer || other.isMaxVer || other.isMinVer {
+		return false
+	}
+
+	return v.CompareN(other, seriesComponents) == EqualTo
+}
+
+// withComponents returns a copy of the version with only the epoch and the first 'n' version components.
+func (v *TolerantVersion) withComponents(n int) *TolerantVersion {
+	// The first component is the epoch.
+	count := min(max(n, 0)+1, len(v.versionComponents))
+
+	truncated := &TolerantVersion{
+		versionComponents: v.versionComponents[:count],
+		original:          v.original,
+	}
+	truncated.key = truncated.computeCanonicalKey()
+	return truncated
+}
+
+// CompareString parses 'versionString' using Parse and compares this version against it, the same as Compare.
+func (v *TolerantVersion) CompareString(versionString string) (int, error) {
+	other, err := Parse(versionString)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.Compare(other), nil
+}
+
+// ComparisonResult is the outcome of comparing two versions with CompareResult.
+type ComparisonResult int
+
+const (
+	Less    ComparisonResult = LessThan
+	Equal   ComparisonResult = EqualTo
+	Greater ComparisonResult = GreatherThan
+)
+
+// String returns the name of the comparison result (e.g. "less").
+func (r ComparisonResult) String() string {
+	switch r {
+	case Less:
+		return "less"
+	case Equal:
+		return "equal"
+	case Greater:
+		return "greater"
+	default:
+		return fmt.Sprintf("ComparisonResult(%d)", int(r))
+	}
+}
+
+// CompareResult is the same as Compare, but returns a ComparisonResult instead of an int. This reads better in switch
+// statements. For example:
+//
+//	switch kernel.CompareResult(newest) {
+//	case versioncompare.Greater:
+//		...
+//	}
+func (v *TolerantVersion) CompareResult(other *TolerantVersion) ComparisonResult {
+	return ComparisonResult(v.Compare(other))
+}
+
+// versionComponentNames are the names used by CompareExplain for the first version components.
+var versionComponentNames = []string{"major", "minor", "patch"}
+
+// CompareExplain is the same as Compare, but also returns a human readable reason for the result. For example:
+// "equal major.minor.patch, differ at 4th component: 1 < 2". This is meant for debugging surprising comparison results
+// (e.g. a newer kernel that sorts lower), not for parsing.
+//
+// Components are shown in the base 36 form they are compared in. So, letter components (e.g. "azl") are shown as is,
+// but a component with leading zeros (e.g. "01") is shown without them.
+func (v *TolerantVersion) CompareExplain(other *TolerantVersion) (int, string) {
+	result := v.Compare(other)
+	return result, v.explainComparison(other, result)
+}
+
+// explainComparison returns the reason that comparing this version against 'other' gave 'result'. It follows the same
+// steps as Compare.
+func (v *TolerantVersion) explainComparison(other *TolerantVersion, result int) string {
+	switch {
+	case v.isMaxVer && other.isMaxVer, v.isMinVer && other.isMinVer:
+		return fmt.Sprintf("both versions are %s", v.original)
+	case v.isMaxVer || other.isMaxVer:
+		return fmt.Sprintf("%s is greater than any other version", NewMax().original)
+	case v.isMinVer || other.isMinVer:
+		return fmt.Sprintf("%s is less than any other version", NewMin().original)
+	}
+
+	// The first version component is the epoch.
+	if v.versionComponents[0] != other.versionComponents[0] {
+		return fmt.Sprintf("differ at epoch: %s", formatComponentComparison(v.versionComponents[0],
+			other.versionComponents[0], result))
+	}
+
+	index, differ := firstComponentDifference(v.versionComponents[1:], other.versionComponents[1:])
+	if differ {
+		return explainComponentDifference(v, other, v.versionComponents[1:], other.versionComponents[1:], index, result,
+			equalVersionComponentsDescription(index), ordinalVersionComponentName(index+1))
+	}
+
+	switch {
+	case len(v.releaseComponents) <= 0 && len(other.releaseComponents) <= 0:
+		return "equal version, neither has a release"
+	case len(v.releaseComponents) <= 0:
+		return fmt.Sprintf("equal version, release ignored since only %s has one", other.original)
+	case len(other.releaseComponents) <= 0:
+		return fmt.Sprintf("equal version, release ignored since only %s has one", v.original)
+	}
+
+	index, differ = firstComponentDifference(v.releaseComponents, other.releaseComponents)
+	if differ {
+		return explainComponentDifference(v, other, v.releaseComponents, other.releaseComponents, index, result,
+			"equal version", fmt.Sprintf("%s release component", ordinal(index+1)))
+	}
+
+	return "equal version and release"
+}
+
+// firstComponentDifference returns the index of the first component that differs between 'a' and 'b', including a
+// component that only one of them has.
+func firstComponentDifference(a []uint64, b []uint64) (int, bool) {
+	for i := 0; i < min(len(a), len(b)); i++ {
+		if a[i] != b[i] {
+			return i, true
+		}
+	}
+
+	return min(len(a), len(b)), len(a) != len(b)
+}
+
+// explainComponentDifference describes the difference at 'index' between the components 'a', of version 'v', and
+// 'b', of version 'other'.
+func explainComponentDifference(v *TolerantVersion, other *TolerantVersion, a []uint64, b []uint64, index int,
+	result int, equalDescription string, componentName string,
+) string {
+	prefix := ""
+	if equalDescription != "" {
+		prefix = equalDescription + ", "
+	}
+
+	switch {
+	case index >= len(b):
+		return fmt.Sprintf("%sonly %s has a %s", prefix, v.original, componentName)
+	case index >= len(a):
+		return fmt.Sprintf("%sonly %s has a %s", prefix, other.original, componentName)
+	default:
+		return fmt.Sprintf("%sdiffer at %s: %s", prefix, componentName,
+			formatComponentComparison(a[index], b[index], result))
+	}
+}
+
+// equalVersionComponentsDescription describes the first 'count' version components being equal. For example:
+// "equal major.minor".
+func equalVersionComponentsDescription(count int) string {
+	switch {
+	case count <= 0:
+		return ""
+	case count <= len(versionComponentNames):
+		return "equal " + strings.Join(versionComponentNames[:count], ".")
+	default:
+		return fmt.Sprintf("equal first %d components", count)
+	}
+}
+
+// ordinalVersionComponentName returns the name of the 'n'th (1-based) version component. For example: "minor" or
+// "4th component".
+func ordinalVersionComponentName(n int) string {
+	if n <= len(versionComponentNames) {
+		return versionComponentNames[n-1]
+	}
+
+	return fmt.Sprintf("%s component", ordinal(n))
+}
+
+// formatComponentComparison returns the comparison of two components. For example: "1 < 2".
+func formatComponentComparison(a uint64, b uint64, result int) string {
+	operator := "="
+	switch {
+	case result < 0:
+		operator = "<"
+	case result > 0:
+		operator = ">"
+	}
+
+	return fmt.Sprintf("%s %s %s", strconv.FormatUint(a, 36), operator, strconv.FormatUint(b, 36))
+}
+
+// ordinal returns 'n' as an English ordinal number. For example: "1st", "12th", "22nd".
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
 // String returns the original string representation of the version
 func (v *TolerantVersion) String() string {
 	return v.original
 }
 
-// parse takes an arbitrary versionString and fills v with the processed version information
-func (v *TolerantVersion) parse(versionString string) {
+// MarshalText implements encoding.TextMarshaler. So, versions are written to JSON (and YAML) as their original string.
+func (v *TolerantVersion) MarshalText() ([]byte, error) {
+	return []byte(v.original), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. The text is parsed using Parse, except for the strings written
+// for NewMax and NewMin, which are restored as those special versions.
+func (v *TolerantVersion) UnmarshalText(text []byte) error {
+	versionString := string(text)
+
+	switch versionString {
+	case NewMax().original:
+		*v = *NewMax()
+
+	case NewMin().original:
+		*v = *NewMin()
+
+	default:
+		parsed, err := Parse(versionString)
+		if err != nil {
+			return err
+		}
+
+		*v = *parsed
+	}
+
+	return nil
+}
+
+// FormatComponents returns the first 'n' components of the version, joined by '.', for display. For example, for
+// "6.6.47.1-1.azl3", FormatComponents(3) returns "6.6.47". The epoch and release are never included. If the version has
+// fewer than 'n' components, all of them are returned. The version itself is not modified.
+func (v *TolerantVersion) FormatComponents(n int) string {
+	if v.isMaxVer || v.isMinVer {
+		return v.original
+	}
+
+	if n <= 0 {
+		return ""
+	}
+
+	versionSubstring, _, _ := strings.Cut(v.original, "-")
+
+	epoch := epochComponentRegex.FindString(versionSubstring)
+	versionSubstring = strings.TrimPrefix(versionSubstring, epoch)
+
+	rawComponents := componentRegex.FindAllString(versionSubstring, -1)
+	if n < len(rawComponents) {
+		rawComponents = rawComponents[:n]
+	}
+
+	return strings.Join(rawComponents, ".")
+}
+
+// parse takes an arbitrary versionString and fills v with the processed version information. Components that fail to
+// parse are set to 0 and the first such failure is returned.
+func (v *TolerantVersion) parse(versionString string) error {
 	var (
 		versionSubstring, releaseSubstring string
+		firstErr                           error
 	)
 	// Split off any release number if present. '-' is an illegal character for versions so we can split on it
 	splitString := strings.Split(versionString, "-")
@@ -136,6 +452,9 @@ func (v *TolerantVersion) parse(versionString string) {
 	}
 
 	rawComponents := componentRegex.FindAllString(versionSubstring, -1)
+	if len(rawComponents) == 0 {
+		firstErr = fmt.Errorf("no version components found")
+	}
 
 	// If no epoch is set in the version, apply an epoch of 0 so all versions have one.
 	if epochComponentRegex.FindString(versionSubstring) == "" {
@@ -149,6 +468,8 @@ func (v *TolerantVersion) parse(versionString string) {
 		intComponent, err := strconv.ParseUint(rawComponents[i], 36, 64)
 		if err == nil {
 			v.versionComponents[i] = intComponent
+		} else if firstErr == nil {
+			firstErr = fmt.Errorf("invalid version component (%s):\n%w", rawComponents[i], err)
 		}
 		// On error keep default value (0)
 	}
@@ -163,8 +484,12 @@ func (v *TolerantVersion) parse(versionString string) {
 			intComponent, err := strconv.ParseUint(rawComponents[i], 36, 64)
 			if err == nil {
 				v.releaseComponents[i] = intComponent
+			} else if firstErr == nil {
+				firstErr = fmt.Errorf("invalid release component (%s):\n%w", rawComponents[i], err)
 			}
 			// On error keep default value (0)
 		}
 	}
+
+	return firstErr
 }
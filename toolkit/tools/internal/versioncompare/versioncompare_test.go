@@ -4,6 +4,7 @@
 package versioncompare
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -218,3 +219,291 @@ func TestInvalidConditional(t *testing.T) {
 	_, err := low.CompareWithConditional("?", high)
 	assert.Error(t, err)
 }
+
+func TestFormatComponentsFewer(t *testing.T) {
+	v := New("6.6.47.1-1.azl3")
+	assert.Equal(t, "6", v.FormatComponents(1))
+	assert.Equal(t, "6.6", v.FormatComponents(2))
+	assert.Equal(t, "6.6.47", v.FormatComponents(3))
+
+	// The underlying value is unchanged.
+	assert.Equal(t, "6.6.47.1-1.azl3", v.String())
+	assert.Equal(t, 0, v.Compare(New("6.6.47.1-1.azl3")))
+}
+
+func TestFormatComponentsMore(t *testing.T) {
+	v := New("6.6.47.1-1.azl3")
+	assert.Equal(t, "6.6.47.1", v.FormatComponents(4))
+	assert.Equal(t, "6.6.47.1", v.FormatComponents(10))
+}
+
+func TestFormatComponentsZero(t *testing.T) {
+	v := New("6.6.47.1-1.azl3")
+	assert.Equal(t, "", v.FormatComponents(0))
+	assert.Equal(t, "", v.FormatComponents(-1))
+}
+
+func TestFormatComponentsEpoch(t *testing.T) {
+	assert.Equal(t, "6.6", New("1:6.6.0-1").FormatComponents(2))
+}
+
+func TestFormatComponentsMaxAndMin(t *testing.T) {
+	assert.Equal(t, "MAX_VER", NewMax().FormatComponents(3))
+	assert.Equal(t, "MIN_VER", NewMin().FormatComponents(3))
+}
+
+var benchmarkVersionStrings = []string{
+	"6.6.47.1-1.azl3",
+	"6.6.51.1-1.azl3",
+	"5.15.153.1-2.cm2",
+	"6.1.0-1064",
+	"6.6.47.1-2.azl3",
+	"6.6.9",
+	"1:6.6.0",
+	"6.11.6-200.fc40",
+}
+
+// Compare works on the components parsed by New, so comparisons in a loop don't re-tokenize the version strings:
+//
+//	BenchmarkCompare-8           61.68 ns/op         0 B/op        0 allocs/op
+//	BenchmarkCompareReparse-8    32065 ns/op      8640 B/op      256 allocs/op
+func BenchmarkCompare(b *testing.B) {
+	versions := make([]*TolerantVersion, len(benchmarkVersionStrings))
+	for i, versionString := range benchmarkVersionStrings {
+		versions[i] = New(versionString)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range versions {
+			versions[i].Compare(versions[(i+1)%len(versions)])
+		}
+	}
+}
+
+// BenchmarkCompareReparse measures the cost of comparing version strings that have not been parsed ahead of time.
+func BenchmarkCompareReparse(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		for i := range benchmarkVersionStrings {
+			a := New(benchmarkVersionStrings[i])
+			other := New(benchmarkVersionStrings[(i+1)%len(benchmarkVersionStrings)])
+			a.Compare(other)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	v, err := Parse("6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.47.1-1.azl3", v.String())
+	assert.Equal(t, 0, v.Compare(New("6.6.47.1-1.azl3")))
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse("")
+	assert.ErrorContains(t, err, "failed to parse version ()")
+
+	_, err = Parse("...")
+	assert.ErrorContains(t, err, "no version components found")
+
+	_, err = Parse("6.6.zzzzzzzzzzzzzzzz")
+	assert.ErrorContains(t, err, "invalid version component (zzzzzzzzzzzzzzzz)")
+
+	_, err = Parse("6.6.0-zzzzzzzzzzzzzzzz")
+	assert.ErrorContains(t, err, "invalid release component (zzzzzzzzzzzzzzzz)")
+}
+
+func TestCompareString(t *testing.T) {
+	v := New("6.6.47.1-1.azl3")
+
+	result, err := v.CompareString("6.6.0")
+	assert.NoError(t, err)
+	assert.Equal(t, GreatherThan, result)
+
+	result, err = v.CompareString("6.6.47.1")
+	assert.NoError(t, err)
+	assert.Equal(t, EqualTo, result)
+
+	result, err = v.CompareString("6.12")
+	assert.NoError(t, err)
+	assert.Equal(t, LessThan, result)
+}
+
+func TestCompareStringInvalid(t *testing.T) {
+	_, err := New("6.6.47.1-1.azl3").CompareString("-1.azl3")
+	assert.ErrorContains(t, err, "failed to parse version (-1.azl3)")
+}
+
+func TestTolerantVersionJSON(t *testing.T) {
+	versions := []*TolerantVersion{New("6.6.47.1-1.azl3"), NewMax(), NewMin()}
+
+	data, err := json.Marshal(versions)
+	assert.NoError(t, err)
+	assert.Equal(t, `["6.6.47.1-1.azl3","MAX_VER","MIN_VER"]`, string(data))
+
+	var decoded []*TolerantVersion
+	err = json.Unmarshal(data, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, versions, decoded)
+}
+
+func TestTolerantVersionJSONInvalid(t *testing.T) {
+	var decoded *TolerantVersion
+	err := json.Unmarshal([]byte(`"..."`), &decoded)
+	assert.ErrorContains(t, err, "no version components found")
+}
+
+func TestCompareN(t *testing.T) {
+	a := New("5.15.153.1")
+	b := New("5.15.153.2")
+
+	// Only the first three components are significant.
+	assert.Equal(t, EqualTo, a.CompareN(b, 3))
+	assert.Equal(t, EqualTo, b.CompareN(a, 3))
+
+	// The fourth component is significant, as it is for Azure Linux.
+	assert.Equal(t, LessThan, a.CompareN(b, 4))
+	assert.Equal(t, GreatherThan, b.CompareN(a, 4))
+	assert.Equal(t, a.Compare(b), a.CompareN(b, 4))
+
+	// Differences within the first N components are still found.
+	assert.Equal(t, LessThan, New("5.15.152.9").CompareN(New("5.15.153.1"), 3))
+	assert.Equal(t, LessThan, New("5.15.152.9").CompareN(New("5.15.153.1"), 4))
+}
+
+func TestCompareNIgnoresRelease(t *testing.T) {
+	assert.Equal(t, EqualTo, New("5.15.153.1-1.cm2").CompareN(New("5.15.153.1-2.cm2"), 4))
+	assert.Equal(t, LessThan, New("5.15.153.1-1.cm2").Compare(New("5.15.153.1-2.cm2")))
+}
+
+func TestCompareNShortVersions(t *testing.T) {
+	// A version with fewer than N components is less than one with more, the same as Compare.
+	assert.Equal(t, LessThan, New("5.15").CompareN(New("5.15.153.1"), 3))
+	assert.Equal(t, EqualTo, New("5.15").CompareN(New("5.15.153.1"), 2))
+}
+
+func TestCompareNEpoch(t *testing.T) {
+	assert.Equal(t, GreatherThan, New("1:5.15.153.1").CompareN(New("5.15.153.2"), 3))
+	assert.Equal(t, EqualTo, New("1:5.15.153.1").CompareN(New("1:5.15.153.2"), 3))
+}
+
+func TestCompareNSpecialVersions(t *testing.T) {
+	assert.Equal(t, LessThan, New("5.15.153.1").CompareN(NewMax(), 3))
+	assert.Equal(t, GreatherThan, New("5.15.153.1").CompareN(NewMin(), 3))
+	assert.Equal(t, EqualTo, NewMax().CompareN(NewMax(), 3))
+}
+
+func TestSameSeries(t *testing.T) {
+	assert.True(t, New("6.6.47.1-1.azl3").SameSeries(New("6.6.51.1-2.azl3")))
+	assert.True(t, New("6.6").SameSeries(New("6.6.47.1")))
+	assert.True(t, New("1:6.6.47.1").SameSeries(New("1:6.6.51.1")))
+}
+
+func TestSameSeriesDifferentSeries(t *testing.T) {
+	assert.False(t, New("6.6.47.1-1.azl3").SameSeries(New("6.1.58.1-1.azl3")))
+	assert.False(t, New("6.6.47.1").SameSeries(New("5.6.47.1")))
+	assert.False(t, New("6").SameSeries(New("6.6")))
+	assert.False(t, New("1:6.6.47.1").SameSeries(New("6.6.47.1")))
+}
+
+func TestSameSeriesNilAndSpecialVersions(t *testing.T) {
+	var nilVersion *TolerantVersion
+
+	assert.False(t, nilVersion.SameSeries(New("6.6.47.1")))
+	assert.False(t, New("6.6.47.1").SameSeries(nil))
+	assert.False(t, nilVersion.SameSeries(nil))
+	assert.False(t, NewMax().SameSeries(NewMax()))
+	assert.False(t, New("6.6.47.1").SameSeries(NewMin()))
+}
+
+func TestCompareResult(t *testing.T) {
+	pairs := []struct {
+		a, b string
+	}{
+		{"5.15.153.1", "5.15.153.2"},
+		{"5.15.153.1", "5.15.153.1"},
+		{"5.15.153.2", "5.15.153.1"},
+		{"6.6.47.1-1.azl3", "6.6.47.1-2.azl3"},
+		{"1:5.15", "6.6"},
+	}
+
+	expectedResults := map[int]ComparisonResult{
+		LessThan:     Less,
+		EqualTo:      Equal,
+		GreatherThan: Greater,
+	}
+
+	for _, pair := range pairs {
+		a, b := New(pair.a), New(pair.b)
+		assert.Equal(t, expectedResults[a.Compare(b)], a.CompareResult(b), "%s vs %s", pair.a, pair.b)
+	}
+
+	assert.Equal(t, Less, New("5.15").CompareResult(NewMax()))
+	assert.Equal(t, Greater, New("5.15").CompareResult(NewMin()))
+}
+
+func TestComparisonResultString(t *testing.T) {
+	assert.Equal(t, "less", Less.String())
+	assert.Equal(t, "equal", Equal.String())
+	assert.Equal(t, "greater", Greater.String())
+	assert.Equal(t, "ComparisonResult(5)", ComparisonResult(5).String())
+}
+
+func TestNewWithOriginal(t *testing.T) {
+	v := NewWithOriginal("6.11.6-200.fc40", "6.11.6-200.fc40.x86_64")
+	assert.Equal(t, "6.11.6-200.fc40.x86_64", v.String())
+	assert.Equal(t, EqualTo, v.Compare(New("6.11.6-200.fc40")))
+	assert.Equal(t, LessThan, v.Compare(New("6.11.6-201.fc40")))
+}
+
+func TestCompareExplain(t *testing.T) {
+	tests := []struct {
+		a, b        string
+		result      int
+		explanation string
+	}{
+		{"6.6.47.1-1.azl3", "6.6.47.2-1.azl3", LessThan, "equal major.minor.patch, differ at 4th component: 1 < 2"},
+		{"6.6.51.1", "6.6.47.1", GreatherThan, "equal major.minor, differ at patch: 51 > 47"},
+		{"6.1", "5.15", GreatherThan, "differ at major: 6 > 5"},
+		{"6.6.47.1", "6.6.47", GreatherThan, "equal major.minor.patch, only 6.6.47.1 has a 4th component"},
+		{"1:5.15", "6.6", GreatherThan, "differ at epoch: 1 > 0"},
+		{"6.6.47.1-1.azl3", "6.6.47.1-2.azl3", LessThan, "equal version, differ at 1st release component: 1 < 2"},
+		{"6.6.47.1-1.azl3", "6.6.47.1-1.cm2", GreatherThan,
+			"equal version, differ at 2nd release component: azl > cm"},
+		{"6.6.47.1-1.azl3", "6.6.47.1-1", GreatherThan, "equal version, only 6.6.47.1-1.azl3 has a 2nd release component"},
+		{"6.6.47.1-1.azl3", "6.6.47.1", EqualTo, "equal version, release ignored since only 6.6.47.1-1.azl3 has one"},
+		{"6.6.47.1", "6.6.47.1", EqualTo, "equal version, neither has a release"},
+		{"6.6.47.1-1.azl3", "6.6.47.1-1.azl3", EqualTo, "equal version and release"},
+		{"1.2.3.4.5.6", "1.2.3.4.5.7", LessThan, "equal first 5 components, differ at 6th component: 6 < 7"},
+	}
+
+	for _, test := range tests {
+		result, explanation := New(test.a).CompareExplain(New(test.b))
+		assert.Equal(t, test.result, result, "%s vs %s", test.a, test.b)
+		assert.Equal(t, New(test.a).Compare(New(test.b)), result, "%s vs %s", test.a, test.b)
+		assert.Equal(t, test.explanation, explanation, "%s vs %s", test.a, test.b)
+	}
+}
+
+func TestCompareExplainSpecialVersions(t *testing.T) {
+	result, explanation := NewMax().CompareExplain(New("6.6.47.1"))
+	assert.Equal(t, GreatherThan, result)
+	assert.Equal(t, "MAX_VER is greater than any other version", explanation)
+
+	result, explanation = New("6.6.47.1").CompareExplain(NewMin())
+	assert.Equal(t, GreatherThan, result)
+	assert.Equal(t, "MIN_VER is less than any other version", explanation)
+
+	result, explanation = NewMin().CompareExplain(NewMin())
+	assert.Equal(t, EqualTo, result)
+	assert.Equal(t, "both versions are MIN_VER", explanation)
+}
+
+func TestOrdinal(t *testing.T) {
+	tests := map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st",
+		22: "22nd", 111: "111th"}
+
+	for n, expected := range tests {
+		assert.Equal(t, expected, ordinal(n))
+	}
+}
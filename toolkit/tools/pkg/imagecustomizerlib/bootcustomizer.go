@@ -191,6 +191,35 @@ func (b *BootCustomizer) PrepareForVerity() error {
 	return nil
 }
 
+// Sets the root device to the unlocked device of an encrypted root partition.
+func (b *BootCustomizer) PrepareForEncryptedRoot(rootDevice string) error {
+	if b.isGrubMkconfig {
+		// Force root command-line arg to be referenced by /dev path instead of by UUID.
+		defaultGrubFileContent, err := UpdateDefaultGrubFileVariable(b.defaultGrubFileContent, "GRUB_DISABLE_UUID",
+			"true")
+		if err != nil {
+			return err
+		}
+
+		defaultGrubFileContent, err = UpdateDefaultGrubFileVariable(defaultGrubFileContent, "GRUB_DEVICE",
+			rootDevice)
+		if err != nil {
+			return err
+		}
+
+		b.defaultGrubFileContent = defaultGrubFileContent
+	} else {
+		grubCfgContent, err := replaceSetCommandValue(b.grubCfgContent, "rootdevice", rootDevice)
+		if err != nil {
+			return err
+		}
+
+		b.grubCfgContent = grubCfgContent
+	}
+
+	return nil
+}
+
 func (b *BootCustomizer) WriteToFile(imageChroot safechroot.ChrootInterface) error {
 	if b.isGrubMkconfig {
 		// Update /etc/defaukt/grub file.
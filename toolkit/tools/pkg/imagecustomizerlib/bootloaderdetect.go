@@ -0,0 +1,144 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+)
+
+type Bootloader string
+
+const (
+	BootloaderGrub        Bootloader = "grub"
+	BootloaderSystemdBoot Bootloader = "systemd-boot"
+	// The image boots a Unified Kernel Image (UKI) directly, without a boot menu config.
+	BootloaderUKI     Bootloader = "uki"
+	BootloaderUnknown Bootloader = "unknown"
+)
+
+const (
+	bootLoaderEntriesDir = "loader/entries"
+	ukiDir               = "EFI/Linux"
+	ukiFileExtension     = ".efi"
+)
+
+var (
+	// grubCfgPaths are the locations of the grub config within an image.
+	grubCfgPaths = []string{
+		"/boot/grub2/grub.cfg",
+		"/boot/grub/grub.cfg",
+	}
+
+	// espDirs are the directories that the EFI system partition (ESP) may be mounted at, or that may hold the ESP's
+	// contents when /boot is on the ESP.
+	espDirs = []string{
+		"/boot/efi",
+		"/efi",
+		"/boot",
+	}
+)
+
+// DetectBootloader returns the bootloader that the image boots with.
+//
+// The bootloader is detected by its config files, in the following order of precedence:
+//  1. grub.cfg: Grub. Grub may also read Boot Loader Specification entries (i.e. loader/entries), as Fedora does.
+//  2. loader/entries/*.conf: systemd-boot.
+//  3. EFI/Linux/*.efi: UKI.
+//
+// If none of these are found, BootloaderUnknown is returned without an error.
+func DetectBootloader(imageChroot *safechroot.Chroot) (Bootloader, error) {
+	return detectBootloader(imageChroot.RootDir())
+}
+
+func detectBootloader(rootDir string) (Bootloader, error) {
+	grubCfgPath, err := findGrubCfg(rootDir)
+	if err != nil {
+		return BootloaderUnknown, err
+	}
+
+	if grubCfgPath != "" {
+		return BootloaderGrub, nil
+	}
+
+	entryFiles, err := findBootLoaderEntryFiles(rootDir)
+	if err != nil {
+		return BootloaderUnknown, err
+	}
+
+	if len(entryFiles) > 0 {
+		return BootloaderSystemdBoot, nil
+	}
+
+	ukiFiles, err := findUkiFiles(rootDir)
+	if err != nil {
+		return BootloaderUnknown, err
+	}
+
+	if len(ukiFiles) > 0 {
+		return BootloaderUKI, nil
+	}
+
+	return BootloaderUnknown, nil
+}
+
+// findGrubCfg returns the host path of the image's grub config, or an empty string if there isn't one.
+func findGrubCfg(rootDir string) (string, error) {
+	for _, grubCfgPath := range grubCfgPaths {
+		fullPath := filepath.Join(rootDir, grubCfgPath)
+
+		exists, err := file.PathExists(fullPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to check if (%s) exists:\n%w", fullPath, err)
+		}
+
+		if exists {
+			return fullPath, nil
+		}
+	}
+
+	return "", nil
+}
+
+// findBootLoaderEntryFiles returns the host paths of the image's Boot Loader Specification entry files.
+func findBootLoaderEntryFiles(rootDir string) ([]string, error) {
+	return findEspFilesWithExtension(rootDir, bootLoaderEntriesDir, ".conf")
+}
+
+// findUkiFiles returns the host paths of the image's UKI files.
+func findUkiFiles(rootDir string) ([]string, error) {
+	return findEspFilesWithExtension(rootDir, ukiDir, ukiFileExtension)
+}
+
+// findEspFilesWithExtension returns the host paths of the files with the extension 'extension' in the directory
+// 'subDir' of each of the possible ESP directories.
+func findEspFilesWithExtension(rootDir string, subDir string, extension string) ([]string, error) {
+	foundFiles := []string(nil)
+	for _, espDir := range espDirs {
+		dirPath := filepath.Join(rootDir, espDir, subDir)
+
+		entries, err := os.ReadDir(dirPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory (%s):\n%w", dirPath, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), extension) {
+				continue
+			}
+
+			foundFiles = append(foundFiles, filepath.Join(dirPath, entry.Name()))
+		}
+	}
+
+	return foundFiles, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestImageFile creates a file, with the provided content, at the path 'path' within 'rootDir'.
+func createTestImageFile(t *testing.T, rootDir string, path string, content string) {
+	fullPath := filepath.Join(rootDir, path)
+	err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	err = os.WriteFile(fullPath, []byte(content), 0o644)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+}
+
+func TestDetectBootloaderGrub(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/grub2/grub.cfg", "")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	bootloader, err := DetectBootloader(imageChroot)
+	assert.NoError(t, err)
+	assert.Equal(t, BootloaderGrub, bootloader)
+}
+
+func TestDetectBootloaderGrubWithBootLoaderEntries(t *testing.T) {
+	// Grub can read Boot Loader Specification entries.
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/grub2/grub.cfg", "")
+	createTestImageFile(t, rootDir, "/boot/loader/entries/azl-6.6.47.1-1.azl3.conf", "")
+
+	bootloader, err := detectBootloader(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, BootloaderGrub, bootloader)
+}
+
+func TestDetectBootloaderSystemdBoot(t *testing.T) {
+	for _, espDir := range []string{"/boot/efi", "/efi", "/boot"} {
+		rootDir := t.TempDir()
+		createTestImageFile(t, rootDir, filepath.Join(espDir, "loader/entries/azl-6.6.47.1-1.azl3.conf"), "")
+
+		bootloader, err := detectBootloader(rootDir)
+		assert.NoError(t, err, espDir)
+		assert.Equal(t, BootloaderSystemdBoot, bootloader, espDir)
+	}
+}
+
+func TestDetectBootloaderUki(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/efi/EFI/Linux/azl-6.6.47.1-1.azl3.efi", "")
+
+	bootloader, err := detectBootloader(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, BootloaderUKI, bootloader)
+}
+
+func TestDetectBootloaderUnknown(t *testing.T) {
+	rootDir := t.TempDir()
+
+	// Empty or unrelated directories aren't recognized.
+	err := os.MkdirAll(filepath.Join(rootDir, "/boot/loader/entries"), os.ModePerm)
+	assert.NoError(t, err)
+	createTestImageFile(t, rootDir, "/boot/efi/EFI/Linux/readme.txt", "")
+
+	bootloader, err := detectBootloader(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, BootloaderUnknown, bootloader)
+}
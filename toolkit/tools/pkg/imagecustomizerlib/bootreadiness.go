@@ -0,0 +1,195 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+const (
+	BootCheckBootMenu     = "boot-menu"
+	BootCheckCmdline      = "cmdline"
+	BootCheckDefaultEntry = "default-entry"
+	BootCheckRootDriver   = "root-driver"
+)
+
+// BootReadinessOptions selects which checks ValidateBootReadiness runs.
+type BootReadinessOptions struct {
+	// Same as KernelCheckOptions.InstalledKernel.
+	InstalledKernel bool
+	// Same as KernelCheckOptions.Initramfs.
+	Initramfs bool
+	// Same as KernelCheckOptions.BootConsistency.
+	BootConsistency bool
+	// Warns about installed kernels without a boot menu entry and boot menu entries without an installed kernel.
+	BootMenu bool
+	// Checks that the default kernel's command line has each of the RequiredCmdlineFlags. The check is skipped if there
+	// are no required flags.
+	Cmdline bool
+	// The flags that the default kernel's command line must have. See checkKernelCmdlineFlags for the format.
+	RequiredCmdlineFlags []string
+	// Checks that the bootloader's default selects exactly one boot menu entry, which has a kernel. Images that boot a
+	// UKI directly don't have a default boot entry. So, it is not enabled by DefaultBootReadinessOptions.
+	DefaultEntry bool
+	// Checks that each kernel can load this root device driver (e.g. "nvme") early in boot. The driver depends on the
+	// platform that the image targets. So, the check is only run if the driver is set.
+	RootDeviceDriver string
+}
+
+// DefaultBootReadinessOptions returns options that enable all of the boot readiness checks.
+func DefaultBootReadinessOptions() BootReadinessOptions {
+	return BootReadinessOptions{
+		InstalledKernel: true,
+		Initramfs:       true,
+		BootConsistency: true,
+		BootMenu:        true,
+		Cmdline:         true,
+	}
+}
+
+// ValidateBootReadiness runs the enabled boot related checks against the image, to assert that the image will boot.
+// This combines the installed-kernel, initramfs and boot-consistency kernel health checks with the boot menu and kernel
+// command line checks.
+//
+// The same as RunKernelHealthChecks, a check that fails, or that can't be run, doesn't stop the remaining checks from
+// running. The result of every check that ran is returned. If any check failed, an error summarizing the failed checks
+// is also returned.
+func ValidateBootReadiness(imageChroot *safechroot.Chroot, opts BootReadinessOptions) ([]CheckResult, error) {
+	return validateBootReadiness(imageChroot.RootDir(), opts)
+}
+
+type bootReadinessCheck struct {
+	name    string
+	enabled bool
+	run     func() (CheckResult, error)
+}
+
+// bootReadinessKernelCheckOptions returns the kernel health checks that 'opts' enables.
+func bootReadinessKernelCheckOptions(opts BootReadinessOptions) KernelCheckOptions {
+	return KernelCheckOptions{
+		InstalledKernel: opts.InstalledKernel,
+		Initramfs:       opts.Initramfs,
+		BootConsistency: opts.BootConsistency,
+	}
+}
+
+// bootReadinessChecks returns the boot readiness checks, other than the kernel health checks, in the order that they
+// are run.
+func bootReadinessChecks(rootDir string, opts BootReadinessOptions) []bootReadinessCheck {
+	return []bootReadinessCheck{
+		{BootCheckBootMenu, opts.BootMenu, func() (CheckResult, error) { return checkBootMenuHealth(rootDir) }},
+		{BootCheckCmdline, opts.Cmdline, func() (CheckResult, error) {
+			return checkCmdlineHealth(rootDir, opts.RequiredCmdlineFlags)
+		}},
+		{BootCheckDefaultEntry, opts.DefaultEntry, func() (CheckResult, error) {
+			return checkDefaultBootEntryHealth(rootDir)
+		}},
+		{BootCheckRootDriver, opts.RootDeviceDriver != "", func() (CheckResult, error) {
+			return checkRootDriverHealth(rootDir, opts.RootDeviceDriver)
+		}},
+	}
+}
+
+func validateBootReadiness(rootDir string, opts BootReadinessOptions) ([]CheckResult, error) {
+	// The error only summarizes the failed results, which are summarized again below along with the other checks.
+	results, _ := runKernelHealthChecks(rootDir, bootReadinessKernelCheckOptions(opts))
+
+	isHost := systemdependency.IsHostRootfs(rootDir)
+	for _, check := range bootReadinessChecks(rootDir, opts) {
+		if !check.enabled {
+			continue
+		}
+
+		result, err := check.run()
+		if err != nil {
+			result = CheckResult{
+				Name:    check.name,
+				Status:  CheckStatusFail,
+				Message: err.Error(),
+			}
+		}
+
+		result.Host = isHost
+
+		logKernelCheckResult(result)
+		results = append(results, result)
+	}
+
+	failedChecks := []string(nil)
+	for _, result := range results {
+		if result.Status == CheckStatusFail {
+			failedChecks = append(failedChecks, result.Name)
+		}
+	}
+
+	if len(failedChecks) > 0 {
+		return results, fmt.Errorf("boot readiness checks failed: %s", strings.Join(failedChecks, ", "))
+	}
+
+	return results, nil
+}
+
+// checkBootMenuHealth warns about installed kernels without a boot menu entry and boot menu entries without an
+// installed kernel. A kernel without a menu entry can't be booted, even though it is installed.
+func checkBootMenuHealth(rootDir string) (CheckResult, error) {
+	missing, orphans, err := findKernelBootMenuProblems(rootDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	if len(missing) <= 0 && len(orphans) <= 0 {
+		return CheckResult{
+			Name:   BootCheckBootMenu,
+			Status: CheckStatusPass,
+		}, nil
+	}
+
+	problems := []string(nil)
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("installed kernels missing from the boot menu: %s",
+			strings.Join(missing, ", ")))
+	}
+
+	if len(orphans) > 0 {
+		problems = append(problems, fmt.Sprintf("boot menu entries without an installed kernel: %s",
+			strings.Join(orphans, ", ")))
+	}
+
+	return CheckResult{
+		Name:     BootCheckBootMenu,
+		Status:   CheckStatusWarn,
+		Message:  strings.Join(problems, "; "),
+		Versions: append(missing, orphans...),
+	}, nil
+}
+
+// checkCmdlineHealth is the CheckResult equivalent of checkKernelCmdlineFlags.
+func checkCmdlineHealth(rootDir string, required []string) (CheckResult, error) {
+	if len(required) <= 0 {
+		return newSkippedCheckResult(BootCheckCmdline, "no required kernel command line flags"), nil
+	}
+
+	args, err := getDefaultKernelCmdline(rootDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	missing := findMissingCmdlineFlags(args, required)
+	if len(missing) > 0 {
+		return CheckResult{
+			Name:    BootCheckCmdline,
+			Status:  CheckStatusFail,
+			Message: fmt.Sprintf("kernel command line is missing required flags: %s", strings.Join(missing, ", ")),
+		}, nil
+	}
+
+	return CheckResult{
+		Name:   BootCheckCmdline,
+		Status: CheckStatusPass,
+	}, nil
+}
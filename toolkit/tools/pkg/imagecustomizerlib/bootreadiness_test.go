@@ -0,0 +1,117 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBootReadinessGrubCfg = `set bootprefix=/boot
+load_env -f $bootprefix/mariner.cfg
+
+menuentry "Azure Linux" {
+	linux $bootprefix/$mariner_linux rd.auto=1 $mariner_cmdline
+	initrd $bootprefix/$mariner_initrd
+}
+`
+
+// createTestBootableImage creates an image tree with a single kernel that has everything it needs to boot using grub.
+func createTestBootableImage(t *testing.T) string {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "initramfs-6.6.47.1-1.azl3.img")
+	createTestImageFile(t, rootDir, "/boot/grub2/grub.cfg", testBootReadinessGrubCfg)
+	createTestImageFile(t, rootDir, "/boot/mariner.cfg", testBootMenuMarinerCfg)
+
+	return rootDir
+}
+
+func TestValidateBootReadinessAllPass(t *testing.T) {
+	rootDir := createTestBootableImage(t)
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	opts := DefaultBootReadinessOptions()
+	opts.RequiredCmdlineFlags = []string{"rd.auto=1", "init=/lib/systemd/systemd"}
+
+	results, err := ValidateBootReadiness(imageChroot, opts)
+	assert.NoError(t, err)
+	assert.Len(t, results, 5)
+	for _, result := range results {
+		assert.Equal(t, CheckStatusPass, result.Status, result.Name)
+	}
+}
+
+func TestValidateBootReadinessMixed(t *testing.T) {
+	rootDir := createTestBootableImage(t)
+
+	// Kernel without an initramfs or a boot menu entry.
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.51.1-1.azl3")
+
+	opts := DefaultBootReadinessOptions()
+	opts.RequiredCmdlineFlags = []string{"rd.auto=1", "lockdown=integrity"}
+
+	results, err := validateBootReadiness(rootDir, opts)
+	assert.ErrorContains(t, err, "boot readiness checks failed: initramfs, cmdline")
+	assert.Len(t, results, 5)
+
+	assert.Equal(t, CheckStatusPass, findCheckResult(t, results, KernelCheckInstalledKernel).Status)
+	assert.Equal(t, CheckStatusPass, findCheckResult(t, results, KernelCheckBootConsistency).Status)
+
+	initramfsResult := findCheckResult(t, results, KernelCheckInitramfs)
+	assert.Equal(t, CheckStatusFail, initramfsResult.Status)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, initramfsResult.Versions)
+
+	bootMenuResult := findCheckResult(t, results, BootCheckBootMenu)
+	assert.Equal(t, CheckStatusWarn, bootMenuResult.Status)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, bootMenuResult.Versions)
+
+	cmdlineResult := findCheckResult(t, results, BootCheckCmdline)
+	assert.Equal(t, CheckStatusFail, cmdlineResult.Status)
+	assert.Contains(t, cmdlineResult.Message, "lockdown=integrity")
+}
+
+func TestValidateBootReadinessToggles(t *testing.T) {
+	rootDir := createTestBootableImage(t)
+
+	results, err := validateBootReadiness(rootDir, BootReadinessOptions{
+		Initramfs: true,
+		Cmdline:   true,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, KernelCheckInitramfs, results[0].Name)
+		assert.Equal(t, BootCheckCmdline, results[1].Name)
+		assert.Equal(t, CheckStatusSkipped, results[1].Status)
+	}
+
+	results, err = validateBootReadiness(rootDir, BootReadinessOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestValidateBootReadinessCheckError(t *testing.T) {
+	// Without a bootloader config, the boot menu and command line can't be read. The kernel checks still run.
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "initramfs-6.6.47.1-1.azl3.img")
+
+	opts := DefaultBootReadinessOptions()
+	opts.RequiredCmdlineFlags = []string{"rd.auto=1"}
+
+	results, err := validateBootReadiness(rootDir, opts)
+	assert.ErrorContains(t, err, "boot readiness checks failed: cmdline")
+	assert.Len(t, results, 5)
+
+	assert.Equal(t, CheckStatusPass, findCheckResult(t, results, KernelCheckInitramfs).Status)
+
+	cmdlineResult := findCheckResult(t, results, BootCheckCmdline)
+	assert.Equal(t, CheckStatusFail, cmdlineResult.Status)
+	assert.Contains(t, cmdlineResult.Message, "unsupported bootloader")
+}
@@ -16,18 +16,31 @@ import (
 func checkFileSystems(rawImageFile string) error {
 	logger.Log.Infof("Checking for file system errors")
 
-	imageLoopback, err := safeloopback.NewLoopback(rawImageFile)
+	imageConnection := NewImageConnection()
+	defer imageConnection.Close()
+
+	err := imageConnection.ConnectLoopback(rawImageFile)
+	if err != nil {
+		return err
+	}
+
+	// Assemble the RAID arrays and activate the volume groups, so that the file systems on them can be checked.
+	err = imageConnection.ActivateRaidArrays()
+	if err != nil {
+		return err
+	}
+
+	err = imageConnection.ActivateVolumeGroups()
 	if err != nil {
 		return err
 	}
-	defer imageLoopback.Close()
 
-	err = checkFileSystemsHelper(imageLoopback.DevicePath())
+	err = checkFileSystemsHelper(imageConnection.Loopback().DevicePath())
 	if err != nil {
 		return err
 	}
 
-	err = imageLoopback.CleanClose()
+	err = imageConnection.CleanClose()
 	if err != nil {
 		return err
 	}
@@ -44,7 +57,7 @@ func checkFileSystemsHelper(diskDevice string) error {
 
 	errs := []error(nil)
 	for _, diskPartition := range diskPartitions {
-		if diskPartition.Type != "part" {
+		if !isFileSystemDeviceType(diskPartition.Type) {
 			// Skip the disk entry.
 			continue
 		}
@@ -108,6 +121,20 @@ func checkFileSystem(fileSystemType string, path string) error {
 			return fmt.Errorf("failed to check (%s) with xfs_repair:\n%w", path, err)
 		}
 
+	case "btrfs":
+		err := shell.ExecuteLive(true /*squashErrors*/, "btrfs", "check", "--readonly", path)
+		if err != nil {
+			return fmt.Errorf("failed to check (%s) with btrfs check:\n%w", path, err)
+		}
+
+	case "crypto_LUKS":
+		// The file system of an encrypted device can't be checked without the key.
+		logger.Log.Debugf("Skipping file system check of encrypted device (%s)", path)
+
+	case lvmPhysicalVolumeFsType, raidMemberFsType:
+		// The file systems of the logical volumes and RAID arrays are checked separately.
+		logger.Log.Debugf("Skipping file system check of LVM physical volume or RAID member (%s)", path)
+
 	default:
 		err := shell.ExecuteLive(true /*squashErrors*/, "fsck", "-n", path)
 		if err != nil {
@@ -0,0 +1,280 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/sliceutils"
+)
+
+// configFragment is a config file whose contents are only validated after it has been merged with the config files
+// that it includes (and that include it).
+type configFragment imagecustomizerapi.Config
+
+func (c *configFragment) IsValid() error {
+	return nil
+}
+
+// ConfigFileOptions holds the options for how a config file is loaded.
+type ConfigFileOptions struct {
+	// ConfigVars are the values of the config variables (i.e. --set NAME=VALUE) that replace the "${NAME}" references
+	// in the config file.
+	ConfigVars map[string]string
+	// StrictConfigVars makes references to undefined config variables an error (i.e. --strict-vars).
+	StrictConfigVars bool
+}
+
+// loadConfigFile reads a config file, substitutes its variables, merges in the config files that it includes, and
+// validates the result.
+// Returns the config and the absolute path of the config file's directory, which the config's relative paths are
+// relative to.
+func loadConfigFile(configFile string, options ConfigFileOptions) (*imagecustomizerapi.Config, string, error) {
+	err := validateConfigVars(options.ConfigVars)
+	if err != nil {
+		return nil, "", err
+	}
+
+	absConfigFile, err := filepath.Abs(configFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get absolute path of config file:\n%w", err)
+	}
+
+	loader := configFileLoader{
+		configVars:       options.ConfigVars,
+		strictConfigVars: options.StrictConfigVars,
+	}
+
+	config, err := loader.load(absConfigFile, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = config.IsValid()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return config, filepath.Dir(absConfigFile), nil
+}
+
+type configFileLoader struct {
+	configVars       map[string]string
+	strictConfigVars bool
+}
+
+func (l *configFileLoader) load(configFile string, includeStack []string) (*imagecustomizerapi.Config, error) {
+	if sliceutils.ContainsValue(includeStack, configFile) {
+		return nil, fmt.Errorf("config file (%s) includes itself", configFile)
+	}
+
+	includeStack = append(includeStack, configFile)
+
+	configData, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	configData, err = substituteConfigVars(configData, l.configVars, l.strictConfigVars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to substitute config variables:\n%w", err)
+	}
+
+	err = imagecustomizerapi.ValidateConfigYamlSchema(configData)
+	if err != nil {
+		return nil, err
+	}
+
+	var fragment configFragment
+	err = imagecustomizerapi.UnmarshalYaml(configData, &fragment)
+	if err != nil {
+		return nil, err
+	}
+
+	config := (*imagecustomizerapi.Config)(&fragment)
+	configDir := filepath.Dir(configFile)
+
+	mergedConfig := &imagecustomizerapi.Config{}
+	for _, include := range config.Include {
+		includeFile := file.GetAbsPathWithBase(configDir, include)
+
+		includedConfig, err := l.load(includeFile, includeStack)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load included config file (%s):\n%w", include, err)
+		}
+
+		rebaseConfigPaths(includedConfig, filepath.Dir(includeFile), configDir)
+		mergeConfigs(mergedConfig, includedConfig)
+	}
+
+	config.Include = nil
+	mergeConfigs(mergedConfig, config)
+
+	return mergedConfig, nil
+}
+
+// replacedConfigFields lists the list fields that are replaced as a whole, instead of being appended to, since a
+// command with appended args isn't meaningful.
+var replacedConfigFields = map[reflect.Type]map[string]bool{
+	reflect.TypeOf(imagecustomizerapi.Container{}): {"Entrypoint": true, "Cmd": true},
+}
+
+// mergeConfigs layers the overlay config on top of the base config.
+//
+// The merge rules are:
+//   - Lists are appended to (e.g. os.packages.install, os.additionalFiles and scripts.postCustomization).
+//   - Maps are merged, with the overlay's values replacing the base's values for the same key.
+//   - Objects are merged field by field.
+//   - Other values (e.g. os.hostname) are replaced, if they are set in the overlay. A value set to its zero value
+//     (e.g. false or "") is indistinguishable from an unset value. So, an overlay can't reset a value to its zero
+//     value.
+//   - The storage object is replaced as a whole, if it is set in the overlay, since a partial disk layout isn't
+//     meaningful.
+//   - Kernel command-line args (extraCommandLine) are appended to.
+//   - The container's entrypoint and cmd are replaced as a whole, if they are set in the overlay.
+func mergeConfigs(base *imagecustomizerapi.Config, overlay *imagecustomizerapi.Config) {
+	mergeConfigValues(reflect.ValueOf(base).Elem(), reflect.ValueOf(overlay).Elem())
+}
+
+func mergeConfigValues(base reflect.Value, overlay reflect.Value) {
+	if overlay.IsZero() {
+		return
+	}
+
+	switch base.Type() {
+	case reflect.TypeOf(imagecustomizerapi.Storage{}):
+		base.Set(overlay)
+		return
+
+	case reflect.TypeOf(imagecustomizerapi.KernelExtraArguments("")):
+		args := strings.TrimSpace(base.String() + " " + overlay.String())
+		base.SetString(args)
+		return
+	}
+
+	switch base.Kind() {
+	case reflect.Pointer:
+		elemKind := base.Type().Elem().Kind()
+		if base.IsNil() || (elemKind != reflect.Struct && elemKind != reflect.Slice) {
+			base.Set(overlay)
+			return
+		}
+
+		mergeConfigValues(base.Elem(), overlay.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < base.NumField(); i++ {
+			field := base.Type().Field(i)
+			switch {
+			case !field.IsExported():
+			case replacedConfigFields[base.Type()][field.Name]:
+				if !overlay.Field(i).IsZero() {
+					base.Field(i).Set(overlay.Field(i))
+				}
+			default:
+				mergeConfigValues(base.Field(i), overlay.Field(i))
+			}
+		}
+
+	case reflect.Slice:
+		base.Set(reflect.AppendSlice(base, overlay))
+
+	case reflect.Map:
+		if base.IsNil() {
+			base.Set(reflect.MakeMap(base.Type()))
+		}
+
+		iter := overlay.MapRange()
+		for iter.Next() {
+			base.SetMapIndex(iter.Key(), iter.Value())
+		}
+
+	default:
+		base.Set(overlay)
+	}
+}
+
+// rebaseConfigPaths changes the relative paths in an included config from being relative to the included config
+// file's directory to being relative to the including config file's directory.
+func rebaseConfigPaths(config *imagecustomizerapi.Config, fromDir string, toDir string) {
+	rebasePath := func(path *string) {
+		if *path == "" || filepath.IsAbs(*path) {
+			return
+		}
+
+		relPath, err := filepath.Rel(toDir, filepath.Join(fromDir, *path))
+		if err != nil {
+			relPath = filepath.Join(fromDir, *path)
+		}
+
+		*path = relPath
+	}
+
+	rebaseAdditionalFiles := func(additionalFiles imagecustomizerapi.AdditionalFileList) {
+		for i := range additionalFiles {
+			rebasePath(&additionalFiles[i].Source)
+		}
+	}
+
+	for i := range config.Storage.Encryption {
+		rebasePath(&config.Storage.Encryption[i].KeyFile)
+	}
+
+	if config.Iso != nil {
+		rebaseAdditionalFiles(config.Iso.AdditionalFiles)
+	}
+
+	if config.OS != nil {
+		for _, packageLists := range [][]string{
+			config.OS.Packages.InstallLists, config.OS.Packages.RemoveLists, config.OS.Packages.UpdateLists,
+		} {
+			for i := range packageLists {
+				rebasePath(&packageLists[i])
+			}
+		}
+
+		rebaseAdditionalFiles(config.OS.AdditionalFiles)
+
+		for i := range config.OS.AdditionalDirs {
+			rebasePath(&config.OS.AdditionalDirs[i].Source)
+		}
+
+		for i := range config.OS.Users {
+			user := &config.OS.Users[i]
+
+			if user.Password != nil && (user.Password.Type == imagecustomizerapi.PasswordTypePlainTextFile ||
+				user.Password.Type == imagecustomizerapi.PasswordTypeHashedFile) {
+				rebasePath(&user.Password.Value)
+			}
+
+			for j := range user.SSHPublicKeyPaths {
+				rebasePath(&user.SSHPublicKeyPaths[j])
+			}
+		}
+
+		if config.OS.Uki != nil && config.OS.Uki.Signing != nil {
+			rebasePath(&config.OS.Uki.Signing.KeyFile)
+			rebasePath(&config.OS.Uki.Signing.CertificateFile)
+		}
+
+		if config.OS.Sbom != nil && config.OS.Sbom.Signing != nil {
+			rebasePath(&config.OS.Sbom.Signing.KeyFile)
+			rebasePath(&config.OS.Sbom.Signing.CertificateFile)
+		}
+	}
+
+	for _, scripts := range [][]imagecustomizerapi.Script{
+		config.Scripts.PostCustomization, config.Scripts.FinalizeCustomization,
+	} {
+		for i := range scripts {
+			rebasePath(&scripts[i].Path)
+		}
+	}
+}
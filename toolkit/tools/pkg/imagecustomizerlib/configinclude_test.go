@@ -0,0 +1,236 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestConfigFiles(t *testing.T, configFiles map[string]string) string {
+	configDir := t.TempDir()
+	for name, contents := range configFiles {
+		path := filepath.Join(configDir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		assert.NoError(t, err)
+
+		err = file.Write(contents, path)
+		assert.NoError(t, err)
+	}
+	return configDir
+}
+
+func TestLoadConfigFileInclude(t *testing.T) {
+	configDir := writeTestConfigFiles(t, map[string]string{
+		"profiles/base.yaml": `
+os:
+  hostname: base
+  packages:
+    installLists:
+    - lists/base.yaml
+    install:
+    - jq
+  kernelCommandLine:
+    extraCommandLine: console=ttyS0
+  additionalFiles:
+  - source: files/motd
+    destination: /etc/motd
+  services:
+    enable:
+    - sshd
+scripts:
+  postCustomization:
+  - path: scripts/setup.sh
+`,
+		"image.yaml": `
+include:
+- profiles/base.yaml
+os:
+  hostname: image
+  packages:
+    install:
+    - vim
+  kernelCommandLine:
+    extraCommandLine: quiet
+  additionalFiles:
+  - source: /etc/hosts
+    destination: /etc/hosts
+`,
+	})
+
+	config, baseConfigPath, err := loadConfigFile(filepath.Join(configDir, "image.yaml"), ConfigFileOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, configDir, baseConfigPath)
+	assert.Empty(t, config.Include)
+
+	if assert.NotNil(t, config.OS) {
+		assert.Equal(t, "image", config.OS.Hostname)
+		assert.Equal(t, []string{"profiles/lists/base.yaml"}, config.OS.Packages.InstallLists)
+		assert.Equal(t, []string{"jq", "vim"}, config.OS.Packages.Install)
+		assert.Equal(t, imagecustomizerapi.KernelExtraArguments("console=ttyS0 quiet"),
+			config.OS.KernelCommandLine.ExtraCommandLine)
+		assert.Equal(t, imagecustomizerapi.AdditionalFileList{
+			{Source: "profiles/files/motd", Destination: "/etc/motd"},
+			{Source: "/etc/hosts", Destination: "/etc/hosts"},
+		}, config.OS.AdditionalFiles)
+		assert.Equal(t, []string{"sshd"}, config.OS.Services.Enable)
+	}
+
+	if assert.Len(t, config.Scripts.PostCustomization, 1) {
+		assert.Equal(t, "profiles/scripts/setup.sh", config.Scripts.PostCustomization[0].Path)
+	}
+}
+
+func TestLoadConfigFileIncludeStorage(t *testing.T) {
+	configDir := writeTestConfigFiles(t, map[string]string{
+		"base.yaml": `
+storage:
+  resetPartitionsUuidsType: reset-all
+os:
+  resetBootLoaderType: hard-reset
+`,
+		"nested.yaml": `
+include:
+- base.yaml
+`,
+		"image.yaml": `
+include:
+- nested.yaml
+storage:
+  bootType: efi
+  disks:
+  - partitionTableType: gpt
+    maxSize: 1G
+    partitions:
+    - id: esp
+      type: esp
+      size: 8M
+    - id: rootfs
+      size: grow
+  filesystems:
+  - deviceId: esp
+    type: fat32
+    mountPoint: /boot/efi
+  - deviceId: rootfs
+    type: ext4
+    mountPoint: /
+`,
+	})
+
+	config, _, err := loadConfigFile(filepath.Join(configDir, "image.yaml"), ConfigFileOptions{})
+	assert.NoError(t, err)
+
+	// The storage object is replaced as a whole.
+	assert.Equal(t, imagecustomizerapi.ResetPartitionsUuidsTypeDefault, config.Storage.ResetPartitionsUuidsType)
+	assert.Equal(t, imagecustomizerapi.BootTypeEfi, config.Storage.BootType)
+	assert.Len(t, config.Storage.Disks, 1)
+
+	if assert.NotNil(t, config.OS) {
+		assert.Equal(t, imagecustomizerapi.ResetBootLoaderTypeHard, config.OS.ResetBootLoaderType)
+	}
+}
+
+func TestLoadConfigFileIncludeZeroValueOverlay(t *testing.T) {
+	configDir := writeTestConfigFiles(t, map[string]string{
+		"base.yaml": `
+os:
+  hostname: base
+  packages:
+    updateExistingPackages: true
+`,
+		"image.yaml": `
+include: [ base.yaml ]
+os:
+  hostname: ""
+  packages:
+    updateExistingPackages: false
+`,
+	})
+
+	config, _, err := loadConfigFile(filepath.Join(configDir, "image.yaml"), ConfigFileOptions{})
+	assert.NoError(t, err)
+
+	// An overlay can't reset a value to its zero value, since it is the same as the value not being set.
+	if assert.NotNil(t, config.OS) {
+		assert.Equal(t, "base", config.OS.Hostname)
+		assert.True(t, config.OS.Packages.UpdateExistingPackages)
+	}
+}
+
+func TestLoadConfigFileIncludeCycle(t *testing.T) {
+	configDir := writeTestConfigFiles(t, map[string]string{
+		"a.yaml": "include: [ b.yaml ]\n",
+		"b.yaml": "include: [ a.yaml ]\n",
+	})
+
+	_, _, err := loadConfigFile(filepath.Join(configDir, "a.yaml"), ConfigFileOptions{})
+	assert.ErrorContains(t, err, "failed to load included config file (b.yaml):\n"+
+		"failed to load included config file (a.yaml):\n"+
+		"config file ("+filepath.Join(configDir, "a.yaml")+") includes itself")
+}
+
+func TestLoadConfigFileIncludeMissing(t *testing.T) {
+	configDir := writeTestConfigFiles(t, map[string]string{
+		"image.yaml": "include: [ missing.yaml ]\n",
+	})
+
+	_, _, err := loadConfigFile(filepath.Join(configDir, "image.yaml"), ConfigFileOptions{})
+	assert.ErrorContains(t, err, "failed to load included config file (missing.yaml)")
+	assert.ErrorContains(t, err, "no such file or directory")
+}
+
+func TestLoadConfigFileIncludeInvalidResult(t *testing.T) {
+	// The merged config is validated as a whole.
+	configDir := writeTestConfigFiles(t, map[string]string{
+		"base.yaml":  "storage:\n  resetPartitionsUuidsType: reset-all\n",
+		"image.yaml": "include: [ base.yaml ]\nos:\n  hostname: image\n",
+	})
+
+	_, _, err := loadConfigFile(filepath.Join(configDir, "image.yaml"), ConfigFileOptions{})
+	assert.ErrorContains(t, err,
+		"'os.resetBootLoaderType' must be specified if 'storage.resetPartitionsUuidsType' is specified")
+}
+
+func TestLoadConfigFileIncludeContainer(t *testing.T) {
+	configDir := writeTestConfigFiles(t, map[string]string{
+		"base.yaml": `
+container:
+  labels:
+    org.opencontainers.image.vendor: contoso
+  entrypoint: [ /usr/bin/bash ]
+  cmd: [ -l ]
+  excludePaths: [ /boot ]
+`,
+		"image.yaml": `
+include: [ base.yaml ]
+container:
+  tag: myapp:1.0
+  labels:
+    org.opencontainers.image.title: myapp
+  entrypoint: [ /usr/bin/myapp ]
+  excludePaths: [ /var/cache/tdnf ]
+`,
+	})
+
+	config, _, err := loadConfigFile(filepath.Join(configDir, "image.yaml"), ConfigFileOptions{})
+	assert.NoError(t, err)
+
+	// The entrypoint is replaced, instead of being appended to.
+	assert.Equal(t, &imagecustomizerapi.Container{
+		Tag: "myapp:1.0",
+		Labels: map[string]string{
+			"org.opencontainers.image.vendor": "contoso",
+			"org.opencontainers.image.title":  "myapp",
+		},
+		Entrypoint:   []string{"/usr/bin/myapp"},
+		Cmd:          []string{"-l"},
+		ExcludePaths: &[]string{"/boot", "/var/cache/tdnf"},
+	}, config.Container)
+}
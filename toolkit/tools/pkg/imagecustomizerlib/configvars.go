@@ -0,0 +1,99 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+)
+
+const configEnvVarPrefix = "env."
+
+var (
+	configVarNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// Matches "$${" (an escaped "${"), "${env.NAME}" and "${NAME}".
+	configVarRefRegex = regexp.MustCompile(`\$\$\{|\$\{((?:env\.)?[A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+func validateConfigVars(configVars map[string]string) error {
+	for name := range configVars {
+		if !configVarNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid config variable name (%s):\nnames must match the pattern (%s)", name,
+				configVarNameRegex.String())
+		}
+	}
+
+	return nil
+}
+
+// substituteConfigVars replaces the "${NAME}" references in a config file's contents with the values of the config
+// variables (i.e. --set NAME=VALUE) and the "${env.NAME}" references with the values of the environment variables.
+//
+// Undefined variables are an error, if strict is set. Otherwise, their references are left as they are, so that
+// shell variables in inline scripts don't need to be escaped.
+func substituteConfigVars(configData []byte, configVars map[string]string, strict bool) ([]byte, error) {
+	var result bytes.Buffer
+	var errs []error
+
+	lastEnd := 0
+	for _, match := range configVarRefRegex.FindAllSubmatchIndex(configData, -1) {
+		start, end := match[0], match[1]
+		result.Write(configData[lastEnd:start])
+		lastEnd = end
+
+		if match[2] < 0 {
+			// Escaped reference.
+			result.WriteString("${")
+			continue
+		}
+
+		name := string(configData[match[2]:match[3]])
+		value, found := lookupConfigVar(name, configVars)
+		if !found {
+			line, column := textPosition(configData, start)
+			if strict {
+				errs = append(errs, fmt.Errorf("line %d, column %d: undefined config variable (%s)", line, column,
+					name))
+			} else {
+				logger.Log.Debugf("Config variable (%s) at line %d, column %d is undefined", name, line, column)
+			}
+
+			result.Write(configData[start:end])
+			continue
+		}
+
+		result.WriteString(value)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	result.Write(configData[lastEnd:])
+	return result.Bytes(), nil
+}
+
+func lookupConfigVar(name string, configVars map[string]string) (string, bool) {
+	envVarName, isEnvVar := strings.CutPrefix(name, configEnvVarPrefix)
+	if isEnvVar {
+		return os.LookupEnv(envVarName)
+	}
+
+	value, found := configVars[name]
+	return value, found
+}
+
+// textPosition returns the 1-based line and column of a byte offset within a text.
+func textPosition(text []byte, offset int) (int, int) {
+	line := bytes.Count(text[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(text[:offset], '\n')
+	return line, column
+}
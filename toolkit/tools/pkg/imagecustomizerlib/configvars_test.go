@@ -0,0 +1,83 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubstituteConfigVars(t *testing.T) {
+	t.Setenv("TEST_CONFIG_SKU", "edge")
+
+	configData := "os:\n" +
+		"  hostname: ${HOSTNAME}-${env.TEST_CONFIG_SKU}\n" +
+		"  packages:\n" +
+		"    installLists: [ lists/${env.TEST_CONFIG_SKU}.yaml ]\n" +
+		"scripts:\n" +
+		"  postCustomization:\n" +
+		"  - content: echo $${HOSTNAME} ${SHELL_VAR} $HOME\n"
+
+	result, err := substituteConfigVars([]byte(configData), map[string]string{"HOSTNAME": "web"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "os:\n"+
+		"  hostname: web-edge\n"+
+		"  packages:\n"+
+		"    installLists: [ lists/edge.yaml ]\n"+
+		"scripts:\n"+
+		"  postCustomization:\n"+
+		"  - content: echo ${HOSTNAME} ${SHELL_VAR} $HOME\n", string(result))
+}
+
+func TestSubstituteConfigVarsStrict(t *testing.T) {
+	configData := "os:\n" +
+		"  hostname: ${HOSTNAME}\n" +
+		"  packages:\n" +
+		"    install: [ ${PACKAGE}, $${ESCAPED}, ${env.TEST_CONFIG_UNDEFINED} ]\n"
+
+	_, err := substituteConfigVars([]byte(configData), map[string]string{"HOSTNAME": "web"}, true)
+	assert.EqualError(t, err, "line 4, column 16: undefined config variable (PACKAGE)\n"+
+		"line 4, column 41: undefined config variable (env.TEST_CONFIG_UNDEFINED)")
+}
+
+func TestValidateConfigVars(t *testing.T) {
+	err := validateConfigVars(map[string]string{"HOSTNAME": "web", "_image_size2": "4G"})
+	assert.NoError(t, err)
+
+	err = validateConfigVars(map[string]string{"env.HOSTNAME": "web"})
+	assert.ErrorContains(t, err, "invalid config variable name (env.HOSTNAME)")
+}
+
+func TestLoadConfigFileVars(t *testing.T) {
+	configDir := writeTestConfigFiles(t, map[string]string{
+		"profiles/base.yaml": "os:\n  hostname: ${HOSTNAME}\n",
+		"image.yaml":         "include: [ profiles/${PROFILE}.yaml ]\nos:\n  selinux:\n    mode: ${SELINUX_MODE}\n",
+	})
+
+	options := ConfigFileOptions{
+		ConfigVars: map[string]string{
+			"HOSTNAME":     "web",
+			"PROFILE":      "base",
+			"SELINUX_MODE": "enforcing",
+		},
+		StrictConfigVars: true,
+	}
+
+	config, _, err := loadConfigFile(filepath.Join(configDir, "image.yaml"), options)
+	assert.NoError(t, err)
+	if assert.NotNil(t, config.OS) {
+		assert.Equal(t, "web", config.OS.Hostname)
+		assert.Equal(t, imagecustomizerapi.SELinuxModeEnforcing, config.OS.SELinux.Mode)
+	}
+
+	delete(options.ConfigVars, "HOSTNAME")
+
+	_, _, err = loadConfigFile(filepath.Join(configDir, "image.yaml"), options)
+	assert.ErrorContains(t, err, "failed to load included config file (profiles/base.yaml):\n"+
+		"failed to substitute config variables:\n"+
+		"line 2, column 13: undefined config variable (HOSTNAME)")
+}
@@ -0,0 +1,349 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/diskutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safeloopback"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safemount"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/sliceutils"
+)
+
+const (
+	// The grubenv variable that selects which slot to boot. An update agent flips this after writing the other slot.
+	abSlotGrubEnvVar = "ab_slot"
+	// The grub config variable that holds the root device of the selected slot.
+	abRootDeviceGrubVar = "ab_rootdevice"
+
+	abSlotA = "a"
+	abSlotB = "b"
+
+	grubEnvHeader = "# GRUB Environment Block\n"
+	// grub-editenv always writes the grubenv file as a fixed size block.
+	grubEnvSize = 1024
+)
+
+// customizeABImageHelper sets up slot B of an A/B image and makes the grub config boot the slot selected by the
+// 'ab_slot' grubenv variable. This is done after all the other changes to the root partition, so that a cloned slot
+// B is identical to slot A.
+func customizeABImageHelper(buildDir string, storage imagecustomizerapi.Storage, buildImageFile string,
+	partIdToPartUuid map[string]string,
+) error {
+	logger.Log.Infof("Setting up A/B slots")
+
+	abUpdate := storage.ABUpdate
+
+	rootFileSystem, foundRootFileSystem := sliceutils.FindValueFunc(storage.FileSystems,
+		func(fileSystem imagecustomizerapi.FileSystem) bool {
+			return fileSystem.MountPoint != nil && fileSystem.MountPoint.Path == "/"
+		},
+	)
+	if !foundRootFileSystem {
+		return fmt.Errorf("failed to find root filesystem (i.e. mount equal to '/')")
+	}
+
+	bootFileSystem, foundBootFileSystem := sliceutils.FindValueFunc(storage.FileSystems,
+		func(fileSystem imagecustomizerapi.FileSystem) bool {
+			return fileSystem.MountPoint != nil && fileSystem.MountPoint.Path == "/boot"
+		},
+	)
+	if !foundBootFileSystem {
+		return fmt.Errorf("failed to find boot filesystem (i.e. mount equal to '/boot')")
+	}
+
+	rootIdType := rootFileSystem.MountPoint.IdType
+
+	loopback, err := safeloopback.NewLoopback(buildImageFile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to image file to set up A/B slots:\n%w", err)
+	}
+	defer loopback.Close()
+
+	diskPartitions, err := diskutils.GetDiskPartitions(loopback.DevicePath())
+	if err != nil {
+		return err
+	}
+
+	if abUpdate.SlotBContent == imagecustomizerapi.ABSlotContentTypeClone {
+		diskPartitions, err = cloneABSlot(rootFileSystem.PartitionId, abUpdate.SlotBDeviceId, rootIdType,
+			loopback.DevicePath(), diskPartitions, partIdToPartUuid, buildDir)
+		if err != nil {
+			return fmt.Errorf("failed to clone slot A into slot B:\n%w", err)
+		}
+	}
+
+	slotARootDevice, err := systemdFormatPartitionId(rootFileSystem.PartitionId, rootIdType, partIdToPartUuid,
+		diskPartitions)
+	if err != nil {
+		return err
+	}
+
+	slotBRootDevice, err := systemdFormatPartitionId(abUpdate.SlotBDeviceId, rootIdType, partIdToPartUuid,
+		diskPartitions)
+	if err != nil {
+		return err
+	}
+
+	bootPartition, _, err := findPartition(imagecustomizerapi.MountIdentifierTypePartUuid,
+		partIdToPartUuid[bootFileSystem.PartitionId], diskPartitions)
+	if err != nil {
+		return err
+	}
+
+	bootPartitionTmpDir := filepath.Join(buildDir, tmpParitionDirName)
+	bootPartitionMount, err := safemount.NewMount(bootPartition.Path, bootPartitionTmpDir,
+		bootPartition.FileSystemType, 0, "", true)
+	if err != nil {
+		return fmt.Errorf("failed to mount partition (%s):\n%w", bootPartition.Path, err)
+	}
+	defer bootPartitionMount.Close()
+
+	// Note: Like verity, the grub.cfg file is modified directly, even if grub-mkconfig is being used. Otherwise, the
+	// slot selection would have to be added as a grub.d script.
+	grubCfgFullPath := filepath.Join(bootPartitionTmpDir, "grub2/grub.cfg")
+	grub2Config, err := file.Read(grubCfgFullPath)
+	if err != nil {
+		return fmt.Errorf("failed to read grub config:\n%w", err)
+	}
+
+	grub2Config, err = updateGrubConfigForAB(grub2Config, slotARootDevice, slotBRootDevice)
+	if err != nil {
+		return err
+	}
+
+	err = file.Write(grub2Config, grubCfgFullPath)
+	if err != nil {
+		return fmt.Errorf("failed to write updated grub config:\n%w", err)
+	}
+
+	// Boot slot A by default.
+	err = setGrubEnvVarInFile(filepath.Join(bootPartitionTmpDir, "grub2/grubenv"), abSlotGrubEnvVar, abSlotA)
+	if err != nil {
+		return err
+	}
+
+	err = bootPartitionMount.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	err = loopback.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// cloneABSlot copies slot A's partition to slot B's partition. Slot B's filesystem is given a new UUID and its fstab
+// file is updated to mount slot B as the root filesystem. The updated list of the disk's partitions is returned.
+func cloneABSlot(slotAPartitionId string, slotBPartitionId string, rootIdType imagecustomizerapi.MountIdentifierType,
+	diskDevPath string, diskPartitions []diskutils.PartitionInfo, partIdToPartUuid map[string]string,
+	buildDir string,
+) ([]diskutils.PartitionInfo, error) {
+	slotAPath, err := idToPartitionBlockDevicePath(slotAPartitionId, diskPartitions, partIdToPartUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	slotBPath, err := idToPartitionBlockDevicePath(slotBPartitionId, diskPartitions, partIdToPartUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.Infof("Cloning slot A (%s) into slot B (%s)", slotAPath, slotBPath)
+
+	// Slot B has never been written to. So, skipping the zero blocks keeps the disk file sparse.
+	err = shell.ExecuteLive(true /*squashErrors*/, "dd", "if="+slotAPath, "of="+slotBPath, "bs=4M", "conv=sparse")
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy partition (%s) to (%s):\n%w", slotAPath, slotBPath, err)
+	}
+
+	err = diskutils.WaitForDevicesToSettle()
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-read the partitions, so that slot B's filesystem is detected.
+	diskPartitions, err = diskutils.GetDiskPartitions(diskDevPath)
+	if err != nil {
+		return nil, err
+	}
+
+	slotBPartition, _, err := findPartition(imagecustomizerapi.MountIdentifierTypePartUuid,
+		partIdToPartUuid[slotBPartitionId], diskPartitions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Avoid having two filesystems with the same UUID on the disk.
+	_, err = resetFileSystemUuid(slotBPartition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset slot B's filesystem UUID:\n%w", err)
+	}
+
+	slotBRootDevice, err := systemdFormatPartitionId(slotBPartitionId, rootIdType, partIdToPartUuid,
+		diskPartitions)
+	if err != nil {
+		return nil, err
+	}
+
+	slotBMountDir := filepath.Join(buildDir, tmpParitionDirName)
+	slotBMount, err := safemount.NewMount(slotBPath, slotBMountDir, slotBPartition.FileSystemType, 0, "", true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount slot B partition (%s):\n%w", slotBPath, err)
+	}
+	defer slotBMount.Close()
+
+	err = updateFstabRootSource(filepath.Join(slotBMountDir, "etc/fstab"), slotBRootDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update slot B's fstab file:\n%w", err)
+	}
+
+	err = slotBMount.CleanClose()
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh the partitions' filesystem UUIDs.
+	diskPartitions, err = diskutils.GetDiskPartitions(diskDevPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return diskPartitions, nil
+}
+
+// updateFstabRootSource changes the source of the root filesystem's fstab entry.
+func updateFstabRootSource(fstabPath string, rootSource string) error {
+	fstabEntries, err := diskutils.ReadFstabFile(fstabPath)
+	if err != nil {
+		return fmt.Errorf("failed to read fstab file:\n%w", err)
+	}
+
+	foundRoot := false
+	for i := range fstabEntries {
+		entry := &fstabEntries[i]
+		if entry.Target == "/" {
+			entry.Source = rootSource
+			foundRoot = true
+		}
+	}
+
+	if !foundRoot {
+		return fmt.Errorf("failed to find root filesystem in fstab file (%s)", fstabPath)
+	}
+
+	err = diskutils.WriteFstabFile(fstabEntries, fstabPath)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// updateGrubConfigForAB makes the grub config's kernel command lines use the root device of the slot selected by the
+// 'ab_slot' grubenv variable.
+func updateGrubConfigForAB(grub2Config string, slotARootDevice string, slotBRootDevice string) (string, error) {
+	grub2Config, _, err := replaceKernelCommandLineArgAll(grub2Config, "root", "root=$"+abRootDeviceGrubVar,
+		true /*allowMultiple*/)
+	if err != nil {
+		return "", fmt.Errorf("failed to set A/B root command-line arg:\n%w", err)
+	}
+
+	// The grubenv file is loaded before the first menu entry (by grub-mkconfig's header or by the image's grub.cfg
+	// file). So, the slot is selected just before it.
+	menuEntryLines, err := findGrubCommandAll(grub2Config, grubMenuEntryCommand, true /*allowMultiple*/)
+	if err != nil {
+		return "", err
+	}
+
+	insertAt := menuEntryLines[0].Tokens[0].Loc.Start.Index
+	grub2Config = grub2Config[:insertAt] + abSlotSelectionGrubConfig(slotARootDevice, slotBRootDevice) +
+		grub2Config[insertAt:]
+
+	return grub2Config, nil
+}
+
+// abSlotSelectionGrubConfig returns the grub script that sets the root device from the 'ab_slot' grubenv variable.
+// Any value other than 'b' boots slot A, so that a missing or corrupt grubenv file still boots.
+func abSlotSelectionGrubConfig(slotARootDevice string, slotBRootDevice string) string {
+	lines := []string{
+		fmt.Sprintf("if [ \"$%s\" = \"%s\" ]; then", abSlotGrubEnvVar, abSlotB),
+		fmt.Sprintf("\tset %s=%s", abRootDeviceGrubVar, slotBRootDevice),
+		"else",
+		fmt.Sprintf("\tset %s=%s", abRootDeviceGrubVar, slotARootDevice),
+		"fi",
+	}
+
+	return strings.Join(lines, "\n") + "\n\n"
+}
+
+func setGrubEnvVarInFile(grubEnvPath string, name string, value string) error {
+	grubEnv := ""
+
+	exists, err := file.PathExists(grubEnvPath)
+	if err != nil {
+		return fmt.Errorf("failed to check if (%s) exists:\n%w", grubEnvPath, err)
+	}
+
+	if exists {
+		grubEnv, err = file.Read(grubEnvPath)
+		if err != nil {
+			return fmt.Errorf("failed to read grubenv file:\n%w", err)
+		}
+	}
+
+	grubEnv, err = setGrubEnvVar(grubEnv, name, value)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(grubEnvPath, []byte(grubEnv), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write grubenv file:\n%w", err)
+	}
+
+	return nil
+}
+
+// setGrubEnvVar sets a variable in the contents of a grubenv file, in the same format that grub-editenv uses.
+func setGrubEnvVar(grubEnv string, name string, value string) (string, error) {
+	builder := strings.Builder{}
+	builder.WriteString(grubEnvHeader)
+
+	// Strip the padding at the end of the block.
+	for _, line := range strings.Split(strings.TrimRight(grubEnv, "#"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == strings.TrimSpace(grubEnvHeader) {
+			continue
+		}
+
+		lineName, _, _ := strings.Cut(line, "=")
+		if lineName == name {
+			continue
+		}
+
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString(fmt.Sprintf("%s=%s\n", name, value))
+
+	newGrubEnv := builder.String()
+	if len(newGrubEnv) > grubEnvSize {
+		return "", fmt.Errorf("grubenv file is too large (%d bytes)", len(newGrubEnv))
+	}
+
+	return newGrubEnv + strings.Repeat("#", grubEnvSize-len(newGrubEnv)), nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/stretchr/testify/assert"
+)
+
+const testABSlotSelection = `if [ "$ab_slot" = "b" ]; then
+	set ab_rootdevice=PARTUUID=2222
+else
+	set ab_rootdevice=PARTUUID=1111
+fi
+
+`
+
+func TestUpdateGrubConfigForAB20(t *testing.T) {
+	grub2Config, err := file.Read(filepath.Join(testDir, sampleGrubCfg20Path))
+	assert.NoError(t, err)
+
+	newGrub2Config, err := updateGrubConfigForAB(grub2Config, "PARTUUID=1111", "PARTUUID=2222")
+	assert.NoError(t, err)
+
+	expectedGrub2Config := strings.Replace(grub2Config, "menuentry", testABSlotSelection+"menuentry", 1)
+	expectedGrub2Config = strings.Replace(expectedGrub2Config, "root=$rootdevice", "root=$ab_rootdevice", 1)
+	assert.Equal(t, expectedGrub2Config, newGrub2Config)
+}
+
+func TestUpdateGrubConfigForABMkconfig(t *testing.T) {
+	grub2Config := `### BEGIN /etc/grub.d/00_header ###
+if [ -s $prefix/grubenv ]; then
+  load_env
+fi
+### END /etc/grub.d/00_header ###
+menuentry 'Azure Linux' {
+	linux /vmlinuz-6.6.47.1-1.azl3 root=PARTUUID=1111 ro
+}
+menuentry 'Azure Linux (recovery mode)' {
+	linux /vmlinuz-6.6.47.1-1.azl3 root=PARTUUID=1111 ro single
+}
+`
+
+	newGrub2Config, err := updateGrubConfigForAB(grub2Config, "PARTUUID=1111", "PARTUUID=2222")
+	assert.NoError(t, err)
+
+	expectedGrub2Config := strings.Replace(grub2Config, "menuentry", testABSlotSelection+"menuentry", 1)
+	expectedGrub2Config = strings.ReplaceAll(expectedGrub2Config, "root=PARTUUID=1111 ", "root=$ab_rootdevice ")
+	assert.Equal(t, expectedGrub2Config, newGrub2Config)
+}
+
+func TestSetGrubEnvVar(t *testing.T) {
+	grubEnv, err := file.Read(filepath.Join(testDir, "../../../internal/resources/assets/grub2/grubenv"))
+	assert.NoError(t, err)
+
+	newGrubEnv, err := setGrubEnvVar(grubEnv, "ab_slot", "a")
+	assert.NoError(t, err)
+	assert.Len(t, newGrubEnv, grubEnvSize)
+	assert.True(t, strings.HasPrefix(newGrubEnv, "# GRUB Environment Block\n"+
+		"# WARNING: Do not edit this file by tools other than grub-editenv!!!\n"+
+		"ab_slot=a\n#"))
+
+	newGrubEnv, err = setGrubEnvVar(newGrubEnv, "ab_slot", "b")
+	assert.NoError(t, err)
+	assert.Len(t, newGrubEnv, grubEnvSize)
+	assert.Equal(t, 1, strings.Count(newGrubEnv, "ab_slot="))
+	assert.Contains(t, newGrubEnv, "\nab_slot=b\n#")
+
+	newGrubEnv, err = setGrubEnvVar("", "ab_slot", "a")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(newGrubEnv, "# GRUB Environment Block\nab_slot=a\n#"))
+
+	_, err = setGrubEnvVar("", "ab_slot", strings.Repeat("a", grubEnvSize))
+	assert.ErrorContains(t, err, "grubenv file is too large")
+}
+
+func TestUpdateFstabRootSource(t *testing.T) {
+	fstabPath := filepath.Join(t.TempDir(), "fstab")
+	err := file.Write("PARTUUID=0000 /boot ext4 defaults 0 2\nPARTUUID=1111 / ext4 defaults 0 1\n", fstabPath)
+	assert.NoError(t, err)
+
+	err = updateFstabRootSource(fstabPath, "PARTUUID=2222")
+	assert.NoError(t, err)
+
+	fstab, err := file.Read(fstabPath)
+	assert.NoError(t, err)
+	assert.Contains(t, fstab, "PARTUUID=0000")
+	assert.Contains(t, fstab, "PARTUUID=2222")
+	assert.NotContains(t, fstab, "PARTUUID=1111")
+
+	err = file.Write("PARTUUID=0000 /boot ext4 defaults 0 2\n", fstabPath)
+	assert.NoError(t, err)
+
+	err = updateFstabRootSource(fstabPath, "PARTUUID=2222")
+	assert.ErrorContains(t, err, "failed to find root filesystem in fstab file")
+}
@@ -51,17 +51,25 @@ func hardResetBootLoader(baseConfigPath string, config *imagecustomizerapi.Confi
 	var rootMountIdType imagecustomizerapi.MountIdentifierType
 	var bootType imagecustomizerapi.BootType
 	if config.CustomizePartitions() {
+		// The root filesystem may also be a btrfs subvolume.
 		rootFileSystem, foundRootFileSystem := sliceutils.FindValueFunc(config.Storage.FileSystems,
 			func(fileSystem imagecustomizerapi.FileSystem) bool {
-				return fileSystem.MountPoint != nil &&
-					fileSystem.MountPoint.Path == "/"
+				_, found := fileSystem.GetMountPoint("/")
+				return found
 			},
 		)
 		if !foundRootFileSystem {
 			return fmt.Errorf("failed to find root filesystem (i.e. mount equal to '/')")
 		}
 
-		rootMountIdType = rootFileSystem.MountPoint.IdType
+		rootMountPoint, _ := rootFileSystem.GetMountPoint("/")
+		rootMountIdType = rootMountPoint.IdType
+		if sliceutils.ContainsFunc(config.Storage.Raid, func(raid imagecustomizerapi.Raid) bool {
+			return raid.Id == rootFileSystem.DeviceId
+		}) {
+			// RAID arrays don't have partition identifiers.
+			rootMountIdType = imagecustomizerapi.MountIdentifierTypeUuid
+		}
 		bootType = config.Storage.BootType
 	} else {
 		rootMountIdType, err = findRootMountIdTypeFromFstabFile(imageConnection)
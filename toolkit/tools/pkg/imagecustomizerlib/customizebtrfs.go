@@ -0,0 +1,288 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/diskutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safeloopback"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safemount"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+)
+
+const (
+	// btrfsTopLevelMountOptions mounts the top-level subvolume of a btrfs filesystem, regardless of which subvolume
+	// is the default one.
+	btrfsTopLevelMountOptions = "subvolid=5"
+)
+
+// createBtrfsSubvolumes creates the subvolumes of the btrfs filesystems. If the root filesystem is a subvolume, then
+// it is also made the default subvolume, so that mounting the filesystem without any options mounts the OS.
+func createBtrfsSubvolumes(fileSystems []imagecustomizerapi.FileSystem, partIDToDevPathMap map[string]string,
+	buildDir string,
+) error {
+	for _, fileSystem := range fileSystems {
+		if len(fileSystem.Subvolumes) <= 0 {
+			continue
+		}
+
+		devPath, found := partIDToDevPathMap[fileSystem.PartitionId]
+		if !found {
+			return fmt.Errorf("failed to find partition (%s) for btrfs filesystem", fileSystem.PartitionId)
+		}
+
+		err := createBtrfsSubvolumesOnDevice(fileSystem.Subvolumes, devPath, buildDir)
+		if err != nil {
+			return fmt.Errorf("failed to create btrfs subvolumes on (%s):\n%w", fileSystem.DeviceId, err)
+		}
+	}
+
+	return nil
+}
+
+func createBtrfsSubvolumesOnDevice(subvolumes []imagecustomizerapi.BtrfsSubvolume, devPath string,
+	buildDir string,
+) error {
+	mountDir := filepath.Join(buildDir, tmpParitionDirName)
+	mount, err := safemount.NewMount(devPath, mountDir, string(imagecustomizerapi.FileSystemTypeBtrfs), 0,
+		btrfsTopLevelMountOptions, true)
+	if err != nil {
+		return fmt.Errorf("failed to mount btrfs filesystem (%s):\n%w", devPath, err)
+	}
+	defer mount.Close()
+
+	for _, subvolumePath := range sortedBtrfsSubvolumePaths(subvolumes) {
+		logger.Log.Infof("Creating btrfs subvolume (%s)", subvolumePath)
+
+		fullPath := filepath.Join(mountDir, subvolumePath)
+
+		// Subvolumes may be nested within plain directories.
+		err = os.MkdirAll(filepath.Dir(fullPath), os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create parent directory of btrfs subvolume (%s):\n%w", subvolumePath, err)
+		}
+
+		err = shell.ExecuteLive(true /*squashErrors*/, "btrfs", "subvolume", "create", fullPath)
+		if err != nil {
+			return fmt.Errorf("failed to create btrfs subvolume (%s):\n%w", subvolumePath, err)
+		}
+	}
+
+	rootSubvolume, hasRootSubvolume := findRootBtrfsSubvolume(subvolumes)
+	if hasRootSubvolume {
+		err = shell.ExecuteLive(true /*squashErrors*/, "btrfs", "subvolume", "set-default",
+			filepath.Join(mountDir, rootSubvolume.Path))
+		if err != nil {
+			return fmt.Errorf("failed to set default btrfs subvolume (%s):\n%w", rootSubvolume.Path, err)
+		}
+	}
+
+	err = mount.CleanClose()
+	if err != nil {
+		return fmt.Errorf("failed to unmount btrfs filesystem (%s):\n%w", devPath, err)
+	}
+
+	return nil
+}
+
+// sortedBtrfsSubvolumePaths returns the subvolume paths in the order they must be created, so that parent subvolumes
+// are created before the subvolumes nested within them.
+func sortedBtrfsSubvolumePaths(subvolumes []imagecustomizerapi.BtrfsSubvolume) []string {
+	paths := []string(nil)
+	for _, subvolume := range subvolumes {
+		paths = append(paths, subvolume.Path)
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+func findRootBtrfsSubvolume(subvolumes []imagecustomizerapi.BtrfsSubvolume) (imagecustomizerapi.BtrfsSubvolume, bool) {
+	for _, subvolume := range subvolumes {
+		if subvolume.MountPoint != nil && subvolume.MountPoint.Path == "/" {
+			return subvolume, true
+		}
+	}
+
+	return imagecustomizerapi.BtrfsSubvolume{}, false
+}
+
+func enableBtrfs(fileSystems []imagecustomizerapi.FileSystem, imageChroot *safechroot.Chroot) (bool, error) {
+	var err error
+
+	hasBtrfs := false
+	rootSubvolume := imagecustomizerapi.BtrfsSubvolume{}
+	hasRootSubvolume := false
+	for _, fileSystem := range fileSystems {
+		if fileSystem.Type != imagecustomizerapi.FileSystemTypeBtrfs {
+			continue
+		}
+
+		hasBtrfs = true
+
+		subvolume, found := findRootBtrfsSubvolume(fileSystem.Subvolumes)
+		if found {
+			rootSubvolume = subvolume
+			hasRootSubvolume = true
+		}
+	}
+
+	if !hasBtrfs {
+		return false, nil
+	}
+
+	logger.Log.Infof("Enable btrfs")
+
+	err = validateBtrfsDependencies(imageChroot)
+	if err != nil {
+		return false, fmt.Errorf("failed to validate package dependencies for btrfs:\n%w", err)
+	}
+
+	// Integrate the btrfs dracut module into initramfs img.
+	err = addDracutModule("btrfs", imageChroot)
+	if err != nil {
+		return false, fmt.Errorf("failed to add dracut modules for btrfs:\n%w", err)
+	}
+
+	if hasRootSubvolume {
+		err = prepareGrubConfigForBtrfs(rootSubvolume, imageChroot)
+		if err != nil {
+			return false, fmt.Errorf("failed to prepare grub config files for btrfs:\n%w", err)
+		}
+	}
+
+	return true, nil
+}
+
+func prepareGrubConfigForBtrfs(rootSubvolume imagecustomizerapi.BtrfsSubvolume, imageChroot *safechroot.Chroot,
+) error {
+	bootCustomizer, err := NewBootCustomizer(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	// Tell the initramfs which subvolume to mount as the root filesystem.
+	err = bootCustomizer.UpdateKernelCommandLineArgs(defaultGrubFileVarNameCmdlineLinux, []string{"rootflags"},
+		[]string{btrfsKernelCommandLineArg(rootSubvolume)})
+	if err != nil {
+		return err
+	}
+
+	err = bootCustomizer.WriteToFile(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func btrfsKernelCommandLineArg(rootSubvolume imagecustomizerapi.BtrfsSubvolume) string {
+	return "rootflags=" + rootSubvolume.MountOptions()
+}
+
+func validateBtrfsDependencies(imageChroot *safechroot.Chroot) error {
+	requiredRpms := []string{"btrfs-progs"}
+
+	for _, pkg := range requiredRpms {
+		logger.Log.Debugf("Checking if package (%s) is installed", pkg)
+		if !isPackageInstalled(imageChroot, pkg) {
+			return fmt.Errorf("package (%s) is not installed:\nthe following packages must be installed to use "+
+				"btrfs: %v", pkg, requiredRpms)
+		}
+	}
+
+	return nil
+}
+
+// hasReadOnlyBtrfsSubvolumes returns true if any of the btrfs subvolumes need to be made read-only.
+func hasReadOnlyBtrfsSubvolumes(fileSystems []imagecustomizerapi.FileSystem) bool {
+	for _, fileSystem := range fileSystems {
+		for _, subvolume := range fileSystem.Subvolumes {
+			if subvolume.ReadOnly {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// customizeBtrfsImageHelper makes the read-only btrfs subvolumes read-only. This is done after the OS has been
+// customized, so that the subvolumes can be written to during customization.
+func customizeBtrfsImageHelper(buildDir string, fileSystems []imagecustomizerapi.FileSystem, buildImageFile string,
+	partIdToPartUuid map[string]string,
+) error {
+	loopback, err := safeloopback.NewLoopback(buildImageFile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to image file to make btrfs subvolumes read-only:\n%w", err)
+	}
+	defer loopback.Close()
+
+	diskPartitions, err := diskutils.GetDiskPartitions(loopback.DevicePath())
+	if err != nil {
+		return err
+	}
+
+	for _, fileSystem := range fileSystems {
+		if !hasReadOnlyBtrfsSubvolumes([]imagecustomizerapi.FileSystem{fileSystem}) {
+			continue
+		}
+
+		partitionPath, err := idToPartitionBlockDevicePath(fileSystem.PartitionId, diskPartitions, partIdToPartUuid)
+		if err != nil {
+			return err
+		}
+
+		err = setBtrfsSubvolumesReadOnly(fileSystem.Subvolumes, partitionPath, buildDir)
+		if err != nil {
+			return fmt.Errorf("failed to make btrfs subvolumes read-only on (%s):\n%w", fileSystem.DeviceId, err)
+		}
+	}
+
+	err = loopback.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func setBtrfsSubvolumesReadOnly(subvolumes []imagecustomizerapi.BtrfsSubvolume, devPath string, buildDir string,
+) error {
+	mountDir := filepath.Join(buildDir, tmpParitionDirName)
+	mount, err := safemount.NewMount(devPath, mountDir, string(imagecustomizerapi.FileSystemTypeBtrfs), 0,
+		btrfsTopLevelMountOptions, true)
+	if err != nil {
+		return fmt.Errorf("failed to mount btrfs filesystem (%s):\n%w", devPath, err)
+	}
+	defer mount.Close()
+
+	for _, subvolume := range subvolumes {
+		if !subvolume.ReadOnly {
+			continue
+		}
+
+		logger.Log.Infof("Making btrfs subvolume (%s) read-only", subvolume.Path)
+
+		err = shell.ExecuteLive(true /*squashErrors*/, "btrfs", "property", "set", "-ts",
+			filepath.Join(mountDir, subvolume.Path), "ro", "true")
+		if err != nil {
+			return fmt.Errorf("failed to make btrfs subvolume (%s) read-only:\n%w", subvolume.Path, err)
+		}
+	}
+
+	err = mount.CleanClose()
+	if err != nil {
+		return fmt.Errorf("failed to unmount btrfs filesystem (%s):\n%w", devPath, err)
+	}
+
+	return nil
+}
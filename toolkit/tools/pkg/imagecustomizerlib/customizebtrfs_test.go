@@ -0,0 +1,90 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBtrfsFileSystem() imagecustomizerapi.FileSystem {
+	return imagecustomizerapi.FileSystem{
+		DeviceId:    "root",
+		PartitionId: "root",
+		Type:        imagecustomizerapi.FileSystemTypeBtrfs,
+		Subvolumes: []imagecustomizerapi.BtrfsSubvolume{
+			{
+				Path: "@home",
+				MountPoint: &imagecustomizerapi.MountPoint{
+					Path:    "/home",
+					Options: "compress=zstd",
+				},
+			},
+			{
+				Path: "@",
+				MountPoint: &imagecustomizerapi.MountPoint{
+					Path:   "/",
+					IdType: imagecustomizerapi.MountIdentifierTypeUuid,
+				},
+			},
+			{
+				Path:     "@/var/lib/snapshot",
+				ReadOnly: true,
+			},
+		},
+	}
+}
+
+func TestSortedBtrfsSubvolumePaths(t *testing.T) {
+	fileSystem := newTestBtrfsFileSystem()
+	assert.Equal(t, []string{"@", "@/var/lib/snapshot", "@home"}, sortedBtrfsSubvolumePaths(fileSystem.Subvolumes))
+}
+
+func TestFindRootBtrfsSubvolume(t *testing.T) {
+	fileSystem := newTestBtrfsFileSystem()
+
+	subvolume, found := findRootBtrfsSubvolume(fileSystem.Subvolumes)
+	assert.True(t, found)
+	assert.Equal(t, "@", subvolume.Path)
+	assert.Equal(t, "rootflags=subvol=@", btrfsKernelCommandLineArg(subvolume))
+
+	_, found = findRootBtrfsSubvolume(fileSystem.Subvolumes[:1])
+	assert.False(t, found)
+}
+
+func TestHasReadOnlyBtrfsSubvolumes(t *testing.T) {
+	fileSystem := newTestBtrfsFileSystem()
+	assert.True(t, hasReadOnlyBtrfsSubvolumes([]imagecustomizerapi.FileSystem{fileSystem}))
+
+	fileSystem.Subvolumes = fileSystem.Subvolumes[:2]
+	assert.False(t, hasReadOnlyBtrfsSubvolumes([]imagecustomizerapi.FileSystem{fileSystem}))
+}
+
+func TestPartitionSettingsToImagerBtrfsSubvolumes(t *testing.T) {
+	fileSystems := []imagecustomizerapi.FileSystem{newTestBtrfsFileSystem()}
+
+	partitionSettings, err := partitionSettingsToImager(fileSystems)
+	assert.NoError(t, err)
+	assert.Equal(t, []configuration.PartitionSetting{
+		{
+			ID:              "root",
+			MountIdentifier: configuration.MountIdentifierPartUuid,
+		},
+		{
+			ID:              "root",
+			MountIdentifier: configuration.MountIdentifierPartUuid,
+			MountOptions:    "subvol=@home,compress=zstd",
+			MountPoint:      "/home",
+		},
+		{
+			ID:              "root",
+			MountIdentifier: configuration.MountIdentifierUuid,
+			MountOptions:    "subvol=@",
+			MountPoint:      "/",
+		},
+	}, partitionSettings)
+}
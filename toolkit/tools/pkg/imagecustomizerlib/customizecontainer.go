@@ -0,0 +1,485 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+)
+
+const (
+	containerLayerTarFileName = "container-layer.tar"
+	containerLayerBlobName    = "container-layer.tar.gz"
+	containerRootfsDirName    = "container-rootfs-mount"
+
+	ociLayoutVersion = "1.0.0"
+	ociBlobsDir      = "blobs/sha256"
+
+	ociMediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	ociMediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	ociMediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	ociMediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	ociAnnotationRefName      = "org.opencontainers.image.ref.name"
+	containerdAnnotationImage = "io.containerd.image.name"
+
+	containerDefaultTag = "latest"
+)
+
+// The boot files, kernel modules and firmware aren't used by a container, since it runs on the host's kernel.
+var defaultContainerExcludePaths = []string{
+	"/boot",
+	"/usr/lib/modules",
+	"/usr/lib/firmware",
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociImageConfig struct {
+	Created      string             `json:"created"`
+	Architecture string             `json:"architecture"`
+	Os           string             `json:"os"`
+	Config       ociContainerConfig `json:"config"`
+	RootFs       ociRootFs          `json:"rootfs"`
+}
+
+type ociContainerConfig struct {
+	Entrypoint []string          `json:"Entrypoint,omitempty"`
+	Cmd        []string          `json:"Cmd,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+}
+
+type ociRootFs struct {
+	Type    string   `json:"type"`
+	DiffIds []string `json:"diff_ids"`
+}
+
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+// dockerArchiveManifestEntry is an entry of the manifest.json file that 'docker load' reads.
+type dockerArchiveManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags,omitempty"`
+	Layers   []string `json:"Layers"`
+}
+
+// containerLayer is the gzip compressed tarball of the rootfs.
+type containerLayer struct {
+	// The path of the compressed layer.
+	Path string
+	// The sha256 digest of the compressed layer.
+	Digest string
+	Size   int64
+	// The sha256 digest of the uncompressed layer.
+	DiffId string
+}
+
+// createContainerImage creates a single layer container image from the rootfs of the customized image.
+//
+// The 'oci' format is a tarball of an OCI image layout. The 'docker-archive' format additionally includes the
+// manifest.json file that older versions of 'docker load' require (like 'docker save' does).
+func createContainerImage(buildDir string, container *imagecustomizerapi.Container, rawImageFile string,
+	outputImageFile string, outputImageFormat string,
+) error {
+	logger.Log.Infof("Creating container image")
+
+	if container == nil {
+		container = &imagecustomizerapi.Container{}
+	}
+
+	excludePaths := defaultContainerExcludePaths
+	if container.ExcludePaths != nil {
+		excludePaths = *container.ExcludePaths
+	}
+
+	layerTarFile := filepath.Join(buildDir, containerLayerTarFileName)
+	defer os.Remove(layerTarFile)
+
+	err := createContainerLayerTar(buildDir, rawImageFile, layerTarFile, excludePaths)
+	if err != nil {
+		return err
+	}
+
+	layerBlobFile := filepath.Join(buildDir, containerLayerBlobName)
+	defer os.Remove(layerBlobFile)
+
+	layer, err := compressContainerLayer(layerTarFile, layerBlobFile)
+	if err != nil {
+		return err
+	}
+
+	err = writeContainerArchive(outputImageFile, outputImageFormat, container, layer, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to write container image (%s):\n%w", outputImageFile, err)
+	}
+
+	return nil
+}
+
+func createContainerLayerTar(buildDir string, rawImageFile string, layerTarFile string, excludePaths []string) error {
+	imageConnection, err := connectToExistingImage(rawImageFile, buildDir, containerRootfsDirName,
+		false /*includeDefaultMounts*/)
+	if err != nil {
+		return err
+	}
+	defer imageConnection.Close()
+
+	tarArgs := containerLayerTarArgs(imageConnection.Chroot().RootDir(), layerTarFile, excludePaths)
+
+	err = shell.ExecuteLiveWithErr(1, "tar", tarArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to create container layer tarball:\n%w", err)
+	}
+
+	err = imageConnection.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func containerLayerTarArgs(rootDir string, layerTarFile string, excludePaths []string) []string {
+	// Notes:
+	// `--numeric-owner` ensures that the file owners are the image's users, not the host's.
+	// `--xattrs-include` keeps the file capabilities (e.g. for ping) but not the SELinux labels, since these are
+	// assigned by the container runtime.
+	// `--sort=name` makes the layer's contents independent of the file system's directory order.
+	tarArgs := []string{
+		"--create", "--file", layerTarFile, "--directory", rootDir,
+		"--numeric-owner", "--xattrs", "--xattrs-include=security.capability", "--sort=name",
+	}
+
+	for _, excludePath := range excludePaths {
+		// Excluding a directory leaves out the directory itself, as well as its contents.
+		tarArgs = append(tarArgs, "--exclude=."+path.Clean(excludePath))
+	}
+
+	tarArgs = append(tarArgs, ".")
+	return tarArgs
+}
+
+// compressContainerLayer gzips the layer tarball and calculates both its digest and its diff ID.
+func compressContainerLayer(layerTarFile string, layerBlobFile string) (containerLayer, error) {
+	source, err := os.Open(layerTarFile)
+	if err != nil {
+		return containerLayer{}, fmt.Errorf("failed to open container layer tarball:\n%w", err)
+	}
+	defer source.Close()
+
+	destination, err := os.Create(layerBlobFile)
+	if err != nil {
+		return containerLayer{}, fmt.Errorf("failed to create container layer blob:\n%w", err)
+	}
+	defer destination.Close()
+
+	diffIdHash := sha256.New()
+	digestHash := sha256.New()
+	counter := &countingWriter{}
+
+	gzipWriter := gzip.NewWriter(io.MultiWriter(destination, digestHash, counter))
+
+	_, err = io.Copy(io.MultiWriter(gzipWriter, diffIdHash), source)
+	if err != nil {
+		return containerLayer{}, fmt.Errorf("failed to compress container layer:\n%w", err)
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		return containerLayer{}, fmt.Errorf("failed to compress container layer:\n%w", err)
+	}
+
+	err = destination.Close()
+	if err != nil {
+		return containerLayer{}, fmt.Errorf("failed to write container layer blob:\n%w", err)
+	}
+
+	layer := containerLayer{
+		Path:   layerBlobFile,
+		Digest: sha256Digest(digestHash),
+		Size:   counter.count,
+		DiffId: sha256Digest(diffIdHash),
+	}
+	return layer, nil
+}
+
+func writeContainerArchive(outputImageFile string, outputImageFormat string, container *imagecustomizerapi.Container,
+	layer containerLayer, created time.Time,
+) error {
+	imageConfig := ociImageConfig{
+		Created:      created.Format(time.RFC3339),
+		Architecture: runtime.GOARCH,
+		Os:           "linux",
+		Config: ociContainerConfig{
+			Entrypoint: container.Entrypoint,
+			Cmd:        container.Cmd,
+			Labels:     container.Labels,
+		},
+		RootFs: ociRootFs{
+			Type:    "layers",
+			DiffIds: []string{layer.DiffId},
+		},
+	}
+
+	imageConfigJson, err := json.Marshal(imageConfig)
+	if err != nil {
+		return fmt.Errorf("failed to serialize image config:\n%w", err)
+	}
+
+	imageConfigDescriptor := newOciDescriptor(ociMediaTypeConfig, imageConfigJson)
+
+	manifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociMediaTypeManifest,
+		Config:        imageConfigDescriptor,
+		Layers: []ociDescriptor{{
+			MediaType: ociMediaTypeLayer,
+			Digest:    layer.Digest,
+			Size:      layer.Size,
+		}},
+	}
+
+	manifestJson, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to serialize image manifest:\n%w", err)
+	}
+
+	manifestDescriptor := newOciDescriptor(ociMediaTypeManifest, manifestJson)
+	if container.Tag != "" {
+		manifestDescriptor.Annotations = map[string]string{
+			ociAnnotationRefName:      containerTagVersion(container.Tag),
+			containerdAnnotationImage: container.Tag,
+		}
+	}
+
+	index := ociIndex{
+		SchemaVersion: 2,
+		MediaType:     ociMediaTypeIndex,
+		Manifests:     []ociDescriptor{manifestDescriptor},
+	}
+
+	indexJson, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to serialize image index:\n%w", err)
+	}
+
+	layoutJson, err := json.Marshal(ociLayout{ImageLayoutVersion: ociLayoutVersion})
+	if err != nil {
+		return fmt.Errorf("failed to serialize image layout:\n%w", err)
+	}
+
+	outputFile, err := os.Create(outputImageFile)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	archive := containerArchiveWriter{
+		writer:  tar.NewWriter(outputFile),
+		modTime: created,
+	}
+
+	err = archive.writeFile("oci-layout", layoutJson)
+	if err != nil {
+		return err
+	}
+
+	err = archive.writeFile("index.json", indexJson)
+	if err != nil {
+		return err
+	}
+
+	if outputImageFormat == ImageFormatDockerArchive {
+		dockerManifest := []dockerArchiveManifestEntry{{
+			Config: ociBlobPath(imageConfigDescriptor.Digest),
+			Layers: []string{ociBlobPath(layer.Digest)},
+		}}
+		if container.Tag != "" {
+			dockerManifest[0].RepoTags = []string{container.Tag}
+		}
+
+		dockerManifestJson, err := json.Marshal(dockerManifest)
+		if err != nil {
+			return fmt.Errorf("failed to serialize docker manifest:\n%w", err)
+		}
+
+		err = archive.writeFile("manifest.json", dockerManifestJson)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{"blobs", ociBlobsDir} {
+		err = archive.writeDir(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = archive.writeFile(ociBlobPath(imageConfigDescriptor.Digest), imageConfigJson)
+	if err != nil {
+		return err
+	}
+
+	err = archive.writeFile(ociBlobPath(manifestDescriptor.Digest), manifestJson)
+	if err != nil {
+		return err
+	}
+
+	err = archive.copyFile(ociBlobPath(layer.Digest), layer.Path, layer.Size)
+	if err != nil {
+		return err
+	}
+
+	err = archive.writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return outputFile.Close()
+}
+
+// containerTagVersion returns the tag portion (e.g. '1.0') of an image reference (e.g. 'myapp:1.0').
+func containerTagVersion(imageRef string) string {
+	name := imageRef[strings.LastIndex(imageRef, "/")+1:]
+	_, version, found := strings.Cut(name, ":")
+	if !found {
+		return containerDefaultTag
+	}
+	return version
+}
+
+func newOciDescriptor(mediaType string, content []byte) ociDescriptor {
+	sum := sha256.Sum256(content)
+	return ociDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+		Size:      int64(len(content)),
+	}
+}
+
+func ociBlobPath(digest string) string {
+	return path.Join(ociBlobsDir, strings.TrimPrefix(digest, "sha256:"))
+}
+
+func sha256Digest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+type countingWriter struct {
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += int64(len(p))
+	return len(p), nil
+}
+
+type containerArchiveWriter struct {
+	writer  *tar.Writer
+	modTime time.Time
+}
+
+func (a *containerArchiveWriter) writeDir(name string) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0o755,
+		ModTime:  a.modTime,
+	}
+
+	err := a.writer.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to add (%s) to container archive:\n%w", name, err)
+	}
+
+	return nil
+}
+
+func (a *containerArchiveWriter) writeFile(name string, content []byte) error {
+	err := a.writeFileHeader(name, int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	_, err = a.writer.Write(content)
+	if err != nil {
+		return fmt.Errorf("failed to add (%s) to container archive:\n%w", name, err)
+	}
+
+	return nil
+}
+
+func (a *containerArchiveWriter) copyFile(name string, sourceFile string, size int64) error {
+	source, err := os.Open(sourceFile)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	err = a.writeFileHeader(name, size)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(a.writer, source)
+	if err != nil {
+		return fmt.Errorf("failed to add (%s) to container archive:\n%w", name, err)
+	}
+
+	return nil
+}
+
+func (a *containerArchiveWriter) writeFileHeader(name string, size int64) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  a.modTime,
+	}
+
+	err := a.writer.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to add (%s) to container archive:\n%w", name, err)
+	}
+
+	return nil
+}
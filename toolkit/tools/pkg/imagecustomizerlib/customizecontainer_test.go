@@ -0,0 +1,210 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerLayerTarArgs(t *testing.T) {
+	tarArgs := containerLayerTarArgs("/build/rootfs", "/build/layer.tar", []string{"/boot", "/var/cache/tdnf/"})
+	assert.Equal(t, []string{
+		"--create", "--file", "/build/layer.tar", "--directory", "/build/rootfs",
+		"--numeric-owner", "--xattrs", "--xattrs-include=security.capability", "--sort=name",
+		"--exclude=./boot", "--exclude=./var/cache/tdnf", ".",
+	}, tarArgs)
+}
+
+func TestContainerTagVersion(t *testing.T) {
+	assert.Equal(t, "latest", containerTagVersion("myapp"))
+	assert.Equal(t, "1.0", containerTagVersion("myapp:1.0"))
+	assert.Equal(t, "latest", containerTagVersion("localhost:5000/myapp"))
+	assert.Equal(t, "1.0", containerTagVersion("localhost:5000/team/myapp:1.0"))
+}
+
+func TestCompressContainerLayer(t *testing.T) {
+	testTempDir := t.TempDir()
+	layerTarFile := filepath.Join(testTempDir, "layer.tar")
+	layerBlobFile := filepath.Join(testTempDir, "layer.tar.gz")
+
+	layerTar := []byte("not really a tarball")
+	err := os.WriteFile(layerTarFile, layerTar, 0o644)
+	assert.NoError(t, err)
+
+	layer, err := compressContainerLayer(layerTarFile, layerBlobFile)
+	assert.NoError(t, err)
+	assert.Equal(t, layerBlobFile, layer.Path)
+	assert.Equal(t, testSha256Digest(layerTar), layer.DiffId)
+
+	layerBlob, err := os.ReadFile(layerBlobFile)
+	assert.NoError(t, err)
+	assert.Equal(t, testSha256Digest(layerBlob), layer.Digest)
+	assert.Equal(t, int64(len(layerBlob)), layer.Size)
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(layerBlob))
+	assert.NoError(t, err)
+
+	uncompressed, err := io.ReadAll(gzipReader)
+	assert.NoError(t, err)
+	assert.Equal(t, layerTar, uncompressed)
+}
+
+func TestWriteContainerArchiveOci(t *testing.T) {
+	testTempDir := t.TempDir()
+	outputImageFile := filepath.Join(testTempDir, "image.tar")
+
+	layer := writeTestContainerLayer(t, testTempDir)
+	container := &imagecustomizerapi.Container{
+		Tag:        "myregistry.azurecr.io/myapp:1.0",
+		Labels:     map[string]string{"org.opencontainers.image.title": "myapp"},
+		Entrypoint: []string{"/usr/bin/myapp"},
+		Cmd:        []string{"--verbose"},
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := writeContainerArchive(outputImageFile, ImageFormatOci, container, layer, created)
+	assert.NoError(t, err)
+
+	files := readTestContainerArchive(t, outputImageFile)
+	assert.NotContains(t, files, "manifest.json")
+	assert.JSONEq(t, `{"imageLayoutVersion":"1.0.0"}`, string(files["oci-layout"]))
+
+	var index ociIndex
+	err = json.Unmarshal(files["index.json"], &index)
+	assert.NoError(t, err)
+	if !assert.Len(t, index.Manifests, 1) {
+		return
+	}
+
+	manifestDescriptor := index.Manifests[0]
+	assert.Equal(t, ociMediaTypeManifest, manifestDescriptor.MediaType)
+	assert.Equal(t, map[string]string{
+		"org.opencontainers.image.ref.name": "1.0",
+		"io.containerd.image.name":          "myregistry.azurecr.io/myapp:1.0",
+	}, manifestDescriptor.Annotations)
+
+	// Every blob is stored under its digest.
+	for name, content := range files {
+		if filepath.Dir(name) == ociBlobsDir {
+			assert.Equal(t, "sha256:"+filepath.Base(name), testSha256Digest(content))
+		}
+	}
+
+	var manifest ociManifest
+	err = json.Unmarshal(files[ociBlobPath(manifestDescriptor.Digest)], &manifest)
+	assert.NoError(t, err)
+	assert.Equal(t, []ociDescriptor{{MediaType: ociMediaTypeLayer, Digest: layer.Digest, Size: layer.Size}},
+		manifest.Layers)
+	assert.Contains(t, files, ociBlobPath(layer.Digest))
+
+	var imageConfig ociImageConfig
+	err = json.Unmarshal(files[ociBlobPath(manifest.Config.Digest)], &imageConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, ociImageConfig{
+		Created:      "2024-01-02T03:04:05Z",
+		Architecture: runtime.GOARCH,
+		Os:           "linux",
+		Config: ociContainerConfig{
+			Entrypoint: []string{"/usr/bin/myapp"},
+			Cmd:        []string{"--verbose"},
+			Labels:     map[string]string{"org.opencontainers.image.title": "myapp"},
+		},
+		RootFs: ociRootFs{
+			Type:    "layers",
+			DiffIds: []string{layer.DiffId},
+		},
+	}, imageConfig)
+}
+
+func TestWriteContainerArchiveDocker(t *testing.T) {
+	testTempDir := t.TempDir()
+	outputImageFile := filepath.Join(testTempDir, "image.tar")
+
+	layer := writeTestContainerLayer(t, testTempDir)
+	container := &imagecustomizerapi.Container{
+		Tag: "myapp:1.0",
+	}
+
+	err := writeContainerArchive(outputImageFile, ImageFormatDockerArchive, container, layer, time.Now().UTC())
+	assert.NoError(t, err)
+
+	files := readTestContainerArchive(t, outputImageFile)
+
+	var dockerManifest []dockerArchiveManifestEntry
+	err = json.Unmarshal(files["manifest.json"], &dockerManifest)
+	assert.NoError(t, err)
+	if !assert.Len(t, dockerManifest, 1) {
+		return
+	}
+
+	assert.Equal(t, []string{"myapp:1.0"}, dockerManifest[0].RepoTags)
+	assert.Equal(t, []string{ociBlobPath(layer.Digest)}, dockerManifest[0].Layers)
+	assert.Contains(t, files, dockerManifest[0].Config)
+}
+
+func TestCreateImageCustomizerParametersContainerEncryption(t *testing.T) {
+	config := &imagecustomizerapi.Config{
+		Storage: imagecustomizerapi.Storage{
+			Encryption: []imagecustomizerapi.Encryption{{}},
+		},
+	}
+
+	_, err := createImageCustomizerParameters("/build", "/base.vhdx", testDir, config, false, nil, false, "",
+		ImageFormatOci, "/out/image.tar", "")
+	assert.ErrorContains(t, err, "generating a container image is not supported when 'encryption' is specified")
+}
+
+func writeTestContainerLayer(t *testing.T, dir string) containerLayer {
+	layerTarFile := filepath.Join(dir, "layer.tar")
+	err := os.WriteFile(layerTarFile, []byte("layer"), 0o644)
+	assert.NoError(t, err)
+
+	layer, err := compressContainerLayer(layerTarFile, filepath.Join(dir, "layer.tar.gz"))
+	assert.NoError(t, err)
+	return layer
+}
+
+func readTestContainerArchive(t *testing.T, archiveFile string) map[string][]byte {
+	archive, err := os.Open(archiveFile)
+	assert.NoError(t, err)
+	defer archive.Close()
+
+	files := make(map[string][]byte)
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			content, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			files[header.Name] = content
+		}
+	}
+	return files
+}
+
+func testSha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,380 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/configuration"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/diskutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safeloopback"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safemount"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+)
+
+const (
+	cryptTabPath = "/etc/crypttab"
+
+	// The directory that systemd-cryptsetup searches for key files.
+	cryptsetupKeysDir = "/etc/cryptsetup-keys.d"
+
+	encryptionStagingDirName = "encryption-staging"
+)
+
+// createLuksUuids creates the UUIDs of the LUKS headers of the encrypted devices, keyed by the encrypted device's ID.
+// The UUIDs are created ahead of time so that /etc/crypttab and the kernel command-line can reference the encrypted
+// devices before they are formatted.
+func createLuksUuids(encryption []imagecustomizerapi.Encryption) map[string]string {
+	luksUuids := make(map[string]string)
+	for _, encryption := range encryption {
+		luksUuids[encryption.Id] = uuid.NewString()
+	}
+
+	return luksUuids
+}
+
+func enableEncryptedPartitions(baseConfigPath string, encryption []imagecustomizerapi.Encryption,
+	luksUuids map[string]string, imageChroot *safechroot.Chroot,
+) (bool, error) {
+	var err error
+
+	if len(encryption) <= 0 {
+		return false, nil
+	}
+
+	logger.Log.Infof("Enable encryption")
+
+	err = validateEncryptionDependencies(imageChroot)
+	if err != nil {
+		return false, fmt.Errorf("failed to validate package dependencies for encryption:\n%w", err)
+	}
+
+	// Integrate the cryptsetup dracut module into initramfs img.
+	err = addDracutModuleAndDriver("crypt", "dm_crypt", imageChroot)
+	if err != nil {
+		return false, fmt.Errorf("failed to add dracut modules for encryption:\n%w", err)
+	}
+
+	cryptTabLines := []string(nil)
+	for _, encryption := range encryption {
+		luksUuid := luksUuids[encryption.Id]
+
+		keyFile, err := installEncryptionKeyFile(baseConfigPath, encryption, imageChroot)
+		if err != nil {
+			return false, err
+		}
+
+		if encryption.Unlock == imagecustomizerapi.EncryptionUnlockTypeTpm2 {
+			// The TPM that the key is sealed to is only available on the target machine.
+			logger.Log.Warnf("Encrypted device (%s) must be enrolled with the TPM on the target machine "+
+				"(e.g. using systemd-cryptenroll)", encryption.Name)
+		}
+
+		cryptTabLines = append(cryptTabLines, cryptTabEntry(encryption, luksUuid, keyFile))
+
+		if isRootEncryption(encryption) {
+			err = prepareGrubConfigForEncryption(encryption, luksUuid, imageChroot)
+			if err != nil {
+				return false, fmt.Errorf("failed to prepare grub config files for encryption:\n%w", err)
+			}
+		}
+	}
+
+	err = file.Append(strings.Join(cryptTabLines, "\n")+"\n", filepath.Join(imageChroot.RootDir(), cryptTabPath))
+	if err != nil {
+		return false, fmt.Errorf("failed to write (%s):\n%w", cryptTabPath, err)
+	}
+
+	err = updateFstabForEncryption(encryption, imageChroot)
+	if err != nil {
+		return false, fmt.Errorf("failed to update fstab file for encryption:\n%w", err)
+	}
+
+	return true, nil
+}
+
+// installEncryptionKeyFile copies the key file into the image, if the device is unlocked using a key file. The path of
+// the key file within the image is returned.
+func installEncryptionKeyFile(baseConfigPath string, encryption imagecustomizerapi.Encryption,
+	imageChroot *safechroot.Chroot,
+) (string, error) {
+	if encryption.Unlock != imagecustomizerapi.EncryptionUnlockTypeKeyFile {
+		return "", nil
+	}
+
+	keyFile := filepath.Join(cryptsetupKeysDir, encryption.Name+".key")
+
+	err := file.NewFileCopyBuilder(file.GetAbsPathWithBase(baseConfigPath, encryption.KeyFile),
+		filepath.Join(imageChroot.RootDir(), keyFile)).
+		SetDirFileMode(0o700).
+		SetFileMode(0o400).
+		Run()
+	if err != nil {
+		return "", fmt.Errorf("failed to copy key file for encrypted device (%s):\n%w", encryption.Name, err)
+	}
+
+	// Note: Key files are never added to the initramfs, since it is stored unencrypted. So, key file unlocking is
+	// limited to devices that are unlocked after the (encrypted) root filesystem is mounted. This is verified in the
+	// API validity checks.
+	return keyFile, nil
+}
+
+// cryptTabEntry returns the /etc/crypttab line for an encrypted device.
+func cryptTabEntry(encryption imagecustomizerapi.Encryption, luksUuid string, keyFile string) string {
+	if keyFile == "" {
+		keyFile = "none"
+	}
+
+	options := "luks"
+	if encryption.Unlock == imagecustomizerapi.EncryptionUnlockTypeTpm2 {
+		options += ",tpm2-device=auto"
+	}
+
+	return fmt.Sprintf("%s UUID=%s %s %s", encryption.Name, luksUuid, keyFile, options)
+}
+
+func updateFstabForEncryption(encryptionList []imagecustomizerapi.Encryption, imageChroot *safechroot.Chroot,
+) error {
+	var err error
+
+	fstabFile := filepath.Join(imageChroot.RootDir(), "etc", "fstab")
+	fstabEntries, err := diskutils.ReadFstabFile(fstabFile)
+	if err != nil {
+		return fmt.Errorf("failed to read fstab file:\n%w", err)
+	}
+
+	// Update fstab entries so that encrypted mounts point to the unlocked device paths.
+	for _, encryption := range encryptionList {
+		if encryption.FileSystem == nil || encryption.FileSystem.MountPoint == nil {
+			// No mount point assigned to encrypted device.
+			continue
+		}
+
+		mountPath := encryption.FileSystem.MountPoint.Path
+
+		for j := range fstabEntries {
+			entry := &fstabEntries[j]
+			if entry.Target == mountPath {
+				entry.Source = encryptionDevicePath(encryption)
+			}
+		}
+	}
+
+	err = diskutils.WriteFstabFile(fstabEntries, fstabFile)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func prepareGrubConfigForEncryption(rootEncryption imagecustomizerapi.Encryption, luksUuid string,
+	imageChroot *safechroot.Chroot,
+) error {
+	bootCustomizer, err := NewBootCustomizer(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	err = bootCustomizer.PrepareForEncryptedRoot(encryptionDevicePath(rootEncryption))
+	if err != nil {
+		return err
+	}
+
+	err = bootCustomizer.UpdateKernelCommandLineArgs(defaultGrubFileVarNameCmdlineLinux,
+		[]string{"rd.luks.name", "rd.luks.key", "rd.luks.options"},
+		encryptionKernelCommandLineArgs(rootEncryption, luksUuid))
+	if err != nil {
+		return err
+	}
+
+	err = bootCustomizer.WriteToFile(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// encryptionKernelCommandLineArgs returns the kernel command-line args that tell the initramfs how to unlock the
+// encrypted root device.
+func encryptionKernelCommandLineArgs(rootEncryption imagecustomizerapi.Encryption, luksUuid string) []string {
+	args := []string{
+		fmt.Sprintf("rd.luks.name=%s=%s", luksUuid, rootEncryption.Name),
+	}
+
+	if rootEncryption.Unlock == imagecustomizerapi.EncryptionUnlockTypeTpm2 {
+		args = append(args, fmt.Sprintf("rd.luks.options=%s=tpm2-device=auto", luksUuid))
+	}
+
+	return args
+}
+
+func isRootEncryption(encryption imagecustomizerapi.Encryption) bool {
+	return encryption.FileSystem != nil && encryption.FileSystem.MountPoint != nil &&
+		encryption.FileSystem.MountPoint.Path == "/"
+}
+
+func encryptionDevicePath(encryption imagecustomizerapi.Encryption) string {
+	return imagecustomizerapi.DeviceMapperPath + "/" + encryption.Name
+}
+
+func customizeEncryptionImageHelper(buildDir string, baseConfigPath string,
+	encryption []imagecustomizerapi.Encryption, luksUuids map[string]string, buildImageFile string,
+	partIdToPartUuid map[string]string,
+) error {
+	loopback, err := safeloopback.NewLoopback(buildImageFile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to image file to provision encryption:\n%w", err)
+	}
+	defer loopback.Close()
+
+	diskPartitions, err := diskutils.GetDiskPartitions(loopback.DevicePath())
+	if err != nil {
+		return err
+	}
+
+	for _, encryption := range encryption {
+		partitionPath, err := idToPartitionBlockDevicePath(encryption.DeviceId, diskPartitions, partIdToPartUuid)
+		if err != nil {
+			return err
+		}
+
+		err = encryptPartition(buildDir, file.GetAbsPathWithBase(baseConfigPath, encryption.KeyFile), encryption,
+			luksUuids[encryption.Id], partitionPath)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt partition (%s):\n%w", encryption.DeviceId, err)
+		}
+	}
+
+	err = loopback.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// encryptPartition replaces the contents of a partition with a LUKS device that contains the same files.
+func encryptPartition(buildDir string, keyFile string, encryption imagecustomizerapi.Encryption, luksUuid string,
+	partitionPath string,
+) error {
+	logger.Log.Infof("Encrypting partition (%s)", partitionPath)
+
+	fileSystemType := string(encryption.FileSystem.Type)
+	partitionMountDir := filepath.Join(buildDir, tmpParitionDirName)
+	stagingDir := filepath.Join(buildDir, encryptionStagingDirName)
+
+	err := os.MkdirAll(stagingDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory:\n%w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	// Save the partition's files, since formatting the LUKS device erases them.
+	err = copyFilesFromDevice(partitionPath, fileSystemType, partitionMountDir, stagingDir)
+	if err != nil {
+		return err
+	}
+
+	err = shell.ExecuteLive(true /*squashErrors*/, "cryptsetup", luksFormatArgs(encryption, luksUuid, keyFile,
+		partitionPath)...)
+	if err != nil {
+		return fmt.Errorf("failed to format LUKS device:\n%w", err)
+	}
+
+	mapperName := "luks-" + luksUuid
+	err = shell.ExecuteLive(true /*squashErrors*/, "cryptsetup", "open", "--type", "luks2", "--key-file", keyFile,
+		partitionPath, mapperName)
+	if err != nil {
+		return fmt.Errorf("failed to open LUKS device:\n%w", err)
+	}
+
+	err = populateEncryptedDevice(imagecustomizerapi.DeviceMapperPath+"/"+mapperName, fileSystemType,
+		partitionMountDir, stagingDir)
+
+	closeErr := shell.ExecuteLive(true /*squashErrors*/, "cryptsetup", "close", mapperName)
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close LUKS device:\n%w", closeErr)
+	}
+
+	return nil
+}
+
+// luksFormatArgs returns the cryptsetup args that format a partition as a LUKS device.
+func luksFormatArgs(encryption imagecustomizerapi.Encryption, luksUuid string, keyFile string, partitionPath string,
+) []string {
+	return []string{"luksFormat", "--batch-mode", "--type", "luks2", "--cipher", encryption.GetCipher(),
+		"--uuid", luksUuid, "--key-file", keyFile, partitionPath}
+}
+
+func copyFilesFromDevice(devicePath string, fileSystemType string, mountDir string, targetDir string) error {
+	mount, err := safemount.NewMount(devicePath, mountDir, fileSystemType, 0, "", true)
+	if err != nil {
+		return fmt.Errorf("failed to mount partition (%s):\n%w", devicePath, err)
+	}
+	defer mount.Close()
+
+	err = copyPartitionFiles(mountDir+"/.", targetDir)
+	if err != nil {
+		return fmt.Errorf("failed to copy files from partition (%s):\n%w", devicePath, err)
+	}
+
+	err = mount.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func populateEncryptedDevice(devicePath string, fileSystemType string, mountDir string, sourceDir string) error {
+	_, err := diskutils.FormatSinglePartition(devicePath, configuration.Partition{FsType: fileSystemType})
+	if err != nil {
+		return fmt.Errorf("failed to format encrypted device (%s):\n%w", devicePath, err)
+	}
+
+	mount, err := safemount.NewMount(devicePath, mountDir, fileSystemType, 0, "", true)
+	if err != nil {
+		return fmt.Errorf("failed to mount encrypted device (%s):\n%w", devicePath, err)
+	}
+	defer mount.Close()
+
+	err = copyPartitionFiles(sourceDir+"/.", mountDir)
+	if err != nil {
+		return fmt.Errorf("failed to copy files to encrypted device (%s):\n%w", devicePath, err)
+	}
+
+	err = mount.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateEncryptionDependencies(imageChroot *safechroot.Chroot) error {
+	requiredRpms := []string{"cryptsetup"}
+
+	for _, pkg := range requiredRpms {
+		logger.Log.Debugf("Checking if package (%s) is installed", pkg)
+		if !isPackageInstalled(imageChroot, pkg) {
+			return fmt.Errorf("package (%s) is not installed:\nthe following packages must be installed to use "+
+				"encryption: %v", pkg, requiredRpms)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+const testLuksUuid = "0b6e9f1a-4d7c-4a51-9a0e-2f6d7c1b3e58"
+
+func newTestRootEncryption(unlock imagecustomizerapi.EncryptionUnlockType) imagecustomizerapi.Encryption {
+	return imagecustomizerapi.Encryption{
+		Id:       "rootencrypted",
+		Name:     "luks-root",
+		DeviceId: "root",
+		KeyFile:  "files/root.key",
+		Unlock:   unlock,
+		FileSystem: &imagecustomizerapi.FileSystem{
+			DeviceId: "rootencrypted",
+			Type:     imagecustomizerapi.FileSystemTypeExt4,
+			MountPoint: &imagecustomizerapi.MountPoint{
+				Path: "/",
+			},
+		},
+	}
+}
+
+func TestCryptTabEntry(t *testing.T) {
+	encryption := newTestRootEncryption(imagecustomizerapi.EncryptionUnlockTypeDefault)
+	assert.Equal(t, "luks-root UUID="+testLuksUuid+" none luks", cryptTabEntry(encryption, testLuksUuid, ""))
+
+	encryption = newTestRootEncryption(imagecustomizerapi.EncryptionUnlockTypeKeyFile)
+	assert.Equal(t, "luks-root UUID="+testLuksUuid+" /etc/cryptsetup-keys.d/luks-root.key luks",
+		cryptTabEntry(encryption, testLuksUuid, "/etc/cryptsetup-keys.d/luks-root.key"))
+
+	encryption = newTestRootEncryption(imagecustomizerapi.EncryptionUnlockTypeTpm2)
+	assert.Equal(t, "luks-root UUID="+testLuksUuid+" none luks,tpm2-device=auto",
+		cryptTabEntry(encryption, testLuksUuid, ""))
+}
+
+func TestEncryptionKernelCommandLineArgs(t *testing.T) {
+	encryption := newTestRootEncryption(imagecustomizerapi.EncryptionUnlockTypePassphrase)
+	assert.Equal(t, []string{"rd.luks.name=" + testLuksUuid + "=luks-root"},
+		encryptionKernelCommandLineArgs(encryption, testLuksUuid))
+
+	encryption = newTestRootEncryption(imagecustomizerapi.EncryptionUnlockTypeTpm2)
+	assert.Equal(t, []string{
+		"rd.luks.name=" + testLuksUuid + "=luks-root",
+		"rd.luks.options=" + testLuksUuid + "=tpm2-device=auto",
+	}, encryptionKernelCommandLineArgs(encryption, testLuksUuid))
+}
+
+func TestLuksFormatArgs(t *testing.T) {
+	encryption := newTestRootEncryption(imagecustomizerapi.EncryptionUnlockTypeDefault)
+
+	args := luksFormatArgs(encryption, testLuksUuid, "/config/files/root.key", "/dev/loop0p3")
+	assert.Equal(t, []string{
+		"luksFormat", "--batch-mode", "--type", "luks2", "--cipher", "aes-xts-plain64", "--uuid", testLuksUuid,
+		"--key-file", "/config/files/root.key", "/dev/loop0p3",
+	}, args)
+}
+
+func TestUpdateFstabForEncryption(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/etc/fstab",
+		"PARTUUID=1111 /boot ext4 defaults 0 2\n"+
+			"PARTUUID=2222 / ext4 defaults 0 1\n")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+	encryption := newTestRootEncryption(imagecustomizerapi.EncryptionUnlockTypeDefault)
+
+	err := updateFstabForEncryption([]imagecustomizerapi.Encryption{encryption}, imageChroot)
+	assert.NoError(t, err)
+
+	fstabContents, err := file.Read(filepath.Join(rootDir, "etc/fstab"))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"PARTUUID=1111 /boot ext4 defaults 0 2\n"+
+			"/dev/mapper/luks-root / ext4 defaults 0 1\n",
+		fstabContents)
+}
+
+func TestValidateStorageConfigMissingKeyFile(t *testing.T) {
+	baseConfigPath := t.TempDir()
+	storage := imagecustomizerapi.Storage{
+		Encryption: []imagecustomizerapi.Encryption{
+			newTestRootEncryption(imagecustomizerapi.EncryptionUnlockTypeDefault),
+		},
+	}
+
+	err := validateStorageConfig(baseConfigPath, &storage)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorContains(t, err, "invalid encryption item at index 0")
+	assert.ErrorContains(t, err, "invalid keyFile (files/root.key)")
+
+	createTestImageFile(t, baseConfigPath, "files/root.key", "password")
+
+	err = validateStorageConfig(baseConfigPath, &storage)
+	assert.NoError(t, err)
+}
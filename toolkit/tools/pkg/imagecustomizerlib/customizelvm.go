@@ -0,0 +1,264 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/configuration"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/diskutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/sliceutils"
+)
+
+const (
+	lvmPhysicalVolumeFsType = "LVM2_member"
+)
+
+// createVolumeGroups creates the volume groups and logical volumes on the physical volume partitions and formats
+// the logical volumes. The device path and file system type of each logical volume are returned, keyed by the logical
+// volume's ID.
+func createVolumeGroups(volumeGroups []imagecustomizerapi.VolumeGroup,
+	fileSystems []imagecustomizerapi.FileSystem, partIDToDevPathMap map[string]string,
+) (map[string]string, map[string]string, error) {
+	lvIdToDevPathMap := make(map[string]string)
+	lvIdToFsTypeMap := make(map[string]string)
+
+	for _, volumeGroup := range volumeGroups {
+		logger.Log.Infof("Creating volume group (%s)", volumeGroup.Name)
+
+		physicalVolumePaths := []string(nil)
+		for _, physicalVolume := range volumeGroup.PhysicalVolumes {
+			devPath, found := partIDToDevPathMap[physicalVolume]
+			if !found {
+				return nil, nil, fmt.Errorf("failed to find partition (%s) for volume group (%s)", physicalVolume,
+					volumeGroup.Name)
+			}
+
+			err := shell.ExecuteLive(true /*squashErrors*/, "pvcreate", "-qy", devPath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create physical volume (%s):\n%w", devPath, err)
+			}
+
+			physicalVolumePaths = append(physicalVolumePaths, devPath)
+		}
+
+		vgcreateArgs := append([]string{"-qy", volumeGroup.Name}, physicalVolumePaths...)
+		err := shell.ExecuteLive(true /*squashErrors*/, "vgcreate", vgcreateArgs...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create volume group (%s):\n%w", volumeGroup.Name, err)
+		}
+
+		for _, logicalVolume := range volumeGroup.LogicalVolumes {
+			err := shell.ExecuteLive(true /*squashErrors*/, "lvcreate", lvcreateArgs(volumeGroup.Name,
+				logicalVolume)...)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create logical volume (%s/%s):\n%w", volumeGroup.Name,
+					logicalVolume.Name, err)
+			}
+
+			devPath := logicalVolumeDevicePath(volumeGroup.Name, logicalVolume.Name)
+
+			fileSystem, _ := sliceutils.FindValueFunc(fileSystems,
+				func(fileSystem imagecustomizerapi.FileSystem) bool {
+					return fileSystem.DeviceId == logicalVolume.Id
+				},
+			)
+
+			fsType := string(fileSystem.Type)
+			fsType, err = diskutils.FormatSinglePartition(devPath, configuration.Partition{FsType: fsType})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to format logical volume (%s/%s):\n%w", volumeGroup.Name,
+					logicalVolume.Name, err)
+			}
+
+			lvIdToDevPathMap[logicalVolume.Id] = devPath
+			lvIdToFsTypeMap[logicalVolume.Id] = fsType
+		}
+	}
+
+	return lvIdToDevPathMap, lvIdToFsTypeMap, nil
+}
+
+// lvcreateArgs returns the lvcreate args that create a logical volume.
+func lvcreateArgs(volumeGroupName string, logicalVolume imagecustomizerapi.LogicalVolume) []string {
+	args := []string{"-qy", "--wipesignatures", "y"}
+	if logicalVolume.Size != nil {
+		args = append(args, "--size", fmt.Sprintf("%db", *logicalVolume.Size))
+	} else {
+		args = append(args, "--extents", "100%FREE")
+	}
+
+	args = append(args, "--name", logicalVolume.Name, volumeGroupName)
+	return args
+}
+
+// logicalVolumeDevicePath returns the device-mapper path of a logical volume.
+// Device-mapper escapes dashes within the volume group and logical volume names by doubling them.
+func logicalVolumeDevicePath(volumeGroupName string, logicalVolumeName string) string {
+	return fmt.Sprintf("%s/%s-%s", imagecustomizerapi.DeviceMapperPath, strings.ReplaceAll(volumeGroupName, "-", "--"),
+		strings.ReplaceAll(logicalVolumeName, "-", "--"))
+}
+
+// activateVolumeGroups activates the volume groups that have physical volumes on the disk. The names of the volume
+// groups are returned.
+func activateVolumeGroups(diskDevPath string) ([]string, error) {
+	diskPartitions, err := diskutils.GetDiskPartitions(diskDevPath)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeGroupNames := []string(nil)
+	for _, diskPartition := range diskPartitions {
+		if diskPartition.FileSystemType != lvmPhysicalVolumeFsType {
+			continue
+		}
+
+		stdout, _, err := shell.Execute("pvs", "--noheadings", "--options", "vg_name", diskPartition.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read volume group of physical volume (%s):\n%w", diskPartition.Path,
+				err)
+		}
+
+		volumeGroupName := strings.TrimSpace(stdout)
+		if volumeGroupName == "" || sliceutils.ContainsValue(volumeGroupNames, volumeGroupName) {
+			continue
+		}
+
+		volumeGroupNames = append(volumeGroupNames, volumeGroupName)
+	}
+
+	if len(volumeGroupNames) <= 0 {
+		return nil, nil
+	}
+
+	logger.Log.Debugf("Activating volume groups (%s)", strings.Join(volumeGroupNames, ", "))
+
+	vgchangeArgs := append([]string{"--activate", "y"}, volumeGroupNames...)
+	err = shell.ExecuteLive(true /*squashErrors*/, "vgchange", vgchangeArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to activate volume groups (%s):\n%w", strings.Join(volumeGroupNames, ", "), err)
+	}
+
+	err = diskutils.WaitForDevicesToSettle()
+	if err != nil {
+		return nil, err
+	}
+
+	return volumeGroupNames, nil
+}
+
+// deactivateVolumeGroups deactivates the volume groups, so that the disk's loopback device can be detached.
+func deactivateVolumeGroups(volumeGroupNames []string) error {
+	if len(volumeGroupNames) <= 0 {
+		return nil
+	}
+
+	vgchangeArgs := append([]string{"--activate", "n"}, volumeGroupNames...)
+	err := shell.ExecuteLive(true /*squashErrors*/, "vgchange", vgchangeArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate volume groups (%s):\n%w", strings.Join(volumeGroupNames, ", "), err)
+	}
+
+	return nil
+}
+
+func enableLvm(volumeGroups []imagecustomizerapi.VolumeGroup, fileSystems []imagecustomizerapi.FileSystem,
+	imageChroot *safechroot.Chroot,
+) (bool, error) {
+	var err error
+
+	if len(volumeGroups) <= 0 {
+		return false, nil
+	}
+
+	logger.Log.Infof("Enable LVM")
+
+	err = validateLvmDependencies(imageChroot)
+	if err != nil {
+		return false, fmt.Errorf("failed to validate package dependencies for LVM:\n%w", err)
+	}
+
+	// Integrate the lvm dracut module into initramfs img.
+	err = addDracutModuleAndDriver("lvm", "dm_mod", imageChroot)
+	if err != nil {
+		return false, fmt.Errorf("failed to add dracut modules for LVM:\n%w", err)
+	}
+
+	rootVolumeGroup, rootLogicalVolume, hasRootLogicalVolume := findRootLogicalVolume(volumeGroups, fileSystems)
+	if hasRootLogicalVolume {
+		err = prepareGrubConfigForLvm(rootVolumeGroup, rootLogicalVolume, imageChroot)
+		if err != nil {
+			return false, fmt.Errorf("failed to prepare grub config files for LVM:\n%w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// findRootLogicalVolume returns the logical volume that contains the root filesystem, if there is one.
+func findRootLogicalVolume(volumeGroups []imagecustomizerapi.VolumeGroup,
+	fileSystems []imagecustomizerapi.FileSystem,
+) (imagecustomizerapi.VolumeGroup, imagecustomizerapi.LogicalVolume, bool) {
+	for _, fileSystem := range fileSystems {
+		if fileSystem.MountPoint == nil || fileSystem.MountPoint.Path != "/" {
+			continue
+		}
+
+		for _, volumeGroup := range volumeGroups {
+			for _, logicalVolume := range volumeGroup.LogicalVolumes {
+				if logicalVolume.Id == fileSystem.DeviceId {
+					return volumeGroup, logicalVolume, true
+				}
+			}
+		}
+	}
+
+	return imagecustomizerapi.VolumeGroup{}, imagecustomizerapi.LogicalVolume{}, false
+}
+
+func prepareGrubConfigForLvm(rootVolumeGroup imagecustomizerapi.VolumeGroup,
+	rootLogicalVolume imagecustomizerapi.LogicalVolume, imageChroot *safechroot.Chroot,
+) error {
+	bootCustomizer, err := NewBootCustomizer(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	// Tell the initramfs which logical volume to activate for the root filesystem.
+	err = bootCustomizer.UpdateKernelCommandLineArgs(defaultGrubFileVarNameCmdlineLinux, []string{"rd.lvm.lv"},
+		[]string{lvmKernelCommandLineArg(rootVolumeGroup.Name, rootLogicalVolume.Name)})
+	if err != nil {
+		return err
+	}
+
+	err = bootCustomizer.WriteToFile(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func lvmKernelCommandLineArg(volumeGroupName string, logicalVolumeName string) string {
+	return fmt.Sprintf("rd.lvm.lv=%s/%s", volumeGroupName, logicalVolumeName)
+}
+
+func validateLvmDependencies(imageChroot *safechroot.Chroot) error {
+	requiredRpms := []string{"lvm2"}
+
+	for _, pkg := range requiredRpms {
+		logger.Log.Debugf("Checking if package (%s) is installed", pkg)
+		if !isPackageInstalled(imageChroot, pkg) {
+			return fmt.Errorf("package (%s) is not installed:\nthe following packages must be installed to use "+
+				"LVM: %v", pkg, requiredRpms)
+		}
+	}
+
+	return nil
+}
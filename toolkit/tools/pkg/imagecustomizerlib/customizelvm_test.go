@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/diskutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/ptrutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVolumeGroup() imagecustomizerapi.VolumeGroup {
+	return imagecustomizerapi.VolumeGroup{
+		Name:            "vg0",
+		PhysicalVolumes: []string{"pv"},
+		LogicalVolumes: []imagecustomizerapi.LogicalVolume{
+			{
+				Id:   "rootlv",
+				Name: "root",
+				Size: ptrutils.PtrTo(imagecustomizerapi.DiskSize(2 * diskutils.GiB)),
+			},
+			{
+				Id:   "varlv",
+				Name: "var-data",
+			},
+		},
+	}
+}
+
+func TestLvcreateArgs(t *testing.T) {
+	volumeGroup := newTestVolumeGroup()
+
+	assert.Equal(t, []string{"-qy", "--wipesignatures", "y", "--size", "2147483648b", "--name", "root", "vg0"},
+		lvcreateArgs(volumeGroup.Name, volumeGroup.LogicalVolumes[0]))
+	assert.Equal(t, []string{"-qy", "--wipesignatures", "y", "--extents", "100%FREE", "--name", "var-data", "vg0"},
+		lvcreateArgs(volumeGroup.Name, volumeGroup.LogicalVolumes[1]))
+}
+
+func TestLogicalVolumeDevicePath(t *testing.T) {
+	assert.Equal(t, "/dev/mapper/vg0-root", logicalVolumeDevicePath("vg0", "root"))
+	assert.Equal(t, "/dev/mapper/vg0-var--data", logicalVolumeDevicePath("vg0", "var-data"))
+	assert.Equal(t, "/dev/mapper/os--vg-root", logicalVolumeDevicePath("os-vg", "root"))
+}
+
+func TestFindRootLogicalVolume(t *testing.T) {
+	volumeGroups := []imagecustomizerapi.VolumeGroup{newTestVolumeGroup()}
+	fileSystems := []imagecustomizerapi.FileSystem{
+		{
+			DeviceId:   "varlv",
+			Type:       imagecustomizerapi.FileSystemTypeExt4,
+			MountPoint: &imagecustomizerapi.MountPoint{Path: "/var"},
+		},
+		{
+			DeviceId:   "rootlv",
+			Type:       imagecustomizerapi.FileSystemTypeExt4,
+			MountPoint: &imagecustomizerapi.MountPoint{Path: "/"},
+		},
+	}
+
+	volumeGroup, logicalVolume, found := findRootLogicalVolume(volumeGroups, fileSystems)
+	assert.True(t, found)
+	assert.Equal(t, "vg0", volumeGroup.Name)
+	assert.Equal(t, "root", logicalVolume.Name)
+	assert.Equal(t, "rd.lvm.lv=vg0/root", lvmKernelCommandLineArg(volumeGroup.Name, logicalVolume.Name))
+
+	_, _, found = findRootLogicalVolume(volumeGroups, fileSystems[:1])
+	assert.False(t, found)
+}
+
+func TestFindSourcePartitionLogicalVolume(t *testing.T) {
+	partitions := []diskutils.PartitionInfo{
+		{
+			Path:     "/dev/loop0p3",
+			Type:     "part",
+			PartUuid: "2222",
+		},
+		{
+			Path: "/dev/mapper/vg0-root",
+			Type: "lvm",
+		},
+	}
+
+	mountIdType, partition, partitionIndex, err := findSourcePartitionHelper("/dev/mapper/vg0-root", partitions)
+	assert.NoError(t, err)
+	assert.Equal(t, imagecustomizerapi.MountIdentifierTypeDefault, mountIdType)
+	assert.Equal(t, "/dev/mapper/vg0-root", partition.Path)
+	assert.Equal(t, 1, partitionIndex)
+
+	_, err = findSourcePartition("/dev/mapper/vg0-home", partitions)
+	assert.ErrorContains(t, err, "partition not found")
+
+	_, err = findSourcePartition("/dev/sda1", partitions)
+	assert.ErrorContains(t, err, "unknown fstab source type (/dev/sda1)")
+}
@@ -7,11 +7,12 @@ import (
 	"time"
 
 	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
 )
 
 func doOsCustomizations(buildDir string, baseConfigPath string, config *imagecustomizerapi.Config,
 	imageConnection *ImageConnection, rpmsSources []string, useBaseImageRpmRepos bool, partitionsCustomized bool,
-	imageUuid string) error {
+	imageUuid string, luksUuids map[string]string) error {
 	var err error
 
 	imageChroot := imageConnection.Chroot()
@@ -85,13 +86,40 @@ func doOsCustomizations(buildDir string, baseConfigPath string, config *imagecus
 		return err
 	}
 
-	if partitionsCustomized || overlayUpdated || verityUpdated {
+	encryptionUpdated, err := enableEncryptedPartitions(baseConfigPath, config.Storage.Encryption, luksUuids,
+		imageChroot)
+	if err != nil {
+		return err
+	}
+
+	raidUpdated, err := enableRaid(config.Storage.Raid, imageConnection)
+	if err != nil {
+		return err
+	}
+
+	lvmUpdated, err := enableLvm(config.Storage.VolumeGroups, config.Storage.FileSystems, imageChroot)
+	if err != nil {
+		return err
+	}
+
+	btrfsUpdated, err := enableBtrfs(config.Storage.FileSystems, imageChroot)
+	if err != nil {
+		return err
+	}
+
+	if partitionsCustomized || overlayUpdated || verityUpdated || encryptionUpdated || raidUpdated || lvmUpdated ||
+		btrfsUpdated {
 		err = regenerateInitrd(imageChroot)
 		if err != nil {
 			return err
 		}
 	}
 
+	err = installSystemdBoot(config.OS.BootLoader, imageChroot)
+	if err != nil {
+		return err
+	}
+
 	err = runUserScripts(baseConfigPath, config.Scripts.PostCustomization, "postCustomization", imageChroot)
 	if err != nil {
 		return err
@@ -117,5 +145,27 @@ func doOsCustomizations(buildDir string, baseConfigPath string, config *imagecus
 		return err
 	}
 
+	if config.OS.TargetKernel != "" {
+		targetKernel, err := versioncompare.ParseConstraint(config.OS.TargetKernel)
+		if err != nil {
+			return err
+		}
+
+		err = checkKernelMatchesTarget(imageChroot, targetKernel)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = stageUkiInputs(config.OS.Uki, buildDir, imageChroot)
+	if err != nil {
+		return err
+	}
+
+	err = stageSbom(config.OS.Sbom, buildDir, imageUuid, config.OS.AdditionalFiles, imageChroot)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -28,7 +28,7 @@ func customizePartitionsUsingFileCopy(buildDir string, baseConfigPath string, co
 	}
 
 	partIdToPartUuid, err := createNewImage(newBuildImageFile, diskConfig, config.Storage.FileSystems,
-		buildDir, "newimageroot", installOSFunc)
+		config.Storage.Raid, config.Storage.VolumeGroups, buildDir, "newimageroot", installOSFunc)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,326 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/configuration"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/diskutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/sliceutils"
+)
+
+const (
+	mdadmConfPath = "/etc/mdadm.conf"
+
+	raidMemberFsType = "linux_raid_member"
+)
+
+// createRaidArrays creates the RAID arrays from their member partitions and formats them. The device path and file
+// system type of each RAID array are returned, keyed by the RAID array's ID.
+func createRaidArrays(raids []imagecustomizerapi.Raid, fileSystems []imagecustomizerapi.FileSystem,
+	partIDToDevPathMap map[string]string,
+) (map[string]string, map[string]string, error) {
+	raidIdToDevPathMap := make(map[string]string)
+	raidIdToFsTypeMap := make(map[string]string)
+
+	for _, raid := range raids {
+		logger.Log.Infof("Creating RAID array (%s)", raid.Name)
+
+		memberPaths := []string(nil)
+		for _, deviceId := range raid.Devices {
+			devPath, found := partIDToDevPathMap[deviceId]
+			if !found {
+				return nil, nil, fmt.Errorf("failed to find partition (%s) for RAID array (%s)", deviceId, raid.Name)
+			}
+
+			memberPaths = append(memberPaths, devPath)
+		}
+
+		err := shell.ExecuteLive(true /*squashErrors*/, "mdadm", mdadmCreateArgs(raid, memberPaths)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create RAID array (%s):\n%w", raid.Name, err)
+		}
+
+		err = diskutils.WaitForDevicesToSettle()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		devPath := raidDevicePath(raid.Name)
+
+		fileSystem, _ := sliceutils.FindValueFunc(fileSystems,
+			func(fileSystem imagecustomizerapi.FileSystem) bool {
+				return fileSystem.DeviceId == raid.Id
+			},
+		)
+
+		fsType := string(fileSystem.Type)
+		fsType, err = diskutils.FormatSinglePartition(devPath, configuration.Partition{FsType: fsType})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to format RAID array (%s):\n%w", raid.Name, err)
+		}
+
+		raidIdToDevPathMap[raid.Id] = devPath
+		raidIdToFsTypeMap[raid.Id] = fsType
+	}
+
+	return raidIdToDevPathMap, raidIdToFsTypeMap, nil
+}
+
+// mdadmCreateArgs returns the mdadm args that create a RAID array.
+func mdadmCreateArgs(raid imagecustomizerapi.Raid, memberPaths []string) []string {
+	args := []string{
+		"--create", raidDevicePath(raid.Name),
+		"--run",
+		"--metadata=1.2",
+		// Don't tie the array to the build host.
+		"--homehost=any",
+		"--name=" + raid.Name,
+		"--level=" + string(raid.Level),
+		"--raid-devices=" + strconv.Itoa(len(memberPaths)),
+		// The member partitions are empty. So, there is nothing to sync. Syncing would also needlessly fill in the
+		// sparse disk file.
+		"--assume-clean",
+	}
+
+	args = append(args, memberPaths...)
+	return args
+}
+
+// raidDevicePath returns the named device path of a RAID array.
+func raidDevicePath(raidName string) string {
+	return imagecustomizerapi.MdDevicePath + "/" + raidName
+}
+
+// setRaidMountIdentifiers makes the filesystems on RAID arrays be referenced by their filesystem UUID, since RAID
+// arrays don't have partition identifiers.
+func setRaidMountIdentifiers(imagerPartitionSettings []configuration.PartitionSetting,
+	raids []imagecustomizerapi.Raid,
+) {
+	for i := range imagerPartitionSettings {
+		partitionSetting := &imagerPartitionSettings[i]
+
+		isRaid := sliceutils.ContainsFunc(raids, func(raid imagecustomizerapi.Raid) bool {
+			return raid.Id == partitionSetting.ID
+		})
+		if isRaid {
+			partitionSetting.MountIdentifier = configuration.MountIdentifierUuid
+		}
+	}
+}
+
+// activateRaidArrays assembles the RAID arrays that have member partitions on the disk. The device paths of the RAID
+// arrays are returned.
+func activateRaidArrays(diskDevPath string) ([]string, error) {
+	diskPartitions, err := diskutils.GetDiskPartitions(diskDevPath)
+	if err != nil {
+		return nil, err
+	}
+
+	memberPaths := []string(nil)
+	for _, diskPartition := range diskPartitions {
+		if diskPartition.Type == "part" && diskPartition.FileSystemType == raidMemberFsType {
+			memberPaths = append(memberPaths, diskPartition.Path)
+		}
+	}
+
+	if len(memberPaths) <= 0 {
+		return nil, nil
+	}
+
+	for _, memberPath := range memberPaths {
+		// The host's udev rules may have already assembled the array. So, errors are only logged here. Whether or
+		// not the arrays were assembled is checked below.
+		err := shell.ExecuteLive(true /*squashErrors*/, "mdadm", "--incremental", "--run", memberPath)
+		if err != nil {
+			logger.Log.Debugf("Failed to add RAID member (%s) to array:\n%v", memberPath, err)
+		}
+	}
+
+	err = diskutils.WaitForDevicesToSettle()
+	if err != nil {
+		return nil, err
+	}
+
+	diskPartitions, err = diskutils.GetDiskPartitions(diskDevPath)
+	if err != nil {
+		return nil, err
+	}
+
+	raidPaths := []string(nil)
+	for _, diskPartition := range diskPartitions {
+		if isRaidDeviceType(diskPartition.Type) {
+			raidPaths = append(raidPaths, diskPartition.Path)
+		}
+	}
+
+	if len(raidPaths) <= 0 {
+		return nil, fmt.Errorf("failed to assemble RAID arrays from members (%s)", strings.Join(memberPaths, ", "))
+	}
+
+	logger.Log.Debugf("Activated RAID arrays (%s)", strings.Join(raidPaths, ", "))
+
+	return raidPaths, nil
+}
+
+// deactivateRaidArrays stops the RAID arrays, so that the disk's loopback device can be detached.
+func deactivateRaidArrays(raidPaths []string) error {
+	for _, raidPath := range raidPaths {
+		err := shell.ExecuteLive(true /*squashErrors*/, "mdadm", "--stop", raidPath)
+		if err != nil {
+			return fmt.Errorf("failed to stop RAID array (%s):\n%w", raidPath, err)
+		}
+	}
+
+	return nil
+}
+
+func isRaidDeviceType(deviceType string) bool {
+	switch deviceType {
+	case "raid0", "raid1", "raid4", "raid5", "raid6", "raid10":
+		return true
+
+	default:
+		return false
+	}
+}
+
+func enableRaid(raids []imagecustomizerapi.Raid, imageConnection *ImageConnection) (bool, error) {
+	var err error
+
+	if len(raids) <= 0 {
+		return false, nil
+	}
+
+	logger.Log.Infof("Enable RAID")
+
+	imageChroot := imageConnection.Chroot()
+
+	err = validateRaidDependencies(imageChroot)
+	if err != nil {
+		return false, fmt.Errorf("failed to validate package dependencies for RAID:\n%w", err)
+	}
+
+	mdadmConfLines, err := createMdadmConfLines(raids, imageConnection.raidArrays)
+	if err != nil {
+		return false, err
+	}
+
+	err = file.Append(strings.Join(mdadmConfLines, "\n")+"\n", filepath.Join(imageChroot.RootDir(), mdadmConfPath))
+	if err != nil {
+		return false, fmt.Errorf("failed to write (%s):\n%w", mdadmConfPath, err)
+	}
+
+	// Integrate the mdraid dracut module and the mdadm.conf file into initramfs img, so that the arrays can be
+	// assembled before the root filesystem is mounted.
+	dracutConfigFile := filepath.Join(imageChroot.RootDir(), "etc", "dracut.conf.d", "mdraid.conf")
+	err = addDracutConfig(dracutConfigFile, []string{
+		"add_dracutmodules+=\" mdraid \"",
+		"add_drivers+=\" " + strings.Join(raidKernelDrivers(raids), " ") + " \"",
+		"mdadmconf=\"yes\"",
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to add dracut modules for RAID:\n%w", err)
+	}
+
+	return true, nil
+}
+
+// createMdadmConfLines returns the /etc/mdadm.conf lines that describe the RAID arrays.
+func createMdadmConfLines(raids []imagecustomizerapi.Raid, raidPaths []string) ([]string, error) {
+	raidUuids := make(map[string]string)
+	for _, raidPath := range raidPaths {
+		stdout, _, err := shell.Execute("mdadm", "--detail", "--export", raidPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read details of RAID array (%s):\n%w", raidPath, err)
+		}
+
+		name, uuid := parseMdadmDetailExport(stdout)
+		raidUuids[name] = uuid
+	}
+
+	lines := []string(nil)
+	for _, raid := range raids {
+		uuid, found := raidUuids[raid.Name]
+		if !found {
+			return nil, fmt.Errorf("failed to find RAID array (%s)", raid.Name)
+		}
+
+		lines = append(lines, mdadmConfArrayLine(raid.Name, uuid))
+	}
+
+	return lines, nil
+}
+
+// parseMdadmDetailExport returns the name (without the homehost) and the UUID of a RAID array, from the output of
+// 'mdadm --detail --export'.
+func parseMdadmDetailExport(output string) (string, string) {
+	name := ""
+	uuid := ""
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "MD_NAME":
+			// The name is prefixed with the homehost (e.g. 'any:root').
+			_, name, found = strings.Cut(value, ":")
+			if !found {
+				name = value
+			}
+
+		case "MD_UUID":
+			uuid = value
+		}
+	}
+
+	return name, uuid
+}
+
+func mdadmConfArrayLine(raidName string, uuid string) string {
+	return fmt.Sprintf("ARRAY %s metadata=1.2 UUID=%s", raidDevicePath(raidName), uuid)
+}
+
+// raidKernelDrivers returns the kernel modules that the RAID arrays need.
+func raidKernelDrivers(raids []imagecustomizerapi.Raid) []string {
+	drivers := []string(nil)
+	for _, raid := range raids {
+		driver := string(raid.Level)
+		switch raid.Level {
+		case imagecustomizerapi.RaidLevelRaid5, imagecustomizerapi.RaidLevelRaid6:
+			driver = "raid456"
+		}
+
+		if !sliceutils.ContainsValue(drivers, driver) {
+			drivers = append(drivers, driver)
+		}
+	}
+
+	return drivers
+}
+
+func validateRaidDependencies(imageChroot *safechroot.Chroot) error {
+	requiredRpms := []string{"mdadm"}
+
+	for _, pkg := range requiredRpms {
+		logger.Log.Debugf("Checking if package (%s) is installed", pkg)
+		if !isPackageInstalled(imageChroot, pkg) {
+			return fmt.Errorf("package (%s) is not installed:\nthe following packages must be installed to use "+
+				"RAID: %v", pkg, requiredRpms)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMdadmDetailExport = `MD_LEVEL=raid1
+MD_DEVICES=2
+MD_METADATA=1.2
+MD_UUID=3a4d8b1c:5e6f7a8b:9c0d1e2f:3a4b5c6d
+MD_DEVNAME=root
+MD_NAME=any:root
+MD_DEVICE_dev_loop0p3_ROLE=0
+MD_DEVICE_dev_loop0p3_DEV=/dev/loop0p3
+`
+
+func newTestRootRaid() imagecustomizerapi.Raid {
+	return imagecustomizerapi.Raid{
+		Id:      "rootraid",
+		Name:    "root",
+		Level:   imagecustomizerapi.RaidLevelRaid1,
+		Devices: []string{"root1", "root2"},
+	}
+}
+
+func TestMdadmCreateArgs(t *testing.T) {
+	args := mdadmCreateArgs(newTestRootRaid(), []string{"/dev/loop0p3", "/dev/loop0p4"})
+	assert.Equal(t, []string{
+		"--create", "/dev/md/root", "--run", "--metadata=1.2", "--homehost=any", "--name=root", "--level=raid1",
+		"--raid-devices=2", "--assume-clean", "/dev/loop0p3", "/dev/loop0p4",
+	}, args)
+}
+
+func TestParseMdadmDetailExport(t *testing.T) {
+	name, uuid := parseMdadmDetailExport(testMdadmDetailExport)
+	assert.Equal(t, "root", name)
+	assert.Equal(t, "3a4d8b1c:5e6f7a8b:9c0d1e2f:3a4b5c6d", uuid)
+	assert.Equal(t, "ARRAY /dev/md/root metadata=1.2 UUID=3a4d8b1c:5e6f7a8b:9c0d1e2f:3a4b5c6d",
+		mdadmConfArrayLine(name, uuid))
+
+	// Arrays created without a homehost don't have a prefix.
+	name, _ = parseMdadmDetailExport("MD_NAME=data\n")
+	assert.Equal(t, "data", name)
+}
+
+func TestRaidKernelDrivers(t *testing.T) {
+	raids := []imagecustomizerapi.Raid{
+		newTestRootRaid(),
+		{Id: "a", Name: "a", Level: imagecustomizerapi.RaidLevelRaid5},
+		{Id: "b", Name: "b", Level: imagecustomizerapi.RaidLevelRaid6},
+		{Id: "c", Name: "c", Level: imagecustomizerapi.RaidLevelRaid1},
+		{Id: "d", Name: "d", Level: imagecustomizerapi.RaidLevelRaid10},
+	}
+
+	assert.Equal(t, []string{"raid1", "raid456", "raid10"}, raidKernelDrivers(raids))
+}
+
+func TestSetRaidMountIdentifiers(t *testing.T) {
+	partitionSettings := []configuration.PartitionSetting{
+		{
+			ID:              "boot",
+			MountIdentifier: configuration.MountIdentifierPartUuid,
+			MountPoint:      "/boot",
+		},
+		{
+			ID:              "rootraid",
+			MountIdentifier: configuration.MountIdentifierPartUuid,
+			MountPoint:      "/",
+		},
+	}
+
+	setRaidMountIdentifiers(partitionSettings, []imagecustomizerapi.Raid{newTestRootRaid()})
+	assert.Equal(t, configuration.MountIdentifierPartUuid, partitionSettings[0].MountIdentifier)
+	assert.Equal(t, configuration.MountIdentifierUuid, partitionSettings[1].MountIdentifier)
+}
+
+func TestIsFileSystemDeviceType(t *testing.T) {
+	assert.True(t, isFileSystemDeviceType("part"))
+	assert.True(t, isFileSystemDeviceType("lvm"))
+	assert.True(t, isFileSystemDeviceType("raid1"))
+	assert.False(t, isFileSystemDeviceType("loop"))
+	assert.False(t, isFileSystemDeviceType("disk"))
+}
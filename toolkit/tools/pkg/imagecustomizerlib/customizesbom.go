@@ -0,0 +1,655 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+const (
+	sbomStagingFileName = "sbom.json"
+	sbomToolName        = "imagecustomizer"
+
+	// The package fields are separated by tabs, since a license or vendor may contain spaces.
+	sbomRpmQueryFormat = "%{NAME}\t%{EPOCHNUM}\t%{VERSION}\t%{RELEASE}\t%{ARCH}\t%{LICENSE}\t%{VENDOR}\n"
+
+	// rpm lists each imported GPG key as a "gpg-pubkey" package. These aren't software and are left out of the SBOM.
+	rpmGpgPubkeyPackageName = "gpg-pubkey"
+
+	spdxFileExtension          = ".spdx.json"
+	cycloneDxFileExtension     = ".cdx.json"
+	sbomSignatureFileExtension = ".p7s"
+
+	spdxNoAssertion = "NOASSERTION"
+	spdxDocumentId  = "SPDXRef-DOCUMENT"
+	spdxOsId        = "SPDXRef-OperatingSystem"
+
+	cycloneDxOsRef = "operating-system"
+)
+
+// sbomPackage is an installed package, as read from the image's rpm database.
+type sbomPackage struct {
+	Name    string
+	Epoch   string
+	Version string
+	Release string
+	Arch    string
+	License string
+	Vendor  string
+}
+
+// sbomFile is a file that was added to the image by the config.
+type sbomFile struct {
+	// The path of the file within the image.
+	Path   string
+	Sha1   string
+	Sha256 string
+}
+
+// sbomContents holds everything that goes into the SBOM, independent of the SBOM's format.
+type sbomContents struct {
+	Distro    *systemdependency.Distro
+	ImageUuid string
+	Created   time.Time
+	Packages  []sbomPackage
+	// The installed kernels that aren't owned by a package. For example, a kernel that was copied into the image by a
+	// script. The kernels that are owned by a package are already covered by Packages.
+	Kernels []KernelComponent
+	Files   []sbomFile
+}
+
+// stageSbom reads the image's installed packages and the hashes of the additional files, and writes the SBOM to the
+// build directory. The SBOM is copied to the output directory by writeSbom, once the image is finished.
+func stageSbom(sbom *imagecustomizerapi.Sbom, buildDir string, imageUuid string,
+	additionalFiles imagecustomizerapi.AdditionalFileList, imageChroot *safechroot.Chroot,
+) error {
+	if sbom == nil {
+		return nil
+	}
+
+	logger.Log.Infof("Creating SBOM")
+
+	rootDir := imageChroot.RootDir()
+
+	packageManager, err := getImagePackageManager(rootDir)
+	if err != nil {
+		return err
+	}
+
+	if packageManager != rpmQueryProgramPath {
+		return fmt.Errorf("failed to create SBOM:\nimage doesn't have an rpm database")
+	}
+
+	packages, err := getSbomPackages(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	kernels, err := getSbomUnpackagedKernels(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	files, err := getSbomFiles(rootDir, additionalFiles)
+	if err != nil {
+		return err
+	}
+
+	distro, err := systemdependency.ReadDistroFromOsRelease(filepath.Join(rootDir, "/etc/os-release"))
+	if err != nil {
+		return err
+	}
+
+	contents := sbomContents{
+		Distro:    distro,
+		ImageUuid: imageUuid,
+		Created:   time.Now().UTC(),
+		Packages:  packages,
+		Kernels:   kernels,
+		Files:     files,
+	}
+
+	var document any
+	switch sbom.Format {
+	case imagecustomizerapi.SbomFormatSpdx:
+		document = newSpdxDocument(contents)
+
+	case imagecustomizerapi.SbomFormatCycloneDx:
+		document = newCycloneDxDocument(contents)
+
+	default:
+		return fmt.Errorf("unsupported SBOM format (%s)", sbom.Format)
+	}
+
+	documentBytes, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize SBOM:\n%w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(buildDir, sbomStagingFileName), documentBytes, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write SBOM:\n%w", err)
+	}
+
+	return nil
+}
+
+// writeSbom copies the staged SBOM next to the output image and, if requested, signs it. The signature is a detached
+// CMS (PKCS #7) signature in DER format, which can be checked with:
+//
+//	openssl cms -verify -binary -inform DER -in <sbom>.p7s -content <sbom> -CAfile <certificate>
+func writeSbom(buildDir string, baseConfigPath string, sbom *imagecustomizerapi.Sbom, outputImageDir string,
+	outputImageBase string,
+) error {
+	stagedSbomPath := filepath.Join(buildDir, sbomStagingFileName)
+	defer os.Remove(stagedSbomPath)
+
+	sbomPath := filepath.Join(outputImageDir, outputImageBase+sbomFileExtension(sbom.Format))
+
+	logger.Log.Infof("Writing: %s", sbomPath)
+
+	err := file.Copy(stagedSbomPath, sbomPath)
+	if err != nil {
+		return fmt.Errorf("failed to write SBOM (%s):\n%w", sbomPath, err)
+	}
+
+	if sbom.Signing != nil {
+		err = shell.ExecuteLive(true /*squashErrors*/, "openssl",
+			sbomSignArgs(sbomPath, sbom.Signing, baseConfigPath)...)
+		if err != nil {
+			return fmt.Errorf("failed to sign SBOM (%s):\n%w", sbomPath, err)
+		}
+	}
+
+	return nil
+}
+
+func sbomFileExtension(format imagecustomizerapi.SbomFormat) string {
+	if format == imagecustomizerapi.SbomFormatCycloneDx {
+		return cycloneDxFileExtension
+	}
+
+	return spdxFileExtension
+}
+
+// sbomSignArgs returns the openssl args that write the detached signature of the SBOM.
+func sbomSignArgs(sbomPath string, signing *imagecustomizerapi.SbomSigning, baseConfigPath string) []string {
+	return []string{
+		"cms", "-sign", "-binary",
+		"-md", "sha256",
+		"-in", sbomPath,
+		"-signer", file.GetAbsPathWithBase(baseConfigPath, signing.CertificateFile),
+		"-inkey", file.GetAbsPathWithBase(baseConfigPath, signing.KeyFile),
+		"-outform", "DER",
+		"-out", sbomPath + sbomSignatureFileExtension,
+	}
+}
+
+// getSbomPackages returns the packages in the image's rpm database, sorted by name.
+func getSbomPackages(imageChroot *safechroot.Chroot) ([]sbomPackage, error) {
+	stdout, stderr, err := runPackageQuery(imageChroot, "rpm", "-qa", "--queryformat", sbomRpmQueryFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rpm for installed packages:\n%v\n%w", stderr, err)
+	}
+
+	return parseSbomRpmQuery(stdout)
+}
+
+func parseSbomRpmQuery(output string) ([]sbomPackage, error) {
+	packages := []sbomPackage(nil)
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 || fields[0] == "" || fields[2] == "" {
+			return nil, fmt.Errorf("invalid package query output (%s)", line)
+		}
+
+		if fields[0] == rpmGpgPubkeyPackageName {
+			continue
+		}
+
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+			if fields[i] == rpmQueryNoneValue {
+				fields[i] = ""
+			}
+		}
+
+		packages = append(packages, sbomPackage{
+			Name:    fields[0],
+			Epoch:   fields[1],
+			Version: fields[2],
+			Release: fields[3],
+			Arch:    fields[4],
+			License: fields[5],
+			Vendor:  fields[6],
+		})
+	}
+
+	sort.SliceStable(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Arch < packages[j].Arch
+	})
+
+	return packages, nil
+}
+
+// getSbomUnpackagedKernels returns the installed kernels that aren't owned by a package. Images without a kernel
+// modules directory (e.g. container images) don't have any kernels.
+func getSbomUnpackagedKernels(imageChroot *safechroot.Chroot) ([]KernelComponent, error) {
+	components, err := ExportKernelComponents(imageChroot)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kernels := []KernelComponent(nil)
+	for _, component := range components {
+		if !component.FromPackage {
+			kernels = append(kernels, component)
+		}
+	}
+
+	return kernels, nil
+}
+
+// getSbomFiles hashes the additional files, as they are in the finished image.
+func getSbomFiles(rootDir string, additionalFiles imagecustomizerapi.AdditionalFileList) ([]sbomFile, error) {
+	files := []sbomFile(nil)
+	seen := make(map[string]bool)
+	for _, additionalFile := range additionalFiles {
+		filePath := filepath.Join("/", additionalFile.Destination)
+		if seen[filePath] {
+			continue
+		}
+		seen[filePath] = true
+
+		sha1Hash, sha256Hash, err := hashSbomFile(filepath.Join(rootDir, filePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash additional file (%s):\n%w", filePath, err)
+		}
+
+		files = append(files, sbomFile{
+			Path:   filePath,
+			Sha1:   sha1Hash,
+			Sha256: sha256Hash,
+		})
+	}
+
+	return files, nil
+}
+
+func hashSbomFile(filePath string) (string, string, error) {
+	fileReader, err := os.Open(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	defer fileReader.Close()
+
+	sha1Hasher := sha1.New()
+	sha256Hasher := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(sha1Hasher, sha256Hasher), fileReader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return hex.EncodeToString(sha1Hasher.Sum(nil)), hex.EncodeToString(sha256Hasher.Sum(nil)), nil
+}
+
+// versionRelease returns the package's version and release. For example: "2.40-2.azl3".
+func (p sbomPackage) versionRelease() string {
+	if p.Release == "" {
+		return p.Version
+	}
+
+	return p.Version + "-" + p.Release
+}
+
+// version returns the package's full version, including the epoch. For example: "1:2.40-2.azl3".
+func (p sbomPackage) version() string {
+	if p.Epoch == "" || p.Epoch == "0" {
+		return p.versionRelease()
+	}
+
+	return p.Epoch + ":" + p.versionRelease()
+}
+
+// purl returns the package URL of the package. For example:
+// "pkg:rpm/azurelinux/bash@5.2.15-3.azl3?arch=x86_64&distro=azurelinux-3.0".
+func (p sbomPackage) purl(distro *systemdependency.Distro) string {
+	qualifiers := []string(nil)
+	if p.Arch != "" {
+		qualifiers = append(qualifiers, "arch="+url.QueryEscape(p.Arch))
+	}
+
+	if distro.ID != "" {
+		qualifiers = append(qualifiers, "distro="+url.QueryEscape(distro.ID+"-"+distro.VersionID))
+	}
+
+	if p.Epoch != "" && p.Epoch != "0" {
+		qualifiers = append(qualifiers, "epoch="+url.QueryEscape(p.Epoch))
+	}
+
+	namespace := ""
+	if distro.ID != "" {
+		namespace = url.PathEscape(strings.ToLower(distro.ID)) + "/"
+	}
+
+	purl := fmt.Sprintf("pkg:rpm/%s%s@%s", namespace, url.PathEscape(p.Name),
+		url.PathEscape(p.versionRelease()))
+	if len(qualifiers) > 0 {
+		purl += "?" + strings.Join(qualifiers, "&")
+	}
+
+	return purl
+}
+
+func sbomToolNameAndVersion() string {
+	if ToolVersion == "" {
+		return sbomToolName
+	}
+
+	return sbomToolName + "-" + ToolVersion
+}
+
+type spdxDocument struct {
+	SpdxVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SpdxId            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name                  string            `json:"name"`
+	SpdxId                string            `json:"SPDXID"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	Supplier              string            `json:"supplier"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	LicenseConcluded      string            `json:"licenseConcluded"`
+	LicenseDeclared       string            `json:"licenseDeclared"`
+	LicenseComments       string            `json:"licenseComments,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxFile struct {
+	FileName         string         `json:"fileName"`
+	SpdxId           string         `json:"SPDXID"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	SpdxElementId      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSpdxElement string `json:"relatedSpdxElement"`
+}
+
+// newSpdxDocument returns an SPDX 2.3 document that describes the image's OS, which contains the packages and the
+// additional files.
+func newSpdxDocument(contents sbomContents) spdxDocument {
+	document := spdxDocument{
+		SpdxVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SpdxId:            spdxDocumentId,
+		Name:              strings.TrimSpace(contents.Distro.ID + " " + contents.Distro.VersionID),
+		DocumentNamespace: "urn:uuid:" + contents.ImageUuid,
+		CreationInfo: spdxCreationInfo{
+			Created:  contents.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomToolNameAndVersion()},
+		},
+		Packages: []spdxPackage{{
+			Name:                  contents.Distro.ID,
+			SpdxId:                spdxOsId,
+			VersionInfo:           contents.Distro.VersionID,
+			Supplier:              spdxNoAssertion,
+			DownloadLocation:      spdxNoAssertion,
+			LicenseConcluded:      spdxNoAssertion,
+			LicenseDeclared:       spdxNoAssertion,
+			PrimaryPackagePurpose: "OPERATING-SYSTEM",
+		}},
+		Relationships: []spdxRelationship{{
+			SpdxElementId:      spdxDocumentId,
+			RelationshipType:   "DESCRIBES",
+			RelatedSpdxElement: spdxOsId,
+		}},
+	}
+
+	for i, pkg := range contents.Packages {
+		supplier := spdxNoAssertion
+		if pkg.Vendor != "" {
+			supplier = "Organization: " + pkg.Vendor
+		}
+
+		// rpm license tags aren't guaranteed to be valid SPDX license expressions. So, they are recorded as a comment.
+		licenseComments := ""
+		if pkg.License != "" {
+			licenseComments = "RPM License tag: " + pkg.License
+		}
+
+		spdxId := fmt.Sprintf("SPDXRef-Package-%d", i)
+		document.Packages = append(document.Packages, spdxPackage{
+			Name:             pkg.Name,
+			SpdxId:           spdxId,
+			VersionInfo:      pkg.version(),
+			Supplier:         supplier,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			LicenseComments:  licenseComments,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  pkg.purl(contents.Distro),
+			}},
+		})
+		document.Relationships = append(document.Relationships, spdxRelationship{
+			SpdxElementId:      spdxOsId,
+			RelationshipType:   "CONTAINS",
+			RelatedSpdxElement: spdxId,
+		})
+	}
+
+	for i, kernel := range contents.Kernels {
+		spdxId := fmt.Sprintf("SPDXRef-Kernel-%d", i)
+		document.Packages = append(document.Packages, spdxPackage{
+			Name:             kernel.Name,
+			SpdxId:           spdxId,
+			VersionInfo:      kernel.Version,
+			Supplier:         spdxNoAssertion,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+		})
+		document.Relationships = append(document.Relationships, spdxRelationship{
+			SpdxElementId:      spdxOsId,
+			RelationshipType:   "CONTAINS",
+			RelatedSpdxElement: spdxId,
+		})
+	}
+
+	for i, addedFile := range contents.Files {
+		spdxId := fmt.Sprintf("SPDXRef-File-%d", i)
+		document.Files = append(document.Files, spdxFile{
+			FileName: "." + addedFile.Path,
+			SpdxId:   spdxId,
+			Checksums: []spdxChecksum{
+				{Algorithm: "SHA1", ChecksumValue: addedFile.Sha1},
+				{Algorithm: "SHA256", ChecksumValue: addedFile.Sha256},
+			},
+			LicenseConcluded: spdxNoAssertion,
+		})
+		document.Relationships = append(document.Relationships, spdxRelationship{
+			SpdxElementId:      spdxOsId,
+			RelationshipType:   "CONTAINS",
+			RelatedSpdxElement: spdxId,
+		})
+	}
+
+	return document
+}
+
+type cycloneDxDocument struct {
+	BomFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDxMetadata    `json:"metadata"`
+	Components   []cycloneDxComponent `json:"components"`
+}
+
+type cycloneDxMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDxTools     `json:"tools"`
+	Component cycloneDxComponent `json:"component"`
+}
+
+type cycloneDxTools struct {
+	Components []cycloneDxComponent `json:"components"`
+}
+
+type cycloneDxComponent struct {
+	Type      string             `json:"type"`
+	BomRef    string             `json:"bom-ref,omitempty"`
+	Publisher string             `json:"publisher,omitempty"`
+	Name      string             `json:"name"`
+	Version   string             `json:"version,omitempty"`
+	Licenses  []cycloneDxLicense `json:"licenses,omitempty"`
+	Purl      string             `json:"purl,omitempty"`
+	Hashes    []cycloneDxHash    `json:"hashes,omitempty"`
+}
+
+type cycloneDxLicense struct {
+	License cycloneDxLicenseName `json:"license"`
+}
+
+type cycloneDxLicenseName struct {
+	Name string `json:"name"`
+}
+
+type cycloneDxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// newCycloneDxDocument returns a CycloneDX 1.5 document whose subject is the image's OS and whose components are the
+// packages and the additional files.
+func newCycloneDxDocument(contents sbomContents) cycloneDxDocument {
+	document := cycloneDxDocument{
+		BomFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + contents.ImageUuid,
+		Version:      1,
+		Metadata: cycloneDxMetadata{
+			Timestamp: contents.Created.Format(time.RFC3339),
+			Tools: cycloneDxTools{
+				Components: []cycloneDxComponent{{
+					Type:    "application",
+					Name:    sbomToolName,
+					Version: ToolVersion,
+				}},
+			},
+			Component: cycloneDxComponent{
+				Type:    "operating-system",
+				BomRef:  cycloneDxOsRef,
+				Name:    contents.Distro.ID,
+				Version: contents.Distro.VersionID,
+			},
+		},
+		Components: []cycloneDxComponent{},
+	}
+
+	for _, pkg := range contents.Packages {
+		// The rpm license tag is recorded as a license name, since it isn't guaranteed to be a valid SPDX license
+		// expression.
+		licenses := []cycloneDxLicense(nil)
+		if pkg.License != "" {
+			licenses = append(licenses, cycloneDxLicense{License: cycloneDxLicenseName{Name: pkg.License}})
+		}
+
+		purl := pkg.purl(contents.Distro)
+		document.Components = append(document.Components, cycloneDxComponent{
+			Type:      "library",
+			BomRef:    purl,
+			Publisher: pkg.Vendor,
+			Name:      pkg.Name,
+			Version:   pkg.version(),
+			Licenses:  licenses,
+			Purl:      purl,
+		})
+	}
+
+	for _, kernel := range contents.Kernels {
+		document.Components = append(document.Components, cycloneDxComponent{
+			Type:    "application",
+			BomRef:  "kernel:" + kernel.KernelRelease,
+			Name:    kernel.Name,
+			Version: kernel.Version,
+		})
+	}
+
+	for _, addedFile := range contents.Files {
+		document.Components = append(document.Components, cycloneDxComponent{
+			Type:   "file",
+			BomRef: "file:" + addedFile.Path,
+			Name:   addedFile.Path,
+			Hashes: []cycloneDxHash{
+				{Alg: "SHA-1", Content: addedFile.Sha1},
+				{Alg: "SHA-256", Content: addedFile.Sha256},
+			},
+		})
+	}
+
+	return document
+}
@@ -0,0 +1,276 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSbomRpmQueryOutput = "bash\t0\t5.2.15\t3.azl3\tx86_64\tGPL-3.0-or-later\tMicrosoft Corporation\n" +
+	"gpg-pubkey\t0\t3135ce90\t5e6fda74\t(none)\tpubkey\t(none)\n" +
+	"binutils\t1\t2.41\t2.azl3\tx86_64\tGPLv3+\t(none)\n"
+
+func TestParseSbomRpmQuery(t *testing.T) {
+	packages, err := parseSbomRpmQuery(testSbomRpmQueryOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, []sbomPackage{
+		{Name: "bash", Epoch: "0", Version: "5.2.15", Release: "3.azl3", Arch: "x86_64", License: "GPL-3.0-or-later",
+			Vendor: "Microsoft Corporation"},
+		{Name: "binutils", Epoch: "1", Version: "2.41", Release: "2.azl3", Arch: "x86_64", License: "GPLv3+"},
+	}, packages)
+}
+
+func TestParseSbomRpmQueryInvalid(t *testing.T) {
+	_, err := parseSbomRpmQuery("bash 5.2.15-3.azl3\n")
+	assert.ErrorContains(t, err, "invalid package query output (bash 5.2.15-3.azl3)")
+}
+
+func TestSbomPackagePurl(t *testing.T) {
+	distro := &systemdependency.Distro{ID: "azurelinux", VersionID: "3.0"}
+
+	pkg := sbomPackage{Name: "bash", Epoch: "0", Version: "5.2.15", Release: "3.azl3", Arch: "x86_64"}
+	assert.Equal(t, "5.2.15-3.azl3", pkg.version())
+	assert.Equal(t, "pkg:rpm/azurelinux/bash@5.2.15-3.azl3?arch=x86_64&distro=azurelinux-3.0", pkg.purl(distro))
+
+	pkg = sbomPackage{Name: "libstdc++", Epoch: "1", Version: "13.2.0", Release: "7.azl3", Arch: "x86_64"}
+	assert.Equal(t, "1:13.2.0-7.azl3", pkg.version())
+	assert.Equal(t, "pkg:rpm/azurelinux/libstdc++@13.2.0-7.azl3?arch=x86_64&distro=azurelinux-3.0&epoch=1",
+		pkg.purl(distro))
+
+	pkg = sbomPackage{Name: "bash", Version: "5.2.15"}
+	assert.Equal(t, "pkg:rpm/bash@5.2.15", pkg.purl(&systemdependency.Distro{}))
+}
+
+func testSbomContents() sbomContents {
+	return sbomContents{
+		Distro:    &systemdependency.Distro{ID: "azurelinux", VersionID: "3.0"},
+		ImageUuid: "c3f5a8e6-3d2b-4b8e-9c1a-5e7d2f4a6b8c",
+		Created:   time.Date(2024, 8, 9, 10, 11, 12, 0, time.UTC),
+		Packages: []sbomPackage{
+			{Name: "bash", Epoch: "0", Version: "5.2.15", Release: "3.azl3", Arch: "x86_64", License: "GPLv3+",
+				Vendor: "Microsoft Corporation"},
+		},
+		Kernels: []KernelComponent{
+			{Name: "linux", Version: "6.6.51.1-1.azl3.custom", KernelRelease: "6.6.51.1-1.azl3.custom"},
+		},
+		Files: []sbomFile{
+			{Path: "/etc/motd", Sha1: "1111", Sha256: "2222"},
+		},
+	}
+}
+
+func TestNewSpdxDocument(t *testing.T) {
+	document := newSpdxDocument(testSbomContents())
+
+	assert.Equal(t, "SPDX-2.3", document.SpdxVersion)
+	assert.Equal(t, "azurelinux 3.0", document.Name)
+	assert.Equal(t, "urn:uuid:c3f5a8e6-3d2b-4b8e-9c1a-5e7d2f4a6b8c", document.DocumentNamespace)
+	assert.Equal(t, "2024-08-09T10:11:12Z", document.CreationInfo.Created)
+
+	if assert.Len(t, document.Packages, 3) {
+		assert.Equal(t, "OPERATING-SYSTEM", document.Packages[0].PrimaryPackagePurpose)
+		assert.Equal(t, spdxPackage{
+			Name:             "bash",
+			SpdxId:           "SPDXRef-Package-0",
+			VersionInfo:      "5.2.15-3.azl3",
+			Supplier:         "Organization: Microsoft Corporation",
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			LicenseComments:  "RPM License tag: GPLv3+",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  "pkg:rpm/azurelinux/bash@5.2.15-3.azl3?arch=x86_64&distro=azurelinux-3.0",
+			}},
+		}, document.Packages[1])
+		assert.Equal(t, spdxPackage{
+			Name:             "linux",
+			SpdxId:           "SPDXRef-Kernel-0",
+			VersionInfo:      "6.6.51.1-1.azl3.custom",
+			Supplier:         "NOASSERTION",
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+		}, document.Packages[2])
+	}
+
+	if assert.Len(t, document.Files, 1) {
+		assert.Equal(t, "./etc/motd", document.Files[0].FileName)
+		assert.Equal(t, []spdxChecksum{{"SHA1", "1111"}, {"SHA256", "2222"}}, document.Files[0].Checksums)
+	}
+
+	assert.Equal(t, []spdxRelationship{
+		{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-OperatingSystem"},
+		{"SPDXRef-OperatingSystem", "CONTAINS", "SPDXRef-Package-0"},
+		{"SPDXRef-OperatingSystem", "CONTAINS", "SPDXRef-Kernel-0"},
+		{"SPDXRef-OperatingSystem", "CONTAINS", "SPDXRef-File-0"},
+	}, document.Relationships)
+}
+
+func TestNewCycloneDxDocument(t *testing.T) {
+	document := newCycloneDxDocument(testSbomContents())
+
+	assert.Equal(t, "CycloneDX", document.BomFormat)
+	assert.Equal(t, "1.5", document.SpecVersion)
+	assert.Equal(t, "urn:uuid:c3f5a8e6-3d2b-4b8e-9c1a-5e7d2f4a6b8c", document.SerialNumber)
+	assert.Equal(t, "2024-08-09T10:11:12Z", document.Metadata.Timestamp)
+	assert.Equal(t, cycloneDxComponent{Type: "operating-system", BomRef: "operating-system", Name: "azurelinux",
+		Version: "3.0"}, document.Metadata.Component)
+
+	purl := "pkg:rpm/azurelinux/bash@5.2.15-3.azl3?arch=x86_64&distro=azurelinux-3.0"
+	assert.Equal(t, []cycloneDxComponent{
+		{
+			Type:      "library",
+			BomRef:    purl,
+			Publisher: "Microsoft Corporation",
+			Name:      "bash",
+			Version:   "5.2.15-3.azl3",
+			Licenses:  []cycloneDxLicense{{License: cycloneDxLicenseName{Name: "GPLv3+"}}},
+			Purl:      purl,
+		},
+		{
+			Type:    "application",
+			BomRef:  "kernel:6.6.51.1-1.azl3.custom",
+			Name:    "linux",
+			Version: "6.6.51.1-1.azl3.custom",
+		},
+		{
+			Type:   "file",
+			BomRef: "file:/etc/motd",
+			Name:   "/etc/motd",
+			Hashes: []cycloneDxHash{{"SHA-1", "1111"}, {"SHA-256", "2222"}},
+		},
+	}, document.Components)
+}
+
+func TestGetSbomFiles(t *testing.T) {
+	rootDir := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(rootDir, "etc"), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = file.Write("hello\n", filepath.Join(rootDir, "etc/motd"))
+	assert.NoError(t, err)
+
+	content := "hello\n"
+	additionalFiles := imagecustomizerapi.AdditionalFileList{
+		{Destination: "/etc/motd", Content: &content},
+		{Destination: "etc/motd", Source: "files/motd"},
+	}
+
+	files, err := getSbomFiles(rootDir, additionalFiles)
+	assert.NoError(t, err)
+	assert.Equal(t, []sbomFile{{
+		Path:   "/etc/motd",
+		Sha1:   "f572d396fae9206628714fb2ce00f72e94f2258f",
+		Sha256: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+	}}, files)
+
+	additionalFiles = append(additionalFiles, imagecustomizerapi.AdditionalFile{Destination: "/etc/missing"})
+
+	_, err = getSbomFiles(rootDir, additionalFiles)
+	assert.ErrorContains(t, err, "failed to hash additional file (/etc/missing)")
+}
+
+func TestSbomSignArgs(t *testing.T) {
+	signing := &imagecustomizerapi.SbomSigning{
+		KeyFile:         "files/sbom.key",
+		CertificateFile: "/keys/sbom.crt",
+	}
+
+	args := sbomSignArgs("/out/image.spdx.json", signing, "/config")
+	assert.Equal(t, []string{
+		"cms", "-sign", "-binary", "-md", "sha256",
+		"-in", "/out/image.spdx.json",
+		"-signer", "/keys/sbom.crt",
+		"-inkey", "/config/files/sbom.key",
+		"-outform", "DER",
+		"-out", "/out/image.spdx.json.p7s",
+	}, args)
+}
+
+func TestStageAndWriteSbom(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, rpmQueryProgramPath)
+	buildDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(rootDir, "etc"), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = file.Write("ID=azurelinux\nVERSION_ID=\"3.0\"\n", filepath.Join(rootDir, "etc/os-release"))
+	assert.NoError(t, err)
+
+	setTestPackageQueryResponses(t, map[string][3]string{
+		"rpm -qa --queryformat " + sbomRpmQueryFormat: {testSbomRpmQueryOutput, "", ""},
+	})
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+	sbom := &imagecustomizerapi.Sbom{Format: imagecustomizerapi.SbomFormatCycloneDx}
+
+	err = stageSbom(sbom, buildDir, "c3f5a8e6-3d2b-4b8e-9c1a-5e7d2f4a6b8c", nil, imageChroot)
+	assert.NoError(t, err)
+
+	err = writeSbom(buildDir, "", sbom, outputDir, "image")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(buildDir, sbomStagingFileName))
+
+	documentBytes, err := os.ReadFile(filepath.Join(outputDir, "image.cdx.json"))
+	assert.NoError(t, err)
+
+	var document cycloneDxDocument
+	err = json.Unmarshal(documentBytes, &document)
+	assert.NoError(t, err)
+	assert.Equal(t, "azurelinux", document.Metadata.Component.Name)
+	if assert.Len(t, document.Components, 2) {
+		assert.Equal(t, "bash", document.Components[0].Name)
+		assert.Equal(t, "1:2.41-2.azl3", document.Components[1].Version)
+	}
+}
+
+func TestStageSbomNoRpm(t *testing.T) {
+	imageChroot := safechroot.NewChroot(t.TempDir(), true /*isExistingDir*/)
+	sbom := &imagecustomizerapi.Sbom{Format: imagecustomizerapi.SbomFormatSpdx}
+
+	err := stageSbom(sbom, t.TempDir(), "", nil, imageChroot)
+	assert.ErrorContains(t, err, "image doesn't have an rpm database")
+}
+
+func TestGetSbomUnpackagedKernels(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, rpmQueryProgramPath)
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	// No kernel modules directory.
+	kernels, err := getSbomUnpackagedKernels(imageChroot)
+	assert.NoError(t, err)
+	assert.Empty(t, kernels)
+
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3.custom")
+
+	rpmQuery := "rpm -qf --queryformat " + kernelComponentRpmQueryFormat + " /lib/modules/"
+	setTestPackageQueryResponses(t, map[string][3]string{
+		rpmQuery + "6.6.47.1-1.azl3": {"kernel\t6.6.47.1-1.azl3\tx86_64\tMicrosoft Corporation\n", "", ""},
+		rpmQuery + "6.6.51.1-1.azl3.custom": {
+			"file /lib/modules/6.6.51.1-1.azl3.custom is not owned by any package\n", "", "exit status 1",
+		},
+	})
+
+	// The packaged kernel is already in the SBOM's packages.
+	kernels, err = getSbomUnpackagedKernels(imageChroot)
+	assert.NoError(t, err)
+	assert.Equal(t, []KernelComponent{
+		{Name: "linux", Version: "6.6.51.1-1.azl3.custom", KernelRelease: "6.6.51.1-1.azl3.custom"},
+	}, kernels)
+}
@@ -0,0 +1,274 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+const (
+	// The directory that the systemd-boot package installs the systemd-boot EFI binaries to.
+	systemdBootEfiDir = "/usr/lib/systemd/boot/efi"
+
+	// The paths of the systemd-boot files, relative to the root of the EFI system partition.
+	systemdBootInstallDir = "EFI/systemd"
+	efiFallbackBootDir    = "EFI/BOOT"
+	loaderConfPath        = "loader/loader.conf"
+
+	// The names of the files within a kernel's directory on the EFI system partition.
+	systemdBootLinuxFileName  = "linux"
+	systemdBootInitrdFileName = "initrd"
+)
+
+// installSystemdBoot installs systemd-boot to the EFI system partition and writes a Boot Loader Specification entry
+// for each of the installed kernels. Since systemd-boot can only read files on the EFI system partition, the kernels
+// and their initramfs files are copied there too.
+//
+// The kernel command line is taken from the image's grub config, so that all the args that the other customizations
+// add to the grub config are kept.
+func installSystemdBoot(bootLoader imagecustomizerapi.BootLoaderType, imageChroot *safechroot.Chroot) error {
+	if bootLoader != imagecustomizerapi.BootLoaderTypeSystemdBoot {
+		return nil
+	}
+
+	logger.Log.Infof("Installing systemd-boot")
+
+	err := validateSystemdBootDependencies(imageChroot)
+	if err != nil {
+		return fmt.Errorf("failed to validate package dependencies for systemd-boot:\n%w", err)
+	}
+
+	rootDir := imageChroot.RootDir()
+
+	espDir, err := findEspDir(rootDir)
+	if err != nil {
+		return err
+	}
+
+	efiArch, err := systemdBootEfiArch(runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+
+	kernelVersions, err := systemdependency.GetInstalledKernelStringVersions(rootDir)
+	if err != nil {
+		return err
+	}
+
+	if len(kernelVersions) <= 0 {
+		return fmt.Errorf("failed to find any installed kernels to create systemd-boot entries for")
+	}
+
+	sortKernelVersions(kernelVersions)
+
+	cmdline, err := getDefaultKernelCmdline(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to read kernel command line for systemd-boot entries:\n%w", err)
+	}
+
+	distro, err := systemdependency.ReadDistroFromOsRelease(filepath.Join(rootDir, "/etc/os-release"))
+	if err != nil {
+		return err
+	}
+
+	// Install the systemd-boot binary, both to its own directory and to the fallback boot path so that firmware
+	// without a boot entry for it still boots it.
+	systemdBootSourcePath := filepath.Join(rootDir, systemdBootEfiDir, "systemd-boot"+efiArch+".efi")
+	systemdBootTargetPaths := []string{
+		filepath.Join(espDir, systemdBootInstallDir, "systemd-boot"+efiArch+".efi"),
+		filepath.Join(espDir, efiFallbackBootDir, "BOOT"+strings.ToUpper(efiArch)+".EFI"),
+	}
+
+	for _, targetPath := range systemdBootTargetPaths {
+		err = file.Copy(systemdBootSourcePath, targetPath)
+		if err != nil {
+			return fmt.Errorf("failed to install systemd-boot binary (%s):\n%w", targetPath, err)
+		}
+	}
+
+	entryNames := []string(nil)
+	for _, kernelVersion := range kernelVersions {
+		entryName, err := addSystemdBootEntry(rootDir, espDir, distro, kernelVersion, strings.Join(cmdline, " "))
+		if err != nil {
+			return fmt.Errorf("failed to add systemd-boot entry for kernel (%s):\n%w", kernelVersion, err)
+		}
+
+		entryNames = append(entryNames, entryName)
+	}
+
+	// Boot the newest kernel by default.
+	loaderConf := systemdBootLoaderConfContents(entryNames[len(entryNames)-1])
+
+	err = writeEspFile(loaderConf, filepath.Join(espDir, loaderConfPath))
+	if err != nil {
+		return fmt.Errorf("failed to write systemd-boot loader config:\n%w", err)
+	}
+
+	return nil
+}
+
+// addSystemdBootEntry copies a kernel and its initramfs to the EFI system partition and writes its Boot Loader
+// Specification entry. The name of the entry is returned.
+func addSystemdBootEntry(rootDir string, espDir string, distro *systemdependency.Distro, kernelVersion string,
+	cmdline string,
+) (string, error) {
+	vmlinuzPath := filepath.Join(rootDir, bootDir, vmlinuzPrefix+kernelVersion)
+
+	initramfsPath := ""
+	for _, fileName := range kernelInitramfsFileNames(kernelVersion) {
+		candidatePath := filepath.Join(rootDir, bootDir, fileName)
+
+		exists, err := file.PathExists(candidatePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to check if (%s) exists:\n%w", candidatePath, err)
+		}
+
+		if exists {
+			initramfsPath = candidatePath
+			break
+		}
+	}
+
+	if initramfsPath == "" {
+		return "", fmt.Errorf("failed to find initramfs of kernel (%s)", kernelVersion)
+	}
+
+	// The kernel files are placed in a per-kernel directory, like kernel-install does.
+	kernelDir := path.Join("/", distro.ID, kernelVersion)
+
+	err := file.Copy(vmlinuzPath, filepath.Join(espDir, kernelDir, systemdBootLinuxFileName))
+	if err != nil {
+		return "", fmt.Errorf("failed to copy kernel to EFI system partition:\n%w", err)
+	}
+
+	err = file.Copy(initramfsPath, filepath.Join(espDir, kernelDir, systemdBootInitrdFileName))
+	if err != nil {
+		return "", fmt.Errorf("failed to copy initramfs to EFI system partition:\n%w", err)
+	}
+
+	entryName := fmt.Sprintf("%s-%s.conf", distro.ID, kernelVersion)
+	entry := systemdBootEntryContents(distro, kernelVersion, kernelDir, cmdline)
+
+	err = writeEspFile(entry, filepath.Join(espDir, bootLoaderEntriesDir, entryName))
+	if err != nil {
+		return "", fmt.Errorf("failed to write systemd-boot entry (%s):\n%w", entryName, err)
+	}
+
+	return entryName, nil
+}
+
+// systemdBootEntryContents returns the Boot Loader Specification entry of a kernel. 'kernelDir' is the kernel's
+// directory, relative to the root of the EFI system partition.
+func systemdBootEntryContents(distro *systemdependency.Distro, kernelVersion string, kernelDir string,
+	cmdline string,
+) string {
+	title := strings.TrimSpace(distro.ID + " " + distro.VersionID)
+
+	lines := []string{
+		fmt.Sprintf("title %s (%s)", title, kernelVersion),
+		fmt.Sprintf("version %s", kernelVersion),
+		fmt.Sprintf("linux %s", path.Join(kernelDir, systemdBootLinuxFileName)),
+		fmt.Sprintf("initrd %s", path.Join(kernelDir, systemdBootInitrdFileName)),
+		fmt.Sprintf("options %s", cmdline),
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// systemdBootLoaderConfContents returns the systemd-boot loader config, which selects the default entry.
+func systemdBootLoaderConfContents(defaultEntryName string) string {
+	lines := []string{
+		fmt.Sprintf("default %s", defaultEntryName),
+		// Match the grub config, which boots the default entry without showing the menu.
+		"timeout 0",
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// sortKernelVersions orders the kernel versions from oldest to newest.
+func sortKernelVersions(kernelVersions []string) {
+	sort.Slice(kernelVersions, func(i, j int) bool {
+		result := versioncompare.New(kernelVersions[i]).Compare(versioncompare.New(kernelVersions[j]))
+		if result != versioncompare.EqualTo {
+			return result == versioncompare.LessThan
+		}
+
+		return kernelVersions[i] < kernelVersions[j]
+	})
+}
+
+// systemdBootEfiArch returns the architecture suffix that the systemd-boot EFI binaries use.
+func systemdBootEfiArch(goArch string) (string, error) {
+	switch goArch {
+	case "amd64":
+		return "x64", nil
+
+	case "arm64":
+		return "aa64", nil
+
+	default:
+		return "", fmt.Errorf("systemd-boot is not supported on architecture (%s)", goArch)
+	}
+}
+
+// findEspDir returns the host path of the directory that the image's EFI system partition is mounted at.
+func findEspDir(rootDir string) (string, error) {
+	for _, espDir := range espDirs {
+		efiDirPath := filepath.Join(rootDir, espDir, "EFI")
+
+		exists, err := file.DirExists(efiDirPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to check if (%s) exists:\n%w", efiDirPath, err)
+		}
+
+		if exists {
+			return filepath.Join(rootDir, espDir), nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to find EFI system partition (i.e. a directory with an 'EFI' sub-directory in: %s)",
+		strings.Join(espDirs, ", "))
+}
+
+func writeEspFile(contents string, filePath string) error {
+	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create directory (%s):\n%w", filepath.Dir(filePath), err)
+	}
+
+	err = file.Write(contents, filePath)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateSystemdBootDependencies(imageChroot *safechroot.Chroot) error {
+	requiredRpms := []string{"systemd-boot"}
+
+	for _, pkg := range requiredRpms {
+		logger.Log.Debugf("Checking if package (%s) is installed", pkg)
+		if !isPackageInstalled(imageChroot, pkg) {
+			return fmt.Errorf("package (%s) is not installed:\nthe following packages must be installed to use "+
+				"systemd-boot: %v", pkg, requiredRpms)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdBootEntryContents(t *testing.T) {
+	distro := &systemdependency.Distro{ID: "azurelinux", VersionID: "3.0"}
+
+	entry := systemdBootEntryContents(distro, "6.6.47.1-1.azl3", "/azurelinux/6.6.47.1-1.azl3",
+		"root=PARTUUID=1234 ro console=ttyS0")
+	assert.Equal(t, "title azurelinux 3.0 (6.6.47.1-1.azl3)\n"+
+		"version 6.6.47.1-1.azl3\n"+
+		"linux /azurelinux/6.6.47.1-1.azl3/linux\n"+
+		"initrd /azurelinux/6.6.47.1-1.azl3/initrd\n"+
+		"options root=PARTUUID=1234 ro console=ttyS0\n", entry)
+
+	assert.Equal(t, "default azurelinux-6.6.47.1-1.azl3.conf\ntimeout 0\n",
+		systemdBootLoaderConfContents("azurelinux-6.6.47.1-1.azl3.conf"))
+}
+
+func TestSortKernelVersions(t *testing.T) {
+	kernelVersions := []string{"6.6.47.1-1.azl3", "6.6.9.1-1.azl3", "6.6.47.1-2.azl3"}
+	sortKernelVersions(kernelVersions)
+	assert.Equal(t, []string{"6.6.9.1-1.azl3", "6.6.47.1-1.azl3", "6.6.47.1-2.azl3"}, kernelVersions)
+}
+
+func TestSystemdBootEfiArch(t *testing.T) {
+	efiArch, err := systemdBootEfiArch("amd64")
+	assert.NoError(t, err)
+	assert.Equal(t, "x64", efiArch)
+
+	efiArch, err = systemdBootEfiArch("arm64")
+	assert.NoError(t, err)
+	assert.Equal(t, "aa64", efiArch)
+
+	_, err = systemdBootEfiArch("riscv64")
+	assert.ErrorContains(t, err, "systemd-boot is not supported on architecture (riscv64)")
+}
+
+func TestAddSystemdBootEntry(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelVersion := "6.6.47.1-1.azl3"
+
+	err := os.MkdirAll(filepath.Join(rootDir, "boot/efi/EFI"), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = file.Write("kernel", filepath.Join(rootDir, "boot", "vmlinuz-"+kernelVersion))
+	assert.NoError(t, err)
+
+	espDir, err := findEspDir(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(rootDir, "boot/efi"), espDir)
+
+	distro := &systemdependency.Distro{ID: "azurelinux", VersionID: "3.0"}
+
+	_, err = addSystemdBootEntry(rootDir, espDir, distro, kernelVersion, "ro")
+	assert.ErrorContains(t, err, "failed to find initramfs of kernel (6.6.47.1-1.azl3)")
+
+	err = file.Write("initramfs", filepath.Join(rootDir, "boot", "initramfs-"+kernelVersion+".img"))
+	assert.NoError(t, err)
+
+	entryName, err := addSystemdBootEntry(rootDir, espDir, distro, kernelVersion, "ro")
+	assert.NoError(t, err)
+	assert.Equal(t, "azurelinux-6.6.47.1-1.azl3.conf", entryName)
+
+	for _, espFile := range []string{"azurelinux/6.6.47.1-1.azl3/linux", "azurelinux/6.6.47.1-1.azl3/initrd",
+		"loader/entries/azurelinux-6.6.47.1-1.azl3.conf"} {
+		assert.FileExists(t, filepath.Join(espDir, espFile))
+	}
+
+	bootloader, err := detectBootloader(filepath.Join(rootDir, "noboot"))
+	assert.NoError(t, err)
+	assert.Equal(t, BootloaderUnknown, bootloader)
+
+	bootloader, err = detectBootloader(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, BootloaderSystemdBoot, bootloader)
+}
+
+func TestFindEspDirMissing(t *testing.T) {
+	_, err := findEspDir(t.TempDir())
+	assert.ErrorContains(t, err, "failed to find EFI system partition")
+}
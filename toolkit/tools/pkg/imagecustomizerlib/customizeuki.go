@@ -0,0 +1,304 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/imagegen/diskutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safeloopback"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safemount"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+const (
+	ukiStagingDirName  = "ukistaging"
+	ukiBootRootDirName = "ukiroot"
+
+	// The names of the files within the UKI staging directory.
+	ukiStagedLinuxFileName     = "linux"
+	ukiStagedInitrdFileName    = "initrd"
+	ukiStagedOsReleaseFileName = "os-release"
+	ukiStagedStubFileName      = "stub.efi"
+	ukiStagedUnameFileName     = "uname"
+)
+
+// stageUkiInputs copies the files that make up the UKI out of the image. The UKI itself is built after the image's
+// partitions are finalized (e.g. verity's root hash is known), since the kernel command line is embedded in it.
+func stageUkiInputs(uki *imagecustomizerapi.Uki, buildDir string, imageChroot *safechroot.Chroot) error {
+	if uki == nil {
+		return nil
+	}
+
+	logger.Log.Infof("Staging UKI files")
+
+	err := validateUkiDependencies(imageChroot)
+	if err != nil {
+		return fmt.Errorf("failed to validate package dependencies for UKI:\n%w", err)
+	}
+
+	targetKernel, err := DefaultInitramfsTargetKernel(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	bootSet, err := GetKernelBootSet(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	kernel, err := selectUkiKernel(bootSet, targetKernel.String())
+	if err != nil {
+		return err
+	}
+
+	stubPath, err := ukiStubPath(runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+
+	stagingDir := filepath.Join(buildDir, ukiStagingDirName)
+	err = os.RemoveAll(stagingDir)
+	if err != nil {
+		return fmt.Errorf("failed to clean UKI staging directory:\n%w", err)
+	}
+
+	err = os.MkdirAll(stagingDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create UKI staging directory:\n%w", err)
+	}
+
+	stagedFiles := map[string]string{
+		kernel.Vmlinuz:    ukiStagedLinuxFileName,
+		kernel.Initramfs:  ukiStagedInitrdFileName,
+		"/etc/os-release": ukiStagedOsReleaseFileName,
+		stubPath:          ukiStagedStubFileName,
+	}
+
+	for imagePath, stagedFileName := range stagedFiles {
+		err = file.Copy(filepath.Join(imageChroot.RootDir(), imagePath), filepath.Join(stagingDir, stagedFileName))
+		if err != nil {
+			return fmt.Errorf("failed to stage UKI file (%s):\n%w", imagePath, err)
+		}
+	}
+
+	err = file.Write(kernel.Version, filepath.Join(stagingDir, ukiStagedUnameFileName))
+	if err != nil {
+		return fmt.Errorf("failed to stage UKI kernel release:\n%w", err)
+	}
+
+	return nil
+}
+
+// ukiStubPath returns the path of the systemd-boot EFI stub that the UKI's sections are added to.
+func ukiStubPath(goArch string) (string, error) {
+	efiArch, err := systemdBootEfiArch(goArch)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(systemdBootEfiDir, "linux"+efiArch+".efi.stub"), nil
+}
+
+// selectUkiKernel returns the boot artifacts of 'targetKernel', which is the kernel that the initramfs tooling
+// targets. The UKI is built from the same kernel, so that it bundles the initramfs that was generated for it.
+func selectUkiKernel(bootSet []KernelBootArtifacts, targetKernel string) (KernelBootArtifacts, error) {
+	for _, kernel := range bootSet {
+		if kernel.Version != targetKernel {
+			continue
+		}
+
+		if kernel.Vmlinuz == "" || kernel.Initramfs == "" {
+			return KernelBootArtifacts{}, fmt.Errorf("kernel (%s) is missing a kernel binary or an initramfs in "+
+				"/boot to build the UKI from", targetKernel)
+		}
+
+		return kernel, nil
+	}
+
+	return KernelBootArtifacts{}, fmt.Errorf("failed to find the boot files of kernel (%s) to build the UKI from",
+		targetKernel)
+}
+
+func validateUkiDependencies(imageChroot *safechroot.Chroot) error {
+	requiredRpms := []string{"systemd-boot"}
+
+	for _, pkg := range requiredRpms {
+		logger.Log.Debugf("Checking if package (%s) is installed", pkg)
+		if !isPackageInstalled(imageChroot, pkg) {
+			return fmt.Errorf("package (%s) is not installed:\nthe following packages must be installed to use "+
+				"UKI: %v", pkg, requiredRpms)
+		}
+	}
+
+	return nil
+}
+
+// customizeUkiImageHelper builds the UKI from the staged files and the image's final kernel command line and writes
+// it to the EFI system partition.
+func customizeUkiImageHelper(buildDir string, baseConfigPath string, uki *imagecustomizerapi.Uki,
+	buildImageFile string,
+) error {
+	logger.Log.Infof("Creating UKI")
+
+	stagingDir := filepath.Join(buildDir, ukiStagingDirName)
+	defer os.RemoveAll(stagingDir)
+
+	loopback, err := safeloopback.NewLoopback(buildImageFile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to image file to create UKI:\n%w", err)
+	}
+	defer loopback.Close()
+
+	diskPartitions, err := diskutils.GetDiskPartitions(loopback.DevicePath())
+	if err != nil {
+		return err
+	}
+
+	systemBootPartition, err := findSystemBootPartition(diskPartitions)
+	if err != nil {
+		return err
+	}
+
+	if systemBootPartition.PartitionTypeUuid != diskutils.EfiSystemPartitionTypeUuid {
+		return fmt.Errorf("UKI requires an EFI system partition")
+	}
+
+	bootPartition, err := findBootPartitionFromEsp(systemBootPartition, diskPartitions, buildDir)
+	if err != nil {
+		return err
+	}
+
+	cmdline, err := readUkiKernelCmdline(bootPartition, buildDir)
+	if err != nil {
+		return err
+	}
+
+	kernelRelease, err := file.Read(filepath.Join(stagingDir, ukiStagedUnameFileName))
+	if err != nil {
+		return fmt.Errorf("failed to read staged UKI kernel release:\n%w", err)
+	}
+
+	distro, err := systemdependency.ReadDistroFromOsRelease(filepath.Join(stagingDir, ukiStagedOsReleaseFileName))
+	if err != nil {
+		return err
+	}
+
+	espMountDir := filepath.Join(buildDir, tmpParitionDirName)
+	espMount, err := safemount.NewMount(systemBootPartition.Path, espMountDir, systemBootPartition.FileSystemType, 0,
+		"", true)
+	if err != nil {
+		return fmt.Errorf("failed to mount EFI system partition:\n%w", err)
+	}
+	defer espMount.Close()
+
+	ukiPath := filepath.Join(espMountDir, ukiDir, ukiFileName(distro.ID, kernelRelease))
+	err = os.MkdirAll(filepath.Dir(ukiPath), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create UKI directory:\n%w", err)
+	}
+
+	err = shell.ExecuteLive(true /*squashErrors*/, "ukify", ukifyBuildArgs(stagingDir, kernelRelease, cmdline,
+		uki.Signing, baseConfigPath, ukiPath)...)
+	if err != nil {
+		return fmt.Errorf("failed to build UKI:\n%w", err)
+	}
+
+	// Sanity check the UKI.
+	info, err := readUki(ukiPath)
+	if err != nil {
+		return err
+	}
+
+	if info.KernelRelease != kernelRelease || !info.HasInitrd {
+		return fmt.Errorf("built UKI (%s) doesn't have the expected kernel (%s) and initramfs", ukiPath,
+			kernelRelease)
+	}
+
+	err = espMount.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	err = loopback.CleanClose()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readUkiKernelCmdline returns the default kernel command line from the grub config on the boot partition.
+func readUkiKernelCmdline(bootPartition *diskutils.PartitionInfo, buildDir string) (string, error) {
+	// Mount the partition at /boot of a fake root directory, so that the grub config's paths can be resolved.
+	rootDir := filepath.Join(buildDir, ukiBootRootDirName)
+	bootMountDir := filepath.Join(rootDir, "boot")
+	bootMount, err := safemount.NewMount(bootPartition.Path, bootMountDir, bootPartition.FileSystemType, 0, "", true)
+	if err != nil {
+		return "", fmt.Errorf("failed to mount boot partition (%s):\n%w", bootPartition.Path, err)
+	}
+	defer bootMount.Close()
+
+	grubCfgPath, err := findGrubCfg(rootDir)
+	if err != nil {
+		return "", err
+	}
+
+	if grubCfgPath == "" {
+		// The boot partition is the root partition.
+		rootDir = bootMountDir
+	}
+
+	args, err := getDefaultKernelCmdline(rootDir)
+	if err != nil {
+		return "", err
+	}
+
+	err = bootMount.CleanClose()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(args, " "), nil
+}
+
+// ukiFileName returns the file name of the UKI, following the Boot Loader Specification's naming convention.
+func ukiFileName(distroId string, kernelRelease string) string {
+	return fmt.Sprintf("%s-%s%s", distroId, kernelRelease, ukiFileExtension)
+}
+
+// ukifyBuildArgs returns the ukify args that build the UKI from the staged files.
+func ukifyBuildArgs(stagingDir string, kernelRelease string, cmdline string, signing *imagecustomizerapi.UkiSigning,
+	baseConfigPath string, ukiPath string,
+) []string {
+	args := []string{
+		"build",
+		"--linux=" + filepath.Join(stagingDir, ukiStagedLinuxFileName),
+		"--initrd=" + filepath.Join(stagingDir, ukiStagedInitrdFileName),
+		"--os-release=@" + filepath.Join(stagingDir, ukiStagedOsReleaseFileName),
+		"--stub=" + filepath.Join(stagingDir, ukiStagedStubFileName),
+		"--uname=" + kernelRelease,
+		"--cmdline=" + cmdline,
+	}
+
+	if signing != nil {
+		args = append(args,
+			"--signtool=sbsign",
+			"--secureboot-private-key="+file.GetAbsPathWithBase(baseConfigPath, signing.KeyFile),
+			"--secureboot-certificate="+file.GetAbsPathWithBase(baseConfigPath, signing.CertificateFile),
+		)
+	}
+
+	args = append(args, "--output="+ukiPath)
+	return args
+}
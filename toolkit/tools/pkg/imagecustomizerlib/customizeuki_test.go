@@ -0,0 +1,81 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectUkiKernel(t *testing.T) {
+	bootSet := []KernelBootArtifacts{
+		{
+			Version:   "6.6.47.1-1.azl3",
+			Vmlinuz:   "/boot/vmlinuz-6.6.47.1-1.azl3",
+			Initramfs: "/boot/initramfs-6.6.47.1-1.azl3.img",
+		},
+		{
+			// Newer kernel whose initramfs hasn't been generated.
+			Version: "6.6.51.1-1.azl3",
+			Vmlinuz: "/boot/vmlinuz-6.6.51.1-1.azl3",
+		},
+	}
+
+	kernel, err := selectUkiKernel(bootSet, "6.6.47.1-1.azl3")
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.47.1-1.azl3", kernel.Version)
+
+	_, err = selectUkiKernel(bootSet, "6.6.51.1-1.azl3")
+	assert.ErrorContains(t, err, "kernel (6.6.51.1-1.azl3) is missing a kernel binary or an initramfs")
+
+	_, err = selectUkiKernel(bootSet, "6.6.57.1-1.azl3")
+	assert.ErrorContains(t, err, "failed to find the boot files of kernel (6.6.57.1-1.azl3)")
+}
+
+func TestUkiStubPath(t *testing.T) {
+	stubPath, err := ukiStubPath("amd64")
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/lib/systemd/boot/efi/linuxx64.efi.stub", stubPath)
+
+	stubPath, err = ukiStubPath("arm64")
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/lib/systemd/boot/efi/linuxaa64.efi.stub", stubPath)
+
+	_, err = ukiStubPath("riscv64")
+	assert.ErrorContains(t, err, "systemd-boot is not supported on architecture (riscv64)")
+}
+
+func TestUkiFileName(t *testing.T) {
+	assert.Equal(t, "azurelinux-6.6.47.1-1.azl3.efi", ukiFileName("azurelinux", "6.6.47.1-1.azl3"))
+}
+
+func TestUkifyBuildArgs(t *testing.T) {
+	args := ukifyBuildArgs("/build/ukistaging", "6.6.47.1-1.azl3", "root=PARTUUID=2222 ro", nil, "/config",
+		"/esp/EFI/Linux/azurelinux-6.6.47.1-1.azl3.efi")
+	assert.Equal(t, []string{
+		"build",
+		"--linux=/build/ukistaging/linux",
+		"--initrd=/build/ukistaging/initrd",
+		"--os-release=@/build/ukistaging/os-release",
+		"--stub=/build/ukistaging/stub.efi",
+		"--uname=6.6.47.1-1.azl3",
+		"--cmdline=root=PARTUUID=2222 ro",
+		"--output=/esp/EFI/Linux/azurelinux-6.6.47.1-1.azl3.efi",
+	}, args)
+
+	signing := &imagecustomizerapi.UkiSigning{
+		KeyFile:         "files/db.key",
+		CertificateFile: "/keys/db.crt",
+	}
+
+	args = ukifyBuildArgs("/build/ukistaging", "6.6.47.1-1.azl3", "ro", signing, "/config", "/esp/uki.efi")
+	assert.Equal(t, []string{
+		"--signtool=sbsign",
+		"--secureboot-private-key=/config/files/db.key",
+		"--secureboot-certificate=/keys/db.crt",
+		"--output=/esp/uki.efi",
+	}, args[7:])
+}
@@ -0,0 +1,530 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/rpm"
+	"gopkg.in/ini.v1"
+)
+
+// Characters that only appear in package specs that are capabilities (e.g. "/usr/bin/vim" or "pkgconfig(zlib)") or
+// globs, which can't be resolved from RPM file names.
+const packageSpecCapabilityChars = "/()<>=*?[]"
+
+// DryRunImageWithConfigFile validates the config file and the command-line args, and logs the customizations that
+// CustomizeImageWithConfigFile would apply. The base image isn't modified or even opened.
+func DryRunImageWithConfigFile(buildDir string, configFile string, imageFile string,
+	rpmsSources []string, outputImageFile string, outputImageFormat string,
+	outputSplitPartitionsFormat string, outputPXEArtifactsDir string,
+	useBaseImageRpmRepos bool, enableShrinkFilesystems bool,
+) error {
+	return DryRunImageWithConfigFileOptions(buildDir, configFile, ConfigFileOptions{}, imageFile, rpmsSources,
+		outputImageFile, outputImageFormat, outputSplitPartitionsFormat, outputPXEArtifactsDir, useBaseImageRpmRepos,
+		enableShrinkFilesystems)
+}
+
+// DryRunImageWithConfigFileOptions is DryRunImageWithConfigFile with options (e.g. config variables) for how the
+// config file is loaded.
+func DryRunImageWithConfigFileOptions(buildDir string, configFile string, configFileOptions ConfigFileOptions,
+	imageFile string, rpmsSources []string, outputImageFile string, outputImageFormat string,
+	outputSplitPartitionsFormat string, outputPXEArtifactsDir string,
+	useBaseImageRpmRepos bool, enableShrinkFilesystems bool,
+) error {
+	var err error
+
+	config, absBaseConfigPath, err := loadConfigFile(configFile, configFileOptions)
+	if err != nil {
+		return err
+	}
+
+	err = DryRunImage(buildDir, absBaseConfigPath, config, imageFile, rpmsSources, outputImageFile, outputImageFormat,
+		outputSplitPartitionsFormat, outputPXEArtifactsDir, useBaseImageRpmRepos, enableShrinkFilesystems)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DryRunImage runs all the checks that CustomizeImage runs before it opens the base image, resolves the packages to
+// install against the local RPM sources, and logs the plan of customizations.
+func DryRunImage(buildDir string, baseConfigPath string, config *imagecustomizerapi.Config, imageFile string,
+	rpmsSources []string, outputImageFile string, outputImageFormat string, outputSplitPartitionsFormat string,
+	outputPXEArtifactsDir string, useBaseImageRpmRepos bool, enableShrinkFilesystems bool,
+) error {
+	err := validateConfig(baseConfigPath, config, rpmsSources, useBaseImageRpmRepos)
+	if err != nil {
+		return fmt.Errorf("invalid image config:\n%w", err)
+	}
+
+	ic, err := createImageCustomizerParameters(buildDir, imageFile, baseConfigPath, config,
+		useBaseImageRpmRepos, rpmsSources, enableShrinkFilesystems, outputSplitPartitionsFormat,
+		outputImageFormat, outputImageFile, outputPXEArtifactsDir)
+	if err != nil {
+		return fmt.Errorf("failed to create image customizer parameters object:\n%w", err)
+	}
+
+	// Note: checkEnvironmentVars() is skipped, since a dry run doesn't need to run as root.
+	isFile, err := file.IsFile(imageFile)
+	if err != nil {
+		return fmt.Errorf("invalid image file (%s):\n%w", imageFile, err)
+	}
+
+	if !isFile {
+		return fmt.Errorf("invalid image file (%s):\nnot a file", imageFile)
+	}
+
+	if config.OS != nil {
+		err = checkPackagesResolvable(baseConfigPath, config.OS, rpmsSources, useBaseImageRpmRepos)
+		if err != nil {
+			return err
+		}
+	}
+
+	plan, err := dryRunPlan(ic)
+	if err != nil {
+		return err
+	}
+
+	logger.Log.Infof("Dry run plan:")
+	for _, line := range plan {
+		logger.Log.Infof("  %s", line)
+	}
+
+	logger.Log.Infof("Dry run succeeded")
+
+	return nil
+}
+
+// checkPackagesResolvable checks that each of the packages to install is provided by one of the RPM sources.
+//
+// The RPM sources are checked offline. So, only directories of RPMs and repos whose baseurl is a local directory are
+// checked. If any of the packages might be provided by a remote repo or by the base image's repos, then the packages
+// that aren't found are only reported as warnings.
+func checkPackagesResolvable(baseConfigPath string, config *imagecustomizerapi.OS, rpmsSources []string,
+	useBaseImageRpmRepos bool,
+) error {
+	allPackagesInstall, err := collectPackagesList(baseConfigPath, config.Packages.InstallLists,
+		config.Packages.Install)
+	if err != nil {
+		return err
+	}
+
+	if len(allPackagesInstall) <= 0 {
+		return nil
+	}
+
+	packageNames, allSourcesLocal, err := getLocalRpmSourcesPackageNames(rpmsSources)
+	if err != nil {
+		return err
+	}
+
+	if useBaseImageRpmRepos {
+		allSourcesLocal = false
+	}
+
+	unresolvedPackages := []string(nil)
+	for _, packageSpec := range allPackagesInstall {
+		if strings.ContainsAny(packageSpec, packageSpecCapabilityChars) {
+			logger.Log.Debugf("Can't resolve package (%s) from RPM file names", packageSpec)
+			continue
+		}
+
+		if !packageSpecMatches(packageSpec, packageNames) {
+			unresolvedPackages = append(unresolvedPackages, packageSpec)
+		}
+	}
+
+	if len(unresolvedPackages) <= 0 {
+		return nil
+	}
+
+	if !allSourcesLocal {
+		logger.Log.Warnf("Packages not found in the local RPM sources (they may be provided by a remote or the base "+
+			"image's repo): %v", unresolvedPackages)
+		return nil
+	}
+
+	return fmt.Errorf("packages not found in the RPM sources: %v", unresolvedPackages)
+}
+
+// getLocalRpmSourcesPackageNames returns the names of the packages in the RPM sources that are on the build host.
+// Also returns whether all the RPM sources are on the build host.
+func getLocalRpmSourcesPackageNames(rpmsSources []string) (map[string]bool, bool, error) {
+	packageNames := make(map[string]bool)
+	allSourcesLocal := true
+
+	for _, rpmSource := range rpmsSources {
+		fileType, err := getRpmSourceFileType(rpmSource)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get RPM source file type (%s):\n%w", rpmSource, err)
+		}
+
+		switch fileType {
+		case "dir":
+			err = addRpmDirPackageNames(rpmSource, packageNames)
+			if err != nil {
+				return nil, false, err
+			}
+
+		case "repo":
+			repoDirs, hasRemoteRepos, err := getRepoConfigLocalDirs(rpmSource)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if hasRemoteRepos {
+				allSourcesLocal = false
+			}
+
+			for _, repoDir := range repoDirs {
+				err = addRpmDirPackageNames(repoDir, packageNames)
+				if err != nil {
+					return nil, false, err
+				}
+			}
+
+		default:
+			return nil, false, fmt.Errorf("unknown RPM source type (%s):\nmust be a .repo file or a directory",
+				rpmSource)
+		}
+	}
+
+	return packageNames, allSourcesLocal, nil
+}
+
+// getRepoConfigLocalDirs returns the local directories of the repos in a repo config file. Also returns whether any
+// of the repos are remote.
+func getRepoConfigLocalDirs(repoConfigPath string) ([]string, bool, error) {
+	reposConfig, err := ini.Load(repoConfigPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load repo config file (%s):\n%w", repoConfigPath, err)
+	}
+
+	repoDirs := []string(nil)
+	hasRemoteRepos := false
+	for _, repoConfig := range reposConfig.Sections() {
+		if repoConfig.Name() == ini.DefaultSection {
+			continue
+		}
+
+		baseurl := repoConfig.Key("baseurl").String()
+		repoDir, hasFilePrefix := strings.CutPrefix(baseurl, "file://")
+		if !hasFilePrefix {
+			hasRemoteRepos = true
+			continue
+		}
+
+		repoDirs = append(repoDirs, repoDir)
+	}
+
+	return repoDirs, hasRemoteRepos, nil
+}
+
+// addRpmDirPackageNames adds the names of the RPM files in a directory, including its sub-directories.
+func addRpmDirPackageNames(rpmsDir string, packageNames map[string]bool) error {
+	err := filepath.WalkDir(rpmsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".rpm") || strings.HasSuffix(d.Name(), ".src.rpm") {
+			return nil
+		}
+
+		packageName, err := rpm.ExtractNameFromRPMPath(path)
+		if err != nil {
+			logger.Log.Debugf("Skipping RPM file (%s):\n%s", path, err)
+			return nil
+		}
+
+		packageNames[packageName] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read RPMs directory (%s):\n%w", rpmsDir, err)
+	}
+
+	return nil
+}
+
+// packageSpecMatches returns whether a package spec matches one of the package names. Besides a plain name, tdnf
+// accepts a name followed by a version (e.g. "kernel-6.6.47.1-1.azl3") and a name followed by an arch (e.g.
+// "bash.x86_64").
+func packageSpecMatches(packageSpec string, packageNames map[string]bool) bool {
+	if packageNames[packageSpec] {
+		return true
+	}
+
+	for i := 1; i < len(packageSpec)-1; i++ {
+		separator := packageSpec[i]
+		if separator != '-' && separator != '.' {
+			continue
+		}
+
+		if !packageNames[packageSpec[:i]] {
+			continue
+		}
+
+		suffix := packageSpec[i+1:]
+		switch {
+		case separator == '-' && unicode.IsDigit(rune(suffix[0])):
+			return true
+
+		case separator == '.' && isRpmArch(suffix):
+			return true
+		}
+	}
+
+	return false
+}
+
+func isRpmArch(arch string) bool {
+	switch arch {
+	case "x86_64", "aarch64", "noarch", "i686":
+		return true
+
+	default:
+		return false
+	}
+}
+
+// dryRunPlan returns the customizations that will be applied, in the order that they are applied. Sub-items are
+// indented.
+func dryRunPlan(ic *ImageCustomizerParameters) ([]string, error) {
+	config := ic.config
+	osConfig := config.OS
+	if osConfig == nil {
+		osConfig = &imagecustomizerapi.OS{}
+	}
+
+	plan := []string(nil)
+	addStep := func(format string, args ...any) {
+		plan = append(plan, fmt.Sprintf(format, args...))
+	}
+
+	addStep("Convert the base image (%s) to a writeable raw image", ic.inputImageFile)
+
+	if !ic.customizeOSPartitions {
+		if ic.inputIsIso {
+			addStep("Keep the base iso's OS unchanged")
+		}
+	} else {
+		if config.CustomizePartitions() {
+			addStep("Create a new %s boot disk and copy the base image's files into it", config.Storage.BootType)
+			for _, disk := range config.Storage.Disks {
+				addStep("  Disk: %s partition table, size %s", disk.PartitionTableType, disk.MaxSize.HumanReadable())
+				for _, partition := range disk.Partitions {
+					addStep("    Partition (%s): %s", partition.Id, dryRunPartitionRange(partition))
+				}
+			}
+
+			for _, fileSystem := range config.Storage.FileSystems {
+				mountPath := ""
+				if fileSystem.MountPoint != nil {
+					mountPath = ", mounted at " + fileSystem.MountPoint.Path
+				}
+
+				addStep("  Filesystem (%s): %s%s", fileSystem.DeviceId, fileSystem.Type, mountPath)
+			}
+		}
+
+		if config.Storage.ResetPartitionsUuidsType != imagecustomizerapi.ResetPartitionsUuidsTypeDefault {
+			addStep("Reset the partition UUIDs (%s)", config.Storage.ResetPartitionsUuidsType)
+		}
+
+		allPackagesRemove, err := collectPackagesList(ic.configPath, osConfig.Packages.RemoveLists,
+			osConfig.Packages.Remove)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(allPackagesRemove) > 0 {
+			addStep("Remove packages: %s", strings.Join(allPackagesRemove, ", "))
+		}
+
+		if osConfig.Packages.UpdateExistingPackages {
+			addStep("Update all the installed packages")
+		}
+
+		allPackagesInstall, err := collectPackagesList(ic.configPath, osConfig.Packages.InstallLists,
+			osConfig.Packages.Install)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(allPackagesInstall) > 0 {
+			addStep("Install packages: %s", strings.Join(allPackagesInstall, ", "))
+		}
+
+		allPackagesUpdate, err := collectPackagesList(ic.configPath, osConfig.Packages.UpdateLists,
+			osConfig.Packages.Update)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(allPackagesUpdate) > 0 {
+			addStep("Update packages: %s", strings.Join(allPackagesUpdate, ", "))
+		}
+
+		if osConfig.Hostname != "" {
+			addStep("Set the hostname to (%s)", osConfig.Hostname)
+		}
+
+		for _, additionalDir := range osConfig.AdditionalDirs {
+			addStep("Copy directory (%s) to (%s)", additionalDir.Source, additionalDir.Destination)
+		}
+
+		for _, additionalFile := range osConfig.AdditionalFiles {
+			addStep("Write file (%s)", additionalFile.Destination)
+		}
+
+		for _, user := range osConfig.Users {
+			addStep("Add or update user (%s)", user.Name)
+		}
+
+		if len(osConfig.Services.Enable) > 0 {
+			addStep("Enable services: %s", strings.Join(osConfig.Services.Enable, ", "))
+		}
+
+		if len(osConfig.Services.Disable) > 0 {
+			addStep("Disable services: %s", strings.Join(osConfig.Services.Disable, ", "))
+		}
+
+		for _, module := range osConfig.Modules {
+			addStep("Configure kernel module (%s)", module.Name)
+		}
+
+		if osConfig.ResetBootLoaderType != imagecustomizerapi.ResetBootLoaderTypeDefault {
+			addStep("Reset the bootloader (%s)", osConfig.ResetBootLoaderType)
+		}
+
+		if osConfig.KernelCommandLine.ExtraCommandLine != "" {
+			addStep("Add kernel command-line args: %s", osConfig.KernelCommandLine.ExtraCommandLine)
+		}
+
+		if osConfig.SELinux.Mode != imagecustomizerapi.SELinuxModeDefault {
+			addStep("Set the SELinux mode to (%s)", osConfig.SELinux.Mode)
+		}
+
+		if osConfig.Overlays != nil {
+			for _, overlay := range *osConfig.Overlays {
+				addStep("Add overlay mounted at (%s)", overlay.MountPoint)
+			}
+		}
+
+		for _, verity := range config.Storage.Verity {
+			addStep("Enable verity device (%s) in the initramfs", verity.Name)
+		}
+
+		for _, encryption := range config.Storage.Encryption {
+			addStep("Enable encrypted device (%s) in the initramfs", encryption.Name)
+		}
+
+		for _, raid := range config.Storage.Raid {
+			addStep("Enable RAID array (%s) in the initramfs", raid.Name)
+		}
+
+		for _, volumeGroup := range config.Storage.VolumeGroups {
+			addStep("Enable LVM volume group (%s) in the initramfs", volumeGroup.Name)
+		}
+
+		if osConfig.BootLoader == imagecustomizerapi.BootLoaderTypeSystemdBoot {
+			addStep("Install systemd-boot")
+		}
+
+		for _, script := range config.Scripts.PostCustomization {
+			addStep("Run postCustomization script (%s)", dryRunScriptName(script))
+		}
+
+		for _, script := range config.Scripts.FinalizeCustomization {
+			addStep("Run finalizeCustomization script (%s)", dryRunScriptName(script))
+		}
+
+		if osConfig.TargetKernel != "" {
+			addStep("Check that the newest installed kernel matches (%s)", osConfig.TargetKernel)
+		}
+
+		if osConfig.Sbom != nil {
+			addStep("Read the installed packages for the SBOM")
+		}
+
+		if ic.enableShrinkFilesystems {
+			addStep("Shrink the filesystems")
+		}
+
+		if hasReadOnlyBtrfsSubvolumes(config.Storage.FileSystems) {
+			addStep("Make the btrfs subvolumes that are marked as readOnly read-only")
+		}
+
+		for _, verity := range config.Storage.Verity {
+			addStep("Create the verity hash tree of device (%s) on (%s)", verity.DataDeviceId, verity.HashDeviceId)
+		}
+
+		for _, encryption := range config.Storage.Encryption {
+			addStep("Encrypt device (%s) with LUKS", encryption.DeviceId)
+		}
+
+		if config.Storage.ABUpdate != nil {
+			addStep("Set up A/B update slot B on (%s)", config.Storage.ABUpdate.SlotBDeviceId)
+		}
+
+		if osConfig.Uki != nil {
+			addStep("Build the UKI")
+		}
+
+		addStep("Check the filesystems")
+
+		if ic.outputSplitPartitionsFormat != "" {
+			addStep("Extract the partitions (%s) to (%s)", ic.outputSplitPartitionsFormat, ic.outputImageDir)
+		}
+
+		if osConfig.Sbom != nil {
+			addStep("Write the %s SBOM to (%s)", osConfig.Sbom.Format,
+				filepath.Join(ic.outputImageDir, ic.outputImageBase+sbomFileExtension(osConfig.Sbom.Format)))
+		}
+	}
+
+	if ic.outputImageFormat != "" {
+		addStep("Write the %s image to (%s)", ic.outputImageFormat, ic.outputImageFile)
+	}
+
+	if ic.outputPXEArtifactsDir != "" {
+		addStep("Write the PXE artifacts to (%s)", ic.outputPXEArtifactsDir)
+	}
+
+	return plan, nil
+}
+
+func dryRunPartitionRange(partition imagecustomizerapi.Partition) string {
+	end, hasEnd := partition.GetEnd()
+	if !hasEnd {
+		return fmt.Sprintf("[%s, end of disk)", partition.Start.HumanReadable())
+	}
+
+	return fmt.Sprintf("[%s, %s), size %s", partition.Start.HumanReadable(), end.HumanReadable(),
+		(end - *partition.Start).HumanReadable())
+}
+
+func dryRunScriptName(script imagecustomizerapi.Script) string {
+	switch {
+	case script.Name != "":
+		return script.Name
+
+	case script.Path != "":
+		return script.Path
+
+	default:
+		return "inline"
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/imagecustomizerapi"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestRpmsDir(t *testing.T, rpmFileNames ...string) string {
+	rpmsDir := t.TempDir()
+	for _, rpmFileName := range rpmFileNames {
+		err := os.MkdirAll(filepath.Join(rpmsDir, filepath.Dir(rpmFileName)), os.ModePerm)
+		assert.NoError(t, err)
+
+		err = file.Write("", filepath.Join(rpmsDir, rpmFileName))
+		assert.NoError(t, err)
+	}
+	return rpmsDir
+}
+
+func TestDryRunImageWithConfigFilePartitions(t *testing.T) {
+	buildDir := t.TempDir()
+	imageFile := filepath.Join(buildDir, "base.vhdx")
+
+	err := file.Write("", imageFile)
+	assert.NoError(t, err)
+
+	err = DryRunImageWithConfigFile(buildDir, filepath.Join(testDir, "partitions-config.yaml"), imageFile, nil,
+		filepath.Join(buildDir, "out.vhdx"), "vhdx", "", "", false /*useBaseImageRpmRepos*/, false)
+	assert.NoError(t, err)
+}
+
+func TestDryRunImageMissingImageFile(t *testing.T) {
+	buildDir := t.TempDir()
+
+	err := DryRunImage(buildDir, testDir, &imagecustomizerapi.Config{}, filepath.Join(buildDir, "base.vhdx"), nil,
+		filepath.Join(buildDir, "out.vhdx"), "vhdx", "", "", false /*useBaseImageRpmRepos*/, false)
+	assert.ErrorContains(t, err, "invalid image file")
+}
+
+func TestDryRunImageInvalidParameters(t *testing.T) {
+	buildDir := t.TempDir()
+
+	err := DryRunImage(buildDir, testDir, &imagecustomizerapi.Config{}, filepath.Join(buildDir, "base.vhdx"), nil,
+		filepath.Join(buildDir, "out.vhdx"), "vhdx", "", filepath.Join(buildDir, "pxe"),
+		false /*useBaseImageRpmRepos*/, false)
+	assert.ErrorContains(t, err, "'--output-pxe-artifacts-dir') can be specified only if the output format is an iso")
+}
+
+func TestDryRunPlanPartitions(t *testing.T) {
+	var config imagecustomizerapi.Config
+	err := imagecustomizerapi.UnmarshalYamlFile(filepath.Join(testDir, "partitions-config.yaml"), &config)
+	assert.NoError(t, err)
+
+	ic, err := createImageCustomizerParameters("/build", "/base.vhdx", testDir, &config, false, nil, false, "",
+		"vhdx", "/out/image.vhdx", "")
+	assert.NoError(t, err)
+
+	plan, err := dryRunPlan(ic)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"Convert the base image (/base.vhdx) to a writeable raw image",
+		"Create a new efi boot disk and copy the base image's files into it",
+		"  Disk: gpt partition table, size 4 GiB",
+		"    Partition (esp): [1 MiB, 9 MiB), size 8 MiB",
+		"    Partition (boot): [9 MiB, 108 MiB), size 99 MiB",
+		"    Partition (rootfs): [108 MiB, 2 GiB), size 1940 MiB",
+		"    Partition (var): [2 GiB, end of disk)",
+		"  Filesystem (esp): fat32, mounted at /boot/efi",
+		"  Filesystem (boot): ext4, mounted at /boot",
+		"  Filesystem (rootfs): xfs, mounted at /",
+		"  Filesystem (var): xfs, mounted at /var",
+		"Reset the bootloader (hard-reset)",
+		"Add kernel command-line args: console=tty0 console=ttyS0",
+		"Check the filesystems",
+		"Write the vhdx image to (/out/image.vhdx)",
+	}, plan)
+}
+
+func TestCheckPackagesResolvable(t *testing.T) {
+	rpmsDir := createTestRpmsDir(t, "jq-1.7.1-1.azl3.x86_64.rpm", "sub/golang-1.22.5-2.azl3.x86_64.rpm")
+
+	config := &imagecustomizerapi.OS{
+		Packages: imagecustomizerapi.Packages{
+			InstallLists: []string{"lists/golang.yaml"},
+			Install:      []string{"jq-1.7.1", "jq.x86_64", "/usr/bin/vim"},
+		},
+	}
+
+	err := checkPackagesResolvable(testDir, config, []string{rpmsDir}, false /*useBaseImageRpmRepos*/)
+	assert.NoError(t, err)
+
+	config.Packages.Install = append(config.Packages.Install, "jqq")
+
+	err = checkPackagesResolvable(testDir, config, []string{rpmsDir}, false /*useBaseImageRpmRepos*/)
+	assert.ErrorContains(t, err, "packages not found in the RPM sources: [jqq]")
+
+	// The base image's repos can't be checked. So, unresolved packages are only a warning.
+	err = checkPackagesResolvable(testDir, config, []string{rpmsDir}, true /*useBaseImageRpmRepos*/)
+	assert.NoError(t, err)
+}
+
+func TestCheckPackagesResolvableRepoConfig(t *testing.T) {
+	rpmsDir := createTestRpmsDir(t, "jq-1.7.1-1.azl3.x86_64.rpm")
+	repoFile := filepath.Join(t.TempDir(), "local.repo")
+
+	err := file.Write("[local]\nname=local\nbaseurl=file://"+rpmsDir+"\n", repoFile)
+	assert.NoError(t, err)
+
+	config := &imagecustomizerapi.OS{
+		Packages: imagecustomizerapi.Packages{
+			Install: []string{"jq", "golang"},
+		},
+	}
+
+	err = checkPackagesResolvable(testDir, config, []string{repoFile}, false /*useBaseImageRpmRepos*/)
+	assert.ErrorContains(t, err, "packages not found in the RPM sources: [golang]")
+
+	err = file.Write("[local]\nname=local\nbaseurl=file://"+rpmsDir+"\n\n"+
+		"[remote]\nname=remote\nbaseurl=https://packages.microsoft.com/azurelinux/3.0/prod/base/x86_64\n", repoFile)
+	assert.NoError(t, err)
+
+	err = checkPackagesResolvable(testDir, config, []string{repoFile}, false /*useBaseImageRpmRepos*/)
+	assert.NoError(t, err)
+}
+
+func TestPackageSpecMatches(t *testing.T) {
+	packageNames := map[string]bool{"kernel": true, "kernel-headers": true, "python3.12": true}
+
+	assert.True(t, packageSpecMatches("kernel", packageNames))
+	assert.True(t, packageSpecMatches("kernel-6.6.47.1-1.azl3", packageNames))
+	assert.True(t, packageSpecMatches("kernel-headers-6.6.47.1", packageNames))
+	assert.True(t, packageSpecMatches("kernel.x86_64", packageNames))
+	assert.True(t, packageSpecMatches("python3.12", packageNames))
+	assert.False(t, packageSpecMatches("kernel-devel", packageNames))
+	assert.False(t, packageSpecMatches("kernel.", packageNames))
+	assert.False(t, packageSpecMatches("python3", packageNames))
+}
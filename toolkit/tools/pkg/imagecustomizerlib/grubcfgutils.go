@@ -447,8 +447,13 @@ func findKernelCommandLineArgValue(args []grubConfigLinuxArg, name string) (stri
 func replaceKernelCommandLineArgValueAll(inputGrubCfgContent string, name string, value string, allowMultiple bool,
 ) (outputGrubCfgContent string, oldValues []string, err error) {
 	newArg := fmt.Sprintf("%s=%s", name, value)
-	quotedNewArg := grub.QuoteString(newArg)
+	return replaceKernelCommandLineArgAll(inputGrubCfgContent, name, grub.QuoteString(newArg), allowMultiple)
+}
 
+// Replaces the kernel command-line arg with the provided name. 'newArgWord' is written to the grub config as is. So,
+// it may contain variable expansions (e.g. 'root=$rootdevice').
+func replaceKernelCommandLineArgAll(inputGrubCfgContent string, name string, newArgWord string, allowMultiple bool,
+) (outputGrubCfgContent string, oldValues []string, err error) {
 	lines, err := findLinuxOrInitrdLineAll(inputGrubCfgContent, linuxCommand, allowMultiple)
 	if err != nil {
 		return "", nil, err
@@ -482,7 +487,7 @@ func replaceKernelCommandLineArgValueAll(inputGrubCfgContent string, name string
 		end := arg.Token.Loc.End.Index
 
 		oldValues = append(oldValues, inputGrubCfgContent[start:end])
-		outputGrubCfgContent = outputGrubCfgContent[:start] + quotedNewArg + outputGrubCfgContent[end:]
+		outputGrubCfgContent = outputGrubCfgContent[:start] + newArgWord + outputGrubCfgContent[end:]
 	}
 
 	return outputGrubCfgContent, oldValues, nil
@@ -14,6 +14,8 @@ type ImageConnection struct {
 	loopback            *safeloopback.Loopback
 	chroot              *safechroot.Chroot
 	chrootIsExistingDir bool
+	volumeGroups        []string
+	raidArrays          []string
 }
 
 func NewImageConnection() *ImageConnection {
@@ -33,6 +35,28 @@ func (c *ImageConnection) ConnectLoopback(diskFilePath string) error {
 	return nil
 }
 
+// Assembles the RAID arrays on the loopback device, so that the filesystems on them can be mounted.
+func (c *ImageConnection) ActivateRaidArrays() error {
+	raidArrays, err := activateRaidArrays(c.loopback.DevicePath())
+	if err != nil {
+		return err
+	}
+
+	c.raidArrays = append(c.raidArrays, raidArrays...)
+	return nil
+}
+
+// Activates the volume groups on the loopback device, so that their logical volumes can be mounted.
+func (c *ImageConnection) ActivateVolumeGroups() error {
+	volumeGroups, err := activateVolumeGroups(c.loopback.DevicePath())
+	if err != nil {
+		return err
+	}
+
+	c.volumeGroups = append(c.volumeGroups, volumeGroups...)
+	return nil
+}
+
 func (c *ImageConnection) ConnectChroot(rootDir string, isExistingDir bool, extraDirectories []string,
 	extraMountPoints []*safechroot.MountPoint, includeDefaultMounts bool,
 ) error {
@@ -64,17 +88,36 @@ func (c *ImageConnection) Close() {
 		c.chroot.Close(c.chrootIsExistingDir)
 	}
 
+	deactivateVolumeGroups(c.volumeGroups)
+	deactivateRaidArrays(c.raidArrays)
+
 	if c.loopback != nil {
 		c.loopback.Close()
 	}
 }
 
 func (c *ImageConnection) CleanClose() error {
-	err := c.chroot.Close(c.chrootIsExistingDir)
+	if c.chroot != nil {
+		err := c.chroot.Close(c.chrootIsExistingDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := deactivateVolumeGroups(c.volumeGroups)
 	if err != nil {
 		return err
 	}
 
+	c.volumeGroups = nil
+
+	err = deactivateRaidArrays(c.raidArrays)
+	if err != nil {
+		return err
+	}
+
+	c.raidArrays = nil
+
 	err = c.loopback.CleanClose()
 	if err != nil {
 		return err
@@ -32,6 +32,10 @@ const (
 	ImageFormatIso      = "iso"
 	ImageFormatRaw      = "raw"
 
+	// container image formats
+	ImageFormatOci           = "oci"
+	ImageFormatDockerArchive = "docker-archive"
+
 	// qemu-specific formats
 	QemuFormatVpc = "vpc"
 
@@ -73,6 +77,7 @@ type ImageCustomizerParameters struct {
 	// output image
 	outputImageFormat     string
 	outputIsIso           bool
+	outputIsContainer     bool
 	outputImageFile       string
 	outputImageDir        string
 	outputImageBase       string
@@ -125,6 +130,7 @@ func createImageCustomizerParameters(buildDir string,
 	// output image
 	ic.outputImageFormat = outputImageFormat
 	ic.outputIsIso = ic.outputImageFormat == ImageFormatIso
+	ic.outputIsContainer = ic.outputImageFormat == ImageFormatOci || ic.outputImageFormat == ImageFormatDockerArchive
 	ic.outputImageFile = outputImageFile
 	ic.outputImageBase = strings.TrimSuffix(filepath.Base(outputImageFile), filepath.Ext(outputImageFile))
 	ic.outputImageDir = filepath.Dir(outputImageFile)
@@ -141,6 +147,39 @@ func createImageCustomizerParameters(buildDir string,
 		return nil, fmt.Errorf("the output PXE artifacts directory ('--output-pxe-artifacts-dir') can be specified only if the output format is an iso image.")
 	}
 
+	if len(config.Storage.Encryption) > 0 {
+		// The encrypted partitions are filled to the brim by the time they are encrypted. So, there is nothing to
+		// gain by shrinking them.
+		if ic.enableShrinkFilesystems {
+			return nil, fmt.Errorf("shrinking file systems is not supported when 'encryption' is specified")
+		}
+
+		// The iso's squashfs isn't encrypted. So, the encryption would silently be lost.
+		if ic.outputIsIso {
+			return nil, fmt.Errorf("generating an iso image is not supported when 'encryption' is specified")
+		}
+
+		// Likewise, the container image's layer isn't encrypted.
+		if ic.outputIsContainer {
+			return nil, fmt.Errorf("generating a container image is not supported when 'encryption' is specified")
+		}
+	}
+
+	if config.OS != nil && config.OS.Uki != nil && ic.outputIsIso {
+		// The iso has its own bootloader setup. So, the UKI would never be used.
+		return nil, fmt.Errorf("generating an iso image is not supported when 'os.uki' is specified")
+	}
+
+	if config.Storage.ABUpdate != nil && ic.outputIsIso {
+		// The iso only has a single root filesystem.
+		return nil, fmt.Errorf("generating an iso image is not supported when 'storage.abUpdate' is specified")
+	}
+
+	if config.OS != nil && config.OS.BootLoader == imagecustomizerapi.BootLoaderTypeSystemdBoot && ic.outputIsIso {
+		// The iso always boots with grub.
+		return nil, fmt.Errorf("generating an iso image is not supported when 'os.bootLoader' is 'systemd-boot'")
+	}
+
 	if ic.inputIsIso {
 		// When the input is an iso image, there's only one file system: the
 		// suqash file system and it has no empty space since it's a read-only
@@ -177,25 +216,29 @@ func CustomizeImageWithConfigFile(buildDir string, configFile string, imageFile
 	rpmsSources []string, outputImageFile string, outputImageFormat string,
 	outputSplitPartitionsFormat string, outputPXEArtifactsDir string,
 	useBaseImageRpmRepos bool, enableShrinkFilesystems bool,
+) error {
+	return CustomizeImageWithConfigFileOptions(buildDir, configFile, ConfigFileOptions{}, imageFile, rpmsSources,
+		outputImageFile, outputImageFormat, outputSplitPartitionsFormat, outputPXEArtifactsDir, useBaseImageRpmRepos,
+		enableShrinkFilesystems)
+}
+
+// CustomizeImageWithConfigFileOptions is CustomizeImageWithConfigFile with options (e.g. config variables) for how the
+// config file is loaded.
+func CustomizeImageWithConfigFileOptions(buildDir string, configFile string, configFileOptions ConfigFileOptions,
+	imageFile string, rpmsSources []string, outputImageFile string, outputImageFormat string,
+	outputSplitPartitionsFormat string, outputPXEArtifactsDir string,
+	useBaseImageRpmRepos bool, enableShrinkFilesystems bool,
 ) error {
 	var err error
 
 	logVersionsOfToolDeps()
 
-	var config imagecustomizerapi.Config
-	err = imagecustomizerapi.UnmarshalYamlFile(configFile, &config)
+	config, absBaseConfigPath, err := loadConfigFile(configFile, configFileOptions)
 	if err != nil {
 		return err
 	}
 
-	baseConfigPath, _ := filepath.Split(configFile)
-
-	absBaseConfigPath, err := filepath.Abs(baseConfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path of config file directory:\n%w", err)
-	}
-
-	err = CustomizeImage(buildDir, absBaseConfigPath, &config, imageFile, rpmsSources, outputImageFile, outputImageFormat,
+	err = CustomizeImage(buildDir, absBaseConfigPath, config, imageFile, rpmsSources, outputImageFile, outputImageFormat,
 		outputSplitPartitionsFormat, outputPXEArtifactsDir, useBaseImageRpmRepos, enableShrinkFilesystems)
 	if err != nil {
 		return err
@@ -367,9 +410,11 @@ func customizeOSContents(ic *ImageCustomizerParameters) error {
 		return err
 	}
 
+	luksUuids := createLuksUuids(ic.config.Storage.Encryption)
+
 	// Customize the raw image file.
 	err = customizeImageHelper(ic.buildDirAbs, ic.configPath, ic.config, ic.rawImageFile, ic.rpmsSources,
-		ic.useBaseImageRpmRepos, partitionsCustomized, imageUuidStr)
+		ic.useBaseImageRpmRepos, partitionsCustomized, imageUuidStr, luksUuids)
 	if err != nil {
 		return err
 	}
@@ -382,6 +427,15 @@ func customizeOSContents(ic *ImageCustomizerParameters) error {
 		}
 	}
 
+	if hasReadOnlyBtrfsSubvolumes(ic.config.Storage.FileSystems) {
+		// Make the btrfs subvolumes read-only, now that their contents are final.
+		err = customizeBtrfsImageHelper(ic.buildDirAbs, ic.config.Storage.FileSystems, ic.rawImageFile,
+			partIdToPartUuid)
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(ic.config.Storage.Verity) > 0 {
 		// Customize image for dm-verity, setting up verity metadata and security features.
 		err = customizeVerityImageHelper(ic.buildDirAbs, ic.configPath, ic.config, ic.rawImageFile, partIdToPartUuid)
@@ -390,6 +444,31 @@ func customizeOSContents(ic *ImageCustomizerParameters) error {
 		}
 	}
 
+	if len(ic.config.Storage.Encryption) > 0 {
+		// Move the contents of the encrypted partitions into LUKS devices.
+		err = customizeEncryptionImageHelper(ic.buildDirAbs, ic.configPath, ic.config.Storage.Encryption, luksUuids,
+			ic.rawImageFile, partIdToPartUuid)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ic.config.Storage.ABUpdate != nil {
+		// Set up slot B, now that the contents of slot A are final.
+		err = customizeABImageHelper(ic.buildDirAbs, ic.config.Storage, ic.rawImageFile, partIdToPartUuid)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ic.config.OS.Uki != nil {
+		// Build the UKI, now that the kernel command line is final.
+		err = customizeUkiImageHelper(ic.buildDirAbs, ic.configPath, ic.config.OS.Uki, ic.rawImageFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Check file systems for corruption.
 	err = checkFileSystems(ic.rawImageFile)
 	if err != nil {
@@ -405,6 +484,13 @@ func customizeOSContents(ic *ImageCustomizerParameters) error {
 		}
 	}
 
+	if ic.config.OS.Sbom != nil {
+		err = writeSbom(ic.buildDirAbs, ic.configPath, ic.config.OS.Sbom, ic.outputImageDir, ic.outputImageBase)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -435,6 +521,15 @@ func convertWriteableFormatToOutputImage(ic *ImageCustomizerParameters, inputIso
 				return fmt.Errorf("failed to create LiveOS iso image:\n%w", err)
 			}
 		}
+
+	case ImageFormatOci, ImageFormatDockerArchive:
+		logger.Log.Infof("Writing: %s", ic.outputImageFile)
+
+		err := createContainerImage(ic.buildDirAbs, ic.config.Container, ic.rawImageFile, ic.outputImageFile,
+			ic.outputImageFormat)
+		if err != nil {
+			return fmt.Errorf("failed to create container image:\n%w", err)
+		}
 	}
 
 	return nil
@@ -459,11 +554,13 @@ func convertImageFile(inputPath string, outputPath string, format string) error
 
 func validateImageFormat(imageFormat string) error {
 	switch imageFormat {
-	case ImageFormatVhd, ImageFormatVhdFixed, ImageFormatVhdx, ImageFormatRaw, ImageFormatQCow2:
+	case ImageFormatVhd, ImageFormatVhdFixed, ImageFormatVhdx, ImageFormatRaw, ImageFormatQCow2, ImageFormatOci,
+		ImageFormatDockerArchive:
 		return nil
 
 	default:
-		return fmt.Errorf("unsupported image format (supported: vhd, vhd-fixed, vhdx, raw, qcow2): %s", imageFormat)
+		return fmt.Errorf("unsupported image format (supported: vhd, vhd-fixed, vhdx, raw, qcow2, oci, docker-archive): %s",
+			imageFormat)
 	}
 }
 
@@ -515,6 +612,11 @@ func validateConfig(baseConfigPath string, config *imagecustomizerapi.Config, rp
 		return err
 	}
 
+	err = validateStorageConfig(baseConfigPath, &config.Storage)
+	if err != nil {
+		return err
+	}
+
 	err = validateScripts(baseConfigPath, &config.Scripts)
 	if err != nil {
 		return err
@@ -523,6 +625,24 @@ func validateConfig(baseConfigPath string, config *imagecustomizerapi.Config, rp
 	return nil
 }
 
+func validateStorageConfig(baseConfigPath string, storage *imagecustomizerapi.Storage) error {
+	for i, encryption := range storage.Encryption {
+		keyFileFullPath := file.GetAbsPathWithBase(baseConfigPath, encryption.KeyFile)
+		isFile, err := file.IsFile(keyFileFullPath)
+		if err != nil {
+			return fmt.Errorf("invalid encryption item at index %d:\ninvalid keyFile (%s):\n%w", i,
+				encryption.KeyFile, err)
+		}
+
+		if !isFile {
+			return fmt.Errorf("invalid encryption item at index %d:\ninvalid keyFile (%s):\nnot a file", i,
+				encryption.KeyFile)
+		}
+	}
+
+	return nil
+}
+
 func validateAdditionalFiles(baseConfigPath string, additionalFiles imagecustomizerapi.AdditionalFileList) error {
 	errs := []error(nil)
 	for _, additionalFile := range additionalFiles {
@@ -577,6 +697,32 @@ func validateSystemConfig(baseConfigPath string, config *imagecustomizerapi.OS,
 		return err
 	}
 
+	if config.Uki != nil && config.Uki.Signing != nil {
+		for _, signingFile := range []string{config.Uki.Signing.KeyFile, config.Uki.Signing.CertificateFile} {
+			isFile, err := file.IsFile(file.GetAbsPathWithBase(baseConfigPath, signingFile))
+			if err != nil {
+				return fmt.Errorf("invalid uki signing file (%s):\n%w", signingFile, err)
+			}
+
+			if !isFile {
+				return fmt.Errorf("invalid uki signing file (%s):\nnot a file", signingFile)
+			}
+		}
+	}
+
+	if config.Sbom != nil && config.Sbom.Signing != nil {
+		for _, signingFile := range []string{config.Sbom.Signing.KeyFile, config.Sbom.Signing.CertificateFile} {
+			isFile, err := file.IsFile(file.GetAbsPathWithBase(baseConfigPath, signingFile))
+			if err != nil {
+				return fmt.Errorf("invalid sbom signing file (%s):\n%w", signingFile, err)
+			}
+
+			if !isFile {
+				return fmt.Errorf("invalid sbom signing file (%s):\nnot a file", signingFile)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -669,7 +815,7 @@ func validatePackageLists(baseConfigPath string, config *imagecustomizerapi.OS,
 
 func customizeImageHelper(buildDir string, baseConfigPath string, config *imagecustomizerapi.Config,
 	rawImageFile string, rpmsSources []string, useBaseImageRpmRepos bool, partitionsCustomized bool,
-	imageUuidStr string,
+	imageUuidStr string, luksUuids map[string]string,
 ) error {
 	logger.Log.Debugf("Customizing OS")
 
@@ -681,7 +827,7 @@ func customizeImageHelper(buildDir string, baseConfigPath string, config *imagec
 
 	// Do the actual customizations.
 	err = doOsCustomizations(buildDir, baseConfigPath, config, imageConnection, rpmsSources,
-		useBaseImageRpmRepos, partitionsCustomized, imageUuidStr)
+		useBaseImageRpmRepos, partitionsCustomized, imageUuidStr, luksUuids)
 
 	// Out of disk space errors can be difficult to diagnose.
 	// So, warn about any partitions with low free space.
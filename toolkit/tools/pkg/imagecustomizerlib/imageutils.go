@@ -5,6 +5,7 @@ package imagecustomizerlib
 
 import (
 	"fmt"
+	"maps"
 	"path/filepath"
 	"sort"
 
@@ -40,6 +41,17 @@ func connectToExistingImageHelper(imageConnection *ImageConnection, imageFilePat
 		return err
 	}
 
+	// Assemble the RAID arrays and activate the volume groups, so that the filesystems on them can be found.
+	err = imageConnection.ActivateRaidArrays()
+	if err != nil {
+		return err
+	}
+
+	err = imageConnection.ActivateVolumeGroups()
+	if err != nil {
+		return err
+	}
+
 	// Look for all the partitions on the image.
 	mountPoints, err := findPartitions(buildDir, imageConnection.Loopback().DevicePath())
 	if err != nil {
@@ -58,14 +70,14 @@ func connectToExistingImageHelper(imageConnection *ImageConnection, imageFilePat
 }
 
 func createNewImage(filename string, diskConfig imagecustomizerapi.Disk,
-	fileSystems []imagecustomizerapi.FileSystem, buildDir string, chrootDirName string,
-	installOS installOSFunc,
+	fileSystems []imagecustomizerapi.FileSystem, raids []imagecustomizerapi.Raid,
+	volumeGroups []imagecustomizerapi.VolumeGroup, buildDir string, chrootDirName string, installOS installOSFunc,
 ) (map[string]string, error) {
 	imageConnection := NewImageConnection()
 	defer imageConnection.Close()
 
-	partIdToPartUuid, err := createNewImageHelper(imageConnection, filename, diskConfig, fileSystems, buildDir, chrootDirName,
-		installOS)
+	partIdToPartUuid, err := createNewImageHelper(imageConnection, filename, diskConfig, fileSystems, raids,
+		volumeGroups, buildDir, chrootDirName, installOS)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new image:\n%w", err)
 	}
@@ -80,8 +92,8 @@ func createNewImage(filename string, diskConfig imagecustomizerapi.Disk,
 }
 
 func createNewImageHelper(imageConnection *ImageConnection, filename string, diskConfig imagecustomizerapi.Disk,
-	fileSystems []imagecustomizerapi.FileSystem, buildDir string, chrootDirName string,
-	installOS installOSFunc,
+	fileSystems []imagecustomizerapi.FileSystem, raids []imagecustomizerapi.Raid,
+	volumeGroups []imagecustomizerapi.VolumeGroup, buildDir string, chrootDirName string, installOS installOSFunc,
 ) (map[string]string, error) {
 
 	// Convert config to image config types, so that the imager's utils can be used.
@@ -95,9 +107,11 @@ func createNewImageHelper(imageConnection *ImageConnection, filename string, dis
 		return nil, err
 	}
 
+	setRaidMountIdentifiers(imagerPartitionSettings, raids)
+
 	// Create imager boilerplate.
 	partIdToPartUuid, tmpFstabFile, err := createImageBoilerplate(imageConnection, filename, buildDir, chrootDirName,
-		imagerDiskConfig, imagerPartitionSettings)
+		imagerDiskConfig, imagerPartitionSettings, raids, volumeGroups, fileSystems)
 	if err != nil {
 		return nil, err
 	}
@@ -162,6 +176,8 @@ func configureDiskBootLoader(imageConnection *ImageConnection, rootMountIdType i
 
 func createImageBoilerplate(imageConnection *ImageConnection, filename string, buildDir string, chrootDirName string,
 	imagerDiskConfig configuration.Disk, imagerPartitionSettings []configuration.PartitionSetting,
+	raids []imagecustomizerapi.Raid, volumeGroups []imagecustomizerapi.VolumeGroup,
+	fileSystems []imagecustomizerapi.FileSystem,
 ) (map[string]string, string, error) {
 	// Create raw disk image file.
 	err := diskutils.CreateSparseDisk(filename, imagerDiskConfig.MaxSize, 0o644)
@@ -189,6 +205,38 @@ func createImageBoilerplate(imageConnection *ImageConnection, filename string, b
 		return nil, "", err
 	}
 
+	// Set up the RAID arrays.
+	// The RAID arrays and volume groups are recorded first, so that they are deactivated even if their creation fails
+	// partway.
+	for _, raid := range raids {
+		imageConnection.raidArrays = append(imageConnection.raidArrays, raidDevicePath(raid.Name))
+	}
+
+	raidIdToDevPathMap, raidIdToFsTypeMap, err := createRaidArrays(raids, fileSystems, partIDToDevPathMap)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Set up the volume groups and logical volumes.
+	// Physical volumes may be either partitions or RAID arrays.
+	for _, volumeGroup := range volumeGroups {
+		imageConnection.volumeGroups = append(imageConnection.volumeGroups, volumeGroup.Name)
+	}
+
+	pvIdToDevPathMap := maps.Clone(partIDToDevPathMap)
+	maps.Copy(pvIdToDevPathMap, raidIdToDevPathMap)
+
+	lvIdToDevPathMap, lvIdToFsTypeMap, err := createVolumeGroups(volumeGroups, fileSystems, pvIdToDevPathMap)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Set up the btrfs subvolumes, so that they can be mounted.
+	err = createBtrfsSubvolumes(fileSystems, partIDToDevPathMap, buildDir)
+	if err != nil {
+		return nil, "", err
+	}
+
 	// Read the disk partitions.
 	diskPartitions, err := diskutils.GetDiskPartitions(imageConnection.Loopback().DevicePath())
 	if err != nil {
@@ -201,6 +249,12 @@ func createImageBoilerplate(imageConnection *ImageConnection, filename string, b
 		return nil, "", err
 	}
 
+	// RAID arrays and logical volumes are mounted the same way as partitions.
+	maps.Copy(partIDToDevPathMap, raidIdToDevPathMap)
+	maps.Copy(partIDToFsTypeMap, raidIdToFsTypeMap)
+	maps.Copy(partIDToDevPathMap, lvIdToDevPathMap)
+	maps.Copy(partIDToFsTypeMap, lvIdToFsTypeMap)
+
 	// Create the fstab file.
 	// This is done so that we can read back the file using findmnt, which conveniently splits the vfs and fs mount
 	// options for us. If we wanted to handle this more directly, we could create a golang wrapper around libmount
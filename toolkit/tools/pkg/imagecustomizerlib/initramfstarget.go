@@ -0,0 +1,105 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// nonDefaultKernelTokens are the release string tokens (compared case-insensitively) of kernel variants that the
+// initramfs tooling never picks by default.
+var nonDefaultKernelTokens = []string{
+	"rescue",
+	"debug",
+}
+
+// DefaultInitramfsTargetKernel returns the kernel that the initramfs tooling (e.g. dracut) targets when it isn't told
+// a kernel version explicitly. All of the initramfs steps should use this, so that they agree on the kernel.
+//
+// The selection rules are:
+//   - The kernel must be installed (i.e. have a non-empty /lib/modules/<ver> directory).
+//   - The kernel must be bootable (i.e. have a kernel binary at /boot/vmlinuz-<ver> or /lib/modules/<ver>/vmlinuz).
+//   - Rescue and debug kernels (e.g. "6.11.6-200.fc40.x86_64+debug") are excluded.
+//   - Of the remaining kernels, the newest one is picked.
+func DefaultInitramfsTargetKernel(imageChroot *safechroot.Chroot) (*versioncompare.TolerantVersion, error) {
+	return defaultInitramfsTargetKernel(imageChroot.RootDir())
+}
+
+func defaultInitramfsTargetKernel(rootDir string) (*versioncompare.TolerantVersion, error) {
+	kernels, err := systemdependency.GetInstalledKernelVersions(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *versioncompare.TolerantVersion
+	for _, kernel := range kernels {
+		if isNonDefaultKernel(kernel.String()) {
+			continue
+		}
+
+		bootable, err := isKernelBootable(rootDir, kernel.String())
+		if err != nil {
+			return nil, err
+		}
+
+		if !bootable {
+			continue
+		}
+
+		if newest == nil || kernel.Compare(newest) > 0 {
+			newest = kernel
+		}
+	}
+
+	if newest == nil {
+		return nil, fmt.Errorf("no bootable kernel found for initramfs (installed kernels: %v)", kernels)
+	}
+
+	return newest, nil
+}
+
+// isNonDefaultKernel returns true if the kernel release string identifies a rescue or debug kernel.
+func isNonDefaultKernel(release string) bool {
+	tokens := strings.FieldsFunc(strings.ToLower(release), func(r rune) bool {
+		return r == '.' || r == '-' || r == '+' || r == '~' || r == '_'
+	})
+
+	for _, token := range tokens {
+		for _, nonDefaultToken := range nonDefaultKernelTokens {
+			if token == nonDefaultToken {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isKernelBootable returns true if the kernel 'kernel' has a kernel binary.
+func isKernelBootable(rootDir string, kernel string) (bool, error) {
+	candidates := []string{
+		filepath.Join(rootDir, bootDir, vmlinuzPrefix+kernel),
+		filepath.Join(rootDir, systemdependency.KernelModulesDir, kernel, "vmlinuz"),
+	}
+
+	for _, candidate := range candidates {
+		exists, err := file.PathExists(candidate)
+		if err != nil {
+			return false, fmt.Errorf("failed to check if (%s) exists:\n%w", candidate, err)
+		}
+
+		if exists {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
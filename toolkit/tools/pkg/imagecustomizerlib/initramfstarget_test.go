@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestBootableKernel creates an installed kernel with a /boot/vmlinuz-<ver> binary.
+func createTestBootableKernel(t *testing.T, rootDir string, version string) {
+	createTestKernelDir(t, rootDir, version)
+	createTestBootFile(t, rootDir, "vmlinuz-"+version)
+}
+
+func TestDefaultInitramfsTargetKernelNewest(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestBootableKernel(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootableKernel(t, rootDir, "6.6.57.1-1.azl3")
+	createTestBootableKernel(t, rootDir, "6.6.51.1-1.azl3")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	kernel, err := DefaultInitramfsTargetKernel(imageChroot)
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.57.1-1.azl3", kernel.String())
+}
+
+func TestDefaultInitramfsTargetKernelExcludesRescueAndDebug(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestBootableKernel(t, rootDir, "6.11.6-200.fc40.x86_64")
+	createTestBootableKernel(t, rootDir, "6.11.7-200.fc40.x86_64+debug")
+	createTestBootableKernel(t, rootDir, "6.12.0-0-rescue")
+
+	kernel, err := defaultInitramfsTargetKernel(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, "6.11.6-200.fc40.x86_64", kernel.String())
+}
+
+func TestDefaultInitramfsTargetKernelExcludesUnbootable(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestBootableKernel(t, rootDir, "6.6.47.1-1.azl3")
+
+	// Azure Linux 3.0 also ships the kernel binary in the modules directory.
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	err := os.WriteFile(filepath.Join(kernelDir, "vmlinuz"), nil, 0o644)
+	assert.NoError(t, err)
+
+	// No kernel binary.
+	createTestKernelDir(t, rootDir, "6.6.57.1-1.azl3")
+
+	kernel, err := defaultInitramfsTargetKernel(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.51.1-1.azl3", kernel.String())
+}
+
+func TestDefaultInitramfsTargetKernelNone(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootableKernel(t, rootDir, "6.6.51.1-1.azl3-debug")
+
+	_, err := defaultInitramfsTargetKernel(rootDir)
+	assert.ErrorContains(t, err, "no bootable kernel found for initramfs")
+}
+
+func TestIsNonDefaultKernel(t *testing.T) {
+	assert.True(t, isNonDefaultKernel("6.11.7-200.fc40.x86_64+debug"))
+	assert.True(t, isNonDefaultKernel("6.6.51.1-1.azl3-debug"))
+	assert.True(t, isNonDefaultKernel("0-rescue-4b6f1ed4d0a94a1e8a4b3b1c4b1e3f0a"))
+	assert.False(t, isNonDefaultKernel("6.6.47.1-1.azl3"))
+	assert.False(t, isNonDefaultKernel("6.6.47.1-1.azl3-debugfs"))
+}
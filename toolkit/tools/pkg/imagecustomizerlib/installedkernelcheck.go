@@ -4,35 +4,303 @@
 package imagecustomizerlib
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
 	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// errNoInstalledKernel explains the most likely cause of an image not having a kernel.
+var errNoInstalledKernel = errors.New("no installed kernel found: the kernel package may have been removed without " +
+	"a replacement (install a kernel package, such as kernel or kernel-hwe)")
+
+// kernelEnumerator returns the kernels installed in an image.
+type kernelEnumerator func() ([]*versioncompare.TolerantVersion, error)
+
+// chrootKernelEnumerator returns an enumerator that scans the chroot's /lib/modules directory.
+func chrootKernelEnumerator(imageChroot *safechroot.Chroot) kernelEnumerator {
+	return func() ([]*versioncompare.TolerantVersion, error) {
+		return systemdependency.GetInstalledKernelVersions(imageChroot.RootDir())
+	}
+}
+
+// staticKernelEnumerator returns an enumerator for a kernel list that has already been gathered (e.g. from the package
+// transaction), to avoid rescanning the image.
+func staticKernelEnumerator(kernels []*versioncompare.TolerantVersion) kernelEnumerator {
+	return func() ([]*versioncompare.TolerantVersion, error) {
+		return kernels, nil
+	}
+}
+
+// installedKernelPolicy selects what checkForInstalledKernelWithPolicy accepts as an installed kernel.
+type installedKernelPolicy int
+
+const (
+	// installedKernelPolicyModules requires a non-empty /lib/modules/<ver> directory.
+	installedKernelPolicyModules installedKernelPolicy = iota
+	// installedKernelPolicyAllowUki also accepts a valid UKI under EFI/Linux, for images that boot solely from a UKI
+	// and so don't need /lib/modules (e.g. the modules they need are in the UKI's initramfs).
+	installedKernelPolicyAllowUki
 )
 
 // Check if the user accidentally uninstalled the kernel package without installing a substitute package.
 func checkForInstalledKernel(imageChroot *safechroot.Chroot) error {
-	kernelModulesDir := filepath.Join(imageChroot.RootDir(), "/lib/modules")
+	return checkForInstalledKernelWithPolicy(imageChroot, installedKernelPolicyModules)
+}
+
+// checkForInstalledKernelWithPolicy is the same as checkForInstalledKernel, but 'policy' selects what counts as an
+// installed kernel.
+func checkForInstalledKernelWithPolicy(imageChroot *safechroot.Chroot, policy installedKernelPolicy) error {
+	_, err := ensureInstalledKernel(imageChroot)
+	if err == nil || policy != installedKernelPolicyAllowUki {
+		return err
+	}
+
+	ukiFiles, ukiErr := findValidUkiFiles(imageChroot.RootDir())
+	if ukiErr != nil {
+		return ukiErr
+	}
+
+	if len(ukiFiles) <= 0 {
+		return err
+	}
+
+	logger.Log.Debugf("No kernel modules found (%s)", err)
+	logger.Log.Infof("Installed UKIs: %s", strings.Join(ukiFiles, ", "))
+	return nil
+}
+
+// findValidUkiFiles returns the paths, within the image, of the UKI files that have a kernel. Invalid UKI files are
+// logged and skipped.
+func findValidUkiFiles(rootDir string) ([]string, error) {
+	ukiPaths, err := findUkiFiles(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	validUkiFiles := []string(nil)
+	for _, ukiPath := range ukiPaths {
+		imagePath, err := filepath.Rel(rootDir, ukiPath)
+		if err != nil {
+			return nil, err
+		}
+		imagePath = "/" + imagePath
+
+		_, err = readUki(ukiPath)
+		if err != nil {
+			logger.Log.Warnf("Skipping UKI (%s):\n%s", imagePath, err)
+			continue
+		}
+
+		validUkiFiles = append(validUkiFiles, imagePath)
+	}
+
+	return validUkiFiles, nil
+}
+
+// ensureInstalledKernel is the same as checkForInstalledKernel but also returns the kernels that were found.
+//
+// If no kernel is found, the error lists any empty kernel directories, which are left behind when the kernel package
+// is uninstalled.
+func ensureInstalledKernel(imageChroot *safechroot.Chroot) ([]*versioncompare.TolerantVersion, error) {
+	kernels, err := ensureKernelInstalledWith(chrootKernelEnumerator(imageChroot))
+	if errors.Is(err, errNoInstalledKernel) {
+		leftoverDirs, leftoverErr := findLeftoverKernelDirs(imageChroot.RootDir())
+		if leftoverErr != nil {
+			logger.Log.Debugf("Failed to find leftover kernel directories: %s", leftoverErr)
+		}
+
+		if len(leftoverDirs) > 0 {
+			return nil, fmt.Errorf("%w\nempty leftover kernel directories: %s", err, strings.Join(leftoverDirs, ", "))
+		}
+	}
+
+	return kernels, err
+}
+
+// ensureKernelInstalledWith is the same as ensureInstalledKernel but gets the list of kernels from 'enumerate'.
+func ensureKernelInstalledWith(enumerate kernelEnumerator) ([]*versioncompare.TolerantVersion, error) {
+	kernels, err := enumerate()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kernels) <= 0 {
+		return nil, errNoInstalledKernel
+	}
+
+	logger.Log.Infof("Installed kernels: %v", kernels)
+
+	return kernels, nil
+}
+
+// findLeftoverKernelDirs returns the paths, within the image, of the empty kernel directories (i.e. /lib/modules/<ver>).
+func findLeftoverKernelDirs(rootDir string) ([]string, error) {
+	versions, err := systemdependency.GetFilteredKernelStringVersions(rootDir, file.IsDirEmpty)
+	if err != nil {
+		return nil, err
+	}
+
+	leftoverDirs := make([]string, len(versions))
+	for i, version := range versions {
+		leftoverDirs[i] = filepath.Join(systemdependency.KernelModulesDir, version)
+	}
+
+	return leftoverDirs, nil
+}
 
-	kernels, err := os.ReadDir(kernelModulesDir)
+// checkForInstalledKernelForArch is the same as checkForInstalledKernel, but if 'targetArch' isn't empty, it also
+// requires at least one installed kernel to be built for 'targetArch' (e.g. "x86_64"). This catches cross-build
+// staging mistakes where the only installed kernel is for the wrong architecture.
+func checkForInstalledKernelForArch(imageChroot *safechroot.Chroot, targetArch string) error {
+	return checkInstalledKernelArchWith(chrootKernelEnumerator(imageChroot), targetArch)
+}
+
+// checkInstalledKernelArchWith is the same as checkForInstalledKernelForArch but gets the list of kernels from
+// 'enumerate'.
+//
+// Most distros (including Azure Linux) don't include the architecture in the kernel release string. If any installed
+// kernel's release string doesn't have an architecture, then the check can't be done reliably. So, only a warning is
+// logged.
+func checkInstalledKernelArchWith(enumerate kernelEnumerator, targetArch string) error {
+	kernels, err := ensureKernelInstalledWith(enumerate)
 	if err != nil {
-		return fmt.Errorf("failed to read installed kernels list:\n%w", err)
+		return err
+	}
+
+	if targetArch == "" {
+		return nil
 	}
 
+	unknownArchKernels := []string(nil)
 	for _, kernel := range kernels {
-		// There is a bug in Azure Linux 2.0, where uninstalling the kernel package doesn't remove the directory
-		// /lib/modules/<ver>. Instead the directory is just emptied. So, ensure the directory isn't empty.
-		files, err := os.ReadDir(filepath.Join(kernelModulesDir, kernel.Name()))
+		release, err := systemdependency.ParseKernelRelease(kernel.String())
 		if err != nil {
-			return fmt.Errorf("failed to read installed kernel (%s) module directory:\n%w", kernel.Name(), err)
+			return err
 		}
 
-		if len(files) > 0 {
-			// Found at least 1 kernel.
+		if release.Arch == targetArch {
 			return nil
 		}
+
+		if release.Arch == "" {
+			unknownArchKernels = append(unknownArchKernels, kernel.String())
+		}
+	}
+
+	if len(unknownArchKernels) > 0 {
+		logger.Log.Warnf("Can't verify that an installed kernel matches the target architecture (%s), since the "+
+			"kernels (%s) don't specify an architecture", targetArch, strings.Join(unknownArchKernels, ", "))
+		return nil
+	}
+
+	return fmt.Errorf("no installed kernel matches the target architecture (%s):\ninstalled kernels: %v", targetArch,
+		kernels)
+}
+
+// checkNewestKernelInstalled verifies that the newest installed kernel is at least as new as 'expectedNewest'. This
+// catches package repos that served a stale kernel.
+func checkNewestKernelInstalled(imageChroot *safechroot.Chroot, expectedNewest *versioncompare.TolerantVersion) error {
+	kernels, err := ensureInstalledKernel(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	newest := newestKernel(kernels)
+	if newest.Compare(expectedNewest) < 0 {
+		return fmt.Errorf("newest installed kernel (%s) is older than the expected newest kernel (%s)", newest,
+			expectedNewest)
+	}
+
+	return nil
+}
+
+// checkKernelMatchesTarget verifies that the newest installed kernel meets the image's target kernel constraint
+// (e.g. "6.6.*"). The newest kernel is the one that the boot-loader defaults to.
+func checkKernelMatchesTarget(imageChroot *safechroot.Chroot, target *versioncompare.Constraint) error {
+	kernels, err := ensureInstalledKernel(imageChroot)
+	if err != nil {
+		return err
+	}
+
+	newest := newestKernel(kernels)
+	if !target.Check(newest) {
+		return fmt.Errorf("newest installed kernel (%s) does not match the target kernel (%s)", newest, target)
+	}
+
+	return nil
+}
+
+// newestKernel returns the newest kernel in 'kernels', which must not be empty.
+func newestKernel(kernels []*versioncompare.TolerantVersion) *versioncompare.TolerantVersion {
+	newest := kernels[0]
+	for _, kernel := range kernels[1:] {
+		if kernel.Compare(newest) > 0 {
+			newest = kernel
+		}
+	}
+
+	return newest
+}
+
+// warnDuplicateKernelSeries logs a warning for each kernel series (e.g. "6.6") that has more than one installed
+// kernel. Keeping multiple kernels of the same series wastes space and can confuse updates. It returns the series that
+// have duplicates.
+func warnDuplicateKernelSeries(imageChroot *safechroot.Chroot) ([]string, error) {
+	series, err := systemdependency.KernelsBySeries(imageChroot.RootDir())
+	if err != nil {
+		return nil, err
+	}
+
+	duplicateSeries := []string(nil)
+	for seriesName, kernels := range series {
+		if len(kernels) > 1 {
+			duplicateSeries = append(duplicateSeries, seriesName)
+			logger.Log.Warnf("Multiple kernels of series (%s) are installed: %v", seriesName, kernels)
+		}
+	}
+
+	sort.Strings(duplicateSeries)
+
+	return duplicateSeries, nil
+}
+
+// findDuplicateKernelSeries returns the installed kernels whose series (e.g. "6.6") has more than one installed
+// kernel, along with a description of each such series. Keeping multiple kernels of the same series wastes space and
+// can confuse updates. The series are sorted.
+func findDuplicateKernelSeries(rootDir string) ([]string, []string, error) {
+	series, err := systemdependency.KernelsBySeries(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seriesNames := []string(nil)
+	for seriesName, kernels := range series {
+		if len(kernels) > 1 {
+			seriesNames = append(seriesNames, seriesName)
+		}
+	}
+
+	sort.Strings(seriesNames)
+
+	duplicates := []string(nil)
+	descriptions := []string(nil)
+	for _, seriesName := range seriesNames {
+		kernels := []string(nil)
+		for _, kernel := range series[seriesName] {
+			kernels = append(kernels, kernel.String())
+		}
+
+		duplicates = append(duplicates, kernels...)
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", seriesName, strings.Join(kernels, ", ")))
 	}
 
-	return fmt.Errorf("no installed kernel found")
+	return duplicates, descriptions, nil
 }
@@ -4,9 +4,13 @@
 package imagecustomizerlib
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,3 +27,300 @@ func TestCustomizeImageMissingKernel(t *testing.T) {
 		"" /*outputPXEArtifactsDir*/, false /*useBaseImageRpmRepos*/, false /*enableShrinkFilesystems*/)
 	assert.ErrorContains(t, err, "no installed kernel found")
 }
+
+// createTestKernelDir creates a fake, non-empty /lib/modules/<version> directory under 'rootDir'.
+func createTestKernelDir(t *testing.T, rootDir string, version string) string {
+	kernelDir := filepath.Join(rootDir, "lib/modules", version)
+	err := os.MkdirAll(kernelDir, os.ModePerm)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	err = os.WriteFile(filepath.Join(kernelDir, "modules.dep"), nil, 0o644)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return kernelDir
+}
+
+func TestEnsureInstalledKernel(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	kernels, err := ensureInstalledKernel(imageChroot)
+	assert.NoError(t, err)
+	assert.Len(t, kernels, 2)
+	assert.Equal(t, "6.6.47.1-1.azl3", kernels[0].String())
+	assert.Equal(t, "6.6.51.1-1.azl3", kernels[1].String())
+
+	err = checkForInstalledKernel(imageChroot)
+	assert.NoError(t, err)
+}
+
+func TestEnsureInstalledKernelEmptyModulesDir(t *testing.T) {
+	rootDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(rootDir, "lib/modules/6.6.47.1-1.azl3"), os.ModePerm)
+	assert.NoError(t, err)
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	_, err = ensureInstalledKernel(imageChroot)
+	assert.ErrorContains(t, err, "no installed kernel found")
+	assert.ErrorContains(t, err, "the kernel package may have been removed without a replacement")
+	assert.ErrorContains(t, err, "empty leftover kernel directories: /lib/modules/6.6.47.1-1.azl3")
+}
+
+func TestCheckForInstalledKernelWithPolicyUkiOnly(t *testing.T) {
+	// The image has no /lib/modules. The kernel and its modules are in the UKI.
+	rootDir := t.TempDir()
+	createTestUkiFile(t, filepath.Join(rootDir, "boot/efi/EFI/Linux/azl-6.6.47.1-1.azl3.efi"),
+		testPeSection{".uname", []byte("6.6.47.1-1.azl3")},
+		testPeSection{".linux", []byte("kernel")},
+		testPeSection{".initrd", []byte("initrd")},
+	)
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	err := checkForInstalledKernelWithPolicy(imageChroot, installedKernelPolicyAllowUki)
+	assert.NoError(t, err)
+
+	// The default policy still requires /lib/modules.
+	err = checkForInstalledKernel(imageChroot)
+	assert.Error(t, err)
+
+	// An empty /lib/modules is accepted as well.
+	err = os.MkdirAll(filepath.Join(rootDir, "lib/modules"), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = checkForInstalledKernelWithPolicy(imageChroot, installedKernelPolicyAllowUki)
+	assert.NoError(t, err)
+
+	err = checkForInstalledKernel(imageChroot)
+	assert.ErrorIs(t, err, errNoInstalledKernel)
+}
+
+func TestCheckForInstalledKernelWithPolicyInvalidUki(t *testing.T) {
+	rootDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(rootDir, "lib/modules"), os.ModePerm)
+	assert.NoError(t, err)
+	createTestImageFile(t, rootDir, "/boot/efi/EFI/Linux/azl-6.6.47.1-1.azl3.efi", "not a PE file")
+
+	err = checkForInstalledKernelWithPolicy(safechroot.NewChroot(rootDir, true /*isExistingDir*/),
+		installedKernelPolicyAllowUki)
+	assert.ErrorIs(t, err, errNoInstalledKernel)
+}
+
+func TestCheckNewestKernelInstalled(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	// Equal.
+	err := checkNewestKernelInstalled(imageChroot, versioncompare.New("6.6.51.1-1.azl3"))
+	assert.NoError(t, err)
+
+	// Installed kernel is newer than expected.
+	err = checkNewestKernelInstalled(imageChroot, versioncompare.New("6.6.49.1-1.azl3"))
+	assert.NoError(t, err)
+
+	// Installed kernel is older than expected.
+	err = checkNewestKernelInstalled(imageChroot, versioncompare.New("6.6.51.1-2.azl3"))
+	assert.ErrorContains(t, err,
+		"newest installed kernel (6.6.51.1-1.azl3) is older than the expected newest kernel (6.6.51.1-2.azl3)")
+}
+
+func TestCheckNewestKernelInstalledNoKernel(t *testing.T) {
+	rootDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(rootDir, "lib/modules"), os.ModePerm)
+	assert.NoError(t, err)
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	err = checkNewestKernelInstalled(imageChroot, versioncompare.New("6.6.51.1-1.azl3"))
+	assert.ErrorContains(t, err, "no installed kernel found")
+}
+
+func TestCheckKernelMatchesTarget(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.1.90.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	target, err := versioncompare.ParseConstraint("6.6.*")
+	assert.NoError(t, err)
+
+	err = checkKernelMatchesTarget(imageChroot, target)
+	assert.NoError(t, err)
+
+	target, err = versioncompare.ParseConstraint(">= 6.6.44, < 6.7")
+	assert.NoError(t, err)
+
+	err = checkKernelMatchesTarget(imageChroot, target)
+	assert.NoError(t, err)
+}
+
+func TestCheckKernelMatchesTargetViolated(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	target, err := versioncompare.ParseConstraint("6.12.*")
+	assert.NoError(t, err)
+
+	err = checkKernelMatchesTarget(imageChroot, target)
+	assert.ErrorContains(t, err,
+		"newest installed kernel (6.6.47.1-1.azl3) does not match the target kernel (6.12.*)")
+
+	// Only the newest kernel is checked.
+	createTestKernelDir(t, rootDir, "6.12.1.1-1.azl3")
+
+	err = checkKernelMatchesTarget(imageChroot, target)
+	assert.NoError(t, err)
+
+	target, err = versioncompare.ParseConstraint("6.6.*")
+	assert.NoError(t, err)
+
+	err = checkKernelMatchesTarget(imageChroot, target)
+	assert.ErrorContains(t, err,
+		"newest installed kernel (6.12.1.1-1.azl3) does not match the target kernel (6.6.*)")
+}
+
+func TestEnsureKernelInstalledWithInjectedKernels(t *testing.T) {
+	kernels := []*versioncompare.TolerantVersion{
+		versioncompare.New("6.6.47.1-1.azl3"),
+		versioncompare.New("6.6.51.1-1.azl3"),
+	}
+
+	found, err := ensureKernelInstalledWith(staticKernelEnumerator(kernels))
+	assert.NoError(t, err)
+	assert.Equal(t, kernels, found)
+}
+
+func TestEnsureKernelInstalledWithNoInjectedKernels(t *testing.T) {
+	_, err := ensureKernelInstalledWith(staticKernelEnumerator(nil))
+	assert.ErrorContains(t, err, "no installed kernel found")
+}
+
+func TestEnsureKernelInstalledWithEnumeratorError(t *testing.T) {
+	enumerate := func() ([]*versioncompare.TolerantVersion, error) {
+		return nil, fmt.Errorf("package transaction unavailable")
+	}
+
+	_, err := ensureKernelInstalledWith(enumerate)
+	assert.ErrorContains(t, err, "package transaction unavailable")
+}
+
+func TestCheckInstalledKernelArchMatching(t *testing.T) {
+	kernels := []*versioncompare.TolerantVersion{
+		versioncompare.New("6.11.6-200.fc40.aarch64"),
+		versioncompare.New("6.11.6-200.fc40.x86_64"),
+	}
+
+	err := checkInstalledKernelArchWith(staticKernelEnumerator(kernels), "x86_64")
+	assert.NoError(t, err)
+}
+
+func TestCheckInstalledKernelArchMismatching(t *testing.T) {
+	kernels := []*versioncompare.TolerantVersion{
+		versioncompare.New("6.11.6-200.fc40.aarch64"),
+	}
+
+	err := checkInstalledKernelArchWith(staticKernelEnumerator(kernels), "x86_64")
+	assert.ErrorContains(t, err, "no installed kernel matches the target architecture (x86_64)")
+	assert.ErrorContains(t, err, "6.11.6-200.fc40.aarch64")
+}
+
+func TestCheckInstalledKernelArchNoArchInfo(t *testing.T) {
+	kernels := []*versioncompare.TolerantVersion{
+		versioncompare.New("6.6.47.1-1.azl3"),
+	}
+
+	// Azure Linux kernels don't specify an arch, so the check is lenient.
+	err := checkInstalledKernelArchWith(staticKernelEnumerator(kernels), "aarch64")
+	assert.NoError(t, err)
+}
+
+func TestCheckInstalledKernelArchNoTarget(t *testing.T) {
+	kernels := []*versioncompare.TolerantVersion{
+		versioncompare.New("6.11.6-200.fc40.aarch64"),
+	}
+
+	err := checkInstalledKernelArchWith(staticKernelEnumerator(kernels), "")
+	assert.NoError(t, err)
+}
+
+func TestCheckForInstalledKernelForArch(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.11.6-200.fc40.x86_64")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	err := checkForInstalledKernelForArch(imageChroot, "x86_64")
+	assert.NoError(t, err)
+
+	err = checkForInstalledKernelForArch(imageChroot, "aarch64")
+	assert.ErrorContains(t, err, "no installed kernel matches the target architecture (aarch64)")
+}
+
+func TestWarnDuplicateKernelSeries(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.1.0")
+	createTestKernelDir(t, rootDir, "5.15.153.1-2.cm2")
+	createTestKernelDir(t, rootDir, "5.15.0-1064-azure")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	duplicateSeries, err := warnDuplicateKernelSeries(imageChroot)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5.15", "6.6"}, duplicateSeries)
+}
+
+func TestWarnDuplicateKernelSeriesNone(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.1.0")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	duplicateSeries, err := warnDuplicateKernelSeries(imageChroot)
+	assert.NoError(t, err)
+	assert.Empty(t, duplicateSeries)
+}
+
+func TestFindDuplicateKernelSeries(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.1.0")
+	createTestKernelDir(t, rootDir, "5.15.153.1-2.cm2")
+	createTestKernelDir(t, rootDir, "5.15.0-1064-azure")
+
+	duplicates, descriptions, err := findDuplicateKernelSeries(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5.15.0-1064-azure", "5.15.153.1-2.cm2", "6.6.47.1-1.azl3", "6.6.51.1-1.azl3"},
+		duplicates)
+	assert.Equal(t, []string{
+		"5.15 (5.15.0-1064-azure, 5.15.153.1-2.cm2)",
+		"6.6 (6.6.47.1-1.azl3, 6.6.51.1-1.azl3)",
+	}, descriptions)
+}
+
+func TestFindDuplicateKernelSeriesNone(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.1.0")
+
+	duplicates, descriptions, err := findDuplicateKernelSeries(rootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, duplicates)
+	assert.Empty(t, descriptions)
+}
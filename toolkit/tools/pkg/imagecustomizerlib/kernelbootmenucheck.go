@@ -0,0 +1,315 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/grub"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+const (
+	grubSetCommand     = "set"
+	grubLoadEnvCommand = "load_env"
+
+	bootLoaderEntryLinuxKey   = "linux"
+	bootLoaderEntryVersionKey = "version"
+)
+
+// checkAllKernelsInBootMenu checks that each installed kernel has a boot menu entry and that each boot menu entry
+// refers to an installed kernel. A kernel without a menu entry can't be booted, even though it is installed.
+//
+// Problems are logged as warnings. An error is only returned if the image's boot menu or installed kernels can't be
+// read.
+func checkAllKernelsInBootMenu(imageChroot *safechroot.Chroot) error {
+	missing, orphans, err := findKernelBootMenuProblems(imageChroot.RootDir())
+	if err != nil {
+		return err
+	}
+
+	for _, kernel := range missing {
+		logger.Log.Warnf("Installed kernel (%s) is missing from the boot menu", kernel)
+	}
+
+	for _, kernel := range orphans {
+		logger.Log.Warnf("Boot menu entry for kernel (%s) has no installed kernel", kernel)
+	}
+
+	return nil
+}
+
+// findKernelBootMenuProblems returns the installed kernels that don't have a boot menu entry and the boot menu entries
+// whose kernel isn't installed.
+//
+// Images that boot a UKI directly, or whose bootloader isn't recognized, are skipped.
+func findKernelBootMenuProblems(rootDir string) (missing []string, orphans []string, err error) {
+	bootloader, err := detectBootloader(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	menuKernels := []string(nil)
+	switch bootloader {
+	case BootloaderGrub:
+		menuKernels, err = getGrubMenuKernels(rootDir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case BootloaderSystemdBoot:
+		menuKernels, err = getBootLoaderEntryKernels(rootDir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	default:
+		logger.Log.Infof("Skipping boot menu check: no boot menu for bootloader (%s)", bootloader)
+		return nil, nil, nil
+	}
+
+	kernels, err := systemdependency.GetInstalledKernelStringVersions(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, kernel := range kernels {
+		if !slices.Contains(menuKernels, kernel) {
+			missing = append(missing, kernel)
+		}
+	}
+
+	for _, kernel := range menuKernels {
+		if !slices.Contains(kernels, kernel) && !slices.Contains(orphans, kernel) {
+			orphans = append(orphans, kernel)
+		}
+	}
+
+	return missing, orphans, nil
+}
+
+// getGrubMenuKernels returns the kernel versions referred to by the linux commands in the image's grub config.
+//
+// Grub may also read Boot Loader Specification entries. So, the kernels of those entries are included as well.
+func getGrubMenuKernels(rootDir string) ([]string, error) {
+	grubCfgPath, err := findGrubCfg(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	menuKernels := []string(nil)
+	err = walkGrubConfig(rootDir, grubCfgPath, func(line grub.Line, vars map[string]string) error {
+		if !grub.IsTokenKeyword(line.Tokens[0], linuxCommand) {
+			return nil
+		}
+
+		if len(line.Tokens) < 2 {
+			return fmt.Errorf("grub config '%s' command is missing file path arg", linuxCommand)
+		}
+
+		kernelPath := expandGrubWord(line.Tokens[1], vars)
+		menuKernels = appendMenuKernel(menuKernels, kernelPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entryKernels, err := getBootLoaderEntryKernels(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	menuKernels = append(menuKernels, entryKernels...)
+	return menuKernels, nil
+}
+
+// walkGrubConfig calls 'visit' for each line of the grub config 'grubCfgPath', other than the set and load_env
+// commands, along with the variables set by the preceding lines.
+//
+// The grub config isn't executed. So, the variables are collected in file order, ignoring any conditionals.
+// Azure Linux's grub config loads the kernel's file name (e.g. mariner_linux) and command line (e.g. mariner_cmdline)
+// from an env file.
+func walkGrubConfig(rootDir string, grubCfgPath string, visit func(line grub.Line, vars map[string]string) error,
+) error {
+	grubCfgContent, err := os.ReadFile(grubCfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to read grub config (%s):\n%w", grubCfgPath, err)
+	}
+
+	grubTokens, err := grub.TokenizeConfig(string(grubCfgContent))
+	if err != nil {
+		return fmt.Errorf("failed to parse grub config (%s):\n%w", grubCfgPath, err)
+	}
+
+	vars := make(map[string]string)
+	for _, line := range grub.SplitTokensIntoLines(grubTokens) {
+		switch {
+		case grub.IsTokenKeyword(line.Tokens[0], grubSetCommand):
+			for _, token := range line.Tokens[1:] {
+				name, value, found := strings.Cut(expandGrubWord(token, vars), "=")
+				if found {
+					vars[name] = value
+				}
+			}
+
+		case grub.IsTokenKeyword(line.Tokens[0], grubLoadEnvCommand):
+			err := loadGrubEnvFiles(rootDir, line, vars)
+			if err != nil {
+				return err
+			}
+
+		default:
+			err := visit(line, vars)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadGrubEnvFiles reads the env files of a load_env command into 'vars'. Env files that don't exist are ignored, since
+// the grub config typically only loads them if they exist.
+func loadGrubEnvFiles(rootDir string, line grub.Line, vars map[string]string) error {
+	args := line.Tokens[1:]
+	for i := 0; i < len(args); i++ {
+		arg := expandGrubWord(args[i], vars)
+		if arg != "-f" && arg != "--file" {
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return fmt.Errorf("grub config '%s' command is missing file path arg", grubLoadEnvCommand)
+		}
+
+		i++
+		envFilePath := filepath.Join(rootDir, expandGrubWord(args[i], vars))
+
+		err := readGrubEnvFile(envFilePath, vars)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readGrubEnvFile reads the name=value lines of a grub env file into 'vars'.
+func readGrubEnvFile(envFilePath string, vars map[string]string) error {
+	envFile, err := os.Open(envFilePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open grub env file (%s):\n%w", envFilePath, err)
+	}
+	defer envFile.Close()
+
+	scanner := bufio.NewScanner(envFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, "=")
+		if found {
+			vars[name] = value
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read grub env file (%s):\n%w", envFilePath, err)
+	}
+
+	return nil
+}
+
+// expandGrubWord returns the value of a grub word, with its variables expanded using 'vars'. Unknown variables expand
+// to an empty string, as they do in grub.
+func expandGrubWord(token grub.Token, vars map[string]string) string {
+	sb := strings.Builder{}
+	for _, subWord := range token.SubWords {
+		switch subWord.Type {
+		case grub.VAR_EXPANSION, grub.QUOTED_VAR_EXPANSION:
+			sb.WriteString(vars[subWord.Value])
+
+		default:
+			sb.WriteString(subWord.Value)
+		}
+	}
+
+	return sb.String()
+}
+
+// getBootLoaderEntryKernels returns the kernel versions referred to by the image's Boot Loader Specification entries.
+func getBootLoaderEntryKernels(rootDir string) ([]string, error) {
+	entryFiles, err := findBootLoaderEntryFiles(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	menuKernels := []string(nil)
+	for _, entryFile := range entryFiles {
+		entry, err := readBootLoaderEntry(entryFile)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case entry[bootLoaderEntryLinuxKey] != "":
+			menuKernels = appendMenuKernel(menuKernels, entry[bootLoaderEntryLinuxKey])
+
+		case entry[bootLoaderEntryVersionKey] != "":
+			menuKernels = append(menuKernels, entry[bootLoaderEntryVersionKey])
+
+		default:
+			logger.Log.Warnf("Boot loader entry (%s) doesn't specify a kernel", entryFile)
+		}
+	}
+
+	return menuKernels, nil
+}
+
+// readBootLoaderEntry reads the key/value pairs of a Boot Loader Specification entry file.
+func readBootLoaderEntry(entryFile string) (map[string]string, error) {
+	content, err := os.ReadFile(entryFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot loader entry (%s):\n%w", entryFile, err)
+	}
+
+	entry := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		entry[key] = strings.TrimSpace(value)
+	}
+
+	return entry, nil
+}
+
+// appendMenuKernel appends the kernel version of the kernel binary 'kernelPath' (e.g. /boot/vmlinuz-<version>).
+func appendMenuKernel(menuKernels []string, kernelPath string) []string {
+	kernel, found := strings.CutPrefix(filepath.Base(kernelPath), vmlinuzPrefix)
+	if !found || kernel == "" {
+		logger.Log.Warnf("Unable to determine the kernel version of boot menu kernel (%s)", kernelPath)
+		return menuKernels
+	}
+
+	return append(menuKernels, kernel)
+}
@@ -0,0 +1,99 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBootMenuGrubCfg = `set bootprefix=/boot
+load_env -f $bootprefix/mariner.cfg
+if [ -f $bootprefix/grub2/grubenv ]; then
+	load_env -f $bootprefix/grub2/grubenv
+fi
+
+menuentry "Azure Linux" {
+	linux $bootprefix/$mariner_linux rd.auto=1 $mariner_cmdline
+	initrd $bootprefix/$mariner_initrd
+}
+
+menuentry "Azure Linux (6.6.9.1-1.azl3)" {
+	linux "${bootprefix}/vmlinuz-6.6.9.1-1.azl3" rd.auto=1
+}
+`
+
+const testBootMenuMarinerCfg = `mariner_cmdline=init=/lib/systemd/systemd
+mariner_linux=vmlinuz-6.6.47.1-1.azl3
+mariner_initrd=initramfs-6.6.47.1-1.azl3.img
+`
+
+func TestFindKernelBootMenuProblemsGrub(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/grub2/grub.cfg", testBootMenuGrubCfg)
+	createTestImageFile(t, rootDir, "/boot/mariner.cfg", testBootMenuMarinerCfg)
+
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+
+	missing, orphans, err := findKernelBootMenuProblems(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, missing)
+	assert.Equal(t, []string{"6.6.9.1-1.azl3"}, orphans)
+}
+
+func TestFindKernelBootMenuProblemsGrubWithBootLoaderEntries(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/grub2/grub.cfg", "blscfg\n")
+	createTestImageFile(t, rootDir, "/boot/loader/entries/azl-6.6.47.1-1.azl3.conf",
+		"title Azure Linux\nversion 6.6.47.1-1.azl3\nlinux /vmlinuz-6.6.47.1-1.azl3\n")
+
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	missing, orphans, err := findKernelBootMenuProblems(rootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+	assert.Empty(t, orphans)
+}
+
+func TestFindKernelBootMenuProblemsSystemdBoot(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/efi/loader/entries/azl-6.6.47.1-1.azl3.conf",
+		"# Comment\ntitle Azure Linux\nlinux   /vmlinuz-6.6.47.1-1.azl3\ninitrd /initramfs-6.6.47.1-1.azl3.img\n")
+	createTestImageFile(t, rootDir, "/boot/efi/loader/entries/azl-6.6.9.1-1.azl3.conf",
+		"title Azure Linux\nversion 6.6.9.1-1.azl3\n")
+
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+
+	missing, orphans, err := findKernelBootMenuProblems(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, missing)
+	assert.Equal(t, []string{"6.6.9.1-1.azl3"}, orphans)
+}
+
+func TestFindKernelBootMenuProblemsUki(t *testing.T) {
+	// UKIs don't have a boot menu. So, the check is skipped.
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/efi/EFI/Linux/azl-6.6.47.1-1.azl3.efi", "")
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	missing, orphans, err := findKernelBootMenuProblems(rootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+	assert.Empty(t, orphans)
+}
+
+func TestCheckAllKernelsInBootMenuUki(t *testing.T) {
+	// UKIs don't have a boot menu. So, the check is skipped.
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/efi/EFI/Linux/azl-6.6.47.1-1.azl3.efi", "")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	err := checkAllKernelsInBootMenu(imageChroot)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,131 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+const kernelConfigPrefix = "config-"
+
+// KernelBootArtifacts holds the files that belong to a single kernel.
+// All paths are absolute paths within the image. A path is empty if the image doesn't have that file.
+type KernelBootArtifacts struct {
+	// The kernel's release string (i.e. uname -r). For example: "6.6.47.1-1.azl3".
+	Version string `json:"version"`
+	// For example: "/lib/modules/6.6.47.1-1.azl3".
+	ModulesDir string `json:"modulesDir,omitempty"`
+	// For example: "/boot/vmlinuz-6.6.47.1-1.azl3".
+	Vmlinuz string `json:"vmlinuz,omitempty"`
+	// For example: "/boot/initramfs-6.6.47.1-1.azl3.img".
+	Initramfs string `json:"initramfs,omitempty"`
+	// For example: "/boot/config-6.6.47.1-1.azl3".
+	Config string `json:"config,omitempty"`
+}
+
+// GetKernelBootSet returns the files of each kernel in the image, ordered from oldest to newest kernel.
+//
+// A kernel is included if it has a modules directory or a kernel binary in /boot. /boot is only read once. So, callers
+// that check several of a kernel's files should prefer this over looking up each file separately.
+func GetKernelBootSet(imageChroot *safechroot.Chroot) ([]KernelBootArtifacts, error) {
+	return getKernelBootSet(imageChroot.RootDir())
+}
+
+func getKernelBootSet(rootDir string) ([]KernelBootArtifacts, error) {
+	moduleKernels, err := systemdependency.GetInstalledKernelStringVersions(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	bootFiles, err := readBootFileNames(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	artifactsByVersion := make(map[string]*KernelBootArtifacts)
+	getArtifacts := func(version string) *KernelBootArtifacts {
+		artifacts, found := artifactsByVersion[version]
+		if !found {
+			artifacts = &KernelBootArtifacts{Version: version}
+			artifactsByVersion[version] = artifacts
+		}
+		return artifacts
+	}
+
+	for _, version := range moduleKernels {
+		getArtifacts(version).ModulesDir = filepath.Join(systemdependency.KernelModulesDir, version)
+	}
+
+	for fileName := range bootFiles {
+		version, found := strings.CutPrefix(fileName, vmlinuzPrefix)
+		if found && version != "" {
+			getArtifacts(version).Vmlinuz = filepath.Join(bootDir, fileName)
+		}
+	}
+
+	bootSet := []KernelBootArtifacts(nil)
+	for _, artifacts := range artifactsByVersion {
+		for _, fileName := range kernelInitramfsFileNames(artifacts.Version) {
+			if bootFiles[fileName] {
+				artifacts.Initramfs = filepath.Join(bootDir, fileName)
+				break
+			}
+		}
+
+		for _, fileName := range []string{kernelConfigPrefix + artifacts.Version,
+			kernelConfigPrefix + artifacts.Version + ".gz"} {
+			if bootFiles[fileName] {
+				artifacts.Config = filepath.Join(bootDir, fileName)
+				break
+			}
+		}
+
+		bootSet = append(bootSet, *artifacts)
+	}
+
+	sort.Slice(bootSet, func(i, j int) bool {
+		result := versioncompare.New(bootSet[i].Version).Compare(versioncompare.New(bootSet[j].Version))
+		if result != versioncompare.EqualTo {
+			return result == versioncompare.LessThan
+		}
+
+		// Versions that compare as equal (e.g. "6.6.47.1" and "6.6.47.01") are ordered by name so that the
+		// order is stable.
+		return bootSet[i].Version < bootSet[j].Version
+	})
+
+	return bootSet, nil
+}
+
+// readBootFileNames returns the names of the files in /boot. A missing /boot directory is treated as empty.
+func readBootFileNames(rootDir string) (map[string]bool, error) {
+	bootDirPath := filepath.Join(rootDir, bootDir)
+
+	entries, err := os.ReadDir(bootDirPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot directory (%s):\n%w", bootDirPath, err)
+	}
+
+	fileNames := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		fileNames[entry.Name()] = true
+	}
+
+	return fileNames, nil
+}
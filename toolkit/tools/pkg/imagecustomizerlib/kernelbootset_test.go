@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetKernelBootSet(t *testing.T) {
+	rootDir := t.TempDir()
+
+	// Complete kernel.
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "initramfs-6.6.47.1-1.azl3.img")
+	createTestBootFile(t, rootDir, "config-6.6.47.1-1.azl3")
+
+	// Kernel without an initramfs and with a compressed config.
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "config-6.6.51.1-1.azl3.gz")
+
+	// Modules only.
+	createTestKernelDir(t, rootDir, "5.15.153.1-2.cm2")
+
+	// Kernel binary only, with a Debian style initramfs.
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.9.1-1.azl3")
+	createTestBootFile(t, rootDir, "initrd.img-6.6.9.1-1.azl3")
+
+	// Unrelated files.
+	createTestBootFile(t, rootDir, "grub2/grub.cfg")
+	createTestBootFile(t, rootDir, "System.map-6.6.47.1-1.azl3")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	bootSet, err := GetKernelBootSet(imageChroot)
+	assert.NoError(t, err)
+	assert.Equal(t, []KernelBootArtifacts{
+		{
+			Version:    "5.15.153.1-2.cm2",
+			ModulesDir: "/lib/modules/5.15.153.1-2.cm2",
+		},
+		{
+			Version:   "6.6.9.1-1.azl3",
+			Vmlinuz:   "/boot/vmlinuz-6.6.9.1-1.azl3",
+			Initramfs: "/boot/initrd.img-6.6.9.1-1.azl3",
+		},
+		{
+			Version:    "6.6.47.1-1.azl3",
+			ModulesDir: "/lib/modules/6.6.47.1-1.azl3",
+			Vmlinuz:    "/boot/vmlinuz-6.6.47.1-1.azl3",
+			Initramfs:  "/boot/initramfs-6.6.47.1-1.azl3.img",
+			Config:     "/boot/config-6.6.47.1-1.azl3",
+		},
+		{
+			Version:    "6.6.51.1-1.azl3",
+			ModulesDir: "/lib/modules/6.6.51.1-1.azl3",
+			Vmlinuz:    "/boot/vmlinuz-6.6.51.1-1.azl3",
+			Config:     "/boot/config-6.6.51.1-1.azl3.gz",
+		},
+	}, bootSet)
+}
+
+func TestGetKernelBootSetNoBootDir(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	bootSet, err := getKernelBootSet(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []KernelBootArtifacts{
+		{
+			Version:    "6.6.47.1-1.azl3",
+			ModulesDir: "/lib/modules/6.6.47.1-1.azl3",
+		},
+	}, bootSet)
+}
+
+func TestGetKernelBootSetNoModulesDir(t *testing.T) {
+	_, err := getKernelBootSet(t.TempDir())
+	assert.ErrorContains(t, err, "failed to read installed kernels list")
+}
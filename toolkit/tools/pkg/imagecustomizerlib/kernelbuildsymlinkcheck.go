@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+// kernelBuildLinkName is the name of the link, within a kernel's modules directory, that points to the kernel's
+// headers. Out-of-tree module builds (e.g. DKMS) use it to find the headers.
+const kernelBuildLinkName = "build"
+
+// checkKernelBuildSymlink checks that each installed kernel's /lib/modules/<ver>/build link exists and resolves to a
+// directory. Links are resolved within the image, so absolute links don't point into the build host.
+//
+// Only images that build out-of-tree modules need the kernel headers. So, this check is opt-in.
+func checkKernelBuildSymlink(imageChroot *safechroot.Chroot) error {
+	rootDir := imageChroot.RootDir()
+
+	kernels, err := systemdependency.GetInstalledKernelStringVersions(rootDir)
+	if err != nil {
+		return err
+	}
+
+	_, descriptions, err := findKernelBuildSymlinkProblems(rootDir, kernels)
+	if err != nil {
+		return err
+	}
+
+	if len(descriptions) > 0 {
+		return fmt.Errorf("kernel build links are broken: %s", strings.Join(descriptions, ", "))
+	}
+
+	return nil
+}
+
+// findKernelBuildSymlinkProblems returns the kernels in 'kernels' whose build link is missing or doesn't resolve to a
+// directory, along with a description of each problem.
+func findKernelBuildSymlinkProblems(rootfs string, kernels []string) (broken []string, descriptions []string,
+	err error,
+) {
+	for _, kernel := range kernels {
+		problem, err := getKernelBuildSymlinkProblem(rootfs, kernel)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if problem != "" {
+			broken = append(broken, kernel)
+			descriptions = append(descriptions, fmt.Sprintf("%s (%s)", kernel, problem))
+		}
+	}
+
+	return broken, descriptions, nil
+}
+
+// getKernelBuildSymlinkProblem returns a description of what is wrong with the kernel's build link, or an empty string
+// if the link resolves to a directory.
+func getKernelBuildSymlinkProblem(rootfs string, kernel string) (string, error) {
+	kernelDir, err := systemdependency.ResolvePathInRootfs(rootfs, filepath.Join(systemdependency.KernelModulesDir,
+		kernel))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve kernel (%s) modules directory:\n%w", kernel, err)
+	}
+
+	linkPath := filepath.Join(kernelDir, kernelBuildLinkName)
+	_, err = os.Lstat(linkPath)
+	if os.IsNotExist(err) {
+		return "build link is missing", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to stat kernel (%s) build link:\n%w", kernel, err)
+	}
+
+	targetPath, err := systemdependency.ResolvePathInRootfs(rootfs, filepath.Join(systemdependency.KernelModulesDir,
+		kernel, kernelBuildLinkName))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve kernel (%s) build link:\n%w", kernel, err)
+	}
+
+	targetInfo, err := os.Stat(targetPath)
+	if os.IsNotExist(err) {
+		// The link itself exists. So, it must be a symlink whose target is missing.
+		target, err := os.Readlink(linkPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read kernel (%s) build link:\n%w", kernel, err)
+		}
+
+		logger.Log.Warnf("Kernel (%s) build link is dangling: target (%s) does not exist", kernel, target)
+		return fmt.Sprintf("build link target (%s) does not exist", target), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to stat kernel (%s) build link target:\n%w", kernel, err)
+	}
+
+	if !targetInfo.IsDir() {
+		return "build link is not a directory", nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestKernelBuildSymlink creates a kernel whose build link points to 'target'. If 'createTarget' is set, the
+// target directory is also created within the rootfs.
+func createTestKernelBuildSymlink(t *testing.T, rootDir string, version string, target string, createTarget bool) {
+	kernelDir := createTestKernelDir(t, rootDir, version)
+
+	err := os.Symlink(target, filepath.Join(kernelDir, kernelBuildLinkName))
+	assert.NoError(t, err)
+
+	if createTarget {
+		targetPath := target
+		if !filepath.IsAbs(targetPath) {
+			targetPath = filepath.Join("/lib/modules", version, targetPath)
+		}
+
+		err = os.MkdirAll(filepath.Join(rootDir, targetPath), os.ModePerm)
+		assert.NoError(t, err)
+	}
+}
+
+func TestFindKernelBuildSymlinkProblemsValid(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelBuildSymlink(t, rootDir, "6.6.47.1-1.azl3", "/usr/src/kernels/6.6.47.1-1.azl3", true)
+	createTestKernelBuildSymlink(t, rootDir, "6.6.51.1-1.azl3", "../../../usr/src/kernels/6.6.51.1-1.azl3", true)
+
+	broken, descriptions, err := findKernelBuildSymlinkProblems(rootDir,
+		[]string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Empty(t, broken)
+	assert.Empty(t, descriptions)
+}
+
+func TestFindKernelBuildSymlinkProblemsDangling(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelBuildSymlink(t, rootDir, "6.6.47.1-1.azl3", "/usr/src/kernels/6.6.47.1-1.azl3", true)
+	createTestKernelBuildSymlink(t, rootDir, "6.6.51.1-1.azl3", "/usr/src/kernels/6.6.51.1-1.azl3", false)
+
+	broken, descriptions, err := findKernelBuildSymlinkProblems(rootDir,
+		[]string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, broken)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3 (build link target (/usr/src/kernels/6.6.51.1-1.azl3) does not exist)"},
+		descriptions)
+}
+
+func TestFindKernelBuildSymlinkProblemsResolvesWithinImage(t *testing.T) {
+	// The target exists on the build host, but not within the image.
+	rootDir := t.TempDir()
+	createTestKernelBuildSymlink(t, rootDir, "6.6.47.1-1.azl3", "/usr", false)
+
+	broken, descriptions, err := findKernelBuildSymlinkProblems(rootDir, []string{"6.6.47.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, broken)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3 (build link target (/usr) does not exist)"}, descriptions)
+}
+
+func TestFindKernelBuildSymlinkProblemsMissing(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	broken, descriptions, err := findKernelBuildSymlinkProblems(rootDir, []string{"6.6.47.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, broken)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3 (build link is missing)"}, descriptions)
+}
+
+func TestFindKernelBuildSymlinkProblemsNotDirectory(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	err := os.WriteFile(filepath.Join(kernelDir, kernelBuildLinkName), nil, 0o644)
+	assert.NoError(t, err)
+
+	broken, descriptions, err := findKernelBuildSymlinkProblems(rootDir, []string{"6.6.47.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, broken)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3 (build link is not a directory)"}, descriptions)
+}
+
+func TestCheckKernelBuildSymlink(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelBuildSymlink(t, rootDir, "6.6.47.1-1.azl3", "/usr/src/kernels/6.6.47.1-1.azl3", true)
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	err := checkKernelBuildSymlink(imageChroot)
+	assert.NoError(t, err)
+
+	createTestKernelBuildSymlink(t, rootDir, "6.6.51.1-1.azl3", "/usr/src/kernels/6.6.51.1-1.azl3", false)
+
+	err = checkKernelBuildSymlink(imageChroot)
+	assert.EqualError(t, err, "kernel build links are broken: "+
+		"6.6.51.1-1.azl3 (build link target (/usr/src/kernels/6.6.51.1-1.azl3) does not exist)")
+}
+
+func TestRunKernelHealthChecksBuildSymlink(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelBuildSymlink(t, rootDir, "6.6.47.1-1.azl3", "/usr/src/kernels/6.6.47.1-1.azl3", false)
+
+	// A broken build link only warns.
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{BuildSymlink: true})
+	assert.NoError(t, err)
+
+	result := findCheckResult(t, results, KernelCheckBuildSymlink)
+	assert.Equal(t, CheckStatusWarn, result.Status)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, result.Versions)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/grub"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+)
+
+const grubMenuEntryCommand = "menuentry"
+
+// checkKernelCmdlineFlags checks that the default kernel's command line contains each of the 'required' flags.
+//
+// A flag without a value (e.g. "slab_nomerge") only needs to be present. A flag with a value (e.g.
+// "lockdown=integrity") needs to be present with that value. If a flag is given more than once, the last one is used,
+// the same as the kernel does for most flags.
+//
+// The command line is read from the image's grub config, with any grub variables (e.g. $mariner_cmdline) expanded. The
+// default kernel is the first linux command that isn't in a recovery menu entry.
+func checkKernelCmdlineFlags(imageChroot *safechroot.Chroot, required []string) error {
+	if len(required) <= 0 {
+		return nil
+	}
+
+	args, err := getDefaultKernelCmdline(imageChroot.RootDir())
+	if err != nil {
+		return err
+	}
+
+	missing := findMissingCmdlineFlags(args, required)
+	if len(missing) > 0 {
+		return fmt.Errorf("kernel command line is missing required flags: %s", strings.Join(missing, ", "))
+	}
+
+	logger.Log.Debugf("Kernel command line has required flags: %s", strings.Join(required, ", "))
+	return nil
+}
+
+// getDefaultKernelCmdline returns the args of the default kernel's command line in the image's grub config.
+func getDefaultKernelCmdline(rootDir string) ([]string, error) {
+	bootloader, err := detectBootloader(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if bootloader != BootloaderGrub {
+		return nil, fmt.Errorf("failed to read kernel command line: unsupported bootloader (%s)", bootloader)
+	}
+
+	grubCfgPath, err := findGrubCfg(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	inRecoveryMenuEntry := false
+	args := []string(nil)
+	err = walkGrubConfig(rootDir, grubCfgPath, func(line grub.Line, vars map[string]string) error {
+		switch {
+		case grub.IsTokenKeyword(line.Tokens[0], grubMenuEntryCommand):
+			inRecoveryMenuEntry = len(line.Tokens) > 1 && strings.Contains(line.Tokens[1].RawContent, "recovery")
+
+		case grub.IsTokenKeyword(line.Tokens[0], linuxCommand) && !found && !inRecoveryMenuEntry:
+			if len(line.Tokens) < 2 {
+				return fmt.Errorf("grub config '%s' command is missing file path arg", linuxCommand)
+			}
+
+			// Skip the kernel binary path arg. A variable may expand to several args (e.g. $mariner_cmdline).
+			for _, token := range line.Tokens[2:] {
+				args = append(args, strings.Fields(expandGrubWord(token, vars))...)
+			}
+			found = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("failed to find default kernel's '%s' command in grub config (%s)", linuxCommand,
+			grubCfgPath)
+	}
+
+	return args, nil
+}
+
+// findMissingCmdlineFlags returns the 'required' flags that aren't satisfied by the command line 'args'. A flag whose
+// value doesn't match is listed along with the value that was found.
+func findMissingCmdlineFlags(args []string, required []string) []string {
+	missing := []string(nil)
+	for _, flag := range required {
+		name, requiredValue, hasValue := strings.Cut(flag, "=")
+
+		found := false
+		foundArg := ""
+		for _, arg := range args {
+			argName, _, _ := strings.Cut(arg, "=")
+			if argName == name {
+				found = true
+				foundArg = arg
+			}
+		}
+
+		switch {
+		case !found:
+			missing = append(missing, flag)
+
+		case hasValue && foundArg != name+"="+requiredValue:
+			missing = append(missing, fmt.Sprintf("%s (found %s)", flag, foundArg))
+		}
+	}
+
+	return missing
+}
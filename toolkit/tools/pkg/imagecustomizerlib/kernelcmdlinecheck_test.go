@@ -0,0 +1,98 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCmdlineGrubCfg = `set bootprefix=/boot
+load_env -f $bootprefix/mariner.cfg
+
+menuentry "Azure Linux" {
+	linux $bootprefix/$mariner_linux rd.auto=1 lockdown=integrity $mariner_cmdline
+	initrd $bootprefix/$mariner_initrd
+}
+
+menuentry "Azure Linux (recovery mode)" {
+	linux $bootprefix/$mariner_linux single
+}
+`
+
+const testCmdlineMarinerCfg = `mariner_linux=vmlinuz-6.6.47.1-1.azl3
+mariner_initrd=initramfs-6.6.47.1-1.azl3.img
+mariner_cmdline=init=/lib/systemd/systemd ro slab_nomerge
+`
+
+func createTestCmdlineImage(t *testing.T, grubCfg string) *safechroot.Chroot {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/grub2/grub.cfg", grubCfg)
+	createTestImageFile(t, rootDir, "/boot/mariner.cfg", testCmdlineMarinerCfg)
+
+	return safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+}
+
+func TestCheckKernelCmdlineFlagsPass(t *testing.T) {
+	imageChroot := createTestCmdlineImage(t, testCmdlineGrubCfg)
+
+	err := checkKernelCmdlineFlags(imageChroot, []string{"lockdown=integrity", "slab_nomerge", "init"})
+	assert.NoError(t, err)
+}
+
+func TestCheckKernelCmdlineFlagsMissing(t *testing.T) {
+	imageChroot := createTestCmdlineImage(t, testCmdlineGrubCfg)
+
+	// "single" is only in the recovery menu entry.
+	err := checkKernelCmdlineFlags(imageChroot, []string{"lockdown=confidentiality", "slab_nomerge", "single",
+		"init_on_free=1"})
+	assert.EqualError(t, err, "kernel command line is missing required flags: "+
+		"lockdown=confidentiality (found lockdown=integrity), single, init_on_free=1")
+}
+
+func TestCheckKernelCmdlineFlagsLastValueWins(t *testing.T) {
+	imageChroot := createTestCmdlineImage(t, `menuentry "Azure Linux" {
+	linux /boot/vmlinuz-6.6.47.1-1.azl3 lockdown=integrity lockdown=none
+}
+`)
+
+	err := checkKernelCmdlineFlags(imageChroot, []string{"lockdown=integrity"})
+	assert.EqualError(t, err, "kernel command line is missing required flags: "+
+		"lockdown=integrity (found lockdown=none)")
+}
+
+func TestCheckKernelCmdlineFlagsNoLinuxCommand(t *testing.T) {
+	imageChroot := createTestCmdlineImage(t, "set timeout=0\n")
+
+	err := checkKernelCmdlineFlags(imageChroot, []string{"slab_nomerge"})
+	assert.ErrorContains(t, err, "failed to find default kernel's 'linux' command in grub config")
+}
+
+func TestCheckKernelCmdlineFlagsUnsupportedBootloader(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/efi/EFI/Linux/azl-6.6.47.1-1.azl3.efi", "")
+
+	err := checkKernelCmdlineFlags(safechroot.NewChroot(rootDir, true /*isExistingDir*/), []string{"slab_nomerge"})
+	assert.ErrorContains(t, err, "unsupported bootloader")
+}
+
+func TestCheckCmdlineHealthPass(t *testing.T) {
+	imageChroot := createTestCmdlineImage(t, testCmdlineGrubCfg)
+
+	result, err := checkCmdlineHealth(imageChroot.RootDir(), []string{"lockdown=integrity", "slab_nomerge", "init"})
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusPass, result.Status)
+}
+
+func TestCheckCmdlineHealthMissing(t *testing.T) {
+	imageChroot := createTestCmdlineImage(t, testCmdlineGrubCfg)
+
+	result, err := checkCmdlineHealth(imageChroot.RootDir(), []string{"lockdown=confidentiality", "single"})
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusFail, result.Status)
+	assert.Equal(t, "kernel command line is missing required flags: "+
+		"lockdown=confidentiality (found lockdown=integrity), single", result.Message)
+}
@@ -0,0 +1,199 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+const (
+	// kernelComponentFallbackName is the component name of a kernel that isn't owned by any package.
+	kernelComponentFallbackName = "linux"
+
+	// The package fields are separated by tabs, since a supplier may contain spaces.
+	kernelComponentRpmQueryFormat  = "%{NAME}\t%{VERSION}-%{RELEASE}\t%{ARCH}\t%{VENDOR}\n"
+	kernelComponentDpkgQueryFormat = "${Package}\t${Version}\t${Architecture}\t${Maintainer}\n"
+
+	// rpm prints "(none)" for tags that aren't set.
+	rpmQueryNoneValue = "(none)"
+)
+
+// KernelComponent describes an installed kernel as a software component, for use in a software bill of materials
+// (SBOM). The fields follow the package fields common to SBOM formats (e.g. SPDX), without depending on any of them.
+type KernelComponent struct {
+	// The name of the package that installed the kernel. For example: "kernel". If the kernel isn't owned by a package,
+	// this is "linux".
+	Name string `json:"name"`
+	// The version of the package that installed the kernel. For example: "6.6.47.1-1.azl3". If the kernel isn't owned by
+	// a package, this is the kernel's release.
+	Version string `json:"version"`
+	// For example: "x86_64" (rpm) or "amd64" (dpkg). Empty if unknown.
+	Arch string `json:"arch,omitempty"`
+	// The package's vendor (rpm) or maintainer (dpkg). Empty if unknown.
+	Supplier string `json:"supplier,omitempty"`
+	// The kernel's release string (i.e. uname -r). For example: "6.6.47.1-1.azl3".
+	KernelRelease string `json:"kernelRelease"`
+	// Set if the name, version, arch and supplier were read from the package manager's database.
+	FromPackage bool `json:"fromPackage"`
+}
+
+// ExportKernelComponents returns a component for each installed kernel, ordered from oldest to newest kernel, for
+// feeding into an SBOM generator.
+//
+// Each kernel is correlated with the rpm or dpkg package that owns its modules directory. Kernels that aren't owned by
+// any package, or images without a supported package manager, get a component based on the kernel release alone.
+func ExportKernelComponents(imageChroot *safechroot.Chroot) ([]KernelComponent, error) {
+	kernels, err := systemdependency.GetInstalledKernelVersions(imageChroot.RootDir())
+	if err != nil {
+		return nil, err
+	}
+
+	packageManager, err := getImagePackageManager(imageChroot.RootDir())
+	if err != nil {
+		return nil, err
+	}
+
+	if packageManager == "" {
+		logger.Log.Infof("No supported package manager found: kernel components won't include package metadata")
+	}
+
+	components := []KernelComponent(nil)
+	for _, kernel := range kernels {
+		kernelRelease := kernel.String()
+		kernelDir := filepath.Join(systemdependency.KernelModulesDir, kernelRelease)
+
+		var component KernelComponent
+		switch packageManager {
+		case rpmQueryProgramPath:
+			component, err = getRpmKernelComponent(imageChroot, kernelDir)
+
+		case dpkgQueryProgramPath:
+			component, err = getDpkgKernelComponent(imageChroot, kernelDir)
+
+		default:
+			err = ErrKernelNotPackageOwned
+		}
+		if errors.Is(err, ErrKernelNotPackageOwned) {
+			component, err = newUnpackagedKernelComponent(kernelRelease)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get kernel (%s) component:\n%w", kernelRelease, err)
+		}
+
+		component.KernelRelease = kernelRelease
+		components = append(components, component)
+	}
+
+	return components, nil
+}
+
+// getImagePackageManager returns the path, within the image, of the package manager's query program (i.e.
+// rpmQueryProgramPath or dpkgQueryProgramPath), or an empty string if the image doesn't have a supported one.
+func getImagePackageManager(rootDir string) (string, error) {
+	for _, programPath := range []string{rpmQueryProgramPath, dpkgQueryProgramPath} {
+		exists, err := file.PathExists(filepath.Join(rootDir, programPath))
+		if err != nil {
+			return "", fmt.Errorf("failed to check if (%s) is installed:\n%w", programPath, err)
+		}
+
+		if exists {
+			return programPath, nil
+		}
+	}
+
+	return "", nil
+}
+
+func getRpmKernelComponent(imageChroot *safechroot.Chroot, kernelDir string) (KernelComponent, error) {
+	stdout, stderr, err := runPackageQuery(imageChroot, "rpm", "-qf", "--queryformat", kernelComponentRpmQueryFormat,
+		kernelDir)
+	if err != nil {
+		// rpm reports unowned files on stdout and exits with a non-zero code.
+		if strings.Contains(stdout, "is not owned by any package") {
+			return KernelComponent{}, ErrKernelNotPackageOwned
+		}
+		return KernelComponent{}, fmt.Errorf("failed to query rpm for package of (%s):\n%v\n%w", kernelDir, stderr,
+			err)
+	}
+
+	return parseKernelComponentQuery(stdout)
+}
+
+func getDpkgKernelComponent(imageChroot *safechroot.Chroot, kernelDir string) (KernelComponent, error) {
+	stdout, stderr, err := runPackageQuery(imageChroot, "dpkg-query", "-S", kernelDir)
+	if err != nil {
+		if strings.Contains(stderr, "no path found matching pattern") {
+			return KernelComponent{}, ErrKernelNotPackageOwned
+		}
+		return KernelComponent{}, fmt.Errorf("failed to query dpkg for package of (%s):\n%v\n%w", kernelDir, stderr,
+			err)
+	}
+
+	packageName, err := parseDpkgOwningPackage(stdout)
+	if err != nil {
+		return KernelComponent{}, err
+	}
+
+	stdout, stderr, err = runPackageQuery(imageChroot, "dpkg-query", "-W", "-f", kernelComponentDpkgQueryFormat,
+		packageName)
+	if err != nil {
+		return KernelComponent{}, fmt.Errorf("failed to query dpkg for package (%s):\n%v\n%w", packageName, stderr,
+			err)
+	}
+
+	return parseKernelComponentQuery(stdout)
+}
+
+// parseKernelComponentQuery parses a package query whose lines have the tab separated fields: name, version, arch and
+// supplier. A directory may be owned by more than one package (e.g. kernel and kernel-modules-extra), in which case the
+// first package is used.
+func parseKernelComponentQuery(output string) (KernelComponent, error) {
+	// Only the line breaks are trimmed, since an empty supplier leaves a trailing tab.
+	firstLine, _, _ := strings.Cut(strings.TrimLeft(output, "\n"), "\n")
+
+	fields := strings.Split(firstLine, "\t")
+	if len(fields) != 4 || fields[0] == "" || fields[1] == "" {
+		return KernelComponent{}, fmt.Errorf("invalid package query output (%s)", firstLine)
+	}
+
+	component := KernelComponent{
+		Name:        fields[0],
+		Version:     fields[1],
+		Arch:        fields[2],
+		Supplier:    strings.TrimSpace(fields[3]),
+		FromPackage: true,
+	}
+
+	if component.Arch == rpmQueryNoneValue {
+		component.Arch = ""
+	}
+	if component.Supplier == rpmQueryNoneValue {
+		component.Supplier = ""
+	}
+
+	return component, nil
+}
+
+// newUnpackagedKernelComponent returns the component of a kernel that isn't owned by a package. For example, a kernel
+// that was built and copied into the image by hand.
+func newUnpackagedKernelComponent(kernelRelease string) (KernelComponent, error) {
+	release, err := systemdependency.ParseKernelRelease(kernelRelease)
+	if err != nil {
+		return KernelComponent{}, err
+	}
+
+	return KernelComponent{
+		Name:    kernelComponentFallbackName,
+		Version: kernelRelease,
+		Arch:    release.Arch,
+	}, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// setTestPackageQueryResponses replaces the package manager query with one that returns the output registered for the
+// query's arguments (e.g. "rpm -qf ..."). Unregistered queries fail.
+func setTestPackageQueryResponses(t *testing.T, responses map[string][3]string) {
+	originalQuery := runPackageQuery
+	runPackageQuery = func(imageChroot *safechroot.Chroot, program string, queryArgs ...string) (string, string,
+		error,
+	) {
+		query := strings.Join(append([]string{program}, queryArgs...), " ")
+
+		response, found := responses[query]
+		if !found {
+			return "", "", fmt.Errorf("unexpected query (%s)", query)
+		}
+
+		var err error
+		if response[2] != "" {
+			err = fmt.Errorf("%s", response[2])
+		}
+		return response[0], response[1], err
+	}
+	t.Cleanup(func() { runPackageQuery = originalQuery })
+}
+
+func TestExportKernelComponentsRpm(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, rpmQueryProgramPath)
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3.custom")
+
+	rpmQuery := "rpm -qf --queryformat " + kernelComponentRpmQueryFormat + " /lib/modules/"
+	setTestPackageQueryResponses(t, map[string][3]string{
+		rpmQuery + "6.6.47.1-1.azl3": {
+			"kernel\t6.6.47.1-1.azl3\tx86_64\tMicrosoft Corporation\n" +
+				"kernel-modules-extra\t6.6.47.1-1.azl3\tx86_64\tMicrosoft Corporation\n",
+			"", "",
+		},
+		rpmQuery + "6.6.51.1-1.azl3.custom": {
+			"file /lib/modules/6.6.51.1-1.azl3.custom is not owned by any package\n", "", "exit status 1",
+		},
+	})
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	components, err := ExportKernelComponents(imageChroot)
+	assert.NoError(t, err)
+	assert.Equal(t, []KernelComponent{
+		{
+			Name:          "kernel",
+			Version:       "6.6.47.1-1.azl3",
+			Arch:          "x86_64",
+			Supplier:      "Microsoft Corporation",
+			KernelRelease: "6.6.47.1-1.azl3",
+			FromPackage:   true,
+		},
+		{
+			Name:          "linux",
+			Version:       "6.6.51.1-1.azl3.custom",
+			KernelRelease: "6.6.51.1-1.azl3.custom",
+		},
+	}, components)
+}
+
+func TestExportKernelComponentsRpmNoneValues(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, rpmQueryProgramPath)
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	setTestPackageQuery(t, "kernel\t6.6.47.1-1.azl3\tx86_64\t(none)\n", "", nil)
+
+	components, err := ExportKernelComponents(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.NoError(t, err)
+	assert.Len(t, components, 1)
+	assert.Equal(t, "", components[0].Supplier)
+}
+
+func TestExportKernelComponentsDpkg(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, dpkgQueryProgramPath)
+	createTestKernelDir(t, rootDir, "5.15.0-1064-azure")
+
+	setTestPackageQueryResponses(t, map[string][3]string{
+		"dpkg-query -S /lib/modules/5.15.0-1064-azure": {
+			"linux-modules-5.15.0-1064-azure:amd64, linux-image-5.15.0-1064-azure: /lib/modules/5.15.0-1064-azure\n",
+			"", "",
+		},
+		"dpkg-query -W -f " + kernelComponentDpkgQueryFormat + " linux-modules-5.15.0-1064-azure": {
+			"linux-modules-5.15.0-1064-azure\t5.15.0-1064.73\tamd64\tUbuntu Kernel Team <kernel-team@lists.ubuntu.com>\n",
+			"", "",
+		},
+	})
+
+	components, err := ExportKernelComponents(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.NoError(t, err)
+	assert.Equal(t, []KernelComponent{
+		{
+			Name:          "linux-modules-5.15.0-1064-azure",
+			Version:       "5.15.0-1064.73",
+			Arch:          "amd64",
+			Supplier:      "Ubuntu Kernel Team <kernel-team@lists.ubuntu.com>",
+			KernelRelease: "5.15.0-1064-azure",
+			FromPackage:   true,
+		},
+	}, components)
+}
+
+func TestExportKernelComponentsNoPackageManager(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3.x86_64")
+
+	components, err := ExportKernelComponents(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.NoError(t, err)
+	assert.Equal(t, []KernelComponent{
+		{
+			Name:          "linux",
+			Version:       "6.6.47.1-1.azl3.x86_64",
+			Arch:          "x86_64",
+			KernelRelease: "6.6.47.1-1.azl3.x86_64",
+		},
+	}, components)
+}
+
+func TestExportKernelComponentsInvalidQueryOutput(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, rpmQueryProgramPath)
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	setTestPackageQuery(t, "kernel 6.6.47.1-1.azl3\n", "", nil)
+
+	_, err := ExportKernelComponents(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.ErrorContains(t, err, "failed to get kernel (6.6.47.1-1.azl3) component")
+	assert.ErrorContains(t, err, "invalid package query output (kernel 6.6.47.1-1.azl3)")
+}
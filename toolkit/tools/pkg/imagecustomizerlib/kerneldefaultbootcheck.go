@@ -0,0 +1,275 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/grub"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+)
+
+const (
+	grubDefaultVar     = "default"
+	grubMenuEntryIdArg = "--id"
+
+	bootLoaderConfPath       = "loader/loader.conf"
+	bootLoaderConfDefaultKey = "default"
+	bootLoaderEntryTitleKey  = "title"
+)
+
+// bootMenuEntry is a boot menu entry that a bootloader's default may select.
+type bootMenuEntry struct {
+	// The entry's title, or its file name for a Boot Loader Specification entry without a title.
+	Name string
+	// The kernel binary's path, as written in the bootloader config. Empty if the entry doesn't have a kernel.
+	Kernel string
+}
+
+// checkSingleDefaultBootKernel checks that the bootloader's default selects exactly one boot menu entry, so that the
+// kernel that boots by default is deterministic. An error is returned if it doesn't. See checkDefaultBootEntryHealth
+// for how the default is matched.
+func checkSingleDefaultBootKernel(imageChroot *safechroot.Chroot) error {
+	result, err := checkDefaultBootEntryHealth(imageChroot.RootDir())
+	if err != nil {
+		return err
+	}
+
+	if result.Status == CheckStatusFail {
+		return errors.New(result.Message)
+	}
+
+	logger.Log.Infof("Checked default boot entry: %s", result.Message)
+	return nil
+}
+
+// checkDefaultBootEntryHealth checks that the bootloader's default selects exactly one boot menu entry, so that the
+// kernel that boots by default is deterministic.
+//
+// For grub, the default is the 'default' variable, which is either an entry's index, title or id. For systemd-boot, the
+// default is the 'default' glob pattern in loader.conf, which is matched against the entry file names. The check fails
+// if the default isn't set, doesn't match any entry or matches more than one entry. Grub submenus aren't supported.
+func checkDefaultBootEntryHealth(rootDir string) (CheckResult, error) {
+	defaultValue, entries, err := resolveDefaultBootEntries(rootDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	message := ""
+	switch {
+	case defaultValue == "":
+		message = "no default boot entry is set"
+
+	case len(entries) <= 0:
+		message = fmt.Sprintf("default boot entry (%s) doesn't match any boot menu entry", defaultValue)
+
+	case len(entries) > 1:
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name
+		}
+
+		message = fmt.Sprintf("default boot entry (%s) is ambiguous: it matches multiple boot menu entries (%s)",
+			defaultValue, strings.Join(names, ", "))
+
+	case entries[0].Kernel == "":
+		message = fmt.Sprintf("default boot entry (%s) doesn't have a kernel", entries[0].Name)
+	}
+
+	if message != "" {
+		return CheckResult{
+			Name:    BootCheckDefaultEntry,
+			Status:  CheckStatusFail,
+			Message: message,
+		}, nil
+	}
+
+	return CheckResult{
+		Name:    BootCheckDefaultEntry,
+		Status:  CheckStatusPass,
+		Message: fmt.Sprintf("default boot entry (%s) boots kernel (%s)", entries[0].Name, entries[0].Kernel),
+	}, nil
+}
+
+// resolveDefaultBootEntries returns the value of the bootloader's default and the boot menu entries that it selects.
+// If the default isn't set, an empty value is returned.
+func resolveDefaultBootEntries(rootDir string) (string, []bootMenuEntry, error) {
+	bootloader, err := detectBootloader(rootDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch bootloader {
+	case BootloaderGrub:
+		return resolveGrubDefaultEntries(rootDir)
+
+	case BootloaderSystemdBoot:
+		return resolveBootLoaderEntryDefaultEntries(rootDir)
+
+	default:
+		return "", nil, fmt.Errorf("failed to resolve default boot entry: unsupported bootloader (%s)", bootloader)
+	}
+}
+
+// resolveGrubDefaultEntries returns the value of the grub config's 'default' variable and the menu entries that it
+// selects.
+func resolveGrubDefaultEntries(rootDir string) (string, []bootMenuEntry, error) {
+	grubCfgPath, err := findGrubCfg(rootDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	type grubMenuEntry struct {
+		bootMenuEntry
+		id string
+	}
+
+	defaultValue := ""
+	menuEntries := []grubMenuEntry(nil)
+	err = walkGrubConfig(rootDir, grubCfgPath, func(line grub.Line, vars map[string]string) error {
+		defaultValue = vars[grubDefaultVar]
+
+		switch {
+		case grub.IsTokenKeyword(line.Tokens[0], grubMenuEntryCommand):
+			if len(line.Tokens) < 2 {
+				return fmt.Errorf("grub config '%s' command is missing title arg", grubMenuEntryCommand)
+			}
+
+			menuEntries = append(menuEntries, grubMenuEntry{
+				bootMenuEntry: bootMenuEntry{Name: expandGrubWord(line.Tokens[1], vars)},
+				id:            getGrubMenuEntryId(line, vars),
+			})
+
+		case grub.IsTokenKeyword(line.Tokens[0], linuxCommand) && len(menuEntries) > 0:
+			if len(line.Tokens) < 2 {
+				return fmt.Errorf("grub config '%s' command is missing file path arg", linuxCommand)
+			}
+
+			menuEntries[len(menuEntries)-1].Kernel = expandGrubWord(line.Tokens[1], vars)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if defaultValue == "" {
+		return "", nil, nil
+	}
+
+	index, err := strconv.Atoi(defaultValue)
+	if err == nil {
+		if index < 0 || index >= len(menuEntries) {
+			return defaultValue, nil, nil
+		}
+
+		return defaultValue, []bootMenuEntry{menuEntries[index].bootMenuEntry}, nil
+	}
+
+	matches := []bootMenuEntry(nil)
+	for _, menuEntry := range menuEntries {
+		if menuEntry.Name == defaultValue || menuEntry.id == defaultValue {
+			matches = append(matches, menuEntry.bootMenuEntry)
+		}
+	}
+
+	return defaultValue, matches, nil
+}
+
+// getGrubMenuEntryId returns the value of a menuentry command's --id arg, or an empty string if it doesn't have one.
+func getGrubMenuEntryId(line grub.Line, vars map[string]string) string {
+	args := line.Tokens[2:]
+	for i, token := range args {
+		arg := expandGrubWord(token, vars)
+
+		id, found := strings.CutPrefix(arg, grubMenuEntryIdArg+"=")
+		if found {
+			return id
+		}
+
+		if arg == grubMenuEntryIdArg && i+1 < len(args) {
+			return expandGrubWord(args[i+1], vars)
+		}
+	}
+
+	return ""
+}
+
+// resolveBootLoaderEntryDefaultEntries returns the value of loader.conf's 'default' key and the Boot Loader
+// Specification entries that it selects. The default is a glob pattern that is matched against the entry's file name,
+// with or without the .conf extension.
+func resolveBootLoaderEntryDefaultEntries(rootDir string) (string, []bootMenuEntry, error) {
+	defaultValue, err := readBootLoaderConfDefault(rootDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if defaultValue == "" {
+		return "", nil, nil
+	}
+
+	entryFiles, err := findBootLoaderEntryFiles(rootDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	matches := []bootMenuEntry(nil)
+	for _, entryFile := range entryFiles {
+		entryId := filepath.Base(entryFile)
+
+		matched, err := path.Match(defaultValue, entryId)
+		if err == nil && !matched {
+			matched, err = path.Match(defaultValue, strings.TrimSuffix(entryId, ".conf"))
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid loader.conf default pattern (%s):\n%w", defaultValue, err)
+		}
+
+		if !matched {
+			continue
+		}
+
+		entry, err := readBootLoaderEntry(entryFile)
+		if err != nil {
+			return "", nil, err
+		}
+
+		name := entry[bootLoaderEntryTitleKey]
+		if name == "" {
+			name = entryId
+		}
+
+		matches = append(matches, bootMenuEntry{Name: name, Kernel: entry[bootLoaderEntryLinuxKey]})
+	}
+
+	return defaultValue, matches, nil
+}
+
+// readBootLoaderConfDefault returns the value of the 'default' key of the image's systemd-boot loader.conf, or an empty
+// string if it isn't set.
+func readBootLoaderConfDefault(rootDir string) (string, error) {
+	for _, espDir := range espDirs {
+		loaderConfPath := filepath.Join(rootDir, espDir, bootLoaderConfPath)
+
+		loaderConf, err := readBootLoaderEntry(loaderConfPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return loaderConf[bootLoaderConfDefaultKey], nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDefaultBootGrubMenu = `
+menuentry "Azure Linux" --id azl-6.6.47.1 {
+	linux /boot/vmlinuz-6.6.47.1-1.azl3
+}
+
+menuentry "Azure Linux" --id=azl-6.6.51.1 {
+	linux /boot/vmlinuz-6.6.51.1-1.azl3
+}
+
+menuentry "Azure Linux (6.6.57.1-1.azl3)" {
+	linux /boot/vmlinuz-6.6.57.1-1.azl3
+}
+`
+
+func checkTestDefaultBootEntry(t *testing.T, files map[string]string) (CheckResult, error) {
+	rootDir := t.TempDir()
+	for filePath, content := range files {
+		createTestImageFile(t, rootDir, filePath, content)
+	}
+
+	return checkDefaultBootEntryHealth(rootDir)
+}
+
+func TestCheckDefaultBootEntryHealthGrub(t *testing.T) {
+	defaults := []string{
+		"set default=2\n",
+		"set default=\"Azure Linux (6.6.57.1-1.azl3)\"\n",
+		"set default=azl-6.6.51.1\n",
+		// The default may be loaded from the grub env file.
+		"load_env -f /boot/grub2/grubenv\nset default=\"${saved_entry}\"\n",
+	}
+
+	for _, grubDefault := range defaults {
+		result, err := checkTestDefaultBootEntry(t, map[string]string{
+			"/boot/grub2/grub.cfg": grubDefault + testDefaultBootGrubMenu,
+			"/boot/grub2/grubenv":  "# GRUB Environment Block\nsaved_entry=azl-6.6.47.1\n",
+		})
+		assert.NoError(t, err, "default (%s)", grubDefault)
+		assert.Equal(t, CheckStatusPass, result.Status, "default (%s)", grubDefault)
+	}
+}
+
+func TestCheckDefaultBootEntryHealthGrubNoDefault(t *testing.T) {
+	result, err := checkTestDefaultBootEntry(t, map[string]string{
+		"/boot/grub2/grub.cfg": testDefaultBootGrubMenu,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusFail, result.Status)
+	assert.Equal(t, "no default boot entry is set", result.Message)
+
+	result, err = checkTestDefaultBootEntry(t, map[string]string{
+		"/boot/grub2/grub.cfg": "set default=3\n" + testDefaultBootGrubMenu,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusFail, result.Status)
+	assert.Equal(t, "default boot entry (3) doesn't match any boot menu entry", result.Message)
+}
+
+func TestCheckDefaultBootEntryHealthGrubMultipleDefaults(t *testing.T) {
+	result, err := checkTestDefaultBootEntry(t, map[string]string{
+		"/boot/grub2/grub.cfg": "set default=\"Azure Linux\"\n" + testDefaultBootGrubMenu,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusFail, result.Status)
+	assert.Equal(t, "default boot entry (Azure Linux) is ambiguous: it matches multiple boot menu entries "+
+		"(Azure Linux, Azure Linux)", result.Message)
+}
+
+func TestCheckDefaultBootEntryHealthSystemdBoot(t *testing.T) {
+	entries := map[string]string{
+		"/boot/efi/loader/entries/azl-6.6.47.1-1.azl3.conf": "title Azure Linux 6.6.47\nlinux /vmlinuz-6.6.47.1-1.azl3\n",
+		"/boot/efi/loader/entries/azl-6.6.51.1-1.azl3.conf": "title Azure Linux 6.6.51\nlinux /vmlinuz-6.6.51.1-1.azl3\n",
+	}
+
+	withLoaderConf := func(loaderConf string) map[string]string {
+		files := map[string]string{"/boot/efi/loader/loader.conf": loaderConf}
+		for filePath, content := range entries {
+			files[filePath] = content
+		}
+		return files
+	}
+
+	result, err := checkTestDefaultBootEntry(t, withLoaderConf("timeout 0\ndefault azl-6.6.51.1-1.azl3.conf\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "default boot entry (Azure Linux 6.6.51) boots kernel (/vmlinuz-6.6.51.1-1.azl3)", result.Message)
+
+	// The pattern may leave out the .conf extension.
+	result, err = checkTestDefaultBootEntry(t, withLoaderConf("default azl-6.6.47.*\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusPass, result.Status)
+
+	result, err = checkTestDefaultBootEntry(t, withLoaderConf("timeout 0\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusFail, result.Status)
+	assert.Equal(t, "no default boot entry is set", result.Message)
+
+	result, err = checkTestDefaultBootEntry(t, entries)
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusFail, result.Status)
+	assert.Equal(t, "no default boot entry is set", result.Message)
+
+	result, err = checkTestDefaultBootEntry(t, withLoaderConf("default azl-*\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusFail, result.Status)
+	assert.Equal(t, "default boot entry (azl-*) is ambiguous: it matches multiple boot menu entries "+
+		"(Azure Linux 6.6.47, Azure Linux 6.6.51)", result.Message)
+}
+
+func TestCheckDefaultBootEntryHealthUnsupportedBootloader(t *testing.T) {
+	_, err := checkTestDefaultBootEntry(t, map[string]string{
+		"/boot/efi/EFI/Linux/azl-6.6.47.1-1.azl3.efi": "",
+	})
+	assert.ErrorContains(t, err, "unsupported bootloader (uki)")
+}
+
+func TestCheckSingleDefaultBootKernel(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestImageFile(t, rootDir, "/boot/grub2/grub.cfg", "set default=azl-6.6.51.1\n"+testDefaultBootGrubMenu)
+
+	err := checkSingleDefaultBootKernel(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.NoError(t, err)
+
+	createTestImageFile(t, rootDir, "/boot/grub2/grub.cfg", "set default=\"Azure Linux\"\n"+testDefaultBootGrubMenu)
+
+	err = checkSingleDefaultBootKernel(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.EqualError(t, err, "default boot entry (Azure Linux) is ambiguous: it matches multiple boot menu entries "+
+		"(Azure Linux, Azure Linux)")
+}
@@ -0,0 +1,614 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+const (
+	KernelCheckInstalledKernel = "installed-kernel"
+	KernelCheckInitramfs       = "initramfs"
+	KernelCheckModulesDep      = "modules-dep"
+	KernelCheckBootConsistency = "boot-consistency"
+	KernelCheckFirmware        = "firmware"
+	KernelCheckCompression     = "module-compression"
+	KernelCheckVermagic        = "vermagic"
+	KernelCheckBuildSymlink    = "build-symlink"
+	KernelCheckOrphanModules   = "orphan-modules"
+	KernelCheckSystemMap       = "system-map"
+	KernelCheckDuplicateSeries = "duplicate-series"
+	KernelCheckModuleAliases   = "module-aliases"
+	KernelCheckUsrMerge        = "usr-merge"
+
+	bootDir       = "/boot"
+	vmlinuzPrefix = "vmlinuz-"
+)
+
+type CheckStatus string
+
+const (
+	CheckStatusPass CheckStatus = "pass"
+	CheckStatusWarn CheckStatus = "warn"
+	CheckStatusFail CheckStatus = "fail"
+	// The check didn't apply to the image. For example, the image has no /boot directory.
+	CheckStatusSkipped CheckStatus = "skipped"
+)
+
+// CheckResult is the outcome of a single kernel health check.
+type CheckResult struct {
+	// The name of the check. For example: KernelCheckInitramfs.
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	// A human readable description of the outcome. For a skipped check, this is the reason it was skipped.
+	Message string `json:"message,omitempty"`
+	// The kernel versions that caused the check to warn or fail.
+	Versions []string `json:"versions,omitempty"`
+	// Set if the check ran against the build host's root (i.e. "/") instead of an image. So, the kernels are the build
+	// host's kernels.
+	Host bool `json:"host,omitempty"`
+}
+
+// KernelCheckOptions selects which kernel health checks RunKernelHealthChecks runs.
+type KernelCheckOptions struct {
+	InstalledKernel bool
+	Initramfs       bool
+	ModulesDep      bool
+	BootConsistency bool
+	// Warns if a kernel's modules use more than one compression format, which indicates a botched customization.
+	ModuleCompression bool
+	// Scans every module for the firmware it may load. This is slow and only best-effort. So, it is not enabled by
+	// DefaultKernelCheckOptions and only ever warns.
+	Firmware bool
+	// Checks that each kernel's modules directory name matches the release its modules were built for. This is
+	// best-effort, since it samples a single readable module per kernel. So, it is not enabled by
+	// DefaultKernelCheckOptions.
+	Vermagic bool
+	// Checks that each kernel's build link resolves to the kernel headers. Only images that build out-of-tree modules
+	// need the headers. So, it is not enabled by DefaultKernelCheckOptions and only ever warns.
+	BuildSymlink bool
+	// Warns about kernel modules directories without any files in /boot, which are usually left behind by a partially
+	// removed kernel. Images that boot a UKI don't keep kernel files in /boot. So, it is not enabled by
+	// DefaultKernelCheckOptions and only ever warns.
+	OrphanModules bool
+	// Warns about kernels without a /boot/System.map-<ver> file, which debugging and crash analysis tools need.
+	// Minimal images intentionally drop it. So, it is not enabled by DefaultKernelCheckOptions and only ever warns.
+	SystemMap bool
+	// Warns about kernel series (e.g. "6.6") that have more than one installed kernel. Some images intentionally keep a
+	// fallback kernel. So, it is not enabled by DefaultKernelCheckOptions and only ever warns.
+	DuplicateSeries bool
+	// Warns about module aliases that map to different modules in different kernels. Reading every kernel's
+	// modules.alias file is slow and a renamed driver is often expected. So, it is not enabled by
+	// DefaultKernelCheckOptions and only ever warns.
+	ModuleAliases bool
+	// Warns if the image's /lib/modules and /usr/lib/modules are separate directories with different kernels. Only
+	// images part way through the usr-merge transition can have both. So, it is not enabled by
+	// DefaultKernelCheckOptions and only ever warns.
+	UsrMerge bool
+}
+
+// DefaultKernelCheckOptions returns options that enable all of the kernel health checks.
+func DefaultKernelCheckOptions() KernelCheckOptions {
+	return KernelCheckOptions{
+		InstalledKernel:   true,
+		Initramfs:         true,
+		ModulesDep:        true,
+		BootConsistency:   true,
+		ModuleCompression: true,
+	}
+}
+
+type kernelHealthCheck struct {
+	name    string
+	enabled bool
+	// Set if the check needs the list of installed kernels.
+	needsKernels bool
+	// Set if the check reports files that are candidates for removal. Such checks aren't run against the build host's
+	// root, so that they never propose removing the running kernel.
+	suggestsRemoval bool
+	run             func(rootDir string, kernels []string) (CheckResult, error)
+}
+
+// RunKernelHealthChecks runs all of the enabled kernel health checks against the image.
+// Unlike checkForInstalledKernel, a failing check doesn't stop the remaining checks from running. The result of every
+// check that ran is returned. If any check failed, an error summarizing the failed checks is also returned.
+//
+// If the chroot's root is the build host's root (i.e. "/"), the results are marked as Host and the checks that suggest
+// removing files (e.g. KernelCheckOrphanModules) are skipped.
+func RunKernelHealthChecks(imageChroot *safechroot.Chroot, opts KernelCheckOptions) ([]CheckResult, error) {
+	return runKernelHealthChecks(imageChroot.RootDir(), opts)
+}
+
+// kernelHealthChecks returns the kernel health checks, in the order that they are run.
+func kernelHealthChecks(opts KernelCheckOptions) []kernelHealthCheck {
+	return []kernelHealthCheck{
+		{KernelCheckInstalledKernel, opts.InstalledKernel, true, false, checkInstalledKernelHealth},
+		{KernelCheckInitramfs, opts.Initramfs, true, false, checkInitramfsHealth},
+		{KernelCheckModulesDep, opts.ModulesDep, true, false, checkModulesDepHealth},
+		{KernelCheckBootConsistency, opts.BootConsistency, false, false, checkBootConsistencyHealth},
+		{KernelCheckCompression, opts.ModuleCompression, true, false, checkModuleCompressionHealth},
+		{KernelCheckFirmware, opts.Firmware, true, false, checkFirmwareHealth},
+		{KernelCheckVermagic, opts.Vermagic, true, false, checkVermagicHealth},
+		{KernelCheckBuildSymlink, opts.BuildSymlink, true, false, checkBuildSymlinkHealth},
+		{KernelCheckOrphanModules, opts.OrphanModules, true, true, checkOrphanModulesHealth},
+		{KernelCheckSystemMap, opts.SystemMap, true, false, checkSystemMapHealth},
+		{KernelCheckDuplicateSeries, opts.DuplicateSeries, true, false, checkDuplicateSeriesHealth},
+		{KernelCheckModuleAliases, opts.ModuleAliases, false, false, checkModuleAliasesHealth},
+		{KernelCheckUsrMerge, opts.UsrMerge, false, false, checkUsrMergeHealth},
+	}
+}
+
+func runKernelHealthChecks(rootDir string, opts KernelCheckOptions) ([]CheckResult, error) {
+	checks := kernelHealthChecks(opts)
+
+	// A failure to list the kernels is recorded against the individual checks, so that checks that don't need the
+	// list can still run.
+	kernels, kernelsErr := systemdependency.GetInstalledKernelStringVersions(rootDir)
+
+	isHost := systemdependency.IsHostRootfs(rootDir)
+	if isHost {
+		logger.Log.Warnf("Running kernel checks against the build host's root (%s), instead of an image", rootDir)
+	}
+
+	results := []CheckResult(nil)
+	failedChecks := []string(nil)
+	for _, check := range checks {
+		if !check.enabled {
+			continue
+		}
+
+		var result CheckResult
+		var err error
+		switch {
+		case isHost && check.suggestsRemoval:
+			result = newSkippedCheckResult(check.name, "not run against the build host's root")
+
+		case check.needsKernels && kernelsErr != nil:
+			err = kernelsErr
+
+		case check.needsKernels && len(kernels) <= 0 && check.name != KernelCheckInstalledKernel:
+			// The installed-kernel check reports the lack of kernels. The other checks have nothing to check.
+			result = newSkippedCheckResult(check.name, "no installed kernels")
+
+		default:
+			result, err = check.run(rootDir, kernels)
+		}
+		if err != nil {
+			result = CheckResult{
+				Name:    check.name,
+				Status:  CheckStatusFail,
+				Message: err.Error(),
+			}
+		}
+
+		result.Host = isHost
+
+		logKernelCheckResult(result)
+		if result.Status == CheckStatusFail {
+			failedChecks = append(failedChecks, result.Name)
+		}
+
+		results = append(results, result)
+	}
+
+	if len(failedChecks) > 0 {
+		return results, fmt.Errorf("kernel health checks failed: %s", strings.Join(failedChecks, ", "))
+	}
+
+	return results, nil
+}
+
+// logKernelCheckResult logs the outcome of a check at a level that matches its status.
+func logKernelCheckResult(result CheckResult) {
+	switch result.Status {
+	case CheckStatusFail:
+		logger.Log.Errorf("Kernel check (%s) failed: %s", result.Name, result.Message)
+
+	case CheckStatusWarn:
+		logger.Log.Warnf("Kernel check (%s) warning: %s", result.Name, result.Message)
+
+	case CheckStatusSkipped:
+		logger.Log.Infof("Kernel check (%s) skipped: %s", result.Name, result.Message)
+
+	default:
+		logger.Log.Debugf("Kernel check (%s) passed", result.Name)
+	}
+}
+
+func checkInstalledKernelHealth(rootDir string, kernels []string) (CheckResult, error) {
+	if len(kernels) <= 0 {
+		return CheckResult{
+			Name:    KernelCheckInstalledKernel,
+			Status:  CheckStatusFail,
+			Message: "no installed kernel found",
+		}, nil
+	}
+
+	return CheckResult{
+		Name:     KernelCheckInstalledKernel,
+		Status:   CheckStatusPass,
+		Message:  fmt.Sprintf("found %d installed kernel(s)", len(kernels)),
+		Versions: kernels,
+	}, nil
+}
+
+func checkInitramfsHealth(rootDir string, kernels []string) (CheckResult, error) {
+	skipped, result, err := skipIfNoBootDir(rootDir, KernelCheckInitramfs)
+	if err != nil || skipped {
+		return result, err
+	}
+
+	missing := []string(nil)
+	for _, kernel := range kernels {
+		initramfsPath, err := findKernelInitramfs(rootDir, kernel)
+		if err != nil {
+			return CheckResult{}, err
+		}
+
+		if initramfsPath == "" {
+			missing = append(missing, kernel)
+		}
+	}
+
+	return newKernelListCheckResult(KernelCheckInitramfs, CheckStatusFail, missing, "missing initramfs"), nil
+}
+
+func checkModulesDepHealth(rootDir string, kernels []string) (CheckResult, error) {
+	missing := []string(nil)
+	for _, kernel := range kernels {
+		modulesDepPath := filepath.Join(rootDir, systemdependency.KernelModulesDir, kernel, "modules.dep")
+
+		exists, err := file.PathExists(modulesDepPath)
+		if err != nil {
+			return CheckResult{}, fmt.Errorf("failed to check if (%s) exists:\n%w", modulesDepPath, err)
+		}
+
+		if !exists {
+			missing = append(missing, kernel)
+		}
+	}
+
+	return newKernelListCheckResult(KernelCheckModulesDep, CheckStatusFail, missing, "missing modules.dep"), nil
+}
+
+// checkBootConsistencyHealth checks that every kernel binary in /boot has a matching modules directory.
+func checkBootConsistencyHealth(rootDir string, kernels []string) (CheckResult, error) {
+	skipped, result, err := skipIfNoBootDir(rootDir, KernelCheckBootConsistency)
+	if err != nil || skipped {
+		return result, err
+	}
+
+	bootKernels, err := getBootKernelVersions(rootDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	missing := []string(nil)
+	for _, bootKernel := range bootKernels {
+		modulesDir := filepath.Join(rootDir, systemdependency.KernelModulesDir, bootKernel)
+
+		exists, err := file.DirExists(modulesDir)
+		if err != nil {
+			return CheckResult{}, fmt.Errorf("failed to check if (%s) exists:\n%w", modulesDir, err)
+		}
+
+		if !exists {
+			missing = append(missing, bootKernel)
+		}
+	}
+
+	return newKernelListCheckResult(KernelCheckBootConsistency, CheckStatusFail, missing,
+		"kernel in /boot has no modules directory"), nil
+}
+
+func checkModuleCompressionHealth(rootDir string, kernels []string) (CheckResult, error) {
+	mixed := []string(nil)
+	for _, kernel := range kernels {
+		counts, err := systemdependency.CountModuleCompression(rootDir, kernel)
+		if err != nil {
+			return CheckResult{}, err
+		}
+
+		if len(counts) > 1 {
+			mixed = append(mixed, kernel)
+		}
+	}
+
+	return newKernelListCheckResult(KernelCheckCompression, CheckStatusWarn, mixed,
+		"kernel modules use mixed compression formats"), nil
+}
+
+func checkFirmwareHealth(rootDir string, kernels []string) (CheckResult, error) {
+	affected := []string(nil)
+	messages := []string(nil)
+	for _, kernel := range kernels {
+		missing, err := systemdependency.GetMissingKernelFirmware(rootDir, kernel)
+		if err != nil {
+			return CheckResult{}, err
+		}
+
+		if len(missing) > 0 {
+			affected = append(affected, kernel)
+			messages = append(messages, fmt.Sprintf("%s: %s", kernel, strings.Join(missing, ", ")))
+		}
+	}
+
+	if len(affected) <= 0 {
+		return CheckResult{
+			Name:   KernelCheckFirmware,
+			Status: CheckStatusPass,
+		}, nil
+	}
+
+	return CheckResult{
+		Name:     KernelCheckFirmware,
+		Status:   CheckStatusWarn,
+		Message:  fmt.Sprintf("missing firmware (%s)", strings.Join(messages, "; ")),
+		Versions: affected,
+	}, nil
+}
+
+func checkVermagicHealth(rootDir string, kernels []string) (CheckResult, error) {
+	mismatched, descriptions, err := findKernelDirVermagicMismatches(rootDir, kernels)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	if len(mismatched) <= 0 {
+		return CheckResult{
+			Name:   KernelCheckVermagic,
+			Status: CheckStatusPass,
+		}, nil
+	}
+
+	return CheckResult{
+		Name:   KernelCheckVermagic,
+		Status: CheckStatusFail,
+		Message: fmt.Sprintf("kernel modules were built for a different kernel release: %s",
+			strings.Join(descriptions, ", ")),
+		Versions: mismatched,
+	}, nil
+}
+
+func checkBuildSymlinkHealth(rootDir string, kernels []string) (CheckResult, error) {
+	broken, descriptions, err := findKernelBuildSymlinkProblems(rootDir, kernels)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	if len(broken) <= 0 {
+		return CheckResult{
+			Name:   KernelCheckBuildSymlink,
+			Status: CheckStatusPass,
+		}, nil
+	}
+
+	return CheckResult{
+		Name:     KernelCheckBuildSymlink,
+		Status:   CheckStatusWarn,
+		Message:  fmt.Sprintf("kernel build links are broken: %s", strings.Join(descriptions, ", ")),
+		Versions: broken,
+	}, nil
+}
+
+func checkOrphanModulesHealth(rootDir string, kernels []string) (CheckResult, error) {
+	skipped, result, err := skipIfNoBootDir(rootDir, KernelCheckOrphanModules)
+	if err != nil || skipped {
+		return result, err
+	}
+
+	orphans, err := findOrphanModuleDirs(rootDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	return newKernelListCheckResult(KernelCheckOrphanModules, CheckStatusWarn, orphans,
+		"kernel modules directory has no /boot files"), nil
+}
+
+func checkSystemMapHealth(rootDir string, kernels []string) (CheckResult, error) {
+	skipped, result, err := skipIfNoBootDir(rootDir, KernelCheckSystemMap)
+	if err != nil || skipped {
+		return result, err
+	}
+
+	missing, err := findKernelsMissingSystemMap(rootDir, kernels)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	return newKernelListCheckResult(KernelCheckSystemMap, CheckStatusWarn, missing, "missing System.map"), nil
+}
+
+func checkDuplicateSeriesHealth(rootDir string, kernels []string) (CheckResult, error) {
+	duplicates, descriptions, err := findDuplicateKernelSeries(rootDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	if len(duplicates) <= 0 {
+		return CheckResult{
+			Name:   KernelCheckDuplicateSeries,
+			Status: CheckStatusPass,
+		}, nil
+	}
+
+	return CheckResult{
+		Name:   KernelCheckDuplicateSeries,
+		Status: CheckStatusWarn,
+		Message: fmt.Sprintf("multiple kernels of the same series are installed: %s",
+			strings.Join(descriptions, ", ")),
+		Versions: duplicates,
+	}, nil
+}
+
+func checkModuleAliasesHealth(rootDir string, kernels []string) (CheckResult, error) {
+	conflicts, err := findModuleAliasConflicts(rootDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	if len(conflicts) <= 0 {
+		return CheckResult{
+			Name:   KernelCheckModuleAliases,
+			Status: CheckStatusPass,
+		}, nil
+	}
+
+	descriptions := []string(nil)
+	for _, conflict := range conflicts[:min(len(conflicts), maxReportedModuleAliasConflicts)] {
+		descriptions = append(descriptions, conflict.String())
+	}
+	if len(conflicts) > len(descriptions) {
+		descriptions = append(descriptions, fmt.Sprintf("and %d more", len(conflicts)-len(descriptions)))
+	}
+
+	conflictKernels := []string(nil)
+	for _, conflict := range conflicts {
+		for kernel := range conflict.KernelModules {
+			if !slices.Contains(conflictKernels, kernel) {
+				conflictKernels = append(conflictKernels, kernel)
+			}
+		}
+	}
+	sort.Strings(conflictKernels)
+
+	return CheckResult{
+		Name:   KernelCheckModuleAliases,
+		Status: CheckStatusWarn,
+		Message: fmt.Sprintf("module aliases map to different modules across kernels: %s",
+			strings.Join(descriptions, ", ")),
+		Versions: conflictKernels,
+	}, nil
+}
+
+func checkUsrMergeHealth(rootDir string, kernels []string) (CheckResult, error) {
+	onlyInLib, onlyInUsr, err := findModulesUsrMergeDivergence(rootDir)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	if len(onlyInLib) <= 0 && len(onlyInUsr) <= 0 {
+		return CheckResult{
+			Name:   KernelCheckUsrMerge,
+			Status: CheckStatusPass,
+		}, nil
+	}
+
+	diverged := append(slices.Clone(onlyInLib), onlyInUsr...)
+	sort.Strings(diverged)
+
+	return CheckResult{
+		Name:   KernelCheckUsrMerge,
+		Status: CheckStatusWarn,
+		Message: fmt.Sprintf("kernel modules directories (%s) and (%s) have diverged: only in (%s): [%s], "+
+			"only in (%s): [%s]",
+			systemdependency.KernelModulesDir, usrKernelModulesDir,
+			systemdependency.KernelModulesDir, strings.Join(onlyInLib, ", "),
+			usrKernelModulesDir, strings.Join(onlyInUsr, ", ")),
+		Versions: diverged,
+	}, nil
+}
+
+// skipIfNoBootDir returns a skipped result for the check 'name' if the image doesn't have a /boot directory. For
+// example, container images and images that boot from a UKI on the ESP.
+func skipIfNoBootDir(rootDir string, name string) (bool, CheckResult, error) {
+	bootDirPath := filepath.Join(rootDir, bootDir)
+
+	exists, err := file.DirExists(bootDirPath)
+	if err != nil {
+		return false, CheckResult{}, fmt.Errorf("failed to check if (%s) exists:\n%w", bootDirPath, err)
+	}
+
+	if exists {
+		return false, CheckResult{}, nil
+	}
+
+	return true, newSkippedCheckResult(name, "no /boot directory"), nil
+}
+
+func newSkippedCheckResult(name string, reason string) CheckResult {
+	return CheckResult{
+		Name:    name,
+		Status:  CheckStatusSkipped,
+		Message: reason,
+	}
+}
+
+func newKernelListCheckResult(name string, status CheckStatus, versions []string, problem string) CheckResult {
+	if len(versions) <= 0 {
+		return CheckResult{
+			Name:   name,
+			Status: CheckStatusPass,
+		}
+	}
+
+	return CheckResult{
+		Name:     name,
+		Status:   status,
+		Message:  fmt.Sprintf("%s: %s", problem, strings.Join(versions, ", ")),
+		Versions: versions,
+	}
+}
+
+// findKernelInitramfs returns the path of the initramfs of a kernel, or an empty string if there isn't one.
+// Azure Linux 2.0 names the file "initrd.img-<ver>" while Azure Linux 3.0 names it "initramfs-<ver>.img".
+func findKernelInitramfs(rootDir string, kernel string) (string, error) {
+	for _, fileName := range kernelInitramfsFileNames(kernel) {
+		candidate := filepath.Join(rootDir, bootDir, fileName)
+		exists, err := file.PathExists(candidate)
+		if err != nil {
+			return "", fmt.Errorf("failed to check if (%s) exists:\n%w", candidate, err)
+		}
+
+		if exists {
+			return candidate, nil
+		}
+	}
+
+	return "", nil
+}
+
+// kernelInitramfsFileNames returns the file names, in /boot, that the initramfs of 'kernel' may have, in order of
+// preference.
+func kernelInitramfsFileNames(kernel string) []string {
+	return []string{
+		"initramfs-" + kernel + ".img",
+		"initrd.img-" + kernel,
+	}
+}
+
+// getBootKernelVersions returns the versions of the kernel binaries (vmlinuz-<ver>) in /boot.
+func getBootKernelVersions(rootDir string) ([]string, error) {
+	bootDirPath := filepath.Join(rootDir, bootDir)
+
+	entries, err := os.ReadDir(bootDirPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot directory (%s):\n%w", bootDirPath, err)
+	}
+
+	versions := []string(nil)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), vmlinuzPrefix) {
+			continue
+		}
+
+		versions = append(versions, strings.TrimPrefix(entry.Name(), vmlinuzPrefix))
+	}
+
+	return versions, nil
+}
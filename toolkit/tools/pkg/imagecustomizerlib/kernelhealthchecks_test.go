@@ -0,0 +1,308 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestBootFile creates an empty file under the /boot directory of 'rootDir'.
+func createTestBootFile(t *testing.T, rootDir string, name string) {
+	bootFilePath := filepath.Join(rootDir, "boot", name)
+	err := os.MkdirAll(filepath.Dir(bootFilePath), os.ModePerm)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	err = os.WriteFile(bootFilePath, nil, 0o644)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+}
+
+func findCheckResult(t *testing.T, results []CheckResult, name string) CheckResult {
+	for _, result := range results {
+		if result.Name == name {
+			return result
+		}
+	}
+
+	t.Fatalf("check (%s) not found in results", name)
+	return CheckResult{}
+}
+
+func TestRunKernelHealthChecksAllPass(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "initramfs-6.6.47.1-1.azl3.img")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	results, err := RunKernelHealthChecks(imageChroot, DefaultKernelCheckOptions())
+	assert.NoError(t, err)
+	assert.Len(t, results, 5)
+	for _, result := range results {
+		assert.Equal(t, CheckStatusPass, result.Status, result.Name)
+	}
+
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, findCheckResult(t, results, KernelCheckInstalledKernel).Versions)
+}
+
+func TestRunKernelHealthChecksMixed(t *testing.T) {
+	rootDir := t.TempDir()
+
+	// Good kernel, using the Azure Linux 2.0 initramfs name.
+	createTestKernelDir(t, rootDir, "5.15.153.1-2.cm2")
+	createTestBootFile(t, rootDir, "vmlinuz-5.15.153.1-2.cm2")
+	createTestBootFile(t, rootDir, "initrd.img-5.15.153.1-2.cm2")
+
+	// Kernel without an initramfs.
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.47.1-1.azl3")
+
+	// Kernel binary without a modules directory.
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.51.1-1.azl3")
+
+	results, err := runKernelHealthChecks(rootDir, DefaultKernelCheckOptions())
+	assert.ErrorContains(t, err, "kernel health checks failed: initramfs, boot-consistency")
+	assert.Len(t, results, 5)
+
+	installedResult := findCheckResult(t, results, KernelCheckInstalledKernel)
+	assert.Equal(t, CheckStatusPass, installedResult.Status)
+
+	initramfsResult := findCheckResult(t, results, KernelCheckInitramfs)
+	assert.Equal(t, CheckStatusFail, initramfsResult.Status)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, initramfsResult.Versions)
+
+	modulesDepResult := findCheckResult(t, results, KernelCheckModulesDep)
+	assert.Equal(t, CheckStatusPass, modulesDepResult.Status)
+
+	bootResult := findCheckResult(t, results, KernelCheckBootConsistency)
+	assert.Equal(t, CheckStatusFail, bootResult.Status)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, bootResult.Versions)
+}
+
+func TestRunKernelHealthChecksNoModulesDir(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestBootFile(t, rootDir, "grub2/grub.cfg")
+
+	results, err := runKernelHealthChecks(rootDir, DefaultKernelCheckOptions())
+	assert.ErrorContains(t, err, "installed-kernel, initramfs, modules-dep")
+	assert.Len(t, results, 5)
+
+	installedResult := findCheckResult(t, results, KernelCheckInstalledKernel)
+	assert.Equal(t, CheckStatusFail, installedResult.Status)
+	assert.Contains(t, installedResult.Message, "failed to read installed kernels list")
+
+	bootResult := findCheckResult(t, results, KernelCheckBootConsistency)
+	assert.Equal(t, CheckStatusPass, bootResult.Status)
+}
+
+func TestRunKernelHealthChecksNoBootDir(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	results, err := runKernelHealthChecks(rootDir, DefaultKernelCheckOptions())
+	assert.NoError(t, err)
+	assert.Len(t, results, 5)
+
+	for _, name := range []string{KernelCheckInitramfs, KernelCheckBootConsistency} {
+		result := findCheckResult(t, results, name)
+		assert.Equal(t, CheckStatusSkipped, result.Status, name)
+		assert.Equal(t, "no /boot directory", result.Message, name)
+	}
+
+	assert.Equal(t, CheckStatusPass, findCheckResult(t, results, KernelCheckModulesDep).Status)
+}
+
+func TestRunKernelHealthChecksNoKernels(t *testing.T) {
+	rootDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(rootDir, "lib/modules"), os.ModePerm)
+	assert.NoError(t, err)
+
+	results, err := runKernelHealthChecks(rootDir, DefaultKernelCheckOptions())
+	assert.ErrorContains(t, err, "kernel health checks failed: installed-kernel")
+	assert.Len(t, results, 5)
+
+	assert.Equal(t, CheckStatusFail, findCheckResult(t, results, KernelCheckInstalledKernel).Status)
+
+	for _, name := range []string{KernelCheckInitramfs, KernelCheckModulesDep, KernelCheckCompression} {
+		result := findCheckResult(t, results, name)
+		assert.Equal(t, CheckStatusSkipped, result.Status, name)
+		assert.Equal(t, "no installed kernels", result.Message, name)
+	}
+}
+
+func TestRunKernelHealthChecksDisabledChecks(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{InstalledKernel: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, KernelCheckInstalledKernel, results[0].Name)
+	}
+}
+
+func TestRunKernelHealthChecksFirmware(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	err := os.WriteFile(filepath.Join(kernelDir, "wifi.ko"), []byte("\x00firmware=wifi.bin\x00"), 0o644)
+	assert.NoError(t, err)
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{Firmware: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, CheckStatusWarn, results[0].Status)
+		assert.Equal(t, []string{"6.6.47.1-1.azl3"}, results[0].Versions)
+		assert.Contains(t, results[0].Message, "wifi.bin")
+	}
+
+	err = os.MkdirAll(filepath.Join(rootDir, "lib/firmware"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(rootDir, "lib/firmware/wifi.bin"), nil, 0o644)
+	assert.NoError(t, err)
+
+	results, err = runKernelHealthChecks(rootDir, KernelCheckOptions{Firmware: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, CheckStatusPass, results[0].Status)
+	}
+}
+
+func TestRunKernelHealthChecksMixedModuleCompression(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	err := os.WriteFile(filepath.Join(kernelDir, "a.ko.xz"), nil, 0o644)
+	assert.NoError(t, err)
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{ModuleCompression: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, CheckStatusPass, results[0].Status)
+	}
+
+	err = os.WriteFile(filepath.Join(kernelDir, "b.ko"), nil, 0o644)
+	assert.NoError(t, err)
+
+	results, err = runKernelHealthChecks(rootDir, KernelCheckOptions{ModuleCompression: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, CheckStatusWarn, results[0].Status)
+		assert.Equal(t, []string{"6.6.47.1-1.azl3"}, results[0].Versions)
+	}
+}
+
+func TestRunKernelHealthChecksDuplicateSeries(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.1.0")
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{DuplicateSeries: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, CheckStatusPass, results[0].Status)
+	}
+
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+
+	results, err = runKernelHealthChecks(rootDir, KernelCheckOptions{DuplicateSeries: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, CheckStatusWarn, results[0].Status)
+		assert.Equal(t, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"}, results[0].Versions)
+		assert.Contains(t, results[0].Message, "6.6 (6.6.47.1-1.azl3, 6.6.51.1-1.azl3)")
+	}
+}
+
+func TestRunKernelHealthChecksOptIn(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, rootDir string)
+		opts  KernelCheckOptions
+	}{
+		{
+			name: KernelCheckVermagic,
+			setup: func(t *testing.T, rootDir string) {
+				kernelDir := createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+				createTestKernelModule(t, kernelDir, "kernel/fs/ext4/ext4.ko", "6.6.44.1-1.azl3")
+			},
+			opts: KernelCheckOptions{Vermagic: true},
+		},
+		{
+			name: KernelCheckBuildSymlink,
+			setup: func(t *testing.T, rootDir string) {
+				createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+			},
+			opts: KernelCheckOptions{BuildSymlink: true},
+		},
+		{
+			name: KernelCheckOrphanModules,
+			setup: func(t *testing.T, rootDir string) {
+				createTestKernelDir(t, rootDir, "6.6.9.1-1.azl3")
+				createTestBootFile(t, rootDir, "vmlinuz-6.6.51.1-1.azl3")
+			},
+			opts: KernelCheckOptions{OrphanModules: true},
+		},
+		{
+			name: KernelCheckSystemMap,
+			setup: func(t *testing.T, rootDir string) {
+				createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+				createTestBootFile(t, rootDir, "vmlinuz-6.6.47.1-1.azl3")
+			},
+			opts: KernelCheckOptions{SystemMap: true},
+		},
+		{
+			name: KernelCheckDuplicateSeries,
+			setup: func(t *testing.T, rootDir string) {
+				createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+				createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+			},
+			opts: KernelCheckOptions{DuplicateSeries: true},
+		},
+		{
+			name: KernelCheckModuleAliases,
+			setup: func(t *testing.T, rootDir string) {
+				createTestModulesAlias(t, rootDir, "6.6.47.1-1.azl3", "alias fs-virtiofs virtiofs\n")
+				createTestModulesAlias(t, rootDir, "6.6.51.1-1.azl3", "alias fs-virtiofs virtio_fs_next\n")
+			},
+			opts: KernelCheckOptions{ModuleAliases: true},
+		},
+		{
+			name: KernelCheckUsrMerge,
+			setup: func(t *testing.T, rootDir string) {
+				createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+				createTestUsrKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+			},
+			opts: KernelCheckOptions{UsrMerge: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			test.setup(t, rootDir)
+
+			// The default options don't run the check, even though the image has a problem that it would report.
+			results, _ := runKernelHealthChecks(rootDir, DefaultKernelCheckOptions())
+			for _, result := range results {
+				assert.NotEqual(t, test.name, result.Name)
+			}
+
+			results, _ = runKernelHealthChecks(rootDir, test.opts)
+			if assert.Len(t, results, 1) {
+				assert.Equal(t, test.name, results[0].Name)
+				assert.NotEqual(t, CheckStatusPass, results[0].Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// VerifyKernelLock checks that the set of kernels installed in the image exactly matches the kernels listed in the
+// lockfile 'lockfilePath', which is a path on the build host.
+//
+// The lockfile lists one kernel version (e.g. "6.6.47.1-1.azl3") per line. Blank lines and lines starting with '#' are
+// ignored.
+func VerifyKernelLock(imageChroot *safechroot.Chroot, lockfilePath string) error {
+	return verifyKernelLock(imageChroot.RootDir(), lockfilePath)
+}
+
+func verifyKernelLock(rootDir string, lockfilePath string) error {
+	lockedKernels, err := readKernelLockfile(lockfilePath)
+	if err != nil {
+		return err
+	}
+
+	installedKernels, err := systemdependency.GetInstalledKernelVersions(rootDir)
+	if err != nil {
+		return err
+	}
+
+	installedSet := versioncompare.NewSet(installedKernels...)
+
+	missing := lockedKernels.Difference(installedSet)
+	extra := installedSet.Difference(lockedKernels)
+	if missing.Len() == 0 && extra.Len() == 0 {
+		return nil
+	}
+
+	problems := []string(nil)
+	if missing.Len() > 0 {
+		problems = append(problems, fmt.Sprintf("missing: %s", joinVersions(missing.Sorted())))
+	}
+	if extra.Len() > 0 {
+		problems = append(problems, fmt.Sprintf("extra: %s", joinVersions(extra.Sorted())))
+	}
+
+	return fmt.Errorf("installed kernels don't match kernel lockfile (%s): %s", lockfilePath,
+		strings.Join(problems, "; "))
+}
+
+// readKernelLockfile returns the set of kernel versions listed in the lockfile.
+func readKernelLockfile(lockfilePath string) (*versioncompare.Set, error) {
+	lockfile, err := os.Open(lockfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open kernel lockfile (%s):\n%w", lockfilePath, err)
+	}
+	defer lockfile.Close()
+
+	lockedKernels := versioncompare.NewSet()
+
+	scanner := bufio.NewScanner(lockfile)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		version, err := versioncompare.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kernel version in lockfile (%s) on line %d:\n%w", lockfilePath, lineNumber,
+				err)
+		}
+
+		lockedKernels.Add(version)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel lockfile (%s):\n%w", lockfilePath, err)
+	}
+
+	return lockedKernels, nil
+}
+
+// joinVersions returns a comma separated list of the versions.
+func joinVersions(versions []*versioncompare.TolerantVersion) string {
+	versionStrings := make([]string, len(versions))
+	for i, version := range versions {
+		versionStrings[i] = version.String()
+	}
+
+	return strings.Join(versionStrings, ", ")
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestKernelLockfile(t *testing.T, content string) string {
+	lockfilePath := filepath.Join(t.TempDir(), "kernel.lock")
+	createTestImageFile(t, filepath.Dir(lockfilePath), filepath.Base(lockfilePath), content)
+	return lockfilePath
+}
+
+func TestVerifyKernelLockMatch(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+
+	lockfilePath := createTestKernelLockfile(t, "# Pinned kernels\n6.6.51.1-1.azl3\n\n6.6.47.1-1.azl3\n")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	err := VerifyKernelLock(imageChroot, lockfilePath)
+	assert.NoError(t, err)
+}
+
+func TestVerifyKernelLockMissing(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	lockfilePath := createTestKernelLockfile(t, "6.6.47.1-1.azl3\n6.6.51.1-1.azl3\n")
+
+	err := verifyKernelLock(rootDir, lockfilePath)
+	assert.ErrorContains(t, err, "installed kernels don't match kernel lockfile")
+	assert.ErrorContains(t, err, ": missing: 6.6.51.1-1.azl3")
+	assert.NotContains(t, err.Error(), "extra")
+}
+
+func TestVerifyKernelLockExtra(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.9.1-1.azl3")
+
+	lockfilePath := createTestKernelLockfile(t, "6.6.47.1-1.azl3\n")
+
+	err := verifyKernelLock(rootDir, lockfilePath)
+	assert.ErrorContains(t, err, ": extra: 6.6.9.1-1.azl3, 6.6.51.1-1.azl3")
+	assert.NotContains(t, err.Error(), "missing")
+}
+
+func TestVerifyKernelLockMissingAndExtra(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	lockfilePath := createTestKernelLockfile(t, "6.6.51.1-1.azl3\n")
+
+	err := verifyKernelLock(rootDir, lockfilePath)
+	assert.ErrorContains(t, err, ": missing: 6.6.51.1-1.azl3; extra: 6.6.47.1-1.azl3")
+}
+
+func TestVerifyKernelLockInvalidLockfile(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	lockfilePath := createTestKernelLockfile(t, "6.6.47.1-1.azl3\n...\n")
+
+	err := verifyKernelLock(rootDir, lockfilePath)
+	assert.ErrorContains(t, err, "on line 2")
+
+	err = verifyKernelLock(rootDir, filepath.Join(t.TempDir(), "missing.lock"))
+	assert.ErrorContains(t, err, "failed to open kernel lockfile")
+}
@@ -0,0 +1,140 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+// maxReportedModuleAliasConflicts limits how many conflicts are logged or listed in the check's message, since a
+// kernel with a renamed driver can conflict on hundreds of device aliases.
+const maxReportedModuleAliasConflicts = 10
+
+// moduleAliasConflict is a module alias that loads different modules depending on which kernel is booted.
+type moduleAliasConflict struct {
+	Alias string
+	// The modules the alias maps to, keyed by kernel version. Each list is sorted.
+	KernelModules map[string][]string
+}
+
+func (c moduleAliasConflict) String() string {
+	kernels := make([]string, 0, len(c.KernelModules))
+	for kernel := range c.KernelModules {
+		kernels = append(kernels, kernel)
+	}
+	sort.Strings(kernels)
+
+	mappings := make([]string, 0, len(kernels))
+	for _, kernel := range kernels {
+		mappings = append(mappings, fmt.Sprintf("%s: %s", kernel, strings.Join(c.KernelModules[kernel], " ")))
+	}
+
+	return fmt.Sprintf("%s (%s)", c.Alias, strings.Join(mappings, "; "))
+}
+
+// checkModuleAliasConflicts warns about module aliases that map to different modules in different installed kernels.
+// For example, a device whose driver was renamed in a newer kernel. Config that refers to the module by name (e.g.
+// modprobe.d options or blacklists) then only applies to one of the kernels.
+//
+// Conflicts are only logged as warnings. An error is only returned if the image can't be read.
+func checkModuleAliasConflicts(imageChroot *safechroot.Chroot) error {
+	conflicts, err := findModuleAliasConflicts(imageChroot.RootDir())
+	if err != nil {
+		return err
+	}
+
+	if len(conflicts) <= 0 {
+		return nil
+	}
+
+	logged := conflicts[:min(len(conflicts), maxReportedModuleAliasConflicts)]
+	for _, conflict := range logged {
+		logger.Log.Warnf("Module alias maps to different modules across kernels: %s", conflict)
+	}
+
+	if len(conflicts) > len(logged) {
+		logger.Log.Warnf("%d more module aliases map to different modules across kernels", len(conflicts)-len(logged))
+	}
+
+	return nil
+}
+
+// findModuleAliasConflicts returns the module aliases that map to different modules across the installed kernels,
+// sorted by alias.
+//
+// Only aliases that exist in more than one kernel are compared, since aliases that are new in one kernel can't
+// conflict. Kernels without a modules.alias file are skipped.
+func findModuleAliasConflicts(rootDir string) ([]moduleAliasConflict, error) {
+	kernels, err := systemdependency.GetInstalledKernelStringVersions(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kernels) < 2 {
+		return nil, nil
+	}
+
+	// modules.alias files have tens of thousands of lines. So, only the first kernel's mapping of each alias is kept,
+	// and the other kernels' mappings are only stored for aliases that conflict. A kernel that agrees with the first
+	// kernel, and is read before the conflicting kernel, isn't listed in the conflict.
+	type aliasMapping struct {
+		kernel  string
+		modules []string
+	}
+
+	firstMappings := make(map[string]aliasMapping)
+	conflicts := make(map[string]*moduleAliasConflict)
+	for _, kernel := range kernels {
+		aliases, err := systemdependency.ReadKernelModulesAlias(rootDir, kernel)
+		if errors.Is(err, os.ErrNotExist) {
+			logger.Log.Debugf("Skipping module alias check for kernel (%s): no modules.alias file", kernel)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for alias, modules := range aliases {
+			sort.Strings(modules)
+
+			first, found := firstMappings[alias]
+			if !found {
+				firstMappings[alias] = aliasMapping{kernel: kernel, modules: modules}
+				continue
+			}
+
+			conflict, conflicting := conflicts[alias]
+			if !conflicting {
+				if slices.Equal(first.modules, modules) {
+					continue
+				}
+
+				conflict = &moduleAliasConflict{
+					Alias:         alias,
+					KernelModules: map[string][]string{first.kernel: first.modules},
+				}
+				conflicts[alias] = conflict
+			}
+
+			conflict.KernelModules[kernel] = modules
+		}
+	}
+
+	result := make([]moduleAliasConflict, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		result = append(result, *conflict)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Alias < result[j].Alias })
+
+	return result, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestModulesAlias(t *testing.T, rootDir string, version string, modulesAlias string) {
+	kernelDir := createTestKernelDir(t, rootDir, version)
+	createTestImageFile(t, rootDir, filepath.Join("/lib/modules", filepath.Base(kernelDir), "modules.alias"),
+		modulesAlias)
+}
+
+func TestFindModuleAliasConflicts(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestModulesAlias(t, rootDir, "6.6.47.1-1.azl3", `alias fs-virtiofs virtiofs
+alias pci:v00001AF4d00001000sv*sd*bc*sc*i* virtio-net
+alias pci:v000015B3d0000101Bsv*sd*bc*sc*i* mlx5_core
+`)
+	createTestModulesAlias(t, rootDir, "6.6.51.1-1.azl3", `# Module names are compared after normalization.
+alias fs-virtiofs virtiofs
+alias pci:v00001AF4d00001000sv*sd*bc*sc*i* virtio_net
+alias pci:v000015B3d0000101Bsv*sd*bc*sc*i* mlx5_core
+alias pci:v000015B3d0000101Bsv*sd*bc*sc*i* mlx5_vdpa
+alias pci:v00008086d00001889sv*sd*bc*sc*i* iavf
+`)
+	// Kernels without a modules.alias file are skipped.
+	createTestKernelDir(t, rootDir, "6.6.52.1-1.azl3")
+
+	conflicts, err := findModuleAliasConflicts(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []moduleAliasConflict{
+		{
+			Alias: "pci:v000015B3d0000101Bsv*sd*bc*sc*i*",
+			KernelModules: map[string][]string{
+				"6.6.47.1-1.azl3": {"mlx5_core"},
+				"6.6.51.1-1.azl3": {"mlx5_core", "mlx5_vdpa"},
+			},
+		},
+	}, conflicts)
+	assert.Equal(t, "pci:v000015B3d0000101Bsv*sd*bc*sc*i* "+
+		"(6.6.47.1-1.azl3: mlx5_core; 6.6.51.1-1.azl3: mlx5_core mlx5_vdpa)", conflicts[0].String())
+
+	// Conflicts only warn.
+	err = checkModuleAliasConflicts(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.NoError(t, err)
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{ModuleAliases: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, CheckStatusWarn, results[0].Status)
+		assert.Equal(t, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"}, results[0].Versions)
+		assert.Equal(t, "module aliases map to different modules across kernels: pci:v000015B3d0000101Bsv*sd*bc*sc*i* "+
+			"(6.6.47.1-1.azl3: mlx5_core; 6.6.51.1-1.azl3: mlx5_core mlx5_vdpa)", results[0].Message)
+	}
+}
+
+func TestFindModuleAliasConflictsInvalidFile(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestModulesAlias(t, rootDir, "6.6.47.1-1.azl3", "alias fs-virtiofs virtiofs\n")
+	createTestModulesAlias(t, rootDir, "6.6.51.1-1.azl3", "alias fs-virtiofs\n")
+
+	err := checkModuleAliasConflicts(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.ErrorContains(t, err, "invalid modules alias line (alias fs-virtiofs)")
+}
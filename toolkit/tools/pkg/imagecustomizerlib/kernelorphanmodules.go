@@ -0,0 +1,66 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+// checkOrphanModuleDirs warns about each kernel modules directory (i.e. /lib/modules/<ver>) that has no kernel binary,
+// config or initramfs in /boot. Such a directory wastes space and usually indicates that a kernel was only partially
+// removed. This is the inverse of the boot-consistency check, which flags kernels in /boot without a modules directory.
+//
+// Orphan directories are only logged as warnings. An error is only returned if the image can't be read. The check is
+// skipped for the build host's root, so that the host's kernel files are never reported as candidates for removal.
+func checkOrphanModuleDirs(imageChroot *safechroot.Chroot) error {
+	rootDir := imageChroot.RootDir()
+
+	if systemdependency.IsHostRootfs(rootDir) {
+		logger.Log.Infof("Skipping orphan kernel modules check: (%s) is the build host's root", rootDir)
+		return nil
+	}
+
+	skipped, result, err := skipIfNoBootDir(rootDir, KernelCheckOrphanModules)
+	if err != nil {
+		return err
+	}
+
+	if skipped {
+		logger.Log.Infof("Skipping orphan kernel modules check: %s", result.Message)
+		return nil
+	}
+
+	orphans, err := findOrphanModuleDirs(rootDir)
+	if err != nil {
+		return err
+	}
+
+	if len(orphans) > 0 {
+		logger.Log.Warnf("Kernel modules directories have no /boot files: %s", strings.Join(orphans, ", "))
+	}
+
+	return nil
+}
+
+// findOrphanModuleDirs returns the kernels that have a modules directory but don't have any files in /boot.
+func findOrphanModuleDirs(rootDir string) ([]string, error) {
+	bootSet, err := getKernelBootSet(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := []string(nil)
+	for _, artifacts := range bootSet {
+		if artifacts.ModulesDir != "" && artifacts.Vmlinuz == "" && artifacts.Config == "" &&
+			artifacts.Initramfs == "" {
+			orphans = append(orphans, artifacts.Version)
+		}
+	}
+
+	return orphans, nil
+}
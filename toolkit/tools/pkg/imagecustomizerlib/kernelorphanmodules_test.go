@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestOrphanModulesImage creates an image with a complete kernel, a kernel with only a config in /boot and an
+// orphan modules directory.
+func createTestOrphanModulesImage(t *testing.T) string {
+	rootDir := t.TempDir()
+
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "initramfs-6.6.51.1-1.azl3.img")
+
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "config-6.6.47.1-1.azl3")
+
+	createTestKernelDir(t, rootDir, "6.6.9.1-1.azl3")
+
+	return rootDir
+}
+
+func TestFindOrphanModuleDirs(t *testing.T) {
+	rootDir := createTestOrphanModulesImage(t)
+
+	orphans, err := findOrphanModuleDirs(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.9.1-1.azl3"}, orphans)
+}
+
+func TestFindOrphanModuleDirsNone(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.51.1-1.azl3")
+
+	orphans, err := findOrphanModuleDirs(rootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, orphans)
+}
+
+func TestCheckOrphanModuleDirs(t *testing.T) {
+	// Orphan modules directories only warn.
+	rootDir := createTestOrphanModulesImage(t)
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	err := checkOrphanModuleDirs(imageChroot)
+	assert.NoError(t, err)
+
+	// Images without a /boot directory are skipped.
+	err = checkOrphanModuleDirs(safechroot.NewChroot(t.TempDir(), true /*isExistingDir*/))
+	assert.NoError(t, err)
+}
+
+func TestCheckOrphanModuleDirsHostRoot(t *testing.T) {
+	err := checkOrphanModuleDirs(safechroot.NewChroot("/", true /*isExistingDir*/))
+	assert.NoError(t, err)
+}
+
+func TestRunKernelHealthChecksOrphanModules(t *testing.T) {
+	rootDir := createTestOrphanModulesImage(t)
+
+	// Orphan modules directories only warn.
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{OrphanModules: true})
+	assert.NoError(t, err)
+
+	result := findCheckResult(t, results, KernelCheckOrphanModules)
+	assert.Equal(t, CheckStatusWarn, result.Status)
+	assert.Equal(t, "kernel modules directory has no /boot files: 6.6.9.1-1.azl3", result.Message)
+	assert.Equal(t, []string{"6.6.9.1-1.azl3"}, result.Versions)
+}
+
+func TestRunKernelHealthChecksOrphanModulesNoBootDir(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{OrphanModules: true})
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusSkipped, findCheckResult(t, results, KernelCheckOrphanModules).Status)
+}
+
+func TestRunKernelHealthChecksOrphanModulesHostRoot(t *testing.T) {
+	// The build host's kernels must never be reported as candidates for removal.
+	results, err := runKernelHealthChecks("/", KernelCheckOptions{OrphanModules: true})
+	assert.NoError(t, err)
+
+	result := findCheckResult(t, results, KernelCheckOrphanModules)
+	assert.Equal(t, CheckStatusSkipped, result.Status)
+	assert.Equal(t, "not run against the build host's root", result.Message)
+	assert.True(t, result.Host)
+
+	results, err = runKernelHealthChecks(createTestOrphanModulesImage(t), KernelCheckOptions{OrphanModules: true})
+	assert.NoError(t, err)
+	assert.False(t, findCheckResult(t, results, KernelCheckOrphanModules).Host)
+}
@@ -0,0 +1,202 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/shell"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+const (
+	rpmQueryProgramPath  = "/usr/bin/rpm"
+	dpkgQueryProgramPath = "/usr/bin/dpkg-query"
+
+	// debianChangelogTrailerPrefix starts the line of a Debian changelog entry that holds the maintainer and date.
+	// For example: " -- Ubuntu Kernel <kernel-team@lists.ubuntu.com>  Mon, 08 Jul 2024 11:31:04 +0000".
+	debianChangelogTrailerPrefix = " -- "
+)
+
+// ErrKernelNotPackageOwned is returned when an installed kernel's files are not owned by any package.
+var ErrKernelNotPackageOwned = errors.New("kernel is not owned by any package")
+
+// packageQueryFunc runs a package manager query within the chroot.
+type packageQueryFunc func(imageChroot *safechroot.Chroot, program string, args ...string) (stdout string,
+	stderr string, err error)
+
+// runPackageQuery can be replaced by tests to mock the package manager's output.
+var runPackageQuery packageQueryFunc = runChrootPackageQuery
+
+func runChrootPackageQuery(imageChroot *safechroot.Chroot, program string, args ...string) (stdout string,
+	stderr string, err error,
+) {
+	err = imageChroot.UnsafeRun(func() error {
+		var queryErr error
+		stdout, stderr, queryErr = shell.Execute(program, args...)
+		return queryErr
+	})
+	return stdout, stderr, err
+}
+
+// GetKernelBuildTime returns the build timestamp of the package that installed the kernel 'version'.
+//
+// For RPM based images, this is the package's BUILDTIME tag. For Debian based images, which don't record a build time,
+// the date of the package's most recent changelog entry is used instead. ErrKernelNotPackageOwned is returned if the
+// kernel's modules directory isn't owned by any package.
+func GetKernelBuildTime(imageChroot *safechroot.Chroot, version *versioncompare.TolerantVersion) (time.Time, error) {
+	kernelDir := filepath.Join(systemdependency.KernelModulesDir, version.String())
+
+	rpmExists, err := file.PathExists(filepath.Join(imageChroot.RootDir(), rpmQueryProgramPath))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to check if rpm is installed:\n%w", err)
+	}
+
+	if rpmExists {
+		return getRpmKernelBuildTime(imageChroot, version, kernelDir)
+	}
+
+	dpkgExists, err := file.PathExists(filepath.Join(imageChroot.RootDir(), dpkgQueryProgramPath))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to check if dpkg is installed:\n%w", err)
+	}
+
+	if dpkgExists {
+		return getDpkgKernelBuildTime(imageChroot, version, kernelDir)
+	}
+
+	return time.Time{}, fmt.Errorf("failed to get kernel (%s) build time:\nno supported package manager found", version)
+}
+
+func getRpmKernelBuildTime(imageChroot *safechroot.Chroot, version *versioncompare.TolerantVersion, kernelDir string,
+) (time.Time, error) {
+	stdout, stderr, err := runPackageQuery(imageChroot, "rpm", "-qf", "--queryformat", "%{BUILDTIME}\n", kernelDir)
+	if err != nil {
+		// rpm reports unowned files on stdout and exits with a non-zero code.
+		if strings.Contains(stdout, "is not owned by any package") {
+			return time.Time{}, fmt.Errorf("failed to get kernel (%s) build time:\n%w", version, ErrKernelNotPackageOwned)
+		}
+		return time.Time{}, fmt.Errorf("failed to query rpm for kernel (%s) package:\n%v\n%w", version, stderr, err)
+	}
+
+	buildTime, err := parseRpmBuildTime(stdout)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get kernel (%s) build time:\n%w", version, err)
+	}
+
+	return buildTime, nil
+}
+
+// parseRpmBuildTime parses the output of an rpm '%{BUILDTIME}' query. A directory may be owned by more than one package
+// (e.g. kernel and kernel-modules-extra), in which case the first package's build time is used.
+func parseRpmBuildTime(output string) (time.Time, error) {
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	firstLine = strings.TrimSpace(firstLine)
+
+	seconds, err := strconv.ParseInt(firstLine, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid rpm build time (%s):\n%w", firstLine, err)
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+func getDpkgKernelBuildTime(imageChroot *safechroot.Chroot, version *versioncompare.TolerantVersion, kernelDir string,
+) (time.Time, error) {
+	stdout, stderr, err := runPackageQuery(imageChroot, "dpkg-query", "-S", kernelDir)
+	if err != nil {
+		if strings.Contains(stderr, "no path found matching pattern") {
+			return time.Time{}, fmt.Errorf("failed to get kernel (%s) build time:\n%w", version, ErrKernelNotPackageOwned)
+		}
+		return time.Time{}, fmt.Errorf("failed to query dpkg for kernel (%s) package:\n%v\n%w", version, stderr, err)
+	}
+
+	packageName, err := parseDpkgOwningPackage(stdout)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get kernel (%s) build time:\n%w", version, err)
+	}
+
+	changelogPath := filepath.Join(imageChroot.RootDir(), "/usr/share/doc", packageName, "changelog.Debian.gz")
+	buildTime, err := readDebianChangelogTime(changelogPath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get kernel (%s) build time:\n%w", version, err)
+	}
+
+	return buildTime, nil
+}
+
+// parseDpkgOwningPackage parses the output of 'dpkg-query -S <path>', which has the format
+// "<package>[:<arch>][, <package>...]: <path>", and returns the first owning package.
+func parseDpkgOwningPackage(output string) (string, error) {
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+
+	packages, _, found := strings.Cut(firstLine, ": ")
+	if !found {
+		return "", fmt.Errorf("invalid dpkg-query output (%s)", firstLine)
+	}
+
+	packageName, _, _ := strings.Cut(packages, ",")
+	packageName, _, _ = strings.Cut(strings.TrimSpace(packageName), ":")
+	if packageName == "" {
+		return "", fmt.Errorf("invalid dpkg-query output (%s)", firstLine)
+	}
+
+	return packageName, nil
+}
+
+func readDebianChangelogTime(changelogPath string) (time.Time, error) {
+	changelogFile, err := os.Open(changelogPath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open package changelog (%s):\n%w", changelogPath, err)
+	}
+	defer changelogFile.Close()
+
+	reader, err := gzip.NewReader(changelogFile)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decompress package changelog (%s):\n%w", changelogPath, err)
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, debianChangelogTrailerPrefix) {
+			return parseDebianChangelogTrailer(line)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read package changelog (%s):\n%w", changelogPath, err)
+	}
+
+	return time.Time{}, fmt.Errorf("no entries found in package changelog (%s)", changelogPath)
+}
+
+// parseDebianChangelogTrailer parses the date of a changelog entry's trailer line. The date follows the maintainer's
+// email address and is separated from it by two spaces.
+func parseDebianChangelogTrailer(line string) (time.Time, error) {
+	_, date, found := strings.Cut(line, ">  ")
+	if !found {
+		return time.Time{}, fmt.Errorf("invalid changelog trailer line (%s)", line)
+	}
+
+	changelogTime, err := time.Parse(time.RFC1123Z, strings.TrimSpace(date))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid changelog date (%s):\n%w", date, err)
+	}
+
+	return changelogTime.UTC(), nil
+}
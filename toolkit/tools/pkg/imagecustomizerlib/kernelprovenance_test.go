@@ -0,0 +1,133 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDebianChangelog = `linux-signed-azure (5.15.0-1064.73) jammy; urgency=medium
+
+  * Main version: 5.15.0-1064.73
+
+ -- Ubuntu Kernel Bot <kernel-team@lists.ubuntu.com>  Fri, 24 May 2024 13:45:12 +0200
+
+linux-signed-azure (5.15.0-1063.72) jammy; urgency=medium
+
+ -- Ubuntu Kernel Bot <kernel-team@lists.ubuntu.com>  Mon, 06 May 2024 10:00:00 +0000
+`
+
+// setTestPackageQuery replaces the package manager query with one that returns the provided output.
+func setTestPackageQuery(t *testing.T, stdout string, stderr string, err error) *[]string {
+	var args []string
+
+	originalQuery := runPackageQuery
+	runPackageQuery = func(imageChroot *safechroot.Chroot, program string, queryArgs ...string) (string, string,
+		error,
+	) {
+		args = append([]string{program}, queryArgs...)
+		return stdout, stderr, err
+	}
+	t.Cleanup(func() { runPackageQuery = originalQuery })
+
+	return &args
+}
+
+func createTestPackageManagerRoot(t *testing.T, programPath string) string {
+	rootDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(rootDir, filepath.Dir(programPath)), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(rootDir, programPath), nil, 0o755)
+	assert.NoError(t, err)
+
+	return rootDir
+}
+
+func TestGetKernelBuildTimeRpm(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, rpmQueryProgramPath)
+	args := setTestPackageQuery(t, "1723161960\n1723161960\n", "", nil)
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	buildTime, err := GetKernelBuildTime(imageChroot, versioncompare.New("6.6.47.1-1.azl3"))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1723161960, 0).UTC(), buildTime)
+	assert.Equal(t, []string{"rpm", "-qf", "--queryformat", "%{BUILDTIME}\n", "/lib/modules/6.6.47.1-1.azl3"}, *args)
+}
+
+func TestGetKernelBuildTimeRpmNotOwned(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, rpmQueryProgramPath)
+	setTestPackageQuery(t, "file /lib/modules/6.6.47.1-1.azl3 is not owned by any package\n", "",
+		fmt.Errorf("exit status 1"))
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	_, err := GetKernelBuildTime(imageChroot, versioncompare.New("6.6.47.1-1.azl3"))
+	assert.ErrorIs(t, err, ErrKernelNotPackageOwned)
+}
+
+func TestGetKernelBuildTimeRpmInvalidOutput(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, rpmQueryProgramPath)
+	setTestPackageQuery(t, "(none)\n", "", nil)
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	_, err := GetKernelBuildTime(imageChroot, versioncompare.New("6.6.47.1-1.azl3"))
+	assert.ErrorContains(t, err, "invalid rpm build time ((none))")
+}
+
+func TestGetKernelBuildTimeDpkg(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, dpkgQueryProgramPath)
+	args := setTestPackageQuery(t,
+		"linux-modules-5.15.0-1064-azure:amd64, linux-image-5.15.0-1064-azure: /lib/modules/5.15.0-1064-azure\n",
+		"", nil)
+
+	var changelog bytes.Buffer
+	writer := gzip.NewWriter(&changelog)
+	_, err := writer.Write([]byte(testDebianChangelog))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	docDir := filepath.Join(rootDir, "usr/share/doc/linux-modules-5.15.0-1064-azure")
+	err = os.MkdirAll(docDir, os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(docDir, "changelog.Debian.gz"), changelog.Bytes(), 0o644)
+	assert.NoError(t, err)
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	buildTime, err := GetKernelBuildTime(imageChroot, versioncompare.New("5.15.0-1064-azure"))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.May, 24, 11, 45, 12, 0, time.UTC), buildTime)
+	assert.Equal(t, []string{"dpkg-query", "-S", "/lib/modules/5.15.0-1064-azure"}, *args)
+}
+
+func TestGetKernelBuildTimeDpkgNotOwned(t *testing.T) {
+	rootDir := createTestPackageManagerRoot(t, dpkgQueryProgramPath)
+	setTestPackageQuery(t, "", "dpkg-query: no path found matching pattern /lib/modules/5.15.0-1064-azure\n",
+		fmt.Errorf("exit status 1"))
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	_, err := GetKernelBuildTime(imageChroot, versioncompare.New("5.15.0-1064-azure"))
+	assert.ErrorIs(t, err, ErrKernelNotPackageOwned)
+}
+
+func TestGetKernelBuildTimeNoPackageManager(t *testing.T) {
+	imageChroot := safechroot.NewChroot(t.TempDir(), true /*isExistingDir*/)
+
+	_, err := GetKernelBuildTime(imageChroot, versioncompare.New("6.6.47.1-1.azl3"))
+	assert.ErrorContains(t, err, "no supported package manager found")
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+)
+
+// getReportBuildHostKernelVersion can be replaced by tests, so that the report doesn't depend on the build host.
+var getReportBuildHostKernelVersion = systemdependency.GetBuildHostKernelVersion
+
+// KernelReport is the JSON document written by WriteKernelReport.
+//
+// Each section records its own error, if any, instead of failing the whole report. So, a report is always written, even
+// for a badly broken image.
+type KernelReport struct {
+	BuildHost        KernelReportBuildHost        `json:"buildHost"`
+	InstalledKernels KernelReportInstalledKernels `json:"installedKernels"`
+	Checks           KernelReportChecks           `json:"checks"`
+	BootSet          KernelReportBootSet          `json:"bootSet"`
+}
+
+type KernelReportBuildHost struct {
+	KernelVersion *versioncompare.TolerantVersion `json:"kernelVersion,omitempty"`
+	Error         string                          `json:"error,omitempty"`
+}
+
+type KernelReportInstalledKernels struct {
+	Versions []*versioncompare.TolerantVersion `json:"versions"`
+	Error    string                            `json:"error,omitempty"`
+}
+
+type KernelReportChecks struct {
+	Results []CheckResult `json:"results"`
+	// Set if any of the checks failed.
+	Error string `json:"error,omitempty"`
+}
+
+// KernelReportBootSet lists the files of each kernel, which shows whether each kernel's files are consistent.
+type KernelReportBootSet struct {
+	Kernels []KernelBootArtifacts `json:"kernels"`
+	Error   string                `json:"error,omitempty"`
+}
+
+// WriteKernelReport writes a JSON document describing the kernel state of the image to 'w'. The document contains
+// the build host's kernel, the installed kernels, the results of the default kernel health checks, and the files of
+// each kernel.
+//
+// Errors found while collecting the report are recorded within the report. An error is only returned if the report
+// can't be written.
+func WriteKernelReport(w io.Writer, imageChroot *safechroot.Chroot) error {
+	return writeKernelReport(w, imageChroot.RootDir())
+}
+
+func writeKernelReport(w io.Writer, rootDir string) error {
+	report := getKernelReport(rootDir)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(report)
+	if err != nil {
+		return fmt.Errorf("failed to write kernel report:\n%w", err)
+	}
+
+	return nil
+}
+
+func getKernelReport(rootDir string) KernelReport {
+	report := KernelReport{}
+
+	buildHostVersion, err := getReportBuildHostKernelVersion()
+	report.BuildHost.KernelVersion = buildHostVersion
+	report.BuildHost.Error = errorString(err)
+
+	installedKernels, err := systemdependency.GetInstalledKernelVersions(rootDir)
+	report.InstalledKernels.Versions = installedKernels
+	report.InstalledKernels.Error = errorString(err)
+
+	checkResults, err := runKernelHealthChecks(rootDir, DefaultKernelCheckOptions())
+	report.Checks.Results = checkResults
+	report.Checks.Error = errorString(err)
+
+	bootSet, err := getKernelBootSet(rootDir)
+	report.BootSet.Kernels = bootSet
+	report.BootSet.Error = errorString(err)
+
+	return report
+}
+
+// errorString returns the error's message, or an empty string if 'err' is nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
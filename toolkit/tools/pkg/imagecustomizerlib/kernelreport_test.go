@@ -0,0 +1,69 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/versioncompare"
+	"github.com/stretchr/testify/assert"
+)
+
+func stubReportBuildHostKernelVersion(t *testing.T, version *versioncompare.TolerantVersion, err error) {
+	originalGetVersion := getReportBuildHostKernelVersion
+	getReportBuildHostKernelVersion = func() (*versioncompare.TolerantVersion, error) {
+		return version, err
+	}
+	t.Cleanup(func() { getReportBuildHostKernelVersion = originalGetVersion })
+}
+
+func TestWriteKernelReport(t *testing.T) {
+	stubReportBuildHostKernelVersion(t, versioncompare.New("6.6.51.1-1.azl3"), nil)
+
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "initramfs-6.6.47.1-1.azl3.img")
+	createTestBootFile(t, rootDir, "config-6.6.47.1-1.azl3")
+
+	// Kernel without an initramfs.
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.51.1-1.azl3")
+
+	imageChroot := safechroot.NewChroot(rootDir, true /*isExistingDir*/)
+
+	buffer := bytes.Buffer{}
+	err := WriteKernelReport(&buffer, imageChroot)
+	assert.NoError(t, err)
+
+	expected, err := os.ReadFile(filepath.Join(testDir, "kernelreport/report.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), buffer.String())
+}
+
+func TestWriteKernelReportErrors(t *testing.T) {
+	stubReportBuildHostKernelVersion(t, nil, fmt.Errorf("uname failed"))
+
+	// An image without any kernels still produces a valid report.
+	buffer := bytes.Buffer{}
+	err := writeKernelReport(&buffer, t.TempDir())
+	assert.NoError(t, err)
+
+	report := KernelReport{}
+	err = json.Unmarshal(buffer.Bytes(), &report)
+	assert.NoError(t, err)
+	assert.Nil(t, report.BuildHost.KernelVersion)
+	assert.Equal(t, "uname failed", report.BuildHost.Error)
+	assert.Empty(t, report.InstalledKernels.Versions)
+	assert.Contains(t, report.InstalledKernels.Error, "failed to read installed kernels list")
+	assert.Contains(t, report.Checks.Error, "kernel health checks failed")
+	assert.NotEmpty(t, report.Checks.Results)
+	assert.Contains(t, report.BootSet.Error, "failed to read installed kernels list")
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+// checkRootDeviceDriverAvailable checks that each installed kernel can access the root device early in boot. That is,
+// the block device driver 'rootDriver' (e.g. "nvme", "hv_storvsc" or "virtio_blk") is either built into the kernel or
+// is a module included in the kernel's initramfs. Otherwise, the image fails to boot with a "cannot find root device"
+// error.
+func checkRootDeviceDriverAvailable(imageChroot *safechroot.Chroot, rootDriver string) error {
+	missing, err := findKernelsMissingRootDriver(imageChroot.RootDir(), rootDriver)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("root device driver (%s) isn't built-in or in the initramfs of kernels: %s", rootDriver,
+			strings.Join(missing, "; "))
+	}
+
+	return nil
+}
+
+// checkRootDriverHealth is the CheckResult equivalent of checkRootDeviceDriverAvailable.
+func checkRootDriverHealth(rootDir string, rootDriver string) (CheckResult, error) {
+	missing, err := findKernelsMissingRootDriver(rootDir, rootDriver)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	if len(missing) <= 0 {
+		return CheckResult{
+			Name:   BootCheckRootDriver,
+			Status: CheckStatusPass,
+		}, nil
+	}
+
+	versions := make([]string, len(missing))
+	for i, description := range missing {
+		versions[i], _, _ = strings.Cut(description, " ")
+	}
+
+	return CheckResult{
+		Name:   BootCheckRootDriver,
+		Status: CheckStatusFail,
+		Message: fmt.Sprintf("root device driver (%s) isn't built-in or in the initramfs of kernels: %s", rootDriver,
+			strings.Join(missing, ", ")),
+		Versions: versions,
+	}, nil
+}
+
+// findKernelsMissingRootDriver returns a description of each installed kernel that can't load 'rootDriver' early in
+// boot.
+func findKernelsMissingRootDriver(rootDir string, rootDriver string) ([]string, error) {
+	if rootDriver == "" {
+		return nil, fmt.Errorf("root device driver isn't specified")
+	}
+
+	kernels, err := systemdependency.GetInstalledKernelStringVersions(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string(nil)
+	for _, kernel := range kernels {
+		builtIn, err := systemdependency.IsKernelModuleBuiltIn(rootDir, kernel, rootDriver)
+		if err != nil {
+			return nil, err
+		}
+
+		if builtIn {
+			logger.Log.Debugf("Root device driver (%s) is built into kernel (%s)", rootDriver, kernel)
+			continue
+		}
+
+		initramfsPath, err := findKernelInitramfs(rootDir, kernel)
+		if err != nil {
+			return nil, err
+		}
+
+		if initramfsPath == "" {
+			missing = append(missing, fmt.Sprintf("%s (no initramfs)", kernel))
+			continue
+		}
+
+		modules, err := systemdependency.ListInitramfsModules(initramfsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if !modules[strings.ReplaceAll(rootDriver, "-", "_")] {
+			missing = append(missing, kernel)
+			continue
+		}
+
+		logger.Log.Debugf("Root device driver (%s) is in kernel (%s) initramfs", rootDriver, kernel)
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavaliercoder/go-cpio"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestInitramfs creates a gzip compressed initramfs for 'kernel' with an empty file for each of 'names'.
+func createTestInitramfs(t *testing.T, rootDir string, kernel string, names ...string) {
+	buffer := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&buffer)
+	cpioWriter := cpio.NewWriter(gzipWriter)
+	for _, name := range names {
+		err := cpioWriter.WriteHeader(&cpio.Header{Name: name, Mode: 0o644})
+		assert.NoError(t, err)
+	}
+
+	err := cpioWriter.Close()
+	assert.NoError(t, err)
+
+	err = gzipWriter.Close()
+	assert.NoError(t, err)
+
+	createTestImageFile(t, rootDir, filepath.Join(bootDir, "initramfs-"+kernel+".img"), buffer.String())
+}
+
+func TestFindKernelsMissingRootDriverBuiltIn(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	err := os.WriteFile(filepath.Join(kernelDir, "modules.builtin"), []byte("kernel/drivers/nvme/host/nvme.ko\n"),
+		0o644)
+	assert.NoError(t, err)
+
+	missing, err := findKernelsMissingRootDriver(rootDir, "nvme")
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestFindKernelsMissingRootDriverInInitramfs(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestInitramfs(t, rootDir, "6.6.47.1-1.azl3",
+		"usr/lib/modules/6.6.47.1-1.azl3/kernel/drivers/scsi/hv_storvsc.ko.xz")
+
+	missing, err := findKernelsMissingRootDriver(rootDir, "hv-storvsc")
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestFindKernelsMissingRootDriverMissing(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestInitramfs(t, rootDir, "6.6.47.1-1.azl3",
+		"usr/lib/modules/6.6.47.1-1.azl3/kernel/drivers/scsi/hv_storvsc.ko.xz")
+
+	missing, err := findKernelsMissingRootDriver(rootDir, "virtio_blk")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3 (no initramfs)"}, missing)
+
+	err = checkRootDeviceDriverAvailable(safechroot.NewChroot(rootDir, true /*isExistingDir*/), "virtio_blk")
+	assert.EqualError(t, err, "root device driver (virtio_blk) isn't built-in or in the initramfs of kernels: "+
+		"6.6.47.1-1.azl3; 6.6.51.1-1.azl3 (no initramfs)")
+
+	results, err := validateBootReadiness(rootDir, BootReadinessOptions{RootDeviceDriver: "virtio_blk"})
+	assert.ErrorContains(t, err, "boot readiness checks failed: root-driver")
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"}, results[0].Versions)
+		assert.Equal(t, "root device driver (virtio_blk) isn't built-in or in the initramfs of kernels: "+
+			"6.6.47.1-1.azl3, 6.6.51.1-1.azl3 (no initramfs)", results[0].Message)
+	}
+}
+
+func TestFindKernelsMissingRootDriverNoDriver(t *testing.T) {
+	_, err := findKernelsMissingRootDriver(t.TempDir(), "")
+	assert.ErrorContains(t, err, "root device driver isn't specified")
+}
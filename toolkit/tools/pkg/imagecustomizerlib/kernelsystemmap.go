@@ -0,0 +1,71 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/file"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+const systemMapPrefix = "System.map-"
+
+// checkSystemMapPresent warns about each installed kernel that doesn't have a /boot/System.map-<ver> file. The kernel
+// symbol map is used by debugging and crash analysis tools. Minimal images intentionally drop it. So, this check is
+// only useful for images meant for debugging, and isn't run by default.
+//
+// Missing files are only logged as warnings. An error is only returned if the image can't be read.
+func checkSystemMapPresent(imageChroot *safechroot.Chroot) error {
+	rootDir := imageChroot.RootDir()
+
+	skipped, result, err := skipIfNoBootDir(rootDir, KernelCheckSystemMap)
+	if err != nil {
+		return err
+	}
+
+	if skipped {
+		logger.Log.Infof("Skipping System.map check: %s", result.Message)
+		return nil
+	}
+
+	kernels, err := systemdependency.GetInstalledKernelStringVersions(rootDir)
+	if err != nil {
+		return err
+	}
+
+	missing, err := findKernelsMissingSystemMap(rootDir, kernels)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		logger.Log.Warnf("Kernels are missing System.map: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// findKernelsMissingSystemMap returns the kernels that don't have a System.map file in /boot.
+func findKernelsMissingSystemMap(rootDir string, kernels []string) ([]string, error) {
+	missing := []string(nil)
+	for _, kernel := range kernels {
+		systemMapPath := filepath.Join(rootDir, bootDir, systemMapPrefix+kernel)
+
+		exists, err := file.PathExists(systemMapPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if (%s) exists:\n%w", systemMapPath, err)
+		}
+
+		if !exists {
+			missing = append(missing, kernel)
+		}
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestSystemMapImage creates an image with one kernel that has a System.map and one kernel that doesn't.
+func createTestSystemMapImage(t *testing.T) string {
+	rootDir := t.TempDir()
+
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.51.1-1.azl3")
+	createTestBootFile(t, rootDir, "initramfs-6.6.51.1-1.azl3.img")
+	createTestBootFile(t, rootDir, "System.map-6.6.51.1-1.azl3")
+
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "vmlinuz-6.6.47.1-1.azl3")
+	createTestBootFile(t, rootDir, "initramfs-6.6.47.1-1.azl3.img")
+
+	return rootDir
+}
+
+func TestFindKernelsMissingSystemMap(t *testing.T) {
+	rootDir := createTestSystemMapImage(t)
+
+	missing, err := findKernelsMissingSystemMap(rootDir, []string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, missing)
+}
+
+func TestFindKernelsMissingSystemMapNone(t *testing.T) {
+	rootDir := createTestSystemMapImage(t)
+
+	missing, err := findKernelsMissingSystemMap(rootDir, []string{"6.6.51.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestCheckSystemMapPresent(t *testing.T) {
+	// Missing System.map files only warn.
+	imageChroot := safechroot.NewChroot(createTestSystemMapImage(t), true /*isExistingDir*/)
+
+	err := checkSystemMapPresent(imageChroot)
+	assert.NoError(t, err)
+
+	// No /boot directory.
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	err = checkSystemMapPresent(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.NoError(t, err)
+}
+
+func TestRunKernelHealthChecksSystemMap(t *testing.T) {
+	rootDir := createTestSystemMapImage(t)
+
+	// Missing System.map files only warn.
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{SystemMap: true})
+	assert.NoError(t, err)
+
+	result := findCheckResult(t, results, KernelCheckSystemMap)
+	assert.Equal(t, CheckStatusWarn, result.Status)
+	assert.Equal(t, "missing System.map: 6.6.47.1-1.azl3", result.Message)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, result.Versions)
+}
+
+func TestRunKernelHealthChecksSystemMapNoBootDir(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{SystemMap: true})
+	assert.NoError(t, err)
+	assert.Equal(t, CheckStatusSkipped, findCheckResult(t, results, KernelCheckSystemMap).Status)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/sliceutils"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+const usrKernelModulesDir = "/usr/lib/modules"
+
+// checkModulesUsrMergeConsistency warns if the image's /lib/modules and /usr/lib/modules directories hold different
+// sets of kernels.
+//
+// On usr-merged images, /lib (or /lib/modules) is a symlink to its /usr equivalent, so the two can't diverge. Images
+// part way through the usr-merge transition may instead have two real directories, one a copy of the other. If their
+// kernels differ, one of the copies is stale or corrupt, and which kernels are found depends on the path used.
+//
+// Images that only have one of the two directories are skipped. Divergence is only logged as a warning. An error is
+// only returned if the image can't be read.
+func checkModulesUsrMergeConsistency(imageChroot *safechroot.Chroot) error {
+	onlyInLib, onlyInUsr, err := findModulesUsrMergeDivergence(imageChroot.RootDir())
+	if err != nil {
+		return err
+	}
+
+	if len(onlyInLib) > 0 || len(onlyInUsr) > 0 {
+		logger.Log.Warnf("Kernel modules directories (%s) and (%s) have diverged:\n"+
+			"only in (%s): [%s]\nonly in (%s): [%s]",
+			systemdependency.KernelModulesDir, usrKernelModulesDir,
+			systemdependency.KernelModulesDir, strings.Join(onlyInLib, ", "),
+			usrKernelModulesDir, strings.Join(onlyInUsr, ", "))
+	}
+
+	return nil
+}
+
+// findModulesUsrMergeDivergence returns the kernels that are only in /lib/modules and the kernels that are only in
+// /usr/lib/modules. If both paths resolve to the same directory, or either doesn't exist, nothing is returned.
+func findModulesUsrMergeDivergence(rootDir string) ([]string, []string, error) {
+	libModulesDir, err := systemdependency.ResolvePathInRootfs(rootDir, systemdependency.KernelModulesDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve (%s):\n%w", systemdependency.KernelModulesDir, err)
+	}
+
+	usrModulesDir, err := systemdependency.ResolvePathInRootfs(rootDir, usrKernelModulesDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve (%s):\n%w", usrKernelModulesDir, err)
+	}
+
+	libInfo, err := os.Stat(libModulesDir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat (%s):\n%w", libModulesDir, err)
+	}
+
+	usrInfo, err := os.Stat(usrModulesDir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat (%s):\n%w", usrModulesDir, err)
+	}
+
+	if os.SameFile(libInfo, usrInfo) {
+		logger.Log.Debugf("Kernel modules directory (%s) is the same as (%s)", systemdependency.KernelModulesDir,
+			usrKernelModulesDir)
+		return nil, nil, nil
+	}
+
+	libKernels, err := getKernelSetInDir(libModulesDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usrKernels, err := getKernelSetInDir(usrModulesDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kernelSetDifference(libKernels, usrKernels), kernelSetDifference(usrKernels, libKernels), nil
+}
+
+// getKernelSetInDir returns the kernels in the kernel modules directory 'modulesDir', sorted by name.
+func getKernelSetInDir(modulesDir string) ([]string, error) {
+	kernels, err := systemdependency.GetInstalledKernelVersionsInDir(modulesDir, systemdependency.WithSkipUnparseable())
+	if err != nil {
+		return nil, err
+	}
+
+	kernelStrings := make([]string, len(kernels))
+	for i, kernel := range kernels {
+		kernelStrings[i] = kernel.String()
+	}
+
+	return kernelStrings, nil
+}
+
+// kernelSetDifference returns the kernels in 'a' that aren't in 'b'.
+func kernelSetDifference(a []string, b []string) []string {
+	difference := []string(nil)
+	for _, kernel := range a {
+		if !sliceutils.ContainsValue(b, kernel) {
+			difference = append(difference, kernel)
+		}
+	}
+
+	return difference
+}
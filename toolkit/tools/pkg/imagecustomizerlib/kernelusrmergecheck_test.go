@@ -0,0 +1,81 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/safechroot"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestUsrKernelDir creates a kernel under the image's /usr/lib/modules.
+func createTestUsrKernelDir(t *testing.T, rootDir string, version string) {
+	createTestImageFile(t, rootDir, filepath.Join("/usr/lib/modules", version, "modules.dep"), "")
+}
+
+func TestFindModulesUsrMergeDivergenceSymlinked(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestUsrKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	// An absolute symlink must be resolved within the image, not the build host.
+	err := os.Symlink("/usr/lib", filepath.Join(rootDir, "lib"))
+	assert.NoError(t, err)
+
+	onlyInLib, onlyInUsr, err := findModulesUsrMergeDivergence(rootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, onlyInLib)
+	assert.Empty(t, onlyInUsr)
+}
+
+func TestFindModulesUsrMergeDivergenceIdentical(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestUsrKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestUsrKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+
+	onlyInLib, onlyInUsr, err := findModulesUsrMergeDivergence(rootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, onlyInLib)
+	assert.Empty(t, onlyInUsr)
+}
+
+func TestFindModulesUsrMergeDivergenceDiverged(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestUsrKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestUsrKernelDir(t, rootDir, "6.6.57.1-1.azl3")
+
+	onlyInLib, onlyInUsr, err := findModulesUsrMergeDivergence(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.47.1-1.azl3"}, onlyInLib)
+	assert.Equal(t, []string{"6.6.57.1-1.azl3"}, onlyInUsr)
+
+	// Divergence only warns.
+	err = checkModulesUsrMergeConsistency(safechroot.NewChroot(rootDir, true /*isExistingDir*/))
+	assert.NoError(t, err)
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{UsrMerge: true})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, CheckStatusWarn, results[0].Status)
+		assert.Equal(t, []string{"6.6.47.1-1.azl3", "6.6.57.1-1.azl3"}, results[0].Versions)
+		assert.Contains(t, results[0].Message,
+			"only in (/lib/modules): [6.6.47.1-1.azl3], only in (/usr/lib/modules): [6.6.57.1-1.azl3]")
+	}
+}
+
+func TestFindModulesUsrMergeDivergenceNoUsrModules(t *testing.T) {
+	rootDir := t.TempDir()
+	createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+
+	onlyInLib, onlyInUsr, err := findModulesUsrMergeDivergence(rootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, onlyInLib)
+	assert.Empty(t, onlyInUsr)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/logger"
+	"github.com/microsoft/azurelinux/toolkit/tools/internal/systemdependency"
+)
+
+// checkKernelDirNameMatchesModules checks that the name of each /lib/modules/<ver> directory under 'rootfs' matches the
+// kernel release that its modules were built for (i.e. their vermagic). A mismatch means the module tree was
+// mis-staged, and the kernel will refuse to load the modules.
+//
+// This is best-effort: kernels whose modules can't be read (e.g. zstd compressed) are skipped.
+func checkKernelDirNameMatchesModules(rootfs string) error {
+	kernels, err := systemdependency.GetInstalledKernelStringVersions(rootfs)
+	if err != nil {
+		return err
+	}
+
+	_, descriptions, err := findKernelDirVermagicMismatches(rootfs, kernels)
+	if err != nil {
+		return err
+	}
+
+	if len(descriptions) > 0 {
+		return fmt.Errorf("kernel modules were built for a different kernel release: %s",
+			strings.Join(descriptions, ", "))
+	}
+
+	return nil
+}
+
+// findKernelDirVermagicMismatches returns the kernels in 'kernels' whose modules were built for a different release,
+// along with a description of each mismatch. See checkKernelDirNameMatchesModules.
+func findKernelDirVermagicMismatches(rootfs string, kernels []string) (mismatched []string, descriptions []string,
+	err error,
+) {
+	for _, kernel := range kernels {
+		release, found, err := systemdependency.GetKernelModulesVermagic(rootfs, kernel)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !found {
+			logger.Log.Debugf("Skipping vermagic check of kernel (%s): no readable modules", kernel)
+			continue
+		}
+
+		if release != kernel {
+			mismatched = append(mismatched, kernel)
+			descriptions = append(descriptions, fmt.Sprintf("%s (modules built for %s)", kernel, release))
+		}
+	}
+
+	return mismatched, descriptions, nil
+}
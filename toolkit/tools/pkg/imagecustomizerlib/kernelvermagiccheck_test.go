@@ -0,0 +1,96 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestKernelModule writes a fake module file that has a vermagic modinfo entry.
+func createTestKernelModule(t *testing.T, kernelDir string, modulePath string, vermagic string) {
+	fullPath := filepath.Join(kernelDir, modulePath)
+	err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	content := "\x7fELF\x00license=GPL\x00vermagic=" + vermagic + " SMP preempt mod_unload modversions\x00"
+	err = os.WriteFile(fullPath, []byte(content), 0o644)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+}
+
+func TestFindKernelDirVermagicMismatchesNone(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelModule(t, kernelDir, "kernel/fs/ext4/ext4.ko", "6.6.47.1-1.azl3")
+
+	mismatched, descriptions, err := findKernelDirVermagicMismatches(rootDir, []string{"6.6.47.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Empty(t, mismatched)
+	assert.Empty(t, descriptions)
+}
+
+func TestFindKernelDirVermagicMismatchesMislabeled(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelModule(t, kernelDir, "kernel/fs/ext4/ext4.ko", "6.6.47.1-1.azl3")
+
+	// Modules of a different kernel were staged into this directory.
+	kernelDir = createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestKernelModule(t, kernelDir, "kernel/fs/ext4/ext4.ko", "6.6.44.1-1.azl3")
+
+	mismatched, descriptions, err := findKernelDirVermagicMismatches(rootDir,
+		[]string{"6.6.47.1-1.azl3", "6.6.51.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, mismatched)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3 (modules built for 6.6.44.1-1.azl3)"}, descriptions)
+}
+
+func TestFindKernelDirVermagicMismatchesUnreadable(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	err := os.WriteFile(filepath.Join(kernelDir, "ext4.ko.zst"), []byte("zstd"), 0o644)
+	assert.NoError(t, err)
+
+	mismatched, descriptions, err := findKernelDirVermagicMismatches(rootDir, []string{"6.6.47.1-1.azl3"})
+	assert.NoError(t, err)
+	assert.Empty(t, mismatched)
+	assert.Empty(t, descriptions)
+}
+
+func TestCheckKernelDirNameMatchesModules(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.47.1-1.azl3")
+	createTestKernelModule(t, kernelDir, "kernel/fs/ext4/ext4.ko", "6.6.47.1-1.azl3")
+
+	err := checkKernelDirNameMatchesModules(rootDir)
+	assert.NoError(t, err)
+
+	kernelDir = createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestKernelModule(t, kernelDir, "kernel/fs/ext4/ext4.ko", "6.6.44.1-1.azl3")
+
+	err = checkKernelDirNameMatchesModules(rootDir)
+	assert.EqualError(t, err, "kernel modules were built for a different kernel release: "+
+		"6.6.51.1-1.azl3 (modules built for 6.6.44.1-1.azl3)")
+}
+
+func TestRunKernelHealthChecksVermagic(t *testing.T) {
+	rootDir := t.TempDir()
+	kernelDir := createTestKernelDir(t, rootDir, "6.6.51.1-1.azl3")
+	createTestKernelModule(t, kernelDir, "kernel/fs/ext4/ext4.ko", "6.6.44.1-1.azl3")
+
+	results, err := runKernelHealthChecks(rootDir, KernelCheckOptions{Vermagic: true})
+	assert.ErrorContains(t, err, "kernel health checks failed: vermagic")
+
+	result := findCheckResult(t, results, KernelCheckVermagic)
+	assert.Equal(t, CheckStatusFail, result.Status)
+	assert.Equal(t, []string{"6.6.51.1-1.azl3"}, result.Versions)
+	assert.Contains(t, result.Message, "6.6.51.1-1.azl3 (modules built for 6.6.44.1-1.azl3)")
+}
@@ -50,6 +50,12 @@ func findPartitions(buildDir string, diskDevice string) ([]*safechroot.MountPoin
 	return mountPoints, nil
 }
 
+// isFileSystemDeviceType returns whether a device of the lsblk type can hold a file system that is listed in the fstab
+// file.
+func isFileSystemDeviceType(deviceType string) bool {
+	return deviceType == "part" || deviceType == "lvm" || isRaidDeviceType(deviceType)
+}
+
 func findSystemBootPartition(diskPartitions []diskutils.PartitionInfo) (*diskutils.PartitionInfo, error) {
 	// Look for all system boot partitions, including both EFI System Paritions (ESP) and BIOS boot partitions.
 	var bootPartitions []*diskutils.PartitionInfo
@@ -133,13 +139,13 @@ func findRootfsPartition(diskPartitions []diskutils.PartitionInfo, buildDir stri
 		diskPartition := diskPartitions[i]
 
 		// Skip over disk entries.
-		if diskPartition.Type != "part" {
+		if !isFileSystemDeviceType(diskPartition.Type) {
 			continue
 		}
 
 		// Skip over file-system types that can't be used for the rootfs partition.
 		switch diskPartition.FileSystemType {
-		case "ext2", "ext3", "ext4", "xfs":
+		case "ext2", "ext3", "ext4", "xfs", "btrfs":
 
 		default:
 			logger.Log.Debugf("Skip partition (%s) with unsupported rootfs filesystem type (%s)", diskPartition.Path,
@@ -327,6 +333,8 @@ func findPartition(mountIdType imagecustomizerapi.MountIdentifierType, mountId s
 			matches = partition.PartUuid == mountId
 		case imagecustomizerapi.MountIdentifierTypePartLabel:
 			matches = partition.PartLabel == mountId
+		case imagecustomizerapi.MountIdentifierTypeDefault:
+			matches = partition.Path == mountId
 		}
 		if matches {
 			matchedPartitionIndexes = append(matchedPartitionIndexes, i)
@@ -364,6 +372,11 @@ func parseSourcePartition(source string) (imagecustomizerapi.MountIdentifierType
 		return imagecustomizerapi.MountIdentifierTypePartLabel, partLabel, nil
 	}
 
+	if strings.HasPrefix(source, imagecustomizerapi.DeviceMapperPath+"/") {
+		// Logical volumes are referenced by their device path.
+		return imagecustomizerapi.MountIdentifierTypeDefault, source, nil
+	}
+
 	err := fmt.Errorf("unknown fstab source type (%s)", source)
 	return imagecustomizerapi.MountIdentifierTypeDefault, "", err
 }
@@ -136,6 +136,25 @@ func partitionSettingsToImager(fileSystems []imagecustomizerapi.FileSystem,
 			return nil, err
 		}
 		imagerPartitionSettings = append(imagerPartitionSettings, imagerPartitionSetting)
+
+		// Each mounted btrfs subvolume gets its own fstab entry for the filesystem's partition.
+		for _, subvolume := range fileSystem.Subvolumes {
+			if subvolume.MountPoint == nil {
+				continue
+			}
+
+			imagerMountIdentifierType, err := mountIdentifierTypeToImager(subvolume.MountPoint.IdType)
+			if err != nil {
+				return nil, err
+			}
+
+			imagerPartitionSettings = append(imagerPartitionSettings, configuration.PartitionSetting{
+				ID:              fileSystem.PartitionId,
+				MountIdentifier: imagerMountIdentifierType,
+				MountOptions:    subvolume.MountOptions(),
+				MountPoint:      subvolume.MountPoint.Path,
+			})
+		}
 	}
 	return imagerPartitionSettings, nil
 }
@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"debug/pe"
+	"fmt"
+	"strings"
+)
+
+// The PE sections of a Unified Kernel Image (UKI), as defined by the UAPI group's UKI specification.
+const (
+	ukiLinuxSection  = ".linux"
+	ukiInitrdSection = ".initrd"
+	ukiUnameSection  = ".uname"
+)
+
+// ukiInfo describes a Unified Kernel Image (UKI).
+type ukiInfo struct {
+	// The kernel release (i.e. uname -r) from the .uname section. Empty if the UKI doesn't have the section, which is
+	// optional.
+	KernelRelease string
+	// Set if the UKI has an embedded initramfs.
+	HasInitrd bool
+}
+
+// readUki reads the UKI at the host path 'ukiPath'. An error is returned if the file isn't a PE file or doesn't have a
+// kernel (i.e. a non-empty .linux section).
+func readUki(ukiPath string) (ukiInfo, error) {
+	peFile, err := pe.Open(ukiPath)
+	if err != nil {
+		return ukiInfo{}, fmt.Errorf("failed to read UKI (%s) as a PE file:\n%w", ukiPath, err)
+	}
+	defer peFile.Close()
+
+	linuxSection := peFile.Section(ukiLinuxSection)
+	if linuxSection == nil || linuxSection.Size <= 0 {
+		return ukiInfo{}, fmt.Errorf("invalid UKI (%s): missing kernel (%s) section", ukiPath, ukiLinuxSection)
+	}
+
+	info := ukiInfo{
+		HasInitrd: peFile.Section(ukiInitrdSection) != nil,
+	}
+
+	unameSection := peFile.Section(ukiUnameSection)
+	if unameSection != nil {
+		uname, err := unameSection.Data()
+		if err != nil {
+			return ukiInfo{}, fmt.Errorf("failed to read UKI (%s) section (%s):\n%w", ukiPath, ukiUnameSection, err)
+		}
+
+		// The section's raw data is padded to the file alignment with null bytes.
+		info.KernelRelease = strings.TrimSpace(strings.TrimRight(string(uname), "\x00"))
+	}
+
+	return info, nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package imagecustomizerlib
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPeSection struct {
+	name string
+	data []byte
+}
+
+// newTestPeFile returns a minimal PE file with the provided sections and no optional header.
+func newTestPeFile(t *testing.T, sections ...testPeSection) []byte {
+	const peHeaderOffset = 0x40
+
+	buf := bytes.Buffer{}
+
+	dosHeader := make([]byte, peHeaderOffset)
+	copy(dosHeader, "MZ")
+	binary.LittleEndian.PutUint32(dosHeader[0x3c:], peHeaderOffset)
+	buf.Write(dosHeader)
+	buf.WriteString("PE\x00\x00")
+
+	fileHeader := pe.FileHeader{
+		Machine:          pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections: uint16(len(sections)),
+	}
+	err := binary.Write(&buf, binary.LittleEndian, fileHeader)
+	assert.NoError(t, err)
+
+	dataOffset := uint32(buf.Len() + len(sections)*binary.Size(pe.SectionHeader32{}))
+	for _, section := range sections {
+		header := pe.SectionHeader32{
+			VirtualSize:      uint32(len(section.data)),
+			SizeOfRawData:    uint32(len(section.data)),
+			PointerToRawData: dataOffset,
+		}
+		copy(header.Name[:], section.name)
+
+		err = binary.Write(&buf, binary.LittleEndian, header)
+		assert.NoError(t, err)
+
+		dataOffset += uint32(len(section.data))
+	}
+
+	for _, section := range sections {
+		buf.Write(section.data)
+	}
+
+	return buf.Bytes()
+}
+
+func createTestUkiFile(t *testing.T, ukiPath string, sections ...testPeSection) {
+	err := os.MkdirAll(filepath.Dir(ukiPath), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(ukiPath, newTestPeFile(t, sections...), 0o644)
+	assert.NoError(t, err)
+}
+
+func TestReadUki(t *testing.T) {
+	ukiPath := filepath.Join(t.TempDir(), "azl.efi")
+	createTestUkiFile(t, ukiPath,
+		testPeSection{".osrel", []byte("ID=azurelinux\n")},
+		testPeSection{".uname", []byte("6.6.47.1-1.azl3\x00\x00\x00")},
+		testPeSection{".linux", []byte("kernel")},
+		testPeSection{".initrd", []byte("initrd")},
+	)
+
+	info, err := readUki(ukiPath)
+	assert.NoError(t, err)
+	assert.Equal(t, ukiInfo{KernelRelease: "6.6.47.1-1.azl3", HasInitrd: true}, info)
+}
+
+func TestReadUkiNoUname(t *testing.T) {
+	ukiPath := filepath.Join(t.TempDir(), "azl.efi")
+	createTestUkiFile(t, ukiPath, testPeSection{".linux", []byte("kernel")})
+
+	info, err := readUki(ukiPath)
+	assert.NoError(t, err)
+	assert.Equal(t, ukiInfo{}, info)
+}
+
+func TestReadUkiNoKernel(t *testing.T) {
+	ukiPath := filepath.Join(t.TempDir(), "azl.efi")
+	createTestUkiFile(t, ukiPath, testPeSection{".uname", []byte("6.6.47.1-1.azl3")})
+
+	_, err := readUki(ukiPath)
+	assert.ErrorContains(t, err, "missing kernel (.linux) section")
+}
+
+func TestReadUkiNotPeFile(t *testing.T) {
+	ukiPath := filepath.Join(t.TempDir(), "azl.efi")
+	err := os.WriteFile(ukiPath, []byte("not a PE file"), 0o644)
+	assert.NoError(t, err)
+
+	_, err = readUki(ukiPath)
+	assert.ErrorContains(t, err, "as a PE file")
+}